@@ -58,10 +58,10 @@ const (
 	DefaultRaftTickInterval = 200 * time.Millisecond
 )
 
-type lazyTLSConfig struct {
-	once      sync.Once
-	tlsConfig *tls.Config
-	err       error
+type lazyCertificateManager struct {
+	once sync.Once
+	cm   *security.CertificateManager
+	err  error
 }
 
 type lazyHTTPClient struct {
@@ -103,11 +103,9 @@ type Config struct {
 	// See https://github.com/grpc/grpc-go/issues/586.
 	HTTPAddr string
 
-	// clientTLSConfig is the loaded client TLS config. It is initialized lazily.
-	clientTLSConfig lazyTLSConfig
-
-	// serverTLSConfig is the loaded server TLS config. It is initialized lazily.
-	serverTLSConfig lazyTLSConfig
+	// certificateManager loads the certificates and hands out the client and
+	// server TLS configs. It is initialized lazily.
+	certificateManager lazyCertificateManager
 
 	// httpClient uses the client TLS config. It is initialized lazily.
 	httpClient lazyHTTPClient
@@ -197,9 +195,20 @@ func (cfg *Config) PGURL(user *url.Userinfo) (*url.URL, error) {
 	}, nil
 }
 
-// GetClientTLSConfig returns the client TLS config, initializing it if needed.
-// If Insecure is true, return a nil config, otherwise load a config based
-// on the SSLCert file. If SSLCert is empty, use a very permissive config.
+// GetCertificateManager returns the certificate manager, initializing it if
+// needed. The certificate manager loads the certificates at the SSLCA,
+// SSLCert and SSLCertKey paths and reloads them when they change.
+func (cfg *Config) GetCertificateManager() (*security.CertificateManager, error) {
+	cfg.certificateManager.once.Do(func() {
+		cfg.certificateManager.cm, cfg.certificateManager.err = security.NewCertificateManager(
+			cfg.SSLCA, cfg.SSLCert, cfg.SSLCertKey)
+	})
+	return cfg.certificateManager.cm, cfg.certificateManager.err
+}
+
+// GetClientTLSConfig returns the current client TLS config, initializing it
+// if needed. If Insecure is true, return a nil config, otherwise load a config
+// based on the SSLCert file. If SSLCert is empty, use a very permissive config.
 // TODO(marc): empty SSLCert should fail when client certificates are required.
 func (cfg *Config) GetClientTLSConfig() (*tls.Config, error) {
 	// Early out.
@@ -207,40 +216,35 @@ func (cfg *Config) GetClientTLSConfig() (*tls.Config, error) {
 		return nil, nil
 	}
 
-	cfg.clientTLSConfig.once.Do(func() {
-		cfg.clientTLSConfig.tlsConfig, cfg.clientTLSConfig.err = security.LoadClientTLSConfig(
-			cfg.SSLCA, cfg.SSLCert, cfg.SSLCertKey)
-		if cfg.clientTLSConfig.err != nil {
-			cfg.clientTLSConfig.err = errors.Errorf("error setting up client TLS config: %s", cfg.clientTLSConfig.err)
-		}
-	})
-
-	return cfg.clientTLSConfig.tlsConfig, cfg.clientTLSConfig.err
+	cm, err := cfg.GetCertificateManager()
+	if err != nil {
+		return nil, errors.Errorf("error setting up client TLS config: %s", err)
+	}
+	return cm.ClientTLSConfig(), nil
 }
 
-// GetServerTLSConfig returns the server TLS config, initializing it if needed.
-// If Insecure is true, return a nil config, otherwise load a config based
-// on the SSLCert file. Fails if Insecure=false and SSLCert="".
+// GetServerTLSConfig returns the current server TLS config, initializing it
+// if needed. If Insecure is true, return a nil config, otherwise load a config
+// based on the SSLCert file. Fails if Insecure=false and SSLCert="".
+//
+// The returned config serves the server certificate loaded last, but its
+// client CAs are fixed. Callers which establish connections over a long
+// period of time should call this method for every connection.
 func (cfg *Config) GetServerTLSConfig() (*tls.Config, error) {
 	// Early out.
 	if cfg.Insecure {
 		return nil, nil
 	}
 
-	cfg.serverTLSConfig.once.Do(func() {
-		if cfg.SSLCert != "" {
-			cfg.serverTLSConfig.tlsConfig, cfg.serverTLSConfig.err = security.LoadServerTLSConfig(
-				cfg.SSLCA, cfg.SSLCert, cfg.SSLCertKey)
-			if cfg.serverTLSConfig.err != nil {
-				cfg.serverTLSConfig.err = errors.Errorf("error setting up server TLS config: %s", cfg.serverTLSConfig.err)
-			}
-		} else {
-			cfg.serverTLSConfig.err = errors.Errorf("--%s=false, but --%s is empty. Certificates must be specified.",
-				cliflags.Insecure.Name, cliflags.Cert.Name)
-		}
-	})
-
-	return cfg.serverTLSConfig.tlsConfig, cfg.serverTLSConfig.err
+	if cfg.SSLCert == "" {
+		return nil, errors.Errorf("--%s=false, but --%s is empty. Certificates must be specified.",
+			cliflags.Insecure.Name, cliflags.Cert.Name)
+	}
+	cm, err := cfg.GetCertificateManager()
+	if err != nil {
+		return nil, errors.Errorf("error setting up server TLS config: %s", err)
+	}
+	return cm.ServerTLSConfig(), nil
 }
 
 // GetHTTPClient returns the http client, initializing it
@@ -266,5 +270,8 @@ func DefaultRetryOptions() retry.Options {
 		InitialBackoff: 50 * time.Millisecond,
 		MaxBackoff:     5 * time.Second,
 		Multiplier:     2,
+		// Spread out the retries of the many clients which typically fail at
+		// the same time, for example when a node goes down.
+		FullJitter: true,
 	}
 }
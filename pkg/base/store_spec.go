@@ -19,6 +19,7 @@ package base
 import (
 	"bytes"
 	"fmt"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -48,8 +49,27 @@ type StoreSpec struct {
 	SizePercent float64
 	InMemory    bool
 	Attributes  roachpb.Attributes
+	// EncryptionKey is the path to the key file used to encrypt the store's
+	// data files. Empty if the store is not encrypted.
+	EncryptionKey string
+	// OldEncryptionKeys are the paths to key files which were previously
+	// used to encrypt the store. They are needed to read files which have
+	// not yet been rewritten with the current key.
+	OldEncryptionKeys []string
+	// WALDir is the directory in which the store's write-ahead log is kept.
+	// Empty if the WAL is kept alongside the rest of the store's data.
+	WALDir string
+	// Engine is the storage engine backing the store, either
+	// StoreEngineRocksDB or StoreEngineGo. Empty selects RocksDB.
+	Engine string
 }
 
+// The storage engines which can back a store.
+const (
+	StoreEngineRocksDB = "rocksdb"
+	StoreEngineGo      = "go"
+)
+
 // String returns a fully parsable version of the store spec.
 func (ss StoreSpec) String() string {
 	var buffer bytes.Buffer
@@ -75,6 +95,18 @@ func (ss StoreSpec) String() string {
 		}
 		fmt.Fprintf(&buffer, ",")
 	}
+	if len(ss.EncryptionKey) > 0 {
+		fmt.Fprintf(&buffer, "enc-key=%s,", ss.EncryptionKey)
+	}
+	if len(ss.OldEncryptionKeys) > 0 {
+		fmt.Fprintf(&buffer, "enc-old-keys=%s,", strings.Join(ss.OldEncryptionKeys, ":"))
+	}
+	if len(ss.WALDir) > 0 {
+		fmt.Fprintf(&buffer, "wal-dir=%s,", ss.WALDir)
+	}
+	if len(ss.Engine) > 0 {
+		fmt.Fprintf(&buffer, "engine=%s,", ss.Engine)
+	}
 	// Trim the extra comma from the end if it exists.
 	if l := buffer.Len(); l > 0 {
 		buffer.Truncate(l - 1)
@@ -84,7 +116,7 @@ func (ss StoreSpec) String() string {
 
 // newStoreSpec parses the string passed into a --store flag and returns a
 // StoreSpec if it is correctly parsed.
-// There are four possible fields that can be passed in, comma separated:
+// There are eight possible fields that can be passed in, comma separated:
 // - path=xxx The directory in which to the rocks db instance should be
 //   located, required unless using a in memory storage.
 // - type=mem This specifies that the store is an in memory storage instead of
@@ -98,6 +130,17 @@ func (ss StoreSpec) String() string {
 //   - 20%             -> 20% of the available space
 //   - 0.2             -> 20% of the available space
 // - attrs=xxx:yyy:zzz A colon separated list of optional attributes.
+// - enc-key=xxx The path to a file containing the AES key (16, 24 or 32
+//   bytes) used to encrypt the store's data files.
+// - enc-old-keys=xxx:yyy A colon separated list of paths to keys which were
+//   previously used to encrypt the store. Files written with these keys are
+//   re-encrypted with the current key in the background.
+// - wal-dir=xxx The optional directory in which to keep the write-ahead log,
+//   typically on a separate low-latency device. It must be distinct from the
+//   store's path.
+// - engine=xxx The storage engine backing the store: rocksdb (the default) or
+//   go, a pure-Go engine which is slower but does not depend on RocksDB. The
+//   go engine does not support encryption or wal-dir.
 // Note that commas are forbidden within any field name or value.
 func newStoreSpec(value string) (StoreSpec, error) {
 	if len(value) == 0 {
@@ -191,6 +234,19 @@ func newStoreSpec(value string) (StoreSpec, error) {
 				ss.Attributes.Attrs = append(ss.Attributes.Attrs, attribute)
 			}
 			sort.Strings(ss.Attributes.Attrs)
+		case "enc-key":
+			ss.EncryptionKey = value
+		case "enc-old-keys":
+			ss.OldEncryptionKeys = strings.Split(value, ":")
+		case "wal-dir":
+			ss.WALDir = value
+		case "engine":
+			switch value = strings.ToLower(value); value {
+			case StoreEngineRocksDB, StoreEngineGo:
+				ss.Engine = value
+			default:
+				return StoreSpec{}, fmt.Errorf("%s is not a valid store engine", value)
+			}
 		case "type":
 			if value == "mem" {
 				ss.InMemory = true
@@ -209,8 +265,27 @@ func newStoreSpec(value string) (StoreSpec, error) {
 		if ss.SizePercent == 0 && ss.SizeInBytes == 0 {
 			return StoreSpec{}, fmt.Errorf("size must be specified for an in memory store")
 		}
+		if ss.EncryptionKey != "" || len(ss.OldEncryptionKeys) > 0 {
+			return StoreSpec{}, fmt.Errorf("encryption specified for in memory store")
+		}
+		if ss.WALDir != "" {
+			return StoreSpec{}, fmt.Errorf("wal-dir specified for in memory store")
+		}
 	} else if ss.Path == "" {
 		return StoreSpec{}, fmt.Errorf("no path specified")
+	} else if ss.WALDir != "" && filepath.Clean(ss.WALDir) == filepath.Clean(ss.Path) {
+		return StoreSpec{}, fmt.Errorf("wal-dir must be distinct from the store path")
+	}
+	if ss.EncryptionKey == "" && len(ss.OldEncryptionKeys) > 0 {
+		return StoreSpec{}, fmt.Errorf("old encryption keys specified without an encryption key")
+	}
+	if ss.Engine == StoreEngineGo {
+		if ss.EncryptionKey != "" {
+			return StoreSpec{}, fmt.Errorf("encryption is not supported by the go engine")
+		}
+		if ss.WALDir != "" {
+			return StoreSpec{}, fmt.Errorf("wal-dir is not supported by the go engine")
+		}
 	}
 	return ss, nil
 }
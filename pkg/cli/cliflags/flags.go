@@ -109,6 +109,33 @@ If left unspecified, defaults to 25% of the physical memory, or
 512MB if the memory size cannot be determined.`,
 	}
 
+	BackgroundRateLimit = FlagInfo{
+		Name: "background-rate-limit",
+		Description: `
+Maximum rate in bytes per second at which each store's background flushes
+and compactions may write to disk. Size suffixes are supported (e.g. 50MB
+and 50MiB). If left unspecified, background work is not throttled. The
+limit can be changed at runtime by an administrator with a POST request to
+the /debug/ratelimit/ endpoint.`,
+	}
+
+	LogSinks = FlagInfo{
+		Name: "log-sink",
+		Description: `
+A comma-separated list of destinations to which log entries are copied in
+addition to the log files. Each destination is one of:
+<PRE>
+
+  syslog              the local syslog daemon
+  syslog://host:port  a remote syslog daemon, over UDP
+  tcp://host:port     a network collector (such as fluentd), as JSON
+  udp://host:port     a network collector, as JSON over UDP
+
+</PRE>
+Entries are dropped rather than slowing down the server when a destination
+does not keep up.`,
+	}
+
 	ClientHost = FlagInfo{
 		Name:        "host",
 		EnvVar:      "COCKROACH_HOST",
@@ -176,8 +203,14 @@ An unspecified type means ip address or dns. Type is one of:
 <PRE>
 
   - tcp: (default if type is omitted): plain ip address or hostname.
-  - http-lb: HTTP load balancer: we query
-             http(s)://<address>/_status/details/local`,
+  - srv: DNS name whose SRV records list the nodes to join, for
+         example srv=_cockroach._tcp.example.com.
+  - lb: load balancer whose hostname resolves to the addresses of
+        the nodes to join, for example lb=cockroach.example.com:26257.
+
+</PRE>
+The addresses of srv and lb resolvers are looked up again
+periodically, so nodes added behind them are used for bootstrapping.`,
 	}
 
 	ServerHost = FlagInfo{
@@ -371,6 +404,14 @@ is the prefix for range local keys.`}
 		Description: `Print key and value sizes along with their associated key.`,
 	}
 
+	MaxOffset = FlagInfo{
+		Name: "max-offset",
+		Description: `
+The maximum clock offset between the nodes of the cluster. Nodes whose clocks
+are further apart terminate, so the value has to be the same on all the nodes
+of the cluster. Larger values make uncertainty restarts of reads more likely.`,
+	}
+
 	RaftTickInterval = FlagInfo{
 		Name: "raft-tick-interval",
 		Description: `
@@ -750,6 +750,30 @@ func runDebugSSTables(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+var debugEncryptionStatusCmd = &cobra.Command{
+	Use:   "encryption-status [directory]",
+	Short: "show the encryption status of a store",
+	Long: `
+Shows the number of files and bytes in a store encrypted with each key. Keys
+are identified by a hash of their contents. The store does not need to be
+opened and the keys do not need to be available.
+`,
+	RunE: maybeDecorateGRPCError(runDebugEncryptionStatus),
+}
+
+func runDebugEncryptionStatus(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return errors.New("one argument is required")
+	}
+
+	status, err := engine.ComputeEncryptionStatus(args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Println(status)
+	return nil
+}
+
 func init() {
 	debugCmd.AddCommand(debugCmds...)
 }
@@ -763,6 +787,7 @@ var debugCmds = []*cobra.Command{
 	debugCheckStoreCmd,
 	debugCompactCmd,
 	debugSSTablesCmd,
+	debugEncryptionStatusCmd,
 	kvCmd,
 	rangeCmd,
 	debugEnvCmd,
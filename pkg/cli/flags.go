@@ -46,6 +46,7 @@ var connURL, connUser, connHost, connPort, advertiseHost string
 var httpHost, httpPort, connDBName, zoneConfig string
 var zoneDisableReplication bool
 var startBackground bool
+var logSinks string
 var undoFreezeCluster bool
 
 var serverCfg = server.MakeConfig()
@@ -287,7 +288,9 @@ func init() {
 
 		varFlag(f, &serverCfg.Stores, cliflags.Store)
 		durationFlag(f, &serverCfg.RaftTickInterval, cliflags.RaftTickInterval, base.DefaultRaftTickInterval)
+		durationFlag(f, &serverCfg.MaxOffset, cliflags.MaxOffset, serverCfg.MaxOffset)
 		boolFlag(f, &startBackground, cliflags.Background, false)
+		stringFlag(f, &logSinks, cliflags.LogSinks, "")
 
 		// Usage for the unix socket is odd as we use a real file, whereas
 		// postgresql and clients consider it a directory and build a filename
@@ -315,6 +318,8 @@ func init() {
 
 		sqlSize = newBytesValue(&serverCfg.SQLMemoryPoolSize)
 		varFlag(f, sqlSize, cliflags.SQLMem)
+
+		varFlag(f, newBytesValue(&serverCfg.BackgroundRateLimit), cliflags.BackgroundRateLimit)
 	}
 
 	for _, cmd := range certCmds {
@@ -24,6 +24,7 @@ import (
 
 	"github.com/cockroachdb/cockroach/pkg/base"
 	"github.com/cockroachdb/cockroach/pkg/cli/cliflags"
+	"github.com/cockroachdb/cockroach/pkg/server"
 	"github.com/cockroachdb/cockroach/pkg/testutils/buildutil"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 )
@@ -108,6 +109,28 @@ func TestRaftTickIntervalFlagValue(t *testing.T) {
 	}
 }
 
+func TestMaxOffsetFlagValue(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	f := startCmd.Flags()
+	testData := []struct {
+		args     []string
+		expected time.Duration
+	}{
+		{nil, server.MakeConfig().MaxOffset},
+		{[]string{"--max-offset", "1s"}, time.Second},
+	}
+
+	for i, td := range testData {
+		if err := f.Parse(td.args); err != nil {
+			t.Fatal(err)
+		}
+		if td.expected != serverCfg.MaxOffset {
+			t.Errorf("%d. MaxOffset expected %s, but got %s", i, td.expected, serverCfg.MaxOffset)
+		}
+	}
+}
+
 func TestHttpHostFlagValue(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 
@@ -41,6 +41,7 @@ import (
 	"google.golang.org/grpc"
 
 	"github.com/cockroachdb/cockroach/pkg/build"
+	"github.com/cockroachdb/cockroach/pkg/cli/cliflags"
 	"github.com/cockroachdb/cockroach/pkg/rpc"
 	"github.com/cockroachdb/cockroach/pkg/security"
 	"github.com/cockroachdb/cockroach/pkg/server"
@@ -250,6 +251,35 @@ var ErrorCode = 1
 // storage devices ("stores") on this machine and --join as the list
 // of other active nodes used to join this node to the cockroach
 // cluster, if this is its first time connecting.
+// initLogSinks registers the sinks specified by the --log-sink flag. The
+// sinks stay registered until the process exits.
+func initLogSinks(specs string) error {
+	if specs == "" {
+		return nil
+	}
+	for _, spec := range strings.Split(specs, ",") {
+		var sink log.Sink
+		var err error
+		switch {
+		case spec == "syslog":
+			sink, err = log.NewSyslogSink("", "", "cockroach")
+		case strings.HasPrefix(spec, "syslog://"):
+			sink, err = log.NewSyslogSink("udp", strings.TrimPrefix(spec, "syslog://"), "cockroach")
+		case strings.HasPrefix(spec, "tcp://"):
+			sink = log.NewNetworkSink("tcp", strings.TrimPrefix(spec, "tcp://"))
+		case strings.HasPrefix(spec, "udp://"):
+			sink = log.NewNetworkSink("udp", strings.TrimPrefix(spec, "udp://"))
+		default:
+			return errors.Errorf("invalid --%s destination %q", cliflags.LogSinks.Name, spec)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "unable to open log sink %q", spec)
+		}
+		log.AddSink(sink, log.Severity_INFO, log.DefaultSinkBufferSize)
+	}
+	return nil
+}
+
 func runStart(_ *cobra.Command, args []string) error {
 	if startBackground {
 		return rerunBackground()
@@ -312,6 +342,10 @@ func runStart(_ *cobra.Command, args []string) error {
 		logDir = "."
 	}
 
+	if err := initLogSinks(logSinks); err != nil {
+		return err
+	}
+
 	// We log build information to stdout (for the short summary), but also
 	// to stderr to coincide with the full logs.
 	info := build.GetInfo()
@@ -445,6 +479,10 @@ func runStart(_ *cobra.Command, args []string) error {
 	case <-time.After(time.Minute):
 		returnErr = errors.New("time limit reached, initiating hard shutdown")
 		log.Errorf(context.TODO(), "%v", err)
+		log.Errorf(context.TODO(), "running tasks:\n%s", stopper.RunningTasks())
+		if stacks := stopper.RunningTaskStacks(); len(stacks) > 0 {
+			log.Errorf(context.TODO(), "stacks of running tasks:\n%s", stacks)
+		}
 		// NB: we do not return here to go through log.Flush below.
 	case <-stopper.IsStopped():
 		const msgDone = "server drained and shutdown completed"
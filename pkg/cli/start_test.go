@@ -75,3 +75,26 @@ func TestInitInsecure(t *testing.T) {
 		}
 	}
 }
+
+func TestInitLogSinksInvalid(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	testCases := []struct {
+		specs    string
+		expected string
+	}{
+		{"", ""},
+		{"bogus", `invalid --log-sink destination "bogus"`},
+		{"http://localhost:8080", `invalid --log-sink destination "http://localhost:8080"`},
+	}
+	for i, c := range testCases {
+		err := initLogSinks(c.specs)
+		if c.expected == "" {
+			if err != nil {
+				t.Fatalf("%d: expected success, but found %v", i, err)
+			}
+		} else if !testutils.IsError(err, c.expected) {
+			t.Fatalf("%d: expected %s, but found %v", i, c.expected, err)
+		}
+	}
+}
@@ -201,6 +201,80 @@ func (s SystemConfig) Hash() []byte {
 	return sha.Sum(nil)
 }
 
+// Diff returns the delta which transforms base into s. The delta
+// references base by its hash.
+func (s SystemConfig) Diff(base SystemConfig) SystemConfigDelta {
+	delta := SystemConfigDelta{BaseHash: base.Hash()}
+	i, j := 0, 0
+	for i < len(s.Values) || j < len(base.Values) {
+		var c int
+		switch {
+		case i == len(s.Values):
+			c = 1
+		case j == len(base.Values):
+			c = -1
+		default:
+			c = bytes.Compare(s.Values[i].Key, base.Values[j].Key)
+		}
+		switch {
+		case c < 0:
+			delta.Values = append(delta.Values, s.Values[i])
+			i++
+		case c > 0:
+			delta.DeletedKeys = append(delta.DeletedKeys, base.Values[j].Key)
+			j++
+		default:
+			if !bytes.Equal(s.Values[i].Value.RawBytes, base.Values[j].Value.RawBytes) {
+				delta.Values = append(delta.Values, s.Values[i])
+			}
+			i++
+			j++
+		}
+	}
+	return delta
+}
+
+// ApplyDelta returns the system config resulting from applying delta to
+// s. The caller is responsible for verifying that the delta's base hash
+// matches s.
+func (s SystemConfig) ApplyDelta(delta SystemConfigDelta) SystemConfig {
+	var deleted map[string]struct{}
+	if len(delta.DeletedKeys) > 0 {
+		deleted = make(map[string]struct{}, len(delta.DeletedKeys))
+		for _, key := range delta.DeletedKeys {
+			deleted[string(key)] = struct{}{}
+		}
+	}
+	values := make([]roachpb.KeyValue, 0, len(s.Values)+len(delta.Values))
+	i, j := 0, 0
+	for i < len(s.Values) || j < len(delta.Values) {
+		var c int
+		switch {
+		case i == len(s.Values):
+			c = 1
+		case j == len(delta.Values):
+			c = -1
+		default:
+			c = bytes.Compare(s.Values[i].Key, delta.Values[j].Key)
+		}
+		switch {
+		case c < 0:
+			if _, ok := deleted[string(s.Values[i].Key)]; !ok {
+				values = append(values, s.Values[i])
+			}
+			i++
+		case c > 0:
+			values = append(values, delta.Values[j])
+			j++
+		default:
+			values = append(values, delta.Values[j])
+			i++
+			j++
+		}
+	}
+	return SystemConfig{Values: values}
+}
+
 // GetValue searches the kv list for 'key' and returns its
 // roachpb.Value if found.
 func (s SystemConfig) GetValue(key roachpb.Key) *roachpb.Value {
@@ -132,6 +132,55 @@ func TestGet(t *testing.T) {
 	}
 }
 
+func TestDiffApplyDelta(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	testCases := []struct {
+		base, cfg   []roachpb.KeyValue
+		changed     []string
+		deletedKeys []string
+	}{
+		{nil, nil, nil, nil},
+		{nil, []roachpb.KeyValue{plainKV("a", "vala")}, []string{"a"}, nil},
+		{[]roachpb.KeyValue{plainKV("a", "vala")}, nil, nil, []string{"a"}},
+		{
+			[]roachpb.KeyValue{plainKV("a", "vala"), plainKV("c", "valc"), plainKV("d", "vald")},
+			[]roachpb.KeyValue{plainKV("a", "vala"), plainKV("c", "valc")},
+			nil, []string{"d"},
+		},
+		{
+			[]roachpb.KeyValue{plainKV("a", "vala"), plainKV("c", "valc"), plainKV("e", "vale")},
+			[]roachpb.KeyValue{plainKV("b", "valb"), plainKV("c", "valc2"), plainKV("e", "vale")},
+			[]string{"b", "c"}, []string{"a"},
+		},
+	}
+
+	for tcNum, tc := range testCases {
+		base := config.SystemConfig{Values: tc.base}
+		cfg := config.SystemConfig{Values: tc.cfg}
+		delta := cfg.Diff(base)
+		if !reflect.DeepEqual(delta.BaseHash, base.Hash()) {
+			t.Errorf("#%d: expected base hash %x, got %x", tcNum, base.Hash(), delta.BaseHash)
+		}
+		var changed, deletedKeys []string
+		for _, kv := range delta.Values {
+			changed = append(changed, string(kv.Key))
+		}
+		for _, key := range delta.DeletedKeys {
+			deletedKeys = append(deletedKeys, string(key))
+		}
+		if !reflect.DeepEqual(changed, tc.changed) {
+			t.Errorf("#%d: expected changed keys %v, got %v", tcNum, tc.changed, changed)
+		}
+		if !reflect.DeepEqual(deletedKeys, tc.deletedKeys) {
+			t.Errorf("#%d: expected deleted keys %v, got %v", tcNum, tc.deletedKeys, deletedKeys)
+		}
+		if applied := base.ApplyDelta(delta); !reflect.DeepEqual(applied.Hash(), cfg.Hash()) {
+			t.Errorf("#%d: expected %+v after applying delta, got %+v", tcNum, cfg, applied)
+		}
+	}
+}
+
 func TestGetLargestID(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	testCases := []struct {
@@ -0,0 +1,217 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package gossip
+
+import (
+	"fmt"
+	"regexp"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/metric"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+)
+
+// BatchCallback is a callback method to be invoked with the infos updated
+// since its previous invocation, keyed by gossip key. Only the latest value
+// of each key is delivered.
+type BatchCallback func(map[string]roachpb.Value)
+
+// BatchCallbackMetrics holds the queue metrics of the batch callbacks
+// registered under a name.
+type BatchCallbackMetrics struct {
+	Queued    *metric.Counter
+	Coalesced *metric.Counter
+	Pending   *metric.Gauge
+	Batches   *metric.Counter
+
+	// pending is the number of keys waiting for delivery, summed over the
+	// callbacks sharing the metrics. Accessed atomically.
+	pending *int64
+}
+
+// addPending adjusts the number of keys waiting for delivery.
+func (m BatchCallbackMetrics) addPending(delta int64) {
+	m.Pending.Update(atomic.AddInt64(m.pending, delta))
+}
+
+func makeBatchCallbackMetrics(name string) BatchCallbackMetrics {
+	return BatchCallbackMetrics{
+		Queued: metric.NewCounter(metric.Metadata{
+			Name: fmt.Sprintf("gossip.callbacks.%s.queued", name),
+			Help: fmt.Sprintf("Number of updates queued for the %s gossip callback", name)}),
+		Coalesced: metric.NewCounter(metric.Metadata{
+			Name: fmt.Sprintf("gossip.callbacks.%s.coalesced", name),
+			Help: fmt.Sprintf("Number of updates for the %s gossip callback superseded before delivery", name)}),
+		Pending: metric.NewGauge(metric.Metadata{
+			Name: fmt.Sprintf("gossip.callbacks.%s.pending", name),
+			Help: fmt.Sprintf("Number of keys with updates waiting for the %s gossip callback", name)}),
+		Batches: metric.NewCounter(metric.Metadata{
+			Name: fmt.Sprintf("gossip.callbacks.%s.batches", name),
+			Help: fmt.Sprintf("Number of batches delivered to the %s gossip callback", name)}),
+		pending: new(int64),
+	}
+}
+
+// batchCallback holds the regexp pattern match, BatchCallback method and
+// the updates queued for the next flush.
+type batchCallback struct {
+	matcher  stringMatcher
+	method   BatchCallback
+	interval time.Duration
+	metrics  BatchCallbackMetrics
+
+	mu struct {
+		syncutil.Mutex
+		pending map[string]roachpb.Value
+		// flushing is set while a flush is scheduled or running. At most one
+		// flush is in flight at a time, so batches are delivered in order.
+		flushing bool
+	}
+}
+
+// registerBatchCallback registers a batch callback for a key pattern.
+// The updates of matching infos are coalesced and delivered every
+// interval; all matching infos already in the infostore are delivered in
+// the first batch. Returns a function to unregister the callback. Note:
+// the callback may fire after being unregistered.
+func (is *infoStore) registerBatchCallback(
+	pattern string, interval time.Duration, method BatchCallback, metrics BatchCallbackMetrics,
+) func() {
+	var matcher stringMatcher
+	if pattern == ".*" {
+		matcher = allMatcher{}
+	} else {
+		matcher = regexp.MustCompile(pattern)
+	}
+	cb := &batchCallback{matcher: matcher, method: method, interval: interval, metrics: metrics}
+	cb.mu.pending = map[string]roachpb.Value{}
+	is.batchCallbacks = append(is.batchCallbacks, cb)
+	if err := is.visitInfos(func(key string, i *Info) error {
+		if matcher.MatchString(key) {
+			is.queueBatchCallback(cb, key, i.Value)
+		}
+		return nil
+	}); err != nil {
+		panic(err)
+	}
+
+	return func() {
+		for i, targetCB := range is.batchCallbacks {
+			if targetCB == cb {
+				numCBs := len(is.batchCallbacks)
+				is.batchCallbacks[i] = is.batchCallbacks[numCBs-1]
+				is.batchCallbacks = is.batchCallbacks[:numCBs-1]
+				break
+			}
+		}
+	}
+}
+
+// processBatchCallbacks queues the update of the specified key for every
+// batch callback whose pattern matches the key.
+func (is *infoStore) processBatchCallbacks(key string, content roachpb.Value) {
+	for _, cb := range is.batchCallbacks {
+		if cb.matcher.MatchString(key) {
+			is.queueBatchCallback(cb, key, content)
+		}
+	}
+}
+
+// queueBatchCallback queues an update for the batch callback, scheduling a
+// flush if none is in flight.
+func (is *infoStore) queueBatchCallback(cb *batchCallback, key string, content roachpb.Value) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if _, ok := cb.mu.pending[key]; ok {
+		cb.metrics.Coalesced.Inc(1)
+	} else {
+		cb.metrics.addPending(1)
+	}
+	cb.mu.pending[key] = content
+	cb.metrics.Queued.Inc(1)
+	if cb.mu.flushing {
+		return
+	}
+	cb.mu.flushing = true
+
+	if err := is.stopper.RunAsyncTask(context.Background(), func(_ context.Context) {
+		var timer timeutil.Timer
+		defer timer.Stop()
+		for {
+			timer.Reset(cb.interval)
+			select {
+			case <-timer.C:
+				timer.Read = true
+			case <-is.stopper.ShouldQuiesce():
+				return
+			}
+
+			cb.mu.Lock()
+			batch := cb.mu.pending
+			cb.mu.pending = map[string]roachpb.Value{}
+			cb.metrics.addPending(-int64(len(batch)))
+			cb.mu.Unlock()
+
+			cb.method(batch)
+			cb.metrics.Batches.Inc(1)
+
+			cb.mu.Lock()
+			if len(cb.mu.pending) == 0 {
+				cb.mu.flushing = false
+				cb.mu.Unlock()
+				return
+			}
+			cb.mu.Unlock()
+		}
+	}); err != nil {
+		cb.mu.flushing = false
+		ctx := is.AnnotateCtx(context.TODO())
+		log.Warning(ctx, err)
+	}
+}
+
+// RegisterBatchCallback registers a callback for a key pattern to be
+// invoked with the infos matching pattern which were updated during the
+// preceding interval. Multiple updates of a key within an interval are
+// coalesced into one, which avoids the per-info callback work of
+// RegisterCallback when many infos change at once. The queue metrics of
+// the callback are registered under the specified name and shared by all
+// the callbacks registered under that name, so registering callbacks
+// repeatedly does not grow the metric registry. Returns a function to
+// unregister the callback.
+func (g *Gossip) RegisterBatchCallback(
+	name string, pattern string, interval time.Duration, method BatchCallback,
+) func() {
+	g.mu.Lock()
+	metrics, ok := g.batchCallbackMetrics[name]
+	if !ok {
+		metrics = makeBatchCallbackMetrics(name)
+		g.batchCallbackMetrics[name] = metrics
+		g.registry.AddMetricStruct(metrics)
+	}
+	unregister := g.mu.is.registerBatchCallback(pattern, interval, method, metrics)
+	g.mu.Unlock()
+	return func() {
+		g.mu.Lock()
+		unregister()
+		g.mu.Unlock()
+	}
+}
@@ -35,6 +35,10 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 )
 
+// A StreamDialer opens a gossip stream to the node at addr. The stream is
+// closed when ctx is canceled.
+type StreamDialer func(ctx context.Context, addr net.Addr) (Gossip_GossipClient, error)
+
 // client is a client-side RPC connection to a gossip peer node.
 type client struct {
 	log.AmbientContext
@@ -44,6 +48,8 @@ type client struct {
 	addr                  net.Addr                 // Peer node network address
 	forwardAddr           *util.UnresolvedAddr     // Set if disconnected with an alternate addr
 	remoteHighWaterStamps map[roachpb.NodeID]int64 // Remote server's high water timestamps
+	verified              bool                     // Set once the peer passes the handshake
+	peerVersion           uint32                   // Peer's gossip protocol version; 0 until first gossip response
 	closer                chan struct{}            // Client shutdown channel
 	clientMetrics         Metrics
 	nodeMetrics           Metrics
@@ -106,12 +112,19 @@ func (c *client) start(
 			// asynchronous from the caller's perspective, so the only effect of
 			// `WithBlock` here is blocking shutdown - at the time of this writing,
 			// that ends ups up making `kv` tests take twice as long.
-			conn, err := rpcCtx.GRPCDial(c.addr.String())
-			if err != nil {
-				return err
-			}
-			if stream, err = NewGossipClient(conn).Gossip(ctx); err != nil {
-				return err
+			if g.streamDialer != nil {
+				var err error
+				if stream, err = g.streamDialer(ctx, c.addr); err != nil {
+					return err
+				}
+			} else {
+				conn, err := rpcCtx.GRPCDial(c.addr.String())
+				if err != nil {
+					return err
+				}
+				if stream, err = NewGossipClient(conn).Gossip(ctx); err != nil {
+					return err
+				}
 			}
 			return c.requestGossip(g, stream)
 		}, 0); err != nil {
@@ -124,6 +137,9 @@ func (c *client) start(
 		// Start gossiping.
 		log.Infof(ctx, "started gossip client to %s", c.addr)
 		if err := c.gossip(ctx, g, stream, stopper, &wg); err != nil {
+			if isHandshakeError(err) {
+				g.rejectAddr(c.addr, err)
+			}
 			if !grpcutil.IsClosedConnection(err) {
 				g.mu.Lock()
 				if c.peerID != 0 {
@@ -148,13 +164,15 @@ func (c *client) close() {
 
 // requestGossip requests the latest gossip from the remote server by
 // supplying a map of this node's knowledge of other nodes' high water
-// timestamps.
+// timestamps. The request carries no infos and serves as the handshake.
 func (c *client) requestGossip(g *Gossip, stream Gossip_GossipClient) error {
 	g.mu.Lock()
 	args := &Request{
 		NodeID:          g.NodeID.Get(),
 		Addr:            g.mu.is.NodeAddr,
 		HighWaterStamps: g.mu.is.getHighWaterStamps(),
+		ClusterID:       g.mu.clusterID,
+		ProtocolVersion: gossipProtocolVersion,
 	}
 	g.mu.Unlock()
 
@@ -167,34 +185,58 @@ func (c *client) requestGossip(g *Gossip, stream Gossip_GossipClient) error {
 
 // sendGossip sends the latest gossip to the remote server, based on
 // the remote server's notion of other nodes' high water timestamps.
+// Nothing is sent until the remote server has passed the handshake.
 func (c *client) sendGossip(g *Gossip, stream Gossip_GossipClient) error {
 	g.mu.Lock()
+	if !c.verified {
+		g.mu.Unlock()
+		return nil
+	}
 	if delta := g.mu.is.delta(c.remoteHighWaterStamps); len(delta) > 0 {
-		args := Request{
-			NodeID:          g.NodeID.Get(),
-			Addr:            g.mu.is.NodeAddr,
-			Delta:           delta,
-			HighWaterStamps: g.mu.is.getHighWaterStamps(),
+		ctx := c.AnnotateCtx(stream.Context())
+		batches, oversized := splitDelta(compressDelta(delta, c.peerVersion), maxDeltaBytes)
+		if len(oversized) > 0 {
+			log.Warningf(ctx, "sending infos exceeding %d bytes to %s individually: %s",
+				maxDeltaBytes, c.addr, oversized)
+		}
+		highWaterStamps := g.mu.is.getHighWaterStamps()
+
+		requests := make([]*Request, len(batches))
+		for i, batch := range batches {
+			args := &Request{
+				NodeID:          g.NodeID.Get(),
+				Addr:            g.mu.is.NodeAddr,
+				Delta:           batch,
+				HighWaterStamps: highWaterStamps,
+				ClusterID:       g.mu.clusterID,
+				ProtocolVersion: gossipProtocolVersion,
+			}
+			requests[i] = args
+
+			bytesSent := int64(args.Size())
+			infosSent := int64(len(batch))
+			c.clientMetrics.BytesSent.Inc(bytesSent)
+			c.clientMetrics.InfosSent.Inc(infosSent)
+			c.nodeMetrics.BytesSent.Inc(bytesSent)
+			c.nodeMetrics.InfosSent.Inc(infosSent)
 		}
-
-		bytesSent := int64(args.Size())
-		infosSent := int64(len(delta))
-		c.clientMetrics.BytesSent.Inc(bytesSent)
-		c.clientMetrics.InfosSent.Inc(infosSent)
-		c.nodeMetrics.BytesSent.Inc(bytesSent)
-		c.nodeMetrics.InfosSent.Inc(infosSent)
 
 		if log.V(1) {
-			ctx := c.AnnotateCtx(stream.Context())
 			if c.peerID != 0 {
-				log.Infof(ctx, "sending %s to node %d (%s)", extractKeys(args.Delta), c.peerID, c.addr)
+				log.Infof(ctx, "sending %s to node %d (%s)", extractKeys(delta), c.peerID, c.addr)
 			} else {
-				log.Infof(ctx, "sending %s to %s", extractKeys(args.Delta), c.addr)
+				log.Infof(ctx, "sending %s to %s", extractKeys(delta), c.addr)
 			}
 		}
 
 		g.mu.Unlock()
-		return stream.Send(&args)
+		// Critical infos are in the first batches; see splitDelta.
+		for _, args := range requests {
+			if err := stream.Send(args); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
 	g.mu.Unlock()
 	return nil
@@ -213,6 +255,17 @@ func (c *client) handleResponse(ctx context.Context, g *Gossip, reply *Response)
 	c.nodeMetrics.BytesReceived.Inc(bytesReceived)
 	c.nodeMetrics.InfosReceived.Inc(infosReceived)
 
+	// Verify that the remote node belongs to this node's cluster before
+	// accepting any of its infos.
+	if !c.verified {
+		if err := g.verifyHandshakeLocked(reply.NodeID, reply.ClusterID, reply.ProtocolVersion); err != nil {
+			return err
+		}
+		c.verified = true
+		g.acceptAddr(c.addr)
+	}
+	c.peerVersion = reply.ProtocolVersion
+
 	// Combine remote node's infostore delta with ours.
 	if reply.Delta != nil {
 		freshCount, err := g.mu.is.combine(reply.Delta, reply.NodeID)
@@ -293,7 +346,7 @@ func (c *client) gossip(
 		defer wg.Done()
 
 		errCh <- func() error {
-			for {
+			for first := true; ; first = false {
 				reply, err := stream.Recv()
 				if err != nil {
 					return err
@@ -301,6 +354,13 @@ func (c *client) gossip(
 				if err := c.handleResponse(ctx, g, reply); err != nil {
 					return err
 				}
+				// Send the infos held back until the handshake completed.
+				if first {
+					select {
+					case sendGossipChan <- struct{}{}:
+					default:
+					}
+				}
 			}
 		}()
 	})
@@ -110,7 +110,8 @@ func (s *fakeGossipServer) Gossip(stream Gossip_GossipServer) error {
 
 		if err := stream.Send(&Response{
 			// Just don't conflict with other nodes.
-			NodeID: math.MaxInt32,
+			NodeID:          math.MaxInt32,
+			ProtocolVersion: gossipProtocolVersion,
 		}); err != nil {
 			return err
 		}
@@ -164,7 +165,7 @@ func gossipSucceedsSoon(
 		select {
 		case client := <-disconnected:
 			// If the client wasn't able to connect, restart it.
-			client.start(gossip[client], disconnected, rpcContext, stopper, rpcContext.NewBreaker())
+			client.start(gossip[client], disconnected, rpcContext, stopper, rpcContext.NewBreaker("test"))
 		default:
 		}
 
@@ -300,7 +301,7 @@ func TestClientNodeID(t *testing.T) {
 			return
 		case <-disconnected:
 			// The client hasn't been started or failed to start, loop and try again.
-			c.start(local, disconnected, rpcContext, stopper, rpcContext.NewBreaker())
+			c.start(local, disconnected, rpcContext, stopper, rpcContext.NewBreaker("test"))
 		}
 	}
 }
@@ -527,6 +528,7 @@ func TestClientForwardUnresolved(t *testing.T) {
 		Addr:            *addr,
 		AlternateNodeID: nodeID + 1,
 		AlternateAddr:   &newAddr,
+		ProtocolVersion: gossipProtocolVersion,
 	}
 	if err := client.handleResponse(
 		context.TODO(), local, reply,
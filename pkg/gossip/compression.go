@@ -0,0 +1,111 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package gossip
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+
+	"github.com/cockroachdb/cockroach/pkg/util/envutil"
+	"github.com/cockroachdb/cockroach/pkg/util/humanizeutil"
+)
+
+// Infos are compressed with DEFLATE from the standard library rather than
+// with snappy. Only a few large infos (e.g. the system config) exceed the
+// compression threshold and they are sent rarely, so the better compression
+// ratio of DEFLATE is worth its cost in CPU, and unlike snappy's block
+// format, the size of a DEFLATE stream can be bounded while it is being
+// decompressed. Changing the codec requires a new gossip protocol version.
+
+// compressionThreshold is the size of the value of an info above which
+// the value is compressed with DEFLATE when the info is sent to a peer
+// which speaks compressedInfoVersion or later. Infos are stored
+// uncompressed, so compression is transparent to callers.
+var compressionThreshold = int(envutil.EnvOrDefaultBytes("COCKROACH_GOSSIP_COMPRESSION_THRESHOLD", 16<<10))
+
+// maxInfoSize is the maximum size of the value of an info. Adding a larger
+// info fails, and compressed infos received from peers which would
+// decompress to a larger size are rejected.
+var maxInfoSize = int(envutil.EnvOrDefaultBytes("COCKROACH_GOSSIP_MAX_INFO_SIZE", 16<<20))
+
+// errInfoTooLarge returns the error for an info of the specified size
+// which exceeds maxInfoSize.
+func errInfoTooLarge(key string, size int) error {
+	return errors.Errorf("gossip info %q of %s exceeds the maximum info size of %s",
+		key, humanizeutil.IBytes(int64(size)), humanizeutil.IBytes(int64(maxInfoSize)))
+}
+
+// compressDelta returns a copy of the delta to be sent to a peer speaking
+// the specified gossip protocol version, in which the values of infos
+// exceeding compressionThreshold are compressed. Peers which predate
+// compressedInfoVersion are sent the delta as is, and infos whose values
+// do not shrink are left as is.
+func compressDelta(delta map[string]*Info, peerVersion uint32) map[string]*Info {
+	if peerVersion < compressedInfoVersion {
+		return delta
+	}
+	compressed := make(map[string]*Info, len(delta))
+	for key, i := range delta {
+		compressed[key] = i
+		if i.Compressed || len(i.Value.RawBytes) <= compressionThreshold {
+			continue
+		}
+		var buf bytes.Buffer
+		w, err := flate.NewWriter(&buf, flate.BestSpeed)
+		if err != nil {
+			panic(err)
+		}
+		if _, err := w.Write(i.Value.RawBytes); err != nil {
+			panic(err)
+		}
+		if err := w.Close(); err != nil {
+			panic(err)
+		}
+		if buf.Len() >= len(i.Value.RawBytes) {
+			continue
+		}
+		infoCopy := *i
+		infoCopy.Value.RawBytes = buf.Bytes()
+		infoCopy.Compressed = true
+		compressed[key] = &infoCopy
+	}
+	return compressed
+}
+
+// decompressInfo decompresses the value of an info received from a peer
+// in place, if it is compressed.
+func decompressInfo(key string, i *Info) error {
+	if !i.Compressed {
+		return nil
+	}
+	// Read at most one byte more than the maximum info size in order to
+	// detect oversized infos without decompressing them in full.
+	r := flate.NewReader(bytes.NewReader(i.Value.RawBytes))
+	raw, err := ioutil.ReadAll(io.LimitReader(r, int64(maxInfoSize)+1))
+	if err != nil {
+		return errors.Wrapf(err, "failed to decompress gossip info %q", key)
+	}
+	if len(raw) > maxInfoSize {
+		return errors.Errorf("gossip info %q exceeds the maximum info size of %s once decompressed",
+			key, humanizeutil.IBytes(int64(maxInfoSize)))
+	}
+	i.Value.RawBytes = raw
+	i.Compressed = false
+	return nil
+}
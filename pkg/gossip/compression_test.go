@@ -0,0 +1,110 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package gossip
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/rpc"
+	"github.com/cockroachdb/cockroach/pkg/testutils"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/metric"
+	"github.com/cockroachdb/cockroach/pkg/util/stop"
+)
+
+// TestCompressDelta verifies that large infos are compressed in transit
+// and decompressed transparently when combined into the peer's infostore.
+func TestCompressDelta(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	is, stopper := newTestInfoStore()
+	defer stopper.Stop()
+
+	small := is.newInfo([]byte("small"), time.Hour)
+	large := is.newInfo(bytes.Repeat([]byte("x"), 2*compressionThreshold), time.Hour)
+	for key, i := range map[string]*Info{"small": small, "large": large} {
+		if err := is.addInfo(key, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Peers which predate compression are sent the infos as is.
+	if delta := compressDelta(is.delta(nil), compressedInfoVersion-1); delta["large"] != large {
+		t.Errorf("expected large info to be sent uncompressed to a legacy peer")
+	}
+
+	delta := compressDelta(is.delta(nil), compressedInfoVersion)
+	if delta["small"] != small {
+		t.Errorf("expected small info to be sent as is")
+	}
+	if c := delta["large"]; !c.Compressed || len(c.Value.RawBytes) >= len(large.Value.RawBytes) {
+		t.Errorf("expected large info to be compressed, got %d bytes", len(c.Value.RawBytes))
+	}
+	if large.Compressed {
+		t.Errorf("expected the stored info to remain uncompressed")
+	}
+
+	peer, peerStopper := newTestInfoStore()
+	defer peerStopper.Stop()
+	if _, err := peer.combine(delta, 1); err != nil {
+		t.Fatal(err)
+	}
+	i := peer.getInfo("large")
+	if i == nil || i.Compressed {
+		t.Fatalf("expected decompressed info, got %+v", i)
+	}
+	if err := i.Value.Verify([]byte("large")); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(i.Value.RawBytes, large.Value.RawBytes) {
+		t.Errorf("decompressed value does not match the original value")
+	}
+}
+
+// TestMaxInfoSize verifies that infos exceeding the maximum info size are
+// rejected both when added locally and when received from peers.
+func TestMaxInfoSize(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+	rpcContext := newInsecureRPCContext(stopper)
+	g := NewTest(1, rpcContext, rpc.NewServer(rpcContext), nil, stopper, metric.NewRegistry())
+
+	defer func(size int) { maxInfoSize = size }(maxInfoSize)
+	maxInfoSize = 4 * compressionThreshold
+
+	err := g.AddInfo("large", make([]byte, maxInfoSize), time.Hour)
+	if !testutils.IsError(err, "exceeds the maximum info size") {
+		t.Errorf("expected error adding large info, got %v", err)
+	}
+	if err := g.AddInfo("large", make([]byte, maxInfoSize/2), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	// A peer with a lower limit rejects the info.
+	g.mu.Lock()
+	delta := compressDelta(g.mu.is.delta(nil), gossipProtocolVersion)
+	g.mu.Unlock()
+	maxInfoSize /= 4
+	peer, peerStopper := newTestInfoStore()
+	defer peerStopper.Stop()
+	if _, err := peer.combine(delta, 1); !testutils.IsError(err, "exceeds the maximum info size") {
+		t.Errorf("expected error combining large info, got %v", err)
+	}
+	if i := peer.getInfo("large"); i != nil {
+		t.Errorf("expected large info to be rejected, got %+v", i)
+	}
+}
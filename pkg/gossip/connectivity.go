@@ -0,0 +1,253 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package gossip
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+)
+
+const (
+	// clientsRefreshInterval is the interval at which a node regossips its
+	// outgoing connections when they haven't changed, so that they don't
+	// expire.
+	clientsRefreshInterval = 10 * time.Minute
+
+	// ttlClientsGossip is the time-to-live of a node's gossiped outgoing
+	// connections.
+	ttlClientsGossip = 2 * clientsRefreshInterval
+)
+
+// ConnectivityConn is a gossip connection from the client node Source to
+// the server node Target.
+type ConnectivityConn struct {
+	Source roachpb.NodeID `json:"source"`
+	Target roachpb.NodeID `json:"target"`
+}
+
+// ConnectivityInfo describes the origin of an info in the infostore.
+type ConnectivityInfo struct {
+	Key string `json:"key"`
+	// NodeID is the node which originated the info.
+	NodeID roachpb.NodeID `json:"node_id"`
+	// PeerID is the node from which the info was received.
+	PeerID roachpb.NodeID `json:"peer_id"`
+	// Hops is the number of hops the info took from its originator.
+	Hops uint32 `json:"hops"`
+	// OrigStamp is the wall time at which the info was originated.
+	OrigStamp int64 `json:"orig_stamp"`
+}
+
+// Connectivity is a snapshot of the gossip network as known to a node. It
+// can be serialized as JSON, or rendered as a DOT graph using DOT.
+type Connectivity struct {
+	// NodeID is the node which took the snapshot.
+	NodeID roachpb.NodeID `json:"node_id"`
+	// SentinelNodeID is the node which gossips the sentinel, or 0 if the
+	// sentinel is unknown.
+	SentinelNodeID roachpb.NodeID `json:"sentinel_node_id"`
+	// Incoming and Outgoing are the node's own server and client connections.
+	Incoming []roachpb.NodeID `json:"incoming"`
+	Outgoing []roachpb.NodeID `json:"outgoing"`
+	// ClientConns is the edge set of the network, as gossiped by each node
+	// about its outgoing connections.
+	ClientConns []ConnectivityConn `json:"client_conns"`
+	// Hops maps each known node to the minimum number of hops taken by the
+	// infos it originated.
+	Hops map[roachpb.NodeID]uint32 `json:"hops"`
+	// Infos describes the origin of each info in the infostore.
+	Infos []ConnectivityInfo `json:"infos"`
+}
+
+// Connectivity returns a snapshot of the gossip network as known to this
+// node. The edge set is assembled from the outgoing connections gossiped by
+// every node, and so lags behind the network by up to a gossip round trip.
+func (g *Gossip) Connectivity() Connectivity {
+	ctx := g.AnnotateCtx(context.TODO())
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	c := Connectivity{
+		NodeID:   g.NodeID.Get(),
+		Incoming: g.mu.incoming.asSlice(),
+		Outgoing: g.outgoing.asSlice(),
+		Hops:     map[roachpb.NodeID]uint32{},
+	}
+	if i := g.mu.is.getInfo(KeySentinel); i != nil {
+		c.SentinelNodeID = i.NodeID
+	}
+	if err := g.mu.is.visitInfos(func(key string, i *Info) error {
+		c.Infos = append(c.Infos, ConnectivityInfo{
+			Key:       key,
+			NodeID:    i.NodeID,
+			PeerID:    i.PeerID,
+			Hops:      i.Hops,
+			OrigStamp: i.OrigStamp,
+		})
+		if hops, ok := c.Hops[i.NodeID]; !ok || i.Hops < hops {
+			c.Hops[i.NodeID] = i.Hops
+		}
+		if KeyPrefix(key) != KeyGossipClientsPrefix {
+			return nil
+		}
+		val, err := i.Value.GetBytes()
+		if err != nil {
+			log.Warningf(ctx, "invalid gossip clients info %q: %s", key, err)
+			return nil
+		}
+		targets, err := parseNodeIDs(string(val))
+		if err != nil {
+			log.Warningf(ctx, "invalid gossip clients info %q: %s", key, err)
+			return nil
+		}
+		for _, target := range targets {
+			c.ClientConns = append(c.ClientConns, ConnectivityConn{Source: i.NodeID, Target: target})
+		}
+		return nil
+	}); err != nil {
+		panic(err)
+	}
+
+	sort.Sort(nodeIDSlice(c.Incoming))
+	sort.Sort(nodeIDSlice(c.Outgoing))
+	sort.Sort(connsBySourceTarget(c.ClientConns))
+	sort.Sort(infosByKey(c.Infos))
+	return c
+}
+
+// DOT renders the gossip network as a directed graph in the DOT language,
+// with an edge from each client to its server. Nodes are labeled with their
+// minimum hop count from the snapshotting node, which is drawn as a box; the
+// sentinel node is drawn in bold.
+func (c Connectivity) DOT() string {
+	nodes := map[roachpb.NodeID]struct{}{c.NodeID: {}}
+	for nodeID := range c.Hops {
+		nodes[nodeID] = struct{}{}
+	}
+	for _, conn := range c.ClientConns {
+		nodes[conn.Source] = struct{}{}
+		nodes[conn.Target] = struct{}{}
+	}
+	nodeIDs := make([]roachpb.NodeID, 0, len(nodes))
+	for nodeID := range nodes {
+		nodeIDs = append(nodeIDs, nodeID)
+	}
+	sort.Sort(nodeIDSlice(nodeIDs))
+
+	var buf bytes.Buffer
+	buf.WriteString("digraph G {\n")
+	for _, nodeID := range nodeIDs {
+		var attrs []string
+		if hops, ok := c.Hops[nodeID]; ok {
+			attrs = append(attrs, fmt.Sprintf(`label="%d (%d hops)"`, nodeID, hops))
+		}
+		if nodeID == c.NodeID {
+			attrs = append(attrs, "shape=box")
+		}
+		if nodeID == c.SentinelNodeID {
+			attrs = append(attrs, "style=bold")
+		}
+		fmt.Fprintf(&buf, "  %d", nodeID)
+		if len(attrs) > 0 {
+			fmt.Fprintf(&buf, " [%s]", strings.Join(attrs, ","))
+		}
+		buf.WriteString(";\n")
+	}
+	for _, conn := range c.ClientConns {
+		fmt.Fprintf(&buf, "  %d -> %d;\n", conn.Source, conn.Target)
+	}
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+// updateClientsLocked gossips the node IDs of this node's outgoing
+// connections, from which every node assembles the network's edge set. They
+// are only gossiped if they have changed since they were last gossiped, or
+// if that was more than clientsRefreshInterval ago. The mutex must be held
+// by the caller.
+func (g *Gossip) updateClientsLocked() {
+	nodeID := g.NodeID.Get()
+	if nodeID == 0 {
+		return
+	}
+	outgoing := g.outgoing.asSlice()
+	sort.Sort(nodeIDSlice(outgoing))
+	targets := make([]string, len(outgoing))
+	for i, target := range outgoing {
+		targets[i] = target.String()
+	}
+	clients := strings.Join(targets, ",")
+	now := g.clock.Now()
+	if !g.clientsGossipedAt.IsZero() && clients == g.clientsGossiped &&
+		now.Sub(g.clientsGossipedAt) < clientsRefreshInterval {
+		return
+	}
+	if err := g.addInfoLocked(
+		MakeGossipClientsKey(nodeID), []byte(clients), ttlClientsGossip,
+	); err != nil {
+		log.Errorf(g.AnnotateCtx(context.TODO()), "unable to gossip clients: %s", err)
+		return
+	}
+	g.clientsGossiped, g.clientsGossipedAt = clients, now
+}
+
+// parseNodeIDs parses a comma-separated list of node IDs.
+func parseNodeIDs(s string) ([]roachpb.NodeID, error) {
+	if s == "" {
+		return nil, nil
+	}
+	parts := strings.Split(s, ",")
+	nodeIDs := make([]roachpb.NodeID, len(parts))
+	for i, part := range parts {
+		nodeID, err := strconv.ParseInt(part, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		nodeIDs[i] = roachpb.NodeID(nodeID)
+	}
+	return nodeIDs, nil
+}
+
+type nodeIDSlice []roachpb.NodeID
+
+func (s nodeIDSlice) Len() int           { return len(s) }
+func (s nodeIDSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s nodeIDSlice) Less(i, j int) bool { return s[i] < s[j] }
+
+type connsBySourceTarget []ConnectivityConn
+
+func (s connsBySourceTarget) Len() int      { return len(s) }
+func (s connsBySourceTarget) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s connsBySourceTarget) Less(i, j int) bool {
+	if s[i].Source != s[j].Source {
+		return s[i].Source < s[j].Source
+	}
+	return s[i].Target < s[j].Target
+}
+
+type infosByKey []ConnectivityInfo
+
+func (s infosByKey) Len() int           { return len(s) }
+func (s infosByKey) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s infosByKey) Less(i, j int) bool { return s[i].Key < s[j].Key }
@@ -0,0 +1,142 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package gossip
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/rpc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/metric"
+	"github.com/cockroachdb/cockroach/pkg/util/stop"
+)
+
+// TestGossipConnectivity verifies that the connectivity snapshot combines
+// the gossiped outgoing connections of all nodes, and that it renders as a
+// DOT graph.
+func TestGossipConnectivity(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+	rpcContext := newInsecureRPCContext(stopper)
+	g := NewTest(1, rpcContext, rpc.NewServer(rpcContext), nil, stopper, metric.NewRegistry())
+
+	g.mu.Lock()
+	g.outgoing.addNode(3)
+	g.outgoing.addNode(2)
+	g.updateClientsLocked()
+	// Node 2's outgoing connections, received via node 3.
+	inf := g.mu.is.newInfo([]byte("3"), time.Minute)
+	inf.NodeID = 2
+	inf.PeerID = 3
+	inf.Hops = 2
+	if err := g.mu.is.addInfo(MakeGossipClientsKey(2), inf); err != nil {
+		t.Fatal(err)
+	}
+	inf = g.mu.is.newInfo(nil, time.Minute)
+	inf.NodeID = 3
+	inf.PeerID = 3
+	inf.Hops = 1
+	if err := g.mu.is.addInfo(KeySentinel, inf); err != nil {
+		t.Fatal(err)
+	}
+	g.mu.Unlock()
+
+	c := g.Connectivity()
+	if c.NodeID != 1 || c.SentinelNodeID != 3 {
+		t.Errorf("expected node 1 and sentinel node 3, got %d and %d", c.NodeID, c.SentinelNodeID)
+	}
+	if expected := []roachpb.NodeID{2, 3}; !reflect.DeepEqual(c.Outgoing, expected) {
+		t.Errorf("expected outgoing %v, got %v", expected, c.Outgoing)
+	}
+	expectedConns := []ConnectivityConn{{1, 2}, {1, 3}, {2, 3}}
+	if !reflect.DeepEqual(c.ClientConns, expectedConns) {
+		t.Errorf("expected client conns %v, got %v", expectedConns, c.ClientConns)
+	}
+	expectedHops := map[roachpb.NodeID]uint32{1: 0, 2: 2, 3: 1}
+	if !reflect.DeepEqual(c.Hops, expectedHops) {
+		t.Errorf("expected hops %v, got %v", expectedHops, c.Hops)
+	}
+	if len(c.Infos) != 3 {
+		t.Fatalf("expected 3 infos, got %+v", c.Infos)
+	}
+	if info := c.Infos[1]; info.Key != MakeGossipClientsKey(2) || info.NodeID != 2 ||
+		info.PeerID != 3 || info.Hops != 2 {
+		t.Errorf("unexpected info %+v", info)
+	}
+
+	expectedDOT := `digraph G {
+  1 [label="1 (0 hops)",shape=box];
+  2 [label="2 (2 hops)"];
+  3 [label="3 (1 hops)",style=bold];
+  1 -> 2;
+  1 -> 3;
+  2 -> 3;
+}
+`
+	if dot := c.DOT(); dot != expectedDOT {
+		t.Errorf("expected DOT graph:\n%s\ngot:\n%s", expectedDOT, dot)
+	}
+}
+
+// TestGossipClientsOnlyOnChange verifies that a node only regossips its
+// outgoing connections when they change or need to be refreshed.
+func TestGossipClientsOnlyOnChange(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+	rpcContext := newInsecureRPCContext(stopper)
+	g := NewTest(1, rpcContext, rpc.NewServer(rpcContext), nil, stopper, metric.NewRegistry())
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	key := MakeGossipClientsKey(1)
+	origStamp := func() int64 {
+		i := g.mu.is.getInfo(key)
+		if i == nil {
+			t.Fatalf("expected %q to be gossiped", key)
+		}
+		return i.OrigStamp
+	}
+
+	g.outgoing.addNode(2)
+	g.updateClientsLocked()
+	stamp := origStamp()
+
+	// Unchanged connections are not regossiped.
+	g.updateClientsLocked()
+	if s := origStamp(); s != stamp {
+		t.Errorf("expected unchanged clients not to be regossiped")
+	}
+
+	// Changed connections are regossiped.
+	g.outgoing.addNode(3)
+	g.updateClientsLocked()
+	if s := origStamp(); s == stamp {
+		t.Errorf("expected changed clients to be regossiped")
+	} else {
+		stamp = s
+	}
+
+	// Unchanged connections are refreshed before they expire.
+	g.clientsGossipedAt = g.clientsGossipedAt.Add(-clientsRefreshInterval)
+	g.updateClientsLocked()
+	if s := origStamp(); s == stamp {
+		t.Errorf("expected unchanged clients to be refreshed")
+	}
+}
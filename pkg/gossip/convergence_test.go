@@ -17,34 +17,62 @@
 package gossip_test
 
 import (
+	"reflect"
 	"testing"
 
-	"golang.org/x/net/context"
-
 	"github.com/cockroachdb/cockroach/pkg/gossip/simulation"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
-	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/stop"
 )
 
 // TestConvergence verifies a 10 node gossip network converges within
-// a fixed number of simulation cycles. It's really difficult to
-// determine the right number for cycles because different things can
-// happen during a single cycle, depending on how much CPU time is
-// available. Eliminating this variability by getting more
-// synchronization primitives in place for the simulation is possible,
-// though two attempts so far have introduced more complexity into the
-// actual production gossip code than seems worthwhile for a unittest.
+// a fixed number of simulation cycles. The nodes run the real gossip
+// protocol over the deterministic simulation's in-memory transport and
+// manual clock, which deliver gossip one hop per cycle regardless of how
+// much CPU time is available.
 func TestConvergence(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	stopper := stop.NewStopper()
 	defer stopper.Stop()
 
-	network := simulation.NewNetwork(stopper, 10, true)
+	const seed = 42
+	network := simulation.NewDeterministicNetwork(stopper, 10, seed)
 
 	const maxCycles = 100
 	if connectedCycle := network.RunUntilFullyConnected(); connectedCycle > maxCycles {
-		log.Warningf(context.TODO(), "expected a fully-connected network within %d cycles; took %d",
-			maxCycles, connectedCycle)
+		t.Errorf("expected a fully-connected network within %d cycles; took %d (seed %d)",
+			maxCycles, connectedCycle, seed)
+	}
+}
+
+// TestDeterministicConvergence verifies that simulations with the same seed
+// propagate gossip identically: they become fully connected at the same
+// cycle and leave every node with the same maximum hop count.
+func TestDeterministicConvergence(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	const seed = 42
+	run := func() (int, []uint32) {
+		stopper := stop.NewStopper()
+		defer stopper.Stop()
+		network := simulation.NewDeterministicNetwork(stopper, 10, seed)
+		connectedCycle := network.RunUntilFullyConnected()
+		maxHops := make([]uint32, len(network.Nodes))
+		for i, node := range network.Nodes {
+			maxHops[i] = node.MaxHops()
+		}
+		return connectedCycle, maxHops
+	}
+
+	connectedCycle, maxHops := run()
+	for i := 0; i < 3; i++ {
+		cycle, hops := run()
+		if cycle != connectedCycle {
+			t.Errorf("expected network to become fully connected at cycle %d; got %d",
+				connectedCycle, cycle)
+		}
+		if !reflect.DeepEqual(hops, maxHops) {
+			t.Errorf("expected max hops %v; got %v", maxHops, hops)
+		}
 	}
 }
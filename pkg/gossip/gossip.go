@@ -55,7 +55,6 @@ package gossip
 import (
 	"bytes"
 	"fmt"
-	"math"
 	"math/rand"
 	"net"
 	"strings"
@@ -77,6 +76,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/rpc"
 	"github.com/cockroachdb/cockroach/pkg/security"
 	"github.com/cockroachdb/cockroach/pkg/util"
+	"github.com/cockroachdb/cockroach/pkg/util/encoding"
 	"github.com/cockroachdb/cockroach/pkg/util/envutil"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/metric"
@@ -87,19 +87,16 @@ import (
 )
 
 const (
-	// MaxHops is the maximum number of hops which any gossip info
-	// should require to transit between any two nodes in a gossip
-	// network.
+	// MaxHops is the default maximum number of hops which any gossip
+	// info should require to transit between any two nodes in a gossip
+	// network. See Limits.
 	MaxHops = 5
 
-	// minPeers is the minimum number of peers which the maxPeers()
-	// function will return. This is set higher than one to prevent
-	// excessive tightening of the network.
+	// minPeers is the default minimum number of peers which the
+	// maxPeers() function will return. This is set higher than one to
+	// prevent excessive tightening of the network.
 	minPeers = 3
 
-	// ttlNodeDescriptorGossip is time-to-live for node ID -> descriptor.
-	ttlNodeDescriptorGossip = 1 * time.Hour
-
 	// defaultStallInterval is the default interval for checking whether
 	// the incoming and outgoing connections to the gossip network are
 	// insufficient to keep the network connected.
@@ -115,6 +112,25 @@ const (
 	// efficiently targeted connection to the most distant node.
 	defaultCullInterval = 60 * time.Second
 
+	// defaultBootstrapRefreshInterval is the default interval at which the
+	// last seen times of the bootstrap addresses are refreshed from gossip
+	// and persisted.
+	defaultBootstrapRefreshInterval = 10 * time.Minute
+
+	// defaultClientsInterval is the default interval at which a node checks
+	// whether its outgoing connections have changed, in which case they are
+	// regossiped for use in connectivity snapshots.
+	defaultClientsInterval = 2 * time.Second
+
+	// defaultExpirationInterval is the default interval at which expired
+	// infos are removed from the infostore, notifying the expiration
+	// callbacks registered for them.
+	defaultExpirationInterval = 10 * time.Second
+
+	// callbackLatencySampleInterval is the window over which the callback
+	// latency histogram is maintained.
+	callbackLatencySampleInterval = 10 * time.Second
+
 	unknownNodeID roachpb.NodeID = 0
 )
 
@@ -128,10 +144,44 @@ var (
 	MetaBytesReceivedRates       = metric.Metadata{Name: "gossip.bytes.received"}
 )
 
+// Gossip infostore metrics names.
+var (
+	MetaCallbacksProcessed = metric.Metadata{
+		Name: "gossip.callbacks.processed",
+		Help: "Number of gossip callbacks processed"}
+	MetaCallbacksPending = metric.Metadata{
+		Name: "gossip.callbacks.pending",
+		Help: "Number of gossip callbacks waiting to be processed"}
+	MetaCallbacksLatency = metric.Metadata{
+		Name: "gossip.callbacks.latency",
+		Help: "Latency of gossip callback processing, from queueing to completion"}
+	MetaInfosStore = metric.Metadata{
+		Name: "gossip.infos.store",
+		Help: "Number of store descriptor infos in the infostore"}
+	MetaInfosNode = metric.Metadata{
+		Name: "gossip.infos.node",
+		Help: "Number of node descriptor infos in the infostore"}
+	MetaInfosLiveness = metric.Metadata{
+		Name: "gossip.infos.liveness",
+		Help: "Number of node liveness infos in the infostore"}
+	MetaInfosDeadReplicas = metric.Metadata{
+		Name: "gossip.infos.replica-dead",
+		Help: "Number of dead replica infos in the infostore"}
+	MetaInfosOther = metric.Metadata{
+		Name: "gossip.infos.other",
+		Help: "Number of infos in the infostore not covered by another prefix"}
+)
+
 var (
 	// GossipStoresInterval is the interval for gossipping storage-related info.
 	GossipStoresInterval = envutil.EnvOrDefaultDuration("COCKROACH_GOSSIP_STORES_INTERVAL",
 		5*time.Second)
+
+	// BootstrapAddressStaleness is the age beyond which a persisted
+	// bootstrap address which has not been seen in gossip is pruned when
+	// the bootstrap info is read at startup.
+	BootstrapAddressStaleness = envutil.EnvOrDefaultDuration(
+		"COCKROACH_GOSSIP_BOOTSTRAP_ADDRESS_STALENESS", 7*24*time.Hour)
 )
 
 // Storage is an interface which allows the gossip instance
@@ -156,6 +206,7 @@ type Gossip struct {
 	Connected     chan struct{}       // Closed upon initial connection
 	hasConnected  bool                // Set first time network is connected
 	rpcContext    *rpc.Context        // The context required for RPC
+	registry      *metric.Registry    // Registry for per-callback metrics
 	outgoing      nodeSet             // Set of outgoing client node IDs
 	storage       Storage             // Persistent storage interface
 	bootstrapInfo BootstrapInfo       // BootstrapInfo proto for persistent storage
@@ -167,17 +218,36 @@ type Gossip struct {
 	clientsMu struct {
 		syncutil.Mutex
 		clients []*client
-		// One breaker per client for the life of the process.
+		// One breaker per peer address, until the peer is removed.
 		breakers map[string]*circuit.Breaker
+		// Addresses of peers which failed the handshake, and the times
+		// until which no clients are started to them.
+		rejected map[string]time.Time
 	}
 
 	disconnected chan *client  // Channel of disconnected clients
 	stalled      bool          // True if gossip is stalled (i.e. host doesn't have sentinel)
 	stalledCh    chan struct{} // Channel to wake up stalled bootstrap
 
-	stallInterval     time.Duration
-	bootstrapInterval time.Duration
-	cullInterval      time.Duration
+	limitsChanged             chan struct{} // Signals changes of the stall interval
+	bootstrapInterval         time.Duration
+	cullInterval              time.Duration
+	bootstrapAddressStaleness time.Duration
+
+	// batchCallbackMetrics holds the metrics shared by the batch callbacks
+	// registered under each name. Protected by the gossip mutex.
+	batchCallbackMetrics map[string]BatchCallbackMetrics
+
+	// clientsGossiped is the list of outgoing connections last gossiped by
+	// updateClientsLocked, at clientsGossipedAt. Protected by the gossip
+	// mutex.
+	clientsGossiped   string
+	clientsGossipedAt time.Time
+
+	// clock and streamDialer are replaced by simulations; see SetClock and
+	// SetStreamDialer. streamDialer is nil outside of simulations.
+	clock        Clock
+	streamDialer StreamDialer
 
 	// The system config is treated unlike other info objects.
 	// It is used so often that we keep an unmarshalled version of it
@@ -188,6 +258,18 @@ type Gossip struct {
 	systemConfigSet      bool
 	systemConfigMu       syncutil.RWMutex
 	systemConfigChannels []chan<- struct{}
+	// systemConfigBase is the system config last gossiped in full, to
+	// which deltas gossiped under KeySystemConfigDelta are applied.
+	// systemConfigDelta is the latest delta which is newer than the base,
+	// kept until a base with a matching hash is received. The stamps are the
+	// gossip timestamps of the base and the delta, which order them: a
+	// delta is only ever applied to an older base, since a newer base may
+	// have the same hash as the one the delta was computed against.
+	systemConfigBase       config.SystemConfig
+	systemConfigBaseHash   []byte
+	systemConfigBaseStamp  int64
+	systemConfigDelta      *config.SystemConfigDelta
+	systemConfigDeltaStamp int64
 
 	// resolvers is a list of resolvers used to determine
 	// bootstrap hosts for connecting to the gossip network.
@@ -201,6 +283,12 @@ type Gossip struct {
 	// node ID to enable faster node lookup by address.
 	resolverAddrs  map[util.UnresolvedAddr]resolver.Resolver
 	bootstrapAddrs map[util.UnresolvedAddr]roachpb.NodeID
+
+	// ttlClasses holds the time-to-live of each TTL class and
+	// keyPrefixTTLs any per-key-prefix time-to-live overrides. Both are
+	// protected by the gossip mutex.
+	ttlClasses    map[TTLClass]time.Duration
+	keyPrefixTTLs map[string]time.Duration
 }
 
 // New creates an instance of a gossip node.
@@ -221,32 +309,52 @@ func New(
 		server:            newServer(ambient, nodeID, stopper, registry),
 		Connected:         make(chan struct{}),
 		rpcContext:        rpcContext,
+		registry:          registry,
 		outgoing:          makeNodeSet(minPeers, metric.NewGauge(MetaConnectionsOutgoingGauge)),
 		bootstrapping:     map[string]struct{}{},
 		disconnected:      make(chan *client, 10),
 		stalledCh:         make(chan struct{}, 1),
-		stallInterval:     defaultStallInterval,
+		limitsChanged:     make(chan struct{}, 1),
 		bootstrapInterval: defaultBootstrapInterval,
 		cullInterval:      defaultCullInterval,
 		nodeDescs:         map[roachpb.NodeID]*roachpb.NodeDescriptor{},
 		resolverAddrs:     map[util.UnresolvedAddr]resolver.Resolver{},
 		bootstrapAddrs:    map[util.UnresolvedAddr]roachpb.NodeID{},
+		ttlClasses:        defaultTTLClasses(),
+		clock:             realClock{},
+
+		batchCallbackMetrics: map[string]BatchCallbackMetrics{},
+
+		bootstrapAddressStaleness: BootstrapAddressStaleness,
 	}
 	stopper.AddCloser(stop.CloserFn(g.server.AmbientContext.FinishEventLog))
 
 	registry.AddMetric(g.outgoing.gauge)
 	g.clientsMu.breakers = map[string]*circuit.Breaker{}
+	g.clientsMu.rejected = map[string]time.Time{}
 	resolverAddrs := make([]string, len(resolvers))
 	for i, resolver := range resolvers {
 		resolverAddrs[i] = resolver.Addr()
 	}
 	ctx := g.AnnotateCtx(context.Background())
 	log.Infof(ctx, "initial resolvers: %v", resolverAddrs)
+	var err error
+	if g.keyPrefixTTLs, err = keyPrefixTTLsFromEnv(); err != nil {
+		log.Warningf(ctx, "ignoring gossip key prefix TTLs: %s", err)
+		g.keyPrefixTTLs = map[string]time.Duration{}
+	}
 	g.SetResolvers(resolvers)
 
 	g.mu.Lock()
+	if limits, err := limitsFromEnv(); err != nil {
+		log.Warningf(ctx, "ignoring gossip limits: %s", err)
+	} else {
+		g.mu.limits = limits
+	}
+	g.updateConnLimitsLocked()
 	// Add ourselves as a SystemConfig watcher.
 	g.mu.is.registerCallback(KeySystemConfig, g.updateSystemConfig)
+	g.mu.is.registerCallback(KeySystemConfigDelta, g.updateSystemConfigDelta)
 	// Add ourselves as a node descriptor watcher.
 	g.mu.is.registerCallback(MakePrefixPattern(KeyNodeIDPrefix), g.updateNodeAddress)
 	g.mu.Unlock()
@@ -267,7 +375,7 @@ func NewTest(
 ) *Gossip {
 	n := &base.NodeIDContainer{}
 	var ac log.AmbientContext
-	ac.AddLogTag("n", n)
+	ac.AddLogTag("n", log.Safe(n))
 	gossip := New(ac, n, rpcContext, grpcServer, resolvers, stopper, registry)
 	if nodeID != 0 {
 		n.Set(context.TODO(), nodeID)
@@ -284,9 +392,13 @@ func (g *Gossip) GetNodeMetrics() *Metrics {
 func (g *Gossip) SetNodeDescriptor(desc *roachpb.NodeDescriptor) error {
 	ctx := g.AnnotateCtx(context.TODO())
 	log.Infof(ctx, "NodeDescriptor set to %+v", desc)
-	if err := g.AddInfoProto(MakeNodeIDKey(desc.NodeID), desc, ttlNodeDescriptorGossip); err != nil {
+	if err := g.AddInfoProtoWithTTLClass(MakeNodeIDKey(desc.NodeID), desc, TTLLongLived); err != nil {
 		return errors.Errorf("node %d: couldn't gossip descriptor: %v", desc.NodeID, err)
 	}
+	version := encoding.EncodeUvarintAscending(nil, gossipProtocolVersion)
+	if err := g.AddInfoWithTTLClass(MakeGossipVersionKey(desc.NodeID), version, TTLLongLived); err != nil {
+		return errors.Errorf("node %d: couldn't gossip protocol version: %v", desc.NodeID, err)
+	}
 	return nil
 }
 
@@ -297,7 +409,11 @@ func (g *Gossip) SetNodeDescriptor(desc *roachpb.NodeDescriptor) error {
 func (g *Gossip) SetStallInterval(interval time.Duration) {
 	g.mu.Lock()
 	defer g.mu.Unlock()
-	g.stallInterval = interval
+	g.mu.limits.StallInterval = interval
+	select {
+	case g.limitsChanged <- struct{}{}:
+	default:
+	}
 }
 
 // SetBootstrapInterval sets a minimum interval between successive
@@ -334,6 +450,22 @@ func (g *Gossip) SetStorage(storage Storage) error {
 	defer g.mu.Unlock()
 	g.storage = storage
 
+	// Prune stored addresses which haven't been seen in gossip for a long
+	// time, as long as that leaves at least one address to bootstrap from:
+	// a node which has been down for a long time should still attempt to
+	// rejoin using what it last knew.
+	now := g.clock.Now().UnixNano()
+	stale := make([]bool, len(storedBI.Addresses))
+	numStale := 0
+	for i := range storedBI.Addresses {
+		if lastSeen := bootstrapAddressLastSeen(&storedBI, i); lastSeen != 0 &&
+			time.Duration(now-lastSeen) > g.bootstrapAddressStaleness {
+			stale[i] = true
+			numStale++
+		}
+	}
+	pruned := numStale > 0 && numStale < len(storedBI.Addresses)
+
 	// Merge the stored bootstrap info addresses with any we've become
 	// aware of through gossip.
 	existing := map[string]struct{}{}
@@ -341,14 +473,20 @@ func (g *Gossip) SetStorage(storage Storage) error {
 	for _, addr := range g.bootstrapInfo.Addresses {
 		existing[makeKey(addr)] = struct{}{}
 	}
-	for _, addr := range storedBI.Addresses {
+	for i, addr := range storedBI.Addresses {
+		lastSeen := bootstrapAddressLastSeen(&storedBI, i)
+		if pruned && stale[i] {
+			log.Infof(ctx, "pruning bootstrap address %s last seen %s ago",
+				addr, time.Duration(now-lastSeen))
+			continue
+		}
 		// If the address is new, and isn't our own address, add it.
 		if _, ok := existing[makeKey(addr)]; !ok && addr != g.mu.is.NodeAddr {
-			g.maybeAddBootstrapAddress(addr, unknownNodeID)
+			g.maybeAddBootstrapAddress(addr, unknownNodeID, lastSeen)
 		}
 	}
 	// Persist merged addresses.
-	if numAddrs := len(g.bootstrapInfo.Addresses); numAddrs > len(storedBI.Addresses) {
+	if numAddrs := len(g.bootstrapInfo.Addresses); pruned || numAddrs > len(storedBI.Addresses) {
 		if err := g.storage.WriteBootstrapInfo(&g.bootstrapInfo); err != nil {
 			log.Error(ctx, err)
 		}
@@ -474,6 +612,35 @@ func (g *Gossip) SimulationCycle() {
 	g.simulationCycler.Broadcast()
 }
 
+// SetClock is for TESTING PURPOSES ONLY. It replaces the clock which
+// timestamps infos and drives the bootstrap and client management loops,
+// allowing a simulation to control the passage of time. It must be called
+// before any infos are added.
+func (g *Gossip) SetClock(clock Clock) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.clock = clock
+	g.mu.is.clock = clock
+}
+
+// SetRandSeed is for TESTING PURPOSES ONLY. It seeds the random numbers
+// used to jitter the client management intervals and to choose the peers
+// refused connections are forwarded to, allowing a simulation to reproduce
+// them. It must be called before Start.
+func (g *Gossip) SetRandSeed(seed int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.mu.rng = rand.New(rand.NewSource(seed))
+}
+
+// SetStreamDialer is for TESTING PURPOSES ONLY. It replaces the gRPC
+// connections of gossip clients with the streams returned by dial,
+// allowing a simulation to control the delivery of gossip between
+// nodes. It must be called before Start.
+func (g *Gossip) SetStreamDialer(dial StreamDialer) {
+	g.streamDialer = dial
+}
+
 // maybeAddResolver creates and adds a resolver for the specified
 // address if one does not already exist. Returns whether a new
 // resolver was added. The caller must hold the gossip mutex.
@@ -494,16 +661,25 @@ func (g *Gossip) maybeAddResolver(addr util.UnresolvedAddr) bool {
 }
 
 // maybeAddBootstrapAddress adds the specified address to the list of
-// bootstrap addresses if not already present. Returns whether a new
+// bootstrap addresses if not already present, and advances its last seen
+// time (in nanoseconds; zero if unknown) to lastSeen. Returns whether a new
 // bootstrap address was added. The caller must hold the gossip mutex.
-func (g *Gossip) maybeAddBootstrapAddress(addr util.UnresolvedAddr, nodeID roachpb.NodeID) bool {
+func (g *Gossip) maybeAddBootstrapAddress(
+	addr util.UnresolvedAddr, nodeID roachpb.NodeID, lastSeen int64,
+) bool {
 	if existingNodeID, ok := g.bootstrapAddrs[addr]; ok {
 		if existingNodeID == unknownNodeID || existingNodeID != nodeID {
 			g.bootstrapAddrs[addr] = nodeID
 		}
+		for i := range g.bootstrapInfo.Addresses {
+			if g.bootstrapInfo.Addresses[i] == addr && g.bootstrapInfo.LastSeen[i] < lastSeen {
+				g.bootstrapInfo.LastSeen[i] = lastSeen
+			}
+		}
 		return false
 	}
 	g.bootstrapInfo.Addresses = append(g.bootstrapInfo.Addresses, addr)
+	g.bootstrapInfo.LastSeen = append(g.bootstrapInfo.LastSeen, lastSeen)
 	g.bootstrapAddrs[addr] = nodeID
 	ctx := g.AnnotateCtx(context.TODO())
 	log.Eventf(ctx, "add bootstrap %s", addr)
@@ -524,10 +700,24 @@ func (g *Gossip) maybeCleanupBootstrapAddressesLocked() {
 	g.resolvers = g.resolvers[:0]
 	g.resolverIdx = 0
 	g.bootstrapInfo.Addresses = g.bootstrapInfo.Addresses[:0]
+	g.bootstrapInfo.LastSeen = g.bootstrapInfo.LastSeen[:0]
 	g.bootstrapAddrs = map[util.UnresolvedAddr]roachpb.NodeID{}
 	g.resolverAddrs = map[util.UnresolvedAddr]resolver.Resolver{}
 	g.resolversTried = map[int]struct{}{}
 
+	g.refreshBootstrapAddressesLocked()
+}
+
+// refreshBootstrapAddressesLocked adds the addresses of all nodes whose
+// descriptors are present in gossip to the bootstrap addresses, advancing
+// their last seen times, and persists the bootstrap info. The gossip mutex
+// must be held by the caller.
+func (g *Gossip) refreshBootstrapAddressesLocked() {
+	if g.storage == nil {
+		return
+	}
+	ctx := g.AnnotateCtx(context.TODO())
+
 	var desc roachpb.NodeDescriptor
 	if err := g.mu.is.visitInfos(func(key string, i *Info) error {
 		if strings.HasPrefix(key, KeyNodeIDPrefix) {
@@ -538,7 +728,7 @@ func (g *Gossip) maybeCleanupBootstrapAddressesLocked() {
 				return nil
 			}
 			g.maybeAddResolver(desc.Address)
-			g.maybeAddBootstrapAddress(desc.Address, desc.NodeID)
+			g.maybeAddBootstrapAddress(desc.Address, desc.NodeID, i.Value.Timestamp.WallTime)
 		}
 		return nil
 	}); err != nil {
@@ -551,20 +741,13 @@ func (g *Gossip) maybeCleanupBootstrapAddressesLocked() {
 	}
 }
 
-// maxPeers returns the maximum number of peers each gossip node
-// may connect to. This is based on maxHops, which is a preset
-// maximum for number of hops allowed before the gossip network
-// will seek to "tighten" by creating new connections to distant
-// nodes.
-func (g *Gossip) maxPeers(nodeCount int) int {
-	// This formula uses MaxHops-1, instead of MaxHops, to provide a
-	// "fudge" factor for max connected peers, to account for the
-	// arbitrary, decentralized way in which gossip networks are created.
-	maxPeers := int(math.Ceil(math.Exp(math.Log(float64(nodeCount)) / float64(MaxHops-1))))
-	if maxPeers < minPeers {
-		return minPeers
+// bootstrapAddressLastSeen returns the time, in nanoseconds, at which the
+// i'th address of the bootstrap info was last seen, or zero if unknown.
+func bootstrapAddressLastSeen(bi *BootstrapInfo, i int) int64 {
+	if i < len(bi.LastSeen) {
+		return bi.LastSeen[i]
 	}
-	return maxPeers
+	return 0
 }
 
 // updateNodeAddress is a gossip callback which fires with each
@@ -577,9 +760,11 @@ func (g *Gossip) maxPeers(nodeCount int) int {
 func (g *Gossip) updateNodeAddress(key string, content roachpb.Value) {
 	ctx := g.AnnotateCtx(context.TODO())
 	var desc roachpb.NodeDescriptor
-	if err := content.GetProto(&desc); err != nil {
-		log.Error(ctx, err)
-		return
+	if !IsTombstone(key, content) {
+		if err := content.GetProto(&desc); err != nil {
+			log.Error(ctx, err)
+			return
+		}
 	}
 
 	g.mu.Lock()
@@ -597,6 +782,9 @@ func (g *Gossip) updateNodeAddress(key string, content roachpb.Value) {
 			return
 		}
 		log.Infof(ctx, "removed node %d from gossip", nodeID)
+		if desc, ok := g.nodeDescs[nodeID]; ok {
+			g.removeBreaker(desc.Address.String())
+		}
 		delete(g.nodeDescs, nodeID)
 		return
 	}
@@ -609,9 +797,7 @@ func (g *Gossip) updateNodeAddress(key string, content roachpb.Value) {
 
 	// Recompute max peers based on size of network and set the max
 	// sizes for incoming and outgoing node sets.
-	maxPeers := g.maxPeers(len(g.nodeDescs))
-	g.mu.incoming.setMaxSize(maxPeers)
-	g.outgoing.setMaxSize(maxPeers)
+	g.updateConnLimitsLocked()
 
 	// Skip if it's our own address.
 	if desc.Address == g.mu.is.NodeAddr {
@@ -641,21 +827,18 @@ func (g *Gossip) updateNodeAddress(key string, content roachpb.Value) {
 
 		// Deleting the local copy isn't enough to remove the node from the gossip
 		// network. We also have to clear it out in the infoStore by overwriting
-		// it with an empty descriptor, which can be represented as just an empty
-		// byte array due to how protocol buffers are serialied.
-		// Calling addInfoLocked here is somewhat recursive since
+		// it with a tombstone.
+		// Calling addTombstoneLocked here is somewhat recursive since
 		// updateNodeAddress is typically called in response to the infoStore
 		// being updated but won't lead to deadlock because it's called
 		// asynchronously.
-		key := MakeNodeIDKey(oldNodeID)
-		var emptyProto []byte
-		if err := g.addInfoLocked(key, emptyProto, ttlNodeDescriptorGossip); err != nil {
+		if err := g.addTombstoneLocked(MakeNodeIDKey(oldNodeID)); err != nil {
 			log.Errorf(ctx, "failed to empty node descriptor for node %d: %s", oldNodeID, err)
 		}
 	}
 	// Add new address (if it's not already there) to bootstrap info and
 	// persist if possible.
-	added := g.maybeAddBootstrapAddress(desc.Address, desc.NodeID)
+	added := g.maybeAddBootstrapAddress(desc.Address, desc.NodeID, g.clock.Now().UnixNano())
 	if added && g.storage != nil {
 		if err := g.storage.WriteBootstrapInfo(&g.bootstrapInfo); err != nil {
 			log.Error(ctx, err)
@@ -716,9 +899,15 @@ func (g *Gossip) AddInfo(key string, val []byte, ttl time.Duration) error {
 }
 
 // addInfoLocked adds or updates an info object. The mutex is assumed held by
-// the caller. Returns an error if info couldn't be added.
+// the caller. Any time-to-live override for the key's prefix takes
+// precedence over ttl. Returns an error if info couldn't be added, including
+// if it exceeds the maximum info size.
 func (g *Gossip) addInfoLocked(key string, val []byte, ttl time.Duration) error {
-	err := g.mu.is.addInfo(key, g.mu.is.newInfo(val, ttl))
+	i := g.mu.is.newInfo(val, g.ttlForKeyLocked(key, ttl))
+	if size := len(i.Value.RawBytes); size > maxInfoSize {
+		return errInfoTooLarge(key, size)
+	}
+	err := g.mu.is.addInfo(key, i)
 	if err == nil {
 		g.signalConnectedLocked()
 	}
@@ -746,6 +935,9 @@ func (g *Gossip) GetInfo(key string) ([]byte, error) {
 		if err := i.Value.Verify([]byte(key)); err != nil {
 			return nil, err
 		}
+		if IsTombstone(key, i.Value) {
+			return nil, errors.Errorf("key %q has been removed", key)
+		}
 		return i.Value.GetBytes()
 	}
 	return nil, errors.Errorf("key %q does not exist or has expired", key)
@@ -802,6 +994,26 @@ func (g *Gossip) RegisterCallback(pattern string, method Callback) func() {
 	}
 }
 
+// ExpirationCallback is a callback method to be invoked with the key of
+// an info which expired.
+type ExpirationCallback func(string)
+
+// RegisterExpirationCallback registers a callback for a key pattern to be
+// invoked whenever an info for a gossip key matching pattern expires
+// without having been refreshed by its originator. Expired infos are
+// removed periodically, so the callback may fire some time after the
+// info's TTL has passed. Returns a function to unregister the callback.
+func (g *Gossip) RegisterExpirationCallback(pattern string, method ExpirationCallback) func() {
+	g.mu.Lock()
+	unregister := g.mu.is.registerExpirationCallback(pattern, method)
+	g.mu.Unlock()
+	return func() {
+		g.mu.Lock()
+		unregister()
+		g.mu.Unlock()
+	}
+}
+
 // GetSystemConfig returns the local unmarshalled version of the system config.
 // The second return value indicates whether the system config has been set yet.
 func (g *Gossip) GetSystemConfig() (config.SystemConfig, bool) {
@@ -846,6 +1058,67 @@ func (g *Gossip) updateSystemConfig(key string, content roachpb.Value) {
 
 	g.systemConfigMu.Lock()
 	defer g.systemConfigMu.Unlock()
+	stamp := content.Timestamp.WallTime
+	if g.systemConfigBaseHash != nil && stamp < g.systemConfigBaseStamp {
+		if log.V(2) {
+			log.Infof(ctx, "ignoring system config older than the current one")
+		}
+		return
+	}
+	g.systemConfigBase = cfg
+	g.systemConfigBaseHash = cfg.Hash()
+	g.systemConfigBaseStamp = stamp
+	if d := g.systemConfigDelta; d != nil {
+		if g.systemConfigDeltaStamp <= stamp {
+			// The delta is superseded by this system config.
+			g.systemConfigDelta = nil
+		} else if bytes.Equal(d.BaseHash, g.systemConfigBaseHash) {
+			// The delta relative to this system config was received first.
+			cfg = cfg.ApplyDelta(*d)
+		}
+	}
+	g.setSystemConfigLocked(cfg)
+}
+
+// updateSystemConfigDelta is the raw gossip info callback for system
+// config deltas. A delta which is newer than the last full system config
+// is applied to it if it was computed against it; otherwise it is kept
+// until the matching full system config is received. Deltas which are
+// older than the last full system config are ignored.
+func (g *Gossip) updateSystemConfigDelta(key string, content roachpb.Value) {
+	ctx := g.AnnotateCtx(context.TODO())
+	if key != KeySystemConfigDelta {
+		log.Fatalf(ctx, "wrong key received on SystemConfigDelta callback: %s", key)
+	}
+	delta := &config.SystemConfigDelta{}
+	if err := content.GetProto(delta); err != nil {
+		log.Errorf(ctx, "could not unmarshal system config delta on callback: %s", err)
+		return
+	}
+
+	g.systemConfigMu.Lock()
+	defer g.systemConfigMu.Unlock()
+	stamp := content.Timestamp.WallTime
+	if g.systemConfigBaseHash != nil && stamp <= g.systemConfigBaseStamp {
+		if log.V(2) {
+			log.Infof(ctx, "ignoring system config delta older than the system config")
+		}
+		return
+	}
+	g.systemConfigDelta = delta
+	g.systemConfigDeltaStamp = stamp
+	if g.systemConfigBaseHash == nil || !bytes.Equal(delta.BaseHash, g.systemConfigBaseHash) {
+		if log.V(2) {
+			log.Infof(ctx, "deferring system config delta with unknown base %x", delta.BaseHash)
+		}
+		return
+	}
+	g.setSystemConfigLocked(g.systemConfigBase.ApplyDelta(*delta))
+}
+
+// setSystemConfigLocked sets the system config and notifies the registered
+// channels. systemConfigMu must be held.
+func (g *Gossip) setSystemConfigLocked(cfg config.SystemConfig) {
 	g.systemConfig = cfg
 	g.systemConfigSet = true
 	for _, c := range g.systemConfigChannels {
@@ -935,6 +1208,9 @@ func (g *Gossip) getNextBootstrapAddress() net.Addr {
 			continue
 		} else {
 			addrStr := addr.String()
+			if g.isRejectedAddr(addrStr) {
+				continue
+			}
 			if _, addrActive := g.bootstrapping[addrStr]; !addrActive {
 				g.bootstrapping[addrStr] = struct{}{}
 				return addr
@@ -955,8 +1231,6 @@ func (g *Gossip) bootstrap() {
 	g.server.stopper.RunWorker(func() {
 		ctx := g.AnnotateCtx(context.Background())
 		ctx = log.WithLogTag(ctx, "bootstrap", nil)
-		var bootstrapTimer timeutil.Timer
-		defer bootstrapTimer.Stop()
 		for {
 			if g.server.stopper.RunTask(func() {
 				g.mu.Lock()
@@ -984,11 +1258,9 @@ func (g *Gossip) bootstrap() {
 			}
 
 			// Pause an interval before next possible bootstrap.
-			bootstrapTimer.Reset(g.bootstrapInterval)
 			log.Eventf(ctx, "sleeping %s until bootstrap", g.bootstrapInterval)
 			select {
-			case <-bootstrapTimer.C:
-				bootstrapTimer.Read = true
+			case <-g.clock.After(g.bootstrapInterval):
 				// break
 			case <-g.server.stopper.ShouldStop():
 				return
@@ -1019,10 +1291,19 @@ func (g *Gossip) bootstrap() {
 func (g *Gossip) manage() {
 	g.server.stopper.RunWorker(func() {
 		ctx := g.AnnotateCtx(context.Background())
-		cullTicker := time.NewTicker(g.jitteredInterval(g.cullInterval))
-		stallTicker := time.NewTicker(g.jitteredInterval(g.stallInterval))
+		g.mu.Lock()
+		stallInterval := g.mu.limits.StallInterval
+		g.mu.Unlock()
+		cullTicker := g.clock.NewTicker(g.jitteredInterval(g.cullInterval))
+		stallTicker := g.clock.NewTicker(g.jitteredInterval(stallInterval))
+		refreshTicker := g.clock.NewTicker(g.jitteredInterval(defaultBootstrapRefreshInterval))
+		clientsTicker := g.clock.NewTicker(defaultClientsInterval)
+		expirationTicker := g.clock.NewTicker(defaultExpirationInterval)
 		defer cullTicker.Stop()
-		defer stallTicker.Stop()
+		defer func() { stallTicker.Stop() }()
+		defer refreshTicker.Stop()
+		defer clientsTicker.Stop()
+		defer expirationTicker.Stop()
 		for {
 			select {
 			case <-g.server.stopper.ShouldStop():
@@ -1031,11 +1312,11 @@ func (g *Gossip) manage() {
 				g.doDisconnected(c)
 			case nodeID := <-g.tighten:
 				g.tightenNetwork(nodeID)
-			case <-cullTicker.C:
+			case <-cullTicker.C():
 				func() {
 					g.mu.Lock()
 					if !g.outgoing.hasSpace() {
-						leastUsefulID := g.mu.is.leastUseful(g.outgoing)
+						leastUsefulID := g.mu.is.leastUseful(g.localityCullCandidatesLocked())
 
 						if c := g.findClient(func(c *client) bool {
 							return c.peerID == leastUsefulID
@@ -1060,10 +1341,31 @@ func (g *Gossip) manage() {
 					}
 					g.mu.Unlock()
 				}()
-			case <-stallTicker.C:
+			case <-stallTicker.C():
 				g.mu.Lock()
 				g.maybeSignalStatusChangeLocked()
 				g.mu.Unlock()
+			case <-g.limitsChanged:
+				g.mu.Lock()
+				interval := g.mu.limits.StallInterval
+				g.mu.Unlock()
+				if interval != stallInterval {
+					stallInterval = interval
+					stallTicker.Stop()
+					stallTicker = g.clock.NewTicker(g.jitteredInterval(stallInterval))
+				}
+			case <-refreshTicker.C():
+				g.mu.Lock()
+				g.refreshBootstrapAddressesLocked()
+				g.mu.Unlock()
+			case <-clientsTicker.C():
+				g.mu.Lock()
+				g.updateClientsLocked()
+				g.mu.Unlock()
+			case <-expirationTicker.C():
+				g.mu.Lock()
+				g.mu.is.expireInfos()
+				g.mu.Unlock()
 			}
 		}
 	})
@@ -1072,17 +1374,22 @@ func (g *Gossip) manage() {
 // jitteredInterval returns a randomly jittered (+/-25%) duration
 // from checkInterval.
 func (g *Gossip) jitteredInterval(interval time.Duration) time.Duration {
-	return time.Duration(float64(interval) * (0.75 + 0.5*rand.Float64()))
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return time.Duration(float64(interval) * (0.75 + 0.5*g.mu.rng.Float64()))
 }
 
 // tightenNetwork "tightens" the network by starting a new gossip
 // client to the most distant node as measured in required gossip hops
-// to propagate info from the distant node to this node.
+// to propagate info from the distant node to this node. Connections
+// within this node's locality are preferred once it has its share of
+// connections to remote localities.
 func (g *Gossip) tightenNetwork(distantNodeID roachpb.NodeID) {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 	if g.outgoing.hasSpace() {
 		ctx := g.AnnotateCtx(context.TODO())
+		distantNodeID = g.localityTightenTargetLocked(distantNodeID)
 		if nodeAddr, err := g.getNodeIDAddressLocked(distantNodeID); err != nil {
 			log.Errorf(ctx, "unable to get address for node %d: %s", distantNodeID, err)
 		} else {
@@ -1172,9 +1479,12 @@ func (g *Gossip) signalConnectedLocked() {
 func (g *Gossip) startClient(addr net.Addr) {
 	g.clientsMu.Lock()
 	defer g.clientsMu.Unlock()
+	if g.isRejectedAddrLocked(addr.String()) {
+		return
+	}
 	breaker, ok := g.clientsMu.breakers[addr.String()]
 	if !ok {
-		breaker = g.rpcContext.NewBreaker()
+		breaker = g.rpcContext.NewBreaker("gossip." + addr.String())
 		g.clientsMu.breakers[addr.String()] = breaker
 	}
 	ctx := g.AnnotateCtx(context.TODO())
@@ -1184,6 +1494,18 @@ func (g *Gossip) startClient(addr net.Addr) {
 	c.start(g, g.disconnected, g.rpcContext, g.server.stopper, breaker)
 }
 
+// removeBreaker removes the circuit breaker of the clients to the
+// specified address, along with its metrics, once the node at the address
+// has been removed.
+func (g *Gossip) removeBreaker(addr string) {
+	g.clientsMu.Lock()
+	defer g.clientsMu.Unlock()
+	if breaker, ok := g.clientsMu.breakers[addr]; ok {
+		g.rpcContext.RemoveBreaker(breaker)
+		delete(g.clientsMu.breakers, addr)
+	}
+}
+
 // removeClient removes the specified client. Called when a client
 // disconnects.
 func (g *Gossip) removeClient(target *client) {
@@ -1242,3 +1564,48 @@ func makeMetrics() Metrics {
 		InfosSent:     metric.NewCounter(MetaInfosSentRates),
 	}
 }
+
+// InfoStoreMetrics contains metrics describing the contents of a node's
+// infostore and the processing of its callbacks.
+type InfoStoreMetrics struct {
+	CallbacksProcessed *metric.Counter
+	CallbacksPending   *metric.Gauge
+	CallbackLatency    *metric.Histogram
+
+	// Infos by key prefix. Infos are counted when added and uncounted
+	// when they are found to have expired.
+	InfosStore        *metric.Gauge
+	InfosNode         *metric.Gauge
+	InfosLiveness     *metric.Gauge
+	InfosDeadReplicas *metric.Gauge
+	InfosOther        *metric.Gauge
+}
+
+func makeInfoStoreMetrics() InfoStoreMetrics {
+	return InfoStoreMetrics{
+		CallbacksProcessed: metric.NewCounter(MetaCallbacksProcessed),
+		CallbacksPending:   metric.NewGauge(MetaCallbacksPending),
+		CallbackLatency:    metric.NewLatency(MetaCallbacksLatency, callbackLatencySampleInterval),
+		InfosStore:         metric.NewGauge(MetaInfosStore),
+		InfosNode:          metric.NewGauge(MetaInfosNode),
+		InfosLiveness:      metric.NewGauge(MetaInfosLiveness),
+		InfosDeadReplicas:  metric.NewGauge(MetaInfosDeadReplicas),
+		InfosOther:         metric.NewGauge(MetaInfosOther),
+	}
+}
+
+// infosGauge returns the gauge counting infos with the given key.
+func (m InfoStoreMetrics) infosGauge(key string) *metric.Gauge {
+	switch KeyPrefix(key) {
+	case KeyStorePrefix:
+		return m.InfosStore
+	case KeyNodeIDPrefix:
+		return m.InfosNode
+	case KeyNodeLivenessPrefix:
+		return m.InfosLiveness
+	case KeyDeadReplicasPrefix:
+		return m.InfosDeadReplicas
+	default:
+		return m.InfosOther
+	}
+}
@@ -22,15 +22,19 @@ import (
 	"testing"
 	"time"
 
+	"github.com/gogo/protobuf/proto"
 	"github.com/pkg/errors"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 
+	"github.com/cockroachdb/cockroach/pkg/config"
 	"github.com/cockroachdb/cockroach/pkg/gossip/resolver"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/rpc"
 	"github.com/cockroachdb/cockroach/pkg/testutils"
 	"github.com/cockroachdb/cockroach/pkg/util"
+	"github.com/cockroachdb/cockroach/pkg/util/encoding"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/metric"
@@ -251,7 +255,7 @@ func TestGossipNoForwardSelf(t *testing.T) {
 		for {
 			localAddr := local.GetNodeAddr()
 			c := newClient(log.AmbientContext{}, localAddr, makeMetrics())
-			c.start(peer, disconnectedCh, peer.rpcContext, stopper, peer.rpcContext.NewBreaker())
+			c.start(peer, disconnectedCh, peer.rpcContext, stopper, peer.rpcContext.NewBreaker("test"))
 
 			disconnectedClient := <-disconnectedCh
 			if disconnectedClient != c {
@@ -378,3 +382,157 @@ func TestGossipOrphanedStallDetection(t *testing.T) {
 		return errors.Errorf("node %d not yet connected", peerNodeID)
 	})
 }
+
+// TestGossipSystemConfigDelta verifies that system config deltas are
+// applied to the last full system config with a matching hash, including
+// when the delta is received before the system config it is relative to,
+// and that a delta is never applied to a newer system config.
+func TestGossipSystemConfigDelta(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+	rpcContext := newInsecureRPCContext(stopper)
+
+	makeKV := func(k, v string) roachpb.KeyValue {
+		return roachpb.KeyValue{Key: roachpb.Key(k), Value: roachpb.MakeValueFromString(v)}
+	}
+	base := config.SystemConfig{Values: []roachpb.KeyValue{makeKV("a", "1"), makeKV("b", "1")}}
+	updated := config.SystemConfig{Values: []roachpb.KeyValue{makeKV("b", "2"), makeKV("c", "1")}}
+	delta := updated.Diff(base)
+	unrelated := config.SystemConfig{Values: []roachpb.KeyValue{makeKV("d", "1")}}
+
+	// update delivers msg to g as if it had been gossiped under key at the
+	// specified wall time.
+	update := func(g *Gossip, key string, msg proto.Message, wallTime int64) {
+		var v roachpb.Value
+		if err := v.SetProto(msg); err != nil {
+			t.Fatal(err)
+		}
+		v.Timestamp = hlc.Timestamp{WallTime: wallTime}
+		switch key {
+		case KeySystemConfig:
+			g.updateSystemConfig(key, v)
+		case KeySystemConfigDelta:
+			g.updateSystemConfigDelta(key, v)
+		}
+	}
+	expect := func(g *Gossip, expected config.SystemConfig) {
+		cfg, ok := g.GetSystemConfig()
+		if !ok {
+			t.Fatal("system config not set")
+		}
+		if !bytes.Equal(cfg.Hash(), expected.Hash()) {
+			t.Fatalf("expected system config %+v, got %+v", expected, cfg)
+		}
+	}
+
+	g := NewTest(1, rpcContext, rpc.NewServer(rpcContext), nil, stopper, metric.NewRegistry())
+	update(g, KeySystemConfig, &base, 1)
+	expect(g, base)
+	update(g, KeySystemConfigDelta, &delta, 2)
+	expect(g, updated)
+
+	// A newer system config which happens to have the hash the delta was
+	// computed against supersedes the delta, which is not applied again.
+	update(g, KeySystemConfig, &base, 3)
+	expect(g, base)
+	update(g, KeySystemConfigDelta, &delta, 2)
+	expect(g, base)
+
+	// A delta relative to an unknown system config is ignored.
+	update(g, KeySystemConfig, &unrelated, 4)
+	expect(g, unrelated)
+	update(g, KeySystemConfigDelta, &delta, 5)
+	expect(g, unrelated)
+
+	// A delta received before the older system config it is relative to is
+	// applied once that system config is received.
+	g = NewTest(2, rpcContext, rpc.NewServer(rpcContext), nil, stopper, metric.NewRegistry())
+	update(g, KeySystemConfigDelta, &delta, 2)
+	update(g, KeySystemConfig, &base, 1)
+	expect(g, updated)
+}
+
+// TestGossipBatchCallbackMetrics verifies that batch callbacks registered
+// under the same name share their metrics rather than registering new ones.
+func TestGossipBatchCallbackMetrics(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+	rpcContext := newInsecureRPCContext(stopper)
+	registry := metric.NewRegistry()
+	g := NewTest(1, rpcContext, rpc.NewServer(rpcContext), nil, stopper, registry)
+
+	countMetrics := func() int {
+		var count int
+		registry.Each(func(name string, _ interface{}) {
+			count++
+		})
+		return count
+	}
+	method := func(map[string]roachpb.Value) {}
+
+	g.RegisterBatchCallback("test", ".*", time.Millisecond, method)()
+	count := countMetrics()
+	for i := 0; i < 3; i++ {
+		g.RegisterBatchCallback("test", ".*", time.Millisecond, method)()
+	}
+	if c := countMetrics(); c != count {
+		t.Errorf("expected %d metrics after re-registering callbacks, found %d", count, c)
+	}
+}
+
+// TestGossipSystemConfigDeltasSupported verifies that system config deltas
+// are only supported once every node has gossiped a protocol version which
+// understands them.
+func TestGossipSystemConfigDeltasSupported(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+	rpcContext := newInsecureRPCContext(stopper)
+	g := NewTest(1, rpcContext, rpc.NewServer(rpcContext), nil, stopper, metric.NewRegistry())
+
+	if g.SystemConfigDeltasSupported() {
+		t.Error("expected deltas to be unsupported without any nodes")
+	}
+	if err := g.SetNodeDescriptor(&roachpb.NodeDescriptor{NodeID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if !g.SystemConfigDeltasSupported() {
+		t.Error("expected deltas to be supported")
+	}
+
+	// Node 2 predates the gossip protocol version key.
+	if err := g.AddInfoProto(MakeNodeIDKey(2), &roachpb.NodeDescriptor{NodeID: 2}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if g.SystemConfigDeltasSupported() {
+		t.Error("expected deltas to be unsupported with a node of unknown version")
+	}
+	for _, tc := range []struct {
+		version   uint64
+		supported bool
+	}{
+		{systemConfigDeltaVersion - 1, false},
+		{systemConfigDeltaVersion, true},
+	} {
+		version := encoding.EncodeUvarintAscending(nil, tc.version)
+		if err := g.AddInfo(MakeGossipVersionKey(2), version, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if supported := g.SystemConfigDeltasSupported(); supported != tc.supported {
+			t.Errorf("%d: expected supported=%t, got %t", tc.version, tc.supported, supported)
+		}
+	}
+
+	// Removed nodes are not considered.
+	if err := g.AddInfo(MakeGossipVersionKey(2), encoding.EncodeUvarintAscending(nil, 0), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.RemoveNode(2, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !g.SystemConfigDeltasSupported() {
+		t.Error("expected deltas to be supported after removing node 2")
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package gossip
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/util/encoding"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/uuid"
+)
+
+// gossipProtocolVersion is the version of the gossip protocol spoken by
+// this node. It is exchanged with the cluster ID in the handshake which
+// opens every gossip connection, and gossiped under KeyGossipVersionPrefix.
+//
+// Version 2 adds KeySystemConfigDelta.
+// Version 3 adds compressed infos.
+const gossipProtocolVersion = 3
+
+// systemConfigDeltaVersion is the first gossip protocol version whose
+// nodes apply the deltas gossiped under KeySystemConfigDelta.
+const systemConfigDeltaVersion = 2
+
+// compressedInfoVersion is the first gossip protocol version whose nodes
+// decompress the infos they receive. Infos sent to peers speaking an
+// earlier version are never compressed.
+const compressedInfoVersion = 3
+
+// minProtocolVersion is the minimum gossip protocol version of peers this
+// node gossips with. Peers which predate the handshake report version zero;
+// they are treated as legacy peers and accepted, as are peers which have
+// not set their cluster ID.
+const minProtocolVersion = 1
+
+// handshakeRejectionTimeout is the duration for which no clients are
+// started to a peer which failed the handshake. Peers may be upgraded or
+// reconfigured, so the rejection is retried once it expires.
+const handshakeRejectionTimeout = 10 * time.Minute
+
+// handshakeErrorPrefix prefixes the descriptions of the errors returned to
+// peers which fail the handshake, which allows the peers to recognize
+// them; see isHandshakeError.
+const handshakeErrorPrefix = "gossip handshake failed: "
+
+// handshakeError is the error of a failed handshake.
+type handshakeError struct {
+	msg string
+}
+
+func (e *handshakeError) Error() string {
+	return handshakeErrorPrefix + e.msg
+}
+
+func newHandshakeError(format string, args ...interface{}) error {
+	return &handshakeError{msg: fmt.Sprintf(format, args...)}
+}
+
+// SetClusterID sets the ID of the cluster this node belongs to. Peers
+// which belong to a different cluster are refused when connecting to or
+// accepting connections from this node. Until the cluster ID is set, as
+// is the case for a node joining a cluster, peers of any cluster are
+// accepted. The cluster ID cannot be changed once set.
+func (g *Gossip) SetClusterID(clusterID uuid.UUID) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.mu.clusterID != (uuid.UUID{}) && g.mu.clusterID != clusterID {
+		return errors.Errorf("cluster ID already set to %s, cannot change to %s", g.mu.clusterID, clusterID)
+	}
+	g.mu.clusterID = clusterID
+	return nil
+}
+
+// verifyHandshakeLocked returns an error if a peer with the specified
+// cluster ID and protocol version may not gossip with this node. An
+// unknown cluster ID on either side is accepted so that joining nodes can
+// learn the cluster ID through gossip, and so is the version zero of legacy
+// peers which predate the handshake. The returned error is a
+// handshakeError. The mutex must be held by the caller.
+func (s *server) verifyHandshakeLocked(
+	nodeID roachpb.NodeID, clusterID uuid.UUID, version uint32,
+) error {
+	if version != 0 && version < minProtocolVersion {
+		return newHandshakeError(
+			"node %d speaks gossip protocol version %d; the minimum supported version is %d",
+			nodeID, version, minProtocolVersion)
+	}
+	if clusterID != (uuid.UUID{}) && s.mu.clusterID != (uuid.UUID{}) && clusterID != s.mu.clusterID {
+		return newHandshakeError(
+			"node %d belongs to cluster %s, not to cluster %s", nodeID, clusterID, s.mu.clusterID)
+	}
+	return nil
+}
+
+// SystemConfigDeltasSupported returns whether every node in the cluster
+// applies the system config deltas gossiped under KeySystemConfigDelta.
+// Until then, the system config must be gossiped in full under
+// KeySystemConfig. Nodes are known by their node descriptors, and a node
+// which has not gossiped its protocol version is assumed to predate the
+// deltas.
+func (g *Gossip) SystemConfigDeltasSupported() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	supported := false
+	prefix := KeyNodeIDPrefix + separator
+	if err := g.mu.is.visitInfos(func(key string, i *Info) error {
+		if !strings.HasPrefix(key, prefix) || IsTombstone(key, i.Value) {
+			return nil
+		}
+		nodeID, err := NodeIDFromKey(key)
+		if err != nil {
+			return err
+		}
+		version := g.mu.is.getInfo(MakeGossipVersionKey(nodeID))
+		if version == nil {
+			return errors.Errorf("node %d has not gossiped its protocol version", nodeID)
+		}
+		b, err := version.Value.GetBytes()
+		if err != nil {
+			return err
+		}
+		if _, v, err := encoding.DecodeUvarintAscending(b); err != nil {
+			return err
+		} else if v < systemConfigDeltaVersion {
+			return errors.Errorf("node %d speaks gossip protocol version %d", nodeID, v)
+		}
+		supported = true
+		return nil
+	}); err != nil {
+		return false
+	}
+	return supported
+}
+
+// toGRPCError converts a handshake error into the error returned to the
+// peer which failed the handshake.
+func toGRPCError(err error) error {
+	return grpc.Errorf(codes.PermissionDenied, "%s", err)
+}
+
+// isHandshakeError returns true if the error is the result of a failed
+// handshake, either on this node or on the peer.
+func isHandshakeError(err error) bool {
+	err = errors.Cause(err)
+	if _, ok := err.(*handshakeError); ok {
+		return true
+	}
+	return grpc.Code(err) == codes.PermissionDenied &&
+		strings.HasPrefix(grpc.ErrorDesc(err), handshakeErrorPrefix)
+}
+
+// rejectAddr records that the peer at the specified address failed the
+// handshake. No further clients are started to the address until
+// handshakeRejectionTimeout elapses or a handshake with the peer succeeds.
+func (g *Gossip) rejectAddr(addr net.Addr, err error) {
+	g.clientsMu.Lock()
+	defer g.clientsMu.Unlock()
+	if !g.isRejectedAddrLocked(addr.String()) {
+		ctx := g.AnnotateCtx(context.TODO())
+		log.Warningf(ctx, "not gossiping with %s for %s: %s", addr, handshakeRejectionTimeout, err)
+	}
+	g.clientsMu.rejected[addr.String()] = g.clock.Now().Add(handshakeRejectionTimeout)
+}
+
+// acceptAddr clears the rejection of the peer at the specified address
+// after a successful handshake.
+func (g *Gossip) acceptAddr(addr net.Addr) {
+	g.clientsMu.Lock()
+	defer g.clientsMu.Unlock()
+	delete(g.clientsMu.rejected, addr.String())
+}
+
+// isRejectedAddr returns true if the peer at the specified address failed
+// the handshake within the last handshakeRejectionTimeout.
+func (g *Gossip) isRejectedAddr(addr string) bool {
+	g.clientsMu.Lock()
+	defer g.clientsMu.Unlock()
+	return g.isRejectedAddrLocked(addr)
+}
+
+// isRejectedAddrLocked is like isRejectedAddr, but clientsMu must be held
+// by the caller. Expired rejections are removed.
+func (g *Gossip) isRejectedAddrLocked(addr string) bool {
+	until, ok := g.clientsMu.rejected[addr]
+	if !ok {
+		return false
+	}
+	if !g.clock.Now().Before(until) {
+		delete(g.clientsMu.rejected, addr)
+		return false
+	}
+	return true
+}
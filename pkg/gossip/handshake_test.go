@@ -0,0 +1,183 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package gossip
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/cockroachdb/cockroach/pkg/util"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/metric"
+	"github.com/cockroachdb/cockroach/pkg/util/stop"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	"github.com/cockroachdb/cockroach/pkg/util/uuid"
+)
+
+// TestGossipHandshakeClusterIDMismatch verifies that nodes of different
+// clusters refuse to gossip with each other, and that the refusal is
+// permanent.
+func TestGossipHandshakeClusterIDMismatch(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+	local := startGossip(1, stopper, t, metric.NewRegistry())
+	remote := startGossip(2, stopper, t, metric.NewRegistry())
+	if err := local.SetClusterID(uuid.MakeV4()); err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.SetClusterID(uuid.MakeV4()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := local.AddInfo("local-key", nil, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.AddInfo("remote-key", nil, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	addr := remote.GetNodeAddr()
+	local.startClient(addr)
+	util.SucceedsSoon(t, func() error {
+		if !local.isRejectedAddr(addr.String()) {
+			return errors.Errorf("expected %s to be rejected", addr)
+		}
+		if c := local.findClient(func(c *client) bool { return true }); c != nil {
+			return errors.Errorf("expected no clients, found client to %s", c.addr)
+		}
+		return nil
+	})
+
+	// No further clients are started to the rejected address.
+	local.startClient(addr)
+	if c := local.findClient(func(c *client) bool { return true }); c != nil {
+		t.Errorf("expected no clients, found client to %s", c.addr)
+	}
+
+	// The rejection expires.
+	local.clientsMu.Lock()
+	local.clientsMu.rejected[addr.String()] = timeutil.Now()
+	local.clientsMu.Unlock()
+	if local.isRejectedAddr(addr.String()) {
+		t.Errorf("expected rejection of %s to expire", addr)
+	}
+
+	if _, err := remote.GetInfo("local-key"); err == nil {
+		t.Error("expected local info not to be gossiped to remote cluster")
+	}
+	if _, err := local.GetInfo("remote-key"); err == nil {
+		t.Error("expected remote info not to be gossiped to local cluster")
+	}
+}
+
+// TestGossipHandshakeUnknownClusterID verifies that a node which does not
+// know its cluster ID yet gossips with nodes of any cluster.
+func TestGossipHandshakeUnknownClusterID(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+	local := startGossip(1, stopper, t, metric.NewRegistry())
+	remote := startGossip(2, stopper, t, metric.NewRegistry())
+	if err := remote.SetClusterID(uuid.MakeV4()); err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.AddInfo("remote-key", nil, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	local.startClient(remote.GetNodeAddr())
+	util.SucceedsSoon(t, func() error {
+		_, err := local.GetInfo("remote-key")
+		return err
+	})
+}
+
+// TestClientHandshake verifies that a client refuses responses from
+// servers of other clusters, and accepts responses from legacy servers
+// which predate the handshake.
+func TestClientHandshake(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+	local := startGossip(1, stopper, t, metric.NewRegistry())
+	clusterID := uuid.MakeV4()
+	if err := local.SetClusterID(clusterID); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		clusterID uuid.UUID
+		version   uint32
+		expErr    bool
+	}{
+		{clusterID, gossipProtocolVersion, false},
+		{uuid.UUID{}, gossipProtocolVersion, false},
+		{uuid.MakeV4(), gossipProtocolVersion, true},
+		{uuid.UUID{}, 0, false},
+	}
+	for i, tc := range testCases {
+		c := newClient(log.AmbientContext{}, local.GetNodeAddr(), makeMetrics())
+		reply := &Response{
+			NodeID:          2,
+			ClusterID:       tc.clusterID,
+			ProtocolVersion: tc.version,
+		}
+		err := c.handleResponse(context.TODO(), local, reply)
+		if tc.expErr {
+			if !isHandshakeError(err) {
+				t.Errorf("%d: expected handshake error, got %v", i, err)
+			}
+			if c.verified {
+				t.Errorf("%d: expected client not to be verified", i)
+			}
+		} else if err != nil {
+			t.Errorf("%d: unexpected error: %s", i, err)
+		}
+	}
+
+	if err := local.SetClusterID(uuid.MakeV4()); err == nil {
+		t.Error("expected error changing the cluster ID")
+	}
+}
+
+// TestIsHandshakeError verifies that handshake errors are recognized
+// both locally and once returned by a peer, and that other errors with
+// the same gRPC code are not.
+func TestIsHandshakeError(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	err := newHandshakeError("node %d belongs to another cluster", 2)
+	testCases := []struct {
+		err      error
+		expected bool
+	}{
+		{err, true},
+		{errors.Wrap(err, "gossip"), true},
+		{toGRPCError(err), true},
+		{grpc.Errorf(codes.PermissionDenied, "permission denied"), false},
+		{errors.New(err.Error()), false},
+	}
+	for i, tc := range testCases {
+		if actual := isHandshakeError(tc.err); actual != tc.expected {
+			t.Errorf("%d: expected %t for %v, got %t", i, tc.expected, tc.err, actual)
+		}
+	}
+}
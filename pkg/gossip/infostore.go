@@ -53,6 +53,13 @@ type callback struct {
 	method  Callback
 }
 
+// expirationCallback holds regexp pattern match and ExpirationCallback
+// method.
+type expirationCallback struct {
+	matcher stringMatcher
+	method  ExpirationCallback
+}
+
 // infoStore objects manage maps of Info objects. They maintain a
 // sequence number generator which they use to allocate new info
 // objects.
@@ -73,15 +80,20 @@ type infoStore struct {
 	NodeAddr        util.UnresolvedAddr      `json:"-"`               // Address of node owning this info store: "host:port"
 	highWaterStamps map[roachpb.NodeID]int64 // Per-node information for gossip peers
 	callbacks       []*callback
+	batchCallbacks  []*batchCallback
+
+	expirationCallbacks []*expirationCallback
+
+	// clock timestamps new infos and expires old ones. lastStamp is the
+	// last timestamp handed out by monotonicUnixNano.
+	clock     Clock
+	lastStamp int64
 
 	callbackMu     syncutil.Mutex // Serializes callbacks
 	callbackWorkMu syncutil.Mutex // Protects callbackWork
 	callbackWork   []func()
-}
 
-var monoTime struct {
-	syncutil.Mutex
-	last int64
+	metrics InfoStoreMetrics
 }
 
 var errNotFresh = errors.New("info not fresh")
@@ -92,15 +104,12 @@ var errNotFresh = errors.New("info not fresh")
 // newly created value in the event one is created within the same
 // nanosecond. Really unlikely except for the case of unittests, but
 // better safe than sorry.
-func monotonicUnixNano() int64 {
-	monoTime.Lock()
-	defer monoTime.Unlock()
-
-	now := timeutil.Now().UnixNano()
-	if now <= monoTime.last {
-		now = monoTime.last + 1
+func (is *infoStore) monotonicUnixNano() int64 {
+	now := is.clock.Now().UnixNano()
+	if now <= is.lastStamp {
+		now = is.lastStamp + 1
 	}
-	monoTime.last = now
+	is.lastStamp = now
 	return now
 }
 
@@ -140,6 +149,8 @@ func newInfoStore(
 		Infos:           make(infoMap),
 		NodeAddr:        nodeAddr,
 		highWaterStamps: map[roachpb.NodeID]int64{},
+		clock:           realClock{},
+		metrics:         makeInfoStoreMetrics(),
 	}
 }
 
@@ -150,7 +161,7 @@ func (is *infoStore) newInfo(val []byte, ttl time.Duration) *Info {
 	if nodeID == 0 {
 		panic("gossip infostore's NodeID is 0")
 	}
-	now := monotonicUnixNano()
+	now := is.monotonicUnixNano()
 	ttlStamp := now + int64(ttl)
 	if ttl == 0 {
 		ttlStamp = math.MaxInt64
@@ -168,8 +179,8 @@ func (is *infoStore) newInfo(val []byte, ttl time.Duration) *Info {
 func (is *infoStore) getInfo(key string) *Info {
 	if info, ok := is.Infos[key]; ok {
 		// Check TTL and discard if too old.
-		if info.expired(timeutil.Now().UnixNano()) {
-			delete(is.Infos, key)
+		if info.expired(is.clock.Now().UnixNano()) {
+			is.expireInfo(key)
 		} else {
 			return info
 		}
@@ -186,7 +197,8 @@ func (is *infoStore) addInfo(key string, i *Info) error {
 	}
 	// Only replace an existing info if new timestamp is greater, or if
 	// timestamps are equal, but new hops is smaller.
-	if existingInfo, ok := is.Infos[key]; ok {
+	existingInfo, ok := is.Infos[key]
+	if ok {
 		iNanos := i.Value.Timestamp.WallTime
 		existingNanos := existingInfo.Value.Timestamp.WallTime
 		if iNanos < existingNanos || (iNanos == existingNanos && i.Hops >= existingInfo.Hops) {
@@ -195,12 +207,16 @@ func (is *infoStore) addInfo(key string, i *Info) error {
 	}
 	if i.OrigStamp == 0 {
 		i.Value.InitChecksum([]byte(key))
-		i.OrigStamp = monotonicUnixNano()
+		i.OrigStamp = is.monotonicUnixNano()
 		if highWaterStamp, ok := is.highWaterStamps[i.NodeID]; ok && highWaterStamp >= i.OrigStamp {
 			panic(errors.Errorf("high water stamp %d >= %d", highWaterStamp, i.OrigStamp))
 		}
 	}
 	// Update info map.
+	if !ok {
+		g := is.metrics.infosGauge(key)
+		g.Update(g.Value() + 1)
+	}
 	is.Infos[key] = i
 	// Update the high water timestamp & min hops for the originating node.
 	if nID := i.NodeID; nID != 0 {
@@ -209,9 +225,42 @@ func (is *infoStore) addInfo(key string, i *Info) error {
 		}
 	}
 	is.processCallbacks(key, i.Value)
+	is.processBatchCallbacks(key, i.Value)
 	return nil
 }
 
+// deleteInfo removes the info at key from the infos map.
+func (is *infoStore) deleteInfo(key string) {
+	if _, ok := is.Infos[key]; !ok {
+		return
+	}
+	delete(is.Infos, key)
+	g := is.metrics.infosGauge(key)
+	g.Update(g.Value() - 1)
+}
+
+// expireInfo removes the expired info at key from the infos map and
+// notifies the matching expiration callbacks.
+func (is *infoStore) expireInfo(key string) {
+	if _, ok := is.Infos[key]; !ok {
+		return
+	}
+	is.deleteInfo(key)
+	is.processExpirationCallbacks(key)
+}
+
+// expireInfos removes all expired infos from the infos map. Infos are
+// otherwise only removed once they are accessed after expiring, which
+// would delay expiration callbacks indefinitely.
+func (is *infoStore) expireInfos() {
+	now := is.clock.Now().UnixNano()
+	for key, i := range is.Infos {
+		if i.expired(now) {
+			is.expireInfo(key)
+		}
+	}
+}
+
 // getHighWaterStamps returns a copy of the high water stamps map of
 // gossip peer info maintained by this infostore.
 func (is *infoStore) getHighWaterStamps() map[roachpb.NodeID]int64 {
@@ -257,6 +306,58 @@ func (is *infoStore) registerCallback(pattern string, method Callback) func() {
 	}
 }
 
+// registerExpirationCallback registers a callback for a key pattern to be
+// invoked whenever an info for a gossip key matching pattern expires and is
+// removed from the infostore. Returns a function to unregister the
+// callback. Note: the callback may fire after being unregistered.
+func (is *infoStore) registerExpirationCallback(
+	pattern string, method ExpirationCallback,
+) func() {
+	var matcher stringMatcher
+	if pattern == ".*" {
+		matcher = allMatcher{}
+	} else {
+		matcher = regexp.MustCompile(pattern)
+	}
+	cb := &expirationCallback{matcher: matcher, method: method}
+	is.expirationCallbacks = append(is.expirationCallbacks, cb)
+
+	return func() {
+		for i, targetCB := range is.expirationCallbacks {
+			if targetCB == cb {
+				numCBs := len(is.expirationCallbacks)
+				is.expirationCallbacks[i] = is.expirationCallbacks[numCBs-1]
+				is.expirationCallbacks = is.expirationCallbacks[:numCBs-1]
+				break
+			}
+		}
+	}
+}
+
+// processExpirationCallbacks invokes the expiration callbacks matching
+// the specified key. The callbacks are queued behind any pending update
+// callbacks, so subscribers observe the expiration after the updates
+// which preceded it.
+func (is *infoStore) processExpirationCallbacks(key string) {
+	var matches []ExpirationCallback
+	for _, cb := range is.expirationCallbacks {
+		if cb.matcher.MatchString(key) {
+			matches = append(matches, cb.method)
+		}
+	}
+	if len(matches) == 0 {
+		return
+	}
+	queuedAt := timeutil.Now()
+	is.queueCallbackWork(func() {
+		for _, method := range matches {
+			method(key)
+		}
+		is.metrics.CallbacksProcessed.Inc(int64(len(matches)))
+		is.metrics.CallbackLatency.RecordValue(timeutil.Since(queuedAt).Nanoseconds())
+	})
+}
+
 // processCallbacks processes callbacks for the specified key by
 // matching callback regular expression against the key and invoking
 // the corresponding callback method on a match.
@@ -272,13 +373,23 @@ func (is *infoStore) processCallbacks(key string, content roachpb.Value) {
 
 func (is *infoStore) runCallbacks(key string, content roachpb.Value, callbacks ...Callback) {
 	// Add the callbacks to the callback work list.
+	queuedAt := timeutil.Now()
 	f := func() {
 		for _, method := range callbacks {
 			method(key, content)
 		}
+		is.metrics.CallbacksProcessed.Inc(int64(len(callbacks)))
+		is.metrics.CallbackLatency.RecordValue(timeutil.Since(queuedAt).Nanoseconds())
 	}
+	is.queueCallbackWork(f)
+}
+
+// queueCallbackWork adds f to the callback work list, which is run in
+// order on a separate goroutine.
+func (is *infoStore) queueCallbackWork(f func()) {
 	is.callbackWorkMu.Lock()
 	is.callbackWork = append(is.callbackWork, f)
+	is.metrics.CallbacksPending.Update(int64(len(is.callbackWork)))
 	is.callbackWorkMu.Unlock()
 
 	// Run callbacks in a goroutine to avoid mutex reentry. We also guarantee
@@ -293,6 +404,7 @@ func (is *infoStore) runCallbacks(key string, content roachpb.Value, callbacks .
 		is.callbackWorkMu.Lock()
 		work := is.callbackWork
 		is.callbackWork = nil
+		is.metrics.CallbacksPending.Update(0)
 		is.callbackWorkMu.Unlock()
 
 		for _, w := range work {
@@ -308,12 +420,12 @@ func (is *infoStore) runCallbacks(key string, content roachpb.Value, callbacks .
 // function against each info in turn. Be sure to skip over any expired
 // infos.
 func (is *infoStore) visitInfos(visitInfo func(string, *Info) error) error {
-	now := timeutil.Now().UnixNano()
+	now := is.clock.Now().UnixNano()
 
 	if visitInfo != nil {
 		for k, i := range is.Infos {
 			if i.expired(now) {
-				delete(is.Infos, k)
+				is.expireInfo(k)
 				continue
 			}
 			if err := visitInfo(k, i); err != nil {
@@ -341,6 +453,10 @@ func (is *infoStore) combine(
 		if infoCopy.OrigStamp == 0 {
 			panic(errors.Errorf("combining info from node %d with 0 original timestamp", nodeID))
 		}
+		if decompressErr := decompressInfo(key, &infoCopy); decompressErr != nil {
+			err = decompressErr
+			continue
+		}
 		if addErr := is.addInfo(key, &infoCopy); addErr == nil {
 			freshCount++
 		} else if addErr != errNotFresh {
@@ -372,10 +488,20 @@ func (is *infoStore) delta(highWaterTimestamps map[roachpb.NodeID]int64) map[str
 // mostDistant returns the most distant gossip node known to the
 // store as well as the number of hops to reach it.
 func (is *infoStore) mostDistant() (roachpb.NodeID, uint32) {
+	return is.mostDistantFiltered(func(roachpb.NodeID) bool { return true })
+}
+
+// mostDistantFiltered is like mostDistant, but only considers the nodes
+// for which filterFn returns true.
+func (is *infoStore) mostDistantFiltered(
+	filterFn func(node roachpb.NodeID) bool,
+) (roachpb.NodeID, uint32) {
 	var nodeID roachpb.NodeID
 	var maxHops uint32
 	if err := is.visitInfos(func(key string, i *Info) error {
-		if i.Hops > maxHops {
+		// Ties are broken by node ID so that the choice does not depend on
+		// the iteration order of the infos.
+		if (i.Hops > maxHops || (i.Hops == maxHops && i.NodeID < nodeID)) && filterFn(i.NodeID) {
 			maxHops = i.Hops
 			nodeID = i.NodeID
 		}
@@ -409,7 +535,7 @@ func (is *infoStore) leastUseful(nodes nodeSet) roachpb.NodeID {
 	for id, m := range contrib {
 		count := len(m)
 		if nodes.hasNode(id) {
-			if count < least {
+			if count < least || (count == least && id < leastNode) {
 				least = count
 				leastNode = id
 			}
@@ -494,3 +494,205 @@ func TestRegisterCallback(t *testing.T) {
 		t.Errorf("expected %v, got %v", expKeys, cb.Keys())
 	}
 }
+
+// TestExpirationCallbacks verifies that expiration callbacks are invoked
+// for matching infos once they expire, but not for infos which are still
+// live or replaced.
+func TestExpirationCallbacks(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	is, stopper := newTestInfoStore()
+	defer stopper.Stop()
+	wg := &sync.WaitGroup{}
+	cb := callbackRecord{wg: wg}
+	unregister := is.registerExpirationCallback("key.*", func(key string) {
+		cb.Add(key, roachpb.Value{})
+	})
+
+	for key, ttl := range map[string]time.Duration{
+		"key1":  time.Nanosecond,
+		"key2":  time.Hour,
+		"other": time.Nanosecond,
+	} {
+		if err := is.addInfo(key, is.newInfo(nil, ttl)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(time.Millisecond)
+
+	wg.Add(1)
+	is.expireInfos()
+	wg.Wait()
+	if expKeys := []string{"key1"}; !reflect.DeepEqual(cb.Keys(), expKeys) {
+		t.Errorf("expected %v, got %v", expKeys, cb.Keys())
+	}
+	for _, key := range []string{"key1", "other"} {
+		if _, ok := is.Infos[key]; ok {
+			t.Errorf("expected expired info %q to be removed", key)
+		}
+	}
+	if is.getInfo("key2") == nil {
+		t.Error("expected live info to remain")
+	}
+
+	// Infos expiring on access notify the callbacks as well.
+	if err := is.addInfo("key3", is.newInfo(nil, time.Nanosecond)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	wg.Add(1)
+	if is.getInfo("key3") != nil {
+		t.Error("expected info to have expired")
+	}
+	wg.Wait()
+	if expKeys := []string{"key1", "key3"}; !reflect.DeepEqual(cb.Keys(), expKeys) {
+		t.Errorf("expected %v, got %v", expKeys, cb.Keys())
+	}
+
+	// Unregister the callback and verify it is no longer invoked.
+	unregister()
+	if err := is.addInfo("key4", is.newInfo(nil, time.Nanosecond)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	is.expireInfos()
+	if len(is.expirationCallbacks) != 0 {
+		t.Errorf("expected no expiration callbacks, got %d", len(is.expirationCallbacks))
+	}
+}
+
+// TestInfoStoreMetrics verifies that the infostore tracks the number of
+// infos by key prefix and the processing of callbacks.
+func TestInfoStoreMetrics(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	is, stopper := newTestInfoStore()
+	defer stopper.Stop()
+
+	wg := &sync.WaitGroup{}
+	cb := callbackRecord{wg: wg}
+	is.registerCallback(".*", cb.Add)
+
+	keys := []string{
+		MakeNodeIDKey(1),
+		MakeNodeIDKey(2),
+		MakeStoreKey(1),
+		KeySentinel,
+		KeyClusterID,
+	}
+	wg.Add(len(keys))
+	for _, key := range keys {
+		if err := is.addInfo(key, is.newInfo(nil, time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Replacing an info does not change the counts.
+	wg.Add(1)
+	if err := is.addInfo(MakeNodeIDKey(1), is.newInfo(nil, time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	// An expired info is uncounted once it is noticed.
+	wg.Add(1)
+	if err := is.addInfo(MakeNodeLivenessKey(1), is.newInfo(nil, time.Nanosecond)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Nanosecond)
+	if is.getInfo(MakeNodeLivenessKey(1)) != nil {
+		t.Fatal("expected liveness info to have expired")
+	}
+	wg.Wait()
+
+	for _, test := range []struct {
+		gauge    *metric.Gauge
+		expected int64
+	}{
+		{is.metrics.InfosNode, 2},
+		{is.metrics.InfosStore, 1},
+		{is.metrics.InfosLiveness, 0},
+		{is.metrics.InfosDeadReplicas, 0},
+		{is.metrics.InfosOther, 2},
+	} {
+		if v := test.gauge.Value(); v != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.gauge.GetName(), test.expected, v)
+		}
+	}
+
+	util.SucceedsSoon(t, func() error {
+		if c := is.metrics.CallbacksProcessed.Count(); c != int64(len(keys)+2) {
+			return fmt.Errorf("expected %d callbacks processed, got %d", len(keys)+2, c)
+		}
+		if c := is.metrics.CallbackLatency.TotalCount(); c != int64(len(keys)+2) {
+			return fmt.Errorf("expected %d latency samples, got %d", len(keys)+2, c)
+		}
+		return nil
+	})
+	if v := is.metrics.CallbacksPending.Value(); v != 0 {
+		t.Errorf("expected no pending callbacks, got %d", v)
+	}
+}
+
+// TestBatchCallbacks verifies that batch callbacks receive the latest
+// value of every matching key, coalescing updates within a flush interval.
+func TestBatchCallbacks(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	is, stopper := newTestInfoStore()
+	defer stopper.Stop()
+
+	var mu syncutil.Mutex
+	var batches []map[string]roachpb.Value
+	delivered := map[string]roachpb.Value{}
+	method := func(batch map[string]roachpb.Value) {
+		mu.Lock()
+		defer mu.Unlock()
+		batches = append(batches, batch)
+		for key, val := range batch {
+			delivered[key] = val
+		}
+	}
+
+	if err := is.addInfo(MakeStoreKey(1), is.newInfo([]byte("a"), time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	metrics := makeBatchCallbackMetrics("test")
+	is.registerBatchCallback(MakePrefixPattern(KeyStorePrefix), 10*time.Millisecond, method, metrics)
+
+	latest := is.newInfo([]byte("c"), time.Second)
+	for _, i := range []*Info{is.newInfo([]byte("b"), time.Second), latest} {
+		if err := is.addInfo(MakeStoreKey(2), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := is.addInfo(MakeNodeIDKey(1), is.newInfo(nil, time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	util.SucceedsSoon(t, func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(delivered) != 2 {
+			return fmt.Errorf("expected 2 keys delivered, got %v", delivered)
+		}
+		if b := metrics.Batches.Count(); b != int64(len(batches)) {
+			return fmt.Errorf("expected %d batches, got %d", len(batches), b)
+		}
+		return nil
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := delivered[MakeNodeIDKey(1)]; ok {
+		t.Errorf("unexpected delivery of non-matching key")
+	}
+	if val := delivered[MakeStoreKey(2)]; !reflect.DeepEqual(val, latest.Value) {
+		t.Errorf("expected latest value %s, got %s", latest.Value, val)
+	}
+	// Every queued update was either delivered or coalesced.
+	var deliveredCount int64
+	for _, batch := range batches {
+		deliveredCount += int64(len(batch))
+	}
+	if q, c := metrics.Queued.Count(), metrics.Coalesced.Count(); q != 3 || q != deliveredCount+c {
+		t.Errorf("expected 3 queued updates = %d delivered + %d coalesced, got %d", deliveredCount, c, q)
+	}
+	if p := metrics.Pending.Value(); p != 0 {
+		t.Errorf("expected no pending updates, got %d", p)
+	}
+}
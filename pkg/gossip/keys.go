@@ -70,10 +70,26 @@ const (
 	// of storage.Replica structs.
 	KeyFirstRangeDescriptor = "first-range"
 
+	// KeyGossipClientsPrefix is the key prefix for gossiping a node's
+	// outgoing gossip connections. The suffix is a node ID and the value is
+	// a comma-separated list of the node IDs the node is connected to.
+	KeyGossipClientsPrefix = "gossip-clients"
+
+	// KeyGossipVersionPrefix is the key prefix for gossiping the gossip
+	// protocol version spoken by a node. The suffix is a node ID and the
+	// value is the uvarint encoded version. Nodes which predate it do not
+	// gossip their version.
+	KeyGossipVersionPrefix = "gossip-version"
+
 	// KeySystemConfig is the gossip key for the system DB span.
 	// The value if a config.SystemConfig which holds all key/value
 	// pairs in the system DB span.
 	KeySystemConfig = "system-db"
+
+	// KeySystemConfigDelta is the gossip key for incremental system config
+	// updates. The value is a config.SystemConfigDelta relative to the
+	// system config last gossiped under KeySystemConfig.
+	KeySystemConfigDelta = "system-config-delta"
 )
 
 // MakeKey creates a canonical key under which to gossip a piece of
@@ -83,6 +99,15 @@ func MakeKey(components ...string) string {
 	return strings.Join(components, separator)
 }
 
+// KeyPrefix returns the prefix of a key created by MakeKey, which is its
+// first component. Keys with a single component are their own prefix.
+func KeyPrefix(key string) string {
+	if i := strings.Index(key, separator); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
+
 // MakePrefixPattern returns a regular expression pattern that
 // matches precisely the Gossip keys created by invocations of
 // MakeKey with multiple arguments for which the first argument
@@ -121,7 +146,35 @@ func MakeStoreKey(storeID roachpb.StoreID) string {
 	return MakeKey(KeyStorePrefix, storeID.String())
 }
 
+// StoreIDFromKey attempts to extract a StoreID from the provided key. The
+// key should have been constructed by MakeStoreKey or MakeDeadReplicasKey.
+// Returns an error if the key is not of the correct type or is not
+// parsable.
+func StoreIDFromKey(key string) (roachpb.StoreID, error) {
+	prefix := KeyPrefix(key)
+	if prefix != KeyStorePrefix && prefix != KeyDeadReplicasPrefix {
+		return 0, errors.Errorf("%q is not a StoreID Key", key)
+	}
+	storeID, err := strconv.ParseInt(strings.TrimPrefix(key, prefix+separator), 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed parsing StoreID from key %q", key)
+	}
+	return roachpb.StoreID(storeID), nil
+}
+
 // MakeDeadReplicasKey returns the dead replicas gossip key for the given store.
 func MakeDeadReplicasKey(storeID roachpb.StoreID) string {
 	return MakeKey(KeyDeadReplicasPrefix, storeID.String())
 }
+
+// MakeGossipVersionKey returns the gossip key for the gossip protocol
+// version spoken by the node.
+func MakeGossipVersionKey(nodeID roachpb.NodeID) string {
+	return MakeKey(KeyGossipVersionPrefix, nodeID.String())
+}
+
+// MakeGossipClientsKey returns the gossip key for the outgoing gossip
+// connections of the given node.
+func MakeGossipClientsKey(nodeID roachpb.NodeID) string {
+	return MakeKey(KeyGossipClientsPrefix, nodeID.String())
+}
@@ -0,0 +1,143 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package gossip
+
+import (
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cockroachdb/cockroach/pkg/util/envutil"
+)
+
+// Limits holds the parameters which shape the gossip network. They are
+// consumed live by the gossip server and client loops, so they can be
+// adjusted with SetLimits while gossip is running.
+type Limits struct {
+	// MaxHops is the maximum number of hops which any gossip info should
+	// require to transit between any two nodes. Nodes connect to peers
+	// beyond it to tighten the network, and the fan-out is derived from it.
+	MaxHops uint32
+	// MinPeers is the minimum fan-out, i.e. the number of incoming and
+	// outgoing connections allowed regardless of the size of the network.
+	MinPeers int
+	// MaxIncoming and MaxOutgoing cap the number of incoming and outgoing
+	// connections below the fan-out. Zero means no cap.
+	MaxIncoming int
+	MaxOutgoing int
+	// StallInterval is the interval between checks whether this node's
+	// connections are insufficient to keep it connected to the network.
+	StallInterval time.Duration
+}
+
+// DefaultLimits returns the default gossip limits.
+func DefaultLimits() Limits {
+	return Limits{
+		MaxHops:       MaxHops,
+		MinPeers:      minPeers,
+		StallInterval: defaultStallInterval,
+	}
+}
+
+// limitsFromEnv returns the default gossip limits with any overrides
+// specified by COCKROACH_GOSSIP_* environment variables applied.
+func limitsFromEnv() (Limits, error) {
+	l := DefaultLimits()
+	l.MaxHops = uint32(envutil.EnvOrDefaultInt("COCKROACH_GOSSIP_MAX_HOPS", int(l.MaxHops)))
+	l.MinPeers = envutil.EnvOrDefaultInt("COCKROACH_GOSSIP_MIN_PEERS", l.MinPeers)
+	l.MaxIncoming = envutil.EnvOrDefaultInt("COCKROACH_GOSSIP_MAX_INCOMING", l.MaxIncoming)
+	l.MaxOutgoing = envutil.EnvOrDefaultInt("COCKROACH_GOSSIP_MAX_OUTGOING", l.MaxOutgoing)
+	l.StallInterval = envutil.EnvOrDefaultDuration("COCKROACH_GOSSIP_STALL_INTERVAL", l.StallInterval)
+	return l, l.Validate()
+}
+
+// Validate returns an error if the limits would not allow a connected
+// gossip network.
+func (l Limits) Validate() error {
+	if l.MaxHops < 2 {
+		return errors.Errorf("max hops must be at least 2, got %d", l.MaxHops)
+	}
+	if l.MinPeers < 1 {
+		return errors.Errorf("min peers must be at least 1, got %d", l.MinPeers)
+	}
+	if l.MaxIncoming < 0 || l.MaxOutgoing < 0 {
+		return errors.Errorf("connection limits must not be negative, got %d incoming and %d outgoing",
+			l.MaxIncoming, l.MaxOutgoing)
+	}
+	if l.StallInterval <= 0 {
+		return errors.Errorf("stall interval must be positive, got %s", l.StallInterval)
+	}
+	return nil
+}
+
+// maxPeers returns the maximum number of peers each gossip node may
+// connect to. This is based on MaxHops, the maximum number of hops
+// allowed before the gossip network will seek to "tighten" by creating
+// new connections to distant nodes.
+func (l Limits) maxPeers(nodeCount int) int {
+	// This formula uses MaxHops-1, instead of MaxHops, to provide a
+	// "fudge" factor for max connected peers, to account for the
+	// arbitrary, decentralized way in which gossip networks are created.
+	maxPeers := int(math.Ceil(math.Exp(math.Log(float64(nodeCount)) / float64(l.MaxHops-1))))
+	if maxPeers < l.MinPeers {
+		return l.MinPeers
+	}
+	return maxPeers
+}
+
+// capConns returns maxPeers capped by the specified connection limit,
+// where zero means no limit.
+func capConns(maxPeers, limit int) int {
+	if limit > 0 && limit < maxPeers {
+		return limit
+	}
+	return maxPeers
+}
+
+// SetLimits validates and sets the gossip limits. The connection limits
+// apply immediately, though existing connections beyond them are only
+// closed as the network is culled; the stall interval applies from the
+// next check.
+func (g *Gossip) SetLimits(limits Limits) error {
+	if err := limits.Validate(); err != nil {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.mu.limits = limits
+	g.updateConnLimitsLocked()
+	select {
+	case g.limitsChanged <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// GetLimits returns the current gossip limits.
+func (g *Gossip) GetLimits() Limits {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.mu.limits
+}
+
+// updateConnLimitsLocked recomputes the maximum number of incoming and
+// outgoing connections from the limits and the size of the network. The
+// mutex must be held by the caller.
+func (g *Gossip) updateConnLimitsLocked() {
+	maxPeers := g.mu.limits.maxPeers(len(g.nodeDescs))
+	g.mu.incoming.setMaxSize(capConns(maxPeers, g.mu.limits.MaxIncoming))
+	g.outgoing.setMaxSize(capConns(maxPeers, g.mu.limits.MaxOutgoing))
+}
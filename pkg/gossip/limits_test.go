@@ -0,0 +1,105 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package gossip
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/rpc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/metric"
+	"github.com/cockroachdb/cockroach/pkg/util/stop"
+)
+
+func TestLimitsMaxPeers(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	testCases := []struct {
+		maxHops   uint32
+		minPeers  int
+		nodeCount int
+		expected  int
+	}{
+		{5, 3, 0, 3},
+		{5, 3, 10, 3},
+		{5, 3, 1000, 6},
+		{3, 3, 99, 10},
+		{4, 1, 30, 4},
+		{5, 8, 1000, 8},
+	}
+	for i, tc := range testCases {
+		l := Limits{MaxHops: tc.maxHops, MinPeers: tc.minPeers}
+		if maxPeers := l.maxPeers(tc.nodeCount); maxPeers != tc.expected {
+			t.Errorf("%d: expected %d max peers, got %d", i, tc.expected, maxPeers)
+		}
+	}
+}
+
+func TestLimitsValidate(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	if err := DefaultLimits().Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for i, mutate := range []func(*Limits){
+		func(l *Limits) { l.MaxHops = 1 },
+		func(l *Limits) { l.MinPeers = 0 },
+		func(l *Limits) { l.MaxIncoming = -1 },
+		func(l *Limits) { l.MaxOutgoing = -1 },
+		func(l *Limits) { l.StallInterval = 0 },
+	} {
+		l := DefaultLimits()
+		mutate(&l)
+		if err := l.Validate(); err == nil {
+			t.Errorf("%d: expected error for %+v", i, l)
+		}
+	}
+}
+
+// TestGossipSetLimits verifies that changed limits are applied to the
+// maximum number of incoming and outgoing connections.
+func TestGossipSetLimits(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+	rpcContext := newInsecureRPCContext(stopper)
+	g := NewTest(1, rpcContext, rpc.NewServer(rpcContext), nil, stopper, metric.NewRegistry())
+
+	g.mu.Lock()
+	for i := 1; i <= 99; i++ {
+		g.nodeDescs[roachpb.NodeID(i)] = &roachpb.NodeDescriptor{NodeID: roachpb.NodeID(i)}
+	}
+	g.mu.Unlock()
+
+	limits := Limits{MaxHops: 3, MinPeers: 3, MaxIncoming: 4, StallInterval: time.Second}
+	if err := g.SetLimits(limits); err != nil {
+		t.Fatal(err)
+	}
+	if l := g.GetLimits(); l != limits {
+		t.Errorf("expected limits %+v, got %+v", limits, l)
+	}
+	g.mu.Lock()
+	incoming, outgoing := g.mu.incoming.maxSize, g.outgoing.maxSize
+	g.mu.Unlock()
+	if incoming != 4 || outgoing != 10 {
+		t.Errorf("expected 4 incoming and 10 outgoing connections, got %d and %d", incoming, outgoing)
+	}
+
+	if err := g.SetLimits(Limits{}); err == nil {
+		t.Error("expected error setting invalid limits")
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package gossip
+
+import "github.com/cockroachdb/cockroach/pkg/roachpb"
+
+// maxRemoteLocalityPeers is the number of outgoing connections to nodes in
+// other localities which the tighten and cull heuristics aim for. Infos from
+// a remote locality only need to cross into this node's locality once to
+// reach all of it, so further connections to remote localities mostly carry
+// redundant traffic over expensive links.
+const maxRemoteLocalityPeers = 1
+
+// sameLocality returns whether two localities are considered the same for
+// the purpose of choosing gossip peers. Localities are compared on the tiers
+// they have in common; a locality without tiers matches any locality, so
+// that nodes without a configured locality are treated as local.
+func sameLocality(a, b roachpb.Locality) bool {
+	n := len(a.Tiers)
+	if len(b.Tiers) < n {
+		n = len(b.Tiers)
+	}
+	for i := 0; i < n; i++ {
+		if a.Tiers[i] != b.Tiers[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// isRemoteLocked returns whether the specified node is known to be in a
+// different locality than this node. Nodes whose descriptors aren't known
+// are not considered remote. The mutex must be held by the caller.
+func (g *Gossip) isRemoteLocked(nodeID roachpb.NodeID) bool {
+	local, ok := g.nodeDescs[g.NodeID.Get()]
+	if !ok {
+		return false
+	}
+	desc, ok := g.nodeDescs[nodeID]
+	if !ok {
+		return false
+	}
+	return !sameLocality(local.Locality, desc.Locality)
+}
+
+// remoteOutgoingLocked returns the subset of outgoing connections which are
+// to nodes in remote localities. The mutex must be held by the caller.
+func (g *Gossip) remoteOutgoingLocked() nodeSet {
+	return g.outgoing.filter(g.isRemoteLocked)
+}
+
+// localityTightenTargetLocked returns the node to connect to in order to
+// tighten the network towards the specified distant node. If the distant
+// node is in a remote locality and this node already has its share of
+// connections to remote localities, the most distant node in this node's
+// locality which is beyond the MaxHops limit is preferred instead; bringing it closer
+// typically brings the remote node closer too, via the existing
+// inter-locality connections. If there is no such node, the distant node is
+// returned. The mutex must be held by the caller.
+func (g *Gossip) localityTightenTargetLocked(distantNodeID roachpb.NodeID) roachpb.NodeID {
+	if !g.isRemoteLocked(distantNodeID) ||
+		g.remoteOutgoingLocked().len() < maxRemoteLocalityPeers {
+		return distantNodeID
+	}
+	localID := g.NodeID.Get()
+	nodeID, hops := g.mu.is.mostDistantFiltered(func(id roachpb.NodeID) bool {
+		return id != localID && !g.hasOutgoingLocked(id) && !g.isRemoteLocked(id)
+	})
+	if hops > g.mu.limits.MaxHops {
+		return nodeID
+	}
+	return distantNodeID
+}
+
+// localityCullCandidatesLocked returns the outgoing connections from which
+// the least useful one is culled. When there are more connections to remote
+// localities than maxRemoteLocalityPeers, only those are candidates, so that
+// intra-locality fan-out is kept at the expense of redundant inter-locality
+// links. The mutex must be held by the caller.
+func (g *Gossip) localityCullCandidatesLocked() nodeSet {
+	if remote := g.remoteOutgoingLocked(); remote.len() > maxRemoteLocalityPeers {
+		return remote
+	}
+	return g.outgoing
+}
@@ -0,0 +1,137 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package gossip
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/rpc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/metric"
+	"github.com/cockroachdb/cockroach/pkg/util/stop"
+)
+
+func TestSameLocality(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	testCases := []struct {
+		a, b     string
+		expected bool
+	}{
+		{"", "", true},
+		{"", "region=us", true},
+		{"region=us", "region=us", true},
+		{"region=us", "region=eu", false},
+		{"region=us,dc=a", "region=us", true},
+		{"region=us,dc=a", "region=us,dc=a", true},
+		{"region=us,dc=a", "region=us,dc=b", false},
+		{"region=us,dc=a", "region=eu,dc=a", false},
+	}
+	for _, tc := range testCases {
+		var a, b roachpb.Locality
+		if tc.a != "" {
+			if err := a.Set(tc.a); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if tc.b != "" {
+			if err := b.Set(tc.b); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if same := sameLocality(a, b); same != tc.expected {
+			t.Errorf("sameLocality(%q, %q) = %t; expected %t", tc.a, tc.b, same, tc.expected)
+		}
+		if same := sameLocality(b, a); same != tc.expected {
+			t.Errorf("sameLocality(%q, %q) = %t; expected %t", tc.b, tc.a, same, tc.expected)
+		}
+	}
+}
+
+// TestGossipLocalityHeuristics verifies that tightening prefers nodes in
+// the local locality once there is a connection to a remote locality, and
+// that culling targets redundant connections to remote localities.
+func TestGossipLocalityHeuristics(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+	rpcContext := newInsecureRPCContext(stopper)
+	g := NewTest(1, rpcContext, rpc.NewServer(rpcContext), nil, stopper, metric.NewRegistry())
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// Nodes 1-3 are in dc=a, nodes 4-6 in dc=b.
+	for i := 1; i <= 6; i++ {
+		desc := &roachpb.NodeDescriptor{NodeID: roachpb.NodeID(i)}
+		dc := "a"
+		if i > 3 {
+			dc = "b"
+		}
+		if err := desc.Locality.Set("dc=" + dc); err != nil {
+			t.Fatal(err)
+		}
+		g.nodeDescs[desc.NodeID] = desc
+	}
+	// Each node's info is one hop further than the previous node's.
+	for i := 2; i <= 6; i++ {
+		inf := g.mu.is.newInfo(nil, time.Second)
+		inf.NodeID = roachpb.NodeID(i)
+		inf.PeerID = roachpb.NodeID(i)
+		inf.Hops = uint32(MaxHops + i)
+		if err := g.mu.is.addInfo(fmt.Sprintf("b.%d", i), inf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g.outgoing.setMaxSize(3)
+
+	// Without remote connections, the remote distant node is connected to.
+	if id := g.localityTightenTargetLocked(6); id != 6 {
+		t.Errorf("expected tightening towards node 6, got %d", id)
+	}
+	// Local distant nodes are always connected to.
+	g.outgoing.addNode(4)
+	if id := g.localityTightenTargetLocked(2); id != 2 {
+		t.Errorf("expected tightening towards node 2, got %d", id)
+	}
+	// With a remote connection, the most distant local node is preferred.
+	if id := g.localityTightenTargetLocked(6); id != 3 {
+		t.Errorf("expected tightening towards node 3, got %d", id)
+	}
+	g.outgoing.addNode(3)
+	if id := g.localityTightenTargetLocked(6); id != 2 {
+		t.Errorf("expected tightening towards node 2, got %d", id)
+	}
+	// Without local candidates, the remote distant node is connected to.
+	g.outgoing.addNode(2)
+	if id := g.localityTightenTargetLocked(6); id != 6 {
+		t.Errorf("expected tightening towards node 6, got %d", id)
+	}
+
+	// With a single remote connection, all connections are cull candidates.
+	if c := g.localityCullCandidatesLocked(); c.len() != 3 {
+		t.Errorf("expected 3 cull candidates, got %v", c.asSlice())
+	}
+	// With redundant remote connections, only those are cull candidates.
+	g.outgoing.removeNode(2)
+	g.outgoing.addNode(5)
+	c := g.localityCullCandidatesLocked()
+	if c.len() != 2 || !c.hasNode(4) || !c.hasNode(5) {
+		t.Errorf("expected cull candidates [4 5], got %v", c.asSlice())
+	}
+}
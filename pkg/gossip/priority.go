@@ -0,0 +1,128 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package gossip
+
+import (
+	"sort"
+
+	"github.com/cockroachdb/cockroach/pkg/util/envutil"
+)
+
+// Priority is the propagation priority of a gossip info. When a delta is
+// split into several messages, infos are sent in order of priority.
+type Priority int
+
+const (
+	// PriorityCritical infos are sent first. It is meant for small state
+	// whose propagation delay affects the whole cluster, such as the system
+	// config and node liveness.
+	PriorityCritical Priority = iota
+	// PriorityNormal is the priority of infos without a specific class.
+	PriorityNormal
+	// PriorityBulk infos are sent last. It is meant for numerous or large
+	// infos which are regossiped frequently, such as store descriptors.
+	PriorityBulk
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityCritical:
+		return "critical"
+	case PriorityNormal:
+		return "normal"
+	case PriorityBulk:
+		return "bulk"
+	}
+	return "unknown"
+}
+
+// keyPriorities maps key prefixes (see KeyPrefix) to their priority. Keys
+// whose prefix is not listed have PriorityNormal.
+var keyPriorities = map[string]Priority{
+	KeyClusterID:            PriorityCritical,
+	KeySentinel:             PriorityCritical,
+	KeyFirstRangeDescriptor: PriorityCritical,
+	KeySystemConfig:         PriorityCritical,
+	KeySystemConfigDelta:    PriorityCritical,
+	KeyNodeLivenessPrefix:   PriorityCritical,
+	KeyStorePrefix:          PriorityBulk,
+	KeyDeadReplicasPrefix:   PriorityBulk,
+}
+
+// KeyPriority returns the propagation priority of the specified key.
+func KeyPriority(key string) Priority {
+	if p, ok := keyPriorities[KeyPrefix(key)]; ok {
+		return p
+	}
+	return PriorityNormal
+}
+
+// maxDeltaBytes is the target size of the infos sent in a single gossip
+// message. Deltas exceeding it are split into several messages, sent in
+// order of priority. It is kept well below the gRPC message size limit.
+var maxDeltaBytes = int(envutil.EnvOrDefaultBytes("COCKROACH_GOSSIP_MAX_DELTA_BYTES", 1<<20))
+
+// splitDelta splits a delta into batches whose infos total at most
+// maxBytes, ordered such that infos of higher priority are in earlier
+// batches. Every info in the delta is included: an info which exceeds
+// maxBytes on its own is sent in a batch of its own, and its key returned
+// so that the caller can report it. Dropping it instead would not prevent
+// the peer's high water stamp of its originating node from advancing past
+// it on receipt of the node's other infos, so it would never be resent.
+//
+// Note that once a batch is received, the peer's high water stamp of each
+// originating node may exceed the stamps of infos in later batches. If the
+// connection fails before those batches are sent, the peer will only learn
+// of the infos from other peers or once they are regossiped, which is why
+// bulk priority is meant for frequently regossiped infos.
+func splitDelta(
+	delta map[string]*Info, maxBytes int,
+) (batches []map[string]*Info, oversized []string) {
+	keys := make([]string, 0, len(delta))
+	for key := range delta {
+		keys = append(keys, key)
+	}
+	sort.Sort(keysByPriority(keys))
+
+	var batch map[string]*Info
+	var batchBytes int
+	for _, key := range keys {
+		size := len(key) + delta[key].Size()
+		if size > maxBytes {
+			oversized = append(oversized, key)
+		}
+		if batch == nil || (len(batch) > 0 && batchBytes+size > maxBytes) {
+			batch = map[string]*Info{}
+			batchBytes = 0
+			batches = append(batches, batch)
+		}
+		batch[key] = delta[key]
+		batchBytes += size
+	}
+	return batches, oversized
+}
+
+// keysByPriority sorts keys by priority, and keys of equal priority
+// lexicographically.
+type keysByPriority []string
+
+func (k keysByPriority) Len() int      { return len(k) }
+func (k keysByPriority) Swap(i, j int) { k[i], k[j] = k[j], k[i] }
+func (k keysByPriority) Less(i, j int) bool {
+	if pi, pj := KeyPriority(k[i]), KeyPriority(k[j]); pi != pj {
+		return pi < pj
+	}
+	return k[i] < k[j]
+}
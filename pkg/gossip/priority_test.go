@@ -0,0 +1,100 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package gossip
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+)
+
+func TestKeyPriority(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	testCases := []struct {
+		key      string
+		expected Priority
+	}{
+		{KeySystemConfig, PriorityCritical},
+		{KeySentinel, PriorityCritical},
+		{MakeNodeLivenessKey(1), PriorityCritical},
+		{MakeNodeIDKey(1), PriorityNormal},
+		{"unknown", PriorityNormal},
+		{MakeStoreKey(1), PriorityBulk},
+		{MakeDeadReplicasKey(1), PriorityBulk},
+	}
+	for _, tc := range testCases {
+		if p := KeyPriority(tc.key); p != tc.expected {
+			t.Errorf("%s: expected priority %s, got %s", tc.key, tc.expected, p)
+		}
+	}
+}
+
+// TestSplitDelta verifies that deltas are split into batches ordered by
+// priority, and that oversized infos are sent in batches of their own
+// rather than dropped.
+func TestSplitDelta(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	is, stopper := newTestInfoStore()
+	defer stopper.Stop()
+
+	// Two small infos fit into a batch, but not three.
+	small := bytes.Repeat([]byte("x"), 50)
+	smallSize := len(MakeStoreKey(1)) + is.newInfo(small, time.Second).Size()
+	maxBytes := 2*smallSize + smallSize/2
+	large := bytes.Repeat([]byte("x"), maxBytes)
+	delta := map[string]*Info{
+		MakeStoreKey(1):        is.newInfo(small, time.Second),
+		MakeStoreKey(2):        is.newInfo(small, time.Second),
+		MakeStoreKey(3):        is.newInfo(large, time.Second),
+		MakeNodeIDKey(1):       is.newInfo(small, time.Second),
+		MakeNodeLivenessKey(1): is.newInfo(small, time.Second),
+		KeySystemConfig:        is.newInfo(large, time.Second),
+	}
+
+	batches, oversized := splitDelta(delta, maxBytes)
+	if expected := []string{KeySystemConfig, MakeStoreKey(3)}; !reflect.DeepEqual(oversized, expected) {
+		t.Errorf("expected oversized keys %v, got %v", expected, oversized)
+	}
+
+	var keys [][]string
+	for _, batch := range batches {
+		var batchKeys []string
+		var size int
+		for key, i := range batch {
+			batchKeys = append(batchKeys, key)
+			size += len(key) + i.Size()
+		}
+		if len(batch) > 1 && size > maxBytes {
+			t.Errorf("batch %v exceeds %d bytes", batchKeys, maxBytes)
+		}
+		sort.Strings(batchKeys)
+		keys = append(keys, batchKeys)
+	}
+	expected := [][]string{
+		{MakeNodeLivenessKey(1)},
+		{KeySystemConfig},
+		{MakeNodeIDKey(1), MakeStoreKey(1)},
+		{MakeStoreKey(2)},
+		{MakeStoreKey(3)},
+	}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected batches %v, got %v", expected, keys)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package resolver
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cockroachdb/cockroach/pkg/util"
+	"github.com/cockroachdb/cockroach/pkg/util/envutil"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+)
+
+// refreshInterval is the interval after which DNS-based resolvers look up
+// their name again, picking up changes to the set of nodes behind it.
+var refreshInterval = envutil.EnvOrDefaultDuration("COCKROACH_RESOLVER_REFRESH_INTERVAL",
+	1*time.Minute)
+
+// Lookup functions, overridable for testing.
+var (
+	lookupSRV  = net.LookupSRV
+	lookupHost = net.LookupHost
+)
+
+// dnsResolver is a resolver whose name stands for a set of node addresses
+// obtained via DNS. Each call to GetAddress returns the next address in the
+// set, so that successive bootstrap attempts are spread over all the nodes.
+// The set is looked up again every refreshInterval.
+type dnsResolver struct {
+	typ    string
+	addr   string
+	lookup func() ([]string, error)
+
+	addrs      []string  // Addresses from the most recent successful lookup
+	idx        int       // Index of the next address to return
+	resolvedAt time.Time // Time of the most recent successful lookup
+}
+
+// newSRVResolver returns a resolver for the addresses named by the DNS SRV
+// records for name, e.g. "_cockroach._tcp.example.com".
+func newSRVResolver(name string) *dnsResolver {
+	return &dnsResolver{
+		typ:  "srv",
+		addr: name,
+		lookup: func() ([]string, error) {
+			// With an empty service and protocol, name is looked up directly.
+			_, srvs, err := lookupSRV("", "", name)
+			if err != nil {
+				return nil, err
+			}
+			// The records are ordered by priority and randomized by weight.
+			addrs := make([]string, 0, len(srvs))
+			for _, srv := range srvs {
+				host := strings.TrimSuffix(srv.Target, ".")
+				addrs = append(addrs, net.JoinHostPort(host, strconv.Itoa(int(srv.Port))))
+			}
+			return addrs, nil
+		},
+	}
+}
+
+// newLBResolver returns a resolver for a host:port address whose host name
+// resolves to the addresses of multiple nodes, as is typical of DNS-based
+// load balancers. Each address resolved for the host is combined with the
+// port.
+func newLBResolver(address string) (*dnsResolver, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	return &dnsResolver{
+		typ:  "lb",
+		addr: address,
+		lookup: func() ([]string, error) {
+			hosts, err := lookupHost(host)
+			if err != nil {
+				return nil, err
+			}
+			addrs := make([]string, 0, len(hosts))
+			for _, h := range hosts {
+				addrs = append(addrs, net.JoinHostPort(h, port))
+			}
+			return addrs, nil
+		},
+	}, nil
+}
+
+// Type returns the resolver type.
+func (dr *dnsResolver) Type() string { return dr.typ }
+
+// Addr returns the resolver address.
+func (dr *dnsResolver) Addr() string { return dr.addr }
+
+// GetAddress returns the next address for the resolver's name, looking the
+// name up again if the addresses are stale. If the lookup fails, the
+// addresses from the previous lookup continue to be used.
+func (dr *dnsResolver) GetAddress() (net.Addr, error) {
+	if len(dr.addrs) == 0 || timeutil.Since(dr.resolvedAt) >= refreshInterval {
+		addrs, err := dr.lookup()
+		if err == nil && len(addrs) == 0 {
+			err = errors.Errorf("no addresses found for %s", dr.addr)
+		}
+		if err != nil {
+			if len(dr.addrs) == 0 {
+				return nil, err
+			}
+		} else {
+			dr.addrs = addrs
+			dr.idx = 0
+			dr.resolvedAt = timeutil.Now()
+		}
+	}
+	addr := dr.addrs[dr.idx%len(dr.addrs)]
+	dr.idx++
+	return util.NewUnresolvedAddr("tcp", addr), nil
+}
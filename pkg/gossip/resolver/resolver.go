@@ -19,6 +19,7 @@ package resolver
 import (
 	"net"
 	"os"
+	"strings"
 
 	"github.com/pkg/errors"
 
@@ -34,15 +35,34 @@ type Resolver interface {
 	GetAddress() (net.Addr, error)
 }
 
-// NewResolver takes an address and returns a new resolver.
+// NewResolver takes an address of the form [type=]<address> and returns a
+// new resolver. The type is one of:
+//
+//   - tcp (the default): a host:port address.
+//   - srv: a DNS name whose SRV records list the addresses of nodes.
+//   - lb: a host:port address whose host resolves to the addresses of
+//     multiple nodes, such as a DNS-based load balancer.
 func NewResolver(address string) (Resolver, error) {
+	typ := "tcp"
+	if i := strings.Index(address, "="); i >= 0 {
+		typ, address = address[:i], address[i+1:]
+	}
 	if len(address) == 0 {
 		return nil, errors.Errorf("invalid address value: %q", address)
 	}
 
-	// Ensure addr has port and host set.
-	address = ensureHostPort(address, base.DefaultPort)
-	return &socketResolver{typ: "tcp", addr: address}, nil
+	switch typ {
+	case "tcp":
+		// Ensure addr has port and host set.
+		address = ensureHostPort(address, base.DefaultPort)
+		return &socketResolver{typ: typ, addr: address}, nil
+	case "srv":
+		return newSRVResolver(address), nil
+	case "lb":
+		return newLBResolver(ensureHostPort(address, base.DefaultPort))
+	default:
+		return nil, errors.Errorf("unknown resolver type %q", typ)
+	}
 }
 
 // NewResolverFromAddress takes a net.Addr and constructs a resolver.
@@ -17,9 +17,15 @@
 package resolver
 
 import (
+	"net"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/pkg/errors"
 
 	"github.com/cockroachdb/cockroach/pkg/base"
+	"github.com/cockroachdb/cockroach/pkg/testutils"
 )
 
 func TestParseResolverAddress(t *testing.T) {
@@ -88,3 +94,91 @@ func TestGetAddress(t *testing.T) {
 		}
 	}
 }
+
+func TestDNSResolvers(t *testing.T) {
+	defer func(srv func(string, string, string) (string, []*net.SRV, error),
+		host func(string) ([]string, error), interval time.Duration) {
+		lookupSRV, lookupHost, refreshInterval = srv, host, interval
+	}(lookupSRV, lookupHost, refreshInterval)
+
+	var srvs []*net.SRV
+	var lookupErr error
+	lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
+		if service != "" || proto != "" || name != "_cockroach._tcp.example.com" {
+			t.Fatalf("unexpected SRV lookup of %q %q %q", service, proto, name)
+		}
+		return "", srvs, lookupErr
+	}
+	var hosts []string
+	lookupHost = func(host string) ([]string, error) {
+		if host != "lb.example.com" {
+			t.Fatalf("unexpected lookup of %q", host)
+		}
+		return hosts, lookupErr
+	}
+
+	testCases := []struct {
+		address      string
+		resolverType string
+		set          func(addrs ...string)
+		expected     []string
+	}{
+		{"srv=_cockroach._tcp.example.com", "srv", func(addrs ...string) {
+			srvs = nil
+			for i, addr := range addrs {
+				srvs = append(srvs, &net.SRV{Target: addr + ".", Port: uint16(26257 + i)})
+			}
+		}, []string{"a:26257", "b:26258"}},
+		{"lb=lb.example.com", "lb", func(addrs ...string) {
+			hosts = addrs
+		}, []string{"a:" + base.DefaultPort, "b:" + base.DefaultPort}},
+	}
+
+	for _, tc := range testCases {
+		refreshInterval = time.Hour
+		lookupErr = nil
+		tc.set()
+		resolver, err := NewResolver(tc.address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resolver.Type() != tc.resolverType {
+			t.Errorf("%s: expected type %s, got %s", tc.address, tc.resolverType, resolver.Type())
+		}
+		if _, err := resolver.GetAddress(); !testutils.IsError(err, "no addresses found") {
+			t.Errorf("%s: expected error with no addresses, got %v", tc.address, err)
+		}
+
+		// Addresses are returned round-robin.
+		tc.set("a", "b")
+		for i := 0; i < 4; i++ {
+			addr, err := resolver.GetAddress()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e := tc.expected[i%2]; addr.String() != e {
+				t.Errorf("%s: %d: expected %s, got %s", tc.address, i, e, addr)
+			}
+		}
+
+		// New addresses are not picked up until the refresh interval has
+		// passed, and lookup failures leave the existing addresses in place.
+		tc.set("c")
+		if addr, err := resolver.GetAddress(); err != nil || addr.String() != tc.expected[0] {
+			t.Errorf("%s: expected %s, got %v, %v", tc.address, tc.expected[0], addr, err)
+		}
+		refreshInterval = 0
+		lookupErr = errors.New("lookup failed")
+		if addr, err := resolver.GetAddress(); err != nil || addr.String() != tc.expected[1] {
+			t.Errorf("%s: expected %s, got %v, %v", tc.address, tc.expected[1], addr, err)
+		}
+		lookupErr = nil
+		if addr, err := resolver.GetAddress(); err != nil || !strings.HasPrefix(addr.String(), "c:") {
+			t.Errorf("%s: expected re-resolved address c, got %v, %v", tc.address, addr, err)
+		}
+	}
+
+	if _, err := NewResolver("foo=localhost:26257"); !testutils.IsError(err, "unknown resolver type") {
+		t.Errorf("expected unknown resolver type error, got %v", err)
+	}
+}
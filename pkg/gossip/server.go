@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"math/rand"
 	"net"
+	"sort"
 	"sync"
 	"time"
 
@@ -35,6 +36,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/util/stop"
 	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
 	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	"github.com/cockroachdb/cockroach/pkg/util/uuid"
 )
 
 type serverInfo struct {
@@ -56,6 +58,11 @@ type server struct {
 		is       *infoStore                         // The backing infostore
 		incoming nodeSet                            // Incoming client node IDs
 		nodeMap  map[util.UnresolvedAddr]serverInfo // Incoming client's local address -> serverInfo
+		limits   Limits                             // Shape of the gossip network
+		rng      *rand.Rand                         // Jitters intervals and picks forwarding peers
+		// clusterID is the ID of this node's cluster, verified against the
+		// cluster IDs of peers in the handshake. Empty until known.
+		clusterID uuid.UUID
 		// ready broadcasts a wakeup to waiting gossip requests. This is done
 		// via closing the current ready channel and opening a new one. This
 		// is required due to the fact that condition variables are not
@@ -88,12 +95,15 @@ func newServer(
 	}
 
 	s.mu.is = newInfoStore(s.AmbientContext, nodeID, util.UnresolvedAddr{}, stopper)
+	s.mu.limits = DefaultLimits()
 	s.mu.incoming = makeNodeSet(minPeers, metric.NewGauge(MetaConnectionsIncomingGauge))
 	s.mu.nodeMap = make(map[util.UnresolvedAddr]serverInfo)
 	s.mu.ready = make(chan struct{})
+	s.mu.rng = rand.New(rand.NewSource(rand.Int63()))
 
 	registry.AddMetric(s.mu.incoming.gauge)
 	registry.AddMetricStruct(s.nodeMetrics)
+	registry.AddMetricStruct(s.mu.is.metrics)
 
 	return s
 }
@@ -135,6 +145,16 @@ func (s *server) Gossip(stream Gossip_GossipServer) error {
 
 	defer func() { syncChan <- struct{}{} }()
 
+	// Verify that the client belongs to this node's cluster before any
+	// infos are exchanged.
+	s.mu.Lock()
+	err = s.verifyHandshakeLocked(args.NodeID, args.ClusterID, args.ProtocolVersion)
+	s.mu.Unlock()
+	if err != nil {
+		log.Warningf(ctx, "refusing gossip from %s: %s", args.Addr, err)
+		return toGRPCError(err)
+	}
+
 	// Verify that there aren't multiple incoming connections from the same
 	// node. This can happen when bootstrap connections are initiated through
 	// a load balancer.
@@ -172,15 +192,26 @@ func (s *server) Gossip(stream Gossip_GossipServer) error {
 					infoCount, args.NodeID, extractKeys(delta))
 			}
 
-			*reply = Response{
-				NodeID:          s.NodeID.Get(),
-				HighWaterStamps: s.mu.is.getHighWaterStamps(),
-				Delta:           delta,
+			batches, oversized := splitDelta(compressDelta(delta, args.ProtocolVersion), maxDeltaBytes)
+			if len(oversized) > 0 {
+				log.Warningf(ctx, "returning infos exceeding %d bytes to node %d individually: %s",
+					maxDeltaBytes, args.NodeID, oversized)
 			}
+			highWaterStamps := s.mu.is.getHighWaterStamps()
+			clusterID := s.mu.clusterID
 
 			s.mu.Unlock()
-			if err := send(reply); err != nil {
-				return err
+			for _, batch := range batches {
+				*reply = Response{
+					NodeID:          s.NodeID.Get(),
+					HighWaterStamps: highWaterStamps,
+					Delta:           batch,
+					ClusterID:       clusterID,
+					ProtocolVersion: gossipProtocolVersion,
+				}
+				if err := send(reply); err != nil {
+					return err
+				}
 			}
 			s.mu.Lock()
 		}
@@ -248,16 +279,15 @@ func (s *server) gossipReceiver(
 			} else {
 				var alternateAddr util.UnresolvedAddr
 				var alternateNodeID roachpb.NodeID
-				// Choose a random peer for forwarding.
-				altIdx := rand.Intn(len(s.mu.nodeMap))
-				for addr, info := range s.mu.nodeMap {
-					if altIdx == 0 {
-						alternateAddr = addr
-						alternateNodeID = info.peerID
-						break
-					}
-					altIdx--
+				// Choose a random peer for forwarding. The addresses are sorted so
+				// that the choice only depends on the random numbers.
+				addrs := make(unresolvedAddrs, 0, len(s.mu.nodeMap))
+				for addr := range s.mu.nodeMap {
+					addrs = append(addrs, addr)
 				}
+				sort.Sort(addrs)
+				alternateAddr = addrs[s.mu.rng.Intn(len(addrs))]
+				alternateNodeID = s.mu.nodeMap[alternateAddr].peerID
 
 				log.Infof(ctx, "refusing gossip from node %d (max %d conns); forwarding to %d (%s)",
 					args.NodeID, s.mu.incoming.maxSize, alternateNodeID, alternateAddr)
@@ -266,6 +296,8 @@ func (s *server) gossipReceiver(
 					NodeID:          s.NodeID.Get(),
 					AlternateAddr:   &alternateAddr,
 					AlternateNodeID: alternateNodeID,
+					ClusterID:       s.mu.clusterID,
+					ProtocolVersion: gossipProtocolVersion,
 				}
 
 				s.mu.Unlock()
@@ -304,6 +336,8 @@ func (s *server) gossipReceiver(
 		*reply = Response{
 			NodeID:          s.NodeID.Get(),
 			HighWaterStamps: s.mu.is.getHighWaterStamps(),
+			ClusterID:       s.mu.clusterID,
+			ProtocolVersion: gossipProtocolVersion,
 		}
 
 		s.mu.Unlock()
@@ -333,20 +367,21 @@ func (s *server) gossipReceiver(
 }
 
 // maybeTightenLocked examines the infostore for the most distant node and
-// if more distant than MaxHops, sends on the tightenNetwork channel
-// to start a new client connection. The mutex must be held by the caller.
+// if more distant than the MaxHops limit, sends on the tightenNetwork
+// channel to start a new client connection. The mutex must be held by the
+// caller.
 func (s *server) maybeTightenLocked() {
 	ctx := s.AnnotateCtx(context.TODO())
 	distantNodeID, distantHops := s.mu.is.mostDistant()
 	if log.V(2) {
 		log.Infof(ctx, "distantHops: %d from %d", distantHops, distantNodeID)
 	}
-	if distantHops > MaxHops {
+	if maxHops := s.mu.limits.MaxHops; distantHops > maxHops {
 		select {
 		case s.tighten <- distantNodeID:
 			if log.V(1) {
 				log.Infof(ctx, "if possible, tightening network to node %d (%d > %d)",
-					distantNodeID, distantHops, MaxHops)
+					distantNodeID, distantHops, maxHops)
 			}
 		default:
 			// Do nothing.
@@ -404,6 +439,18 @@ func (s *server) status() string {
 	return buf.String()
 }
 
+// unresolvedAddrs sorts addresses by their network and address.
+type unresolvedAddrs []util.UnresolvedAddr
+
+func (a unresolvedAddrs) Len() int      { return len(a) }
+func (a unresolvedAddrs) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a unresolvedAddrs) Less(i, j int) bool {
+	if a[i].NetworkField != a[j].NetworkField {
+		return a[i].NetworkField < a[j].NetworkField
+	}
+	return a[i].AddressField < a[j].AddressField
+}
+
 func roundSecs(d time.Duration) time.Duration {
 	return time.Duration(d.Seconds()+0.5) * time.Second
 }
@@ -0,0 +1,152 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package simulation
+
+import (
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/gossip"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+)
+
+// ManualClock is a gossip.Clock whose time only moves forward when
+// Advance is called. Like a time.Ticker, a timer whose channel is full
+// drops ticks rather than blocking the clock.
+type ManualClock struct {
+	mu     syncutil.Mutex
+	now    time.Time
+	seq    int
+	timers []*manualTimer
+}
+
+var _ gossip.Clock = &ManualClock{}
+
+// NewManualClock creates a ManualClock.
+func NewManualClock() *ManualClock {
+	return &ManualClock{now: time.Unix(0, 0)}
+}
+
+// manualTimer is a timer of a ManualClock. One-shot timers have a zero
+// period. seq orders timers which come due at the same time by creation.
+type manualTimer struct {
+	clock  *ManualClock
+	c      chan time.Time
+	next   time.Time
+	period time.Duration
+	seq    int
+}
+
+// Now implements gossip.Clock.
+func (m *ManualClock) Now() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.now
+}
+
+// NewTicker implements gossip.Clock.
+func (m *ManualClock) NewTicker(d time.Duration) gossip.Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	return m.addTimer(d, d)
+}
+
+// After implements gossip.Clock.
+func (m *ManualClock) After(d time.Duration) <-chan time.Time {
+	return m.addTimer(d, 0).c
+}
+
+func (m *ManualClock) addTimer(d, period time.Duration) *manualTimer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.seq++
+	t := &manualTimer{
+		clock:  m,
+		c:      make(chan time.Time, 1),
+		next:   m.now.Add(d),
+		period: period,
+		seq:    m.seq,
+	}
+	m.timers = append(m.timers, t)
+	return t
+}
+
+// Advance moves the clock forward by d. The timers which come due fire one
+// at a time, in the order in which they come due and then in the order in
+// which they were created, with the clock set to the time at which each
+// one comes due. If settle is not nil, it is called after each timer fires
+// and before the next one does, which lets the caller wait for the effects
+// of each timer in turn.
+func (m *ManualClock) Advance(d time.Duration, settle func()) {
+	m.mu.Lock()
+	end := m.now.Add(d)
+	m.mu.Unlock()
+	for m.fireNext(end) {
+		if settle != nil {
+			settle()
+		}
+	}
+}
+
+// fireNext fires the first timer which comes due no later than end and
+// returns true, or moves the clock to end and returns false if there is no
+// such timer.
+func (m *ManualClock) fireNext(end time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var next *manualTimer
+	idx := -1
+	for i, t := range m.timers {
+		if t.next.After(end) {
+			continue
+		}
+		if next == nil || t.next.Before(next.next) || (t.next.Equal(next.next) && t.seq < next.seq) {
+			next, idx = t, i
+		}
+	}
+	if next == nil {
+		m.now = end
+		return false
+	}
+	m.now = next.next
+	select {
+	case next.c <- m.now:
+	default:
+	}
+	if next.period > 0 {
+		next.next = next.next.Add(next.period)
+	} else {
+		m.timers = append(m.timers[:idx], m.timers[idx+1:]...)
+	}
+	return true
+}
+
+// C implements gossip.Ticker.
+func (t *manualTimer) C() <-chan time.Time {
+	return t.c
+}
+
+// Stop implements gossip.Ticker.
+func (t *manualTimer) Stop() {
+	m := t.clock
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, timer := range m.timers {
+		if timer == t {
+			m.timers = append(m.timers[:i], m.timers[i+1:]...)
+			break
+		}
+	}
+}
@@ -0,0 +1,497 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package simulation
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	"github.com/cockroachdb/cockroach/pkg/base"
+	"github.com/cockroachdb/cockroach/pkg/gossip"
+	"github.com/cockroachdb/cockroach/pkg/gossip/resolver"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/rpc"
+	"github.com/cockroachdb/cockroach/pkg/util"
+	"github.com/cockroachdb/cockroach/pkg/util/encoding"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/metric"
+	"github.com/cockroachdb/cockroach/pkg/util/protoutil"
+	"github.com/cockroachdb/cockroach/pkg/util/stop"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+)
+
+// cycleInterval is the amount by which the clock is advanced at each cycle
+// of a DeterministicNetwork simulation.
+const cycleInterval = time.Second
+
+// DeterministicNetwork provides access to a test gossip network whose
+// nodes run the real gossip protocol over an in-memory transport and a
+// manual clock. Messages sent by the nodes are held by the network until
+// the next cycle of the simulation, at which point they are delivered in
+// an order determined by the seed, so each cycle propagates gossip by
+// exactly one hop.
+//
+// The simulation only takes one step at a time: it delivers a message,
+// fires a timer or adds an info, and then waits until every node has
+// finished reacting to it before taking the next. Together with the
+// manual clock, which also timestamps the infos, and the seeded random
+// numbers of the nodes, this makes a simulation with a given seed
+// reproducible regardless of how the goroutines are scheduled.
+type DeterministicNetwork struct {
+	Nodes   []*gossip.Gossip
+	Stopper *stop.Stopper
+	Clock   *ManualClock
+	Seed    int64
+	rng     *rand.Rand
+	addrs   map[string]*gossip.Gossip
+
+	mu struct {
+		syncutil.Mutex
+		// pending holds the messages sent since the last delivery.
+		pending []message
+		// queued is the number of delivered messages which have not yet been
+		// received.
+		queued int
+		// seqs holds the number of messages sent over each link.
+		seqs map[link]int
+	}
+}
+
+// NewDeterministicNetwork creates and starts nodeCount gossip nodes, all
+// of which bootstrap off the first node.
+func NewDeterministicNetwork(
+	stopper *stop.Stopper, nodeCount int, seed int64,
+) *DeterministicNetwork {
+	log.Infof(context.TODO(), "simulating deterministic gossip network with %d nodes (seed %d)",
+		nodeCount, seed)
+
+	n := &DeterministicNetwork{
+		Stopper: stopper,
+		Clock:   NewManualClock(),
+		Seed:    seed,
+		rng:     rand.New(rand.NewSource(seed)),
+		addrs:   map[string]*gossip.Gossip{},
+	}
+	n.mu.seqs = map[link]int{}
+	rpcContext := rpc.NewContext(
+		log.AmbientContext{},
+		&base.Config{Insecure: true},
+		hlc.NewClock(hlc.UnixNano, time.Nanosecond),
+		stopper,
+	)
+	addrs := make([]net.Addr, nodeCount)
+	for i := range addrs {
+		// Nothing listens on these addresses; they only need to resolve.
+		addrs[i] = util.NewUnresolvedAddr("tcp", fmt.Sprintf("127.0.0.1:%d", 26257+i))
+	}
+	for i := 0; i < nodeCount; i++ {
+		nodeID := roachpb.NodeID(i + 1)
+		// Build a resolver for each instance or we'll get data races.
+		r, err := resolver.NewResolverFromAddress(addrs[0])
+		if err != nil {
+			log.Fatalf(context.TODO(), "bad gossip address %s: %s", addrs[0], err)
+		}
+		g := gossip.NewTest(nodeID, rpcContext, rpc.NewServer(rpcContext),
+			[]resolver.Resolver{r}, stopper, metric.NewRegistry())
+		g.SetClock(n.Clock)
+		g.SetRandSeed(seed + int64(i))
+		g.SetStreamDialer(n.dial)
+		n.addrs[addrs[i].String()] = g
+		n.Nodes = append(n.Nodes, g)
+	}
+	for i, g := range n.Nodes {
+		g.Start(addrs[i])
+		if err := g.SetNodeDescriptor(&roachpb.NodeDescriptor{
+			NodeID:  g.NodeID.Get(),
+			Address: util.MakeUnresolvedAddr(addrs[i].Network(), addrs[i].String()),
+		}); err != nil {
+			log.Fatal(context.TODO(), err)
+		}
+		n.settle()
+	}
+	return n
+}
+
+// nodeKey returns the key gossiped by the node at index i at every cycle.
+func nodeKey(i int) string {
+	return fmt.Sprintf("sim-node-%d", i+1)
+}
+
+// SimulateNetwork runs until the simCallback returns false.
+//
+// At each cycle, node 0 gossips the sentinel and every node gossips a key
+// unique to it with the cycle as the value. The clock is then advanced,
+// and the messages sent since the previous cycle are delivered.
+//
+// The simulation callback receives the cycle and the network as arguments.
+func (n *DeterministicNetwork) SimulateNetwork(
+	simCallback func(cycle int, network *DeterministicNetwork) bool,
+) {
+	for cycle := 1; ; cycle++ {
+		if err := n.Nodes[0].AddInfo(
+			gossip.KeySentinel,
+			encoding.EncodeUint64Ascending(nil, uint64(cycle)),
+			time.Hour,
+		); err != nil {
+			log.Fatal(context.TODO(), err)
+		}
+		n.settle()
+		for i, g := range n.Nodes {
+			if err := g.AddInfo(
+				nodeKey(i),
+				encoding.EncodeUint64Ascending(nil, uint64(cycle)),
+				time.Hour,
+			); err != nil {
+				log.Fatal(context.TODO(), err)
+			}
+			n.settle()
+		}
+		n.Clock.Advance(cycleInterval, n.settle)
+		n.deliver()
+		if !simCallback(cycle, n) {
+			break
+		}
+	}
+}
+
+// RunUntilFullyConnected runs the simulation until every node has
+// received gossip from every other node in the network. It returns the
+// gossip cycle at which the network became fully connected.
+func (n *DeterministicNetwork) RunUntilFullyConnected() int {
+	var connectedAtCycle int
+	n.SimulateNetwork(func(cycle int, network *DeterministicNetwork) bool {
+		if network.isNetworkConnected() {
+			connectedAtCycle = cycle
+			return false
+		}
+		return true
+	})
+	return connectedAtCycle
+}
+
+// isNetworkConnected returns true if every node knows every other node's
+// descriptor.
+func (n *DeterministicNetwork) isNetworkConnected() bool {
+	for _, left := range n.Nodes {
+		for _, right := range n.Nodes {
+			if _, err := left.GetInfo(gossip.MakeNodeIDKey(right.NodeID.Get())); err != nil {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// settle waits until the nodes have finished reacting to the last step of
+// the simulation: every delivered message has been received and every
+// goroutine other than the simulation's own is blocked. At that point
+// nothing but the simulation can make progress, so the messages the nodes
+// have sent do not depend on how their goroutines were scheduled.
+func (n *DeterministicNetwork) settle() {
+	for {
+		n.mu.Lock()
+		queued := n.mu.queued
+		n.mu.Unlock()
+		if queued == 0 && othersBlocked() {
+			return
+		}
+		runtime.Gosched()
+	}
+}
+
+// othersBlocked returns whether every goroutine other than the calling one
+// is blocked, for example on a channel, a select or a mutex. The states of
+// the goroutines are taken from a single consistent snapshot.
+func othersBlocked() bool {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	// The calling goroutine is listed first. The trace of each goroutine
+	// starts with a header such as "goroutine 7 [chan receive, 2 minutes]:".
+	for i, trace := range bytes.Split(buf, []byte("\n\n")) {
+		if i == 0 {
+			continue
+		}
+		start := bytes.IndexByte(trace, '[')
+		if start < 0 {
+			continue
+		}
+		state := trace[start+1:]
+		if end := bytes.IndexAny(state, ",]"); end >= 0 {
+			state = state[:end]
+		}
+		switch string(state) {
+		case "running", "runnable", "syscall":
+			return false
+		}
+	}
+	return true
+}
+
+// deliver hands the messages sent since the last delivery to their
+// receivers one at a time, waiting for each to be processed before
+// delivering the next. The messages are sorted by link and sequence before
+// they are shuffled using the seed, so that their order does not depend on
+// the order in which they were sent.
+func (n *DeterministicNetwork) deliver() {
+	n.mu.Lock()
+	pending := n.mu.pending
+	n.mu.pending = nil
+	n.mu.Unlock()
+	sort.Sort(messagesByLink(pending))
+	for _, i := range n.rng.Perm(len(pending)) {
+		m := pending[i]
+		n.mu.Lock()
+		select {
+		case <-m.conn.done:
+			n.mu.Unlock()
+			continue
+		default:
+		}
+		m.to.queue = append(m.to.queue, m.data)
+		n.mu.queued++
+		select {
+		case m.to.notify <- struct{}{}:
+		default:
+		}
+		n.mu.Unlock()
+		n.settle()
+	}
+}
+
+// dial is the gossip.StreamDialer used by the nodes of the network. It
+// connects a client stream to a server stream which is served by the
+// gossip node at addr.
+func (n *DeterministicNetwork) dial(
+	ctx context.Context, addr net.Addr,
+) (gossip.Gossip_GossipClient, error) {
+	server, ok := n.addrs[addr.String()]
+	if !ok {
+		return nil, errors.Errorf("no gossip node at %s", addr)
+	}
+	c := &conn{
+		network:  n,
+		server:   server.NodeID.Get(),
+		done:     make(chan struct{}),
+		toServer: endpoint{notify: make(chan struct{}, 1)},
+		toClient: endpoint{notify: make(chan struct{}, 1)},
+	}
+	serverCtx, cancel := context.WithCancel(context.Background())
+	if err := n.Stopper.RunTask(func() {
+		n.Stopper.RunWorker(func() {
+			defer c.close()
+			if err := server.Gossip(&serverStream{ctx: serverCtx, conn: c}); err != nil {
+				log.Infof(serverCtx, "gossip stream from node at %s closed: %s", addr, err)
+			}
+		})
+		n.Stopper.RunWorker(func() {
+			select {
+			case <-ctx.Done():
+			case <-c.done:
+			case <-n.Stopper.ShouldStop():
+			}
+			c.close()
+			cancel()
+		})
+	}); err != nil {
+		cancel()
+		return nil, err
+	}
+	return &clientStream{ctx: ctx, conn: c}, nil
+}
+
+// A link identifies the messages sent from one node to another, either as
+// requests of a gossip client or as responses of a gossip server.
+type link struct {
+	from, to roachpb.NodeID
+	response bool
+}
+
+// A message is a gossip request or response in flight to an endpoint. seq
+// is the number of messages sent over the link before it, plus one.
+type message struct {
+	conn *conn
+	to   *endpoint
+	link link
+	seq  int
+	data []byte
+}
+
+// messagesByLink sorts messages by link and then by sequence.
+type messagesByLink []message
+
+func (m messagesByLink) Len() int      { return len(m) }
+func (m messagesByLink) Swap(i, j int) { m[i], m[j] = m[j], m[i] }
+func (m messagesByLink) Less(i, j int) bool {
+	a, b := m[i].link, m[j].link
+	switch {
+	case a.from != b.from:
+		return a.from < b.from
+	case a.to != b.to:
+		return a.to < b.to
+	case a.response != b.response:
+		return !a.response
+	}
+	return m[i].seq < m[j].seq
+}
+
+// An endpoint is the receiving end of one direction of a conn. Its queue
+// is protected by the network's mutex.
+type endpoint struct {
+	queue  [][]byte
+	notify chan struct{}
+}
+
+// A conn is an in-memory connection between a gossip client and server.
+// client is learned from the client's requests and is protected by the
+// network's mutex.
+type conn struct {
+	network            *DeterministicNetwork
+	server, client     roachpb.NodeID
+	done               chan struct{}
+	closeOnce          sync.Once
+	toServer, toClient endpoint
+}
+
+// close closes the connection, dropping any messages which were delivered
+// but not yet received.
+func (c *conn) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		n := c.network
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		n.mu.queued -= len(c.toServer.queue) + len(c.toClient.queue)
+		c.toServer.queue, c.toClient.queue = nil, nil
+	})
+}
+
+// send marshals msg, as gRPC would, and queues it for delivery to the
+// specified endpoint at the next cycle.
+func (c *conn) send(to *endpoint, msg proto.Message) error {
+	select {
+	case <-c.done:
+		return io.EOF
+	default:
+	}
+	data, err := protoutil.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	n := c.network
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	l := link{from: c.server, to: c.client, response: true}
+	if args, ok := msg.(*gossip.Request); ok {
+		c.client = args.NodeID
+		l = link{from: c.client, to: c.server}
+	}
+	n.mu.seqs[l]++
+	n.mu.pending = append(n.mu.pending, message{
+		conn: c, to: to, link: l, seq: n.mu.seqs[l], data: data,
+	})
+	return nil
+}
+
+// recv blocks until a message is delivered to the specified endpoint, the
+// connection is closed or ctx is canceled.
+func (c *conn) recv(ctx context.Context, from *endpoint, msg proto.Message) error {
+	n := c.network
+	for {
+		n.mu.Lock()
+		if len(from.queue) > 0 {
+			data := from.queue[0]
+			from.queue = from.queue[1:]
+			n.mu.queued--
+			n.mu.Unlock()
+			return proto.Unmarshal(data, msg)
+		}
+		n.mu.Unlock()
+		select {
+		case <-from.notify:
+		case <-c.done:
+			return io.EOF
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// clientStream implements gossip.Gossip_GossipClient over a conn. The
+// embedded grpc.ClientStream is nil; gossip only uses the methods below.
+type clientStream struct {
+	grpc.ClientStream
+	ctx  context.Context
+	conn *conn
+}
+
+func (s *clientStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *clientStream) Send(args *gossip.Request) error {
+	return s.conn.send(&s.conn.toServer, args)
+}
+
+func (s *clientStream) Recv() (*gossip.Response, error) {
+	reply := &gossip.Response{}
+	if err := s.conn.recv(s.ctx, &s.conn.toClient, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// serverStream implements gossip.Gossip_GossipServer over a conn. The
+// embedded grpc.ServerStream is nil; gossip only uses the methods below.
+type serverStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	conn *conn
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *serverStream) Send(reply *gossip.Response) error {
+	return s.conn.send(&s.conn.toClient, reply)
+}
+
+func (s *serverStream) Recv() (*gossip.Request, error) {
+	args := &gossip.Request{}
+	if err := s.conn.recv(s.ctx, &s.conn.toServer, args); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
@@ -33,6 +33,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/util/protoutil"
 	"github.com/cockroachdb/cockroach/pkg/util/stop"
 	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 )
 
 type testStorage struct {
@@ -265,3 +266,63 @@ func TestGossipStorageCleanup(t *testing.T) {
 		return nil
 	})
 }
+
+// TestGossipStoragePruneStale verifies that bootstrap addresses which have
+// not been seen in gossip for longer than BootstrapAddressStaleness are
+// pruned when the bootstrap info is read, unless no other addresses remain.
+func TestGossipStoragePruneStale(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+
+	network := simulation.NewNetwork(stopper, 2, false)
+
+	now := timeutil.Now().UnixNano()
+	stale := now - 2*int64(gossip.BootstrapAddressStaleness)
+	freshAddr := util.MakeUnresolvedAddr("tcp", "localhost:1")
+	staleAddr := util.MakeUnresolvedAddr("tcp", "localhost:2")
+	unknownAddr := util.MakeUnresolvedAddr("tcp", "localhost:3")
+
+	// With a fresh address remaining, stale addresses are pruned and the last
+	// seen times of the remaining addresses are preserved. Addresses without
+	// a last seen time are kept.
+	var ts testStorage
+	ts.info = gossip.BootstrapInfo{
+		Addresses: []util.UnresolvedAddr{freshAddr, staleAddr, unknownAddr},
+		LastSeen:  []int64{now, stale},
+	}
+	if err := network.Nodes[0].Gossip.SetStorage(&ts); err != nil {
+		t.Fatal(err)
+	}
+	info := ts.Info()
+	if expected := []util.UnresolvedAddr{freshAddr, unknownAddr}; !reflect.DeepEqual(info.Addresses, expected) {
+		t.Errorf("expected addresses %s, got %s", expected, info.Addresses)
+	}
+	if expected := []int64{now, 0}; !reflect.DeepEqual(info.LastSeen, expected) {
+		t.Errorf("expected last seen %v, got %v", expected, info.LastSeen)
+	}
+
+	// With only stale addresses, nothing is pruned.
+	var ts2 testStorage
+	ts2.info = gossip.BootstrapInfo{
+		Addresses: []util.UnresolvedAddr{staleAddr},
+		LastSeen:  []int64{stale},
+	}
+	if err := network.Nodes[1].Gossip.SetStorage(&ts2); err != nil {
+		t.Fatal(err)
+	}
+	if ts2.isWrite() {
+		t.Errorf("expected no write, got %+v", ts2.Info())
+	}
+	if expected := []string{staleAddr.String()}; !reflect.DeepEqual(resolverAddrs(network.Nodes[1].Gossip), expected) {
+		t.Errorf("expected resolvers %s, got %s", expected, resolverAddrs(network.Nodes[1].Gossip))
+	}
+}
+
+func resolverAddrs(g *gossip.Gossip) []string {
+	var addrs []string
+	for _, r := range g.GetResolvers() {
+		addrs = append(addrs, r.Addr())
+	}
+	return addrs
+}
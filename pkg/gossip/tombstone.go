@@ -0,0 +1,101 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package gossip
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+)
+
+// tombstonePrefixes are the key prefixes of infos which can be removed
+// from the gossip network with a tombstone. A tombstone is an info with an
+// empty value; since it is newer than the info it replaces, it propagates
+// like any other info and overwrites the stale info on every peer. It
+// expires after the long-lived TTL, by which point the stale info has
+// expired everywhere as well.
+var tombstonePrefixes = map[string]struct{}{
+	KeyNodeIDPrefix:       {},
+	KeyStorePrefix:        {},
+	KeyDeadReplicasPrefix: {},
+}
+
+// IsTombstone returns whether the info content received for key marks the
+// removal of the key. Callbacks registered for keys which can be removed
+// must check for tombstones before unmarshalling the content.
+func IsTombstone(key string, content roachpb.Value) bool {
+	if _, ok := tombstonePrefixes[KeyPrefix(key)]; !ok {
+		return false
+	}
+	b, err := content.GetBytes()
+	return err == nil && len(b) == 0
+}
+
+// addTombstoneLocked removes the info at key from the gossip network.
+// Only the keys of node descriptors, store descriptors and dead replicas
+// can be removed. Key prefix TTL overrides do not apply to tombstones,
+// which must outlive the infos they replace. The gossip mutex must be held
+// by the caller.
+func (g *Gossip) addTombstoneLocked(key string) error {
+	if _, ok := tombstonePrefixes[KeyPrefix(key)]; !ok {
+		return errors.Errorf("cannot add tombstone for key %q", key)
+	}
+	ttl, err := g.ttlForClassLocked(TTLLongLived)
+	if err != nil {
+		return err
+	}
+	if err := g.mu.is.addInfo(key, g.mu.is.newInfo(nil, ttl)); err != nil {
+		return err
+	}
+	g.signalConnectedLocked()
+	return nil
+}
+
+// RemoveNode removes the descriptors of the specified node and its stores,
+// along with the stores' dead replicas, from the gossip network.
+func (g *Gossip) RemoveNode(nodeID roachpb.NodeID, storeIDs []roachpb.StoreID) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err := g.addTombstoneLocked(MakeNodeIDKey(nodeID)); err != nil {
+		return errors.Wrapf(err, "failed to remove node %d", nodeID)
+	}
+	for _, storeID := range storeIDs {
+		if err := g.removeStoreLocked(storeID); err != nil {
+			return errors.Wrapf(err, "failed to remove node %d", nodeID)
+		}
+	}
+	return nil
+}
+
+// RemoveStore removes the descriptor of the specified store, along with
+// its dead replicas, from the gossip network. Peers drop the store from
+// their store pools as soon as the removal reaches them, rather than
+// considering it until its descriptor expires.
+func (g *Gossip) RemoveStore(storeID roachpb.StoreID) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.removeStoreLocked(storeID)
+}
+
+// removeStoreLocked is like RemoveStore, but the gossip mutex must be held
+// by the caller.
+func (g *Gossip) removeStoreLocked(storeID roachpb.StoreID) error {
+	for _, key := range []string{MakeStoreKey(storeID), MakeDeadReplicasKey(storeID)} {
+		if err := g.addTombstoneLocked(key); err != nil {
+			return errors.Wrapf(err, "failed to remove store %d", storeID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package gossip
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/rpc"
+	"github.com/cockroachdb/cockroach/pkg/testutils"
+	"github.com/cockroachdb/cockroach/pkg/util"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/metric"
+	"github.com/cockroachdb/cockroach/pkg/util/stop"
+)
+
+// TestGossipRemoveNode verifies that the tombstones added by RemoveNode
+// propagate to peers and remove the stale node and store descriptors.
+func TestGossipRemoveNode(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper := stop.NewStopper()
+	g1 := startGossip(1, stopper, t, metric.NewRegistry())
+	g2 := startGossip(2, stopper, t, metric.NewRegistry())
+	disconnected := make(chan *client, 1)
+	c := newClient(log.AmbientContext{}, g1.GetNodeAddr(), makeMetrics())
+
+	defer func() {
+		stopper.Stop()
+		if c != <-disconnected {
+			t.Errorf("expected client disconnect after remote close")
+		}
+	}()
+
+	// Node 3 and its store were gossiped before being removed.
+	nodeDesc := &roachpb.NodeDescriptor{NodeID: 3}
+	if err := g1.AddInfoProto(MakeNodeIDKey(3), nodeDesc, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	storeDesc := &roachpb.StoreDescriptor{StoreID: 4, Node: *nodeDesc}
+	if err := g1.AddInfoProto(MakeStoreKey(4), storeDesc, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	gossipSucceedsSoon(t, stopper, disconnected, map[*client]*Gossip{
+		c: g2,
+	}, func() error {
+		_, err := g2.GetNodeDescriptor(3)
+		return err
+	})
+
+	if err := g1.RemoveNode(3, []roachpb.StoreID{4}); err != nil {
+		t.Fatal(err)
+	}
+	util.SucceedsSoon(t, func() error {
+		if _, err := g2.GetNodeDescriptor(3); err == nil {
+			return errors.New("node 3 descriptor still present")
+		}
+		return nil
+	})
+	if _, err := g2.GetInfo(MakeStoreKey(4)); !testutils.IsError(err, "has been removed") {
+		t.Errorf("expected store 4 to be removed, got %v", err)
+	}
+
+	g1.mu.Lock()
+	err := g1.addTombstoneLocked(KeySentinel)
+	g1.mu.Unlock()
+	if err == nil {
+		t.Error("expected error adding tombstone for sentinel")
+	}
+}
+
+// TestGossipRemoveStore verifies that RemoveStore removes the store
+// descriptor and dead replicas of a single store, leaving the node's
+// other stores in place.
+func TestGossipRemoveStore(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+	rpcContext := newInsecureRPCContext(stopper)
+	g := NewTest(1, rpcContext, rpc.NewServer(rpcContext), nil, stopper, metric.NewRegistry())
+
+	for _, storeID := range []roachpb.StoreID{4, 5} {
+		storeDesc := &roachpb.StoreDescriptor{StoreID: storeID, Node: roachpb.NodeDescriptor{NodeID: 3}}
+		if err := g.AddInfoProto(MakeStoreKey(storeID), storeDesc, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deadReplicas := &roachpb.StoreDeadReplicas{StoreID: 4}
+	if err := g.AddInfoProto(MakeDeadReplicasKey(4), deadReplicas, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := g.RemoveStore(4); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{MakeStoreKey(4), MakeDeadReplicasKey(4)} {
+		if _, err := g.GetInfo(key); !testutils.IsError(err, "has been removed") {
+			t.Errorf("expected %q to be removed, got %v", key, err)
+		}
+	}
+	if _, err := g.GetInfo(MakeStoreKey(5)); err != nil {
+		t.Errorf("expected store 5 to remain, got %v", err)
+	}
+}
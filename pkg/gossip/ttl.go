@@ -0,0 +1,173 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package gossip
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/pkg/errors"
+
+	"github.com/cockroachdb/cockroach/pkg/util/envutil"
+	"github.com/cockroachdb/cockroach/pkg/util/protoutil"
+)
+
+// TTLClass describes how long an info remains valid after its originator
+// stops regossiping it. Callers which add infos by class rather than with
+// an explicit duration pick up any reconfiguration of the class.
+type TTLClass int
+
+const (
+	// TTLPermanent infos never expire. It is meant for state which is
+	// regossiped whenever it changes, such as the system config.
+	TTLPermanent TTLClass = iota
+	// TTLEphemeral infos expire shortly after their originator stops
+	// regossiping them. It is meant for frequently refreshed state, such as
+	// store descriptors and the load statistics they carry.
+	TTLEphemeral
+	// TTLLongLived infos remain valid long after their originator stops
+	// regossiping them. It is meant for rarely changing state, such as node
+	// descriptors.
+	TTLLongLived
+)
+
+func (c TTLClass) String() string {
+	switch c {
+	case TTLPermanent:
+		return "permanent"
+	case TTLEphemeral:
+		return "ephemeral"
+	case TTLLongLived:
+		return "long-lived"
+	}
+	return "unknown"
+}
+
+const (
+	// ttlEphemeral is the default time-to-live for TTLEphemeral infos.
+	ttlEphemeral = 2 * time.Minute
+
+	// ttlNodeDescriptorGossip is time-to-live for node ID -> descriptor,
+	// and the default time-to-live for TTLLongLived infos.
+	ttlNodeDescriptorGossip = 1 * time.Hour
+)
+
+func defaultTTLClasses() map[TTLClass]time.Duration {
+	return map[TTLClass]time.Duration{
+		TTLPermanent: 0,
+		TTLEphemeral: ttlEphemeral,
+		TTLLongLived: ttlNodeDescriptorGossip,
+	}
+}
+
+// parseKeyPrefixTTLs parses a comma-separated list of <prefix>=<duration>
+// pairs, e.g. "store=5m,node=2h", into a map of per-key-prefix TTLs.
+func parseKeyPrefixTTLs(s string) (map[string]time.Duration, error) {
+	ttls := map[string]time.Duration{}
+	if s == "" {
+		return ttls, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.Errorf("invalid key prefix TTL %q: expected <prefix>=<duration>", pair)
+		}
+		ttl, err := time.ParseDuration(parts[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid key prefix TTL %q", pair)
+		}
+		if ttl < 0 {
+			return nil, errors.Errorf("invalid key prefix TTL %q: duration must not be negative", pair)
+		}
+		ttls[parts[0]] = ttl
+	}
+	return ttls, nil
+}
+
+// keyPrefixTTLsFromEnv returns the per-key-prefix TTLs specified by the
+// COCKROACH_GOSSIP_KEY_PREFIX_TTLS environment variable.
+func keyPrefixTTLsFromEnv() (map[string]time.Duration, error) {
+	return parseKeyPrefixTTLs(envutil.EnvOrDefaultString("COCKROACH_GOSSIP_KEY_PREFIX_TTLS", ""))
+}
+
+// SetTTLClass sets the time-to-live of infos subsequently added with the
+// specified class. A zero ttl makes the infos never expire.
+func (g *Gossip) SetTTLClass(class TTLClass, ttl time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.ttlClasses[class] = ttl
+}
+
+// SetKeyPrefixTTL overrides the time-to-live of all infos subsequently
+// added by this node whose keys have the specified prefix (see KeyPrefix),
+// regardless of the TTL or TTL class requested by the caller. A zero ttl
+// makes the infos never expire.
+func (g *Gossip) SetKeyPrefixTTL(prefix string, ttl time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.keyPrefixTTLs[prefix] = ttl
+}
+
+// ClearKeyPrefixTTL removes the time-to-live override for the specified
+// key prefix.
+func (g *Gossip) ClearKeyPrefixTTL(prefix string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.keyPrefixTTLs, prefix)
+}
+
+// AddInfoWithTTLClass adds or updates an info object with the time-to-live
+// of the specified class. Returns an error if info couldn't be added.
+func (g *Gossip) AddInfoWithTTLClass(key string, val []byte, class TTLClass) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	ttl, err := g.ttlForClassLocked(class)
+	if err != nil {
+		return err
+	}
+	return g.addInfoLocked(key, val, ttl)
+}
+
+// AddInfoProtoWithTTLClass adds or updates an info object with the
+// time-to-live of the specified class. Returns an error if info couldn't be
+// added.
+func (g *Gossip) AddInfoProtoWithTTLClass(key string, msg proto.Message, class TTLClass) error {
+	bytes, err := protoutil.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return g.AddInfoWithTTLClass(key, bytes, class)
+}
+
+// ttlForClassLocked returns the time-to-live of the specified class. The
+// gossip mutex must be held by the caller.
+func (g *Gossip) ttlForClassLocked(class TTLClass) (time.Duration, error) {
+	ttl, ok := g.ttlClasses[class]
+	if !ok {
+		return 0, errors.Errorf("unknown gossip TTL class %d", class)
+	}
+	return ttl, nil
+}
+
+// ttlForKeyLocked returns the time-to-live to use for an info with the
+// specified key, applying any override for the key's prefix to the
+// requested ttl. The gossip mutex must be held by the caller.
+func (g *Gossip) ttlForKeyLocked(key string, ttl time.Duration) time.Duration {
+	if override, ok := g.keyPrefixTTLs[KeyPrefix(key)]; ok {
+		return override
+	}
+	return ttl
+}
@@ -0,0 +1,134 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package gossip
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/rpc"
+	"github.com/cockroachdb/cockroach/pkg/testutils"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/metric"
+	"github.com/cockroachdb/cockroach/pkg/util/stop"
+)
+
+// TestGossipTTLClasses verifies that infos added with a TTL class expire
+// according to the class, and that per-key-prefix overrides take precedence
+// over both TTL classes and explicit TTLs.
+func TestGossipTTLClasses(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+	rpcContext := newInsecureRPCContext(stopper)
+	g := NewTest(1, rpcContext, rpc.NewServer(rpcContext), nil, stopper, metric.NewRegistry())
+
+	ttlStamp := func(key string) int64 {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		i := g.mu.is.getInfo(key)
+		if i == nil {
+			t.Fatalf("%s: info not found", key)
+		}
+		return i.TTLStamp - i.Value.Timestamp.WallTime
+	}
+
+	g.SetTTLClass(TTLEphemeral, time.Minute)
+	g.SetKeyPrefixTTL(KeyNodeLivenessPrefix, time.Second)
+
+	for _, test := range []struct {
+		key      string
+		add      func(key string) error
+		expected int64
+	}{
+		{MakeStoreKey(1), func(key string) error {
+			return g.AddInfoWithTTLClass(key, nil, TTLEphemeral)
+		}, int64(time.Minute)},
+		{MakeNodeIDKey(2), func(key string) error {
+			return g.AddInfoWithTTLClass(key, nil, TTLLongLived)
+		}, int64(ttlNodeDescriptorGossip)},
+		{KeySystemConfig, func(key string) error {
+			return g.AddInfoWithTTLClass(key, nil, TTLPermanent)
+		}, -1},
+		{MakeNodeLivenessKey(1), func(key string) error {
+			return g.AddInfoWithTTLClass(key, nil, TTLLongLived)
+		}, int64(time.Second)},
+		{MakeNodeLivenessKey(2), func(key string) error {
+			return g.AddInfo(key, nil, time.Hour)
+		}, int64(time.Second)},
+	} {
+		if err := test.add(test.key); err != nil {
+			t.Fatal(err)
+		}
+		if test.expected == -1 {
+			g.mu.Lock()
+			stamp := g.mu.is.getInfo(test.key).TTLStamp
+			g.mu.Unlock()
+			if stamp != math.MaxInt64 {
+				t.Errorf("%s: expected info not to expire, got TTL stamp %d", test.key, stamp)
+			}
+			continue
+		}
+		if ttl := ttlStamp(test.key); ttl != test.expected {
+			t.Errorf("%s: expected TTL %s, got %s", test.key, time.Duration(test.expected), time.Duration(ttl))
+		}
+	}
+
+	g.ClearKeyPrefixTTL(KeyNodeLivenessPrefix)
+	if err := g.AddInfo(MakeNodeLivenessKey(3), nil, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := ttlStamp(MakeNodeLivenessKey(3)); ttl != int64(time.Hour) {
+		t.Errorf("expected TTL %s after clearing override, got %s", time.Hour, time.Duration(ttl))
+	}
+
+	if err := g.AddInfoWithTTLClass("a", nil, TTLClass(100)); !testutils.IsError(err, "unknown gossip TTL class") {
+		t.Errorf("expected unknown TTL class error, got %v", err)
+	}
+}
+
+func TestParseKeyPrefixTTLs(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	testCases := []struct {
+		s        string
+		expected map[string]time.Duration
+		err      string
+	}{
+		{"", map[string]time.Duration{}, ""},
+		{"store=5m", map[string]time.Duration{"store": 5 * time.Minute}, ""},
+		{"store=5m,node=0s", map[string]time.Duration{"store": 5 * time.Minute, "node": 0}, ""},
+		{"store", nil, "expected <prefix>=<duration>"},
+		{"=5m", nil, "expected <prefix>=<duration>"},
+		{"store=5", nil, "invalid key prefix TTL"},
+		{"store=-5m", nil, "must not be negative"},
+	}
+	for _, tc := range testCases {
+		ttls, err := parseKeyPrefixTTLs(tc.s)
+		if tc.err != "" {
+			if !testutils.IsError(err, tc.err) {
+				t.Errorf("%q: expected error %q, got %v", tc.s, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", tc.s, err)
+		} else if !reflect.DeepEqual(ttls, tc.expected) {
+			t.Errorf("%q: expected %v, got %v", tc.s, tc.expected, ttls)
+		}
+	}
+}
@@ -590,13 +590,11 @@ func (txn *Txn) sendInternal(ba roachpb.BatchRequest) (*roachpb.BatchResponse, *
 	}
 
 	if br != nil {
-		for _, encSp := range br.CollectedSpans {
-			var newSp basictracer.RawSpan
-			if err := tracing.DecodeRawSpan(encSp, &newSp); err != nil {
-				return nil, roachpb.NewError(err)
-			}
-			txn.CollectedSpans = append(txn.CollectedSpans, newSp)
+		spans, err := br.Recording()
+		if err != nil {
+			return nil, roachpb.NewError(err)
 		}
+		txn.CollectedSpans = append(txn.CollectedSpans, spans...)
 	}
 	// Only successful requests can carry an updated Txn in their response
 	// header. Any error (e.g. a restart) can have a Txn attached to them as
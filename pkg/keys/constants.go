@@ -80,6 +80,9 @@ var (
 	// localStoreGossipSuffix stores gossip bootstrap metadata for this
 	// store, updated any time new gossip hosts are encountered.
 	localStoreGossipSuffix = []byte("goss")
+	// localStoreHLCUpperBoundSuffix stores an upper bound on the wall time
+	// of the node's clock, used to keep the clock monotonic across restarts.
+	localStoreHLCUpperBoundSuffix = []byte("hlcu")
 
 	// LocalRangeIDPrefix is the prefix identifying per-range data
 	// indexed by Range ID. The Range ID is appended to this prefix,
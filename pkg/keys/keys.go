@@ -52,6 +52,12 @@ func StoreGossipKey() roachpb.Key {
 	return MakeStoreKey(localStoreGossipSuffix, nil)
 }
 
+// StoreHLCUpperBoundKey returns a store-local key for the upper bound on the
+// wall time of the node's clock.
+func StoreHLCUpperBoundKey() roachpb.Key {
+	return MakeStoreKey(localStoreHLCUpperBoundSuffix, nil)
+}
+
 // NodeLivenessKey returns the key for the node liveness record.
 func NodeLivenessKey(nodeID roachpb.NodeID) roachpb.Key {
 	key := make(roachpb.Key, 0, len(NodeLivenessPrefix)+9)
@@ -97,6 +97,7 @@ func TestKeyAddressError(t *testing.T) {
 		"store-local key .* is not addressable": {
 			StoreIdentKey(),
 			StoreGossipKey(),
+			StoreHLCUpperBoundKey(),
 		},
 		"local range ID key .* is not addressable": {
 			AbortCacheKey(0, uuid.MakeV4()),
@@ -71,7 +71,7 @@ var (
 			{name: "/RangeID", prefix: roachpb.Key(LocalRangeIDPrefix),
 				ppFunc: localRangeIDKeyPrint, psFunc: localRangeIDKeyParse},
 			{name: "/Range", prefix: LocalRangePrefix, ppFunc: localRangeKeyPrint,
-				psFunc: parseUnsupported},
+				psFunc: localRangeKeyParse},
 		}},
 		{name: "/Meta1", start: Meta1Prefix, end: Meta1KeyMax, entries: []dictEntry{
 			{name: "", prefix: Meta1Prefix, ppFunc: print,
@@ -105,17 +105,19 @@ var (
 			}},
 		},
 		{name: "/System", start: SystemPrefix, end: SystemMax, entries: []dictEntry{
-			{name: "/NodeLiveness", prefix: NodeLivenessPrefix,
+			// NodeLivenessMax needs to precede NodeLiveness, which is a prefix
+			// of its name.
+			{name: "/NodeLivenessMax", prefix: NodeLivenessKeyMax,
 				ppFunc: decodeKeyPrint,
 				psFunc: parseUnsupported,
 			},
-			{name: "/NodeLivenessMax", prefix: NodeLivenessKeyMax,
+			{name: "/NodeLiveness", prefix: NodeLivenessPrefix,
 				ppFunc: decodeKeyPrint,
-				psFunc: parseUnsupported,
+				psFunc: nodeIDKeyParse(NodeLivenessKey),
 			},
 			{name: "/StatusNode", prefix: StatusNodePrefix,
 				ppFunc: decodeKeyPrint,
-				psFunc: parseUnsupported,
+				psFunc: nodeIDKeyParse(NodeStatusKey),
 			},
 			{name: "/tsd", prefix: TimeseriesPrefix,
 				ppFunc: decodeTimeseriesKey,
@@ -124,7 +126,7 @@ var (
 		}},
 		{name: "/Table", start: TableDataMin, end: TableDataMax, entries: []dictEntry{
 			{name: "", prefix: nil, ppFunc: decodeKeyPrint,
-				psFunc: parseUnsupported},
+				psFunc: tableKeyParse},
 		}},
 	}
 
@@ -180,6 +182,7 @@ var constSubKeyDict = []struct {
 }{
 	{"/storeIdent", localStoreIdentSuffix},
 	{"/gossipBootstrap", localStoreGossipSuffix},
+	{"/hlcUpperBound", localStoreHLCUpperBoundSuffix},
 }
 
 func localStoreKeyPrint(key roachpb.Key) string {
@@ -249,6 +252,85 @@ func mustShift(in string) (first, remainder string) {
 	return in[:1], in[1:]
 }
 
+// mustShiftQuoted unquotes the Go string literal at the beginning of the
+// input, returning it along with the remainder of the input.
+func mustShiftQuoted(in string) (unquoted, remainder string) {
+	if len(in) == 0 || in[0] != '"' {
+		panic(&errUglifyUnsupported{errors.Errorf("expected quoted string: %s", in)})
+	}
+	for i := 1; i < len(in); i++ {
+		switch in[i] {
+		case '\\':
+			i++
+		case '"':
+			unq, err := strconv.Unquote(in[:i+1])
+			if err != nil {
+				panic(&errUglifyUnsupported{err})
+			}
+			return unq, in[i+1:]
+		}
+	}
+	panic(&errUglifyUnsupported{errors.Errorf("unterminated quoted string: %s", in)})
+}
+
+// nodeIDKeyParse returns a parser for the system keys which are made up of a
+// prefix followed by a node ID.
+func nodeIDKeyParse(
+	mkKey func(nodeID roachpb.NodeID) roachpb.Key,
+) func(input string) (string, roachpb.Key) {
+	return func(input string) (string, roachpb.Key) {
+		input = mustShiftSlash(input)
+		nodeID, err := strconv.ParseInt(input, 10, 32)
+		if err != nil {
+			panic(&errUglifyUnsupported{err})
+		}
+		return "", mkKey(roachpb.NodeID(nodeID))
+	}
+}
+
+// tableKeyParse parses a table key, i.e. a table ID followed by any number of
+// column values. Since the encoding direction of the values is not part of
+// the pretty-printed key, they are encoded in ascending order. Only NULLs,
+// integers and strings are supported.
+func tableKeyParse(input string) (remainder string, output roachpb.Key) {
+	input = mustShiftSlash(input)
+	slashPos := strings.Index(input, "/")
+	if slashPos < 0 {
+		slashPos = len(input)
+	}
+	tableID, err := strconv.ParseUint(input[:slashPos], 10, 32)
+	if err != nil {
+		panic(&errUglifyUnsupported{err})
+	}
+	output = MakeTablePrefix(uint32(tableID))
+	input = input[slashPos:]
+	for len(input) > 0 {
+		input = mustShiftSlash(input)
+		if strings.HasPrefix(input, `"`) {
+			var s string
+			s, input = mustShiftQuoted(input)
+			output = encoding.EncodeStringAscending(output, s)
+			continue
+		}
+		slashPos = strings.Index(input, "/")
+		if slashPos < 0 {
+			slashPos = len(input)
+		}
+		value := input[:slashPos]
+		input = input[slashPos:]
+		if value == "NULL" {
+			output = encoding.EncodeNullAscending(output)
+			continue
+		}
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			panic(&errUglifyUnsupported{errors.Errorf("unsupported value: %s", value)})
+		}
+		output = encoding.EncodeVarintAscending(output, i)
+	}
+	return "", output
+}
+
 func localRangeIDKeyParse(input string) (remainder string, key roachpb.Key) {
 	var rangeID int64
 	var err error
@@ -354,6 +436,40 @@ func localRangeIDKeyPrint(key roachpb.Key) string {
 	return buf.String()
 }
 
+const strTxnAddrKeyID = "/addrKey:/id:"
+
+func localRangeKeyParse(input string) (remainder string, key roachpb.Key) {
+	input = mustShiftSlash(input)
+	addrKey, input := mustShiftQuoted(input)
+	if input == "" {
+		return "", MakeRangeKeyPrefix(roachpb.RKey(addrKey))
+	}
+	input = mustShiftSlash(input)
+	for _, s := range rangeSuffixDict {
+		if !strings.HasPrefix(input, s.name) {
+			continue
+		}
+		input = input[len(s.name):]
+		if s.atEnd {
+			if input != "" {
+				panic(&errUglifyUnsupported{errors.New("nontrivial detail")})
+			}
+			return "", MakeRangeKey(roachpb.RKey(addrKey), s.suffix, nil)
+		}
+		if !strings.HasPrefix(input, strTxnAddrKeyID) {
+			panic(&errUglifyUnsupported{errors.New("txn id not available")})
+		}
+		var idStr string
+		idStr, input = mustShiftQuoted(input[len(strTxnAddrKeyID):])
+		id, err := uuid.FromString(idStr)
+		if err != nil {
+			panic(&errUglifyUnsupported{err})
+		}
+		return input, MakeRangeKey(roachpb.RKey(addrKey), s.suffix, roachpb.RKey(id.GetBytes()))
+	}
+	panic(&errUglifyUnsupported{errors.New("unhandled range key suffix")})
+}
+
 func localRangeKeyPrint(key roachpb.Key) string {
 	var buf bytes.Buffer
 
@@ -372,7 +488,7 @@ func localRangeKeyPrint(key roachpb.Key) string {
 				if err != nil {
 					return fmt.Sprintf("/%q/err:%v", key, err)
 				}
-				fmt.Fprintf(&buf, "%s/%s/addrKey:/id:%q", decodeKeyPrint(addrKey), s.name, txnID)
+				fmt.Fprintf(&buf, "%s/%s%s%q", decodeKeyPrint(addrKey), s.name, strTxnAddrKeyID, txnID)
 				return buf.String()
 			}
 		}
@@ -545,6 +661,23 @@ func UglyPrint(input string) (_ roachpb.Key, rErr error) {
 		return nil, errors.Errorf(`can't parse "%s" after reading %s: %s`, input, origInput[:len(origInput)-len(input)], err)
 	}
 
+	// Keys of keys are printed recursively (see PrettyPrint), unless the
+	// suffix is a quoted key or a constant.
+	for _, v := range keyOfKeyDict {
+		if !strings.HasPrefix(input, v.name) {
+			continue
+		}
+		if rest := input[len(v.name):]; !strings.HasPrefix(rest, `/"`) && rest != "/Max" {
+			key, err := UglyPrint(rest)
+			if err != nil {
+				return nil, err
+			}
+			output = append(append(output, v.prefix...), key...)
+			input = ""
+		}
+		break
+	}
+
 	var entries []dictEntry // nil if not pinned to a subrange
 outer:
 	for len(input) > 0 {
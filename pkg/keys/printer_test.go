@@ -39,118 +39,131 @@ func TestPrettyPrint(t *testing.T) {
 	durationDesc, _ := encoding.EncodeDurationDescending(nil, duration)
 	txnID := uuid.MakeV4()
 
+	// The expectations for parsing the pretty-printed keys. UglyPrint may not
+	// support the keys marked revertSupportUnknown, but must return the
+	// original key if it does. For the keys marked revertMustSupportAmbiguous,
+	// which contain values that aren't encoded in ascending order, it must
+	// return a key with the same pretty-printed representation.
+	const (
+		revertSupportUnknown = iota
+		revertMustSupport
+		revertMustSupportAmbiguous
+	)
+
 	// The following test cases encode keys with a mixture of ascending and descending direction,
 	// but always decode keys in the ascending direction. This is why some of the decoded values
 	// seem bizarre.
 	testCases := []struct {
-		key roachpb.Key
-		exp string
+		key    roachpb.Key
+		exp    string
+		revert int
 	}{
 		// local
-		{StoreIdentKey(), "/Local/Store/storeIdent"},
-		{StoreGossipKey(), "/Local/Store/gossipBootstrap"},
-
-		{AbortCacheKey(roachpb.RangeID(1000001), txnID), fmt.Sprintf(`/Local/RangeID/1000001/r/AbortCache/%q`, txnID)},
-		{RaftTombstoneKey(roachpb.RangeID(1000001)), "/Local/RangeID/1000001/r/RaftTombstone"},
-		{RaftAppliedIndexKey(roachpb.RangeID(1000001)), "/Local/RangeID/1000001/r/RaftAppliedIndex"},
-		{LeaseAppliedIndexKey(roachpb.RangeID(1000001)), "/Local/RangeID/1000001/r/LeaseAppliedIndex"},
-		{RaftTruncatedStateKey(roachpb.RangeID(1000001)), "/Local/RangeID/1000001/r/RaftTruncatedState"},
-		{RangeLeaseKey(roachpb.RangeID(1000001)), "/Local/RangeID/1000001/r/RangeLease"},
-		{RangeStatsKey(roachpb.RangeID(1000001)), "/Local/RangeID/1000001/r/RangeStats"},
-		{RangeTxnSpanGCThresholdKey(roachpb.RangeID(1000001)), `/Local/RangeID/1000001/r/RangeTxnSpanGCThreshold`},
-		{RangeFrozenStatusKey(roachpb.RangeID(1000001)), "/Local/RangeID/1000001/r/RangeFrozenStatus"},
-		{RangeLastGCKey(roachpb.RangeID(1000001)), "/Local/RangeID/1000001/r/RangeLastGC"},
-
-		{RaftHardStateKey(roachpb.RangeID(1000001)), "/Local/RangeID/1000001/u/RaftHardState"},
-		{RaftLastIndexKey(roachpb.RangeID(1000001)), "/Local/RangeID/1000001/u/RaftLastIndex"},
-		{RaftLogKey(roachpb.RangeID(1000001), uint64(200001)), "/Local/RangeID/1000001/u/RaftLog/logIndex:200001"},
-		{RangeLastReplicaGCTimestampKey(roachpb.RangeID(1000001)), "/Local/RangeID/1000001/u/RangeLastReplicaGCTimestamp"},
-		{RangeLastVerificationTimestampKeyDeprecated(roachpb.RangeID(1000001)), "/Local/RangeID/1000001/u/RangeLastVerificationTimestamp"},
-
-		{MakeRangeKeyPrefix(roachpb.RKey("ok")), `/Local/Range/"ok"`},
-		{RangeDescriptorKey(roachpb.RKey("111")), `/Local/Range/"111"/RangeDescriptor`},
-		{TransactionKey(roachpb.Key("111"), txnID), fmt.Sprintf(`/Local/Range/"111"/Transaction/addrKey:/id:%q`, txnID)},
-
-		{LocalMax, `/Meta1/""`}, // LocalMax == Meta1Prefix
+		{StoreIdentKey(), "/Local/Store/storeIdent", revertMustSupport},
+		{StoreGossipKey(), "/Local/Store/gossipBootstrap", revertMustSupport},
+		{StoreHLCUpperBoundKey(), "/Local/Store/hlcUpperBound", revertMustSupport},
+
+		{AbortCacheKey(roachpb.RangeID(1000001), txnID), fmt.Sprintf(`/Local/RangeID/1000001/r/AbortCache/%q`, txnID), revertMustSupport},
+		{RaftTombstoneKey(roachpb.RangeID(1000001)), "/Local/RangeID/1000001/r/RaftTombstone", revertMustSupport},
+		{RaftAppliedIndexKey(roachpb.RangeID(1000001)), "/Local/RangeID/1000001/r/RaftAppliedIndex", revertMustSupport},
+		{LeaseAppliedIndexKey(roachpb.RangeID(1000001)), "/Local/RangeID/1000001/r/LeaseAppliedIndex", revertMustSupport},
+		{RaftTruncatedStateKey(roachpb.RangeID(1000001)), "/Local/RangeID/1000001/r/RaftTruncatedState", revertMustSupport},
+		{RangeLeaseKey(roachpb.RangeID(1000001)), "/Local/RangeID/1000001/r/RangeLease", revertMustSupport},
+		{RangeStatsKey(roachpb.RangeID(1000001)), "/Local/RangeID/1000001/r/RangeStats", revertMustSupport},
+		{RangeTxnSpanGCThresholdKey(roachpb.RangeID(1000001)), `/Local/RangeID/1000001/r/RangeTxnSpanGCThreshold`, revertMustSupport},
+		{RangeFrozenStatusKey(roachpb.RangeID(1000001)), "/Local/RangeID/1000001/r/RangeFrozenStatus", revertMustSupport},
+		{RangeLastGCKey(roachpb.RangeID(1000001)), "/Local/RangeID/1000001/r/RangeLastGC", revertMustSupport},
+
+		{RaftHardStateKey(roachpb.RangeID(1000001)), "/Local/RangeID/1000001/u/RaftHardState", revertMustSupport},
+		{RaftLastIndexKey(roachpb.RangeID(1000001)), "/Local/RangeID/1000001/u/RaftLastIndex", revertMustSupport},
+		{RaftLogKey(roachpb.RangeID(1000001), uint64(200001)), "/Local/RangeID/1000001/u/RaftLog/logIndex:200001", revertMustSupport},
+		{RangeLastReplicaGCTimestampKey(roachpb.RangeID(1000001)), "/Local/RangeID/1000001/u/RangeLastReplicaGCTimestamp", revertMustSupport},
+		{RangeLastVerificationTimestampKeyDeprecated(roachpb.RangeID(1000001)), "/Local/RangeID/1000001/u/RangeLastVerificationTimestamp", revertMustSupport},
+
+		{MakeRangeKeyPrefix(roachpb.RKey("ok")), `/Local/Range/"ok"`, revertMustSupport},
+		{RangeDescriptorKey(roachpb.RKey("111")), `/Local/Range/"111"/RangeDescriptor`, revertMustSupport},
+		{TransactionKey(roachpb.Key("111"), txnID), fmt.Sprintf(`/Local/Range/"111"/Transaction/addrKey:/id:%q`, txnID), revertMustSupport},
+
+		{LocalMax, `/Meta1/""`, revertMustSupport}, // LocalMax == Meta1Prefix
 
 		// system
-		{makeKey(Meta2Prefix, roachpb.Key("foo")), `/Meta2/"foo"`},
-		{makeKey(Meta1Prefix, roachpb.Key("foo")), `/Meta1/"foo"`},
-		{RangeMetaKey(roachpb.RKey("f")), `/Meta2/"f"`},
+		{makeKey(Meta2Prefix, roachpb.Key("foo")), `/Meta2/"foo"`, revertMustSupport},
+		{makeKey(Meta1Prefix, roachpb.Key("foo")), `/Meta1/"foo"`, revertMustSupport},
+		{RangeMetaKey(roachpb.RKey("f")), `/Meta2/"f"`, revertMustSupport},
 
-		{NodeLivenessKey(10033), "/System/NodeLiveness/10033"},
-		{NodeStatusKey(1111), "/System/StatusNode/1111"},
+		{NodeLivenessKey(10033), "/System/NodeLiveness/10033", revertMustSupport},
+		{NodeStatusKey(1111), "/System/StatusNode/1111", revertMustSupport},
 
-		{SystemMax, "/System/Max"},
+		{SystemMax, "/System/Max", revertSupportUnknown},
 
 		// key of key
-		{RangeMetaKey(roachpb.RKey(MakeRangeKeyPrefix(roachpb.RKey("ok")))), `/Meta2/Local/Range/"ok"`},
-		{RangeMetaKey(roachpb.RKey(makeKey(MakeTablePrefix(42), roachpb.RKey("foo")))), `/Meta2/Table/42/"foo"`},
-		{RangeMetaKey(roachpb.RKey(makeKey(Meta2Prefix, roachpb.Key("foo")))), `/Meta1/"foo"`},
+		{RangeMetaKey(roachpb.RKey(MakeRangeKeyPrefix(roachpb.RKey("ok")))), `/Meta2/Local/Range/"ok"`, revertMustSupport},
+		{RangeMetaKey(roachpb.RKey(makeKey(MakeTablePrefix(42), roachpb.RKey("foo")))), `/Meta2/Table/42/"foo"`, revertMustSupportAmbiguous},
+		{RangeMetaKey(roachpb.RKey(makeKey(Meta2Prefix, roachpb.Key("foo")))), `/Meta1/"foo"`, revertMustSupport},
 
 		// table
-		{UserTableDataMin, "/Table/50"},
-		{MakeTablePrefix(111), "/Table/111"},
-		{makeKey(MakeTablePrefix(42), roachpb.RKey("foo")), `/Table/42/"foo"`},
+		{UserTableDataMin, "/Table/50", revertMustSupport},
+		{MakeTablePrefix(111), "/Table/111", revertMustSupport},
+		{makeKey(MakeTablePrefix(42), roachpb.RKey("foo")), `/Table/42/"foo"`, revertMustSupportAmbiguous},
 		{makeKey(MakeTablePrefix(42),
 			roachpb.RKey(encoding.EncodeFloatAscending(nil, float64(233.221112)))),
-			"/Table/42/233.221112"},
+			"/Table/42/233.221112", revertSupportUnknown},
 		{makeKey(MakeTablePrefix(42),
 			roachpb.RKey(encoding.EncodeFloatDescending(nil, float64(-233.221112)))),
-			"/Table/42/233.221112"},
+			"/Table/42/233.221112", revertSupportUnknown},
 		{makeKey(MakeTablePrefix(42),
 			roachpb.RKey(encoding.EncodeFloatAscending(nil, math.Inf(1)))),
-			"/Table/42/+Inf"},
+			"/Table/42/+Inf", revertSupportUnknown},
 		{makeKey(MakeTablePrefix(42),
 			roachpb.RKey(encoding.EncodeFloatAscending(nil, math.NaN()))),
-			"/Table/42/NaN"},
+			"/Table/42/NaN", revertSupportUnknown},
 		{makeKey(MakeTablePrefix(42),
 			roachpb.RKey(encoding.EncodeVarintAscending(nil, 1222)),
 			roachpb.RKey(encoding.EncodeStringAscending(nil, "handsome man"))),
-			`/Table/42/1222/"handsome man"`},
+			`/Table/42/1222/"handsome man"`, revertMustSupport},
 		{makeKey(MakeTablePrefix(42),
 			roachpb.RKey(encoding.EncodeVarintAscending(nil, 1222))),
-			`/Table/42/1222`},
+			`/Table/42/1222`, revertMustSupport},
 		{makeKey(MakeTablePrefix(42),
 			roachpb.RKey(encoding.EncodeVarintDescending(nil, 1222))),
-			`/Table/42/-1223`},
+			`/Table/42/-1223`, revertMustSupportAmbiguous},
 		{makeKey(MakeTablePrefix(42),
 			roachpb.RKey(encoding.EncodeBytesAscending(nil, []byte{1, 2, 8, 255}))),
-			`/Table/42/"\x01\x02\b\xff"`},
+			`/Table/42/"\x01\x02\b\xff"`, revertMustSupport},
 		{makeKey(MakeTablePrefix(42),
 			roachpb.RKey(encoding.EncodeBytesAscending(nil, []byte{1, 2, 8, 255})),
-			roachpb.RKey("bar")), `/Table/42/"\x01\x02\b\xff"/"bar"`},
+			roachpb.RKey("bar")), `/Table/42/"\x01\x02\b\xff"/"bar"`, revertMustSupportAmbiguous},
 		{makeKey(MakeTablePrefix(42),
 			roachpb.RKey(encoding.EncodeBytesDescending(nil, []byte{1, 2, 8, 255})),
-			roachpb.RKey("bar")), `/Table/42/"\x01\x02\b\xff"/"bar"`},
+			roachpb.RKey("bar")), `/Table/42/"\x01\x02\b\xff"/"bar"`, revertMustSupportAmbiguous},
 		{makeKey(MakeTablePrefix(42),
-			roachpb.RKey(encoding.EncodeNullAscending(nil))), "/Table/42/NULL"},
+			roachpb.RKey(encoding.EncodeNullAscending(nil))), "/Table/42/NULL", revertMustSupport},
 		{makeKey(MakeTablePrefix(42),
-			roachpb.RKey(encoding.EncodeNotNullAscending(nil))), "/Table/42/#"},
+			roachpb.RKey(encoding.EncodeNotNullAscending(nil))), "/Table/42/#", revertSupportUnknown},
 		{makeKey(MakeTablePrefix(42),
 			roachpb.RKey(encoding.EncodeTimeAscending(nil, tm))),
-			"/Table/42/2016-03-30T13:40:35.053725008Z"},
+			"/Table/42/2016-03-30T13:40:35.053725008Z", revertSupportUnknown},
 		{makeKey(MakeTablePrefix(42),
 			roachpb.RKey(encoding.EncodeTimeDescending(nil, tm))),
-			"/Table/42/1923-10-04T10:19:23.946274991Z"},
+			"/Table/42/1923-10-04T10:19:23.946274991Z", revertSupportUnknown},
 		{makeKey(MakeTablePrefix(42),
 			roachpb.RKey(encoding.EncodeDecimalAscending(nil, inf.NewDec(1234, 2)))),
-			"/Table/42/12.34"},
+			"/Table/42/12.34", revertSupportUnknown},
 		{makeKey(MakeTablePrefix(42),
 			roachpb.RKey(encoding.EncodeDecimalDescending(nil, inf.NewDec(1234, 2)))),
-			"/Table/42/-12.34"},
+			"/Table/42/-12.34", revertSupportUnknown},
 		{makeKey(MakeTablePrefix(42),
 			roachpb.RKey(durationAsc)),
-			"/Table/42/1m1d1s"},
+			"/Table/42/1m1d1s", revertSupportUnknown},
 		{makeKey(MakeTablePrefix(42),
 			roachpb.RKey(durationDesc)),
-			"/Table/42/-2m-2d743h59m58.999999999s"},
+			"/Table/42/-2m-2d743h59m58.999999999s", revertSupportUnknown},
 
 		// others
-		{makeKey([]byte("")), "/Min"},
-		{Meta1KeyMax, "/Meta1/Max"},
-		{Meta2KeyMax, "/Meta2/Max"},
-		{makeKey(MakeTablePrefix(42), roachpb.RKey([]byte{0x12, 'a', 0x00, 0x02})), "/Table/42/<unknown escape sequence: 0x0 0x2>"},
+		{makeKey([]byte("")), "/Min", revertMustSupport},
+		{Meta1KeyMax, "/Meta1/Max", revertMustSupport},
+		{Meta2KeyMax, "/Meta2/Max", revertMustSupport},
+		{makeKey(MakeTablePrefix(42), roachpb.RKey([]byte{0x12, 'a', 0x00, 0x02})), "/Table/42/<unknown escape sequence: 0x0 0x2>", revertSupportUnknown},
 	}
 	for i, test := range testCases {
 		keyInfo := MassagePrettyPrintedSpanForTest(PrettyPrint(test.key), nil)
@@ -165,11 +178,15 @@ func TestPrettyPrint(t *testing.T) {
 
 		parsed, err := UglyPrint(keyInfo)
 		if err != nil {
-			if _, ok := err.(*errUglifyUnsupported); !ok {
+			if _, ok := err.(*errUglifyUnsupported); !ok || test.revert != revertSupportUnknown {
 				t.Errorf("%d: %s: %s", i, keyInfo, err)
 			} else {
 				t.Logf("%d: skipping parsing of %s; key is unsupported: %v", i, keyInfo, err)
 			}
+		} else if test.revert == revertMustSupportAmbiguous {
+			if act := PrettyPrint(parsed); act != keyInfo {
+				t.Errorf("%d: expected %s, got %s", i, keyInfo, act)
+			}
 		} else if exp, act := test.key, parsed; !bytes.Equal(exp, act) {
 			t.Errorf("%d: expected %q, got %q", i, exp, act)
 		}
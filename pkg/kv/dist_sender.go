@@ -119,7 +119,11 @@ type DistSenderConfig struct {
 	// range descriptor cache when dispatching a range lookup request.
 	RangeLookupMaxRanges int32
 	LeaseHolderCacheSize int32
-	RPCRetryOptions      *retry.Options
+	// RPCRetryOptions are used to retry sends to a range. If they set a
+	// MaxDuration, sends which are still failing once it has elapsed return
+	// a RetriesExhaustedError; by default, sends are retried until they
+	// succeed or the stopper quiesces.
+	RPCRetryOptions *retry.Options
 	// nodeDescriptor, if provided, is used to describe which node the DistSender
 	// lives on, for instance when deciding where to send RPCs.
 	// Usually it is filled in from the Gossip network on demand.
@@ -473,7 +477,7 @@ func (ds *DistSender) initAndVerifyBatch(
 		return roachpb.NewErrorf("empty batch")
 	}
 
-	if ba.MaxSpanRequestKeys != 0 {
+	if ba.MaxSpanRequestKeys != 0 || ba.TargetBytes != 0 {
 		// Verify that the batch contains only specific range requests or the
 		// Begin/EndTransactionRequest. Verify that a batch with a ReverseScan
 		// only contains ReverseScan range requests.
@@ -534,10 +538,10 @@ func (ds *DistSender) Send(
 
 	var rplChunks []*roachpb.BatchResponse
 	parts := ba.Split(false /* don't split ET */)
-	if len(parts) > 1 && ba.MaxSpanRequestKeys != 0 {
+	if len(parts) > 1 && (ba.MaxSpanRequestKeys != 0 || ba.TargetBytes != 0) {
 		// We already verified above that the batch contains only scan requests of the same type.
 		// Such a batch should never need splitting.
-		panic("batch with MaxSpanRequestKeys needs splitting")
+		panic("batch with MaxSpanRequestKeys or TargetBytes needs splitting")
 	}
 	for len(parts) > 0 {
 		part := parts[0]
@@ -722,7 +726,7 @@ func (ds *DistSender) divideAndSendBatchToRanges(
 		// If we're not handling a request which limits responses and we
 		// can reserve one of the limited goroutines available for parallel
 		// batch RPCs, send asynchronously.
-		if ba.MaxSpanRequestKeys == 0 && ri.NeedAnother(rs) && ds.rpcContext != nil &&
+		if ba.MaxSpanRequestKeys == 0 && ba.TargetBytes == 0 && ri.NeedAnother(rs) && ds.rpcContext != nil &&
 			ds.sendPartialBatchAsync(ctx, ba, rs, ri.Desc(), ri.Token(), isFirst, responseCh) {
 			// Note that we pass the batch request by value to the parallel
 			// goroutine to avoid using the cloned txn.
@@ -734,7 +738,7 @@ func (ds *DistSender) divideAndSendBatchToRanges(
 			}
 		} else {
 			// Send synchronously if there is no parallel capacity left, there's a
-			// max results limit, or this is the final request in the span.
+			// max results or target bytes limit, or this is the final request in the span.
 			resp := ds.sendPartialBatch(ctx, ba, rs, ri.Desc(), ri.Token(), isFirst)
 			responseCh <- resp
 			if resp.pErr != nil {
@@ -758,6 +762,19 @@ func (ds *DistSender) divideAndSendBatchToRanges(
 					return
 				}
 			}
+
+			// Check whether we've received enough bytes to exit query loop. The
+			// last range may have returned more than the remaining target.
+			if ba.TargetBytes > 0 {
+				for _, r := range resp.reply.Responses {
+					ba.TargetBytes -= r.GetInner().Header().NumBytes
+				}
+				// Exiting; fill in missing responses.
+				if ba.TargetBytes <= 0 {
+					fillSkippedResponses(ba, resp.reply, seekKey)
+					return
+				}
+			}
 		}
 
 		// Check for completion.
@@ -836,8 +853,11 @@ func (ds *DistSender) sendPartialBatch(
 		return response{pErr: roachpb.NewError(err)}
 	}
 
-	// Start a retry loop for sending the batch to the range.
-	for r := retry.StartWithCtx(ctx, ds.rpcRetryOptions); r.Next(); {
+	// Start a retry loop for sending the batch to the range. lastErr holds
+	// the error of the last attempt which is retried.
+	var lastErr error
+	r := retry.StartWithCtx(ctx, ds.rpcRetryOptions)
+	for r.Next() {
 		// If we've cleared the descriptor on a send failure, re-lookup.
 		if desc == nil {
 			var descKey roachpb.RKey
@@ -849,6 +869,7 @@ func (ds *DistSender) sendPartialBatch(
 			desc, evictToken, err = ds.getDescriptor(ctx, descKey, nil, isReverse)
 			if err != nil {
 				log.ErrEventf(ctx, "range descriptor re-lookup failed: %s", err)
+				lastErr = err
 				continue
 			}
 		}
@@ -882,6 +903,7 @@ func (ds *DistSender) sendPartialBatch(
 			}
 			// Clear the descriptor to reload on the next attempt.
 			desc = nil
+			lastErr = tErr
 			continue
 		case *roachpb.RangeKeyMismatchError:
 			// Range descriptor might be out of date - evict it. This is
@@ -915,9 +937,12 @@ func (ds *DistSender) sendPartialBatch(
 		break
 	}
 
-	// Propagate error if either the retry closer or context done
-	// channels were closed.
-	if pErr == nil {
+	// Return a RetriesExhaustedError wrapping the last error if the retry
+	// budget was used up, and propagate the error if either the retry closer
+	// or context done channels were closed.
+	if err := r.Err(lastErr); err != nil {
+		pErr = roachpb.NewError(err)
+	} else if pErr == nil {
 		if pErr = ds.deduceRetryEarlyExitError(ctx); pErr == nil {
 			log.Fatal(ctx, "exited retry loop without an error")
 		}
@@ -946,8 +971,8 @@ func includesFrontOfCurSpan(isReverse bool, rd *roachpb.RangeDescriptor, rs roac
 	return rd.ContainsKey(rs.Key)
 }
 
-// fillSkippedResponses after meeting the batch key max limit for range
-// requests.
+// fillSkippedResponses after meeting the batch key max limit or the target
+// bytes for range requests.
 func fillSkippedResponses(ba roachpb.BatchRequest, br *roachpb.BatchResponse, nextKey roachpb.RKey) {
 	// Some requests might have NoopResponses; we must replace them with empty
 	// responses of the proper type.
@@ -361,6 +361,83 @@ func TestMultiRangeBoundedBatchReverseScan(t *testing.T) {
 	}
 }
 
+// TestMultiRangeTargetBytesScan verifies that scans and reverse scans across
+// many ranges stop once the TargetBytes of the batch are reached, and that
+// the returned resume spans cover the remaining keys.
+func TestMultiRangeTargetBytesScan(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	s, _, _ := serverutils.StartServer(t, base.TestServerArgs{})
+	defer s.Stopper().Stop()
+	ctx := context.TODO()
+
+	db := setupMultipleRanges(t, s, "a", "b", "c", "d", "e", "f")
+	writtenKeys := []string{"a1", "a2", "a3", "b1", "b2", "c1", "c2", "d1", "f1", "f2", "f3"}
+	for _, key := range writtenKeys {
+		if err := db.Put(ctx, key, "value"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rows, err := db.Scan(ctx, "a", "g", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// All the rows have the same size.
+	rowSize := int64(len(rows[0].Key) + len(rows[0].Value.RawBytes))
+
+	for _, reverse := range []bool{false, true} {
+		for target := int64(1); target <= rowSize*int64(len(writtenKeys)+1); target += rowSize / 2 {
+			scan := func(b *client.Batch, start, end interface{}) {
+				if reverse {
+					b.ReverseScan(start, end)
+				} else {
+					b.Scan(start, end)
+				}
+			}
+			b := &client.Batch{}
+			b.Header.TargetBytes = target
+			scan(b, "a", "g")
+			if err := db.Run(ctx, b); err != nil {
+				t.Fatal(err)
+			}
+			res := b.Results[0]
+
+			// At least one row is returned, and the last one may exceed the target.
+			expCount := int((target + rowSize - 1) / rowSize)
+			if expCount > len(writtenKeys) {
+				expCount = len(writtenKeys)
+			}
+			if len(res.Rows) != expCount {
+				t.Fatalf("reverse=%t, target=%d: expected %d rows, got %d", reverse, target, expCount, len(res.Rows))
+			}
+			if (res.ResumeSpan.Key != nil) != (expCount < len(writtenKeys)) {
+				t.Fatalf("reverse=%t, target=%d: unexpected resume span %s", reverse, target, res.ResumeSpan)
+			}
+
+			// Resuming from the resume span returns the remaining rows.
+			if res.ResumeSpan.Key != nil {
+				newB := &client.Batch{}
+				scan(newB, res.ResumeSpan.Key, res.ResumeSpan.EndKey)
+				if err := db.Run(ctx, newB); err != nil {
+					t.Fatal(err)
+				}
+				res.Rows = append(res.Rows, newB.Results[0].Rows...)
+			}
+			if len(res.Rows) != len(writtenKeys) {
+				t.Fatalf("reverse=%t, target=%d: expected %d rows in total, got %d", reverse, target, len(writtenKeys), len(res.Rows))
+			}
+			for i, row := range res.Rows {
+				expKey := writtenKeys[i]
+				if reverse {
+					expKey = writtenKeys[len(writtenKeys)-1-i]
+				}
+				if key := string(row.Key); key != expKey {
+					t.Errorf("reverse=%t, target=%d: expected key %d to be %q; got %q", reverse, target, i, expKey, key)
+				}
+			}
+		}
+	}
+}
+
 // TestMultiRangeBoundedBatchScanUnsortedOrder runs two non-overlapping
 // scan requests out of order and shows how the batch response can
 // contain two partial responses.
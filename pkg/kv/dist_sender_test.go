@@ -43,6 +43,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/metric"
+	"github.com/cockroachdb/cockroach/pkg/util/retry"
 	"github.com/cockroachdb/cockroach/pkg/util/stop"
 	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
 	"github.com/cockroachdb/cockroach/pkg/util/tracing"
@@ -539,6 +540,38 @@ func TestRetryOnDescriptorLookupError(t *testing.T) {
 	}
 }
 
+// TestSendRetryBudget verifies that the DistSender stops retrying a send
+// which keeps failing once the retry budget is used up, and returns an error
+// wrapping the last send error.
+func TestSendRetryBudget(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+
+	g, clock := makeGossip(t, stopper)
+	var testFn rpcSendFn = func(_ SendOptions, _ ReplicaSlice,
+		_ roachpb.BatchRequest, _ *rpc.Context) (*roachpb.BatchResponse, error) {
+		return nil, roachpb.NewSendError("boom")
+	}
+
+	retryOpts := retry.Options{
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     10 * time.Millisecond,
+		MaxDuration:    100 * time.Millisecond,
+	}
+	cfg := DistSenderConfig{
+		Clock:             clock,
+		TransportFactory:  adaptLegacyTransport(testFn),
+		RangeDescriptorDB: defaultMockRangeDescriptorDB,
+		RPCRetryOptions:   &retryOpts,
+	}
+	ds := NewDistSender(cfg, g)
+	put := roachpb.NewPut(roachpb.Key("a"), roachpb.MakeValueFromString("value"))
+	if _, pErr := client.SendWrapped(context.Background(), ds, put); !testutils.IsPError(pErr, "retries exhausted after .*: .*boom") {
+		t.Fatalf("expected retries to be exhausted, got %v", pErr)
+	}
+}
+
 func makeGossip(t *testing.T, stopper *stop.Stopper) (*gossip.Gossip, *hlc.Clock) {
 	clock := hlc.NewClock(hlc.UnixNano, time.Nanosecond)
 	rpcContext := rpc.NewContext(
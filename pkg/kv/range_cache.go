@@ -300,9 +300,9 @@ func (rdc *rangeDescriptorCache) lookupRangeDescriptorInternal(
 	}
 
 	if log.V(3) {
-		log.Infof(ctx, "lookup range descriptor: key=%s\n%s", key, rdc.stringLocked())
+		log.Infof(ctx, "lookup range descriptor: key=%s\n%s", log.Unsafe(key), rdc.stringLocked())
 	} else if log.V(2) {
-		log.Infof(ctx, "lookup range descriptor: key=%s", key)
+		log.Infof(ctx, "lookup range descriptor: key=%s", log.Unsafe(key))
 	}
 
 	var res lookupResult
@@ -478,9 +478,9 @@ func (rdc *rangeDescriptorCache) evictCachedRangeDescriptorLocked(
 	for {
 		if log.V(3) {
 			log.Infof(rdc.ctx, "evict cached descriptor: key=%s desc=%s\n%s",
-				descKey, cachedDesc, rdc.stringLocked())
+				log.Unsafe(descKey), log.Unsafe(cachedDesc), rdc.stringLocked())
 		} else if log.V(2) {
-			log.Infof(rdc.ctx, "evict cached descriptor: key=%s desc=%s", descKey, cachedDesc)
+			log.Infof(rdc.ctx, "evict cached descriptor: key=%s desc=%s", log.Unsafe(descKey), log.Unsafe(cachedDesc))
 		}
 		rdc.rangeCache.cache.Del(rngKey)
 
@@ -579,7 +579,7 @@ func (rdc *rangeDescriptorCache) insertRangeDescriptorsLocked(rs ...roachpb.Rang
 			return err
 		}
 		if log.V(2) {
-			log.Infof(rdc.ctx, "adding descriptor: key=%s desc=%s", rangeKey, &rs[i])
+			log.Infof(rdc.ctx, "adding descriptor: key=%s desc=%s", log.Unsafe(rangeKey), log.Unsafe(&rs[i]))
 		}
 		rdc.rangeCache.cache.Add(rangeCacheKey(rangeKey), &rs[i])
 	}
@@ -605,7 +605,7 @@ func (rdc *rangeDescriptorCache) clearOverlappingCachedRangeDescriptors(
 		descriptor := v.(*roachpb.RangeDescriptor)
 		if descriptor.StartKey.Less(key) && !descriptor.EndKey.Less(key) {
 			if log.V(2) {
-				log.Infof(rdc.ctx, "clearing overlapping descriptor: key=%s desc=%s", k, descriptor)
+				log.Infof(rdc.ctx, "clearing overlapping descriptor: key=%s desc=%s", log.Unsafe(k), log.Unsafe(descriptor))
 			}
 			rdc.rangeCache.cache.Del(k.(rangeCacheKey))
 		}
@@ -628,7 +628,7 @@ func (rdc *rangeDescriptorCache) clearOverlappingCachedRangeDescriptors(
 	rdc.rangeCache.cache.DoRange(func(k, v interface{}) bool {
 		if log.V(2) {
 			log.Infof(rdc.ctx, "clearing subsumed descriptor: key=%s desc=%s",
-				k, v.(*roachpb.RangeDescriptor))
+				log.Unsafe(k), log.Unsafe(v.(*roachpb.RangeDescriptor)))
 		}
 		keys = append(keys, k.(rangeCacheKey))
 
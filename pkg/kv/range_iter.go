@@ -151,7 +151,9 @@ func (ri *RangeIterator) Seek(ctx context.Context, key roachpb.RKey, scanDir Sca
 
 	// Retry loop for looking up next range in the span. The retry loop
 	// deals with retryable range descriptor lookups.
-	for r := retry.StartWithCtx(ctx, ri.ds.rpcRetryOptions); r.Next(); {
+	var lastErr error
+	r := retry.StartWithCtx(ctx, ri.ds.rpcRetryOptions)
+	for r.Next() {
 		log.Event(ctx, "meta descriptor lookup")
 		var err error
 		ri.desc, ri.token, err = ri.ds.getDescriptor(
@@ -164,6 +166,7 @@ func (ri *RangeIterator) Seek(ctx context.Context, key roachpb.RKey, scanDir Sca
 		// for before reaching this point.
 		if err != nil {
 			log.VEventf(ctx, 1, "range descriptor lookup failed: %s", err)
+			lastErr = err
 			continue
 		}
 
@@ -189,8 +192,11 @@ func (ri *RangeIterator) Seek(ctx context.Context, key roachpb.RKey, scanDir Sca
 		return
 	}
 
-	// Check for an early exit from the retry loop.
-	if pErr := ri.ds.deduceRetryEarlyExitError(ctx); pErr != nil {
+	// Check for an exhausted retry budget or an early exit from the retry
+	// loop.
+	if err := r.Err(lastErr); err != nil {
+		ri.pErr = roachpb.NewError(err)
+	} else if pErr := ri.ds.deduceRetryEarlyExitError(ctx); pErr != nil {
 		ri.pErr = pErr
 	} else {
 		ri.pErr = roachpb.NewErrorf("RangeIterator failed to seek to %s", key)
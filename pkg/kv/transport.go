@@ -24,19 +24,14 @@ import (
 	"golang.org/x/net/context"
 
 	"github.com/cockroachdb/cockroach/pkg/internal/client"
+	"github.com/cockroachdb/cockroach/pkg/keys"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/rpc"
-	"github.com/cockroachdb/cockroach/pkg/util/envutil"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
 	"github.com/opentracing/opentracing-go"
-	"google.golang.org/grpc"
 )
 
-// Allow local calls to be dispatched directly to the local server without
-// sending an RPC.
-var enableLocalCalls = envutil.EnvOrDefaultBool("COCKROACH_ENABLE_LOCAL_CALLS", true)
-
 // A SendOptions structure describes the algorithm for sending RPCs to one or
 // more replicas, depending on error conditions and how many successful
 // responses are required.
@@ -52,7 +47,6 @@ type SendOptions struct {
 
 type batchClient struct {
 	remoteAddr string
-	conn       *grpc.ClientConn
 	client     roachpb.InternalClient
 	args       roachpb.BatchRequest
 	healthy    bool
@@ -115,21 +109,27 @@ type Transport interface {
 func grpcTransportFactoryImpl(
 	opts SendOptions, rpcContext *rpc.Context, replicas ReplicaSlice, args roachpb.BatchRequest,
 ) (Transport, error) {
+	// Requests to system ranges such as node liveness records are sent on
+	// dedicated connections so they don't queue up behind user traffic.
+	class := rpc.DefaultClass
+	if rs, err := keys.Range(args); err == nil {
+		class = rpc.ConnectionClassForSpan(rs)
+	}
 	clients := make([]batchClient, 0, len(replicas))
 	for _, replica := range replicas {
-		conn, err := rpcContext.GRPCDial(replica.NodeDesc.Address.String())
+		remoteAddr := replica.NodeDesc.Address.String()
+		// Requests to the local node are dispatched to its server directly.
+		internalClient, err := rpcContext.GetInternalClient(remoteAddr, class)
 		if err != nil {
 			return nil, err
 		}
 		argsCopy := args
 		argsCopy.Replica = replica.ReplicaDescriptor
-		remoteAddr := replica.NodeDesc.Address.String()
 		clients = append(clients, batchClient{
 			remoteAddr: remoteAddr,
-			conn:       conn,
-			client:     roachpb.NewInternalClient(conn),
+			client:     internalClient,
 			args:       argsCopy,
-			healthy:    rpcContext.IsConnHealthy(remoteAddr),
+			healthy:    rpcContext.IsConnHealthyClass(remoteAddr, class),
 		})
 	}
 
@@ -138,14 +138,12 @@ func grpcTransportFactoryImpl(
 
 	return &grpcTransport{
 		opts:           opts,
-		rpcContext:     rpcContext,
 		orderedClients: clients,
 	}, nil
 }
 
 type grpcTransport struct {
 	opts            SendOptions
-	rpcContext      *rpc.Context
 	clientIndex     int
 	orderedClients  []batchClient
 	clientPendingMu syncutil.Mutex // protects access to all batchClient pending flags
@@ -168,27 +166,6 @@ func (gt *grpcTransport) SendNext(done chan<- BatchCall) {
 		log.Infof(gt.opts.ctx, "sending request to %s: %+v", addr, client.args)
 	}
 
-	if localServer := gt.rpcContext.GetLocalInternalServerForAddr(addr); enableLocalCalls && localServer != nil {
-		// Clone the request. At the time of writing, Replica may mutate it
-		// during command execution which can lead to data races.
-		//
-		// TODO(tamird): we should clone all of client.args.Header, but the
-		// assertions in protoutil.Clone fire and there seems to be no
-		// reasonable workaround.
-		origTxn := client.args.Txn
-		if origTxn != nil {
-			clonedTxn := origTxn.Clone()
-			client.args.Txn = &clonedTxn
-		}
-
-		go func() {
-			reply, err := localServer.Batch(gt.opts.ctx, &client.args)
-			gt.setPending(client.args.Replica, false)
-			done <- BatchCall{Reply: reply, Err: err}
-		}()
-		return
-	}
-
 	go func() {
 		reply, err := client.client.Batch(gt.opts.ctx, &client.args)
 		if reply != nil {
@@ -62,7 +62,7 @@ type txnMetadata struct {
 	// keys stores key ranges affected by this transaction through this
 	// coordinator. By keeping this record, the coordinator will be able
 	// to update the write intent when the transaction is committed.
-	keys []roachpb.Span
+	keys roachpb.SpanGroup
 
 	// lastUpdateNanos is the latest wall time in nanos the client sent
 	// transaction operations to this coordinator. Accessed and updated
@@ -275,6 +275,10 @@ func (tc *TxnCoordSender) printStatsLoop(ctx context.Context) {
 func (tc *TxnCoordSender) Send(
 	ctx context.Context, ba roachpb.BatchRequest,
 ) (*roachpb.BatchResponse, *roachpb.Error) {
+	if ba.ReturnTrace && opentracing.SpanFromContext(ctx) == nil {
+		return tc.sendAndRecord(ctx, ba)
+	}
+
 	// Start new or pick up active trace. From here on, there's always an active
 	// Trace, though its overhead is small unless it's sampled.
 	sp := opentracing.SpanFromContext(ctx)
@@ -342,11 +346,11 @@ func (tc *TxnCoordSender) Send(
 			txnMeta := tc.txns[txnID]
 			distinctSpans := true
 			if txnMeta != nil {
-				et.IntentSpans = txnMeta.keys
+				et.IntentSpans = txnMeta.keys.Slice()
 				// Defensively set distinctSpans to false if we had any previous
 				// requests in this transaction. This effectively limits the distinct
 				// spans optimization to 1pc transactions.
-				distinctSpans = len(txnMeta.keys) == 0
+				distinctSpans = txnMeta.keys.Len() == 0
 			}
 			// We can't pass in a batch response here to better limit the key
 			// spans as we don't know what is going to be affected. This will
@@ -374,7 +378,7 @@ func (tc *TxnCoordSender) Send(
 				return roachpb.NewErrorf("cannot commit a read-only transaction")
 			}
 			if txnMeta != nil {
-				txnMeta.keys = et.IntentSpans
+				txnMeta.keys.Add(et.IntentSpans...)
 			}
 			return nil
 		}(); pErr != nil {
@@ -420,6 +424,13 @@ func (tc *TxnCoordSender) Send(
 			br, pErr = tc.resendWithTxn(ba)
 		}
 
+		if _, ok := pErr.GetDetail().(*roachpb.AmbiguousResultError); ok && ba.Txn != nil {
+			if etArg, ok := ba.GetArg(roachpb.EndTransaction); ok &&
+				etArg.(*roachpb.EndTransactionRequest).Commit {
+				br, pErr = tc.probeAmbiguousCommit(ctx, ba, pErr)
+			}
+		}
+
 		if pErr = tc.updateState(ctx, startNS, ba, br, pErr); pErr != nil {
 			log.Eventf(ctx, "error: %s", pErr)
 			return nil, pErr
@@ -462,6 +473,39 @@ func (tc *TxnCoordSender) Send(
 	return br, nil
 }
 
+// sendAndRecord sends a batch with ReturnTrace set within a snowball trace
+// of its own, and merges the spans recorded by the TxnCoordSender with those
+// collected by the nodes into the response.
+func (tc *TxnCoordSender) sendAndRecord(
+	ctx context.Context, ba roachpb.BatchRequest,
+) (*roachpb.BatchResponse, *roachpb.Error) {
+	var recording struct {
+		syncutil.Mutex
+		spans [][]byte
+	}
+	sp, err := tracing.JoinOrNewSnowball(opTxnCoordSender, nil, func(rawSpan basictracer.RawSpan) {
+		encSp, err := tracing.EncodeRawSpan(&rawSpan, nil)
+		if err != nil {
+			log.Warning(ctx, err)
+			return
+		}
+		recording.Lock()
+		recording.spans = append(recording.spans, encSp)
+		recording.Unlock()
+	})
+	if err != nil {
+		return nil, roachpb.NewError(err)
+	}
+	br, pErr := tc.Send(opentracing.ContextWithSpan(ctx, sp), ba)
+	sp.Finish()
+	if br != nil {
+		recording.Lock()
+		br.CollectedSpans = append(recording.spans, br.CollectedSpans...)
+		recording.Unlock()
+	}
+	return br, pErr
+}
+
 // maybeRejectClientLocked checks whether the (transactional) request is in a
 // state that prevents it from continuing, such as the coordinator having
 // considered the client abandoned, or a heartbeat having reported an error.
@@ -590,7 +634,7 @@ func (tc *TxnCoordSender) unregisterTxnLocked(
 	restarts = int64(txnMeta.txn.Epoch)
 	status = txnMeta.txn.Status
 
-	txnMeta.keys = nil
+	txnMeta.keys.Clear()
 
 	delete(tc.txns, txnID)
 
@@ -671,8 +715,8 @@ func (tc *TxnCoordSender) tryAsyncAbort(txnID uuid.UUID) {
 	tc.Lock()
 	txnMeta := tc.txns[txnID]
 	// Clone the intents and the txn to avoid data races.
-	intentSpans, _ := roachpb.MergeSpans(append([]roachpb.Span(nil), txnMeta.keys...))
-	txnMeta.keys = nil
+	intentSpans := txnMeta.keys.Slice()
+	txnMeta.keys.Clear()
 	txn := txnMeta.txn.Clone()
 	tc.Unlock()
 
@@ -879,9 +923,6 @@ func (tc *TxnCoordSender) updateState(
 		// intents blocking concurrent writers for extended periods of time.
 		// See #3346.
 		var keys []roachpb.Span
-		if txnMeta != nil {
-			keys = txnMeta.keys
-		}
 		ba.IntentSpanIterate(br, func(key, endKey roachpb.Key) {
 			keys = append(keys, roachpb.Span{
 				Key:    key,
@@ -890,7 +931,7 @@ func (tc *TxnCoordSender) updateState(
 		})
 
 		if txnMeta != nil {
-			txnMeta.keys = keys
+			txnMeta.keys.Add(keys...)
 		} else if len(keys) > 0 {
 			if !newTxn.Writing {
 				panic("txn with intents marked as non-writing")
@@ -905,12 +946,12 @@ func (tc *TxnCoordSender) updateState(
 				log.Event(ctx, "coordinator spawns")
 				txnMeta = &txnMetadata{
 					txn:              newTxn,
-					keys:             keys,
 					firstUpdateNanos: startNS,
 					lastUpdateNanos:  tc.clock.PhysicalNow(),
 					timeoutDuration:  tc.clientTimeout,
 					txnEnd:           make(chan struct{}),
 				}
+				txnMeta.keys.Add(keys...)
 				tc.txns[txnID] = txnMeta
 
 				if err := tc.stopper.RunAsyncTask(ctx, func(ctx context.Context) {
@@ -963,6 +1004,56 @@ func (tc *TxnCoordSender) updateState(
 	return pErr
 }
 
+// probeAmbiguousCommit is called when a batch committing a transaction
+// returned an AmbiguousResultError. It queries the transaction record in an
+// attempt to resolve the ambiguity: a transaction which is found aborted
+// can't have been committed by the batch, and one which is found committed
+// was. In the latter case, a reply is synthesized if the batch consisted of
+// only the EndTransaction. Otherwise, the returned error carries the result
+// of the probe and the index of the EndTransaction, which is always the last
+// request of the batch.
+func (tc *TxnCoordSender) probeAmbiguousCommit(
+	ctx context.Context, ba roachpb.BatchRequest, pErr *roachpb.Error,
+) (*roachpb.BatchResponse, *roachpb.Error) {
+	ambErr := *pErr.GetDetail().(*roachpb.AmbiguousResultError)
+
+	var probeBa roachpb.BatchRequest
+	probeBa.Add(&roachpb.PushTxnRequest{
+		Span: roachpb.Span{
+			Key: ba.Txn.Key,
+		},
+		Now:       tc.clock.Now(),
+		PusheeTxn: ba.Txn.TxnMeta,
+		PushType:  roachpb.PUSH_QUERY,
+	})
+	log.Event(ctx, "probing txn record after ambiguous result")
+	if probeBr, probePErr := tc.wrapped.Send(ctx, probeBa); probePErr != nil {
+		log.Eventf(ctx, "unable to probe txn record: %s", probePErr)
+	} else {
+		ambErr.TxnProbed = true
+		if txn := probeBr.Responses[0].GetInner().(*roachpb.PushTxnResponse).PusheeTxn; txn.ID != nil {
+			ambErr.ProbedTxn = &txn
+			switch txn.Status {
+			case roachpb.ABORTED:
+				return nil, roachpb.NewErrorWithTxn(roachpb.NewTransactionAbortedError(), &txn)
+			case roachpb.COMMITTED:
+				if len(ba.Requests) == 1 {
+					br := &roachpb.BatchResponse{}
+					br.Add(&roachpb.EndTransactionResponse{})
+					br.Txn = &txn
+					return br, nil
+				}
+			}
+		}
+	}
+
+	newPErr := roachpb.NewError(&ambErr)
+	newPErr.OriginNode = pErr.OriginNode
+	newPErr.Now = pErr.Now
+	newPErr.SetErrorIndex(int32(len(ba.Requests) - 1))
+	return nil, newPErr
+}
+
 // TODO(tschottdorf): this method is somewhat awkward but unless we want to
 // give this error back to the client, our options are limited. We'll have to
 // run the whole thing for them, or any restart will still end up at the client
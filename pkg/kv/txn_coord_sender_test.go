@@ -263,8 +263,7 @@ func TestTxnCoordSenderKeyRanges(t *testing.T) {
 	if !ok {
 		t.Fatalf("expected a transaction to be created on coordinator")
 	}
-	keys, _ := roachpb.MergeSpans(txnMeta.keys)
-	if len(keys) != 2 {
+	if keys := txnMeta.keys.Slice(); len(keys) != 2 {
 		t.Errorf("expected 2 entries in keys range group; got %v", keys)
 	}
 }
@@ -505,7 +504,7 @@ func TestTxnCoordSenderAddIntentOnError(t *testing.T) {
 	}
 	sender.Lock()
 	txnID := *txn.Proto.ID
-	intentSpans, _ := roachpb.MergeSpans(sender.txns[txnID].keys)
+	intentSpans := sender.txns[txnID].keys.Slice()
 	expSpans := []roachpb.Span{{Key: key, EndKey: []byte("")}}
 	equal := !reflect.DeepEqual(intentSpans, expSpans)
 	sender.Unlock()
@@ -1037,6 +1036,102 @@ func TestTxnCoordSenderErrorWithIntent(t *testing.T) {
 	}
 }
 
+// TestTxnCoordSenderProbeAmbiguousCommit verifies that the coordinator probes
+// the transaction record when a commit returns an AmbiguousResultError, and
+// resolves the ambiguity if the record allows it.
+func TestTxnCoordSenderProbeAmbiguousCommit(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+	manual := hlc.NewManualClock(123)
+	clock := hlc.NewClock(manual.UnixNano, 20*time.Nanosecond)
+
+	testCases := []struct {
+		probeErr bool
+		status   *roachpb.TransactionStatus // nil if the record is not found
+		onlyET   bool
+		errMsg   string // empty if the commit is expected to succeed
+	}{
+		{probeErr: true, errMsg: `result is ambiguous \(test\)$`},
+		{errMsg: "txn record not found"},
+		{status: roachpb.PENDING.Enum(), errMsg: "txn record is PENDING"},
+		{status: roachpb.ABORTED.Enum(), errMsg: "txn aborted"},
+		{status: roachpb.COMMITTED.Enum(), errMsg: "txn record is COMMITTED"},
+		{status: roachpb.COMMITTED.Enum(), onlyET: true},
+	}
+	for i, test := range testCases {
+		func() {
+			senderFunc := func(_ context.Context, ba roachpb.BatchRequest) (*roachpb.BatchResponse, *roachpb.Error) {
+				if _, ok := ba.GetArg(roachpb.EndTransaction); ok {
+					return nil, roachpb.NewError(roachpb.NewAmbiguousResultError("test"))
+				}
+				br := ba.CreateReply()
+				if args, ok := ba.GetArg(roachpb.PushTxn); ok {
+					if test.probeErr {
+						return nil, roachpb.NewErrorf("probe failed")
+					}
+					if test.status != nil {
+						br.Responses[0].GetInner().(*roachpb.PushTxnResponse).PusheeTxn = roachpb.Transaction{
+							TxnMeta: args.(*roachpb.PushTxnRequest).PusheeTxn,
+							Status:  *test.status,
+						}
+					}
+					return br, nil
+				}
+				txnClone := ba.Txn.Clone()
+				br.Txn = &txnClone
+				br.Txn.Writing = true
+				return br, nil
+			}
+			ambient := log.AmbientContext{Tracer: tracing.NewTracer()}
+			ts := NewTxnCoordSender(
+				ambient,
+				senderFn(senderFunc),
+				clock,
+				false,
+				stopper,
+				MakeTxnMetrics(metric.TestSampleInterval),
+			)
+			defer teardownHeartbeats(ts)
+
+			var ba roachpb.BatchRequest
+			key := roachpb.Key("test")
+			ba.Add(&roachpb.BeginTransactionRequest{Span: roachpb.Span{Key: key}})
+			ba.Add(&roachpb.PutRequest{Span: roachpb.Span{Key: key}})
+			ba.Txn = &roachpb.Transaction{Name: "test"}
+			br, pErr := ts.Send(context.Background(), ba)
+			if pErr != nil {
+				t.Fatalf("%d: %s", i, pErr)
+			}
+
+			ba = roachpb.BatchRequest{}
+			if !test.onlyET {
+				ba.Add(&roachpb.PutRequest{Span: roachpb.Span{Key: key}})
+			}
+			ba.Add(&roachpb.EndTransactionRequest{Commit: true})
+			ba.Txn = br.Txn
+			br, pErr = ts.Send(context.Background(), ba)
+			if test.errMsg == "" {
+				if pErr != nil {
+					t.Fatalf("%d: unexpected error: %s", i, pErr)
+				}
+				if br.Txn.Status != roachpb.COMMITTED {
+					t.Errorf("%d: expected committed txn, got %s", i, br.Txn)
+				}
+				return
+			}
+			if !testutils.IsPError(pErr, test.errMsg) {
+				t.Fatalf("%d: error did not match %s: %v", i, test.errMsg, pErr)
+			}
+			if _, ok := pErr.GetDetail().(*roachpb.AmbiguousResultError); ok {
+				if pErr.Index == nil || int(pErr.Index.Index) != len(ba.Requests)-1 {
+					t.Errorf("%d: expected the index of the EndTransaction, got %v", i, pErr.Index)
+				}
+			}
+		}()
+	}
+}
+
 // TestTxnCoordSenderReleaseTxnMeta verifies that TxnCoordSender releases the
 // txnMetadata after the txn has committed successfully.
 func TestTxnCoordSenderReleaseTxnMeta(t *testing.T) {
@@ -162,6 +162,7 @@ func (rh *ResponseHeader) combine(otherRH ResponseHeader) error {
 	}
 	rh.ResumeSpan = otherRH.ResumeSpan
 	rh.NumKeys += otherRH.NumKeys
+	rh.NumBytes += otherRH.NumBytes
 	rh.RangeInfos = append(rh.RangeInfos, otherRH.RangeInfos...)
 	return nil
 }
@@ -448,6 +449,9 @@ func (*ComputeChecksumRequest) Method() Method { return ComputeChecksum }
 // Method implements the Request interface.
 func (*DeprecatedVerifyChecksumRequest) Method() Method { return Noop }
 
+// Method implements the Request interface.
+func (*QueryIntentRequest) Method() Method { return QueryIntent }
+
 // ShallowCopy implements the Request interface.
 func (gr *GetRequest) ShallowCopy() Request {
 	shallowCopy := *gr
@@ -628,6 +632,12 @@ func (dvcr *DeprecatedVerifyChecksumRequest) ShallowCopy() Request {
 	return &shallowCopy
 }
 
+// ShallowCopy implements the Request interface.
+func (qir *QueryIntentRequest) ShallowCopy() Request {
+	shallowCopy := *qir
+	return &shallowCopy
+}
+
 // NewGet returns a Request initialized to get the value at key.
 func NewGet(key Key) Request {
 	return &GetRequest{
@@ -838,5 +848,6 @@ func (*TransferLeaseRequest) flags() int {
 }
 func (*ComputeChecksumRequest) flags() int          { return isWrite | isNonKV | isRange }
 func (*DeprecatedVerifyChecksumRequest) flags() int { return isWrite }
+func (*QueryIntentRequest) flags() int              { return isRead | isTxn }
 func (*CheckConsistencyRequest) flags() int         { return isAdmin | isRange }
 func (*ChangeFrozenRequest) flags() int             { return isWrite | isRange | isNonKV }
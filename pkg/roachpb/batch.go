@@ -22,7 +22,10 @@ import (
 	"fmt"
 	"strings"
 
+	basictracer "github.com/opentracing/basictracer-go"
+
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/tracing"
 )
 
 //go:generate go run -tags gen-batch gen_batch.go
@@ -255,6 +258,18 @@ func (br *BatchResponse) Combine(otherBatch *BatchResponse) error {
 	return nil
 }
 
+// Recording decodes the trace spans collected while executing the batch,
+// which are returned for snowball traces and for batches with ReturnTrace set.
+func (br *BatchResponse) Recording() ([]basictracer.RawSpan, error) {
+	spans := make([]basictracer.RawSpan, len(br.CollectedSpans))
+	for i, encSp := range br.CollectedSpans {
+		if err := tracing.DecodeRawSpan(encSp, &spans[i]); err != nil {
+			return nil, err
+		}
+	}
+	return spans, nil
+}
+
 // Add adds a request to the batch request. It's a convenience method;
 // requests may also be added directly into the slice.
 func (ba *BatchRequest) Add(requests ...Request) {
@@ -7,7 +7,7 @@ import (
 	"fmt"
 )
 
-type reqCounts [30]int32
+type reqCounts [31]int32
 
 // getReqCounts returns the number of times each
 // request type appears in the batch.
@@ -75,6 +75,8 @@ func (ba *BatchRequest) getReqCounts() reqCounts {
 			counts[28]++
 		case r.LeaseInfo != nil:
 			counts[29]++
+		case r.QueryIntent != nil:
+			counts[30]++
 		default:
 			panic(fmt.Sprintf("unsupported request: %+v", r))
 		}
@@ -113,6 +115,7 @@ var requestNames = []string{
 	"ChangeFrozen",
 	"TransferLease",
 	"LeaseInfo",
+	"QueryIntent",
 }
 
 // Summary prints a short summary of the requests in a batch.
@@ -172,6 +175,7 @@ func (ba *BatchRequest) CreateReply() *BatchResponse {
 	var buf27 []ChangeFrozenResponse
 	var buf28 []RequestLeaseResponse
 	var buf29 []LeaseInfoResponse
+	var buf30 []QueryIntentResponse
 
 	for i, r := range ba.Requests {
 		switch {
@@ -355,6 +359,12 @@ func (ba *BatchRequest) CreateReply() *BatchResponse {
 			}
 			br.Responses[i].LeaseInfo = &buf29[0]
 			buf29 = buf29[1:]
+		case r.QueryIntent != nil:
+			if buf30 == nil {
+				buf30 = make([]QueryIntentResponse, counts[30])
+			}
+			br.Responses[i].QueryIntent = &buf30[0]
+			buf30 = buf30[1:]
 		default:
 			panic(fmt.Sprintf("unsupported request: %+v", r))
 		}
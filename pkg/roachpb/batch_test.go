@@ -20,6 +20,10 @@ package roachpb
 import (
 	"reflect"
 	"testing"
+
+	basictracer "github.com/opentracing/basictracer-go"
+
+	"github.com/cockroachdb/cockroach/pkg/util/tracing"
 )
 
 func TestBatchSplit(t *testing.T) {
@@ -212,3 +216,40 @@ func TestIntentSpanIterate(t *testing.T) {
 		t.Fatalf("unexpected spans: e = %+v, found = %+v", e, spans[0])
 	}
 }
+
+func TestBatchResponseRecording(t *testing.T) {
+	var brs [2]BatchResponse
+	for i, op := range []string{"a", "b"} {
+		encSp, err := tracing.EncodeRawSpan(&basictracer.RawSpan{
+			Context:   basictracer.SpanContext{TraceID: 1, SpanID: uint64(i + 1)},
+			Operation: op,
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		brs[i].CollectedSpans = [][]byte{encSp}
+	}
+	if err := brs[0].Combine(&brs[1]); err != nil {
+		t.Fatal(err)
+	}
+	spans, err := brs[0].Recording()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spans) != 2 || spans[0].Operation != "a" || spans[1].Operation != "b" {
+		t.Errorf("unexpected recording %+v", spans)
+	}
+
+	// The header flag requesting the recording survives the wire.
+	data, err := (&Header{ReturnTrace: true}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var h Header
+	if err := h.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if !h.ReturnTrace {
+		t.Errorf("expected ReturnTrace to be set")
+	}
+}
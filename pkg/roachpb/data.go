@@ -1000,6 +1000,79 @@ func (s Span) Overlaps(o Span) bool {
 	return bytes.Compare(s.EndKey, o.Key) > 0 && bytes.Compare(s.Key, o.EndKey) < 0
 }
 
+// exclusiveEndKey returns the exclusive end key of the span, which for a
+// span containing a single key is the key's successor.
+func (s Span) exclusiveEndKey() Key {
+	if len(s.EndKey) == 0 {
+		return s.Key.Next()
+	}
+	return s.EndKey
+}
+
+// Contains returns whether the span contains all of the keys of the given
+// span.
+func (s Span) Contains(o Span) bool {
+	return s.Key.Compare(o.Key) <= 0 && o.exclusiveEndKey().Compare(s.exclusiveEndKey()) <= 0
+}
+
+// Combine returns the smallest span containing both spans. If the spans are
+// disjoint, this includes the keys between them.
+func (s Span) Combine(o Span) Span {
+	if len(s.EndKey) == 0 && len(o.EndKey) == 0 && s.Key.Equal(o.Key) {
+		return s
+	}
+	key, endKey := s.Key, s.exclusiveEndKey()
+	if o.Key.Compare(key) < 0 {
+		key = o.Key
+	}
+	if oEndKey := o.exclusiveEndKey(); oEndKey.Compare(endKey) > 0 {
+		endKey = oEndKey
+	}
+	return Span{Key: key, EndKey: endKey}
+}
+
+// Intersect returns the keys contained in both spans, along with whether
+// the spans overlap at all.
+func (s Span) Intersect(o Span) (Span, bool) {
+	if !s.Overlaps(o) {
+		return Span{}, false
+	}
+	// A span containing a single key is contained in any span it overlaps.
+	if len(s.EndKey) == 0 {
+		return s, true
+	}
+	if len(o.EndKey) == 0 {
+		return o, true
+	}
+	key, endKey := s.Key, s.EndKey
+	if o.Key.Compare(key) > 0 {
+		key = o.Key
+	}
+	if o.EndKey.Compare(endKey) < 0 {
+		endKey = o.EndKey
+	}
+	return Span{Key: key, EndKey: endKey}, true
+}
+
+// Subtract returns the keys of the span which aren't contained in the given
+// span, as up to two spans in key order.
+func (s Span) Subtract(o Span) []Span {
+	if !s.Overlaps(o) {
+		return []Span{s}
+	}
+	if len(s.EndKey) == 0 {
+		return nil
+	}
+	var spans []Span
+	if s.Key.Compare(o.Key) < 0 {
+		spans = append(spans, Span{Key: s.Key, EndKey: o.Key})
+	}
+	if oEndKey := o.exclusiveEndKey(); oEndKey.Compare(s.EndKey) < 0 {
+		spans = append(spans, Span{Key: oEndKey, EndKey: s.EndKey})
+	}
+	return spans
+}
+
 // Spans is a slice of spans.
 type Spans []Span
 
@@ -607,6 +607,126 @@ func TestSpanOverlaps(t *testing.T) {
 	}
 }
 
+func TestSpanContains(t *testing.T) {
+	sA := Span{Key: []byte("a")}
+	sB := Span{Key: []byte("b")}
+	sAtoC := Span{Key: []byte("a"), EndKey: []byte("c")}
+	sBtoC := Span{Key: []byte("b"), EndKey: []byte("c")}
+	sBtoD := Span{Key: []byte("b"), EndKey: []byte("d")}
+
+	testData := []struct {
+		s1, s2   Span
+		contains bool
+	}{
+		{sA, sA, true},
+		{sA, sB, false},
+		{sA, sAtoC, false},
+		{sAtoC, sA, true},
+		{sAtoC, sB, true},
+		{sBtoD, sA, false},
+		{sAtoC, sAtoC, true},
+		{sAtoC, sBtoC, true},
+		{sBtoC, sAtoC, false},
+		{sAtoC, sBtoD, false},
+		{sBtoD, sBtoC, true},
+	}
+	for i, test := range testData {
+		if c := test.s1.Contains(test.s2); c != test.contains {
+			t.Errorf("%d: expected %s contains %s to be %t; got %t", i, test.s1, test.s2, test.contains, c)
+		}
+	}
+}
+
+func TestSpanCombine(t *testing.T) {
+	sA := Span{Key: []byte("a")}
+	sB := Span{Key: []byte("b")}
+	sAtoC := Span{Key: []byte("a"), EndKey: []byte("c")}
+	sBtoD := Span{Key: []byte("b"), EndKey: []byte("d")}
+	sEtoF := Span{Key: []byte("e"), EndKey: []byte("f")}
+
+	testData := []struct {
+		s1, s2, expected Span
+	}{
+		{sA, sA, sA},
+		{sA, sB, Span{Key: []byte("a"), EndKey: []byte("b\x00")}},
+		{sB, sA, Span{Key: []byte("a"), EndKey: []byte("b\x00")}},
+		{sA, sAtoC, sAtoC},
+		{sB, sAtoC, sAtoC},
+		{sAtoC, sBtoD, Span{Key: []byte("a"), EndKey: []byte("d")}},
+		{sBtoD, sAtoC, Span{Key: []byte("a"), EndKey: []byte("d")}},
+		{sAtoC, sEtoF, Span{Key: []byte("a"), EndKey: []byte("f")}},
+		{sEtoF, sB, Span{Key: []byte("b"), EndKey: []byte("f")}},
+	}
+	for i, test := range testData {
+		if c := test.s1.Combine(test.s2); !c.Equal(test.expected) {
+			t.Errorf("%d: expected %s combined with %s to be %s; got %s", i, test.s1, test.s2, test.expected, c)
+		}
+	}
+}
+
+func TestSpanIntersect(t *testing.T) {
+	sA := Span{Key: []byte("a")}
+	sB := Span{Key: []byte("b")}
+	sAtoC := Span{Key: []byte("a"), EndKey: []byte("c")}
+	sBtoD := Span{Key: []byte("b"), EndKey: []byte("d")}
+	sCtoD := Span{Key: []byte("c"), EndKey: []byte("d")}
+
+	testData := []struct {
+		s1, s2   Span
+		expected Span
+		overlaps bool
+	}{
+		{sA, sA, sA, true},
+		{sA, sB, Span{}, false},
+		{sA, sAtoC, sA, true},
+		{sAtoC, sB, sB, true},
+		{sA, sBtoD, Span{}, false},
+		{sAtoC, sBtoD, Span{Key: []byte("b"), EndKey: []byte("c")}, true},
+		{sBtoD, sAtoC, Span{Key: []byte("b"), EndKey: []byte("c")}, true},
+		{sAtoC, sCtoD, Span{}, false},
+		{sBtoD, sCtoD, sCtoD, true},
+	}
+	for i, test := range testData {
+		is, ok := test.s1.Intersect(test.s2)
+		if ok != test.overlaps || !is.Equal(test.expected) {
+			t.Errorf("%d: expected intersection of %s and %s to be %s (%t); got %s (%t)",
+				i, test.s1, test.s2, test.expected, test.overlaps, is, ok)
+		}
+	}
+}
+
+func TestSpanSubtract(t *testing.T) {
+	sA := Span{Key: []byte("a")}
+	sB := Span{Key: []byte("b")}
+	sAtoC := Span{Key: []byte("a"), EndKey: []byte("c")}
+	sAtoD := Span{Key: []byte("a"), EndKey: []byte("d")}
+	sBtoC := Span{Key: []byte("b"), EndKey: []byte("c")}
+	sBtoD := Span{Key: []byte("b"), EndKey: []byte("d")}
+	sCtoD := Span{Key: []byte("c"), EndKey: []byte("d")}
+
+	testData := []struct {
+		s1, s2   Span
+		expected []Span
+	}{
+		{sA, sA, nil},
+		{sA, sB, []Span{sA}},
+		{sA, sAtoC, nil},
+		{sB, sAtoC, nil},
+		{sAtoC, sA, []Span{{Key: []byte("a\x00"), EndKey: []byte("c")}}},
+		{sAtoC, sB, []Span{{Key: []byte("a"), EndKey: []byte("b")}, {Key: []byte("b\x00"), EndKey: []byte("c")}}},
+		{sAtoC, sCtoD, []Span{sAtoC}},
+		{sAtoC, sBtoD, []Span{{Key: []byte("a"), EndKey: []byte("b")}}},
+		{sBtoD, sAtoC, []Span{sCtoD}},
+		{sAtoD, sBtoC, []Span{{Key: []byte("a"), EndKey: []byte("b")}, sCtoD}},
+		{sBtoC, sAtoD, nil},
+	}
+	for i, test := range testData {
+		if spans := test.s1.Subtract(test.s2); !reflect.DeepEqual(spans, test.expected) {
+			t.Errorf("%d: expected %s minus %s to be %s; got %s", i, test.s1, test.s2, test.expected, spans)
+		}
+	}
+}
+
 // TestRSpanContains verifies methods to check whether a key
 // or key range is contained within the span.
 func TestRSpanContains(t *testing.T) {
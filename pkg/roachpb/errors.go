@@ -359,7 +359,13 @@ func (e *AmbiguousResultError) Error() string {
 }
 
 func (e *AmbiguousResultError) message(_ *Error) string {
-	return fmt.Sprintf("result is ambiguous (%s)", e.Message)
+	if !e.TxnProbed {
+		return fmt.Sprintf("result is ambiguous (%s)", e.Message)
+	}
+	if e.ProbedTxn == nil {
+		return fmt.Sprintf("result is ambiguous (%s); txn record not found", e.Message)
+	}
+	return fmt.Sprintf("result is ambiguous (%s); txn record is %s", e.Message, e.ProbedTxn.Status)
 }
 
 var _ ErrorDetailInterface = &AmbiguousResultError{}
@@ -121,4 +121,6 @@ const (
 	// ChangeFrozen freezes or unfreezes all Ranges with StartKey in a given
 	// key span.
 	ChangeFrozen
+	// QueryIntent checks whether the specified intent exists.
+	QueryIntent
 )
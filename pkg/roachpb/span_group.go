@@ -0,0 +1,132 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package roachpb
+
+import (
+	"bytes"
+
+	"github.com/cockroachdb/cockroach/pkg/util/interval"
+)
+
+// A SpanGroup is a specialization of interval.RangeGroup which deals with key
+// spans, merging overlapping and adjacent spans as they're added. The zero
+// value of a SpanGroup is an empty group ready to use.
+//
+// A SpanGroup is not safe for concurrent use.
+type SpanGroup struct {
+	rg interval.RangeGroup
+}
+
+func (g *SpanGroup) checkInit() {
+	if g.rg == nil {
+		g.rg = interval.NewRangeTree()
+	}
+}
+
+// Add adds the spans to the group, returning whether this increased the
+// keys covered by the group.
+func (g *SpanGroup) Add(spans ...Span) bool {
+	if len(spans) == 0 {
+		return false
+	}
+	g.checkInit()
+	added := false
+	for _, span := range spans {
+		added = g.rg.Add(s2r(span)) || added
+	}
+	return added
+}
+
+// Sub removes the spans from the group, returning whether this decreased the
+// keys covered by the group.
+func (g *SpanGroup) Sub(spans ...Span) bool {
+	if g.rg == nil {
+		return false
+	}
+	removed := false
+	for _, span := range spans {
+		removed = g.rg.Sub(s2r(span)) || removed
+	}
+	return removed
+}
+
+// Clear removes all spans from the group.
+func (g *SpanGroup) Clear() {
+	if g.rg != nil {
+		g.rg.Clear()
+	}
+}
+
+// Contains returns whether the key is covered by the group.
+func (g *SpanGroup) Contains(key Key) bool {
+	return g.Encloses(Span{Key: key})
+}
+
+// Encloses returns whether all of the keys of the spans are covered by the
+// group.
+func (g *SpanGroup) Encloses(spans ...Span) bool {
+	for _, span := range spans {
+		if g.rg == nil || !g.rg.Encloses(s2r(span)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Overlaps returns whether any of the keys of the span are covered by the
+// group.
+func (g *SpanGroup) Overlaps(span Span) bool {
+	return g.rg != nil && g.rg.Overlaps(s2r(span))
+}
+
+// Len returns the number of disjoint spans in the group.
+func (g *SpanGroup) Len() int {
+	if g.rg == nil {
+		return 0
+	}
+	return g.rg.Len()
+}
+
+// Slice returns the disjoint spans of the group in key order.
+func (g *SpanGroup) Slice() []Span {
+	if g.Len() == 0 {
+		return nil
+	}
+	spans := make([]Span, 0, g.rg.Len())
+	_ = g.rg.ForEach(func(r interval.Range) error {
+		spans = append(spans, r2s(r))
+		return nil
+	})
+	return spans
+}
+
+// s2r converts a span to a range. Since interval.Comparable and Key are both
+// byte slices, only the end key of spans containing a single key needs to be
+// filled in.
+func s2r(s Span) interval.Range {
+	return interval.Range{
+		Start: interval.Comparable(s.Key),
+		End:   interval.Comparable(s.exclusiveEndKey()),
+	}
+}
+
+// r2s converts a range to a span. Ranges containing a single key are
+// converted back into spans with an empty end key.
+func r2s(r interval.Range) Span {
+	if bytes.Equal(r.End, Key(r.Start).Next()) {
+		return Span{Key: Key(r.Start)}
+	}
+	return Span{Key: Key(r.Start), EndKey: Key(r.End)}
+}
@@ -0,0 +1,96 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package roachpb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSpanGroup(t *testing.T) {
+	var g SpanGroup
+
+	be := Span{Key: Key("b"), EndKey: Key("e")}
+	if g.Len() != 0 || g.Slice() != nil || g.Contains(Key("b")) || g.Overlaps(be) {
+		t.Fatalf("expected empty group, got %v", g.Slice())
+	}
+	if g.Sub(be) {
+		t.Errorf("expected subtraction from an empty group to be a no-op")
+	}
+
+	if !g.Add(be) {
+		t.Errorf("expected %s to be added", be)
+	}
+	if g.Add(Span{Key: Key("c"), EndKey: Key("d")}) {
+		t.Errorf("expected an enclosed span to not be added")
+	}
+	if !g.Add(Span{Key: Key("a")}, Span{Key: Key("e"), EndKey: Key("f")}) {
+		t.Errorf("expected spans to be added")
+	}
+	if !g.Add(Span{Key: Key("x")}) {
+		t.Errorf("expected key to be added")
+	}
+	exp := []Span{
+		{Key: Key("a")},
+		{Key: Key("b"), EndKey: Key("f")},
+		{Key: Key("x")},
+	}
+	if spans := g.Slice(); !reflect.DeepEqual(spans, exp) {
+		t.Fatalf("expected %v, got %v", exp, spans)
+	}
+	if g.Len() != len(exp) {
+		t.Errorf("expected %d spans, got %d", len(exp), g.Len())
+	}
+
+	for _, key := range []string{"a", "b", "c", "e", "ee", "x"} {
+		if !g.Contains(Key(key)) {
+			t.Errorf("expected %q to be contained", key)
+		}
+	}
+	for _, key := range []string{"", "a\x00", "f", "w", "x\x00"} {
+		if g.Contains(Key(key)) {
+			t.Errorf("expected %q to not be contained", key)
+		}
+	}
+	if !g.Encloses(Span{Key: Key("b"), EndKey: Key("f")}, Span{Key: Key("x")}) {
+		t.Errorf("expected spans to be enclosed")
+	}
+	if g.Encloses(Span{Key: Key("a"), EndKey: Key("c")}) {
+		t.Errorf("expected span across a gap to not be enclosed")
+	}
+	if !g.Overlaps(Span{Key: Key("a"), EndKey: Key("c")}) {
+		t.Errorf("expected span to overlap")
+	}
+	if g.Overlaps(Span{Key: Key("f"), EndKey: Key("x")}) {
+		t.Errorf("expected span to not overlap")
+	}
+
+	if !g.Sub(Span{Key: Key("c"), EndKey: Key("d")}, Span{Key: Key("x")}) {
+		t.Errorf("expected spans to be removed")
+	}
+	exp = []Span{
+		{Key: Key("a")},
+		{Key: Key("b"), EndKey: Key("c")},
+		{Key: Key("d"), EndKey: Key("f")},
+	}
+	if spans := g.Slice(); !reflect.DeepEqual(spans, exp) {
+		t.Fatalf("expected %v, got %v", exp, spans)
+	}
+
+	g.Clear()
+	if g.Len() != 0 || g.Contains(Key("a")) {
+		t.Errorf("expected empty group, got %v", g.Slice())
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package rpc
+
+import (
+	"strings"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+
+	"github.com/cockroachdb/cockroach/pkg/security"
+)
+
+// nodeServices are the gRPC services which only other nodes are allowed to
+// call. Clients presenting a valid certificate for any other user are
+// rejected.
+var nodeServices = map[string]struct{}{
+	"cockroach.roachpb.Internal":    {},
+	"cockroach.storage.MultiRaft":   {},
+	"cockroach.storage.Consistency": {},
+	"cockroach.storage.Freeze":      {},
+}
+
+// serviceName returns the service of a full gRPC method name of the form
+// "/package.Service/Method".
+func serviceName(fullMethod string) string {
+	name := strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// authorize returns an error if the method belongs to one of the node
+// services and the peer of the call did not present a node certificate.
+func authorize(ctx context.Context, fullMethod string) error {
+	if _, ok := nodeServices[serviceName(fullMethod)]; !ok {
+		return nil
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return grpc.Errorf(codes.Unauthenticated, "%s: no peer information", fullMethod)
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return grpc.Errorf(codes.Unauthenticated, "%s: connection is not using TLS", fullMethod)
+	}
+	if err := security.CheckNodeCertificate(&tlsInfo.State); err != nil {
+		return grpc.Errorf(codes.PermissionDenied, "%s: %s", fullMethod, err)
+	}
+	return nil
+}
+
+// unaryAuthInterceptor is a grpc.UnaryServerInterceptor which enforces the
+// certificate roles of unary RPCs.
+func unaryAuthInterceptor(
+	ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if err := authorize(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// streamAuthInterceptor is a grpc.StreamServerInterceptor which enforces
+// the certificate roles of streaming RPCs.
+func streamAuthInterceptor(
+	srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler,
+) error {
+	if err := authorize(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
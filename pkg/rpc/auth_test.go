@@ -0,0 +1,93 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package rpc
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/security"
+	"github.com/cockroachdb/cockroach/pkg/testutils"
+	"github.com/cockroachdb/cockroach/pkg/util"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/netutil"
+	"github.com/cockroachdb/cockroach/pkg/util/stop"
+)
+
+func TestServiceName(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	for _, tc := range []struct {
+		fullMethod, expected string
+	}{
+		{"/cockroach.roachpb.Internal/Batch", "cockroach.roachpb.Internal"},
+		{"/cockroach.storage.MultiRaft/RaftMessage", "cockroach.storage.MultiRaft"},
+		{"cockroach.rpc.Heartbeat", "cockroach.rpc.Heartbeat"},
+	} {
+		if name := serviceName(tc.fullMethod); name != tc.expected {
+			t.Errorf("%s: expected %s, got %s", tc.fullMethod, tc.expected, name)
+		}
+	}
+}
+
+// TestNodeServicesAuth verifies that only nodes may call the node services,
+// while other services remain available to clients.
+func TestNodeServicesAuth(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+
+	clock := hlc.NewClock(time.Unix(0, 1).UnixNano, time.Nanosecond)
+	serverCtx := newNodeTestContext(clock, stopper)
+	s := NewServer(serverCtx)
+	roachpb.RegisterInternalServer(s, &mutatingInternalServer{})
+	ln, err := netutil.ListenAndServeGRPC(stopper, s, util.TestAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remoteAddr := ln.Addr().String()
+
+	for _, tc := range []struct {
+		user    string
+		expCode codes.Code
+	}{
+		{security.NodeUser, codes.OK},
+		{security.RootUser, codes.PermissionDenied},
+	} {
+		clientCtx := NewContext(
+			log.AmbientContext{}, testutils.NewTestBaseContext(tc.user), clock, stopper)
+		conn, err := clientCtx.GRPCDial(remoteAddr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The heartbeat service is not restricted.
+		if _, err := NewHeartbeatClient(conn).Ping(context.Background(), &PingRequest{}); err != nil {
+			t.Errorf("%s: unexpected heartbeat error: %v", tc.user, err)
+		}
+		_, err = roachpb.NewInternalClient(conn).Batch(context.Background(), &roachpb.BatchRequest{})
+		if code := grpc.Code(err); code != tc.expCode {
+			t.Errorf("%s: expected code %s, got %v", tc.user, tc.expCode, err)
+		}
+	}
+}
@@ -23,7 +23,9 @@ import (
 	"github.com/facebookgo/clock"
 	"github.com/rubyist/circuitbreaker"
 
+	"github.com/cockroachdb/cockroach/pkg/util/envutil"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/metric"
 )
 
 const maxBackoff = time.Second
@@ -66,25 +68,61 @@ func (c *breakerClock) Timer(d time.Duration) *clock.Timer {
 
 var _ clock.Clock = &breakerClock{}
 
+// BreakerOptions configures the circuit breakers created by
+// Context.NewBreaker.
+type BreakerOptions struct {
+	// Threshold is the number of consecutive failures which trip a breaker.
+	Threshold int64
+	// While tripped, a breaker lets a single probe through (it is
+	// "half-open") each time its backoff expires. A successful probe resets
+	// the breaker, while a failed probe extends the backoff. The backoff
+	// starts at InitialBackoff and grows by Multiplier up to MaxBackoff.
+	// Each backoff is randomized by up to RandomizationFactor in either
+	// direction.
+	InitialBackoff      time.Duration
+	MaxBackoff          time.Duration
+	Multiplier          float64
+	RandomizationFactor float64
+}
+
+// DefaultBreakerOptions returns the default options for circuit breakers,
+// which can be overridden through environment variables.
+//
+// The default backoff limits the circuit breaker to 1 second intervals
+// between successive attempts to resolve a node address and connect via
+// GRPC.
+//
+// NB (nota Ben): MaxBackoff should be less than the Raft election timeout
+// (1.5s) to avoid disruptions. A newly restarted node will be in follower
+// mode with no knowledge of the Raft leader. If it doesn't hear from a
+// leader before the election timeout expires, it will start to campaign,
+// which can be disruptive. Therefore the leader needs to get in touch (via
+// Raft heartbeats) with such nodes within one election timeout of their
+// restart, which won't happen if their backoff is too high.
+func DefaultBreakerOptions() BreakerOptions {
+	return BreakerOptions{
+		Threshold:           defaultBreakerThreshold,
+		InitialBackoff:      defaultBreakerInitialBackoff,
+		MaxBackoff:          defaultBreakerMaxBackoff,
+		Multiplier:          1.5,
+		RandomizationFactor: 0.5,
+	}
+}
+
+var (
+	defaultBreakerThreshold      = envutil.EnvOrDefaultInt64("COCKROACH_RPC_BREAKER_THRESHOLD", 1)
+	defaultBreakerInitialBackoff = envutil.EnvOrDefaultDuration("COCKROACH_RPC_BREAKER_INITIAL_BACKOFF", 500*time.Millisecond)
+	defaultBreakerMaxBackoff     = envutil.EnvOrDefaultDuration("COCKROACH_RPC_BREAKER_MAX_BACKOFF", maxBackoff)
+)
+
 // newBackOff creates a new exponential backoff properly configured for RPC
 // connection backoff.
-func newBackOff(clock backoff.Clock) backoff.BackOff {
-	// This exponential backoff limits the circuit breaker to 1 second
-	// intervals between successive attempts to resolve a node address
-	// and connect via GRPC.
-	//
-	// NB (nota Ben): MaxInterval should be less than the Raft election timeout
-	// (1.5s) to avoid disruptions. A newly restarted node will be in follower
-	// mode with no knowledge of the Raft leader. If it doesn't hear from a
-	// leader before the election timeout expires, it will start to campaign,
-	// which can be disruptive. Therefore the leader needs to get in touch (via
-	// Raft heartbeats) with such nodes within one election timeout of their
-	// restart, which won't happen if their backoff is too high.
+func newBackOff(clock backoff.Clock, opts BreakerOptions) backoff.BackOff {
 	b := &backoff.ExponentialBackOff{
-		InitialInterval:     500 * time.Millisecond,
-		RandomizationFactor: 0.5,
-		Multiplier:          1.5,
-		MaxInterval:         maxBackoff,
+		InitialInterval:     opts.InitialBackoff,
+		RandomizationFactor: opts.RandomizationFactor,
+		Multiplier:          opts.Multiplier,
+		MaxInterval:         opts.MaxBackoff,
 		MaxElapsedTime:      0,
 		Clock:               clock,
 	}
@@ -92,10 +130,109 @@ func newBackOff(clock backoff.Clock) backoff.BackOff {
 	return b
 }
 
-func newBreaker(clock clock.Clock) *circuit.Breaker {
+func newBreaker(clock clock.Clock, opts BreakerOptions) *circuit.Breaker {
 	return circuit.NewBreakerWithOptions(&circuit.Options{
-		BackOff:    newBackOff(clock),
+		BackOff:    newBackOff(clock, opts),
 		Clock:      clock,
-		ShouldTrip: circuit.ThresholdTripFunc(1),
+		ShouldTrip: circuit.ThresholdTripFunc(opts.Threshold),
 	})
 }
+
+// breakerMetricsInterval is the interval at which the breaker metrics are
+// updated.
+const breakerMetricsInterval = 10 * time.Second
+
+// BreakerMetrics is the collection of metrics for the circuit breakers of
+// a context.
+type BreakerMetrics struct {
+	Tripped *metric.Gauge
+}
+
+var metaBreakersTripped = metric.Metadata{
+	Name: "rpc.breakers.tripped",
+	Help: "Number of tripped circuit breakers to peers"}
+
+func makeBreakerMetrics() BreakerMetrics {
+	return BreakerMetrics{
+		Tripped: metric.NewGauge(metaBreakersTripped),
+	}
+}
+
+var (
+	metaPeerBreakerTripped = metric.Metadata{
+		Name: "rpc.breaker.tripped",
+		Help: "Whether the circuit breaker to a peer is tripped"}
+	metaPeerBreakerConsecutiveFailures = metric.Metadata{
+		Name: "rpc.breaker.consecutive-failures",
+		Help: "Number of consecutive failures seen by the circuit breaker to a peer"}
+)
+
+// peerBreaker is a circuit breaker tracked by a context, along with its
+// metrics.
+type peerBreaker struct {
+	breaker             *circuit.Breaker
+	tripped             *metric.Gauge
+	consecutiveFailures *metric.Gauge
+}
+
+// makePeerBreaker creates the metrics of the named circuit breaker. They
+// carry the name as a label.
+func makePeerBreaker(name string, breaker *circuit.Breaker) peerBreaker {
+	tripped := metaPeerBreakerTripped
+	tripped.AddLabel("peer", name)
+	consecutiveFailures := metaPeerBreakerConsecutiveFailures
+	consecutiveFailures.AddLabel("peer", name)
+	return peerBreaker{
+		breaker:             breaker,
+		tripped:             metric.NewGauge(tripped),
+		consecutiveFailures: metric.NewGauge(consecutiveFailures),
+	}
+}
+
+// BreakerMetrics returns the aggregate metrics for the circuit breakers
+// created by the context.
+func (ctx *Context) BreakerMetrics() *BreakerMetrics {
+	return &ctx.breakerMetrics
+}
+
+// PeerBreakerRegistry returns the registry holding the metrics of the
+// circuit breakers created by NewBreaker. The metrics are distinguished by
+// a label rather than by name, so they are meant to be exported to
+// prometheus only.
+func (ctx *Context) PeerBreakerRegistry() *metric.Registry {
+	return ctx.breakers.registry
+}
+
+// RemoveBreaker stops tracking the circuit breaker, which was created by
+// NewBreaker, and removes its metrics. It is called once the peer of the
+// breaker has been removed from the cluster.
+func (ctx *Context) RemoveBreaker(breaker *circuit.Breaker) {
+	ctx.breakers.Lock()
+	defer ctx.breakers.Unlock()
+	for i, pb := range ctx.breakers.tracked {
+		if pb.breaker == breaker {
+			ctx.breakers.registry.RemoveMetric(pb.tripped)
+			ctx.breakers.registry.RemoveMetric(pb.consecutiveFailures)
+			ctx.breakers.tracked = append(ctx.breakers.tracked[:i], ctx.breakers.tracked[i+1:]...)
+			return
+		}
+	}
+}
+
+// updateBreakerMetrics updates the metrics of all circuit breakers created
+// by the context.
+func (ctx *Context) updateBreakerMetrics() {
+	ctx.breakers.Lock()
+	defer ctx.breakers.Unlock()
+	var tripped int64
+	for _, pb := range ctx.breakers.tracked {
+		if pb.breaker.Tripped() {
+			pb.tripped.Update(1)
+			tripped++
+		} else {
+			pb.tripped.Update(0)
+		}
+		pb.consecutiveFailures.Update(pb.breaker.ConsecFailures())
+	}
+	ctx.breakerMetrics.Tripped.Update(tripped)
+}
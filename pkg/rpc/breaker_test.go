@@ -0,0 +1,103 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package rpc
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/metric"
+	"github.com/cockroachdb/cockroach/pkg/util/stop"
+)
+
+// TestBreakerOptions verifies that the breakers created by a context trip
+// after the configured number of failures, and that their state is
+// reflected in the breaker metrics.
+func TestBreakerOptions(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+
+	clock := hlc.NewClock(time.Unix(0, 1).UnixNano, time.Nanosecond)
+	ctx := newNodeTestContext(clock, stopper)
+	ctx.Breaker.Threshold = 3
+
+	breaker := ctx.NewBreaker("peer")
+	if other := ctx.NewBreaker("other"); other.Tripped() {
+		t.Fatal("expected new breaker not to be tripped")
+	}
+	for i := int64(1); i <= ctx.Breaker.Threshold; i++ {
+		if breaker.Tripped() {
+			t.Fatalf("%d: expected breaker not to be tripped", i)
+		}
+		breaker.Fail()
+	}
+	if !breaker.Tripped() {
+		t.Fatal("expected breaker to be tripped")
+	}
+
+	ctx.updateBreakerMetrics()
+	if v := ctx.BreakerMetrics().Tripped.Value(); v != 1 {
+		t.Errorf("expected 1 tripped breaker, got %d", v)
+	}
+	gauges := peerBreakerGauges(ctx)
+	for name, expected := range map[string]int64{
+		"rpc.breaker.tripped{peer=peer}":              1,
+		"rpc.breaker.consecutive-failures{peer=peer}": ctx.Breaker.Threshold,
+		"rpc.breaker.tripped{peer=other}":             0,
+	} {
+		if g, ok := gauges[name]; !ok {
+			t.Errorf("expected metric %s to be registered", name)
+		} else if v := g.Value(); v != expected {
+			t.Errorf("expected %s to be %d, got %d", name, expected, v)
+		}
+	}
+
+	breaker.Reset()
+	ctx.updateBreakerMetrics()
+	if v := ctx.BreakerMetrics().Tripped.Value(); v != 0 {
+		t.Errorf("expected no tripped breakers, got %d", v)
+	}
+
+	// The metrics of removed breakers are unregistered.
+	ctx.RemoveBreaker(breaker)
+	gauges = peerBreakerGauges(ctx)
+	if _, ok := gauges["rpc.breaker.tripped{peer=peer}"]; ok {
+		t.Error("expected metrics of removed breaker to be unregistered")
+	}
+	if _, ok := gauges["rpc.breaker.tripped{peer=other}"]; !ok {
+		t.Error("expected metrics of other breaker to remain registered")
+	}
+}
+
+// peerBreakerGauges returns the gauges of the peer breaker registry of the
+// context, keyed by name and peer label.
+func peerBreakerGauges(ctx *Context) map[string]*metric.Gauge {
+	gauges := map[string]*metric.Gauge{}
+	ctx.PeerBreakerRegistry().Each(func(name string, val interface{}) {
+		if g, ok := val.(*metric.Gauge); ok {
+			for _, l := range g.GetLabels() {
+				if l.GetName() == "peer" {
+					gauges[fmt.Sprintf("%s{peer=%s}", name, l.GetValue())] = g
+				}
+			}
+		}
+	})
+	return gauges
+}
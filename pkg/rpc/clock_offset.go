@@ -50,6 +50,9 @@ type RemoteClockMonitor struct {
 	mu struct {
 		syncutil.Mutex
 		offsets map[string]RemoteOffset
+		// fenceErr is the error returned by the most recent call to
+		// VerifyClockOffset.
+		fenceErr error
 	}
 
 	metrics RemoteClockMetrics
@@ -122,8 +125,33 @@ func (r *RemoteClockMonitor) UpdateOffset(addr string, offset RemoteOffset) {
 // is healthy (as defined by RemoteOffset.isHealthy). It returns nil iff more
 // than half the known offsets are healthy, and an error otherwise. A non-nil
 // return indicates that this node's clock is unreliable, and that the node
-// should terminate.
+// should terminate or at least stop serving writes until the offsets are
+// healthy again. The result is also made available through Fenced.
 func (r *RemoteClockMonitor) VerifyClockOffset() error {
+	err := r.verifyClockOffset()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil && r.mu.fenceErr == nil {
+		log.Warningf(r.ctx, "clock offset verification failed: %s", err)
+	} else if err == nil && r.mu.fenceErr != nil {
+		log.Infof(r.ctx, "clock offset verification succeeded again")
+	}
+	r.mu.fenceErr = err
+	return err
+}
+
+// Fenced returns the error of the most recent clock offset verification, or
+// nil if this node's clock was found to be within the maximum offset of more
+// than half of its peers. A non-nil return indicates that this node must not
+// serve writes.
+func (r *RemoteClockMonitor) Fenced() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.mu.fenceErr
+}
+
+func (r *RemoteClockMonitor) verifyClockOffset() error {
 	// By the contract of the hlc, if the value is 0, then safety checking
 	// of the max offset is disabled. However we may still want to
 	// propagate the information to a status node.
@@ -132,6 +132,39 @@ func TestVerifyClockOffset(t *testing.T) {
 	}
 }
 
+// TestClockOffsetFenced verifies that the monitor reports the node as fenced
+// while its clock is not within the maximum offset of a majority of the
+// known nodes, and lifts the fence once it is again.
+func TestClockOffsetFenced(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	clock := hlc.NewClock(hlc.NewManualClock(123).UnixNano, 50*time.Nanosecond)
+	monitor := newRemoteClockMonitor(context.TODO(), clock, time.Hour)
+	if err := monitor.Fenced(); err != nil {
+		t.Fatalf("unexpected fence before verification: %s", err)
+	}
+
+	monitor.mu.offsets = map[string]RemoteOffset{
+		"0": {Offset: 20, Uncertainty: 10},
+		"1": {Offset: 85, Uncertainty: 25},
+		"2": {Offset: 91, Uncertainty: 31},
+	}
+	if err := monitor.VerifyClockOffset(); err == nil {
+		t.Fatal("expected verification to fail")
+	}
+	if err := monitor.Fenced(); !testutils.IsError(err, errOffsetGreaterThanMaxOffset) {
+		t.Fatalf("expected node to be fenced, got %v", err)
+	}
+
+	monitor.mu.offsets["1"] = RemoteOffset{Offset: 10, Uncertainty: 5}
+	if err := monitor.VerifyClockOffset(); err != nil {
+		t.Fatal(err)
+	}
+	if err := monitor.Fenced(); err != nil {
+		t.Fatalf("expected fence to be lifted, got %s", err)
+	}
+}
+
 // TestIsHealthyOffsetInterval tests if we correctly determine if
 // a clusterOffsetInterval is healthy or not i.e. if it indicates that the
 // local clock has too great an offset or not.
@@ -0,0 +1,60 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package rpc
+
+import (
+	"github.com/gogo/protobuf/proto"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+
+	"github.com/cockroachdb/cockroach/pkg/util/humanizeutil"
+)
+
+// limitCodec implements grpc.Codec for protocol buffers, rejecting messages
+// which exceed the configured sizes. It is used by both clients and servers,
+// so that the limits apply to requests and responses alike.
+type limitCodec struct {
+	maxSendMsgSize int
+	maxRecvMsgSize int
+}
+
+var _ grpc.Codec = limitCodec{}
+
+// Marshal implements grpc.Codec.
+func (c limitCodec) Marshal(v interface{}) ([]byte, error) {
+	b, err := proto.Marshal(v.(proto.Message))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > c.maxSendMsgSize {
+		return nil, errors.Errorf("message of %s exceeds the maximum send message size of %s",
+			humanizeutil.IBytes(int64(len(b))), humanizeutil.IBytes(int64(c.maxSendMsgSize)))
+	}
+	return b, nil
+}
+
+// Unmarshal implements grpc.Codec.
+func (c limitCodec) Unmarshal(data []byte, v interface{}) error {
+	if len(data) > c.maxRecvMsgSize {
+		return errors.Errorf("message of %s exceeds the maximum receive message size of %s",
+			humanizeutil.IBytes(int64(len(data))), humanizeutil.IBytes(int64(c.maxRecvMsgSize)))
+	}
+	return proto.Unmarshal(data, v.(proto.Message))
+}
+
+// String implements grpc.Codec.
+func (limitCodec) String() string {
+	return "proto"
+}
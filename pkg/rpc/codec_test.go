@@ -0,0 +1,102 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package rpc
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/testutils"
+	"github.com/cockroachdb/cockroach/pkg/util"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/netutil"
+	"github.com/cockroachdb/cockroach/pkg/util/stop"
+)
+
+func TestLimitCodec(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	small := &PingRequest{Ping: "ping"}
+	large := &PingRequest{Ping: strings.Repeat("x", 1<<10)}
+	codec := limitCodec{maxSendMsgSize: 1 << 9, maxRecvMsgSize: 1 << 9}
+
+	b, err := codec.Marshal(small)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded PingRequest
+	if err := codec.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Ping != small.Ping {
+		t.Errorf("expected %q, got %q", small.Ping, decoded.Ping)
+	}
+
+	if _, err := codec.Marshal(large); !testutils.IsError(err, "exceeds the maximum send message size") {
+		t.Errorf("expected send size error, got %v", err)
+	}
+	b, err = limitCodec{maxSendMsgSize: 1 << 20, maxRecvMsgSize: 1 << 20}.Marshal(large)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := codec.Unmarshal(b, &decoded); !testutils.IsError(err, "exceeds the maximum receive message size") {
+		t.Errorf("expected receive size error, got %v", err)
+	}
+}
+
+// TestMaxMsgSize verifies that the message size limits of a context apply
+// to the servers created from it and to the connections it dials.
+func TestMaxMsgSize(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+
+	clock := hlc.NewClock(time.Unix(0, 20).UnixNano, time.Nanosecond)
+	serverCtx := newNodeTestContext(clock, stopper)
+	serverCtx.MaxRecvMsgSize = 1 << 10
+	ln, err := netutil.ListenAndServeGRPC(stopper, NewServer(serverCtx), util.TestAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientCtx := newNodeTestContext(clock, stopper)
+	clientCtx.MaxSendMsgSize = 4 << 10
+	conn, err := clientCtx.GRPCDial(ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewHeartbeatClient(conn)
+
+	for _, tc := range []struct {
+		size   int
+		expErr bool
+	}{
+		{1 << 9, false},
+		// Exceeds the server's receive limit.
+		{2 << 10, true},
+		// Exceeds the client's send limit.
+		{8 << 10, true},
+	} {
+		_, err := client.Ping(context.Background(), &PingRequest{Ping: strings.Repeat("x", tc.size)})
+		if (err != nil) != tc.expErr {
+			t.Errorf("%d: expected error %t, got %v", tc.size, tc.expErr, err)
+		}
+	}
+}
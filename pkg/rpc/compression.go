@@ -0,0 +1,268 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package rpc
+
+import (
+	"sync/atomic"
+
+	"github.com/golang/snappy"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+
+	"github.com/cockroachdb/cockroach/pkg/util/envutil"
+	"github.com/cockroachdb/cockroach/pkg/util/humanizeutil"
+	"github.com/cockroachdb/cockroach/pkg/util/metric"
+)
+
+// defaultEnableCompression is the default value of Context.EnableCompression.
+var defaultEnableCompression = envutil.EnvOrDefaultBool("COCKROACH_RPC_COMPRESSION", false)
+
+// minCompressedMsgSize is the size of the smallest messages which are
+// compressed. Smaller messages are not worth the CPU.
+const minCompressedMsgSize = 1 << 10
+
+// compressedMsgPrefix is the first byte of compressed messages, which is
+// followed by the snappy-encoded message. Protocol buffers never start
+// with a zero byte, as zero is not a valid field tag, so compressed
+// messages can be told apart from raw ones.
+const compressedMsgPrefix = 0
+
+// CompressionMetrics is the collection of metrics for RPC message
+// compression.
+type CompressionMetrics struct {
+	RawBytesSent            *metric.Counter
+	CompressedBytesSent     *metric.Counter
+	RawBytesReceived        *metric.Counter
+	CompressedBytesReceived *metric.Counter
+}
+
+var (
+	metaRawBytesSent = metric.Metadata{
+		Name: "rpc.compression.sent.raw",
+		Help: "Number of bytes of RPC messages sent compressed, before compression"}
+	metaCompressedBytesSent = metric.Metadata{
+		Name: "rpc.compression.sent.compressed",
+		Help: "Number of bytes of RPC messages sent compressed, after compression"}
+	metaRawBytesReceived = metric.Metadata{
+		Name: "rpc.compression.received.raw",
+		Help: "Number of bytes of RPC messages received compressed, after decompression"}
+	metaCompressedBytesReceived = metric.Metadata{
+		Name: "rpc.compression.received.compressed",
+		Help: "Number of bytes of RPC messages received compressed, before decompression"}
+)
+
+func makeCompressionMetrics() CompressionMetrics {
+	return CompressionMetrics{
+		RawBytesSent:            metric.NewCounter(metaRawBytesSent),
+		CompressedBytesSent:     metric.NewCounter(metaCompressedBytesSent),
+		RawBytesReceived:        metric.NewCounter(metaRawBytesReceived),
+		CompressedBytesReceived: metric.NewCounter(metaCompressedBytesReceived),
+	}
+}
+
+// CompressionMetrics returns the compression metrics of the context.
+func (ctx *Context) CompressionMetrics() *CompressionMetrics {
+	return &ctx.compressionMetrics
+}
+
+// compressedMessage wraps a message which a server sends to a client
+// accepting compression; see compressionUnaryInterceptor.
+type compressedMessage struct {
+	msg interface{}
+}
+
+// compressionCodec wraps the codec of clients and servers, compressing the
+// messages sent to peers which accept compression and decompressing the
+// compressed messages received. Compressed messages are accepted from any
+// peer, so that nodes with and without compression enabled can talk to
+// each other.
+//
+// The vendored gRPC compresses either all or none of the messages of a
+// connection or server, and peers which predate compressionVersion could
+// not decompress them. Compression is therefore done by the codec, which
+// decides for each message, using what the heartbeats over the connection
+// have revealed about the version of the peer.
+type compressionCodec struct {
+	grpc.Codec
+	maxRecvMsgSize int
+	metrics        *CompressionMetrics
+	// compress, if non-nil, returns whether messages are to be compressed.
+	// Clients set it; servers only compress the responses wrapped in a
+	// compressedMessage.
+	compress func() bool
+}
+
+// Marshal implements grpc.Codec.
+func (c compressionCodec) Marshal(v interface{}) ([]byte, error) {
+	compress := c.compress != nil && c.compress()
+	if m, ok := v.(compressedMessage); ok {
+		v, compress = m.msg, true
+	}
+	b, err := c.Codec.Marshal(v)
+	if err != nil || !compress || len(b) < minCompressedMsgSize {
+		return b, err
+	}
+	buf := make([]byte, 1+snappy.MaxEncodedLen(len(b)))
+	buf[0] = compressedMsgPrefix
+	compressed := snappy.Encode(buf[1:], b)
+	if len(compressed)+1 >= len(b) {
+		return b, nil
+	}
+	c.metrics.RawBytesSent.Inc(int64(len(b)))
+	c.metrics.CompressedBytesSent.Inc(int64(len(compressed) + 1))
+	return buf[:len(compressed)+1], nil
+}
+
+// Unmarshal implements grpc.Codec.
+func (c compressionCodec) Unmarshal(data []byte, v interface{}) error {
+	if len(data) == 0 || data[0] != compressedMsgPrefix {
+		return c.Codec.Unmarshal(data, v)
+	}
+	n, err := snappy.DecodedLen(data[1:])
+	if err != nil {
+		return errors.Wrap(err, "failed to decompress message")
+	}
+	if n > c.maxRecvMsgSize {
+		return errors.Errorf("message of %s exceeds the maximum receive message size of %s once decompressed",
+			humanizeutil.IBytes(int64(n)), humanizeutil.IBytes(int64(c.maxRecvMsgSize)))
+	}
+	raw, err := snappy.Decode(nil, data[1:])
+	if err != nil {
+		return errors.Wrap(err, "failed to decompress message")
+	}
+	c.metrics.CompressedBytesReceived.Inc(int64(len(data)))
+	c.metrics.RawBytesReceived.Inc(int64(len(raw)))
+	return c.Codec.Unmarshal(raw, v)
+}
+
+// clientCodec returns the codec of the client connection described by
+// meta. Requests are compressed if EnableCompression is set and a
+// heartbeat over the connection has revealed that the peer speaks
+// compressionVersion or later; see peerVersionKnown.
+func (ctx *Context) clientCodec(meta *connMeta) grpc.Codec {
+	var compress func() bool
+	if ctx.EnableCompression {
+		compress = func() bool {
+			return atomic.LoadInt32(&meta.compress) == 1
+		}
+	}
+	return compressionCodec{
+		Codec:          ctx.codec(),
+		maxRecvMsgSize: ctx.MaxRecvMsgSize,
+		metrics:        &ctx.compressionMetrics,
+		compress:       compress,
+	}
+}
+
+// serverCodec returns the codec of servers created from the context.
+func (ctx *Context) serverCodec() grpc.Codec {
+	return compressionCodec{
+		Codec:          ctx.codec(),
+		maxRecvMsgSize: ctx.MaxRecvMsgSize,
+		metrics:        &ctx.compressionMetrics,
+	}
+}
+
+// peerVersionKnown records the version of the peer of the client
+// connection, as revealed by a heartbeat over it.
+func (ctx *Context) peerVersionKnown(key connKey, version uint32) {
+	ctx.conns.Lock()
+	defer ctx.conns.Unlock()
+
+	if meta, ok := ctx.conns.cache[key]; ok {
+		var compress int32
+		if version >= compressionVersion {
+			compress = 1
+		}
+		atomic.StoreInt32(&meta.compress, compress)
+	}
+}
+
+// compressionClientTTL is the number of heartbeat intervals after which a
+// client which accepted compression and stopped heartbeating is forgotten.
+const compressionClientTTL = 10
+
+// clientVersionKnown records the version of the client of a call to the
+// heartbeat service, identified by the remote address of its connection.
+// Responses over that connection are compressed if the client speaks
+// compressionVersion or later; see acceptsCompression.
+func (ctx *Context) clientVersionKnown(goCtx context.Context, version uint32) {
+	p, ok := peer.FromContext(goCtx)
+	if !ok {
+		return
+	}
+	now := ctx.localClock.PhysicalTime()
+	ctx.compressionClients.Lock()
+	defer ctx.compressionClients.Unlock()
+	for addr, lastSeen := range ctx.compressionClients.lastSeen {
+		if now.Sub(lastSeen) > compressionClientTTL*ctx.HeartbeatInterval {
+			delete(ctx.compressionClients.lastSeen, addr)
+		}
+	}
+	if version >= compressionVersion {
+		ctx.compressionClients.lastSeen[p.Addr.String()] = now
+	} else {
+		delete(ctx.compressionClients.lastSeen, p.Addr.String())
+	}
+}
+
+// acceptsCompression returns whether the client of the call accepts
+// compressed responses. Calls made before the first heartbeat over their
+// connection are answered uncompressed.
+func (ctx *Context) acceptsCompression(goCtx context.Context) bool {
+	p, ok := peer.FromContext(goCtx)
+	if !ok {
+		return false
+	}
+	ctx.compressionClients.Lock()
+	defer ctx.compressionClients.Unlock()
+	_, ok = ctx.compressionClients.lastSeen[p.Addr.String()]
+	return ok
+}
+
+// compressionUnaryInterceptor compresses the responses to clients which
+// accept compression.
+func (ctx *Context) compressionUnaryInterceptor(
+	goCtx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+) (interface{}, error) {
+	resp, err := handler(goCtx, req)
+	if err != nil || !ctx.acceptsCompression(goCtx) {
+		return resp, err
+	}
+	return compressedMessage{msg: resp}, nil
+}
+
+// compressionStreamInterceptor is like compressionUnaryInterceptor, but
+// for the messages sent by streaming RPCs.
+func (ctx *Context) compressionStreamInterceptor(
+	srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler,
+) error {
+	if !ctx.acceptsCompression(ss.Context()) {
+		return handler(srv, ss)
+	}
+	return handler(srv, compressedServerStream{ss})
+}
+
+// compressedServerStream compresses the messages sent over a server stream.
+type compressedServerStream struct {
+	grpc.ServerStream
+}
+
+// SendMsg implements grpc.ServerStream.
+func (ss compressedServerStream) SendMsg(m interface{}) error {
+	return ss.ServerStream.SendMsg(compressedMessage{msg: m})
+}
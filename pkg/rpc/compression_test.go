@@ -0,0 +1,179 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package rpc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/testutils"
+	"github.com/cockroachdb/cockroach/pkg/util"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/netutil"
+	"github.com/cockroachdb/cockroach/pkg/util/stop"
+)
+
+func TestCompressionCodec(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	metrics := makeCompressionMetrics()
+	codec := compressionCodec{
+		Codec:          limitCodec{maxSendMsgSize: 1 << 20, maxRecvMsgSize: 1 << 20},
+		maxRecvMsgSize: 1 << 20,
+		metrics:        &metrics,
+	}
+	small := &PingRequest{Ping: "small"}
+	large := &PingRequest{Ping: strings.Repeat("compressible ", 1000)}
+
+	// Only the large messages which are explicitly wrapped are compressed.
+	for _, tc := range []struct {
+		msg           interface{}
+		expCompressed bool
+	}{
+		{small, false},
+		{large, false},
+		{compressedMessage{msg: small}, false},
+		{compressedMessage{msg: large}, true},
+	} {
+		b, err := codec.Marshal(tc.msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if compressed := b[0] == compressedMsgPrefix; compressed != tc.expCompressed {
+			t.Errorf("expected compressed %t, got %t", tc.expCompressed, compressed)
+		}
+		var out PingRequest
+		if err := codec.Unmarshal(b, &out); err != nil {
+			t.Fatal(err)
+		}
+		expected := tc.msg
+		if m, ok := expected.(compressedMessage); ok {
+			expected = m.msg
+		}
+		if !reflect.DeepEqual(&out, expected) {
+			t.Errorf("expected %s, got %s", expected, &out)
+		}
+	}
+
+	b, err := codec.Marshal(compressedMessage{msg: large})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawLen := int64(large.Size())
+	compressedLen := int64(len(b))
+	for _, tc := range []struct {
+		name     string
+		count    int64
+		expected int64
+	}{
+		{"raw sent", metrics.RawBytesSent.Count(), 2 * rawLen},
+		{"compressed sent", metrics.CompressedBytesSent.Count(), 2 * compressedLen},
+		{"raw received", metrics.RawBytesReceived.Count(), rawLen},
+		{"compressed received", metrics.CompressedBytesReceived.Count(), compressedLen},
+	} {
+		if tc.count != tc.expected {
+			t.Errorf("expected %d %s bytes, got %d", tc.expected, tc.name, tc.count)
+		}
+	}
+
+	// Compressed messages which would exceed the maximum receive message
+	// size once decompressed are rejected.
+	codec.maxRecvMsgSize = large.Size() - 1
+	if err := codec.Unmarshal(b, &PingRequest{}); !testutils.IsError(err, "once decompressed") {
+		t.Errorf("expected oversized message to be rejected, got %v", err)
+	}
+}
+
+// TestCompressionMixed verifies that requests and responses are each only
+// compressed if compression is enabled on their sender and supported by
+// their receiver.
+func TestCompressionMixed(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	const oldVersion = compressionVersion - 1
+	for _, tc := range []struct {
+		clientCompression bool
+		clientVersion     uint32
+		serverCompression bool
+		serverVersion     uint32
+		expRequests       bool
+		expResponses      bool
+	}{
+		{true, serverVersion, true, serverVersion, true, true},
+		{true, serverVersion, false, serverVersion, true, false},
+		{false, serverVersion, true, serverVersion, false, true},
+		{true, serverVersion, false, oldVersion, false, false},
+		{false, oldVersion, true, serverVersion, false, false},
+	} {
+		func() {
+			stopper := stop.NewStopper()
+			defer stopper.Stop()
+
+			clock := hlc.NewClock(time.Unix(0, 20).UnixNano, time.Nanosecond)
+			serverCtx := newNodeTestContext(clock, stopper)
+			serverCtx.EnableCompression = tc.serverCompression
+			serverCtx.version = tc.serverVersion
+			s := NewServer(serverCtx)
+			ln, err := netutil.ListenAndServeGRPC(stopper, s, util.TestAddr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			remoteAddr := ln.Addr().String()
+
+			clientCtx := newNodeTestContext(clock, stopper)
+			clientCtx.EnableCompression = tc.clientCompression
+			clientCtx.version = tc.clientVersion
+			conn, err := clientCtx.GRPCDial(remoteAddr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Once a heartbeat has succeeded, both sides know the version of
+			// the other.
+			util.SucceedsSoon(t, func() error {
+				if !clientCtx.IsConnHealthy(remoteAddr) {
+					return errors.Errorf("%+v: expected connection to be healthy", tc)
+				}
+				return nil
+			})
+
+			request := &PingRequest{
+				Ping:          strings.Repeat("compressible ", 1000),
+				ServerVersion: tc.clientVersion,
+			}
+			if _, err := NewHeartbeatClient(conn).Ping(context.Background(), request); err != nil {
+				t.Fatal(err)
+			}
+
+			sent := clientCtx.CompressionMetrics().CompressedBytesSent.Count()
+			received := serverCtx.CompressionMetrics().CompressedBytesReceived.Count()
+			if compressed := sent > 0 && received > 0; compressed != tc.expRequests {
+				t.Errorf("%+v: expected compressed requests %t, sent %d and received %d compressed bytes",
+					tc, tc.expRequests, sent, received)
+			}
+			sent = serverCtx.CompressionMetrics().CompressedBytesSent.Count()
+			received = clientCtx.CompressionMetrics().CompressedBytesReceived.Count()
+			if compressed := sent > 0 && received > 0; compressed != tc.expResponses {
+				t.Errorf("%+v: expected compressed responses %t, sent %d and received %d compressed bytes",
+					tc, tc.expResponses, sent, received)
+			}
+		}()
+	}
+}
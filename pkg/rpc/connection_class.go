@@ -0,0 +1,61 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package rpc
+
+import (
+	"fmt"
+
+	"github.com/cockroachdb/cockroach/pkg/keys"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+)
+
+// ConnectionClass identifies a group of RPC connections. A separate
+// connection is dialed to each peer for every class, so that traffic of one
+// class does not suffer head-of-line blocking behind traffic of another.
+type ConnectionClass int8
+
+const (
+	// DefaultClass is the class of connections used for user traffic and
+	// everything that is not explicitly assigned to another class.
+	DefaultClass ConnectionClass = iota
+	// SystemClass is the class of connections used for latency-sensitive
+	// traffic which keeps the cluster healthy, such as Raft messages and
+	// node liveness heartbeats.
+	SystemClass
+)
+
+var connectionClassNames = [...]string{
+	DefaultClass: "default",
+	SystemClass:  "system",
+}
+
+// String implements fmt.Stringer.
+func (c ConnectionClass) String() string {
+	if int(c) < len(connectionClassNames) {
+		return connectionClassNames[c]
+	}
+	return fmt.Sprintf("ConnectionClass(%d)", int8(c))
+}
+
+// ConnectionClassForSpan returns the class of connections which requests
+// addressed to the specified span should be sent on. Requests addressed to
+// node liveness records use SystemClass.
+func ConnectionClassForSpan(rs roachpb.RSpan) ConnectionClass {
+	if !rs.Key.Less(roachpb.RKey(keys.NodeLivenessPrefix)) &&
+		!roachpb.RKey(keys.NodeLivenessKeyMax).Less(rs.EndKey) {
+		return SystemClass
+	}
+	return DefaultClass
+}
@@ -0,0 +1,94 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package rpc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cockroachdb/cockroach/pkg/keys"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/util"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/stop"
+)
+
+// TestConnectionClasses verifies that connections of different classes to
+// the same target are distinct and heartbeated independently.
+func TestConnectionClasses(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+
+	clock := hlc.NewClock(time.Unix(0, 20).UnixNano, time.Nanosecond)
+	serverCtx := newNodeTestContext(clock, stopper)
+	s, ln := newTestServer(t, serverCtx, true)
+	remoteAddr := ln.Addr().String()
+	RegisterHeartbeatServer(s, &HeartbeatService{
+		clock:              clock,
+		remoteClockMonitor: serverCtx.RemoteClocks,
+	})
+
+	clientCtx := newNodeTestContext(clock, stopper)
+	defaultConn, err := clientCtx.GRPCDial(remoteAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	systemConn, err := clientCtx.GRPCDialClass(remoteAddr, SystemClass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if defaultConn == systemConn {
+		t.Fatal("expected distinct connections for the default and system classes")
+	}
+	if conn, err := clientCtx.GRPCDialClass(remoteAddr, DefaultClass); err != nil {
+		t.Fatal(err)
+	} else if conn != defaultConn {
+		t.Fatal("expected the cached default class connection")
+	}
+
+	util.SucceedsSoon(t, func() error {
+		for _, class := range []ConnectionClass{DefaultClass, SystemClass} {
+			if !clientCtx.IsConnHealthyClass(remoteAddr, class) {
+				return errors.Errorf("expected %s connection to be healthy", class)
+			}
+		}
+		return nil
+	})
+}
+
+func TestConnectionClassForSpan(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	livenessKey := roachpb.RKey(keys.NodeLivenessKey(1))
+	testCases := []struct {
+		span     roachpb.RSpan
+		expected ConnectionClass
+	}{
+		{roachpb.RSpan{Key: livenessKey, EndKey: livenessKey.Next()}, SystemClass},
+		{roachpb.RSpan{Key: roachpb.RKey(keys.NodeLivenessPrefix), EndKey: roachpb.RKey(keys.NodeLivenessKeyMax)}, SystemClass},
+		{roachpb.RSpan{Key: livenessKey, EndKey: roachpb.RKey(keys.SystemMax)}, DefaultClass},
+		{roachpb.RSpan{Key: roachpb.RKey("a"), EndKey: roachpb.RKey("b")}, DefaultClass},
+	}
+	for i, tc := range testCases {
+		if class := ConnectionClassForSpan(tc.span); class != tc.expected {
+			t.Errorf("%d: expected %s for %s, got %s", i, tc.expected, tc.span, class)
+		}
+	}
+}
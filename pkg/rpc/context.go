@@ -18,23 +18,28 @@ package rpc
 
 import (
 	"math"
+	"net"
 	"sync"
 	"time"
 
+	"github.com/cenk/backoff"
+	"github.com/pkg/errors"
 	"github.com/rubyist/circuitbreaker"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/credentials"
 
 	"github.com/cockroachdb/cockroach/pkg/base"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/util/envutil"
 	"github.com/cockroachdb/cockroach/pkg/util/grpcutil"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/metric"
 	"github.com/cockroachdb/cockroach/pkg/util/stop"
 	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
 	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	"github.com/cockroachdb/cockroach/pkg/util/uuid"
 )
 
 func init() {
@@ -46,43 +51,117 @@ func init() {
 	grpc.EnableTracing = false
 }
 
-const (
-	defaultHeartbeatInterval = 3 * time.Second
-	// The coefficient by which the maximum offset is multiplied to determine the
-	// maximum acceptable measurement latency.
-	maximumPingDurationMult = 2
+// The coefficient by which the maximum offset is multiplied to determine the
+// maximum acceptable measurement latency.
+const maximumPingDurationMult = 2
+
+var (
+	// The limiting factor for lowering the max message sizes is the fact
+	// that a single large kv can be sent over the network in one message.
+	// Our maximum kv size is unlimited, so we need this to be very large.
+	// TODO(peter,tamird): need tests before lowering
+	defaultMaxRecvMsgSize = int(envutil.EnvOrDefaultBytes("COCKROACH_RPC_MAX_RECV_MSG_SIZE", math.MaxInt32))
+	defaultMaxSendMsgSize = int(envutil.EnvOrDefaultBytes("COCKROACH_RPC_MAX_SEND_MSG_SIZE", math.MaxInt32))
+	// Connections idle for longer than this are probed, which keeps
+	// middleboxes from dropping them and detects dead peers at the TCP
+	// level.
+	defaultKeepAliveInterval = envutil.EnvOrDefaultDuration("COCKROACH_RPC_KEEPALIVE_INTERVAL", time.Minute)
+	// Low-latency networks can afford to heartbeat more often, and detect
+	// failures sooner, while lossy ones may need a longer timeout or more
+	// failed heartbeats before a connection is considered unhealthy.
+	defaultHeartbeatInterval = envutil.EnvOrDefaultDuration(
+		"COCKROACH_RPC_HEARTBEAT_INTERVAL", 3*time.Second)
+	defaultHeartbeatTimeout = envutil.EnvOrDefaultDuration(
+		"COCKROACH_RPC_HEARTBEAT_TIMEOUT", 2*defaultHeartbeatInterval)
+	defaultHeartbeatFailureThreshold = envutil.EnvOrDefaultInt(
+		"COCKROACH_RPC_HEARTBEAT_FAILURE_THRESHOLD", 1)
 )
 
 // NewServer is a thin wrapper around grpc.NewServer that registers a heartbeat
-// service.
+// service and installs the interceptors of the context.
 func NewServer(ctx *Context) *grpc.Server {
 	opts := []grpc.ServerOption{
-		// The limiting factor for lowering the max message size is the fact
-		// that a single large kv can be sent over the network in one message.
-		// Our maximum kv size is unlimited, so we need this to be very large.
-		// TODO(peter,tamird): need tests before lowering
-		grpc.MaxMsgSize(math.MaxInt32),
+		// MaxMsgSize limits the size of received messages before
+		// decompression, while the codec enforces both limits on the
+		// (decompressed) messages.
+		grpc.MaxMsgSize(ctx.MaxRecvMsgSize),
+		grpc.CustomCodec(ctx.serverCodec()),
 	}
+	var unaryInterceptors []grpc.UnaryServerInterceptor
+	var streamInterceptors []grpc.StreamServerInterceptor
 	if !ctx.Insecure {
-		tlsConfig, err := ctx.GetServerTLSConfig()
+		if _, err := ctx.GetServerTLSConfig(); err != nil {
+			panic(err)
+		}
+		cm, err := ctx.GetCertificateManager()
 		if err != nil {
 			panic(err)
 		}
-		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+		// The credentials use the certificates loaded last for every
+		// handshake, so that rotated certificates are served without a
+		// restart.
+		opts = append(opts, grpc.Creds(cm.ServerCredentials()))
+		// Only nodes may call the internal services; see nodeServices. The
+		// check precedes the interceptors of the context, so that they only
+		// see authorized calls.
+		unaryInterceptors = append(unaryInterceptors, unaryAuthInterceptor)
+		streamInterceptors = append(streamInterceptors, streamAuthInterceptor)
+	}
+	if ctx.EnableCompression {
+		unaryInterceptors = append(unaryInterceptors, ctx.compressionUnaryInterceptor)
+		streamInterceptors = append(streamInterceptors, ctx.compressionStreamInterceptor)
+	}
+	unaryInterceptors = append(unaryInterceptors, ctx.UnaryInterceptors...)
+	streamInterceptors = append(streamInterceptors, ctx.StreamInterceptors...)
+	if interceptor := chainUnaryServerInterceptors(unaryInterceptors...); interceptor != nil {
+		opts = append(opts, grpc.UnaryInterceptor(interceptor))
+	}
+	if interceptor := chainStreamServerInterceptors(streamInterceptors...); interceptor != nil {
+		opts = append(opts, grpc.StreamInterceptor(interceptor))
 	}
 	s := grpc.NewServer(opts...)
 	RegisterHeartbeatServer(s, &HeartbeatService{
 		clock:              ctx.localClock,
 		remoteClockMonitor: ctx.RemoteClocks,
+		heartbeatCB: func() {
+			if cb := ctx.HeartbeatCB; cb != nil {
+				cb()
+			}
+		},
+		versionCB:  ctx.clientVersionKnown,
+		clusterID:  ctx.ClusterID,
+		version:    ctx.version,
+		minVersion: ctx.minVersion,
 	})
 	return s
 }
 
+// connKey identifies a cached connection.
+type connKey struct {
+	target string
+	class  ConnectionClass
+}
+
 type connMeta struct {
 	sync.Once
-	conn    *grpc.ClientConn
-	err     error
-	healthy bool
+	conn *grpc.ClientConn
+	err  error
+	// The state of the heartbeats over the connection, which determines its
+	// health; see IsConnHealthyClass. failures counts the consecutive
+	// heartbeats which failed since the last successful one, and pending is
+	// the time the heartbeat in flight, if any, was sent.
+	heartbeat struct {
+		succeeded bool
+		failures  int
+		pending   time.Time
+	}
+	// If the dial failed, the connection is dialed again by the first call
+	// to GRPCDialClass after retryAt. backOff spaces out the retries.
+	backOff backoff.BackOff
+	retryAt time.Time
+	// compress is 1 if requests over the connection are compressed, which
+	// is learned from the heartbeats; see clientCodec. Accessed atomically.
+	compress int32
 }
 
 // Context contains the fields required by the rpc framework.
@@ -95,19 +174,95 @@ type Context struct {
 	RemoteClocks *RemoteClockMonitor
 	masterCtx    context.Context
 
+	// HeartbeatInterval is the period of the heartbeats sent over the
+	// connections dialed by this context. A heartbeat fails if no response
+	// arrives within HeartbeatTimeout.
 	HeartbeatInterval time.Duration
 	HeartbeatTimeout  time.Duration
-	HeartbeatCB       func()
+	// HeartbeatFailureThreshold is the number of consecutive heartbeats
+	// which have to fail before a connection is considered unhealthy. A
+	// heartbeat still in flight after HeartbeatInterval counts as failed,
+	// so that unresponsive peers are detected before the heartbeat times
+	// out.
+	HeartbeatFailureThreshold int
+	// HeartbeatCB is invoked after every successful heartbeat sent or
+	// received by this node.
+	HeartbeatCB func()
+
+	// EnableCompression causes the RPC requests sent and the responses
+	// returned by this node to be snappy-compressed, for the peers which
+	// support compression; see compressionVersion. Which peers do is learned
+	// from the heartbeats exchanged with them, so the messages sent before
+	// the first heartbeat over a connection are not compressed. Compressed
+	// messages are accepted regardless of this setting, so that nodes with
+	// and without compression enabled can talk to each other.
+	EnableCompression  bool
+	compressionMetrics CompressionMetrics
+	// The clients which accept compressed responses, by the remote address
+	// of their connection, and the time of their last heartbeat.
+	compressionClients struct {
+		syncutil.Mutex
+		lastSeen map[string]time.Time
+	}
+
+	// MaxRecvMsgSize and MaxSendMsgSize limit the size of the RPC messages
+	// received and sent, both by clients dialed by and servers created from
+	// this context.
+	MaxRecvMsgSize int
+	MaxSendMsgSize int
+
+	// KeepAliveInterval is the period of TCP keepalive probes on connections
+	// dialed by this context. Set to 0 to disable keepalives. Servers apply
+	// it to their listeners; see netutil.KeepAliveListener. Unresponsive
+	// peers are also detected at the RPC level by heartbeats which time out
+	// after HeartbeatTimeout.
+	KeepAliveInterval time.Duration
+
+	// UnaryInterceptors and StreamInterceptors are installed, in order, on
+	// the servers created from this context, for instance to trace or log
+	// requests. They are invoked after the calls have been authorized. The
+	// vendored gRPC does not support client interceptors, so only server
+	// interceptors can be installed.
+	UnaryInterceptors  []grpc.UnaryServerInterceptor
+	StreamInterceptors []grpc.StreamServerInterceptor
 
 	localInternalServer roachpb.InternalServer
 
+	// The versions of this node exchanged in heartbeats. Peers which are
+	// not compatible with them are refused; see checkCompatibility.
+	version, minVersion uint32
+
+	clusterID struct {
+		syncutil.Mutex
+		id uuid.UUID
+	}
+
 	conns struct {
 		syncutil.Mutex
-		cache map[string]*connMeta
+		cache map[connKey]*connMeta
 	}
 
+	// Breaker configures the circuit breakers created by NewBreaker.
+	Breaker BreakerOptions
 	// For unittesting.
 	BreakerFactory func() *circuit.Breaker
+
+	breakers struct {
+		syncutil.Mutex
+		tracked  []peerBreaker
+		registry *metric.Registry
+	}
+	breakerMetrics BreakerMetrics
+
+	// MetricsSampleInterval is the window of the per-peer heartbeat latency
+	// histograms.
+	MetricsSampleInterval time.Duration
+
+	peerLatencies struct {
+		syncutil.Mutex
+		registry   *metric.Registry
+		histograms map[string]*metric.Histogram
+	}
 }
 
 // NewContext creates an rpc Context with the supplied values.
@@ -130,8 +285,36 @@ func NewContext(
 	ctx.RemoteClocks = newRemoteClockMonitor(
 		ctx.masterCtx, ctx.localClock, 10*defaultHeartbeatInterval)
 	ctx.HeartbeatInterval = defaultHeartbeatInterval
-	ctx.HeartbeatTimeout = 2 * defaultHeartbeatInterval
-	ctx.conns.cache = make(map[string]*connMeta)
+	ctx.HeartbeatTimeout = defaultHeartbeatTimeout
+	ctx.HeartbeatFailureThreshold = defaultHeartbeatFailureThreshold
+	ctx.EnableCompression = defaultEnableCompression
+	ctx.MaxRecvMsgSize = defaultMaxRecvMsgSize
+	ctx.MaxSendMsgSize = defaultMaxSendMsgSize
+	ctx.KeepAliveInterval = defaultKeepAliveInterval
+	ctx.version = serverVersion
+	ctx.minVersion = minServerVersion
+	ctx.compressionMetrics = makeCompressionMetrics()
+	ctx.compressionClients.lastSeen = make(map[string]time.Time)
+	ctx.Breaker = DefaultBreakerOptions()
+	ctx.breakerMetrics = makeBreakerMetrics()
+	ctx.breakers.registry = metric.NewRegistry()
+	ctx.MetricsSampleInterval = defaultMetricsSampleInterval
+	ctx.peerLatencies.registry = metric.NewRegistry()
+	ctx.peerLatencies.histograms = make(map[string]*metric.Histogram)
+	ctx.conns.cache = make(map[connKey]*connMeta)
+
+	stopper.RunWorker(func() {
+		ticker := time.NewTicker(breakerMetricsInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				ctx.updateBreakerMetrics()
+			case <-stopper.ShouldStop():
+				return
+			}
+		}
+	})
 
 	stopper.RunWorker(func() {
 		<-stopper.ShouldQuiesce()
@@ -169,15 +352,38 @@ func (ctx *Context) SetLocalInternalServer(internalServer roachpb.InternalServer
 	ctx.localInternalServer = internalServer
 }
 
-func (ctx *Context) removeConn(key string, meta *connMeta) {
+// SetClusterID sets the ID of the cluster this node belongs to, which is
+// exchanged in heartbeats. Connections to and from nodes of other clusters
+// are refused. Until the cluster ID is set, as is the case for a node
+// joining a cluster, nodes of any cluster are accepted. The cluster ID
+// cannot be changed once set.
+func (ctx *Context) SetClusterID(clusterID uuid.UUID) error {
+	ctx.clusterID.Lock()
+	defer ctx.clusterID.Unlock()
+	if ctx.clusterID.id != (uuid.UUID{}) && ctx.clusterID.id != clusterID {
+		return errors.Errorf("cluster ID already set to %s, cannot change to %s", ctx.clusterID.id, clusterID)
+	}
+	ctx.clusterID.id = clusterID
+	return nil
+}
+
+// ClusterID returns the ID of the cluster this node belongs to, or the
+// zero UUID if it is not yet known.
+func (ctx *Context) ClusterID() uuid.UUID {
+	ctx.clusterID.Lock()
+	defer ctx.clusterID.Unlock()
+	return ctx.clusterID.id
+}
+
+func (ctx *Context) removeConn(key connKey, meta *connMeta) {
 	ctx.conns.Lock()
 	defer ctx.conns.Unlock()
 	ctx.removeConnLocked(key, meta)
 }
 
-func (ctx *Context) removeConnLocked(key string, meta *connMeta) {
+func (ctx *Context) removeConnLocked(key connKey, meta *connMeta) {
 	if log.V(1) {
-		log.Infof(ctx.masterCtx, "closing %s", key)
+		log.Infof(ctx.masterCtx, "closing %s (%s)", key.target, key.class)
 	}
 	if conn := meta.conn; conn != nil {
 		if err := conn.Close(); err != nil && !grpcutil.IsClosedConnection(err) {
@@ -189,13 +395,45 @@ func (ctx *Context) removeConnLocked(key string, meta *connMeta) {
 	delete(ctx.conns.cache, key)
 }
 
+// rejectConn closes the connection to a peer which failed the
+// compatibility check. Until the backoff expires, dialing the peer again
+// returns err rather than a new connection.
+func (ctx *Context) rejectConn(key connKey, meta *connMeta, err error) {
+	ctx.conns.Lock()
+	defer ctx.conns.Unlock()
+	ctx.removeConnLocked(key, meta)
+	failed := &connMeta{
+		err:     err,
+		backOff: newBackOff(&ctx.breakerClock, ctx.Breaker),
+	}
+	failed.Do(func() {})
+	failed.retryAt = ctx.breakerClock.Now().Add(failed.backOff.NextBackOff())
+	ctx.conns.cache[key] = failed
+}
+
 // GRPCDial calls grpc.Dial with the options appropriate for the context.
+// The returned connection belongs to DefaultClass.
 func (ctx *Context) GRPCDial(target string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	return ctx.GRPCDialClass(target, DefaultClass, opts...)
+}
+
+// GRPCDialClass is like GRPCDial, but returns a connection of the specified
+// class. Connections of different classes to the same target do not share
+// the underlying transport.
+func (ctx *Context) GRPCDialClass(
+	target string, class ConnectionClass, opts ...grpc.DialOption,
+) (*grpc.ClientConn, error) {
+	key := connKey{target: target, class: class}
 	ctx.conns.Lock()
-	meta, ok := ctx.conns.cache[target]
+	meta, ok := ctx.conns.cache[key]
 	if !ok {
 		meta = &connMeta{}
-		ctx.conns.cache[target] = meta
+		ctx.conns.cache[key] = meta
+	} else if !meta.retryAt.IsZero() && !ctx.breakerClock.Now().Before(meta.retryAt) {
+		// The previous dial failed and its backoff has expired. A new
+		// connection starts out unhealthy until a heartbeat succeeds over it.
+		meta = &connMeta{backOff: meta.backOff}
+		ctx.conns.cache[key] = meta
 	}
 	ctx.conns.Unlock()
 
@@ -204,31 +442,43 @@ func (ctx *Context) GRPCDial(target string, opts ...grpc.DialOption) (*grpc.Clie
 		if ctx.Insecure {
 			dialOpt = grpc.WithInsecure()
 		} else {
-			tlsConfig, err := ctx.GetClientTLSConfig()
+			if _, err := ctx.GetClientTLSConfig(); err != nil {
+				meta.err = err
+				return
+			}
+			cm, err := ctx.GetCertificateManager()
 			if err != nil {
 				meta.err = err
 				return
 			}
-			dialOpt = grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))
+			dialOpt = grpc.WithTransportCredentials(cm.ClientCredentials())
 		}
 
-		dialOpts := make([]grpc.DialOption, 0, 2+len(opts))
+		dialOpts := make([]grpc.DialOption, 0, 6+len(opts))
 		dialOpts = append(dialOpts, dialOpt)
-		dialOpts = append(dialOpts, grpc.WithBackoffMaxDelay(maxBackoff))
+		// gRPC re-establishes broken transports by itself, using jittered
+		// exponential backoff.
+		dialOpts = append(dialOpts, grpc.WithBackoffMaxDelay(ctx.Breaker.MaxBackoff))
+		dialOpts = append(dialOpts, grpc.WithCodec(ctx.clientCodec(meta)))
+		dialOpts = append(dialOpts, grpc.WithDialer(ctx.dial))
 		dialOpts = append(dialOpts, opts...)
 
 		if log.V(1) {
-			log.Infof(ctx.masterCtx, "dialing %s", target)
+			log.Infof(ctx.masterCtx, "dialing %s (%s)", target, class)
 		}
 		meta.conn, meta.err = grpc.DialContext(ctx.masterCtx, target, dialOpts...)
 		if meta.err == nil {
 			if err := ctx.Stopper.RunTask(func() {
 				ctx.Stopper.RunWorker(func() {
-					err := ctx.runHeartbeat(meta.conn, target)
+					err := ctx.runHeartbeat(meta.conn, key)
 					if err != nil && !grpcutil.IsClosedConnection(err) {
 						log.Error(ctx.masterCtx, err)
 					}
-					ctx.removeConn(target, meta)
+					if isIncompatibleError(err) {
+						ctx.rejectConn(key, meta, err)
+					} else {
+						ctx.removeConn(key, meta)
+					}
 				})
 			}); err != nil {
 				meta.err = err
@@ -236,49 +486,132 @@ func (ctx *Context) GRPCDial(target string, opts ...grpc.DialOption) (*grpc.Clie
 				// to avoid racing with meta's initialization, the cleanup worker
 				// blocks on meta.Do while holding ctx.conns. Invoke removeConn
 				// asynchronously to avoid deadlock.
-				go ctx.removeConn(target, meta)
+				go ctx.removeConn(key, meta)
 			}
 		}
 	})
 
+	if meta.err != nil {
+		// Failed dials are not sticky: schedule a retry with jittered
+		// exponential backoff. The bookkeeping happens outside of meta.Do as
+		// ctx's cleanup worker blocks on meta.Do while holding ctx.conns.
+		ctx.conns.Lock()
+		if meta.retryAt.IsZero() {
+			if meta.backOff == nil {
+				meta.backOff = newBackOff(&ctx.breakerClock, ctx.Breaker)
+			}
+			meta.retryAt = ctx.breakerClock.Now().Add(meta.backOff.NextBackOff())
+		}
+		ctx.conns.Unlock()
+	}
 	return meta.conn, meta.err
 }
 
+// codec returns the codec for clients and servers, which enforces the
+// message size limits.
+func (ctx *Context) codec() grpc.Codec {
+	return limitCodec{
+		maxSendMsgSize: ctx.MaxSendMsgSize,
+		maxRecvMsgSize: ctx.MaxRecvMsgSize,
+	}
+}
+
+// dial establishes the connections of clients, enabling TCP keepalives.
+func (ctx *Context) dial(addr string, timeout time.Duration) (net.Conn, error) {
+	dialer := net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: ctx.KeepAliveInterval,
+	}
+	return dialer.Dial("tcp", addr)
+}
+
 // NewBreaker creates a new circuit breaker properly configured for RPC
-// connections.
-func (ctx *Context) NewBreaker() *circuit.Breaker {
+// connections to the specified peer. The name of the peer labels the
+// breaker's metrics, which are added to PeerBreakerRegistry.
+func (ctx *Context) NewBreaker(name string) *circuit.Breaker {
+	var breaker *circuit.Breaker
 	if ctx.BreakerFactory != nil {
-		return ctx.BreakerFactory()
+		breaker = ctx.BreakerFactory()
+	} else {
+		breaker = newBreaker(&ctx.breakerClock, ctx.Breaker)
+	}
+
+	pb := makePeerBreaker(name, breaker)
+	ctx.breakers.Lock()
+	ctx.breakers.tracked = append(ctx.breakers.tracked, pb)
+	ctx.breakers.registry.AddMetric(pb.tripped)
+	ctx.breakers.registry.AddMetric(pb.consecutiveFailures)
+	ctx.breakers.Unlock()
+	return breaker
+}
+
+// heartbeatSent records that a heartbeat was sent over the connection at
+// the specified time.
+func (ctx *Context) heartbeatSent(key connKey, sendTime time.Time) {
+	ctx.conns.Lock()
+	defer ctx.conns.Unlock()
+
+	if meta, ok := ctx.conns.cache[key]; ok {
+		meta.heartbeat.pending = sendTime
 	}
-	return newBreaker(&ctx.breakerClock)
 }
 
-// setConnHealthy sets the health status of the connection.
-func (ctx *Context) setConnHealthy(remoteAddr string, healthy bool) {
+// heartbeatDone records the outcome of the heartbeat in flight over the
+// connection.
+func (ctx *Context) heartbeatDone(key connKey, succeeded bool) {
 	ctx.conns.Lock()
 	defer ctx.conns.Unlock()
 
-	meta, ok := ctx.conns.cache[remoteAddr]
-	if ok {
-		meta.healthy = healthy
-		ctx.conns.cache[remoteAddr] = meta
+	if meta, ok := ctx.conns.cache[key]; ok {
+		meta.heartbeat.pending = time.Time{}
+		if succeeded {
+			meta.heartbeat.succeeded = true
+			meta.heartbeat.failures = 0
+		} else {
+			meta.heartbeat.failures++
+		}
 	}
 }
 
-// IsConnHealthy returns whether the most recent heartbeat succeeded or not.
-// This should not be used as a definite status of a nodes health and just used
-// to prioritized healthy nodes over unhealthy ones.
+// IsConnHealthy returns whether the recent heartbeats on the DefaultClass
+// connection succeeded or not; see HeartbeatFailureThreshold. This should not
+// be used as a definite status of a nodes health and just used to prioritized
+// healthy nodes over unhealthy ones.
 func (ctx *Context) IsConnHealthy(remoteAddr string) bool {
+	return ctx.IsConnHealthyClass(remoteAddr, DefaultClass)
+}
+
+// IsConnHealthyClass is like IsConnHealthy, but for the connection of the
+// specified class.
+func (ctx *Context) IsConnHealthyClass(remoteAddr string, class ConnectionClass) bool {
+	if ctx.getLocalInternalServer(remoteAddr) != nil {
+		// Local calls don't use a connection; see GetInternalClient.
+		return true
+	}
 	ctx.conns.Lock()
 	defer ctx.conns.Unlock()
-	meta, ok := ctx.conns.cache[remoteAddr]
-	return ok && meta.healthy
+	meta, ok := ctx.conns.cache[connKey{target: remoteAddr, class: class}]
+	if !ok || !meta.heartbeat.succeeded {
+		return false
+	}
+	// The health is evaluated on every call rather than when heartbeats
+	// complete, so that callers such as DistSender's transport see peers
+	// which stopped responding as unhealthy without waiting for the
+	// heartbeat to time out.
+	failures := meta.heartbeat.failures
+	if pending := meta.heartbeat.pending; !pending.IsZero() &&
+		ctx.localClock.PhysicalTime().Sub(pending) > ctx.HeartbeatInterval {
+		failures++
+	}
+	return failures < ctx.HeartbeatFailureThreshold
 }
 
-func (ctx *Context) runHeartbeat(cc *grpc.ClientConn, remoteAddr string) error {
+func (ctx *Context) runHeartbeat(cc *grpc.ClientConn, key connKey) error {
 	request := PingRequest{
 		Addr:           ctx.Addr,
 		MaxOffsetNanos: ctx.localClock.MaxOffset().Nanoseconds(),
+		ServerVersion:  ctx.version,
+		MinVersion:     ctx.minVersion,
 	}
 	heartbeatClient := NewHeartbeatClient(cc)
 
@@ -296,9 +629,25 @@ func (ctx *Context) runHeartbeat(cc *grpc.ClientConn, remoteAddr string) error {
 			heartbeatTimer.Read = true
 		}
 
+		// The cluster ID is learned after connections have been established
+		// for nodes joining a cluster.
+		request.ClusterID = ctx.ClusterID()
 		sendTime := ctx.localClock.PhysicalTime()
+		ctx.heartbeatSent(key, sendTime)
 		response, err := ctx.heartbeat(heartbeatClient, request)
-		ctx.setConnHealthy(remoteAddr, err == nil)
+		if err == nil {
+			err = checkCompatibility(
+				key.target, request.ClusterID, ctx.version, ctx.minVersion,
+				response.ClusterID, response.ServerVersion, response.MinVersion,
+			)
+		}
+		if err == nil {
+			ctx.peerVersionKnown(key, response.ServerVersion)
+		}
+		ctx.heartbeatDone(key, err == nil)
+		if isIncompatibleError(err) {
+			return errors.Wrapf(err, "heartbeat to %s failed", key.target)
+		}
 		if err == nil {
 			receiveTime := ctx.localClock.PhysicalTime()
 
@@ -317,7 +666,8 @@ func (ctx *Context) runHeartbeat(cc *grpc.ClientConn, remoteAddr string) error {
 				remoteTimeNow := time.Unix(0, response.ServerTime).Add(pingDuration / 2)
 				request.Offset.Offset = remoteTimeNow.Sub(receiveTime).Nanoseconds()
 			}
-			ctx.RemoteClocks.UpdateOffset(remoteAddr, request.Offset)
+			ctx.RemoteClocks.UpdateOffset(key.target, request.Offset)
+			ctx.recordHeartbeatLatency(key.target, receiveTime.Sub(sendTime))
 
 			if cb := ctx.HeartbeatCB; cb != nil {
 				cb()
@@ -23,6 +23,7 @@ import (
 	"testing"
 	"time"
 
+	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 
@@ -30,9 +31,11 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/util"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/netutil"
 	"github.com/cockroachdb/cockroach/pkg/util/stop"
 	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/cockroach/pkg/util/uuid"
 	"github.com/pkg/errors"
 )
 
@@ -530,3 +533,250 @@ func TestRemoteOffsetUnhealthy(t *testing.T) {
 		}
 	}
 }
+
+// TestGRPCDialRetry verifies that failed dials are retried once their
+// backoff has expired.
+func TestGRPCDialRetry(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+
+	manual := hlc.NewManualClock(1)
+	clock := hlc.NewClock(manual.UnixNano, time.Nanosecond)
+	cfg := testutils.NewNodeTestBaseContext()
+	cfg.SSLCert = "missing.crt"
+	ctx := NewContext(log.AmbientContext{}, cfg, clock, stopper)
+	ctx.Breaker.RandomizationFactor = 0
+
+	const target = "127.0.0.1:1"
+	key := connKey{target: target, class: DefaultClass}
+	getMeta := func() *connMeta {
+		ctx.conns.Lock()
+		defer ctx.conns.Unlock()
+		return ctx.conns.cache[key]
+	}
+
+	if _, err := ctx.GRPCDial(target); err == nil {
+		t.Fatal("expected dial to fail")
+	}
+	first := getMeta()
+	if e, a := clock.PhysicalTime().Add(ctx.Breaker.InitialBackoff), first.retryAt; !a.Equal(e) {
+		t.Errorf("expected retry at %s, got %s", e, a)
+	}
+
+	// Before the backoff expires, the failure is returned without dialing.
+	if _, err := ctx.GRPCDial(target); err == nil {
+		t.Fatal("expected dial to fail")
+	}
+	if getMeta() != first {
+		t.Fatal("expected no new dial before the backoff expired")
+	}
+
+	// Afterwards, the connection is dialed again, with a longer backoff.
+	manual.Increment(ctx.Breaker.InitialBackoff.Nanoseconds())
+	if _, err := ctx.GRPCDial(target); err == nil {
+		t.Fatal("expected dial to fail")
+	}
+	second := getMeta()
+	if second == first {
+		t.Fatal("expected a new dial after the backoff expired")
+	}
+	backoff := time.Duration(float64(ctx.Breaker.InitialBackoff) * ctx.Breaker.Multiplier)
+	if e, a := clock.PhysicalTime().Add(backoff), second.retryAt; !a.Equal(e) {
+		t.Errorf("expected retry at %s, got %s", e, a)
+	}
+}
+
+// TestIncompatiblePeer verifies that connections to nodes of other
+// clusters or with incompatible versions fail with a descriptive error.
+func TestIncompatiblePeer(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+
+	manual := hlc.NewManualClock(1)
+	clock := hlc.NewClock(manual.UnixNano, time.Nanosecond)
+	serverCtx := newNodeTestContext(clock, stopper)
+	if err := serverCtx.SetClusterID(uuid.MakeV4()); err != nil {
+		t.Fatal(err)
+	}
+	ln, err := netutil.ListenAndServeGRPC(stopper, NewServer(serverCtx), util.TestAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remoteAddr := ln.Addr().String()
+
+	for _, tc := range []struct {
+		name   string
+		modify func(*Context) error
+		expErr string
+	}{
+		{"cluster", func(ctx *Context) error {
+			return ctx.SetClusterID(uuid.MakeV4())
+		}, "belongs to cluster"},
+		{"version", func(ctx *Context) error {
+			ctx.version, ctx.minVersion = serverVersion+1, serverVersion+1
+			return nil
+		}, "minimum version"},
+	} {
+		clientCtx := newNodeTestContext(clock, stopper)
+		if err := tc.modify(clientCtx); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := clientCtx.GRPCDial(remoteAddr); err != nil {
+			t.Fatalf("%s: %s", tc.name, err)
+		}
+		// The manual clock is not advanced, so the rejection is not retried.
+		util.SucceedsSoon(t, func() error {
+			_, err := clientCtx.GRPCDial(remoteAddr)
+			if !isIncompatibleError(err) {
+				return errors.Errorf("expected incompatibility error, got %v", err)
+			}
+			if !testutils.IsError(err, tc.expErr) {
+				t.Fatalf("%s: expected error %q, got %v", tc.name, tc.expErr, err)
+			}
+			return nil
+		})
+		if clientCtx.IsConnHealthy(remoteAddr) {
+			t.Errorf("%s: expected connection to be unhealthy", tc.name)
+		}
+	}
+
+	if err := serverCtx.SetClusterID(uuid.MakeV4()); !testutils.IsError(err, "cluster ID already set") {
+		t.Errorf("expected error changing the cluster ID, got %v", err)
+	}
+}
+
+// TestHeartbeatFailureThreshold verifies that connections are considered
+// unhealthy after the configured number of failed heartbeats, counting a
+// heartbeat in flight for longer than the heartbeat interval as failed.
+func TestHeartbeatFailureThreshold(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+
+	manual := hlc.NewManualClock(1)
+	clock := hlc.NewClock(manual.UnixNano, time.Nanosecond)
+	ctx := newNodeTestContext(clock, stopper)
+	ctx.HeartbeatInterval = time.Second
+	ctx.HeartbeatFailureThreshold = 2
+
+	const target = "peer"
+	key := connKey{target: target, class: DefaultClass}
+	ctx.conns.Lock()
+	ctx.conns.cache[key] = &connMeta{}
+	ctx.conns.Unlock()
+
+	expectHealthy := func(expected bool) {
+		if healthy := ctx.IsConnHealthy(target); healthy != expected {
+			t.Fatalf("%s: expected healthy=%t", testutils.Caller(1), expected)
+		}
+	}
+	heartbeat := func(succeeded bool) {
+		ctx.heartbeatSent(key, clock.PhysicalTime())
+		ctx.heartbeatDone(key, succeeded)
+	}
+
+	// Connections are unhealthy until a heartbeat succeeds.
+	expectHealthy(false)
+	heartbeat(true)
+	expectHealthy(true)
+
+	// A single failure is tolerated.
+	heartbeat(false)
+	expectHealthy(true)
+
+	// A heartbeat in flight for longer than the interval counts as failed.
+	ctx.heartbeatSent(key, clock.PhysicalTime())
+	expectHealthy(true)
+	manual.Increment(ctx.HeartbeatInterval.Nanoseconds() + 1)
+	expectHealthy(false)
+	ctx.heartbeatDone(key, true)
+	expectHealthy(true)
+
+	heartbeat(false)
+	heartbeat(false)
+	expectHealthy(false)
+	heartbeat(true)
+	expectHealthy(true)
+}
+
+// TestServerDrain verifies that stopping a server lets its in-flight RPCs
+// complete, and stops them once the drain timeout expires.
+func TestServerDrain(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	clock := hlc.NewClock(time.Unix(0, 1).UnixNano, time.Nanosecond)
+	clientStopper := stop.NewStopper()
+	defer clientStopper.Stop()
+	clientCtx := newNodeTestContext(clock, clientStopper)
+
+	for _, graceful := range []bool{true, false} {
+		drainTimeout := time.Millisecond
+		if graceful {
+			drainTimeout = time.Minute
+		}
+		restore := netutil.TestingSetGRPCDrainTimeout(drainTimeout)
+
+		stopper := stop.NewStopper()
+		serverCtx := newNodeTestContext(clock, stopper)
+		entered := make(chan struct{})
+		unblock := make(chan struct{})
+		serverCtx.UnaryInterceptors = append(serverCtx.UnaryInterceptors, func(
+			ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+		) (interface{}, error) {
+			if ping, ok := req.(*PingRequest); ok && ping.Ping == "drain" {
+				close(entered)
+				select {
+				case <-unblock:
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			}
+			return handler(ctx, req)
+		})
+		ln, err := netutil.ListenAndServeGRPC(stopper, NewServer(serverCtx), util.TestAddr)
+		restore()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn, err := clientCtx.GRPCDial(ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		errCh := make(chan error, 1)
+		go func() {
+			_, err := NewHeartbeatClient(conn).Ping(context.Background(), &PingRequest{Ping: "drain"})
+			errCh <- err
+		}()
+		<-entered
+		stopped := make(chan struct{})
+		go func() {
+			stopper.Stop()
+			close(stopped)
+		}()
+
+		if graceful {
+			select {
+			case <-stopped:
+				t.Fatal("expected the stopper to wait for the in-flight RPC")
+			case <-time.After(10 * time.Millisecond):
+			}
+			close(unblock)
+			if err := <-errCh; err != nil {
+				t.Errorf("expected the in-flight RPC to complete, got %v", err)
+			}
+			<-stopped
+		} else {
+			<-stopped
+			if err := <-errCh; err == nil {
+				t.Error("expected the in-flight RPC to fail")
+			}
+			close(unblock)
+		}
+	}
+}
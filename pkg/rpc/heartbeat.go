@@ -21,13 +21,67 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/pkg/errors"
 	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 
 	"github.com/cockroachdb/cockroach/pkg/security"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/stop"
+	"github.com/cockroachdb/cockroach/pkg/util/uuid"
 )
 
+// serverVersion is the version of this node, which it exchanges with its
+// peers in every heartbeat.
+//
+// Version 2 accepts snappy-compressed messages.
+const serverVersion = 2
+
+// minServerVersion is the minimum version of the peers this node is
+// compatible with.
+const minServerVersion = 1
+
+// compressionVersion is the first version whose nodes accept compressed
+// messages. Messages to peers of earlier versions are never compressed.
+const compressionVersion = 2
+
+// checkCompatibility returns an error if this node, which belongs to the
+// cluster clusterID and has the given versions, may not communicate with
+// the node at addr. A version or cluster ID of zero is unknown and not
+// checked (for unittests and nodes which have yet to join a cluster).
+func checkCompatibility(
+	addr string,
+	clusterID uuid.UUID,
+	version, minVersion uint32,
+	peerClusterID uuid.UUID,
+	peerVersion, peerMinVersion uint32,
+) error {
+	if version != 0 && peerVersion != 0 {
+		if peerVersion < minVersion {
+			return grpc.Errorf(codes.FailedPrecondition,
+				"node %s has version %d; the minimum version compatible with this node (version %d) is %d",
+				addr, peerVersion, version, minVersion)
+		}
+		if version < peerMinVersion {
+			return grpc.Errorf(codes.FailedPrecondition,
+				"this node has version %d; the minimum version compatible with node %s (version %d) is %d",
+				version, addr, peerVersion, peerMinVersion)
+		}
+	}
+	if clusterID != (uuid.UUID{}) && peerClusterID != (uuid.UUID{}) && clusterID != peerClusterID {
+		return grpc.Errorf(codes.FailedPrecondition,
+			"node %s belongs to cluster %s, not to cluster %s", addr, peerClusterID, clusterID)
+	}
+	return nil
+}
+
+// isIncompatibleError returns true if the error is the result of a failed
+// compatibility check, either on this node or on the peer.
+func isIncompatibleError(err error) bool {
+	return grpc.Code(errors.Cause(err)) == codes.FailedPrecondition
+}
+
 var _ security.RequestWithUser = &PingRequest{}
 
 // GetUser implements security.RequestWithUser.
@@ -55,12 +109,26 @@ type HeartbeatService struct {
 	// A pointer to the RemoteClockMonitor configured in the RPC Context,
 	// shared by rpc clients, to keep track of remote clock measurements.
 	remoteClockMonitor *RemoteClockMonitor
+	// Invoked after the offset reported by a client has been recorded, if
+	// non-nil. Clients measure offsets more frequently than this node does
+	// when few connections originate from it.
+	heartbeatCB func()
+	// Invoked with the version of the client after its compatibility has
+	// been checked, if non-nil. Responses are only compressed for clients
+	// whose version supports it.
+	versionCB func(ctx context.Context, version uint32)
+	// The ID of the cluster this node belongs to, if non-nil, and the
+	// versions of this node. Clients which are not compatible with this
+	// node are refused; see checkCompatibility.
+	clusterID           func() uuid.UUID
+	version, minVersion uint32
 }
 
 // Ping echos the contents of the request to the response, and returns the
 // server's current clock value, allowing the requester to measure its clock.
 // The requester should also estimate its offset from this server along
-// with the requester's address.
+// with the requester's address. Requesters which are not compatible with
+// this node are refused with a FailedPrecondition error.
 func (hs *HeartbeatService) Ping(ctx context.Context, args *PingRequest) (*PingResponse, error) {
 	// Enforce that clock max offsets are identical between nodes.
 	// Commit suicide in the event that this is ever untrue.
@@ -70,13 +138,31 @@ func (hs *HeartbeatService) Ping(ctx context.Context, args *PingRequest) (*PingR
 		panic(fmt.Sprintf("locally configured maximum clock offset (%s) "+
 			"does not match that of node %s (%s)", mo, args.Addr, amo))
 	}
+	var clusterID uuid.UUID
+	if hs.clusterID != nil {
+		clusterID = hs.clusterID()
+	}
+	if err := checkCompatibility(
+		args.Addr, clusterID, hs.version, hs.minVersion, args.ClusterID, args.ServerVersion, args.MinVersion,
+	); err != nil {
+		return nil, err
+	}
+	if hs.versionCB != nil {
+		hs.versionCB(ctx, args.ServerVersion)
+	}
 	serverOffset := args.Offset
 	// The server offset should be the opposite of the client offset.
 	serverOffset.Offset = -serverOffset.Offset
 	hs.remoteClockMonitor.UpdateOffset(args.Addr, serverOffset)
+	if hs.heartbeatCB != nil {
+		hs.heartbeatCB()
+	}
 	return &PingResponse{
-		Pong:       args.Ping,
-		ServerTime: hs.clock.PhysicalNow(),
+		Pong:          args.Ping,
+		ServerTime:    hs.clock.PhysicalNow(),
+		ClusterID:     clusterID,
+		ServerVersion: hs.version,
+		MinVersion:    hs.minVersion,
 	}, nil
 }
 
@@ -24,8 +24,10 @@ import (
 
 	"golang.org/x/net/context"
 
+	"github.com/cockroachdb/cockroach/pkg/testutils"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/uuid"
 )
 
 func TestRemoteOffsetString(t *testing.T) {
@@ -67,6 +69,58 @@ func TestHeartbeatReply(t *testing.T) {
 	}
 }
 
+// TestHeartbeatCompatibility verifies that heartbeats from nodes of other
+// clusters or with incompatible versions are refused.
+func TestHeartbeatCompatibility(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	clock := hlc.NewClock(hlc.NewManualClock(5).UnixNano, time.Nanosecond)
+	clusterID, otherClusterID := uuid.MakeV4(), uuid.MakeV4()
+	heartbeat := &HeartbeatService{
+		clock:              clock,
+		remoteClockMonitor: newRemoteClockMonitor(context.TODO(), clock, time.Hour),
+		clusterID:          func() uuid.UUID { return clusterID },
+		version:            3,
+		minVersion:         2,
+	}
+
+	for i, tc := range []struct {
+		clusterID           uuid.UUID
+		version, minVersion uint32
+		expErr              string
+	}{
+		{clusterID, 3, 2, ""},
+		{clusterID, 2, 1, ""},
+		{clusterID, 4, 3, ""},
+		// Unknown cluster IDs and versions are not checked.
+		{uuid.UUID{}, 3, 2, ""},
+		{clusterID, 0, 0, ""},
+		{otherClusterID, 3, 2, "belongs to cluster"},
+		{clusterID, 1, 1, "has version 1"},
+		{clusterID, 5, 4, "this node has version 3"},
+	} {
+		request := &PingRequest{
+			Addr:          "test",
+			ClusterID:     tc.clusterID,
+			ServerVersion: tc.version,
+			MinVersion:    tc.minVersion,
+		}
+		response, err := heartbeat.Ping(context.Background(), request)
+		if tc.expErr == "" {
+			if err != nil {
+				t.Errorf("%d: unexpected error: %v", i, err)
+			} else if response.ClusterID != clusterID || response.ServerVersion != 3 || response.MinVersion != 2 {
+				t.Errorf("%d: unexpected response: %+v", i, response)
+			}
+			continue
+		}
+		if !isIncompatibleError(err) {
+			t.Errorf("%d: expected incompatibility error, got %v", i, err)
+		} else if !testutils.IsError(err, tc.expErr) {
+			t.Errorf("%d: expected error %q, got %v", i, tc.expErr, err)
+		}
+	}
+}
+
 func TestManualHeartbeat(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	manual := hlc.NewManualClock(5)
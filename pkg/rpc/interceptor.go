@@ -0,0 +1,71 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package rpc
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// chainUnaryServerInterceptors returns a grpc.UnaryServerInterceptor which
+// invokes the specified interceptors in order, each wrapping the ones
+// following it and the handler. gRPC accepts a single interceptor per
+// server, which makes chaining necessary to layer interceptors. Returns
+// nil if no interceptors are specified.
+func chainUnaryServerInterceptors(
+	interceptors ...grpc.UnaryServerInterceptor,
+) grpc.UnaryServerInterceptor {
+	switch len(interceptors) {
+	case 0:
+		return nil
+	case 1:
+		return interceptors[0]
+	}
+	return func(
+		ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		for i := len(interceptors) - 1; i > 0; i-- {
+			interceptor, next := interceptors[i], handler
+			handler = func(ctx context.Context, req interface{}) (interface{}, error) {
+				return interceptor(ctx, req, info, next)
+			}
+		}
+		return interceptors[0](ctx, req, info, handler)
+	}
+}
+
+// chainStreamServerInterceptors is like chainUnaryServerInterceptors, but
+// for streaming RPCs.
+func chainStreamServerInterceptors(
+	interceptors ...grpc.StreamServerInterceptor,
+) grpc.StreamServerInterceptor {
+	switch len(interceptors) {
+	case 0:
+		return nil
+	case 1:
+		return interceptors[0]
+	}
+	return func(
+		srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler,
+	) error {
+		for i := len(interceptors) - 1; i > 0; i-- {
+			interceptor, next := interceptors[i], handler
+			handler = func(srv interface{}, ss grpc.ServerStream) error {
+				return interceptor(srv, ss, info, next)
+			}
+		}
+		return interceptors[0](srv, ss, info, handler)
+	}
+}
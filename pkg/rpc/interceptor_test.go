@@ -0,0 +1,141 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package rpc
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	"github.com/cockroachdb/cockroach/pkg/util"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/netutil"
+	"github.com/cockroachdb/cockroach/pkg/util/stop"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+)
+
+func TestChainUnaryServerInterceptors(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	var calls []string
+	interceptor := func(name string) grpc.UnaryServerInterceptor {
+		return func(
+			ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+		) (interface{}, error) {
+			calls = append(calls, name+" "+info.FullMethod)
+			resp, err := handler(ctx, req)
+			calls = append(calls, name+" done")
+			return resp, err
+		}
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		calls = append(calls, "handler")
+		return req, nil
+	}
+
+	if chainUnaryServerInterceptors() != nil {
+		t.Error("expected no interceptor")
+	}
+	chain := chainUnaryServerInterceptors(interceptor("a"), interceptor("b"), interceptor("c"))
+	info := &grpc.UnaryServerInfo{FullMethod: "/test/Method"}
+	for i := 0; i < 2; i++ {
+		calls = nil
+		if resp, err := chain(context.Background(), "req", info, handler); err != nil {
+			t.Fatal(err)
+		} else if resp != "req" {
+			t.Fatalf("unexpected response %v", resp)
+		}
+		expected := []string{
+			"a /test/Method", "b /test/Method", "c /test/Method",
+			"handler", "c done", "b done", "a done",
+		}
+		if !reflect.DeepEqual(calls, expected) {
+			t.Errorf("%d: expected calls %s, got %s", i, expected, calls)
+		}
+	}
+}
+
+func TestChainStreamServerInterceptors(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	var calls []string
+	interceptor := func(name string) grpc.StreamServerInterceptor {
+		return func(
+			srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler,
+		) error {
+			calls = append(calls, name)
+			return handler(srv, ss)
+		}
+	}
+	handler := func(srv interface{}, ss grpc.ServerStream) error {
+		calls = append(calls, "handler")
+		return nil
+	}
+
+	chain := chainStreamServerInterceptors(interceptor("a"), interceptor("b"))
+	if err := chain(nil, nil, &grpc.StreamServerInfo{}, handler); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"a", "b", "handler"}; !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected calls %s, got %s", expected, calls)
+	}
+}
+
+// TestContextInterceptors verifies that the servers created from a context
+// invoke its interceptors.
+func TestContextInterceptors(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+
+	clock := hlc.NewClock(time.Unix(0, 1).UnixNano, time.Nanosecond)
+	serverCtx := newNodeTestContext(clock, stopper)
+	var mu struct {
+		syncutil.Mutex
+		methods []string
+	}
+	serverCtx.UnaryInterceptors = append(serverCtx.UnaryInterceptors, func(
+		ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		mu.Lock()
+		mu.methods = append(mu.methods, info.FullMethod)
+		mu.Unlock()
+		return handler(ctx, req)
+	})
+	ln, err := netutil.ListenAndServeGRPC(stopper, NewServer(serverCtx), util.TestAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientCtx := newNodeTestContext(clock, stopper)
+	conn, err := clientCtx.GRPCDial(ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewHeartbeatClient(conn).Ping(context.Background(), &PingRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(mu.methods) == 0 || mu.methods[0] != "/cockroach.rpc.Heartbeat/Ping" {
+		t.Errorf("expected interceptor to see heartbeats, got %s", mu.methods)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package rpc
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/util/envutil"
+)
+
+// Allow local calls to be dispatched directly to the local server without
+// sending an RPC.
+var enableLocalCalls = envutil.EnvOrDefaultBool("COCKROACH_ENABLE_LOCAL_CALLS", true)
+
+// GetInternalClient returns a client for the Internal service of the node at
+// target, using a connection of the specified class. If target is this node
+// and its internal server has been set with SetLocalInternalServer, the
+// returned client invokes the server directly, bypassing serialization and
+// gRPC. The caller's context, including its deadline, cancellation and
+// tracing span, is passed to the server as is.
+func (ctx *Context) GetInternalClient(
+	target string, class ConnectionClass,
+) (roachpb.InternalClient, error) {
+	if localServer := ctx.getLocalInternalServer(target); localServer != nil {
+		return internalClientAdapter{server: localServer}, nil
+	}
+	conn, err := ctx.GRPCDialClass(target, class)
+	if err != nil {
+		return nil, err
+	}
+	return roachpb.NewInternalClient(conn), nil
+}
+
+// getLocalInternalServer returns the local internal server if target is
+// this node and local calls are enabled, and nil otherwise.
+func (ctx *Context) getLocalInternalServer(target string) roachpb.InternalServer {
+	if !enableLocalCalls {
+		return nil
+	}
+	return ctx.GetLocalInternalServerForAddr(target)
+}
+
+// internalClientAdapter implements roachpb.InternalClient by invoking a
+// roachpb.InternalServer directly.
+type internalClientAdapter struct {
+	server roachpb.InternalServer
+}
+
+var _ roachpb.InternalClient = internalClientAdapter{}
+
+// Batch implements roachpb.InternalClient.
+func (a internalClientAdapter) Batch(
+	ctx context.Context, ba *roachpb.BatchRequest, _ ...grpc.CallOption,
+) (*roachpb.BatchResponse, error) {
+	// Clone the transaction. At the time of writing, Replica may mutate it
+	// during command execution which can lead to data races with the caller,
+	// which would not share it with the server if the request was sent over
+	// the wire.
+	//
+	// TODO(tamird): we should clone all of the Header, but the assertions in
+	// protoutil.Clone fire and there seems to be no reasonable workaround.
+	if ba.Txn != nil {
+		baCopy := *ba
+		txn := ba.Txn.Clone()
+		baCopy.Txn = &txn
+		ba = &baCopy
+	}
+	return a.server.Batch(ctx, ba)
+}
@@ -0,0 +1,84 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package rpc
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/stop"
+)
+
+type ctxKey struct{}
+
+// mutatingInternalServer records the context of the last batch and mutates
+// the batch's transaction, as Replica may do.
+type mutatingInternalServer struct {
+	ctx context.Context
+}
+
+func (s *mutatingInternalServer) Batch(
+	ctx context.Context, ba *roachpb.BatchRequest,
+) (*roachpb.BatchResponse, error) {
+	s.ctx = ctx
+	if ba.Txn != nil {
+		ba.Txn.Epoch++
+	}
+	return &roachpb.BatchResponse{}, nil
+}
+
+// TestInternalClientLocal verifies that internal clients for the local node
+// invoke the local server directly with the caller's context, without
+// sharing the caller's transaction.
+func TestInternalClientLocal(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+
+	clock := hlc.NewClock(time.Unix(0, 1).UnixNano, time.Nanosecond)
+	ctx := newNodeTestContext(clock, stopper)
+	server := &mutatingInternalServer{}
+	ctx.SetLocalInternalServer(server)
+
+	client, err := ctx.GetInternalClient(ctx.Addr, SystemClass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := client.(internalClientAdapter); !ok {
+		t.Fatalf("expected local client, got %T", client)
+	}
+	if !ctx.IsConnHealthyClass(ctx.Addr, SystemClass) {
+		t.Error("expected local connection to be healthy")
+	}
+
+	callCtx := context.WithValue(context.Background(), ctxKey{}, "value")
+	ba := &roachpb.BatchRequest{}
+	ba.Txn = &roachpb.Transaction{}
+	if _, err := client.Batch(callCtx, ba); err != nil {
+		t.Fatal(err)
+	}
+	if v := server.ctx.Value(ctxKey{}); v != "value" {
+		t.Errorf("expected the caller's context to be passed to the server, got value %v", v)
+	}
+	if ba.Txn.Epoch != 0 {
+		t.Errorf("expected the caller's transaction to remain unchanged, got epoch %d", ba.Txn.Epoch)
+	}
+}
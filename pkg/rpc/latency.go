@@ -0,0 +1,82 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package rpc
+
+import (
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/util/metric"
+)
+
+// defaultMetricsSampleInterval is the default value of
+// Context.MetricsSampleInterval.
+const defaultMetricsSampleInterval = 10 * time.Second
+
+var metaHeartbeatLatency = metric.Metadata{
+	Name: "rpc.heartbeat.latency",
+	Help: "Round-trip latency of heartbeats to a peer"}
+
+// PeerLatency summarizes the round-trip latencies of the heartbeats to a
+// peer over the last sample interval.
+type PeerLatency struct {
+	Count int64         `json:"count"`
+	Mean  time.Duration `json:"mean"`
+	P50   time.Duration `json:"p50"`
+	P99   time.Duration `json:"p99"`
+	Max   time.Duration `json:"max"`
+}
+
+// recordHeartbeatLatency records the round-trip latency of a successful
+// heartbeat to the specified peer. The histogram of a peer is created on
+// its first heartbeat; it carries the peer's address as a label.
+func (ctx *Context) recordHeartbeatLatency(target string, latency time.Duration) {
+	ctx.peerLatencies.Lock()
+	defer ctx.peerLatencies.Unlock()
+	h, ok := ctx.peerLatencies.histograms[target]
+	if !ok {
+		meta := metaHeartbeatLatency
+		meta.AddLabel("peer", target)
+		h = metric.NewLatency(meta, ctx.MetricsSampleInterval)
+		ctx.peerLatencies.histograms[target] = h
+		ctx.peerLatencies.registry.AddMetric(h)
+	}
+	h.RecordValue(latency.Nanoseconds())
+}
+
+// PeerLatencies returns the heartbeat latencies to all peers this context
+// has heartbeated, keyed by peer address.
+func (ctx *Context) PeerLatencies() map[string]PeerLatency {
+	ctx.peerLatencies.Lock()
+	defer ctx.peerLatencies.Unlock()
+	latencies := make(map[string]PeerLatency, len(ctx.peerLatencies.histograms))
+	for target, h := range ctx.peerLatencies.histograms {
+		curr, _ := h.Windowed()
+		latencies[target] = PeerLatency{
+			Count: curr.TotalCount(),
+			Mean:  time.Duration(curr.Mean()),
+			P50:   time.Duration(curr.ValueAtQuantile(50)),
+			P99:   time.Duration(curr.ValueAtQuantile(99)),
+			Max:   time.Duration(curr.Max()),
+		}
+	}
+	return latencies
+}
+
+// PeerLatencyRegistry returns the registry holding the per-peer heartbeat
+// latency histograms. The histograms are distinguished by a label rather
+// than by name, so they are meant to be exported to prometheus only.
+func (ctx *Context) PeerLatencyRegistry() *metric.Registry {
+	return ctx.peerLatencies.registry
+}
@@ -0,0 +1,98 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package rpc
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cockroachdb/cockroach/pkg/util"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/metric"
+	"github.com/cockroachdb/cockroach/pkg/util/netutil"
+	"github.com/cockroachdb/cockroach/pkg/util/stop"
+)
+
+func TestPeerLatencies(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+
+	clock := hlc.NewClock(time.Unix(0, 1).UnixNano, time.Nanosecond)
+	ctx := newNodeTestContext(clock, stopper)
+	ctx.MetricsSampleInterval = metric.TestSampleInterval
+
+	for _, latency := range []time.Duration{10 * time.Millisecond, 20 * time.Millisecond} {
+		ctx.recordHeartbeatLatency("a", latency)
+	}
+	ctx.recordHeartbeatLatency("b", 100*time.Millisecond)
+
+	latencies := ctx.PeerLatencies()
+	if len(latencies) != 2 {
+		t.Fatalf("expected latencies of 2 peers, got %+v", latencies)
+	}
+	if a := latencies["a"]; a.Count != 2 || a.Max < 20*time.Millisecond || a.Max > 30*time.Millisecond {
+		t.Errorf("unexpected latency of a: %+v", a)
+	}
+	if b := latencies["b"]; b.Count != 1 || b.P50 < 100*time.Millisecond || b.P50 > 110*time.Millisecond {
+		t.Errorf("unexpected latency of b: %+v", b)
+	}
+
+	// The histograms are exported with the peer as a label.
+	exporter := metric.MakePrometheusExporter()
+	exporter.ScrapeRegistry(ctx.PeerLatencyRegistry())
+	var buf bytes.Buffer
+	if err := exporter.PrintAsText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, peer := range []string{"a", "b"} {
+		if expected := []byte(`peer="` + peer + `"`); !bytes.Contains(buf.Bytes(), expected) {
+			t.Errorf("expected %s in exported metrics, got %s", expected, buf.Bytes())
+		}
+	}
+}
+
+// TestHeartbeatLatency verifies that heartbeats record the latencies to
+// their peers.
+func TestHeartbeatLatency(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+
+	clock := hlc.NewClock(time.Unix(0, 1).UnixNano, time.Nanosecond)
+	serverCtx := newNodeTestContext(clock, stopper)
+	ln, err := netutil.ListenAndServeGRPC(stopper, NewServer(serverCtx), util.TestAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remoteAddr := ln.Addr().String()
+
+	clientCtx := newNodeTestContext(clock, stopper)
+	if _, err := clientCtx.GRPCDial(remoteAddr); err != nil {
+		t.Fatal(err)
+	}
+	util.SucceedsSoon(t, func() error {
+		if l, ok := clientCtx.PeerLatencies()[remoteAddr]; !ok || l.Count == 0 {
+			return errors.Errorf("expected heartbeat latencies to %s, got %+v", remoteAddr, clientCtx.PeerLatencies())
+		}
+		return nil
+	})
+}
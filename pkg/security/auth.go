@@ -49,6 +49,25 @@ func GetCertificateUser(tlsState *tls.ConnectionState) (string, error) {
 	return tlsState.PeerCertificates[0].Subject.CommonName, nil
 }
 
+// CheckNodeCertificate returns an error unless the client certificate
+// identifies a node, either through its common name or through one of its
+// organizational units.
+func CheckNodeCertificate(tlsState *tls.ConnectionState) error {
+	certUser, err := GetCertificateUser(tlsState)
+	if err != nil {
+		return err
+	}
+	if certUser == NodeUser {
+		return nil
+	}
+	for _, ou := range tlsState.PeerCertificates[0].Subject.OrganizationalUnit {
+		if ou == NodeUser {
+			return nil
+		}
+	}
+	return errors.Errorf("user %s is not a node", certUser)
+}
+
 // RequestWithUser must be implemented by `roachpb.Request`s which are
 // arguments to methods that are not permitted to skip user checks.
 type RequestWithUser interface {
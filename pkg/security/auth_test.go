@@ -50,6 +50,27 @@ func makeFakeTLSState(commonNames []string, chainLengths []int) *tls.ConnectionS
 	return tls
 }
 
+func TestCheckNodeCertificate(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	if err := security.CheckNodeCertificate(makeFakeTLSState([]string{security.NodeUser}, []int{1})); err != nil {
+		t.Error(err)
+	}
+	if err := security.CheckNodeCertificate(makeFakeTLSState([]string{"foo"}, []int{1})); err == nil {
+		t.Error("unexpected success")
+	}
+	if err := security.CheckNodeCertificate(makeFakeTLSState(nil, nil)); err == nil {
+		t.Error("unexpected success")
+	}
+
+	// A node may also be identified by its organizational unit.
+	state := makeFakeTLSState([]string{"node1.example.com"}, []int{1})
+	state.PeerCertificates[0].Subject.OrganizationalUnit = []string{security.NodeUser}
+	if err := security.CheckNodeCertificate(state); err != nil {
+		t.Error(err)
+	}
+}
+
 func TestGetCertificateUser(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	// Nil TLS state.
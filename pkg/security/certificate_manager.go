@@ -0,0 +1,211 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package security
+
+import (
+	"bytes"
+	"crypto/tls"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/stop"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+)
+
+// CertificateManager loads the CA certificate and the node certificate and
+// key, and hands out TLS configs built from them. The certificates can be
+// replaced on disk while the process is running: Reload, which is invoked
+// periodically and on SIGHUP once Monitor is called, picks up the new files.
+// Connections established after a reload use the new certificates, while
+// established connections are left alone.
+type CertificateManager struct {
+	sslCA, sslCert, sslCertKey string
+
+	mu struct {
+		syncutil.RWMutex
+		// The PEM data the current configs were built from, used to detect
+		// changes on disk.
+		certPEM, keyPEM, caPEM []byte
+		cert                   *tls.Certificate
+		serverConfig           *tls.Config
+		clientConfig           *tls.Config
+	}
+}
+
+// NewCertificateManager creates a CertificateManager and loads the
+// certificates at the specified paths. See LoadServerTLSConfig for the
+// meaning of the paths.
+func NewCertificateManager(sslCA, sslCert, sslCertKey string) (*CertificateManager, error) {
+	cm := &CertificateManager{
+		sslCA:      sslCA,
+		sslCert:    sslCert,
+		sslCertKey: sslCertKey,
+	}
+	if err := cm.Reload(); err != nil {
+		return nil, err
+	}
+	return cm, nil
+}
+
+// Reload reads the certificates from disk and, if they changed since they
+// were last loaded, replaces the TLS configs handed out to new connections.
+// If the new certificates cannot be loaded, an error is returned and the
+// previous certificates remain in use.
+func (cm *CertificateManager) Reload() error {
+	certPEM, err := readFileFn(cm.sslCert)
+	if err != nil {
+		return err
+	}
+	keyPEM, err := readFileFn(cm.sslCertKey)
+	if err != nil {
+		return err
+	}
+	caPEM, err := readFileFn(cm.sslCA)
+	if err != nil {
+		return err
+	}
+
+	cm.mu.RLock()
+	unchanged := cm.mu.serverConfig != nil &&
+		bytes.Equal(certPEM, cm.mu.certPEM) &&
+		bytes.Equal(keyPEM, cm.mu.keyPEM) &&
+		bytes.Equal(caPEM, cm.mu.caPEM)
+	cm.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	serverConfig, err := newServerTLSConfig(certPEM, keyPEM, caPEM)
+	if err != nil {
+		return err
+	}
+	clientConfig, err := newClientTLSConfig(certPEM, keyPEM, caPEM)
+	if err != nil {
+		return err
+	}
+	// The server certificate is served through GetCertificate so that TLS
+	// configs obtained before a reload, such as the one used by the HTTP
+	// server, serve the new certificate as well.
+	cert := serverConfig.Certificates[0]
+	serverConfig.Certificates = nil
+	serverConfig.GetCertificate = cm.getCertificate
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.mu.certPEM, cm.mu.keyPEM, cm.mu.caPEM = certPEM, keyPEM, caPEM
+	cm.mu.cert = &cert
+	cm.mu.serverConfig = serverConfig
+	cm.mu.clientConfig = clientConfig
+	return nil
+}
+
+// getCertificate implements tls.Config.GetCertificate.
+func (cm *CertificateManager) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.mu.cert, nil
+}
+
+// ServerTLSConfig returns the current server TLS config. The returned config
+// must not be modified.
+func (cm *CertificateManager) ServerTLSConfig() *tls.Config {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.mu.serverConfig
+}
+
+// ClientTLSConfig returns the current client TLS config. The returned config
+// must not be modified.
+func (cm *CertificateManager) ClientTLSConfig() *tls.Config {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.mu.clientConfig
+}
+
+// ServerCredentials returns gRPC transport credentials which perform server
+// handshakes using the current server TLS config.
+func (cm *CertificateManager) ServerCredentials() credentials.TransportCredentials {
+	return reloadingCredentials{getConfig: cm.ServerTLSConfig}
+}
+
+// ClientCredentials returns gRPC transport credentials which perform client
+// handshakes using the current client TLS config. Unlike credentials created
+// from a fixed TLS config, reconnections of a long-lived gRPC connection pick
+// up reloaded certificates.
+func (cm *CertificateManager) ClientCredentials() credentials.TransportCredentials {
+	return reloadingCredentials{getConfig: cm.ClientTLSConfig}
+}
+
+// Monitor starts a worker which reloads the certificates every interval, if
+// positive, and whenever the process receives SIGHUP. Failed reloads are
+// logged and leave the current certificates in place.
+func (cm *CertificateManager) Monitor(stopper *stop.Stopper, interval time.Duration) {
+	ctx := context.TODO()
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, syscall.SIGHUP)
+	stopper.RunWorker(func() {
+		defer signal.Stop(signalCh)
+		var tickC <-chan time.Time
+		if interval > 0 {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			tickC = ticker.C
+		}
+		for {
+			select {
+			case <-tickC:
+			case <-signalCh:
+				log.Infof(ctx, "received SIGHUP, reloading certificates")
+			case <-stopper.ShouldStop():
+				return
+			}
+			if err := cm.Reload(); err != nil {
+				log.Warningf(ctx, "unable to reload certificates: %s", err)
+			}
+		}
+	})
+}
+
+// reloadingCredentials implements credentials.TransportCredentials by
+// delegating every handshake to TLS credentials built from the config
+// returned by getConfig at the time of the handshake.
+type reloadingCredentials struct {
+	getConfig func() *tls.Config
+}
+
+var _ credentials.TransportCredentials = reloadingCredentials{}
+
+func (c reloadingCredentials) ClientHandshake(
+	ctx context.Context, addr string, rawConn net.Conn,
+) (net.Conn, credentials.AuthInfo, error) {
+	return credentials.NewTLS(c.getConfig()).ClientHandshake(ctx, addr, rawConn)
+}
+
+func (c reloadingCredentials) ServerHandshake(
+	rawConn net.Conn,
+) (net.Conn, credentials.AuthInfo, error) {
+	return credentials.NewTLS(c.getConfig()).ServerHandshake(rawConn)
+}
+
+func (c reloadingCredentials) Info() credentials.ProtocolInfo {
+	return credentials.NewTLS(c.getConfig()).Info()
+}
@@ -0,0 +1,103 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package security_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/security"
+	"github.com/cockroachdb/cockroach/pkg/security/securitytest"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+)
+
+func servedCommonName(t *testing.T, config *tls.Config) string {
+	cert, err := config.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	x509Cert, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return x509Cert.Subject.CommonName
+}
+
+// TestCertificateManagerReload verifies that reloading the certificate
+// manager picks up certificates which changed on disk, and that failed
+// reloads leave the previous certificates in place.
+func TestCertificateManagerReload(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer ResetTest()
+
+	nodeCert := filepath.Join(security.EmbeddedCertsDir, security.EmbeddedNodeCert)
+	nodeKey := filepath.Join(security.EmbeddedCertsDir, security.EmbeddedNodeKey)
+	// Maps the node certificate paths to the files currently "on disk".
+	files := map[string]string{
+		nodeCert: nodeCert,
+		nodeKey:  nodeKey,
+	}
+	security.SetReadFileFn(func(path string) ([]byte, error) {
+		if f, ok := files[path]; ok {
+			path = f
+		}
+		return securitytest.Asset(path)
+	})
+
+	cm, err := security.NewCertificateManager(
+		filepath.Join(security.EmbeddedCertsDir, security.EmbeddedCACert), nodeCert, nodeKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig := cm.ServerTLSConfig()
+	clientConfig := cm.ClientTLSConfig()
+	if cn := servedCommonName(t, serverConfig); cn != security.NodeUser {
+		t.Fatalf("expected %s certificate, got %s", security.NodeUser, cn)
+	}
+
+	// Reloading unchanged certificates keeps the current configs.
+	if err := cm.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if cm.ServerTLSConfig() != serverConfig || cm.ClientTLSConfig() != clientConfig {
+		t.Fatal("expected unchanged certificates to keep the current configs")
+	}
+
+	// Replace the node certificate.
+	files[nodeCert] = filepath.Join(security.EmbeddedCertsDir, security.EmbeddedRootCert)
+	files[nodeKey] = filepath.Join(security.EmbeddedCertsDir, security.EmbeddedRootKey)
+	if err := cm.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if cm.ClientTLSConfig() == clientConfig {
+		t.Fatal("expected a new client config")
+	}
+	for i, config := range []*tls.Config{cm.ServerTLSConfig(), serverConfig} {
+		if cn := servedCommonName(t, config); cn != security.RootUser {
+			t.Errorf("%d: expected %s certificate, got %s", i, security.RootUser, cn)
+		}
+	}
+
+	// A mismatched certificate and key fail to load.
+	files[nodeKey] = filepath.Join(security.EmbeddedCertsDir, security.EmbeddedTestUserKey)
+	if err := cm.Reload(); err == nil {
+		t.Fatal("expected error reloading mismatched certificate and key")
+	}
+	if cn := servedCommonName(t, cm.ServerTLSConfig()); cn != security.RootUser {
+		t.Errorf("expected %s certificate, got %s", security.RootUser, cn)
+	}
+}
@@ -148,6 +148,7 @@ func GenerateServerCert(
 	if err != nil {
 		return nil, nil, err
 	}
+	template.Subject.OrganizationalUnit = []string{NodeUser}
 
 	// Only server authentication is allowed.
 	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
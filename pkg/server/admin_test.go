@@ -222,6 +222,94 @@ func TestAdminDebugRedirect(t *testing.T) {
 	}
 }
 
+// TestAdminDebugCompact verifies that the /debug/compact endpoint compacts
+// the stores and is only available to administrators via POST.
+func TestAdminDebugCompact(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	s, _, _ := serverutils.StartServer(t, base.TestServerArgs{})
+	defer s.Stopper().Stop()
+
+	compactURL := s.AdminURL() + debugCompactEndpoint + "?start=/Table&end=/Max"
+	post := func(client http.Client) (int, []byte) {
+		resp, err := client.PostForm(compactURL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, body
+	}
+
+	nodeClient, err := s.GetHTTPClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, body := post(nodeClient); code != http.StatusOK {
+		t.Fatalf("expected status code %d; got %d: %s", http.StatusOK, code, body)
+	} else if exp := "on 1 stores"; !bytes.Contains(body, []byte(exp)) {
+		t.Errorf("expected %s to contain %s", body, exp)
+	}
+
+	resp, err := nodeClient.Get(compactURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected status code %d; got %d", http.StatusMethodNotAllowed, resp.StatusCode)
+	}
+
+	userClient, err := testutils.NewTestBaseContext(TestUser).GetHTTPClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, body := post(userClient); code != http.StatusForbidden {
+		t.Errorf("expected status code %d; got %d: %s", http.StatusForbidden, code, body)
+	}
+}
+
+// TestAdminDebugRateLimit verifies that the background rate limit can only be
+// changed by POSTing to the /debug/ratelimit/ endpoint.
+func TestAdminDebugRateLimit(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	s, _, _ := serverutils.StartServer(t, base.TestServerArgs{})
+	defer s.Stopper().Stop()
+
+	client, err := s.GetHTTPClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rateLimitURL := s.AdminURL() + debugRateLimitEndpoint + "50MiB"
+
+	resp, err := client.Get(rateLimitURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected status code %d; got %d", http.StatusMethodNotAllowed, resp.StatusCode)
+	}
+
+	resp, err = client.PostForm(rateLimitURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status code %d; got %d: %s", http.StatusOK, resp.StatusCode, body)
+	}
+	if exp := "50 MiB/s"; !bytes.Contains(body, []byte(exp)) {
+		t.Errorf("expected %s to contain %s", body, exp)
+	}
+}
+
 func TestAdminAPIDatabases(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	s, _, _ := serverutils.StartServer(t, base.TestServerArgs{})
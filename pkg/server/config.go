@@ -20,6 +20,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"math"
+	"os"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
@@ -45,17 +47,20 @@ import (
 
 // Context defaults.
 const (
-	defaultCGroupMemPath            = "/sys/fs/cgroup/memory/memory.limit_in_bytes"
-	defaultMaxOffset                = 250 * time.Millisecond
-	defaultCacheSize                = 512 << 20 // 512 MB
-	defaultSQLMemoryPoolSize        = 512 << 20 // 512 MB
-	defaultScanInterval             = 10 * time.Minute
-	defaultConsistencyCheckInterval = 24 * time.Hour
-	defaultScanMaxIdleTime          = 200 * time.Millisecond
-	defaultMetricsSampleInterval    = 10 * time.Second
-	defaultTimeUntilStoreDead       = 5 * time.Minute
-	defaultStorePath                = "cockroach-data"
-	defaultEventLogEnabled          = true
+	defaultCGroupMemPath             = "/sys/fs/cgroup/memory/memory.limit_in_bytes"
+	defaultMaxOffset                 = 250 * time.Millisecond
+	defaultCacheSize                 = 512 << 20 // 512 MB
+	defaultSQLMemoryPoolSize         = 512 << 20 // 512 MB
+	defaultScanInterval              = 10 * time.Minute
+	defaultConsistencyCheckInterval  = 24 * time.Hour
+	defaultScrubInterval             = 7 * 24 * time.Hour
+	defaultScanMaxIdleTime           = 200 * time.Millisecond
+	defaultMetricsSampleInterval     = 10 * time.Second
+	defaultTimeUntilStoreDead        = 5 * time.Minute
+	defaultTimeUntilNodeRemoved      = 30 * time.Minute
+	defaultCertificateReloadInterval = time.Minute
+	defaultStorePath                 = "cockroach-data"
+	defaultEventLogEnabled           = true
 
 	minimumNetworkFileDescriptors     = 256
 	recommendedNetworkFileDescriptors = 5000
@@ -96,6 +101,12 @@ type Config struct {
 	// used by SQL clients to store row data in server RAM.
 	SQLMemoryPoolSize int64
 
+	// BackgroundRateLimit is the rate in bytes per second at which each
+	// store's background flushes and compactions may write. Zero leaves
+	// background work unthrottled. The rate can be adjusted at runtime
+	// through the debug endpoint.
+	BackgroundRateLimit int64
+
 	// Parsed values.
 
 	// NodeAttributes is the parsed representation of Attrs.
@@ -131,6 +142,12 @@ type Config struct {
 	// Environment Variable: COCKROACH_METRICS_SAMPLE_INTERVAL
 	MetricsSampleInterval time.Duration
 
+	// MetricsPushEndpoint, if set, is a URL of the form graphite://host:port
+	// or statsd://host:port to which the metrics of the node and its stores
+	// are pushed every MetricsSampleInterval.
+	// Environment Variable: COCKROACH_METRICS_PUSH_ENDPOINT
+	MetricsPushEndpoint string
+
 	// ScanInterval determines a duration during which each range should be
 	// visited approximately once by the range scanner. Set to 0 to disable.
 	// Environment Variable: COCKROACH_SCAN_INTERVAL
@@ -147,6 +164,11 @@ type Config struct {
 	// Environment Variable: COCKROACH_CONSISTENCY_CHECK_INTERVAL
 	ConsistencyCheckInterval time.Duration
 
+	// ScrubInterval determines the time over which each store's checksum
+	// scrubber spreads a full pass over the store's data. Set to 0 to disable.
+	// Environment Variable: COCKROACH_SCRUB_INTERVAL
+	ScrubInterval time.Duration
+
 	// ConsistencyCheckPanicOnFailure causes the node to panic when it detects a
 	// replication consistency check failure.
 	ConsistencyCheckPanicOnFailure bool
@@ -156,6 +178,35 @@ type Config struct {
 	// Environment Variable: COCKROACH_TIME_UNTIL_STORE_DEAD
 	TimeUntilStoreDead time.Duration
 
+	// TimeUntilNodeRemoved is the time after which a decommissioning node
+	// whose liveness record has expired is removed from gossip, along with
+	// its stores. Dead nodes which are not decommissioning are never
+	// removed. Set to 0 to disable.
+	// Environment Variable: COCKROACH_TIME_UNTIL_NODE_REMOVED
+	TimeUntilNodeRemoved time.Duration
+
+	// RejectWritesOnClockOffset causes the node to reject writes, rather
+	// than to terminate, while its clock offset from more than half of its
+	// peers exceeds the maximum offset.
+	// Environment Variable: COCKROACH_REJECT_WRITES_ON_CLOCK_OFFSET
+	RejectWritesOnClockOffset bool
+
+	// ForwardClockJumpThreshold, if positive, causes the node to terminate
+	// when its clock jumps forward by more than the threshold (or, with
+	// RejectWritesOnClockOffset, to log an error). Jumps are detected between
+	// successive readings of the clock, which happen at least every tenth of
+	// the threshold; a threshold below the length of pauses of the process
+	// causes spurious detections.
+	// Environment Variable: COCKROACH_FORWARD_CLOCK_JUMP_THRESHOLD
+	ForwardClockJumpThreshold time.Duration
+
+	// CertificateReloadInterval determines how often the certificates are
+	// checked for changes on disk. Changed certificates are used for new
+	// connections. Certificates are also reloaded on SIGHUP. Set to 0 to
+	// only reload on SIGHUP.
+	// Environment Variable: COCKROACH_CERTIFICATE_RELOAD_INTERVAL
+	CertificateReloadInterval time.Duration
+
 	// TestingKnobs is used for internal test controls only.
 	TestingKnobs base.TestingKnobs
 
@@ -334,16 +385,19 @@ func SetOpenFileLimitForOneStore() (int, error) {
 // MakeConfig returns a Context with default values.
 func MakeConfig() Config {
 	cfg := Config{
-		Config:                   new(base.Config),
-		MaxOffset:                defaultMaxOffset,
-		CacheSize:                defaultCacheSize,
-		SQLMemoryPoolSize:        defaultSQLMemoryPoolSize,
-		ScanInterval:             defaultScanInterval,
-		ScanMaxIdleTime:          defaultScanMaxIdleTime,
-		ConsistencyCheckInterval: defaultConsistencyCheckInterval,
-		MetricsSampleInterval:    defaultMetricsSampleInterval,
-		TimeUntilStoreDead:       defaultTimeUntilStoreDead,
-		EventLogEnabled:          defaultEventLogEnabled,
+		Config:                    new(base.Config),
+		MaxOffset:                 defaultMaxOffset,
+		CacheSize:                 defaultCacheSize,
+		SQLMemoryPoolSize:         defaultSQLMemoryPoolSize,
+		ScanInterval:              defaultScanInterval,
+		ScanMaxIdleTime:           defaultScanMaxIdleTime,
+		ConsistencyCheckInterval:  defaultConsistencyCheckInterval,
+		ScrubInterval:             defaultScrubInterval,
+		MetricsSampleInterval:     defaultMetricsSampleInterval,
+		TimeUntilStoreDead:        defaultTimeUntilStoreDead,
+		TimeUntilNodeRemoved:      defaultTimeUntilNodeRemoved,
+		CertificateReloadInterval: defaultCertificateReloadInterval,
+		EventLogEnabled:           defaultEventLogEnabled,
 		Stores: base.StoreSpecList{
 			Specs: []base.StoreSpec{{Path: defaultStorePath}},
 		},
@@ -357,6 +411,7 @@ type Engines []engine.Engine
 
 // Close closes all the Engines.
 // This method has a pointer receiver so that the following pattern works:
+//
 //	func f() {
 //		engines := Engines(engineSlice)
 //		defer engines.Close()  // make sure the engines are Closed if this
@@ -366,7 +421,9 @@ type Engines []engine.Engine
 //	}
 func (e *Engines) Close() {
 	for _, eng := range *e {
-		eng.Close()
+		if eng != nil {
+			eng.Close()
+		}
 	}
 	*e = nil
 }
@@ -411,6 +468,17 @@ func (cfg *Config) CreateEngines() (Engines, error) {
 				return Engines{}, errors.Errorf("%f%% of memory is only %s bytes, which is below the minimum requirement of %s",
 					spec.SizePercent, humanizeutil.IBytes(sizeInBytes), humanizeutil.IBytes(base.MinimumStoreSize))
 			}
+			if spec.Engine == base.StoreEngineGo {
+				eng, err := engine.NewGoEngine(engine.GoEngineConfig{
+					Attrs:        spec.Attributes,
+					MaxSizeBytes: sizeInBytes,
+				})
+				if err != nil {
+					return Engines{}, err
+				}
+				engines = append(engines, eng)
+				continue
+			}
 			engines = append(engines, engine.NewInMem(spec.Attributes, sizeInBytes))
 		} else {
 			if spec.SizePercent > 0 {
@@ -425,13 +493,29 @@ func (cfg *Config) CreateEngines() (Engines, error) {
 					spec.SizePercent, spec.Path, humanizeutil.IBytes(sizeInBytes), humanizeutil.IBytes(base.MinimumStoreSize))
 			}
 
-			eng, err := engine.NewRocksDB(
-				spec.Attributes,
-				spec.Path,
-				cache,
-				sizeInBytes,
-				openFileLimitPerStore,
-			)
+			if spec.Engine == base.StoreEngineGo {
+				eng, err := engine.NewGoEngine(engine.GoEngineConfig{
+					Attrs:        spec.Attributes,
+					Dir:          spec.Path,
+					MaxSizeBytes: sizeInBytes,
+				})
+				if err != nil {
+					return Engines{}, err
+				}
+				engines = append(engines, eng)
+				continue
+			}
+
+			eng, err := engine.NewRocksDBWithConfig(engine.RocksDBConfig{
+				Attrs:                 spec.Attributes,
+				Dir:                   spec.Path,
+				MaxSizeBytes:          sizeInBytes,
+				MaxOpenFiles:          openFileLimitPerStore,
+				WALDir:                spec.WALDir,
+				BackgroundRateLimit:   cfg.BackgroundRateLimit,
+				EncryptionKeyFile:     spec.EncryptionKey,
+				OldEncryptionKeyFiles: spec.OldEncryptionKeys,
+			}, cache)
 			if err != nil {
 				return Engines{}, err
 			}
@@ -449,6 +533,70 @@ func (cfg *Config) CreateEngines() (Engines, error) {
 	return enginesCopy, nil
 }
 
+// CreateRaftEngines creates a dedicated raft engine for each store spec, in
+// the same order as the engines returned by CreateEngines. The raft engine of
+// an on-disk store lives in the "raft" subdirectory of the store and uses the
+// store's encryption keys. If dedicated raft storage is not enabled, a raft
+// engine is only opened for the stores which already have one, as those keep
+// their raft log in it; the entries of the other stores are nil.
+func (cfg *Config) CreateRaftEngines() (Engines, error) {
+	enabled := storage.DedicatedRaftStorageEnabled()
+	engines := Engines(nil)
+	defer engines.Close()
+
+	var count int
+	for _, spec := range cfg.Stores.Specs {
+		if !enabled {
+			if spec.InMemory {
+				engines = append(engines, nil)
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(spec.Path, "raft")); os.IsNotExist(err) {
+				engines = append(engines, nil)
+				continue
+			} else if err != nil {
+				return Engines{}, err
+			}
+		}
+		count++
+		if spec.Engine == base.StoreEngineGo {
+			var dir string
+			if !spec.InMemory {
+				dir = filepath.Join(spec.Path, "raft")
+			}
+			eng, err := engine.NewGoEngine(engine.GoEngineConfig{
+				Attrs: spec.Attributes,
+				Dir:   dir,
+			})
+			if err != nil {
+				return Engines{}, errors.Wrapf(err, "could not create raft engine for %s", spec.Path)
+			}
+			engines = append(engines, eng)
+			continue
+		}
+		if spec.InMemory {
+			engines = append(engines, engine.NewInMem(spec.Attributes, 0))
+			continue
+		}
+		eng, err := engine.NewRocksDBWithConfig(engine.RocksDBConfig{
+			Attrs:                 spec.Attributes,
+			Dir:                   filepath.Join(spec.Path, "raft"),
+			MaxOpenFiles:          engine.MinimumMaxOpenFiles,
+			EncryptionKeyFile:     spec.EncryptionKey,
+			OldEncryptionKeyFiles: spec.OldEncryptionKeys,
+		}, engine.RocksDBCache{})
+		if err != nil {
+			return Engines{}, errors.Wrapf(err, "could not create raft engine for %s", spec.Path)
+		}
+		engines = append(engines, eng)
+	}
+
+	log.Infof(context.TODO(), "%d raft engine(s) initialized", count)
+	enginesCopy := engines
+	engines = nil
+	return enginesCopy, nil
+}
+
 // InitNode parses node attributes and initializes the gossip bootstrap
 // resolvers.
 func (cfg *Config) InitNode() error {
@@ -476,12 +624,18 @@ func (cfg *Config) readEnvironmentVariables() {
 	// cockroach-linearizable
 	cfg.Linearizable = envutil.EnvOrDefaultBool("COCKROACH_LINEARIZABLE", cfg.Linearizable)
 	cfg.ConsistencyCheckPanicOnFailure = envutil.EnvOrDefaultBool("COCKROACH_CONSISTENCY_CHECK_PANIC_ON_FAILURE", cfg.ConsistencyCheckPanicOnFailure)
+	cfg.RejectWritesOnClockOffset = envutil.EnvOrDefaultBool("COCKROACH_REJECT_WRITES_ON_CLOCK_OFFSET", cfg.RejectWritesOnClockOffset)
+	cfg.ForwardClockJumpThreshold = envutil.EnvOrDefaultDuration("COCKROACH_FORWARD_CLOCK_JUMP_THRESHOLD", cfg.ForwardClockJumpThreshold)
 	cfg.MaxOffset = envutil.EnvOrDefaultDuration("COCKROACH_MAX_OFFSET", cfg.MaxOffset)
 	cfg.MetricsSampleInterval = envutil.EnvOrDefaultDuration("COCKROACH_METRICS_SAMPLE_INTERVAL", cfg.MetricsSampleInterval)
+	cfg.MetricsPushEndpoint = envutil.EnvOrDefaultString("COCKROACH_METRICS_PUSH_ENDPOINT", cfg.MetricsPushEndpoint)
 	cfg.ScanInterval = envutil.EnvOrDefaultDuration("COCKROACH_SCAN_INTERVAL", cfg.ScanInterval)
 	cfg.ScanMaxIdleTime = envutil.EnvOrDefaultDuration("COCKROACH_SCAN_MAX_IDLE_TIME", cfg.ScanMaxIdleTime)
 	cfg.TimeUntilStoreDead = envutil.EnvOrDefaultDuration("COCKROACH_TIME_UNTIL_STORE_DEAD", cfg.TimeUntilStoreDead)
+	cfg.TimeUntilNodeRemoved = envutil.EnvOrDefaultDuration("COCKROACH_TIME_UNTIL_NODE_REMOVED", cfg.TimeUntilNodeRemoved)
 	cfg.ConsistencyCheckInterval = envutil.EnvOrDefaultDuration("COCKROACH_CONSISTENCY_CHECK_INTERVAL", cfg.ConsistencyCheckInterval)
+	cfg.ScrubInterval = envutil.EnvOrDefaultDuration("COCKROACH_SCRUB_INTERVAL", cfg.ScrubInterval)
+	cfg.CertificateReloadInterval = envutil.EnvOrDefaultDuration("COCKROACH_CERTIFICATE_RELOAD_INTERVAL", cfg.CertificateReloadInterval)
 }
 
 // parseGossipBootstrapResolvers parses list of gossip bootstrap resolvers.
@@ -111,12 +111,18 @@ func TestReadEnvironmentVariables(t *testing.T) {
 		if err := os.Unsetenv("COCKROACH_TIME_UNTIL_STORE_DEAD"); err != nil {
 			t.Fatal(err)
 		}
+		if err := os.Unsetenv("COCKROACH_TIME_UNTIL_NODE_REMOVED"); err != nil {
+			t.Fatal(err)
+		}
 		if err := os.Unsetenv("COCKROACH_CONSISTENCY_CHECK_INTERVAL"); err != nil {
 			t.Fatal(err)
 		}
 		if err := os.Unsetenv("COCKROACH_RESERVATIONS_ENABLED"); err != nil {
 			t.Fatal(err)
 		}
+		if err := os.Unsetenv("COCKROACH_FORWARD_CLOCK_JUMP_THRESHOLD"); err != nil {
+			t.Fatal(err)
+		}
 		envutil.ClearEnvCache()
 	}
 	defer resetEnvVar()
@@ -165,6 +171,10 @@ func TestReadEnvironmentVariables(t *testing.T) {
 		t.Fatal(err)
 	}
 	cfgExpected.TimeUntilStoreDead = time.Millisecond * 10
+	if err := os.Setenv("COCKROACH_TIME_UNTIL_NODE_REMOVED", "1h"); err != nil {
+		t.Fatal(err)
+	}
+	cfgExpected.TimeUntilNodeRemoved = time.Hour
 	if err := os.Setenv("COCKROACH_CONSISTENCY_CHECK_INTERVAL", "10ms"); err != nil {
 		t.Fatal(err)
 	}
@@ -172,6 +182,10 @@ func TestReadEnvironmentVariables(t *testing.T) {
 	if err := os.Setenv("COCKROACH_RESERVATIONS_ENABLED", "false"); err != nil {
 		t.Fatal(err)
 	}
+	if err := os.Setenv("COCKROACH_FORWARD_CLOCK_JUMP_THRESHOLD", "1s"); err != nil {
+		t.Fatal(err)
+	}
+	cfgExpected.ForwardClockJumpThreshold = time.Second
 
 	envutil.ClearEnvCache()
 	cfg.readEnvironmentVariables()
@@ -208,6 +222,9 @@ func TestReadEnvironmentVariables(t *testing.T) {
 	if err := os.Setenv("COCKROACH_TIME_UNTIL_STORE_DEAD", "abcd"); err != nil {
 		t.Fatal(err)
 	}
+	if err := os.Setenv("COCKROACH_TIME_UNTIL_NODE_REMOVED", "abcd"); err != nil {
+		t.Fatal(err)
+	}
 	if err := os.Setenv("COCKROACH_CONSISTENCY_CHECK_INTERVAL", "abcd"); err != nil {
 		t.Fatal(err)
 	}
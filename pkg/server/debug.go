@@ -19,13 +19,26 @@ package server
 import (
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"golang.org/x/net/context"
 	// Register the net/trace endpoint with http.DefaultServeMux.
 	"golang.org/x/net/trace"
 
+	"github.com/pkg/errors"
 	"github.com/rcrowley/go-metrics"
 	"github.com/rcrowley/go-metrics/exp"
 
+	"github.com/cockroachdb/cockroach/pkg/keys"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/security"
+	"github.com/cockroachdb/cockroach/pkg/storage"
+	"github.com/cockroachdb/cockroach/pkg/util/humanizeutil"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/tracing"
+
 	// This is imported for its side-effect of registering pprof endpoints with
 	// the http.DefaultServeMux.
 	_ "net/http/pprof"
@@ -35,6 +48,26 @@ import (
 // for access to exported vars and pprof tools.
 const debugEndpoint = "/debug/"
 
+// debugVModuleEndpoint changes the vmodule setting to the remainder of the
+// path.
+const debugVModuleEndpoint = debugEndpoint + "vmodule/"
+
+// debugRateLimitEndpoint sets the background rate limit of every store to
+// the remainder of the path, interpreted as bytes per second. Zero removes
+// the limit.
+const debugRateLimitEndpoint = debugEndpoint + "ratelimit/"
+
+// debugCompactEndpoint compacts the engines of the node's stores over the
+// span given by the start and end parameters, which are pretty-printed keys
+// (e.g. /Table/51) defaulting to the whole key space. The store parameter
+// restricts the compaction to a single store, and bottommost=true forces the
+// bottommost level to be compacted as well.
+const debugCompactEndpoint = debugEndpoint + "compact"
+
+// debugSlowSpansEndpoint lists the recently finished spans on this node which
+// exceeded the slow span threshold.
+const debugSlowSpansEndpoint = debugEndpoint + "slowspans"
+
 // We use the default http mux for the debug endpoint (as pprof and net/trace
 // register to that via import, and go-metrics registers to that via exp.Exp())
 var debugServeMux = http.DefaultServeMux
@@ -47,6 +80,116 @@ func handleDebug(w http.ResponseWriter, r *http.Request) {
 	handler.ServeHTTP(w, r)
 }
 
+// adminOnly wraps the handler of a debug endpoint which changes the state of
+// the server. The endpoint only accepts POST requests, which must be made by
+// an administrator, i.e. with a client certificate for the root or node user
+// unless the server is running in insecure mode.
+func (s *Server) adminOnly(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "only POST requests are allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !s.cfg.Insecure {
+			user, err := security.GetCertificateUser(r.TLS)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			if user != security.RootUser && user != security.NodeUser {
+				http.Error(w, fmt.Sprintf("user %s is not an administrator", user), http.StatusForbidden)
+				return
+			}
+		}
+		handler(w, r)
+	}
+}
+
+// handleDebugCompact forces a compaction of the server's stores. The
+// request blocks until the compaction completes.
+func (s *Server) handleDebugCompact(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	parseKey := func(param string, defaultKey roachpb.RKey) (roachpb.RKey, error) {
+		v := r.Form.Get(param)
+		if v == "" {
+			return defaultKey, nil
+		}
+		key, err := keys.UglyPrint(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid %s key %q", param, v)
+		}
+		return roachpb.RKey(key), nil
+	}
+	start, err := parseKey("start", roachpb.RKeyMin)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	end, err := parseKey("end", roachpb.RKeyMax)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var storeID roachpb.StoreID
+	if v := r.Form.Get("store"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid store ID %q", v), http.StatusBadRequest)
+			return
+		}
+		storeID = roachpb.StoreID(id)
+	}
+	var forceBottommost bool
+	if v := r.Form.Get("bottommost"); v != "" {
+		if forceBottommost, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, fmt.Sprintf("invalid bottommost value %q", v), http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx := s.AnnotateCtx(context.TODO())
+	var compacted int
+	if err := s.node.stores.VisitStores(func(store *storage.Store) error {
+		if storeID != 0 && store.StoreID() != storeID {
+			return nil
+		}
+		compacted++
+		return store.CompactKeySpan(ctx, start, end, forceBottommost)
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if compacted == 0 {
+		http.Error(w, fmt.Sprintf("store %d not found", storeID), http.StatusNotFound)
+		return
+	}
+	fmt.Fprintf(w, "compacted %s-%s on %d stores\n", start, end, compacted)
+}
+
+// handleDebugRateLimit adjusts the background rate limit of the server's
+// stores. Unlike the other debug endpoints it is registered on the server's
+// own mux as it needs access to the engines, and it is wrapped by adminOnly
+// as it changes the state of the server.
+func (s *Server) handleDebugRateLimit(w http.ResponseWriter, r *http.Request) {
+	spec := strings.TrimPrefix(r.URL.Path, debugRateLimitEndpoint)
+	bytesPerSec, err := humanizeutil.ParseBytes(spec)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, eng := range s.engines {
+		if err := eng.SetBackgroundRateLimit(bytesPerSec); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	fmt.Fprintf(w, "background rate limit successfully set to %s/s\n", humanizeutil.IBytes(bytesPerSec))
+}
+
 func init() {
 	// Tweak the authentication logic for the tracing endpoint. By default it's
 	// open for localhost only, but with Docker we want to get there from
@@ -84,7 +227,7 @@ table tr td {
 <table>
 <tr>
 <td>trace (local node only)</td>
-<td><a href="./requests">requests</a>, <a href="./events">events</a></td>
+<td><a href="./requests">requests</a>, <a href="./events">events</a>, <a href="./slowspans">slow spans</a></td>
 </tr>
 <tr>
 <td>stopper</td>
@@ -121,6 +264,18 @@ table tr td {
 </td>
 </tr>
 <tr>
+<td>compact stores</td>
+<td>
+post /debug/compact?start=<key>&end=<key><br />For example, <code>start=/Table/51&end=/Table/52</code>. Add <code>store=<store_id></code> to compact a single store.
+</td>
+</tr>
+<tr>
+<td>change background rate limit</td>
+<td>
+post /debug/ratelimit/<bytes_per_second><br />For example, <code>50MiB</code>. Zero removes the limit.
+</td>
+</tr>
+<tr>
 <td>change vmodule</td>
 <td>
 get /debug/vmodule/<your_vmodule_here><br />For example, <code>*=1</code> or <code>raft=3,storage=2</code>. Empty string disables vmodule logging.
@@ -131,6 +286,36 @@ get /debug/vmodule/<your_vmodule_here><br />For example, <code>*=1</code> or <co
 `)
 	})
 
+	debugServeMux.HandleFunc(debugVModuleEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		spec := strings.TrimPrefix(r.URL.Path, debugVModuleEndpoint)
+		if err := log.SetVModule(spec); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, "vmodule successfully set to %q\n", spec)
+	})
+
+	debugServeMux.HandleFunc(debugSlowSpansEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		spans := tracing.SlowSpans()
+		fmt.Fprintf(w, "%d spans slower than %s, most recent first\n", len(spans), tracing.SlowSpanThreshold())
+		for i := len(spans) - 1; i >= 0; i-- {
+			sp := spans[i]
+			fmt.Fprintf(w, "\n%s %9.3fms %s (trace %d, span %d, parent %d)\n",
+				sp.Start.Format(time.RFC3339Nano), sp.Duration.Seconds()*1000, sp.Operation,
+				sp.Context.TraceID, sp.Context.SpanID, sp.ParentSpanID)
+			for k, v := range sp.Tags {
+				fmt.Fprintf(w, "    %s: %v\n", k, v)
+			}
+			for _, l := range sp.Logs {
+				fmt.Fprintf(w, "    %9.3fms", l.Timestamp.Sub(sp.Start).Seconds()*1000)
+				for _, f := range l.Fields {
+					fmt.Fprintf(w, " %s", f)
+				}
+				fmt.Fprintln(w)
+			}
+		}
+	})
+
 	// This registers a superset of the variables exposed through the /debug/vars endpoint
 	// onto the /debug/metrics endpoint. It includes all expvars registered globally and
 	// all metrics registered on the DefaultRegistry.
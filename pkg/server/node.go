@@ -22,9 +22,6 @@ import (
 	"net"
 	"time"
 
-	"google.golang.org/grpc/credentials"
-	"google.golang.org/grpc/peer"
-
 	basictracer "github.com/opentracing/basictracer-go"
 	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
@@ -36,7 +33,6 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/keys"
 	"github.com/cockroachdb/cockroach/pkg/kv"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
-	"github.com/cockroachdb/cockroach/pkg/security"
 	"github.com/cockroachdb/cockroach/pkg/server/status"
 	"github.com/cockroachdb/cockroach/pkg/sql"
 	"github.com/cockroachdb/cockroach/pkg/sql/sqlbase"
@@ -59,6 +55,13 @@ const (
 	gossipStatusInterval = 1 * time.Minute
 	// gossipNodeDescriptorInterval is the interval for gossiping the node descriptor.
 	gossipNodeDescriptorInterval = 1 * time.Hour
+	// hlcUpperBoundInterval is the interval for persisting an upper bound on
+	// the wall time of the clock to the stores.
+	hlcUpperBoundInterval = 1 * time.Second
+	// hlcUpperBoundMargin is how far the persisted upper bound is ahead of
+	// the clock. It leaves room for a delayed write, and it is also the
+	// longest a restarted node waits for its clock to pass the upper bound.
+	hlcUpperBoundMargin = 2 * hlcUpperBoundInterval
 
 	// FirstNodeID is the node ID of the first node in a new cluster.
 	FirstNodeID = 1
@@ -130,6 +133,10 @@ type Node struct {
 	initialBoot bool // True if this is the first time this node has started.
 	txnMetrics  kv.TxnMetrics
 
+	// writeFence, if non-nil, returns an error if this node must not serve
+	// writes, such as when its clock is not in sync with the cluster.
+	writeFence func() error
+
 	storesServer storage.Server
 }
 
@@ -192,7 +199,7 @@ func bootstrapCluster(engines []engine.Engine, txnMetrics kv.TxnMetrics) (uuid.U
 
 		// The bootstrapping store will not connect to other nodes so its
 		// StoreConfig doesn't really matter.
-		s := storage.NewStore(cfg, eng, &roachpb.NodeDescriptor{NodeID: FirstNodeID})
+		s := storage.NewStore(cfg, eng, nil /* raftEng */, &roachpb.NodeDescriptor{NodeID: FirstNodeID})
 
 		// Verify the store isn't already part of a cluster.
 		if s.Ident.ClusterID != (uuid.UUID{}) {
@@ -330,13 +337,20 @@ func (n *Node) start(
 	ctx context.Context,
 	addr net.Addr,
 	engines []engine.Engine,
+	raftEngines []engine.Engine,
 	attrs roachpb.Attributes,
 	locality roachpb.Locality,
 ) error {
 	n.initDescriptor(addr, attrs, locality)
 
+	// Keep the clock from handing out timestamps below those handed out
+	// before the restart, in case the system clock was set back.
+	if err := n.ensureClockMonotonicity(ctx, engines); err != nil {
+		return err
+	}
+
 	// Initialize stores, including bootstrapping new ones.
-	if err := n.initStores(ctx, engines, n.stopper, false); err != nil {
+	if err := n.initStores(ctx, engines, raftEngines, n.stopper, false); err != nil {
 		if err == errNeedsBootstrap {
 			n.initialBoot = true
 			// This node has no initialized stores and no way to connect to
@@ -348,7 +362,7 @@ func (n *Node) start(
 			log.Infof(ctx, "**** cluster %s has been created", clusterID)
 			log.Infof(ctx, "**** add additional nodes by specifying --join=%s", addr)
 			// After bootstrapping, try again to initialize the stores.
-			if err := n.initStores(ctx, engines, n.stopper, true); err != nil {
+			if err := n.initStores(ctx, engines, raftEngines, n.stopper, true); err != nil {
 				return err
 			}
 		} else {
@@ -358,6 +372,10 @@ func (n *Node) start(
 
 	n.startedAt = n.storeCfg.Clock.Now().WallTime
 
+	if err := n.writeHLCUpperBound(ctx); err != nil {
+		return err
+	}
+	n.startWriteHLCUpperBound()
 	n.startComputePeriodicMetrics(n.stopper, n.storeCfg.MetricsSampleInterval)
 	n.startGossip(n.stopper)
 
@@ -399,15 +417,22 @@ func (n *Node) SetDraining(drain bool) error {
 // bootstraps list for initialization once the cluster and node IDs
 // have been determined.
 func (n *Node) initStores(
-	ctx context.Context, engines []engine.Engine, stopper *stop.Stopper, bootstrapped bool,
+	ctx context.Context,
+	engines, raftEngines []engine.Engine,
+	stopper *stop.Stopper,
+	bootstrapped bool,
 ) error {
 	var bootstraps []*storage.Store
 
 	if len(engines) == 0 {
 		return errors.Errorf("no engines")
 	}
-	for _, e := range engines {
-		s := storage.NewStore(n.storeCfg, e, &n.Descriptor)
+	for i, e := range engines {
+		var raftEng engine.Engine
+		if raftEngines != nil {
+			raftEng = raftEngines[i]
+		}
+		s := storage.NewStore(n.storeCfg, e, raftEng, &n.Descriptor)
 		log.Eventf(ctx, "created store for engine: %s", e)
 		if bootstrapped {
 			s.NotifyBootstrapped()
@@ -454,6 +479,14 @@ func (n *Node) initStores(
 	}
 	log.Event(ctx, "validated stores")
 
+	// Refuse gossip with nodes of other clusters. New nodes learn the
+	// cluster ID in connectGossip below.
+	if n.ClusterID != (uuid.UUID{}) {
+		if err := n.storeCfg.Gossip.SetClusterID(n.ClusterID); err != nil {
+			return err
+		}
+	}
+
 	// Set the stores map as the gossip persistent storage, so that
 	// gossip can bootstrap using the most recently persisted set of
 	// node addresses.
@@ -575,6 +608,9 @@ func (n *Node) connectGossip(ctx context.Context) {
 
 	if n.ClusterID == (uuid.UUID{}) {
 		n.ClusterID = gossipClusterID
+		if err := n.storeCfg.Gossip.SetClusterID(n.ClusterID); err != nil {
+			log.Fatal(ctx, err)
+		}
 	} else if n.ClusterID != gossipClusterID {
 		log.Fatalf(ctx, "node %d belongs to cluster %q but is attempting to connect to a gossip network for cluster %q",
 			n.Descriptor.NodeID, n.ClusterID, gossipClusterID)
@@ -637,6 +673,76 @@ func (n *Node) gossipStores(ctx context.Context) {
 	}
 }
 
+// ensureClockMonotonicity reads the upper bound on the wall time of the clock
+// persisted before the node was restarted. If the node was restarted quickly,
+// the clock may not have passed the upper bound yet, and we wait for it to do
+// so. If the clock is further behind, the system clock must have been set
+// back; rather than waiting for an unbounded amount of time, the clock is
+// forwarded to the upper bound.
+func (n *Node) ensureClockMonotonicity(ctx context.Context, engines []engine.Engine) error {
+	var upperBound int64
+	for _, eng := range engines {
+		wallTime, err := storage.ReadHLCUpperBound(ctx, eng)
+		if err != nil {
+			return err
+		}
+		if wallTime > upperBound {
+			upperBound = wallTime
+		}
+	}
+	clock := n.storeCfg.Clock
+	gap := time.Duration(upperBound - clock.PhysicalNow())
+	if gap <= 0 {
+		return nil
+	}
+	if gap <= hlcUpperBoundMargin {
+		log.Infof(ctx, "waiting %s for the clock to pass its persisted upper bound", gap)
+		time.Sleep(gap)
+		return nil
+	}
+	log.Warningf(ctx, "clock is %s behind its persisted upper bound; forwarding it", gap)
+	clock.Update(hlc.Timestamp{WallTime: upperBound})
+	return nil
+}
+
+// writeHLCUpperBound persists an upper bound on the wall time of the clock to
+// every store, and then keeps the clock from going past it. If persisting
+// fails, the clock keeps the previous upper bound, so that it never hands out
+// timestamps which a restarted node could repeat.
+func (n *Node) writeHLCUpperBound(ctx context.Context) error {
+	clock := n.storeCfg.Clock
+	upperBound := clock.Now().WallTime + int64(hlcUpperBoundMargin)
+	if err := n.stores.VisitStores(func(s *storage.Store) error {
+		return storage.WriteHLCUpperBound(ctx, s.Engine(), upperBound)
+	}); err != nil {
+		return err
+	}
+	clock.SetWallTimeUpperBound(upperBound)
+	return nil
+}
+
+// startWriteHLCUpperBound begins periodically persisting an upper bound on
+// the wall time of the clock. Failures are logged; if persisting keeps
+// failing, the clock reaches the last persisted upper bound and terminates
+// the process.
+func (n *Node) startWriteHLCUpperBound() {
+	n.stopper.RunWorker(func() {
+		ctx := n.AnnotateCtx(context.Background())
+		ticker := time.NewTicker(hlcUpperBoundInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := n.writeHLCUpperBound(ctx); err != nil {
+					log.Warningf(ctx, "unable to persist the clock's upper bound: %s", err)
+				}
+			case <-n.stopper.ShouldStop():
+				return
+			}
+		}
+	})
+}
+
 // startComputePeriodicMetrics starts a loop which periodically instructs each
 // store to compute the value of metrics which cannot be incrementally
 // maintained.
@@ -697,6 +803,52 @@ func (n *Node) startWriteSummaries(frequency time.Duration) {
 	})
 }
 
+// startRemoveDeadNodes begins periodically removing the decommissioning
+// nodes which have been dead for longer than timeUntilNodeRemoved, along
+// with their stores, from gossip. The store pool keeps considering their
+// stores dead, both before and after their removal, so that their replicas
+// are repaired.
+func (n *Node) startRemoveDeadNodes(timeUntilNodeRemoved time.Duration) {
+	if timeUntilNodeRemoved <= 0 {
+		return
+	}
+	ctx := log.WithLogTag(n.AnnotateCtx(context.Background()), "remove-dead-nodes", nil)
+	n.stopper.RunWorker(func() {
+		ticker := time.NewTicker(timeUntilNodeRemoved / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				n.removeDeadNodes(ctx, timeUntilNodeRemoved)
+			case <-n.stopper.ShouldStop():
+				return
+			}
+		}
+	})
+}
+
+// removeDeadNodes removes the decommissioning nodes which have been dead
+// for longer than deadFor from gossip. Nodes which are dead but not
+// decommissioning are kept, as they may still come back. Nodes which have
+// already been removed are skipped.
+func (n *Node) removeDeadNodes(ctx context.Context, deadFor time.Duration) {
+	for _, nodeID := range n.storeCfg.NodeLiveness.DeadDecommissionedNodes(deadFor) {
+		if nodeID == n.Descriptor.NodeID {
+			continue
+		}
+		if _, err := n.storeCfg.Gossip.GetNodeDescriptor(nodeID); err != nil {
+			continue
+		}
+		storeIDs := n.storeCfg.StorePool.NodeStoreIDs(nodeID)
+		if err := n.storeCfg.Gossip.RemoveNode(nodeID, storeIDs); err != nil {
+			log.Warningf(ctx, "unable to remove dead node %d: %s", nodeID, err)
+			continue
+		}
+		log.Infof(ctx, "removed decommissioned node %d and stores %v, dead for more than %s",
+			nodeID, storeIDs, deadFor)
+	}
+}
+
 // writeSummaries retrieves status summaries from the supplied
 // NodeStatusRecorder and persists them to the cockroach data store.
 func (n *Node) writeSummaries(ctx context.Context) error {
@@ -751,19 +903,11 @@ func (n *Node) recordJoinEvent() {
 func (n *Node) batchInternal(
 	ctx context.Context, args *roachpb.BatchRequest,
 ) (*roachpb.BatchResponse, error) {
-	// TODO(marc): grpc's authentication model (which gives credential access in
-	// the request handler) doesn't really fit with the current design of the
-	// security package (which assumes that TLS state is only given at connection
-	// time) - that should be fixed.
-	if peer, ok := peer.FromContext(ctx); ok {
-		if tlsInfo, ok := peer.AuthInfo.(credentials.TLSInfo); ok {
-			certUser, err := security.GetCertificateUser(&tlsInfo.State)
-			if err != nil {
-				return nil, err
-			}
-			if certUser != security.NodeUser {
-				return nil, errors.Errorf("user %s is not allowed", certUser)
-			}
+	// Callers of the Internal service are authorized by the RPC server, which
+	// only admits node certificates; see rpc.NewServer.
+	if n.writeFence != nil && args.IsWrite() {
+		if err := n.writeFence(); err != nil {
+			return nil, errors.Wrap(err, "rejecting write")
 		}
 	}
 
@@ -782,11 +926,12 @@ func (n *Node) batchInternal(
 		if err != nil {
 			return err
 		}
-		// If this is a snowball span, it gets special treatment: It skips the
-		// regular tracing machinery, and we instead send the collected spans
-		// back with the response. This is more expensive, but then again,
-		// those are individual requests traced by users, so they can be.
-		if sp.BaggageItem(tracing.Snowball) != "" {
+		// If this is a snowball span (or the client asked for the trace), it
+		// gets special treatment: It skips the regular tracing machinery, and we
+		// instead send the collected spans back with the response. This is more
+		// expensive, but then again, those are individual requests traced by
+		// users, so they can be.
+		if sp.BaggageItem(tracing.Snowball) != "" || args.ReturnTrace {
 			sp.LogEvent("delegating to snowball tracing")
 			sp.Finish()
 
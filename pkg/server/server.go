@@ -107,6 +107,7 @@ type Server struct {
 	sqlExecutor        *sql.Executor
 	leaseMgr           *sql.LeaseManager
 	engines            Engines
+	raftEngines        Engines
 	internalMemMetrics sql.MemoryMetrics
 	adminMemMetrics    sql.MemoryMetrics
 }
@@ -147,7 +148,7 @@ func NewServer(cfg Config, stopper *stop.Stopper) (*Server, error) {
 	// regular tag since it's just doing an (atomic) load when a log/trace message
 	// is constructed. The node ID is set by the Store if this host was
 	// bootstrapped; otherwise a new one is allocated in Node.
-	s.cfg.AmbientCtx.AddLogTag("n", &s.nodeIDContainer)
+	s.cfg.AmbientCtx.AddLogTag("n", log.Safe(&s.nodeIDContainer))
 
 	ctx := s.AnnotateCtx(context.Background())
 	if s.cfg.Insecure {
@@ -156,7 +157,10 @@ func NewServer(cfg Config, stopper *stop.Stopper) (*Server, error) {
 
 	s.rpcContext = rpc.NewContext(s.cfg.AmbientCtx, s.cfg.Config, s.clock, s.stopper)
 	s.rpcContext.HeartbeatCB = func() {
-		if err := s.rpcContext.RemoteClocks.VerifyClockOffset(); err != nil {
+		// With RejectWritesOnClockOffset, the node keeps running and its
+		// writes are fenced off until the offsets are healthy again; see
+		// Node.batchInternal.
+		if err := s.rpcContext.RemoteClocks.VerifyClockOffset(); err != nil && !s.cfg.RejectWritesOnClockOffset {
 			log.Fatal(ctx, err)
 		}
 	}
@@ -219,14 +223,31 @@ func NewServer(cfg Config, stopper *stop.Stopper) (*Server, error) {
 	// liveness expiration and heartbeat interval.
 	active, renewal := storage.RangeLeaseDurations(
 		storage.RaftElectionTimeout(s.cfg.RaftTickInterval, s.cfg.RaftElectionTimeoutTicks))
+	var livenessKnobs storage.NodeLivenessTestingKnobs
+	if s.cfg.TestingKnobs.Store != nil {
+		livenessKnobs = s.cfg.TestingKnobs.Store.(*storage.StoreTestingKnobs).NodeLiveness
+	}
 	s.nodeLiveness = storage.NewNodeLiveness(
-		s.cfg.AmbientCtx, s.clock, s.db, s.gossip, active, renewal,
+		s.cfg.AmbientCtx, s.clock, s.db, s.gossip, active, renewal, livenessKnobs,
 	)
 	s.registry.AddMetricStruct(s.nodeLiveness.Metrics())
 
 	s.raftTransport = storage.NewRaftTransport(
 		s.cfg.AmbientCtx, storage.GossipAddressResolver(s.gossip), s.grpc, s.rpcContext,
 	)
+	// Drop the circuit breakers of removed nodes.
+	s.gossip.RegisterCallback(gossip.MakePrefixPattern(gossip.KeyNodeIDPrefix),
+		func(key string, content roachpb.Value) {
+			if !gossip.IsTombstone(key, content) {
+				return
+			}
+			nodeID, err := gossip.NodeIDFromKey(key)
+			if err != nil {
+				log.Error(ctx, err)
+				return
+			}
+			s.raftTransport.RemoveCircuitBreaker(nodeID)
+		})
 
 	s.kvDB = kv.NewDBServer(s.cfg.Config, s.txnCoordSender, s.stopper)
 	roachpb.RegisterExternalServer(s.grpc, s.kvDB)
@@ -304,6 +325,7 @@ func NewServer(cfg Config, stopper *stop.Stopper) (*Server, error) {
 		ScanMaxIdleTime:                s.cfg.ScanMaxIdleTime,
 		ConsistencyCheckInterval:       s.cfg.ConsistencyCheckInterval,
 		ConsistencyCheckPanicOnFailure: s.cfg.ConsistencyCheckPanicOnFailure,
+		ScrubInterval:                  s.cfg.ScrubInterval,
 		MetricsSampleInterval:          s.cfg.MetricsSampleInterval,
 		StorePool:                      s.storePool,
 		SQLExecutor: sql.InternalExecutor{
@@ -323,11 +345,20 @@ func NewServer(cfg Config, stopper *stop.Stopper) (*Server, error) {
 
 	s.recorder = status.NewMetricsRecorder(s.clock)
 	s.registry.AddMetricStruct(s.rpcContext.RemoteClocks.Metrics())
+	s.registry.AddMetricStruct(s.rpcContext.CompressionMetrics())
+	s.registry.AddMetricStruct(s.rpcContext.BreakerMetrics())
+	s.rpcContext.MetricsSampleInterval = s.cfg.MetricsSampleInterval
+	s.recorder.AddPrometheusRegistry(s.rpcContext.PeerLatencyRegistry())
+	s.recorder.AddPrometheusRegistry(s.rpcContext.PeerBreakerRegistry())
 
 	s.runtime = status.MakeRuntimeStatSampler(s.clock)
 	s.registry.AddMetricStruct(s.runtime)
+	s.registry.AddMetricStruct(s.stopper.Metrics())
 
 	s.node = NewNode(storeCfg, s.recorder, s.registry, s.stopper, txnMetrics, sql.MakeEventLogger(s.leaseMgr))
+	if s.cfg.RejectWritesOnClockOffset {
+		s.node.writeFence = s.rpcContext.RemoteClocks.Fenced
+	}
 	roachpb.RegisterInternalServer(s.grpc, s.node)
 	storage.RegisterConsistencyServer(s.grpc, s.node.storesServer)
 	storage.RegisterFreezeServer(s.grpc, s.node.storesServer)
@@ -392,10 +423,31 @@ func (s *Server) Start(ctx context.Context) error {
 
 	startTime := timeutil.Now()
 
+	if threshold := s.cfg.ForwardClockJumpThreshold; threshold > 0 {
+		s.stopper.RunWorker(func() {
+			s.clock.MonitorForwardClockJumps(threshold, func(jump time.Duration) {
+				if s.cfg.RejectWritesOnClockOffset {
+					// Unless the clocks of the peers jumped as well, the offset from
+					// them fences off writes; see the heartbeat callback.
+					log.Errorf(ctx, "forward clock jump of %s detected", jump)
+					return
+				}
+				log.Fatalf(ctx, "forward clock jump of %s detected, exceeding the threshold of %s", jump, threshold)
+			}, s.stopper.ShouldStop())
+		})
+	}
+
 	tlsConfig, err := s.cfg.GetServerTLSConfig()
 	if err != nil {
 		return err
 	}
+	if !s.cfg.Insecure {
+		cm, err := s.cfg.GetCertificateManager()
+		if err != nil {
+			return err
+		}
+		cm.Monitor(s.stopper, s.cfg.CertificateReloadInterval)
+	}
 
 	httpServer := netutil.MakeServer(s.stopper, tlsConfig, s)
 	plainRedirectServer := netutil.MakeServer(s.stopper, tlsConfig, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -441,6 +493,8 @@ func (s *Server) Start(ctx context.Context) error {
 
 	s.rpcContext.SetLocalInternalServer(s.node)
 
+	// Keep idle connections from being dropped by middleboxes.
+	ln = netutil.KeepAliveListener(ln, s.rpcContext.KeepAliveInterval)
 	m := cmux.New(ln)
 	pgL := m.Match(pgwire.Match)
 	anyL := m.Match(cmux.Any())
@@ -484,12 +538,8 @@ func (s *Server) Start(ctx context.Context) error {
 		netutil.FatalIfUnexpected(httpServer.Serve(httpLn))
 	})
 
-	s.stopper.RunWorker(func() {
-		<-s.stopper.ShouldQuiesce()
-		netutil.FatalIfUnexpected(anyL.Close())
-		<-s.stopper.ShouldStop()
-		s.grpc.Stop()
-	})
+	// Draining the grpc server closes anyL.
+	netutil.DrainGRPCServerOnQuiesce(s.stopper, s.grpc, anyL.Addr())
 
 	s.stopper.RunWorker(func() {
 		netutil.FatalIfUnexpected(s.grpc.Serve(anyL))
@@ -551,6 +601,14 @@ func (s *Server) Start(ctx context.Context) error {
 		return errors.Wrap(err, "failed to create engines")
 	}
 	s.stopper.AddCloser(&s.engines)
+	s.mux.HandleFunc(debugRateLimitEndpoint, s.adminOnly(s.handleDebugRateLimit))
+	s.mux.HandleFunc(debugCompactEndpoint, s.adminOnly(s.handleDebugCompact))
+
+	s.raftEngines, err = s.cfg.CreateRaftEngines()
+	if err != nil {
+		return errors.Wrap(err, "failed to create raft engines")
+	}
+	s.stopper.AddCloser(&s.raftEngines)
 
 	// We might have to sleep a bit to protect against this node producing non-
 	// monotonic timestamps. Before restarting, its clock might have been driven
@@ -593,6 +651,7 @@ func (s *Server) Start(ctx context.Context) error {
 		ctx,
 		unresolvedAdvertAddr,
 		s.engines,
+		s.raftEngines,
 		s.cfg.NodeAttributes,
 		s.cfg.Locality,
 	)
@@ -601,6 +660,12 @@ func (s *Server) Start(ctx context.Context) error {
 	}
 	log.Event(ctx, "started node")
 
+	// Refuse heartbeats with nodes of other clusters now that the cluster ID
+	// is known.
+	if err := s.rpcContext.SetClusterID(s.node.ClusterID); err != nil {
+		return err
+	}
+
 	s.nodeLiveness.StartHeartbeat(ctx, s.stopper)
 
 	// We can now add the node registry.
@@ -617,6 +682,20 @@ func (s *Server) Start(ctx context.Context) error {
 	// Begin recording status summaries.
 	s.node.startWriteSummaries(s.cfg.MetricsSampleInterval)
 
+	// Begin removing long dead decommissioned nodes from gossip.
+	s.node.startRemoveDeadNodes(s.cfg.TimeUntilNodeRemoved)
+
+	// Begin pushing metrics to an external endpoint, if configured.
+	if s.cfg.MetricsPushEndpoint != "" {
+		pusher, err := status.NewMetricsPusher(
+			s.cfg.AmbientCtx, s.recorder, s.cfg.MetricsPushEndpoint, s.cfg.MetricsSampleInterval,
+		)
+		if err != nil {
+			return err
+		}
+		pusher.Start(s.stopper)
+	}
+
 	// Create and start the schema change manager only after a NodeID
 	// has been assigned.
 	testingKnobs := &sql.SchemaChangerTestingKnobs{}
@@ -717,6 +796,13 @@ func (s *Server) doDrain(modes []serverpb.DrainMode, setTo bool) ([]serverpb.Dra
 		case mode == serverpb.DrainMode_CLIENT:
 			err = s.pgServer.SetDraining(setTo)
 		case mode == serverpb.DrainMode_LEASES:
+			// Stop background work such as the replica queues before the
+			// leases are given up, while requests continue to be served.
+			if setTo {
+				s.stopper.RejectTasks(stop.BackgroundTask)
+			} else {
+				s.stopper.AdmitTasks()
+			}
 			err = s.node.SetDraining(setTo)
 		default:
 			err = errors.Errorf("unknown drain mode: %v (%d)", mode, mode)
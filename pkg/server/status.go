@@ -449,6 +449,82 @@ func (s *statusServer) Metrics(
 	return marshalJSONResponse(s.metricSource)
 }
 
+// latencyMatrix holds the heartbeat latencies from each node to its peers,
+// keyed by node ID and peer address.
+type latencyMatrix struct {
+	Nodes  map[roachpb.NodeID]map[string]rpc.PeerLatency `json:"nodes"`
+	Errors map[roachpb.NodeID]string                     `json:"errors,omitempty"`
+}
+
+// Latencies returns the heartbeat latencies from the node specified to its
+// peers. If no node is specified, it returns the latencies of all nodes.
+func (s *statusServer) Latencies(
+	ctx context.Context, req *serverpb.LatenciesRequest,
+) (*serverpb.JSONResponse, error) {
+	ctx = s.AnnotateCtx(ctx)
+	if len(req.NodeId) == 0 {
+		return s.latencyMatrix(ctx)
+	}
+	nodeID, local, err := s.parseNodeID(req.NodeId)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, err.Error())
+	}
+
+	if !local {
+		status, err := s.dialNode(nodeID)
+		if err != nil {
+			return nil, err
+		}
+		return status.Latencies(ctx, req)
+	}
+	return marshalJSONResponse(s.rpcCtx.PeerLatencies())
+}
+
+// latencyMatrix collects the heartbeat latencies of all nodes.
+func (s *statusServer) latencyMatrix(ctx context.Context) (*serverpb.JSONResponse, error) {
+	nodes, err := s.Nodes(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	mu := struct {
+		syncutil.Mutex
+		matrix latencyMatrix
+	}{
+		matrix: latencyMatrix{
+			Nodes:  make(map[roachpb.NodeID]map[string]rpc.PeerLatency),
+			Errors: make(map[roachpb.NodeID]string),
+		},
+	}
+
+	// Parallelize fetching of latencies to minimize total time.
+	var wg sync.WaitGroup
+	for _, node := range nodes.Nodes {
+		wg.Add(1)
+		nodeID := node.Desc.NodeID
+		go func() {
+			defer wg.Done()
+			var latencies map[string]rpc.PeerLatency
+			resp, err := s.Latencies(ctx, &serverpb.LatenciesRequest{NodeId: nodeID.String()})
+			if err == nil {
+				err = json.Unmarshal(resp.Data, &latencies)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				mu.matrix.Errors[nodeID] = err.Error()
+				return
+			}
+			mu.matrix.Nodes[nodeID] = latencies
+		}()
+	}
+	wg.Wait()
+	mu.Lock()
+	defer mu.Unlock()
+	return marshalJSONResponse(mu.matrix)
+}
+
 // RaftDebug returns raft debug information for all known nodes.
 func (s *statusServer) RaftDebug(
 	ctx context.Context, _ *serverpb.RaftDebugRequest,
@@ -0,0 +1,234 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package status
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/ts/tspb"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/stop"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxPushBackoff is the longest a MetricsPusher waits between two
+	// attempts to push to an unavailable endpoint.
+	maxPushBackoff = 5 * time.Minute
+	// pushTimeout bounds the time spent connecting to the endpoint and writing
+	// a single push.
+	pushTimeout = 10 * time.Second
+	// maxStatsDPacketSize bounds the size of the datagrams sent to a StatsD
+	// endpoint, so that they are not fragmented on common networks.
+	maxStatsDPacketSize = 1432
+)
+
+// pushFormat is the wire format used by a MetricsPusher.
+type pushFormat int
+
+const (
+	// pushGraphite sends "<name> <value> <timestamp>" lines over TCP, using
+	// the Graphite plaintext protocol.
+	pushGraphite pushFormat = iota
+	// pushStatsD sends "<name>:<value>|g" gauges over UDP.
+	pushStatsD
+)
+
+// timeSeriesSource provides the flattened metrics pushed by a MetricsPusher;
+// it is implemented by MetricsRecorder.
+type timeSeriesSource interface {
+	GetTimeSeriesData() []tspb.TimeSeriesData
+}
+
+// A MetricsPusher periodically pushes the metrics of a node and its stores
+// to a Graphite or StatsD endpoint, for deployments which cannot scrape the
+// prometheus endpoint. Pushes to an unavailable endpoint are retried with
+// exponential backoff.
+type MetricsPusher struct {
+	log.AmbientContext
+	source   timeSeriesSource
+	format   pushFormat
+	network  string
+	addr     string
+	interval time.Duration
+	conn     net.Conn
+}
+
+// NewMetricsPusher creates a MetricsPusher which pushes the metrics of the
+// recorder to the given endpoint every interval. The endpoint is a URL of the
+// form graphite://host:port or statsd://host:port.
+func NewMetricsPusher(
+	ambient log.AmbientContext, recorder *MetricsRecorder, endpoint string, interval time.Duration,
+) (*MetricsPusher, error) {
+	return newMetricsPusher(ambient, recorder, endpoint, interval)
+}
+
+func newMetricsPusher(
+	ambient log.AmbientContext, source timeSeriesSource, endpoint string, interval time.Duration,
+) (*MetricsPusher, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid metrics push endpoint %q", endpoint)
+	}
+	p := &MetricsPusher{
+		AmbientContext: ambient,
+		source:         source,
+		addr:           u.Host,
+		interval:       interval,
+	}
+	switch u.Scheme {
+	case "graphite":
+		p.format, p.network = pushGraphite, "tcp"
+	case "statsd":
+		p.format, p.network = pushStatsD, "udp"
+	default:
+		return nil, errors.Errorf(
+			"invalid metrics push endpoint %q: scheme must be graphite or statsd", endpoint)
+	}
+	if _, _, err := net.SplitHostPort(u.Host); err != nil {
+		return nil, errors.Wrapf(err, "invalid metrics push endpoint %q", endpoint)
+	}
+	p.AddLogTag("metrics-push", nil)
+	return p, nil
+}
+
+// Start begins pushing metrics until the stopper is stopped.
+func (p *MetricsPusher) Start(stopper *stop.Stopper) {
+	stopper.RunWorker(func() {
+		ctx := p.AnnotateCtx(context.Background())
+		defer p.closeConn()
+
+		var backoff time.Duration
+		var timer timeutil.Timer
+		defer timer.Stop()
+		for {
+			timer.Reset(p.interval + backoff)
+			select {
+			case <-timer.C:
+				timer.Read = true
+			case <-stopper.ShouldStop():
+				return
+			}
+			if err := p.push(); err != nil {
+				backoff = nextPushBackoff(backoff, p.interval)
+				log.Warningf(ctx, "error pushing metrics to %s (retrying in %s): %s",
+					p.addr, p.interval+backoff, err)
+				continue
+			}
+			backoff = 0
+		}
+	})
+}
+
+// nextPushBackoff returns the additional delay before the next push after a
+// failed push which was delayed by the given backoff.
+func nextPushBackoff(backoff, interval time.Duration) time.Duration {
+	if backoff == 0 {
+		backoff = interval
+	} else {
+		backoff *= 2
+	}
+	if backoff > maxPushBackoff {
+		backoff = maxPushBackoff
+	}
+	return backoff
+}
+
+// push sends the current metrics to the endpoint, connecting to it if
+// necessary. The connection is closed on errors so that the next push
+// reconnects.
+func (p *MetricsPusher) push() error {
+	packets := formatPush(p.format, p.source.GetTimeSeriesData())
+	if len(packets) == 0 {
+		return nil
+	}
+	if p.conn == nil {
+		conn, err := net.DialTimeout(p.network, p.addr, pushTimeout)
+		if err != nil {
+			return err
+		}
+		p.conn = conn
+	}
+	if err := p.conn.SetWriteDeadline(timeutil.Now().Add(pushTimeout)); err != nil {
+		p.closeConn()
+		return err
+	}
+	for _, packet := range packets {
+		if _, err := p.conn.Write(packet); err != nil {
+			p.closeConn()
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *MetricsPusher) closeConn() {
+	if p.conn != nil {
+		_ = p.conn.Close()
+		p.conn = nil
+	}
+}
+
+// pushName returns the name under which a time series is pushed. The source
+// (i.e. the node or store ID) is inserted after the prefix of the series, so
+// that the series of a node or store share a common path.
+func pushName(name, source string) string {
+	for _, format := range []string{nodeTimeSeriesPrefix, storeTimeSeriesPrefix} {
+		prefix := strings.TrimSuffix(format, "%s")
+		if strings.HasPrefix(name, prefix) {
+			return prefix + source + "." + strings.TrimPrefix(name, prefix)
+		}
+	}
+	return name + "." + source
+}
+
+// formatPush flattens the time series data into the wire format. The result
+// is split into packets which are written separately; for Graphite, which is
+// stream based, all lines are returned in a single packet.
+func formatPush(format pushFormat, data []tspb.TimeSeriesData) [][]byte {
+	var packets [][]byte
+	var buf bytes.Buffer
+	for _, d := range data {
+		name := pushName(d.Name, d.Source)
+		for _, dp := range d.Datapoints {
+			value := strconv.FormatFloat(dp.Value, 'f', -1, 64)
+			var line string
+			switch format {
+			case pushGraphite:
+				line = fmt.Sprintf("%s %s %d\n", name, value, dp.TimestampNanos/int64(time.Second))
+			case pushStatsD:
+				line = fmt.Sprintf("%s:%s|g\n", name, value)
+				if buf.Len() > 0 && buf.Len()+len(line) > maxStatsDPacketSize {
+					packets = append(packets, append([]byte(nil), buf.Bytes()...))
+					buf.Reset()
+				}
+			}
+			buf.WriteString(line)
+		}
+	}
+	if buf.Len() > 0 {
+		packets = append(packets, buf.Bytes())
+	}
+	return packets
+}
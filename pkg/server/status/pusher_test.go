@@ -0,0 +1,181 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package status
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/testutils"
+	"github.com/cockroachdb/cockroach/pkg/ts/tspb"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/stop"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+)
+
+type fakeTimeSeriesSource []tspb.TimeSeriesData
+
+func (s fakeTimeSeriesSource) GetTimeSeriesData() []tspb.TimeSeriesData {
+	return s
+}
+
+func pushTestData(n int) fakeTimeSeriesSource {
+	var data fakeTimeSeriesSource
+	for i := 0; i < n; i++ {
+		data = append(data,
+			tspb.TimeSeriesData{
+				Name:   fmt.Sprintf(nodeTimeSeriesPrefix, fmt.Sprintf("metric%d", i)),
+				Source: "1",
+				Datapoints: []tspb.TimeSeriesDatapoint{
+					{TimestampNanos: 5 * int64(time.Second), Value: 1.5},
+				},
+			},
+			tspb.TimeSeriesData{
+				Name:   fmt.Sprintf(storeTimeSeriesPrefix, fmt.Sprintf("metric%d", i)),
+				Source: "2",
+				Datapoints: []tspb.TimeSeriesDatapoint{
+					{TimestampNanos: 5 * int64(time.Second), Value: 10},
+				},
+			},
+		)
+	}
+	return data
+}
+
+func TestFormatPush(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	data := pushTestData(1)
+	packets := formatPush(pushGraphite, data)
+	if len(packets) != 1 {
+		t.Fatalf("expected a single packet, got %d", len(packets))
+	}
+	if a, e := string(packets[0]), "cr.node.1.metric0 1.5 5\ncr.store.2.metric0 10 5\n"; a != e {
+		t.Errorf("expected:\n%s\ngot:\n%s", e, a)
+	}
+
+	packets = formatPush(pushStatsD, data)
+	if len(packets) != 1 {
+		t.Fatalf("expected a single packet, got %d", len(packets))
+	}
+	if a, e := string(packets[0]), "cr.node.1.metric0:1.5|g\ncr.store.2.metric0:10|g\n"; a != e {
+		t.Errorf("expected:\n%s\ngot:\n%s", e, a)
+	}
+
+	// StatsD datagrams are split at line boundaries.
+	data = pushTestData(100)
+	packets = formatPush(pushStatsD, data)
+	if len(packets) < 2 {
+		t.Fatalf("expected multiple packets, got %d", len(packets))
+	}
+	var lines int
+	for i, p := range packets {
+		if len(p) > maxStatsDPacketSize {
+			t.Errorf("%d: packet of %d bytes exceeds the maximum size", i, len(p))
+		}
+		if !strings.HasSuffix(string(p), "\n") {
+			t.Errorf("%d: packet does not end with a complete line", i)
+		}
+		lines += strings.Count(string(p), "\n")
+	}
+	if lines != len(data) {
+		t.Errorf("expected %d lines, got %d", len(data), lines)
+	}
+}
+
+func TestNewMetricsPusherEndpoint(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	testCases := []struct {
+		endpoint string
+		expErr   string
+	}{
+		{"graphite://localhost:2003", ""},
+		{"statsd://127.0.0.1:8125", ""},
+		{"http://localhost:2003", "scheme must be graphite or statsd"},
+		{"graphite://localhost", "missing port"},
+		{"localhost:2003", "scheme must be graphite or statsd"},
+	}
+	for i, tc := range testCases {
+		_, err := newMetricsPusher(log.AmbientContext{}, fakeTimeSeriesSource{}, tc.endpoint, time.Second)
+		if tc.expErr == "" {
+			if err != nil {
+				t.Errorf("%d: %s: unexpected error: %s", i, tc.endpoint, err)
+			}
+		} else if !testutils.IsError(err, tc.expErr) {
+			t.Errorf("%d: %s: expected error %q, got %v", i, tc.endpoint, tc.expErr, err)
+		}
+	}
+}
+
+func TestNextPushBackoff(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	var backoff time.Duration
+	for _, e := range []time.Duration{
+		time.Minute, 2 * time.Minute, 4 * time.Minute, maxPushBackoff, maxPushBackoff,
+	} {
+		if backoff = nextPushBackoff(backoff, time.Minute); backoff != e {
+			t.Fatalf("expected a backoff of %s, got %s", e, backoff)
+		}
+	}
+}
+
+// TestMetricsPusherGraphite verifies that metrics are pushed periodically to
+// a Graphite endpoint.
+func TestMetricsPusherGraphite(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+	p, err := newMetricsPusher(
+		log.AmbientContext{}, pushTestData(1), "graphite://"+ln.Addr().String(), time.Millisecond,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Start(stopper)
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := conn.SetReadDeadline(timeutil.Now().Add(10 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	// Read two pushes from the same connection.
+	r := bufio.NewReader(conn)
+	for i := 0; i < 4; i++ {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e := []string{"cr.node.1.metric0 1.5 5\n", "cr.store.2.metric0 10 5\n"}[i%2]; line != e {
+			t.Errorf("%d: expected %q, got %q", i, e, line)
+		}
+	}
+}
@@ -95,8 +95,12 @@ type MetricsRecorder struct {
 		// are not stored as subregistries, but rather are treated as wholly
 		// independent.
 		storeRegistries map[roachpb.StoreID]*metric.Registry
-		clock           *hlc.Clock
-		stores          map[roachpb.StoreID]storeMetrics
+		// prometheusRegistries contains registries which are only exported to
+		// prometheus. Their metrics are distinguished by labels, which are not
+		// supported by the time series system.
+		prometheusRegistries []*metric.Registry
+		clock                *hlc.Clock
+		stores               map[roachpb.StoreID]storeMetrics
 
 		// Counts to help optimize slice allocation.
 		lastDataCount        int
@@ -147,6 +151,14 @@ func (mr *MetricsRecorder) AddStore(store storeMetrics) {
 	mr.mu.stores[storeID] = store
 }
 
+// AddPrometheusRegistry adds a registry whose metrics are exported to
+// prometheus, but not recorded as time series or in status summaries.
+func (mr *MetricsRecorder) AddPrometheusRegistry(reg *metric.Registry) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	mr.mu.prometheusRegistries = append(mr.mu.prometheusRegistries, reg)
+}
+
 // MarshalJSON returns an appropriate JSON representation of the current values
 // of the metrics being tracked by this recorder.
 func (mr *MetricsRecorder) MarshalJSON() ([]byte, error) {
@@ -188,6 +200,9 @@ func (mr *MetricsRecorder) scrapePrometheus() {
 	for _, reg := range mr.mu.storeRegistries {
 		mr.prometheusExporter.ScrapeRegistry(reg)
 	}
+	for _, reg := range mr.mu.prometheusRegistries {
+		mr.prometheusExporter.ScrapeRegistry(reg)
+	}
 }
 
 // PrintAsText writes the current metrics values as plain-text to the writer.
@@ -346,6 +361,8 @@ func extractValue(mtr interface{}) (float64, error) {
 		return float64(mtr.Value()), nil
 	case *metric.GaugeFloat64:
 		return mtr.Value(), nil
+	case *metric.WindowedRate:
+		return mtr.Value(), nil
 	default:
 		return 0, errors.Errorf("cannot extract value for type %T", mtr)
 	}
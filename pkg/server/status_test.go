@@ -19,6 +19,7 @@ package server
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -414,6 +415,37 @@ func TestMetricsEndpoint(t *testing.T) {
 	}
 }
 
+// TestLatenciesEndpoint verifies that the heartbeat latencies of a node and
+// of the whole cluster are available via the /_status/latencies endpoint.
+func TestLatenciesEndpoint(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	s := startServer(t)
+	defer s.Stopper().Stop()
+
+	var resp serverpb.JSONResponse
+	if err := getStatusJSONProto(s, "latencies?node_id=local", &resp); err != nil {
+		t.Fatal(err)
+	}
+	var latencies map[string]rpc.PeerLatency
+	if err := json.Unmarshal(resp.Data, &latencies); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := getStatusJSONProto(s, "latencies", &resp); err != nil {
+		t.Fatal(err)
+	}
+	var matrix latencyMatrix
+	if err := json.Unmarshal(resp.Data, &matrix); err != nil {
+		t.Fatal(err)
+	}
+	if len(matrix.Errors) > 0 {
+		t.Errorf("unexpected errors: %v", matrix.Errors)
+	}
+	if _, ok := matrix.Nodes[s.Gossip().NodeID.Get()]; !ok {
+		t.Errorf("expected latencies of node %d, got %v", s.Gossip().NodeID.Get(), matrix.Nodes)
+	}
+}
+
 func TestRangesResponse(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	ts := startServer(t)
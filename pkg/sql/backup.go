@@ -171,18 +171,14 @@ func Backup(
 
 		backupDescs[i].Path = filepath.Join(dir, dataSSTableName)
 
-		writeSST := func() (writeSSTErr error) {
-			// This is a function so the defered Close (and resultant flush) is
-			// called before the checksum is computed.
-			sst := engine.MakeRocksDBSstFileWriter()
-			if err := sst.Open(backupDescs[i].Path); err != nil {
+		writeSST := func() error {
+			// This is a function so the deferred Close (and resultant cleanup)
+			// runs if any of the adds fail.
+			sst, err := engine.MakeSSTWriter(backupDescs[i].Path)
+			if err != nil {
 				return err
 			}
-			defer func() {
-				if closeErr := sst.Close(); closeErr != nil && writeSSTErr == nil {
-					writeSSTErr = closeErr
-				}
-			}()
+			defer sst.Close()
 			// TODO(dan): Move all this iteration into cpp to avoid the cgo calls.
 			for _, kv := range kvs {
 				mvccKV := engine.MVCCKeyValue{
@@ -193,7 +189,11 @@ func Backup(
 					return err
 				}
 			}
-			dataSize += sst.DataSize
+			info, err := sst.Finish()
+			if err != nil {
+				return err
+			}
+			dataSize += info.DataSize
 			return nil
 		}
 		if err := writeSST(); err != nil {
@@ -93,7 +93,7 @@ func newFlow(flowCtx FlowCtx, flowReg *flowRegistry, syncFlowConsumer RowReceive
 	if opentracing.SpanFromContext(flowCtx.Context) == nil {
 		panic("flow context has no span")
 	}
-	flowCtx.Context = log.WithLogTagStr(flowCtx.Context, "f", flowCtx.id.Short())
+	flowCtx.Context = log.WithLogTag(flowCtx.Context, "f", log.Safe(flowCtx.id.Short()))
 	f := &Flow{
 		FlowCtx:          flowCtx,
 		flowRegistry:     flowReg,
@@ -0,0 +1,419 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/config"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/stop"
+)
+
+// allocSimStore scripts a store of an allocator simulation.
+type allocSimStore struct {
+	// Capacity is the disk capacity of the store in bytes.
+	Capacity int64
+	Attrs    []string
+	Locality roachpb.Locality
+	// JoinTick is the tick at which the store joins the cluster. If DeadTick
+	// is non-zero, the store is considered dead from that tick on.
+	JoinTick, DeadTick int
+}
+
+// allocSimConfig configures an allocator simulation.
+type allocSimConfig struct {
+	// Seed seeds the random choices of the allocator.
+	Seed   int64
+	Stores []allocSimStore
+	// Ranges is the number of simulated ranges of RangeBytes each. All ranges
+	// start out with a single replica on the first store.
+	Ranges     int
+	RangeBytes int64
+	Zone       config.ZoneConfig
+	// MaxTicks bounds the length of the simulation. Every tick advances the
+	// clock by TickInterval and makes at most one change to every range.
+	MaxTicks      int
+	TickInterval  time.Duration
+	UseRuleSolver bool
+}
+
+// allocSimTick holds the metrics of a single tick of an allocator
+// simulation.
+type allocSimTick struct {
+	Adds, Removes   int
+	UnderReplicated int
+	// RangeCountStdDev is the standard deviation of the range counts of the
+	// live stores at the end of the tick.
+	RangeCountStdDev float64
+}
+
+// allocSimResult holds the convergence metrics of an allocator simulation.
+type allocSimResult struct {
+	Ticks []allocSimTick
+	// Converged is set if the simulation reached a tick without any changes
+	// after all scripted store events took place. ConvergedTick is that tick.
+	Converged     bool
+	ConvergedTick int
+	// Adds and Removes count all the replica changes of the simulation.
+	Adds, Removes int
+	// RangeCounts are the final range counts of all the stores.
+	RangeCounts map[roachpb.StoreID]int
+}
+
+// String returns a summary of the result suitable for logging.
+func (r allocSimResult) String() string {
+	var buf bytes.Buffer
+	if r.Converged {
+		fmt.Fprintf(&buf, "converged after %d ticks", r.ConvergedTick)
+	} else {
+		fmt.Fprintf(&buf, "not converged after %d ticks", len(r.Ticks))
+	}
+	fmt.Fprintf(&buf, ", adds=%d removes=%d", r.Adds, r.Removes)
+	if len(r.Ticks) > 0 {
+		fmt.Fprintf(&buf, " stddev=%.2f", r.Ticks[len(r.Ticks)-1].RangeCountStdDev)
+	}
+	for storeID := roachpb.StoreID(1); int(storeID) <= len(r.RangeCounts); storeID++ {
+		fmt.Fprintf(&buf, "\n  s%d: ranges=%d", storeID, r.RangeCounts[storeID])
+	}
+	return buf.String()
+}
+
+// allocSim runs allocator decisions against a synthetic StorePool whose
+// store descriptors are derived from the simulated replica placement.
+type allocSim struct {
+	cfg       allocSimConfig
+	stopper   *stop.Stopper
+	clock     *hlc.ManualClock
+	storePool *StorePool
+	allocator Allocator
+	ranges    []roachpb.RangeDescriptor
+}
+
+// newAllocSim creates an allocator simulation. The caller must call close
+// when done with it.
+func newAllocSim(cfg allocSimConfig) *allocSim {
+	if cfg.Zone.NumReplicas == 0 {
+		cfg.Zone.NumReplicas = 3
+	}
+	if cfg.TickInterval == 0 {
+		cfg.TickInterval = 10 * time.Second
+	}
+	stopper, _, clock, storePool := createTestStorePool(TestTimeUntilStoreDeadOff, true /* deterministic */)
+	s := &allocSim{
+		cfg:       cfg,
+		stopper:   stopper,
+		clock:     clock,
+		storePool: storePool,
+		allocator: MakeAllocator(storePool, AllocatorOptions{
+			AllowRebalance: true,
+			UseRuleSolver:  cfg.UseRuleSolver,
+		}),
+	}
+	s.allocator.randGen = makeAllocatorRand(rand.NewSource(cfg.Seed))
+	for i := 0; i < cfg.Ranges; i++ {
+		s.ranges = append(s.ranges, roachpb.RangeDescriptor{
+			RangeID:       roachpb.RangeID(i + 1),
+			NextReplicaID: 2,
+			Replicas: []roachpb.ReplicaDescriptor{
+				{NodeID: 1, StoreID: 1, ReplicaID: 1},
+			},
+		})
+	}
+	return s
+}
+
+func (s *allocSim) close() {
+	s.stopper.Stop()
+}
+
+// rangeCounts returns the number of replicas on every simulated store.
+func (s *allocSim) rangeCounts() map[roachpb.StoreID]int {
+	counts := make(map[roachpb.StoreID]int, len(s.cfg.Stores))
+	for i := range s.cfg.Stores {
+		counts[roachpb.StoreID(i+1)] = 0
+	}
+	for _, desc := range s.ranges {
+		for _, repl := range desc.Replicas {
+			counts[repl.StoreID]++
+		}
+	}
+	return counts
+}
+
+func (s *allocSim) isDead(i, tick int) bool {
+	return s.cfg.Stores[i].DeadTick > 0 && tick >= s.cfg.Stores[i].DeadTick
+}
+
+// updateStorePool replaces the store details of the StorePool with the
+// simulated state of all stores which have joined the cluster by the given
+// tick, as if every store had just gossiped its descriptor.
+func (s *allocSim) updateStorePool(tick int) {
+	counts := s.rangeCounts()
+	leases := make(map[roachpb.StoreID]int)
+	for _, desc := range s.ranges {
+		leases[desc.Replicas[0].StoreID]++
+	}
+
+	s.storePool.mu.Lock()
+	defer s.storePool.mu.Unlock()
+	s.storePool.mu.storeDetails = make(map[roachpb.StoreID]*storeDetail)
+	for i, store := range s.cfg.Stores {
+		if tick < store.JoinTick {
+			continue
+		}
+		storeID := roachpb.StoreID(i + 1)
+		available := store.Capacity - int64(counts[storeID])*s.cfg.RangeBytes
+		if available < 0 {
+			available = 0
+		}
+		detail := newStoreDetail(context.TODO())
+		detail.dead = s.isDead(i, tick)
+		detail.desc = &roachpb.StoreDescriptor{
+			StoreID: storeID,
+			Attrs:   roachpb.Attributes{Attrs: store.Attrs},
+			Node: roachpb.NodeDescriptor{
+				NodeID:   roachpb.NodeID(storeID),
+				Locality: store.Locality,
+			},
+			Capacity: roachpb.StoreCapacity{
+				Capacity:   store.Capacity,
+				Available:  available,
+				RangeCount: int32(counts[storeID]),
+				LeaseCount: int32(leases[storeID]),
+			},
+		}
+		s.storePool.mu.storeDetails[storeID] = detail
+	}
+}
+
+func (s *allocSim) addReplica(desc *roachpb.RangeDescriptor, store *roachpb.StoreDescriptor) {
+	desc.Replicas = append(desc.Replicas, roachpb.ReplicaDescriptor{
+		NodeID:    store.Node.NodeID,
+		StoreID:   store.StoreID,
+		ReplicaID: desc.NextReplicaID,
+	})
+	desc.NextReplicaID++
+}
+
+func (s *allocSim) removeReplica(desc *roachpb.RangeDescriptor, repl roachpb.ReplicaDescriptor) {
+	for i := range desc.Replicas {
+		if desc.Replicas[i].ReplicaID == repl.ReplicaID {
+			desc.Replicas = append(desc.Replicas[:i], desc.Replicas[i+1:]...)
+			return
+		}
+	}
+}
+
+// processRange makes at most one change to the given range, the way the
+// replicate queue would, and returns the number of replicas it added and
+// removed. The first replica of a range is considered its lease holder.
+func (s *allocSim) processRange(desc *roachpb.RangeDescriptor) (int, int, error) {
+	constraints := s.cfg.Zone.Constraints
+	leaseStoreID := desc.Replicas[0].StoreID
+	action, _ := s.allocator.ComputeAction(s.cfg.Zone, desc)
+	switch action {
+	case AllocatorAdd:
+		target, err := s.allocator.AllocateTarget(constraints, desc.Replicas, desc.RangeID, true)
+		if err != nil {
+			return 0, 0, err
+		}
+		s.addReplica(desc, target)
+		return 1, 0, nil
+	case AllocatorRemoveDead:
+		deadReplicas := s.storePool.deadReplicas(desc.RangeID, desc.Replicas)
+		s.removeReplica(desc, deadReplicas[0])
+		return 0, 1, nil
+	case AllocatorRemove:
+		repl, err := s.allocator.RemoveTarget(constraints, desc.Replicas, leaseStoreID)
+		if err != nil {
+			return 0, 0, err
+		}
+		s.removeReplica(desc, repl)
+		return 0, 1, nil
+	case AllocatorNoop:
+		target, err := s.allocator.RebalanceTarget(constraints, desc.Replicas, leaseStoreID, desc.RangeID)
+		if err != nil || target == nil {
+			return 0, 0, err
+		}
+		s.addReplica(desc, target)
+		repl, err := s.allocator.RemoveTarget(constraints, desc.Replicas, leaseStoreID)
+		if err != nil {
+			return 1, 0, err
+		}
+		s.removeReplica(desc, repl)
+		return 1, 1, nil
+	}
+	return 0, 0, nil
+}
+
+// tick runs a single tick of the simulation.
+func (s *allocSim) tick(tick int) allocSimTick {
+	s.clock.Increment(s.cfg.TickInterval.Nanoseconds())
+	s.updateStorePool(tick)
+
+	var metrics allocSimTick
+	for i := range s.ranges {
+		adds, removes, err := s.processRange(&s.ranges[i])
+		if adds > 0 || removes > 0 {
+			metrics.Adds += adds
+			metrics.Removes += removes
+			// Make the change visible to the decisions about the following
+			// ranges.
+			s.updateStorePool(tick)
+		}
+		if err != nil || len(s.ranges[i].Replicas) < int(s.cfg.Zone.NumReplicas) {
+			metrics.UnderReplicated++
+		}
+	}
+
+	var liveCounts []float64
+	counts := s.rangeCounts()
+	for i, store := range s.cfg.Stores {
+		if tick >= store.JoinTick && !s.isDead(i, tick) {
+			liveCounts = append(liveCounts, float64(counts[roachpb.StoreID(i+1)]))
+		}
+	}
+	metrics.RangeCountStdDev = stdDev(liveCounts)
+	return metrics
+}
+
+// run runs the simulation until it converges or reaches MaxTicks.
+func (s *allocSim) run() allocSimResult {
+	var lastEvent int
+	for _, store := range s.cfg.Stores {
+		if store.JoinTick > lastEvent {
+			lastEvent = store.JoinTick
+		}
+		if store.DeadTick > lastEvent {
+			lastEvent = store.DeadTick
+		}
+	}
+
+	var result allocSimResult
+	for tick := 0; tick < s.cfg.MaxTicks; tick++ {
+		metrics := s.tick(tick)
+		result.Ticks = append(result.Ticks, metrics)
+		result.Adds += metrics.Adds
+		result.Removes += metrics.Removes
+		if tick >= lastEvent && metrics.Adds == 0 && metrics.Removes == 0 {
+			result.Converged = true
+			result.ConvergedTick = tick
+			break
+		}
+	}
+	result.RangeCounts = s.rangeCounts()
+	return result
+}
+
+func stdDev(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	var variance float64
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(variance / float64(len(values)))
+}
+
+// allocSimStores returns n identical stores, each in its own datacenter.
+func allocSimStores(n int, capacity int64) []allocSimStore {
+	stores := make([]allocSimStore, n)
+	for i := range stores {
+		stores[i] = allocSimStore{
+			Capacity: capacity,
+			Locality: roachpb.Locality{
+				Tiers: []roachpb.Tier{{Key: "dc", Value: fmt.Sprintf("dc%d", i)}},
+			},
+		}
+	}
+	return stores
+}
+
+// TestAllocatorSimConverges verifies that the allocator fully replicates and
+// balances ranges across a cluster which grows and loses a store.
+func TestAllocatorSimConverges(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	runToggleRuleSolver(t, func(useRuleSolver bool, t *testing.T) {
+		stores := allocSimStores(6, 100<<30)
+		stores[4].JoinTick = 10
+		stores[5].JoinTick = 10
+		stores[3].DeadTick = 20
+
+		s := newAllocSim(allocSimConfig{
+			Seed:          1,
+			Stores:        stores,
+			Ranges:        100,
+			RangeBytes:    64 << 20,
+			MaxTicks:      500,
+			UseRuleSolver: useRuleSolver,
+		})
+		defer s.close()
+
+		result := s.run()
+		t.Log(result)
+		if !result.Converged {
+			t.Fatalf("expected the simulation to converge: %s", result)
+		}
+		if under := result.Ticks[len(result.Ticks)-1].UnderReplicated; under != 0 {
+			t.Errorf("expected all ranges to be fully replicated, got %d under-replicated", under)
+		}
+		if n := result.RangeCounts[4]; n != 0 {
+			t.Errorf("expected no replicas on the dead store, got %d", n)
+		}
+		for i := range stores {
+			storeID := roachpb.StoreID(i + 1)
+			if storeID == 4 {
+				continue
+			}
+			if n := result.RangeCounts[storeID]; n == 0 {
+				t.Errorf("expected replicas on store %d: %s", storeID, result)
+			}
+		}
+	})
+}
+
+func BenchmarkAllocatorSim(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		s := newAllocSim(allocSimConfig{
+			Seed:       int64(i),
+			Stores:     allocSimStores(10, 100<<30),
+			Ranges:     1000,
+			RangeBytes: 64 << 20,
+			MaxTicks:   100,
+		})
+		result := s.run()
+		s.close()
+		if i == 0 {
+			b.Log(result)
+		}
+	}
+}
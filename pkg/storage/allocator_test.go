@@ -38,7 +38,6 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/rpc"
 	"github.com/cockroachdb/cockroach/pkg/testutils/gossiputil"
-	"github.com/cockroachdb/cockroach/pkg/util"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
@@ -842,7 +841,7 @@ func TestAllocatorRebalanceThrashing(t *testing.T) {
 				gossiputil.NewStoreGossiper(g).GossipStores(stores, t)
 
 				// Ensure gossiped store descriptor changes have propagated.
-				util.SucceedsSoon(t, func() error {
+				SucceedsSoon(t, func() error {
 					sl, _, _ := a.storePool.getStoreList(firstRange)
 					for j, s := range sl.stores {
 						if a, e := s.Capacity.RangeCount, tc.cluster[j].rangeCount; a != e {
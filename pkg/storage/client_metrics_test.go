@@ -26,7 +26,6 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/internal/client"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/storage"
-	"github.com/cockroachdb/cockroach/pkg/util"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/cockroachdb/cockroach/pkg/util/metric"
 	"github.com/pkg/errors"
@@ -66,7 +65,7 @@ func verifyStats(t *testing.T, mtc *multiTestContext, storeIdxSlice ...int) {
 	// non-local intent resolution.
 	for _, s := range stores {
 		m := s.Metrics()
-		util.SucceedsSoon(t, func() error {
+		storage.SucceedsSoon(t, func() error {
 			if a := m.IntentCount.Value(); a != 0 {
 				return fmt.Errorf("expected intent count to be zero, was %d", a)
 			}
@@ -164,6 +163,89 @@ func verifyRocksDBStats(t *testing.T, s *storage.Store) {
 	}
 }
 
+// mtcMetrics is a snapshot of the counters and gauges of the stores of a
+// multiTestContext, indexed by store and metric name. The map of a stopped
+// store is nil.
+type mtcMetrics []map[string]int64
+
+// diff returns the change of every metric of s since the earlier snapshot.
+// Metrics missing from the earlier snapshot count as zero there.
+func (s mtcMetrics) diff(earlier mtcMetrics) mtcMetrics {
+	d := make(mtcMetrics, len(s))
+	for i, values := range s {
+		if values == nil {
+			continue
+		}
+		d[i] = make(map[string]int64, len(values))
+		for name, v := range values {
+			var prev int64
+			if i < len(earlier) {
+				prev = earlier[i][name]
+			}
+			d[i][name] = v - prev
+		}
+	}
+	return d
+}
+
+// metricValue returns the value of a counter or gauge.
+func metricValue(val interface{}) (int64, bool) {
+	switch m := val.(type) {
+	case *metric.Counter:
+		return m.Count(), true
+	case *metric.Gauge:
+		return m.Value(), true
+	}
+	return 0, false
+}
+
+// snapshotMetrics returns the values of the counters and gauges with the
+// given names on all stores, or of all counters and gauges if no names are
+// given.
+func (m *multiTestContext) snapshotMetrics(names ...string) mtcMetrics {
+	wanted := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		wanted[name] = struct{}{}
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	snap := make(mtcMetrics, len(m.stores))
+	for i, s := range m.stores {
+		if s == nil {
+			continue
+		}
+		snap[i] = make(map[string]int64)
+		s.Registry().Each(func(name string, val interface{}) {
+			if _, ok := wanted[name]; !ok && len(wanted) > 0 {
+				return
+			}
+			if v, ok := metricValue(val); ok {
+				snap[i][name] = v
+			}
+		})
+	}
+	return snap
+}
+
+// waitForMetric waits until the counter or gauge with the given name on the
+// store at index i has the expected value.
+func (m *multiTestContext) waitForMetric(i int, name string, expected int64) {
+	storage.SucceedsSoonDepth(1, m.t, func() error {
+		values := m.snapshotMetrics(name)[i]
+		if values == nil {
+			return errors.Errorf("store %d is stopped", i)
+		}
+		v, ok := values[name]
+		if !ok {
+			return errors.Errorf("store %d has no counter or gauge %s", i, name)
+		}
+		if v != expected {
+			return errors.Errorf("expected %s of store %d to be %d, got %d", name, i, expected, v)
+		}
+		return nil
+	})
+}
+
 func TestStoreMetrics(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	t.Skip("TODO(mrtracy): #9204")
@@ -246,3 +328,32 @@ func TestStoreMetrics(t *testing.T) {
 	verifyRocksDBStats(t, mtc.stores[0])
 	verifyRocksDBStats(t, mtc.stores[1])
 }
+
+// TestMultiTestContextMetrics verifies the metric helpers of
+// multiTestContext.
+func TestMultiTestContextMetrics(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	mtc := startMultiTestContext(t, 3)
+	defer mtc.Stop()
+
+	before := mtc.snapshotMetrics("replicas")
+	mtc.replicateRange(1, 1, 2)
+	for i := 1; i < 3; i++ {
+		mtc.waitForMetric(i, "replicas", 1)
+	}
+	d := mtc.snapshotMetrics("replicas").diff(before)
+	for i, expected := range []int64{0, 1, 1} {
+		if len(d[i]) != 1 {
+			t.Errorf("expected only the replicas gauge in the snapshot of store %d, got %v", i, d[i])
+		}
+		if v := d[i]["replicas"]; v != expected {
+			t.Errorf("expected %d new replicas on store %d, got %d", expected, i, v)
+		}
+	}
+
+	mtc.stopStore(2)
+	if snap := mtc.snapshotMetrics(); snap[2] != nil || len(snap[0]) == 0 {
+		t.Errorf("expected metrics of all running stores only, got %v", snap)
+	}
+	mtc.restartStore(2)
+}
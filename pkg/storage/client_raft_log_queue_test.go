@@ -27,7 +27,6 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/config"
 	"github.com/cockroachdb/cockroach/pkg/internal/client"
 	"github.com/cockroachdb/cockroach/pkg/storage"
-	"github.com/cockroachdb/cockroach/pkg/util"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/pkg/errors"
 )
@@ -90,7 +89,7 @@ func TestRaftLogQueue(t *testing.T) {
 	// Sadly, occasionally the queue has a race with the force processing so
 	// this succeeds within will captures those rare cases.
 	var afterTruncationIndex uint64
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		// Force a truncation check.
 		for _, store := range mtc.stores {
 			store.ForceRaftLogScanAndProcess()
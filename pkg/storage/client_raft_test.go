@@ -34,12 +34,12 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/base"
 	"github.com/cockroachdb/cockroach/pkg/internal/client"
 	"github.com/cockroachdb/cockroach/pkg/keys"
+	"github.com/cockroachdb/cockroach/pkg/kv"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/storage"
 	"github.com/cockroachdb/cockroach/pkg/storage/engine"
 	"github.com/cockroachdb/cockroach/pkg/storage/storagebase"
 	"github.com/cockroachdb/cockroach/pkg/testutils"
-	"github.com/cockroachdb/cockroach/pkg/util"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
@@ -257,7 +257,7 @@ func TestReplicateRange(t *testing.T) {
 	}
 	// Verify that in time, no intents remain on meta addressing
 	// keys, and that range descriptor on the meta records is correct.
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		meta2, err := keys.Addr(keys.RangeMetaKey(roachpb.RKeyMax))
 		if err != nil {
 			t.Fatal(err)
@@ -281,7 +281,7 @@ func TestReplicateRange(t *testing.T) {
 	})
 
 	// Verify that the same data is available on the replica.
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		getArgs := getArgs([]byte("a"))
 		if reply, err := client.SendWrappedWith(context.Background(), rg1(mtc.stores[1]), roachpb.Header{
 			ReadConsistency: roachpb.INCONSISTENT,
@@ -366,7 +366,7 @@ func TestRestoreReplicas(t *testing.T) {
 		t.Fatal(pErr)
 	}
 
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		getArgs := getArgs([]byte("a"))
 		if reply, err := client.SendWrappedWith(context.Background(), rg1(mtc.stores[1]), roachpb.Header{
 			ReadConsistency: roachpb.INCONSISTENT,
@@ -464,7 +464,7 @@ func TestFailedReplicaChange(t *testing.T) {
 
 	// Wait for the range to sync to both replicas (mainly so leaktest doesn't
 	// complain about goroutines involved in the process).
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		for _, store := range mtc.stores {
 			rang, err := store.GetReplica(1)
 			if err != nil {
@@ -553,7 +553,7 @@ func TestReplicateAfterTruncation(t *testing.T) {
 	}
 
 	// Once it catches up, the effects of both commands can be seen.
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		getArgs := getArgs([]byte("a"))
 		if reply, err := client.SendWrappedWith(context.Background(), rg1(mtc.stores[1]), roachpb.Header{
 			ReadConsistency: roachpb.INCONSISTENT,
@@ -570,7 +570,7 @@ func TestReplicateAfterTruncation(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		if mvcc, mvcc2 := repl.GetMVCCStats(), repl2.GetMVCCStats(); mvcc2 != mvcc {
 			return errors.Errorf("expected stats on new range:\n%+v\not equal old:\n%+v", mvcc2, mvcc)
 		}
@@ -584,7 +584,7 @@ func TestReplicateAfterTruncation(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		getArgs := getArgs([]byte("a"))
 		if reply, err := client.SendWrappedWith(context.Background(), rg1(mtc.stores[1]), roachpb.Header{
 			ReadConsistency: roachpb.INCONSISTENT,
@@ -835,7 +835,7 @@ func TestReplicateAfterRemoveAndSplit(t *testing.T) {
 	// subsequent replication to succeed.
 	mtc.stores[2].SetReplicaGCQueueActive(true)
 
-	util.SucceedsSoon(t, replicateRHS)
+	storage.SucceedsSoon(t, replicateRHS)
 }
 
 // Test various mechanism for refreshing pending commands.
@@ -948,7 +948,7 @@ func TestStoreRangeUpReplicate(t *testing.T) {
 	mtc.stores[0].ForceReplicationScanAndProcess()
 
 	// The range should become available on every node.
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		for _, s := range mtc.stores {
 			r := s.LookupReplica(roachpb.RKey("a"), roachpb.RKey("b"))
 			if r == nil {
@@ -1019,7 +1019,7 @@ func TestStoreRangeCorruptionChangeReplicas(t *testing.T) {
 	store0 := mtc.stores[0]
 
 	for i := 0; i < extraStores; i++ {
-		util.SucceedsSoon(t, func() error {
+		storage.SucceedsSoon(t, func() error {
 			store0.ForceReplicationScanAndProcess()
 
 			replicas := store0.LookupReplica(roachpb.RKey("a"), roachpb.RKey("b")).Desc().Replicas
@@ -1043,7 +1043,7 @@ func TestStoreRangeCorruptionChangeReplicas(t *testing.T) {
 		})
 
 		var corruptRep roachpb.ReplicaDescriptor
-		util.SucceedsSoon(t, func() error {
+		storage.SucceedsSoon(t, func() error {
 			r := corrupt.store.LookupReplica(roachpb.RKey("a"), roachpb.RKey("b"))
 			if r == nil {
 				return errors.New("replica is not available yet")
@@ -1060,7 +1060,7 @@ func TestStoreRangeCorruptionChangeReplicas(t *testing.T) {
 
 		// Wait until maybeSetCorrupt has been called. This isn't called immediately
 		// since the put command has quorum with the other good node.
-		util.SucceedsSoon(t, func() error {
+		storage.SucceedsSoon(t, func() error {
 			corrupt.Lock()
 			defer corrupt.Unlock()
 			replicas := corrupt.store.GetDeadReplicas()
@@ -1077,7 +1077,7 @@ func TestStoreRangeCorruptionChangeReplicas(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		util.SucceedsSoon(t, func() error {
+		storage.SucceedsSoon(t, func() error {
 			store0.ForceReplicationScanAndProcess()
 
 			// Should be removed from the corrupt store.
@@ -1184,7 +1184,7 @@ func TestChangeReplicasDescriptorInvariant(t *testing.T) {
 	if err := addReplica(1, origDesc); err != nil {
 		t.Fatal(err)
 	}
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		r := mtc.stores[1].LookupReplica(roachpb.RKey("a"), roachpb.RKey("b"))
 		if r == nil {
 			return errors.Errorf("expected replica for keys \"a\" - \"b\"")
@@ -1199,7 +1199,7 @@ func TestChangeReplicasDescriptorInvariant(t *testing.T) {
 		t.Fatalf("got unexpected error: %v", err)
 	}
 
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		after := mtc.stores[2].Metrics().RangeSnapshotsPreemptiveApplied.Count()
 		// The failed ChangeReplicas call should have applied a preemptive snapshot.
 		if after != before+1 {
@@ -1216,7 +1216,7 @@ func TestChangeReplicasDescriptorInvariant(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		after := mtc.stores[2].Metrics().RangeSnapshotsPreemptiveApplied.Count()
 		// The failed ChangeReplicas call should have applied a preemptive snapshot.
 		if after != before+1 {
@@ -1249,7 +1249,7 @@ func TestProgressWithDownNode(t *testing.T) {
 
 	// Verify that the first increment propagates to all the engines.
 	verify := func(expected []int64) {
-		util.SucceedsSoon(t, func() error {
+		storage.SucceedsSoon(t, func() error {
 			values := []int64{}
 			for _, eng := range mtc.engines {
 				val, _, err := engine.MVCCGet(context.Background(), eng, roachpb.Key("a"), mtc.clock.Now(), true, nil)
@@ -1372,7 +1372,7 @@ func runReplicateRestartAfterTruncation(t *testing.T, removeBeforeTruncateAndReA
 		// inactivity threshold and force a gc scan.
 		mtc.manualClock.Increment(int64(storage.ReplicaGCQueueInactivityThreshold + 1))
 		mtc.stores[1].ForceReplicaGCScanAndProcess()
-		util.SucceedsSoon(t, func() error {
+		storage.SucceedsSoon(t, func() error {
 			if true {
 				// TODO(spencerkimball): fix the flakiness seen in #8670 and remove.
 				return nil
@@ -1431,7 +1431,7 @@ func testReplicaAddRemove(t *testing.T, addFirst bool) {
 	}
 
 	// The first increment is visible on all three replicas.
-	util.SucceedsSoon(t, verifyFn([]int64{
+	storage.SucceedsSoon(t, verifyFn([]int64{
 		inc1,
 		inc1,
 		0,
@@ -1448,7 +1448,7 @@ func testReplicaAddRemove(t *testing.T, addFirst bool) {
 		mtc.replicateRange(rangeID, 2)
 	}
 	// The first increment is visible on the new replica.
-	util.SucceedsSoon(t, verifyFn([]int64{
+	storage.SucceedsSoon(t, verifyFn([]int64{
 		inc1,
 		inc1,
 		inc1,
@@ -1463,7 +1463,7 @@ func testReplicaAddRemove(t *testing.T, addFirst bool) {
 			t.Fatal(err)
 		}
 	}
-	util.SucceedsSoon(t, verifyFn([]int64{
+	storage.SucceedsSoon(t, verifyFn([]int64{
 		inc1 + inc2,
 		inc1,
 		inc1 + inc2,
@@ -1483,7 +1483,7 @@ func testReplicaAddRemove(t *testing.T, addFirst bool) {
 			t.Fatal(err)
 		}
 	}
-	util.SucceedsSoon(t, verifyFn([]int64{
+	storage.SucceedsSoon(t, verifyFn([]int64{
 		inc1 + inc2 + inc3,
 		inc1,
 		inc1 + inc2 + inc3,
@@ -1497,7 +1497,7 @@ func testReplicaAddRemove(t *testing.T, addFirst bool) {
 	mtc.stores[1].ForceReplicaGCScanAndProcess()
 
 	// The removed store no longer has any of the data from the range.
-	util.SucceedsSoon(t, verifyFn([]int64{
+	storage.SucceedsSoon(t, verifyFn([]int64{
 		inc1 + inc2 + inc3,
 		0,
 		inc1 + inc2 + inc3,
@@ -1652,7 +1652,7 @@ func TestReplicateAfterSplit(t *testing.T) {
 		t.Error("Range MaxBytes is not set after snapshot applied")
 	}
 	// Once it catches up, the effects of increment commands can be seen.
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		getArgs := getArgs(key)
 		// Reading on non-lease holder replica should use inconsistent read
 		if reply, err := client.SendWrappedWith(context.Background(), rg1(mtc.stores[1]), roachpb.Header{
@@ -1732,7 +1732,7 @@ func TestReplicaRemovalCampaign(t *testing.T) {
 
 			var latestTerm uint64
 			if td.expectAdvance {
-				util.SucceedsSoon(t, func() error {
+				storage.SucceedsSoon(t, func() error {
 					if raftStatus := replica2.RaftStatus(); raftStatus != nil {
 						if term := raftStatus.Term; term <= latestTerm {
 							return errors.Errorf("%d: raft term has not yet advanced: %d", i, term)
@@ -1782,7 +1782,7 @@ func TestRaftAfterRemoveRange(t *testing.T) {
 	mtc.unreplicateRange(rangeID, 1)
 
 	// Wait for the removal to be processed.
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		for _, s := range mtc.stores[1:] {
 			_, err := s.GetReplica(rangeID)
 			if _, ok := err.(*roachpb.RangeNotFoundError); !ok {
@@ -1943,7 +1943,7 @@ func TestReplicateRogueRemovedNode(t *testing.T) {
 	// may be recreated by a stray raft message, so we run the GC scan inside the loop.
 	// TODO(bdarnell): if the call to RemoveReplica in replicaGCQueue.process can be
 	// moved under the lock, then the GC scan can be moved out of this loop.
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		mtc.expireLeases()
 		mtc.manualClock.Increment(int64(
 			storage.ReplicaGCQueueInactivityThreshold) + 1)
@@ -2003,7 +2003,7 @@ func TestReplicateRogueRemovedNode(t *testing.T) {
 	// Now the tombstone on node 1 prevents it from rejoining the rogue
 	// copy of the group.
 	time.Sleep(100 * time.Millisecond)
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		actual := mtc.readIntFromEngines(roachpb.Key("a"))
 		// Normally, replica GC has not happened yet on store 2, so we
 		// expect {16, 0, 5}. However, it is possible (on a
@@ -2097,7 +2097,7 @@ func TestReplicateRemovedNodeDisruptiveElection(t *testing.T) {
 	mtc.waitForValues(key, []int64{0, value, value, value})
 
 	// 3. Wait for the lease holder to obtain raft leadership too.
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		req := &roachpb.LeaseInfoRequest{
 			Span: roachpb.Span{
 				Key: roachpb.KeyMin,
@@ -2237,7 +2237,7 @@ func TestReplicaTooOldGC(t *testing.T) {
 	// to get created in order to get the replica talking to the other replicas.
 	mtc.stores[3].EnqueueRaftUpdateCheck(rangeID)
 
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		replica, err := mtc.stores[3].GetReplica(rangeID)
 		if err != nil {
 			if _, ok := err.(*roachpb.RangeNotFoundError); ok {
@@ -2375,7 +2375,7 @@ func TestRemoveRangeWithoutGC(t *testing.T) {
 	// Wait for store 0 to process the removal. The in-memory replica
 	// object still exists but store 0 is no longer present in the
 	// configuration.
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		rep, err := mtc.stores[0].GetReplica(rangeID)
 		if err != nil {
 			return err
@@ -2416,7 +2416,7 @@ func TestRemoveRangeWithoutGC(t *testing.T) {
 	mtc.stores[0].SetReplicaGCQueueActive(true)
 	mtc.stores[0].ForceReplicaGCScanAndProcess()
 
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		// The Replica object should be removed.
 		if _, err := mtc.stores[0].GetReplica(rangeID); !testutils.IsError(err, "range [0-9]+ was not found") {
 			return errors.Errorf("expected replica to be missing; got %v", err)
@@ -2613,7 +2613,7 @@ func TestTransferRaftLeadership(t *testing.T) {
 		}
 	}
 	// Wait for raft leadership transferring to be finished.
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		status = repl.RaftStatus()
 		if status.Lead != 2 {
 			return errors.Errorf("expected raft leader be 2; got %d", status.Lead)
@@ -2724,7 +2724,7 @@ func TestRangeQuiescence(t *testing.T) {
 	mtc.replicateRange(1, 1, 2)
 
 	waitForQuiescence := func(rangeID roachpb.RangeID) {
-		util.SucceedsSoon(t, func() error {
+		storage.SucceedsSoon(t, func() error {
 			for _, s := range mtc.stores {
 				rep, err := s.GetReplica(rangeID)
 				if err != nil {
@@ -2774,3 +2774,490 @@ func TestRangeQuiescence(t *testing.T) {
 		t.Fatalf("%s should be the leader: %s", rep, state)
 	}
 }
+
+// TestPartitionAndHeal verifies that a partitioned store falls behind the
+// rest of its range while the partition lasts, and catches up once it is
+// healed.
+func TestPartitionAndHeal(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	mtc := startMultiTestContext(t, 3)
+	defer mtc.Stop()
+
+	mtc.replicateRange(1, 1, 2)
+	key := roachpb.Key("a")
+	incArgs := incrementArgs(key, 5)
+	if _, err := client.SendWrapped(context.Background(), rg1(mtc.stores[0]), &incArgs); err != nil {
+		t.Fatal(err)
+	}
+	mtc.waitForValues(key, []int64{5, 5, 5})
+
+	mtc.partition([]int{0, 1}, []int{2})
+
+	// KV requests across the partition fail.
+	var ba roachpb.BatchRequest
+	ba.Add(&incArgs)
+	transport, err := mtc.kvTransportFactory(roachpb.NodeID(3))(
+		kv.SendOptions{}, nil, kv.ReplicaSlice{{
+			ReplicaDescriptor: roachpb.ReplicaDescriptor{NodeID: 1, StoreID: 1},
+			NodeDesc:          mtc.nodeDesc(1),
+		}}, ba)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan kv.BatchCall, 1)
+	transport.SendNext(done)
+	if call := <-done; !testutils.IsError(call.Err, "partitioned") {
+		t.Fatalf("expected partition error, got %v", call.Err)
+	}
+
+	// The majority side of the partition commits writes without the
+	// partitioned store.
+	incArgs = incrementArgs(key, 11)
+	if _, err := client.SendWrapped(context.Background(), rg1(mtc.stores[0]), &incArgs); err != nil {
+		t.Fatal(err)
+	}
+	storage.SucceedsSoon(t, func() error {
+		if values := mtc.readIntFromEngines(key); values[0] != 16 || values[1] != 16 {
+			return errors.Errorf("expected increment on stores 0 and 1, got %v", values)
+		}
+		return nil
+	})
+	if values := mtc.readIntFromEngines(key); values[2] != 5 {
+		t.Fatalf("expected partitioned store to miss the increment, got %v", values)
+	}
+
+	mtc.heal()
+	mtc.waitForValues(key, []int64{16, 16, 16})
+}
+
+// TestAddNewAndRemoveStore verifies that stores added after Start can hold
+// replicas, and that removed stores stop participating in their ranges.
+func TestAddNewAndRemoveStore(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	mtc := startMultiTestContext(t, 3)
+	defer mtc.Stop()
+
+	mtc.replicateRange(1, 1, 2)
+	idx := mtc.AddNewStore()
+	if idx != 3 {
+		t.Fatalf("expected new store at index 3, got %d", idx)
+	}
+	mtc.replicateRange(1, idx)
+
+	key := roachpb.Key("a")
+	incArgs := incrementArgs(key, 5)
+	if _, err := client.SendWrapped(context.Background(), rg1(mtc.stores[0]), &incArgs); err != nil {
+		t.Fatal(err)
+	}
+	mtc.waitForValues(key, []int64{5, 5, 5, 5})
+
+	mtc.RemoveStore(1)
+	mtc.unreplicateRange(1, 1)
+
+	incArgs = incrementArgs(key, 11)
+	if _, err := client.SendWrapped(context.Background(), rg1(mtc.stores[0]), &incArgs); err != nil {
+		t.Fatal(err)
+	}
+	mtc.waitForValues(key, []int64{16, 0, 16, 16})
+}
+
+// TestWaitForEngineValues verifies that non-integer values can be awaited
+// on all engines, either as raw bytes or through a custom decoder.
+func TestWaitForEngineValues(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	mtc := startMultiTestContext(t, 3)
+	defer mtc.Stop()
+
+	mtc.replicateRange(1, 1, 2)
+
+	key := roachpb.Key("a")
+	value := []byte("value")
+	pArgs := putArgs(key, value)
+	if _, err := client.SendWrapped(context.Background(), rg1(mtc.stores[0]), &pArgs); err != nil {
+		t.Fatal(err)
+	}
+	mtc.waitForEngineValues(key, [][]byte{value, value, value})
+	mtc.waitForEngineValues(roachpb.Key("b"), [][]byte{nil, nil, nil})
+
+	// Decode the value into its length.
+	mtc.waitForDecodedValues(key, []interface{}{5, 5, 5}, func(val *roachpb.Value) (interface{}, error) {
+		b, err := val.GetBytes()
+		return len(b), err
+	})
+}
+
+// TestDrainAndStopStore verifies that draining a store hands its leases to
+// the other replicas, so that the range remains available without waiting
+// for the leases of the stopped store to expire.
+func TestDrainAndStopStore(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	mtc := startMultiTestContext(t, 3)
+	defer mtc.Stop()
+
+	mtc.replicateRange(1, 1, 2)
+
+	key := roachpb.Key("a")
+	incArgs := incrementArgs(key, 5)
+	if _, err := client.SendWrapped(context.Background(), rg1(mtc.stores[0]), &incArgs); err != nil {
+		t.Fatal(err)
+	}
+	mtc.waitForValues(key, []int64{5, 5, 5})
+
+	mtc.drainAndStopStore(0, 10*time.Second)
+
+	rep, err := mtc.stores[1].GetReplica(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage.SucceedsSoon(t, func() error {
+		if lease, _ := rep.GetLease(); lease.OwnedBy(mtc.idents[0].StoreID) || !lease.Covers(mtc.clock.Now()) {
+			return errors.Errorf("expected an active lease held by another store, got %s", lease)
+		}
+		return nil
+	})
+
+	// The clock was not moved, so the write requires the transferred lease.
+	if _, err := mtc.dbs[1].Inc(context.TODO(), key, 11); err != nil {
+		t.Fatal(err)
+	}
+	mtc.waitForValues(key, []int64{5, 16, 16})
+}
+
+// TestRestartStoreWithConfig verifies that a configuration change passed to
+// restartStoreWithConfig applies to the restarted store only, and that the
+// store keeps serving its data.
+func TestRestartStoreWithConfig(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	mtc := startMultiTestContext(t, 1)
+	defer mtc.Stop()
+
+	key := roachpb.Key("a")
+	incArgs := incrementArgs(key, 5)
+	if _, err := client.SendWrapped(context.Background(), rg1(mtc.stores[0]), &incArgs); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, disable := range []bool{true, false} {
+		mtc.stopStore(0)
+		if disable {
+			mtc.restartStoreWithConfig(0, func(cfg *storage.StoreConfig) {
+				cfg.TestingKnobs.DisableReplicateQueue = true
+			})
+		} else {
+			mtc.restartStore(0)
+		}
+		if active, err := mtc.stores[0].QueueActive("replicate"); err != nil {
+			t.Fatal(err)
+		} else if active == disable {
+			t.Errorf("expected replicate queue to be active: %t, got %t", !disable, active)
+		}
+		mtc.waitForValues(key, []int64{5})
+	}
+}
+
+// TestRaftTraffic verifies that the multiTestContext accounts for the Raft
+// messages exchanged by the nodes.
+func TestRaftTraffic(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	mtc := startMultiTestContext(t, 3)
+	defer mtc.Stop()
+
+	mtc.replicateRange(1, 1, 2)
+	before := mtc.raftTrafficSnapshot()
+	for _, to := range []roachpb.NodeID{2, 3} {
+		snaps := before.Filter(func(k mtcRaftTrafficKey) bool {
+			return k.Type == raftpb.MsgSnap && k.From == 1 && k.To == to
+		})
+		if snaps.Messages == 0 || snaps.Bytes == 0 {
+			t.Errorf("expected a snapshot sent to node %d, got %+v", to, snaps)
+		}
+	}
+
+	key := roachpb.Key("a")
+	const writes = 5
+	for i := 0; i < writes; i++ {
+		incArgs := incrementArgs(key, 1)
+		if _, err := client.SendWrapped(context.Background(), rg1(mtc.stores[0]), &incArgs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mtc.waitForValues(key, []int64{writes, writes, writes})
+
+	traffic := mtc.raftTrafficSnapshot().Sub(before)
+	for _, to := range []roachpb.NodeID{2, 3} {
+		apps := traffic.Filter(func(k mtcRaftTrafficKey) bool {
+			return k.Type == raftpb.MsgApp && k.From == 1 && k.To == to
+		})
+		if apps.Messages == 0 || apps.Bytes == 0 {
+			t.Errorf("expected appends sent to node %d, got %+v", to, apps)
+		}
+	}
+	if resps := traffic.ByType(raftpb.MsgAppResp); resps.Messages == 0 {
+		t.Errorf("expected append responses, got %+v", traffic)
+	}
+	// The followers don't append to each other.
+	if apps := traffic.Filter(func(k mtcRaftTrafficKey) bool {
+		return k.Type == raftpb.MsgApp && k.From != 1
+	}); apps.Messages != 0 {
+		t.Errorf("unexpected appends sent by followers: %+v", traffic)
+	}
+}
+
+// TestSlowEngine verifies that a range keeps making progress while a
+// follower's disk is slow, and that writes are delayed by a slow disk of the
+// lease holder.
+func TestSlowEngine(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	mtc := &multiTestContext{slowEngines: true}
+	mtc.Start(t, 3)
+	defer mtc.Stop()
+	mtc.replicateRange(1, 1, 2)
+
+	const latency = 50 * time.Millisecond
+	key := roachpb.Key("a")
+	incArgs := incrementArgs(key, 1)
+
+	// A slow follower does not hold up the quorum of the others.
+	mtc.setEngineLatencies(2, slowEngineLatencies{Write: latency, Sync: latency})
+	if _, err := client.SendWrapped(context.Background(), rg1(mtc.stores[0]), &incArgs); err != nil {
+		t.Fatal(err)
+	}
+	mtc.waitForValues(key, []int64{1, 1, 1})
+
+	// Writes wait for the slow disk of the lease holder.
+	mtc.setEngineLatencies(2, slowEngineLatencies{})
+	mtc.setEngineLatencies(0, slowEngineLatencies{Write: latency, Sync: latency})
+	start := timeutil.Now()
+	if _, err := client.SendWrapped(context.Background(), rg1(mtc.stores[0]), &incArgs); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := timeutil.Since(start); elapsed < latency {
+		t.Errorf("expected the write to take at least %s, took %s", latency, elapsed)
+	}
+	mtc.setEngineLatencies(0, slowEngineLatencies{})
+	mtc.waitForValues(key, []int64{2, 2, 2})
+}
+
+// TestReplicateRangeErr verifies that the error-returning variants of the
+// replication helpers report failed replica changes.
+func TestReplicateRangeErr(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	mtc := startMultiTestContext(t, 2)
+	defer mtc.Stop()
+
+	if err := mtc.replicateRangeErr(1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := mtc.replicateRangeErr(1, 1); !testutils.IsError(err, "which is already present") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := mtc.unreplicateRangeErr(1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := mtc.unreplicateRangeErr(1, 1); !testutils.IsError(err, "which is not present") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+// TestChaos verifies that a range keeps accepting writes while chaos is
+// inflicted upon a minority of its replicas, and that all replicas catch
+// up once the chaos runner is stopped.
+func TestChaos(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	mtc := startMultiTestContext(t, 3)
+	defer mtc.Stop()
+
+	mtc.replicateRange(1, 1, 2)
+
+	// Store 0 holds the lease and is spared.
+	chaos := mtc.StartChaos(mtcChaosOptions{
+		Seed:      1,
+		Interval:  10 * time.Millisecond,
+		Stores:    []int{1, 2},
+		Partition: true,
+	})
+	key := roachpb.Key("a")
+	var expected int64
+	for len(chaos.Events()) < 6 && !chaos.exited() {
+		incArgs := incrementArgs(key, 1)
+		if _, err := client.SendWrapped(context.Background(), rg1(mtc.stores[0]), &incArgs); err != nil {
+			t.Fatal(err)
+		}
+		expected++
+	}
+	chaos.Stop()
+
+	events := chaos.Events()
+	for _, e := range events {
+		if e.Store == 0 {
+			t.Errorf("unexpected event on spared store: %s", e)
+		}
+	}
+	if events[0].Op != "stop" && events[0].Op != "partition" {
+		t.Errorf("expected first event to take a store down, got %s", events[0])
+	}
+	mtc.waitForValues(key, []int64{expected, expected, expected})
+}
+
+// TestSnapshotInterceptionKnobs verifies that the BeforeSnapshotSend and
+// BeforeSnapshotApply testing knobs see the headers of snapshots, and can
+// reject them on either end.
+func TestSnapshotInterceptionKnobs(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	var rejectSend, rejectApply int32
+	var mu struct {
+		syncutil.Mutex
+		sent, applied []storage.SnapshotRequest_Header
+	}
+	sc := storage.TestStoreConfig(nil)
+	sc.TestingKnobs.BeforeSnapshotSend = func(header storage.SnapshotRequest_Header) error {
+		mu.Lock()
+		mu.sent = append(mu.sent, header)
+		mu.Unlock()
+		if atomic.LoadInt32(&rejectSend) != 0 {
+			return errors.New("send rejected")
+		}
+		return nil
+	}
+	sc.TestingKnobs.BeforeSnapshotApply = func(header storage.SnapshotRequest_Header) error {
+		mu.Lock()
+		mu.applied = append(mu.applied, header)
+		mu.Unlock()
+		if atomic.LoadInt32(&rejectApply) != 0 {
+			return errors.New("apply rejected")
+		}
+		return nil
+	}
+	mtc := &multiTestContext{storeConfig: &sc}
+	mtc.Start(t, 2)
+	defer mtc.Stop()
+
+	repl, err := mtc.stores[0].GetReplica(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addReplica := func() error {
+		return repl.ChangeReplicas(
+			context.Background(),
+			roachpb.ADD_REPLICA,
+			roachpb.ReplicaDescriptor{
+				NodeID:  mtc.stores[1].Ident.NodeID,
+				StoreID: mtc.stores[1].Ident.StoreID,
+			},
+			repl.Desc(),
+		)
+	}
+
+	atomic.StoreInt32(&rejectSend, 1)
+	if err := addReplica(); !testutils.IsError(err, "send rejected") {
+		t.Fatalf("expected rejection by sender, got %v", err)
+	}
+	mu.Lock()
+	if len(mu.sent) != 1 || len(mu.applied) != 0 {
+		t.Fatalf("expected one snapshot sent and none applied, got %d and %d", len(mu.sent), len(mu.applied))
+	}
+	if h := mu.sent[0]; !h.CanDecline || h.RaftMessageRequest.ToReplica.StoreID != mtc.stores[1].Ident.StoreID {
+		t.Fatalf("unexpected header of preemptive snapshot: %+v", h)
+	}
+	mu.Unlock()
+
+	atomic.StoreInt32(&rejectSend, 0)
+	atomic.StoreInt32(&rejectApply, 1)
+	if err := addReplica(); !testutils.IsError(err, "apply rejected") {
+		t.Fatalf("expected rejection by recipient, got %v", err)
+	}
+
+	atomic.StoreInt32(&rejectApply, 0)
+	if err := addReplica(); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(mu.applied) < 2 {
+		t.Fatalf("expected at least two snapshots received, got %d", len(mu.applied))
+	}
+	for _, h := range mu.applied {
+		if h.RangeDescriptor.RangeID != repl.RangeID {
+			t.Errorf("unexpected header of received snapshot: %+v", h)
+		}
+	}
+}
+
+// TestPreApplyFilter verifies that an error returned by the
+// TestingPreApplyFilter on all replicas prevents a command from being
+// applied anywhere, and is returned to the proposer.
+func TestPreApplyFilter(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	var rejectTS atomic.Value
+	rejectTS.Store(hlc.ZeroTimestamp)
+	var mu struct {
+		syncutil.Mutex
+		rejected map[roachpb.StoreID]struct{}
+	}
+	mu.rejected = make(map[roachpb.StoreID]struct{})
+	sc := storage.TestStoreConfig(nil)
+	sc.TestingKnobs.TestingPreApplyFilter = func(args storagebase.ApplyFilterArgs) *roachpb.Error {
+		if args.RangeID != 1 || args.Timestamp != rejectTS.Load().(hlc.Timestamp) {
+			return nil
+		}
+		mu.Lock()
+		mu.rejected[args.StoreID] = struct{}{}
+		mu.Unlock()
+		return roachpb.NewErrorf("injected")
+	}
+	mtc := &multiTestContext{storeConfig: &sc}
+	mtc.Start(t, 3)
+	defer mtc.Stop()
+	mtc.replicateRange(1, 1, 2)
+
+	// The increment is identified by its timestamp, which the clock will
+	// not hand out to any other command.
+	key := roachpb.Key("a")
+	ts := mtc.clock.Now()
+	rejectTS.Store(ts)
+	incArgs := incrementArgs(key, 5)
+	if _, pErr := client.SendWrappedWith(context.Background(), rg1(mtc.stores[0]), roachpb.Header{
+		Timestamp: ts,
+	}, &incArgs); !testutils.IsPError(pErr, "injected") {
+		t.Fatalf("expected injected error, got %v", pErr)
+	}
+	storage.SucceedsSoon(t, func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(mu.rejected) != 3 {
+			return errors.Errorf("expected rejection on all stores, got %v", mu.rejected)
+		}
+		return nil
+	})
+
+	incArgs = incrementArgs(key, 11)
+	if _, err := client.SendWrapped(context.Background(), rg1(mtc.stores[0]), &incArgs); err != nil {
+		t.Fatal(err)
+	}
+	mtc.waitForValues(key, []int64{11, 11, 11})
+}
+
+// TestGRPCTransport verifies that a multiTestContext whose DistSenders use
+// the gRPC transport serves reads and writes from every node.
+func TestGRPCTransport(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	mtc := &multiTestContext{grpcTransport: true}
+	mtc.Start(t, 3)
+	defer mtc.Stop()
+
+	mtc.replicateRange(1, 1, 2)
+	key := roachpb.Key("a")
+	for i, db := range mtc.dbs {
+		if _, err := db.Inc(context.TODO(), key, 5); err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+	}
+	mtc.waitForValues(key, []int64{15, 15, 15})
+	if row, err := mtc.dbs[2].Get(context.TODO(), key); err != nil {
+		t.Fatal(err)
+	} else if v := row.ValueInt(); v != 15 {
+		t.Fatalf("expected 15, got %d", v)
+	}
+}
@@ -39,7 +39,6 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/testutils"
 	"github.com/cockroachdb/cockroach/pkg/testutils/serverutils"
 	"github.com/cockroachdb/cockroach/pkg/testutils/testcluster"
-	"github.com/cockroachdb/cockroach/pkg/util"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/cockroachdb/cockroach/pkg/util/stop"
@@ -75,7 +74,7 @@ func TestRangeCommandClockUpdate(t *testing.T) {
 	}
 
 	// Wait for that command to execute on all the followers.
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		values := []int64{}
 		for _, eng := range mtc.engines {
 			val, _, err := engine.MVCCGet(context.Background(), eng, roachpb.Key("a"), clocks[0].Now(), true, nil)
@@ -101,6 +100,53 @@ func TestRangeCommandClockUpdate(t *testing.T) {
 	}
 }
 
+// TestNodeClockSkew verifies that the clocks of individual nodes can be
+// skewed mid-test, and that requests from nodes whose clocks are more than
+// the maximum offset ahead are rejected.
+func TestNodeClockSkew(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	const maxOffset = 100 * time.Millisecond
+	manual := hlc.NewManualClock(123)
+	mtc := &multiTestContext{
+		clock:          hlc.NewClock(manual.UnixNano, maxOffset),
+		distinctClocks: true,
+	}
+	mtc.Start(t, 2)
+	defer mtc.Stop()
+
+	incArgs := incrementArgs(roachpb.Key("a"), 5)
+
+	// A skew within the maximum offset is tolerated, and the receiver's
+	// clock is ratcheted forward by the request.
+	mtc.advanceNodeClock(1, maxOffset/2)
+	if err := mtc.verifyClockOffsets(); err != nil {
+		t.Fatal(err)
+	}
+	ts := mtc.clocks[1].Now()
+	if _, err := client.SendWrappedWith(
+		context.Background(), rg1(mtc.stores[0]), roachpb.Header{Timestamp: ts}, &incArgs,
+	); err != nil {
+		t.Fatal(err)
+	}
+	if now := mtc.clocks[0].Now(); now.Less(ts) {
+		t.Errorf("expected clock of store 0 to be updated to %s, got %s", ts, now)
+	}
+
+	// Beyond the maximum offset, requests are rejected.
+	mtc.advanceNodeClock(1, maxOffset)
+	if err := mtc.verifyClockOffsets(); !testutils.IsError(err, "more than the maximum offset") {
+		t.Fatalf("expected clock offset violation, got %v", err)
+	}
+	mtc.expectMaxOffsetViolation(1, 0, &incArgs)
+
+	// Clocks can be skewed backwards as well.
+	mtc.advanceNodeClock(1, -maxOffset)
+	if err := mtc.verifyClockOffsets(); err != nil {
+		t.Fatal(err)
+	}
+}
+
 // TestRejectFutureCommand verifies that lease holders reject commands that
 // would cause a large time jump.
 func TestRejectFutureCommand(t *testing.T) {
@@ -348,7 +394,7 @@ func TestRangeLookupUseReverse(t *testing.T) {
 			EndKey: keys.RangeMetaKey(roachpb.RKeyMax),
 		},
 	}
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		_, pErr := client.SendWrapped(context.Background(), rg1(store), &scanArgs)
 		return pErr.GoError()
 	})
@@ -536,7 +582,7 @@ func TestRangeTransferLease(t *testing.T) {
 
 	// Move the lease to store 1.
 	var newHolderDesc roachpb.ReplicaDescriptor
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		var err error
 		newHolderDesc, err = replica1.GetReplicaDescriptor()
 		return err
@@ -567,7 +613,7 @@ func TestRangeTransferLease(t *testing.T) {
 	}
 
 	// Check that replica1 now has the lease (or gets it soon).
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		if _, pErr := client.SendWrappedWith(
 			context.Background(),
 			mtc.senders[1],
@@ -647,7 +693,7 @@ func TestRangeTransferLease(t *testing.T) {
 	// Now unblock the extension.
 	extensionSem <- struct{}{}
 	// Check that the transfer to replica1 eventually happens.
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		if _, pErr := client.SendWrappedWith(
 			context.Background(),
 			mtc.senders[0],
@@ -720,6 +766,55 @@ func TestLeaseNotUsedAfterRestart(t *testing.T) {
 	}
 }
 
+// TestExpireLease verifies that multiTestContext.expireLease moves the clock
+// just past the expiration of the range's lease, and that the next request
+// acquires a new lease.
+func TestExpireLease(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	sc := storage.TestStoreConfig(nil)
+	sc.TestingKnobs.DisableSplitQueue = true
+	mtc := &multiTestContext{storeConfig: &sc}
+	mtc.Start(t, 1)
+	defer mtc.Stop()
+
+	// Send a read, to acquire a lease.
+	getArgs := getArgs([]byte("a"))
+	if _, err := client.SendWrapped(context.Background(), rg1(mtc.stores[0]), &getArgs); err != nil {
+		t.Fatal(err)
+	}
+	rep, err := mtc.stores[0].GetReplica(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lease, _ := rep.GetLease()
+	before := mtc.clock.Now()
+	if !lease.Covers(before) {
+		t.Fatalf("expected lease %s to cover %s", lease, before)
+	}
+
+	mtc.expireLease(1)
+	now := mtc.clock.Now()
+	if now.Less(lease.Expiration) || lease.Covers(now) {
+		t.Fatalf("expected lease %s to be expired at %s", lease, now)
+	}
+	if max := before.WallTime + mtc.stores[0].LeaseExpiration(mtc.clock); now.WallTime >= max {
+		t.Errorf("expected clock to advance by less than expireLeases does, got %s", now)
+	}
+
+	// Expiring an expired lease leaves the clock alone.
+	mtc.expireLease(1)
+	if after := mtc.clock.Now(); after.WallTime != now.WallTime {
+		t.Errorf("expected clock to remain at %s, got %s", now, after)
+	}
+
+	if _, err := client.SendWrapped(context.Background(), rg1(mtc.stores[0]), &getArgs); err != nil {
+		t.Fatal(err)
+	}
+	if newLease, _ := rep.GetLease(); !lease.Expiration.Less(newLease.Expiration) {
+		t.Fatalf("expected a new lease after %s, got %s", lease, newLease)
+	}
+}
+
 // Test that a lease extension (a RequestLeaseRequest that doesn't change the
 // lease holder) is not blocked by ongoing reads.
 // The test relies on two things:
@@ -877,7 +972,7 @@ func TestLeaseInfoRequest(t *testing.T) {
 
 	// A read on the new lease holder does not necessarily succeed immediately,
 	// since it might take a while for it to apply the transfer.
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		// We can't reliably do a CONSISTENT read here, even though we're reading
 		// from the supposed lease holder, because this node might initially be
 		// unaware of the new lease and so the request might bounce around for a
@@ -969,7 +1064,7 @@ func TestRangeInfo(t *testing.T) {
 	// Get the replicas for each side of the split. This is done within
 	// a SucceedsSoon loop to ensure the split completes.
 	var lhsReplica0, lhsReplica1, rhsReplica0, rhsReplica1 *storage.Replica
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		lhsReplica0 = mtc.stores[0].LookupReplica(roachpb.RKeyMin, nil)
 		lhsReplica1 = mtc.stores[1].LookupReplica(roachpb.RKeyMin, nil)
 		rhsReplica0 = mtc.stores[0].LookupReplica(splitKey, nil)
@@ -1103,3 +1198,51 @@ func TestRangeInfo(t *testing.T) {
 		t.Errorf("on scan reply, expected %+v; got %+v", expRangeInfos, reply.Header().RangeInfos)
 	}
 }
+
+// TestVerifyNoUnresolvedIntents verifies that the multiTestContext finds the
+// intents and the record of a pending transaction, and none once the
+// transaction has committed.
+func TestVerifyNoUnresolvedIntents(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	sc := storage.TestStoreConfig(nil)
+	sc.TestingKnobs.DisableSplitQueue = true
+	mtc := &multiTestContext{storeConfig: &sc, verifyIntentsOnStop: true}
+	mtc.Start(t, 1)
+	defer mtc.Stop()
+
+	key := roachpb.Key("a")
+	txn := roachpb.NewTransaction("test", key, 1, enginepb.SERIALIZABLE, mtc.clock.Now(), 0)
+	var ba roachpb.BatchRequest
+	ba.Txn = txn
+	ba.Add(&roachpb.BeginTransactionRequest{Span: roachpb.Span{Key: key}})
+	pArgs := putArgs(key, []byte("value"))
+	ba.Add(&pArgs)
+	br, pErr := rg1(mtc.stores[0]).Send(context.Background(), ba)
+	if pErr != nil {
+		t.Fatal(pErr)
+	}
+
+	found, err := mtc.findUnresolvedIntents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 {
+		t.Fatalf("expected an intent and a pending txn record, got %v", found)
+	}
+	if err := mtc.checkNoUnresolvedIntents(); err == nil {
+		t.Fatal("expected unresolved intents to be reported")
+	}
+
+	ba = roachpb.BatchRequest{}
+	ba.Txn = br.Txn
+	ba.Txn.Sequence++
+	ba.Add(&roachpb.EndTransactionRequest{
+		Span:        roachpb.Span{Key: key},
+		Commit:      true,
+		IntentSpans: []roachpb.Span{{Key: key}},
+	})
+	if _, pErr := rg1(mtc.stores[0]).Send(context.Background(), ba); pErr != nil {
+		t.Fatal(pErr)
+	}
+	mtc.verifyNoUnresolvedIntents()
+}
@@ -0,0 +1,357 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage_test
+
+import (
+	"bytes"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/storage/engine"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/stop"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+)
+
+// slowEngineLatencies are the latencies injected by a slowEngine.
+type slowEngineLatencies struct {
+	// Read delays point lookups, iterations and iterator seeks.
+	Read time.Duration
+	// Write delays writes which are applied to the engine directly, as well
+	// as batch commits.
+	Write time.Duration
+	// Sync delays batch commits and flushes, in addition to Write.
+	Sync time.Duration
+}
+
+// slowLatencies holds the latencies of a slowEngine, which can be changed
+// while the engine is in use.
+type slowLatencies struct {
+	read, write, sync int64 // time.Duration; accessed atomically
+}
+
+func (l *slowLatencies) delay(ptrs ...*int64) {
+	var d time.Duration
+	for _, p := range ptrs {
+		d += time.Duration(atomic.LoadInt64(p))
+	}
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
+
+func (l *slowLatencies) delayRead()  { l.delay(&l.read) }
+func (l *slowLatencies) delayWrite() { l.delay(&l.write) }
+func (l *slowLatencies) delaySync()  { l.delay(&l.write, &l.sync) }
+
+// slowEngine wraps an engine and injects configurable latencies into its
+// reads, writes and syncs, which allows testing the behavior of a store on a
+// slow (but not failed) disk. Without latencies, all operations are passed
+// through to the wrapped engine.
+type slowEngine struct {
+	engine.Engine
+	latencies *slowLatencies
+}
+
+var _ engine.Engine = slowEngine{}
+
+// newSlowEngine wraps the supplied engine. The wrapped engine is closed
+// along with the slowEngine.
+func newSlowEngine(eng engine.Engine) slowEngine {
+	return slowEngine{Engine: eng, latencies: &slowLatencies{}}
+}
+
+// setLatencies sets the latencies injected into subsequent operations.
+// Operations which are already delayed are not affected.
+func (e slowEngine) setLatencies(l slowEngineLatencies) {
+	atomic.StoreInt64(&e.latencies.read, int64(l.Read))
+	atomic.StoreInt64(&e.latencies.write, int64(l.Write))
+	atomic.StoreInt64(&e.latencies.sync, int64(l.Sync))
+}
+
+// getLatencies returns the currently injected latencies.
+func (e slowEngine) getLatencies() slowEngineLatencies {
+	return slowEngineLatencies{
+		Read:  time.Duration(atomic.LoadInt64(&e.latencies.read)),
+		Write: time.Duration(atomic.LoadInt64(&e.latencies.write)),
+		Sync:  time.Duration(atomic.LoadInt64(&e.latencies.sync)),
+	}
+}
+
+// Get implements the engine.Reader interface.
+func (e slowEngine) Get(key engine.MVCCKey) ([]byte, error) {
+	e.latencies.delayRead()
+	return e.Engine.Get(key)
+}
+
+// GetProto implements the engine.Reader interface.
+func (e slowEngine) GetProto(
+	key engine.MVCCKey, msg proto.Message,
+) (ok bool, keyBytes, valBytes int64, err error) {
+	e.latencies.delayRead()
+	return e.Engine.GetProto(key, msg)
+}
+
+// Iterate implements the engine.Reader interface.
+func (e slowEngine) Iterate(
+	start, end engine.MVCCKey, f func(engine.MVCCKeyValue) (bool, error),
+) error {
+	e.latencies.delayRead()
+	return e.Engine.Iterate(start, end, f)
+}
+
+// NewIterator implements the engine.Reader interface.
+func (e slowEngine) NewIterator(prefix bool) engine.Iterator {
+	return slowIterator{Iterator: e.Engine.NewIterator(prefix), latencies: e.latencies}
+}
+
+// ApplyBatchRepr implements the engine.Writer interface.
+func (e slowEngine) ApplyBatchRepr(repr []byte) error {
+	e.latencies.delayWrite()
+	return e.Engine.ApplyBatchRepr(repr)
+}
+
+// Clear implements the engine.Writer interface.
+func (e slowEngine) Clear(key engine.MVCCKey) error {
+	e.latencies.delayWrite()
+	return e.Engine.Clear(key)
+}
+
+// ClearRange implements the engine.Writer interface.
+func (e slowEngine) ClearRange(start, end engine.MVCCKey) error {
+	e.latencies.delayWrite()
+	return e.Engine.ClearRange(start, end)
+}
+
+// Merge implements the engine.Writer interface.
+func (e slowEngine) Merge(key engine.MVCCKey, value []byte) error {
+	e.latencies.delayWrite()
+	return e.Engine.Merge(key, value)
+}
+
+// Put implements the engine.Writer interface.
+func (e slowEngine) Put(key engine.MVCCKey, value []byte) error {
+	e.latencies.delayWrite()
+	return e.Engine.Put(key, value)
+}
+
+// Flush implements the engine.Engine interface.
+func (e slowEngine) Flush() error {
+	e.latencies.delaySync()
+	return e.Engine.Flush()
+}
+
+// SyncWAL implements the engine.Engine interface.
+func (e slowEngine) SyncWAL() error {
+	e.latencies.delaySync()
+	return e.Engine.SyncWAL()
+}
+
+// NewBatch implements the engine.Engine interface.
+func (e slowEngine) NewBatch() engine.Batch {
+	return slowBatch{Batch: e.Engine.NewBatch(), latencies: e.latencies}
+}
+
+// NewSnapshot implements the engine.Engine interface.
+func (e slowEngine) NewSnapshot() engine.Reader {
+	return slowReader{Reader: e.Engine.NewSnapshot(), latencies: e.latencies}
+}
+
+// slowReader delays the reads of a snapshot.
+type slowReader struct {
+	engine.Reader
+	latencies *slowLatencies
+}
+
+func (r slowReader) Get(key engine.MVCCKey) ([]byte, error) {
+	r.latencies.delayRead()
+	return r.Reader.Get(key)
+}
+
+func (r slowReader) GetProto(
+	key engine.MVCCKey, msg proto.Message,
+) (ok bool, keyBytes, valBytes int64, err error) {
+	r.latencies.delayRead()
+	return r.Reader.GetProto(key, msg)
+}
+
+func (r slowReader) Iterate(
+	start, end engine.MVCCKey, f func(engine.MVCCKeyValue) (bool, error),
+) error {
+	r.latencies.delayRead()
+	return r.Reader.Iterate(start, end, f)
+}
+
+func (r slowReader) NewIterator(prefix bool) engine.Iterator {
+	return slowIterator{Iterator: r.Reader.NewIterator(prefix), latencies: r.latencies}
+}
+
+// slowReadWriter delays the reads of a distinct batch. Writes are buffered
+// in memory until the parent batch commits and are not delayed.
+type slowReadWriter struct {
+	engine.ReadWriter
+	latencies *slowLatencies
+}
+
+func (rw slowReadWriter) Get(key engine.MVCCKey) ([]byte, error) {
+	rw.latencies.delayRead()
+	return rw.ReadWriter.Get(key)
+}
+
+func (rw slowReadWriter) GetProto(
+	key engine.MVCCKey, msg proto.Message,
+) (ok bool, keyBytes, valBytes int64, err error) {
+	rw.latencies.delayRead()
+	return rw.ReadWriter.GetProto(key, msg)
+}
+
+func (rw slowReadWriter) Iterate(
+	start, end engine.MVCCKey, f func(engine.MVCCKeyValue) (bool, error),
+) error {
+	rw.latencies.delayRead()
+	return rw.ReadWriter.Iterate(start, end, f)
+}
+
+func (rw slowReadWriter) NewIterator(prefix bool) engine.Iterator {
+	return slowIterator{Iterator: rw.ReadWriter.NewIterator(prefix), latencies: rw.latencies}
+}
+
+// slowBatch delays the reads and the commit of a batch. Like for distinct
+// batches, writes are buffered in memory and not delayed.
+type slowBatch struct {
+	engine.Batch
+	latencies *slowLatencies
+}
+
+func (b slowBatch) Get(key engine.MVCCKey) ([]byte, error) {
+	b.latencies.delayRead()
+	return b.Batch.Get(key)
+}
+
+func (b slowBatch) GetProto(
+	key engine.MVCCKey, msg proto.Message,
+) (ok bool, keyBytes, valBytes int64, err error) {
+	b.latencies.delayRead()
+	return b.Batch.GetProto(key, msg)
+}
+
+func (b slowBatch) Iterate(
+	start, end engine.MVCCKey, f func(engine.MVCCKeyValue) (bool, error),
+) error {
+	b.latencies.delayRead()
+	return b.Batch.Iterate(start, end, f)
+}
+
+func (b slowBatch) NewIterator(prefix bool) engine.Iterator {
+	return slowIterator{Iterator: b.Batch.NewIterator(prefix), latencies: b.latencies}
+}
+
+func (b slowBatch) Commit() error {
+	b.latencies.delaySync()
+	return b.Batch.Commit()
+}
+
+func (b slowBatch) Distinct() engine.ReadWriter {
+	return slowReadWriter{ReadWriter: b.Batch.Distinct(), latencies: b.latencies}
+}
+
+// slowIterator delays the seeks of an iterator. Stepping an iterator
+// usually hits cached blocks and is not delayed.
+type slowIterator struct {
+	engine.Iterator
+	latencies *slowLatencies
+}
+
+func (i slowIterator) Seek(key engine.MVCCKey) {
+	i.latencies.delayRead()
+	i.Iterator.Seek(key)
+}
+
+func (i slowIterator) SeekReverse(key engine.MVCCKey) {
+	i.latencies.delayRead()
+	i.Iterator.SeekReverse(key)
+}
+
+// TestSlowEngineLatencies verifies that a slowEngine delays the operations
+// of the configured kinds and passes them through to the wrapped engine.
+func TestSlowEngineLatencies(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+	e := newSlowEngine(engine.NewInMem(roachpb.Attributes{}, 1<<20))
+	stopper.AddCloser(e)
+
+	const latency = 20 * time.Millisecond
+	key := engine.MakeMVCCMetadataKey(roachpb.Key("a"))
+	value := []byte("value")
+
+	timed := func(op string, expDelayed bool, f func() error) {
+		start := timeutil.Now()
+		if err := f(); err != nil {
+			t.Fatalf("%s: %s", op, err)
+		}
+		// Only the presence of delays is verified; operations which are not
+		// delayed may still be slow on an overloaded machine.
+		if elapsed := timeutil.Now().Sub(start); expDelayed && elapsed < latency {
+			t.Errorf("%s: expected a delay of at least %s, took %s", op, latency, elapsed)
+		}
+	}
+	get := func() error {
+		val, err := e.Get(key)
+		if err == nil && !bytes.Equal(val, value) {
+			t.Errorf("expected %q, got %q", value, val)
+		}
+		return err
+	}
+	commit := func() error {
+		b := e.NewBatch()
+		defer b.Close()
+		if err := b.Put(key, value); err != nil {
+			return err
+		}
+		return b.Commit()
+	}
+
+	e.setLatencies(slowEngineLatencies{Write: latency})
+	timed("put", true, func() error { return e.Put(key, value) })
+	timed("get", false, get)
+
+	e.setLatencies(slowEngineLatencies{Read: latency})
+	timed("put", false, func() error { return e.Put(key, value) })
+	timed("get", true, get)
+	timed("seek", true, func() error {
+		iter := e.NewIterator(false)
+		defer iter.Close()
+		iter.Seek(key)
+		return iter.Error()
+	})
+	timed("commit", false, commit)
+
+	e.setLatencies(slowEngineLatencies{Sync: latency})
+	if l := e.getLatencies(); l != (slowEngineLatencies{Sync: latency}) {
+		t.Errorf("unexpected latencies %+v", l)
+	}
+	timed("commit", true, commit)
+	timed("flush", true, e.Flush)
+
+	e.setLatencies(slowEngineLatencies{})
+	timed("commit", false, commit)
+	timed("get", false, get)
+}
@@ -44,7 +44,6 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/testutils/testcluster"
 	"github.com/cockroachdb/cockroach/pkg/ts"
 	"github.com/cockroachdb/cockroach/pkg/ts/tspb"
-	"github.com/cockroachdb/cockroach/pkg/util"
 	"github.com/cockroachdb/cockroach/pkg/util/encoding"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
@@ -715,7 +714,7 @@ func TestStoreZoneUpdateAndRangeSplit(t *testing.T) {
 
 		// Wait for the range to be split along table boundaries.
 		expectedRSpan := roachpb.RSpan{Key: roachpb.RKey(tableBoundary), EndKey: roachpb.RKeyMax}
-		util.SucceedsSoon(t, func() error {
+		storage.SucceedsSoon(t, func() error {
 			repl = store.LookupReplica(tableBoundary, nil)
 			if actualRSpan := repl.Desc().RSpan(); !actualRSpan.Equal(expectedRSpan) {
 				return errors.Errorf("expected range %s to span %s", repl, expectedRSpan)
@@ -733,7 +732,7 @@ func TestStoreZoneUpdateAndRangeSplit(t *testing.T) {
 	}
 
 	// Verify that the range is in fact split.
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		repl := store.LookupReplica(keys.MakeTablePrefix(descID+1), nil)
 		rngDesc := repl.Desc()
 		rngStart, rngEnd := rngDesc.StartKey, rngDesc.EndKey
@@ -766,7 +765,7 @@ func TestStoreRangeSplitWithMaxBytesUpdate(t *testing.T) {
 	}
 
 	// Verify that the range is split and the new range has the correct max bytes.
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		newRng := store.LookupReplica(keys.MakeTablePrefix(descID), nil)
 		if newRng.RangeID == origRng.RangeID {
 			return errors.Errorf("expected new range created by split")
@@ -843,7 +842,7 @@ func TestStoreRangeSystemSplits(t *testing.T) {
 		}
 		expKeys = append(expKeys, testutils.MakeKey(keys.Meta2Prefix, roachpb.RKeyMax))
 
-		util.SucceedsSoonDepth(1, t, func() error {
+		storage.SucceedsSoonDepth(1, t, func() error {
 			rows, err := store.DB().Scan(context.TODO(), keys.Meta2Prefix, keys.MetaMax, 0)
 			if err != nil {
 				return err
@@ -947,7 +946,7 @@ func runSetupSplitSnapshotRace(
 	// Get the right range's ID. Since the split was performed on node
 	// 1, it is currently 11 and not 3 as might be expected.
 	var rightRangeID roachpb.RangeID
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		rightRangeID = mtc.stores[1].LookupReplica(roachpb.RKey("z"), nil).RangeID
 		if rightRangeID == leftRangeID {
 			return errors.Errorf("store 1 hasn't processed split yet")
@@ -1701,7 +1700,7 @@ func TestStoreSplitBeginTxnPushMetaIntentRace(t *testing.T) {
 	// SucceedsSoon because of the chance the GC is initiated before
 	// the range is fully split, meaning the initial GC may fail because
 	// it spans ranges.
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		return store.ManualReplicaGC(store.LookupReplica(splitKey, nil))
 	})
 
@@ -1712,7 +1711,7 @@ func TestStoreSplitBeginTxnPushMetaIntentRace(t *testing.T) {
 
 	// Now verify that the meta2/splitKey meta2 record is present; do this
 	// within a SucceedSoon in order to give the intents time to resolve.
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		val, intents, err := engine.MVCCGet(context.Background(), store.Engine(),
 			keys.RangeMetaKey(splitKey), hlc.MaxTimestamp, true, nil)
 		if err != nil {
@@ -1727,3 +1726,39 @@ func TestStoreSplitBeginTxnPushMetaIntentRace(t *testing.T) {
 		return nil
 	})
 }
+
+// TestMultiTestContextSplitRange verifies that multiTestContext.splitRange
+// returns the descriptors of both sides of the split once all replicas have
+// applied it, and that lookupRange agrees with them.
+func TestMultiTestContextSplitRange(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	sc := storage.TestStoreConfig(nil)
+	sc.TestingKnobs.DisableSplitQueue = true
+	mtc := &multiTestContext{storeConfig: &sc}
+	mtc.Start(t, 3)
+	defer mtc.Stop()
+
+	mtc.replicateRange(1, 1, 2)
+
+	splitKey := roachpb.Key("m")
+	left, right := mtc.splitRange(splitKey)
+	if left.RangeID != 1 || right.RangeID == left.RangeID {
+		t.Fatalf("unexpected range IDs after split: %s, %s", left, right)
+	}
+	if !right.StartKey.Equal(roachpb.RKey(splitKey)) {
+		t.Fatalf("expected right hand side to start at %s, got %s", splitKey, right)
+	}
+	for i, s := range mtc.stores {
+		if rep := s.LookupReplica(roachpb.RKey(splitKey), nil); rep == nil || rep.RangeID != right.RangeID {
+			t.Errorf("store %d: expected replica of %s, got %v", i, right, rep)
+		}
+	}
+
+	// Lookups don't depend on any particular store.
+	mtc.stopStore(2)
+	for key, expected := range map[string]roachpb.RangeDescriptor{"a": left, "z": right} {
+		if desc := mtc.lookupRange(roachpb.Key(key)); !reflect.DeepEqual(desc, expected) {
+			t.Errorf("%s: expected %s, got %s", key, expected, desc)
+		}
+	}
+}
@@ -23,7 +23,7 @@ import (
 
 	"github.com/cockroachdb/cockroach/pkg/internal/client"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
-	"github.com/cockroachdb/cockroach/pkg/util"
+	"github.com/cockroachdb/cockroach/pkg/storage"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/pkg/errors"
 )
@@ -48,7 +48,7 @@ func TestComputeStatsForKeySpan(t *testing.T) {
 	}
 
 	// Wait for splits to finish.
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		repl := mtc.stores[0].LookupReplica(roachpb.RKey("z"), nil)
 		if actualRSpan := repl.Desc().RSpan(); !actualRSpan.Key.Equal(roachpb.RKey("i")) {
 			return errors.Errorf("expected range %s to begin at key 'i'", repl)
@@ -25,17 +25,21 @@ client_*.go.
 package storage_test
 
 import (
+	"bytes"
 	"fmt"
 	"math/rand"
 	"net"
 	"reflect"
 	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/cenk/backoff"
 	"github.com/coreos/etcd/raft"
+	"github.com/coreos/etcd/raft/raftpb"
 	"github.com/kr/pretty"
 	"github.com/pkg/errors"
 	circuit "github.com/rubyist/circuitbreaker"
@@ -54,15 +58,20 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/storage"
 	"github.com/cockroachdb/cockroach/pkg/storage/engine"
 	"github.com/cockroachdb/cockroach/pkg/storage/engine/enginepb"
+	"github.com/cockroachdb/cockroach/pkg/testutils"
 	"github.com/cockroachdb/cockroach/pkg/util"
+	"github.com/cockroachdb/cockroach/pkg/util/envutil"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/metric"
 	"github.com/cockroachdb/cockroach/pkg/util/netutil"
+	"github.com/cockroachdb/cockroach/pkg/util/randutil"
 	"github.com/cockroachdb/cockroach/pkg/util/stop"
 	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 	"github.com/cockroachdb/cockroach/pkg/util/tracing"
+	"github.com/cockroachdb/cockroach/pkg/util/uuid"
 )
 
 // rg1 returns a wrapping sender that changes all requests to range 0 to
@@ -157,7 +166,7 @@ func createTestStoreWithEngine(
 	)
 	storeCfg.Transport = storage.NewDummyRaftTransport()
 	// TODO(bdarnell): arrange to have the transport closed.
-	store := storage.NewStore(storeCfg, eng, nodeDesc)
+	store := storage.NewStore(storeCfg, eng, nil /* raftEng */, nodeDesc)
 	if bootstrap {
 		if err := store.Bootstrap(roachpb.StoreIdent{NodeID: 1, StoreID: 1}); err != nil {
 			t.Fatal(err)
@@ -185,6 +194,38 @@ type multiTestContext struct {
 
 	nodeIDtoAddr map[roachpb.NodeID]net.Addr
 
+	// If distinctClocks is set before Start(), every store gets its own
+	// clock, which reads the physical time of multiTestContext.clock plus
+	// the store's skew in clockSkews (accessed atomically), instead of an
+	// alias of multiTestContext.clock; see advanceNodeClock.
+	distinctClocks bool
+	clockSkews     []*int64
+
+	// If deterministic is set before Start(), the random decisions of the
+	// harness and its stores derive from seed: store pools are
+	// deterministic, the allocator of every store is seeded, and so are
+	// chaos runners and link faults which were not given a seed of their
+	// own. Setting seed implies deterministic. If no seed is set, it is
+	// taken from COCKROACH_MTC_SEED or chosen randomly, and logged.
+	deterministic bool
+	seed          int64
+
+	// If grpcTransport is set before Start(), the DistSenders send their
+	// requests over gRPC to the Internal service of the nodes, like in
+	// production, instead of handing them to the destination stores
+	// directly. Partitions and link faults then apply to Raft traffic only.
+	grpcTransport bool
+
+	// If verifyIntentsOnStop is set before Start(), Stop fails the test if
+	// unresolved intents or pending transaction records are left behind.
+	// See verifyNoUnresolvedIntents.
+	verifyIntentsOnStop bool
+
+	// If slowEngines is set before Start(), the engines created by the
+	// multiTestContext are wrapped so that setEngineLatencies can simulate
+	// slow disks.
+	slowEngines bool
+
 	// The per-store clocks slice normally contains aliases of
 	// multiTestContext.clock, but it may be populated before Start() to
 	// use distinct clocks per store.
@@ -197,9 +238,14 @@ type multiTestContext struct {
 	gossips        []*gossip.Gossip
 	nodeLivenesses []*storage.NodeLiveness
 	storePools     []*storage.StorePool
+	// livenessPaused holds, per store, whether the liveness heartbeats of
+	// its node are paused (accessed atomically); see pauseNodeLiveness.
+	livenessPaused []*int32
 	// We use multiple stoppers so we can restart different parts of the
 	// test individually. transportStopper is for 'transports', and the
-	// 'stoppers' slice corresponds to the 'stores'.
+	// 'stoppers' slice corresponds to the 'stores'. The engineStoppers are
+	// children of transportStopper which are stopped after it, so that the
+	// engines are closed once the transports have stopped.
 	// TODO(bdarnell): now that there are multiple transports, do we
 	// need transportStopper?
 	transportStopper   *stop.Stopper
@@ -213,6 +259,20 @@ type multiTestContext struct {
 	stores   []*storage.Store
 	stoppers []*stop.Stopper
 	idents   []roachpb.StoreIdent
+
+	// partitioned holds the pairs of nodes which cannot communicate with
+	// each other; see partition. It is protected by 'partitionMu'.
+	partitionMu *syncutil.Mutex
+	partitioned map[[2]roachpb.NodeID]struct{}
+	// links holds the links between nodes with injected faults; see
+	// setLinkFaults. It is also protected by 'partitionMu'.
+	links map[[2]roachpb.NodeID]*mtcLink
+	// raftTraffic accounts for the Raft messages received by the nodes;
+	// see raftTrafficSnapshot. It is also protected by 'partitionMu'.
+	raftTraffic mtcRaftTraffic
+
+	// chaos is the chaos runner started by StartChaos, if it is running.
+	chaos *mtcChaos
 }
 
 func (m *multiTestContext) getNodeIDAddress(nodeID roachpb.NodeID) (net.Addr, error) {
@@ -243,6 +303,11 @@ func (m *multiTestContext) Start(t *testing.T, numStores int) {
 		mCopy.clocks = nil
 		mCopy.clock = nil
 		mCopy.timeUntilStoreDead = 0
+		mCopy.distinctClocks = false
+		mCopy.deterministic = false
+		mCopy.seed = 0
+		mCopy.grpcTransport = false
+		mCopy.verifyIntentsOnStop = false
 		var empty multiTestContext
 		if !reflect.DeepEqual(empty, mCopy) {
 			t.Fatalf("illegal fields set in multiTestContext:\n%s", pretty.Diff(empty, mCopy))
@@ -250,7 +315,19 @@ func (m *multiTestContext) Start(t *testing.T, numStores int) {
 	}
 	m.t = t
 
+	if m.deterministic || m.seed != 0 {
+		m.deterministic = true
+		if m.seed == 0 {
+			m.seed = mtcSeed
+		}
+		if m.seed == 0 {
+			m.seed = randutil.NewPseudoSeed()
+		}
+		t.Logf("multiTestContext seed: %d (set COCKROACH_MTC_SEED to reproduce)", m.seed)
+	}
+
 	m.mu = &syncutil.RWMutex{}
+	m.partitionMu = &syncutil.Mutex{}
 	m.stores = make([]*storage.Store, numStores)
 	m.storePools = make([]*storage.StorePool, numStores)
 	m.distSenders = make([]*kv.DistSender, numStores)
@@ -262,6 +339,7 @@ func (m *multiTestContext) Start(t *testing.T, numStores int) {
 	m.transports = make([]*storage.RaftTransport, numStores)
 	m.gossips = make([]*gossip.Gossip, numStores)
 	m.nodeLivenesses = make([]*storage.NodeLiveness, numStores)
+	m.livenessPaused = make([]*int32, numStores)
 
 	if m.manualClock == nil {
 		m.manualClock = hlc.NewManualClock(123)
@@ -269,6 +347,14 @@ func (m *multiTestContext) Start(t *testing.T, numStores int) {
 	if m.clock == nil {
 		m.clock = hlc.NewClock(m.manualClock.UnixNano, time.Nanosecond)
 	}
+	if m.distinctClocks {
+		if m.clocks != nil {
+			t.Fatal("distinctClocks cannot be combined with preset clocks")
+		}
+		for idx := 0; idx < numStores; idx++ {
+			m.addSkewedClock()
+		}
+	}
 	if m.transportStopper == nil {
 		m.transportStopper = stop.NewStopper()
 	}
@@ -288,7 +374,7 @@ func (m *multiTestContext) Start(t *testing.T, numStores int) {
 	}
 
 	// Wait for gossip to startup.
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		for i, g := range m.gossips {
 			if _, ok := g.GetSystemConfig(); !ok {
 				return errors.Errorf("system config not available at index %d", i)
@@ -299,6 +385,19 @@ func (m *multiTestContext) Start(t *testing.T, numStores int) {
 }
 
 func (m *multiTestContext) Stop() {
+	if m.chaos != nil {
+		if err := m.chaos.halt(); err != nil {
+			m.t.Error(err)
+		}
+	}
+	if m.verifyIntentsOnStop {
+		// Intents are resolved asynchronously, so give the stores a chance to
+		// clean up before they are stopped. The test is failed without
+		// bailing out so that the stores are stopped regardless.
+		if err := util.RetryForDuration(util.SucceedsSoonDuration(), m.checkNoUnresolvedIntents); err != nil {
+			m.t.Error(err)
+		}
+	}
 	done := make(chan struct{})
 	go func() {
 		m.mu.RLock()
@@ -330,11 +429,9 @@ func (m *multiTestContext) Stop() {
 				stopper.Stop()
 			}
 		}
+		// This also stops the engine stoppers which have not been stopped by
+		// RemoveStore.
 		m.transportStopper.Stop()
-
-		for _, s := range m.engineStoppers {
-			s.Stop()
-		}
 		close(done)
 	}()
 
@@ -368,7 +465,7 @@ func (m *multiTestContext) gossipStores() {
 		timestamps[storeKey] = infoStatus.Infos[storeKey].OrigStamp
 	}
 	// Wait until all stores know about each other.
-	util.SucceedsSoon(m.t, func() error {
+	storage.SucceedsSoon(m.t, func() error {
 		for i := 0; i < len(m.stores); i++ {
 			nodeID := m.stores[i].Ident.NodeID
 			infoStatus := m.gossips[i].GetInfoStatus()
@@ -390,7 +487,7 @@ func (m *multiTestContext) gossipStores() {
 // storePools have received those descriptors.
 func (m *multiTestContext) initGossipNetwork() {
 	m.gossipStores()
-	util.SucceedsSoon(m.t, func() error {
+	storage.SucceedsSoon(m.t, func() error {
 		for i := 0; i < len(m.stores); i++ {
 			if _, alive, _ := m.storePools[i].GetStoreList(roachpb.RangeID(0)); alive != len(m.stores) {
 				return errors.Errorf("node %d's store pool only has %d alive stores, expected %d",
@@ -404,23 +501,29 @@ func (m *multiTestContext) initGossipNetwork() {
 
 type multiTestContextKVTransport struct {
 	mtc      *multiTestContext
+	nodeID   roachpb.NodeID
 	ctx      context.Context
 	cancel   func()
 	replicas kv.ReplicaSlice
 	args     roachpb.BatchRequest
 }
 
-func (m *multiTestContext) kvTransportFactory(
-	_ kv.SendOptions, _ *rpc.Context, replicas kv.ReplicaSlice, args roachpb.BatchRequest,
-) (kv.Transport, error) {
-	ctx, cancel := context.WithCancel(context.Background())
-	return &multiTestContextKVTransport{
-		mtc:      m,
-		ctx:      ctx,
-		cancel:   cancel,
-		replicas: replicas,
-		args:     args,
-	}, nil
+// kvTransportFactory returns the kv.TransportFactory of the DistSender of
+// the specified node.
+func (m *multiTestContext) kvTransportFactory(nodeID roachpb.NodeID) kv.TransportFactory {
+	return func(
+		_ kv.SendOptions, _ *rpc.Context, replicas kv.ReplicaSlice, args roachpb.BatchRequest,
+	) (kv.Transport, error) {
+		ctx, cancel := context.WithCancel(context.Background())
+		return &multiTestContextKVTransport{
+			mtc:      m,
+			nodeID:   nodeID,
+			ctx:      ctx,
+			cancel:   cancel,
+			replicas: replicas,
+			args:     args,
+		}, nil
+	}
 }
 
 func (t *multiTestContextKVTransport) IsExhausted() bool {
@@ -439,6 +542,12 @@ func (t *multiTestContextKVTransport) SendNext(done chan<- kv.BatchCall) {
 		log.Infof(context.TODO(), "SendNext nodeIndex=%d", nodeIndex)
 	}
 
+	if t.mtc.isPartitioned(t.nodeID, rep.NodeID) {
+		done <- kv.BatchCall{Err: roachpb.NewSendError(
+			fmt.Sprintf("node %d is partitioned from node %d", t.nodeID, rep.NodeID))}
+		return
+	}
+
 	// This method crosses store boundaries: it is possible that the
 	// destination store is stopped while the source is still running.
 	// Run the send in a Task on the destination store to simulate what
@@ -446,7 +555,14 @@ func (t *multiTestContextKVTransport) SendNext(done chan<- kv.BatchCall) {
 	t.mtc.mu.RLock()
 	s := t.mtc.stoppers[nodeIndex]
 	t.mtc.mu.RUnlock()
+	plan := t.mtc.planFaults(t.nodeID, rep.NodeID)
 	if s == nil || s.RunAsyncTask(t.ctx, func(ctx context.Context) {
+		if err := plan.beforeSend(ctx, s); err != nil {
+			done <- kv.BatchCall{Err: err}
+			return
+		}
+		defer plan.afterSend()
+
 		t.mtc.mu.RLock()
 		sender := t.mtc.senders[nodeIndex]
 		t.mtc.mu.RUnlock()
@@ -464,26 +580,11 @@ func (t *multiTestContextKVTransport) SendNext(done chan<- kv.BatchCall) {
 			panic(roachpb.ErrorUnexpectedlySet(sender, br))
 		}
 		br.Error = pErr
-
-		// On certain errors, we must advance our manual clock to ensure
-		// that the next attempt has a chance of succeeding.
-		switch tErr := pErr.GetDetail().(type) {
-		case *roachpb.NotLeaseHolderError:
-			if leaseHolder := tErr.LeaseHolder; leaseHolder != nil {
-				t.mtc.mu.RLock()
-				leaseHolderStore := t.mtc.stores[leaseHolder.NodeID-1]
-				t.mtc.mu.RUnlock()
-				if leaseHolderStore == nil {
-					// The lease holder is known but down, so expire its lease.
-					t.mtc.expireLeases()
-				}
-			} else {
-				// stores has the range, is *not* the lease holder, but the
-				// lease holder is not known; this can happen if the lease
-				// holder is removed from the group. Move the manual clock
-				// forward in an attempt to expire the lease.
-				t.mtc.expireLeases()
-			}
+		t.mtc.maybeExpireLeases(pErr)
+		if plan.dropResponse {
+			done <- kv.BatchCall{Err: roachpb.NewSendError(fmt.Sprintf(
+				"response from node %d to node %d dropped", rep.NodeID, t.nodeID))}
+			return
 		}
 		done <- kv.BatchCall{Reply: br, Err: nil}
 	}) != nil {
@@ -491,6 +592,70 @@ func (t *multiTestContextKVTransport) SendNext(done chan<- kv.BatchCall) {
 	}
 }
 
+// maybeExpireLeases advances the manual clock to expire leases on errors
+// which indicate that the lease holder of a range is down or unknown, to
+// ensure that the next attempt has a chance of succeeding.
+func (m *multiTestContext) maybeExpireLeases(pErr *roachpb.Error) {
+	switch tErr := pErr.GetDetail().(type) {
+	case *roachpb.NotLeaseHolderError:
+		if leaseHolder := tErr.LeaseHolder; leaseHolder != nil {
+			m.mu.RLock()
+			leaseHolderStore := m.stores[leaseHolder.NodeID-1]
+			m.mu.RUnlock()
+			if leaseHolderStore == nil {
+				// The lease holder is known but down, so expire its lease.
+				m.expireLeases()
+			}
+		} else {
+			// stores has the range, is *not* the lease holder, but the
+			// lease holder is not known; this can happen if the lease
+			// holder is removed from the group. Move the manual clock
+			// forward in an attempt to expire the lease.
+			m.expireLeases()
+		}
+	}
+}
+
+// mtcInternalServer implements the Internal service of a node of a
+// multiTestContext which uses the gRPC transport; see grpcTransport.
+type mtcInternalServer struct {
+	mtc *multiTestContext
+	idx int
+}
+
+var _ roachpb.InternalServer = mtcInternalServer{}
+
+// Batch implements the roachpb.InternalServer interface. Like the Batch
+// method of server.Node, it returns errors of the stores in the response.
+func (s mtcInternalServer) Batch(
+	ctx context.Context, args *roachpb.BatchRequest,
+) (*roachpb.BatchResponse, error) {
+	s.mtc.mu.RLock()
+	stopper := s.mtc.stoppers[s.idx]
+	sender := s.mtc.senders[s.idx]
+	s.mtc.mu.RUnlock()
+	if stopper == nil {
+		return nil, errors.Errorf("node %d is stopped", s.idx+1)
+	}
+	var br *roachpb.BatchResponse
+	if err := stopper.RunTaskWithErr(func() error {
+		var pErr *roachpb.Error
+		br, pErr = sender.Send(ctx, *args)
+		if br == nil {
+			br = &roachpb.BatchResponse{}
+		}
+		if br.Error != nil {
+			panic(roachpb.ErrorUnexpectedlySet(sender, br))
+		}
+		br.Error = pErr
+		s.mtc.maybeExpireLeases(pErr)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return br, nil
+}
+
 func (t *multiTestContextKVTransport) MoveToFront(replica roachpb.ReplicaDescriptor) {
 }
 
@@ -571,11 +736,18 @@ func (m *multiTestContext) makeStoreConfig(i int) storage.StoreConfig {
 	cfg.StorePool = m.storePools[i]
 	cfg.TestingKnobs.DisableSplitQueue = true
 	cfg.TestingKnobs.ReplicateQueueAcceptsUnsplit = true
+	if m.deterministic {
+		cfg.TestingKnobs.RandSeed = m.seed + int64(i+1)
+	}
 	return cfg
 }
 
 var _ kv.RangeDescriptorDB = mtcRangeDescriptorDB{}
 
+// mtcSeed is the seed of deterministic multiTestContexts which were not
+// given a seed, so that failures of tests under stress can be reproduced.
+var mtcSeed = envutil.EnvOrDefaultInt64("COCKROACH_MTC_SEED", 0)
+
 type mtcRangeDescriptorDB struct {
 	*multiTestContext
 	ds **kv.DistSender
@@ -590,15 +762,20 @@ func (mrdb mtcRangeDescriptorDB) RangeLookup(
 func (m *multiTestContext) populateDB(idx int, stopper *stop.Stopper) {
 	retryOpts := base.DefaultRetryOptions()
 	retryOpts.Closer = stopper.ShouldQuiesce()
-	m.distSenders[idx] = kv.NewDistSender(kv.DistSenderConfig{
+	cfg := kv.DistSenderConfig{
 		Clock: m.clock,
 		RangeDescriptorDB: mtcRangeDescriptorDB{
 			multiTestContext: m,
 			ds:               &m.distSenders[idx],
 		},
-		TransportFactory: m.kvTransportFactory,
-		RPCRetryOptions:  &retryOpts,
-	}, m.gossips[idx])
+		RPCRetryOptions: &retryOpts,
+	}
+	if m.grpcTransport {
+		cfg.RPCContext = m.rpcContext
+	} else {
+		cfg.TransportFactory = m.kvTransportFactory(roachpb.NodeID(idx + 1))
+	}
+	m.distSenders[idx] = kv.NewDistSender(cfg, m.gossips[idx])
 	ambient := log.AmbientContext{Tracer: tracing.NewTracer()}
 	sender := kv.NewTxnCoordSender(
 		ambient,
@@ -619,7 +796,7 @@ func (m *multiTestContext) populateStorePool(idx int, stopper *stop.Stopper) {
 		m.rpcContext,
 		m.timeUntilStoreDead,
 		stopper,
-		/* deterministic */ false,
+		m.deterministic,
 	)
 }
 
@@ -637,9 +814,12 @@ func (m *multiTestContext) addStore(idx int) {
 	if len(m.engines) > idx {
 		eng = m.engines[idx]
 	} else {
-		engineStopper := stop.NewStopper()
+		engineStopper := m.transportStopper.NewChild(stop.StopAfterParent())
 		m.engineStoppers = append(m.engineStoppers, engineStopper)
 		eng = engine.NewInMem(roachpb.Attributes{}, 1<<20)
+		if m.slowEngines {
+			eng = newSlowEngine(eng)
+		}
 		engineStopper.AddCloser(eng)
 		m.engines = append(m.engines, eng)
 		needBootstrap = true
@@ -688,11 +868,17 @@ func (m *multiTestContext) addStore(idx int) {
 	nodeID := roachpb.NodeID(idx + 1)
 	cfg := m.makeStoreConfig(idx)
 	cfg.SetDefaults()
+	paused := new(int32)
+	m.livenessPaused[idx] = paused
+	livenessKnobs := cfg.TestingKnobs.NodeLiveness
+	livenessKnobs.PauseHeartbeat = func() bool {
+		return atomic.LoadInt32(paused) == 1
+	}
 	m.nodeLivenesses[idx] = storage.NewNodeLiveness(
 		ambient, m.clocks[idx], m.dbs[idx], m.gossips[idx],
-		cfg.RangeLeaseActiveDuration, cfg.RangeLeaseRenewalDuration,
+		cfg.RangeLeaseActiveDuration, cfg.RangeLeaseRenewalDuration, livenessKnobs,
 	)
-	store := storage.NewStore(cfg, eng, &roachpb.NodeDescriptor{NodeID: nodeID})
+	store := storage.NewStore(cfg, eng, nil /* raftEng */, &roachpb.NodeDescriptor{NodeID: nodeID})
 	if needBootstrap {
 		if err := store.Bootstrap(roachpb.StoreIdent{
 			NodeID:  roachpb.NodeID(idx + 1),
@@ -732,6 +918,9 @@ func (m *multiTestContext) addStore(idx int) {
 	storesServer := storage.MakeServer(m.nodeDesc(nodeID), stores)
 	storage.RegisterConsistencyServer(grpcServer, storesServer)
 	storage.RegisterFreezeServer(grpcServer, storesServer)
+	if m.grpcTransport {
+		roachpb.RegisterInternalServer(grpcServer, mtcInternalServer{mtc: m, idx: idx})
+	}
 
 	// Add newly created objects to the multiTestContext's collections.
 	// (these must be populated before the store is started so that
@@ -764,6 +953,7 @@ func (m *multiTestContext) addStore(idx int) {
 	if err := m.gossipNodeDesc(m.gossips[idx], nodeID); err != nil {
 		m.t.Fatal(err)
 	}
+	m.interceptRaftMessages(idx, store)
 	store.WaitForInit()
 
 	m.nodeLivenesses[idx].StartHeartbeat(context.Background(), stopper)
@@ -812,8 +1002,96 @@ func (m *multiTestContext) stopStore(i int) {
 	m.mu.Unlock()
 }
 
+// drainAndStopStore stops the store at index i gracefully: its queues are
+// stopped, it stops acquiring and extending range leases and its active
+// leases are transferred to other running members of their ranges before
+// the store is stopped. Leases of ranges without another running member can
+// only expire, so the test is failed if the drain doesn't complete within
+// the given timeout.
+func (m *multiTestContext) drainAndStopStore(i int, timeout time.Duration) {
+	m.mu.RLock()
+	store := m.stores[i]
+	m.mu.RUnlock()
+
+	store.SetQueuesActive(false)
+	drained := make(chan error, 1)
+	go func() {
+		drained <- store.DrainLeases(true)
+	}()
+	deadline := time.After(timeout)
+	for {
+		m.transferLeasesFrom(i)
+		select {
+		case err := <-drained:
+			if err != nil {
+				m.t.Fatalf("store %d: %s", i, err)
+			}
+			m.stopStore(i)
+			return
+		case <-deadline:
+			m.t.Fatalf("store %d: timed out after %s waiting for leases to drain", i, timeout)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// transferLeasesFrom attempts to transfer every active lease held by the
+// store at index i to another running member of the range.
+func (m *multiTestContext) transferLeasesFrom(i int) {
+	m.mu.RLock()
+	store := m.stores[i]
+	running := map[roachpb.StoreID]bool{}
+	for _, s := range m.stores {
+		if s != nil && s != store {
+			running[s.StoreID()] = true
+		}
+	}
+	m.mu.RUnlock()
+
+	var holders []*storage.Replica
+	now := store.Clock().Now()
+	store.VisitReplicas(func(rep *storage.Replica) bool {
+		if lease, _ := rep.GetLease(); lease != nil && lease.OwnedBy(store.StoreID()) && lease.Covers(now) {
+			holders = append(holders, rep)
+		}
+		return true
+	})
+	for _, rep := range holders {
+		for _, target := range rep.Desc().Replicas {
+			if !running[target.StoreID] {
+				continue
+			}
+			if err := rep.AdminTransferLease(target.StoreID); err != nil {
+				log.Warningf(context.TODO(), "store %d: unable to transfer lease of %s to store %d: %s",
+					i, rep, target.StoreID, err)
+				continue
+			}
+			break
+		}
+	}
+}
+
 // restartStore restarts a store previously stopped with StopStore.
 func (m *multiTestContext) restartStore(i int) {
+	m.restartStoreWithConfig(i, nil)
+}
+
+// restartStoreWithConfig is like restartStore, but passes the configuration
+// of the restarted store to mutate (if non-nil) before the store is created.
+// The changes only apply to this incarnation of the store; later restarts
+// use the unmodified configuration again.
+func (m *multiTestContext) restartStoreWithConfig(i int, mutate func(*storage.StoreConfig)) {
+	if err := m.restartStoreWithConfigErr(i, mutate); err != nil {
+		m.t.Fatal(err)
+	}
+}
+
+// restartStoreWithConfigErr is like restartStoreWithConfig, but returns an
+// error instead of failing the test if the store cannot be started. It can
+// be called from goroutines other than the test goroutine.
+func (m *multiTestContext) restartStoreWithConfigErr(
+	i int, mutate func(*storage.StoreConfig),
+) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.stoppers[i] = stop.NewStopper()
@@ -821,12 +1099,349 @@ func (m *multiTestContext) restartStore(i int) {
 	m.populateStorePool(i, m.stoppers[i])
 
 	cfg := m.makeStoreConfig(i)
-	m.stores[i] = storage.NewStore(cfg, m.engines[i], &roachpb.NodeDescriptor{NodeID: roachpb.NodeID(i + 1)})
+	if mutate != nil {
+		mutate(&cfg)
+	}
+	m.stores[i] = storage.NewStore(cfg, m.engines[i], nil /* raftEng */, &roachpb.NodeDescriptor{NodeID: roachpb.NodeID(i + 1)})
 	if err := m.stores[i].Start(context.Background(), m.stoppers[i]); err != nil {
-		m.t.Fatal(err)
+		return err
 	}
+	m.interceptRaftMessages(i, m.stores[i])
 	// The sender is assumed to still exist.
 	m.senders[i].AddStore(m.stores[i])
+	return nil
+}
+
+// partition simulates a network partition between the specified sets of
+// stores: Raft and KV traffic between stores of different sets is dropped,
+// while traffic within a set and to or from stores which are not part of
+// any set is unaffected. Any previous partition is replaced.
+func (m *multiTestContext) partition(sets ...[]int) {
+	dropped := make(map[[2]roachpb.NodeID]struct{})
+	for i := range sets {
+		for j := range sets {
+			if i == j {
+				continue
+			}
+			for _, from := range sets[i] {
+				for _, to := range sets[j] {
+					dropped[[2]roachpb.NodeID{roachpb.NodeID(from + 1), roachpb.NodeID(to + 1)}] = struct{}{}
+				}
+			}
+		}
+	}
+	m.partitionMu.Lock()
+	m.partitioned = dropped
+	m.partitionMu.Unlock()
+}
+
+// heal removes the partition created by partition.
+func (m *multiTestContext) heal() {
+	m.partitionMu.Lock()
+	m.partitioned = nil
+	m.partitionMu.Unlock()
+}
+
+// isPartitioned returns true if traffic from the first to the second node
+// is dropped.
+func (m *multiTestContext) isPartitioned(from, to roachpb.NodeID) bool {
+	m.partitionMu.Lock()
+	defer m.partitionMu.Unlock()
+	_, ok := m.partitioned[[2]roachpb.NodeID{from, to}]
+	return ok
+}
+
+// mtcLinkFaults configures the faults injected into the KV requests sent
+// from one node to another; see setLinkFaults.
+type mtcLinkFaults struct {
+	// DropRequest is the probability with which a request is dropped
+	// before it is delivered, and DropResponse the probability with which
+	// the response to a delivered request is dropped. Either way, the
+	// sender sees a SendError.
+	DropRequest, DropResponse float64
+	// Every request is delayed by Delay plus a random duration of up to
+	// Jitter.
+	Delay, Jitter time.Duration
+	// Reorder is the probability with which a request is held back until
+	// the next request over the link has been delivered, or for at most
+	// mtcMaxReorderDelay.
+	Reorder float64
+	// Seed seeds the random decisions, which makes the faults injected into
+	// a sequence of requests reproducible.
+	Seed int64
+}
+
+// mtcMaxReorderDelay is the maximum time a request held back for
+// reordering waits for the next request over its link.
+const mtcMaxReorderDelay = 100 * time.Millisecond
+
+// mtcLink is a link between two nodes with injected faults.
+type mtcLink struct {
+	faults mtcLinkFaults
+	mu     struct {
+		syncutil.Mutex
+		rand *rand.Rand
+		// held is closed once the request held back for reordering, if
+		// any, may be delivered.
+		held chan struct{}
+	}
+}
+
+// mtcFaultPlan describes the faults injected into a single request.
+type mtcFaultPlan struct {
+	from, to     roachpb.NodeID
+	dropRequest  bool
+	dropResponse bool
+	delay        time.Duration
+	// wait, if non-nil, holds the request back until it is closed. The
+	// request closes release, if non-nil, once it has been delivered.
+	wait, release chan struct{}
+}
+
+// setLinkFaults injects the specified faults into the KV requests sent
+// from the store at index from to the store at index to, replacing any
+// faults previously injected into the link. The faults are injected in
+// addition to partitions.
+func (m *multiTestContext) setLinkFaults(from, to int, faults mtcLinkFaults) {
+	if faults.Seed == 0 && m.deterministic {
+		faults.Seed = m.seed
+	}
+	link := &mtcLink{faults: faults}
+	link.mu.rand = rand.New(rand.NewSource(faults.Seed))
+	m.partitionMu.Lock()
+	defer m.partitionMu.Unlock()
+	if m.links == nil {
+		m.links = make(map[[2]roachpb.NodeID]*mtcLink)
+	}
+	m.links[[2]roachpb.NodeID{roachpb.NodeID(from + 1), roachpb.NodeID(to + 1)}] = link
+}
+
+// clearLinkFaults removes the faults injected by setLinkFaults.
+func (m *multiTestContext) clearLinkFaults() {
+	m.partitionMu.Lock()
+	m.links = nil
+	m.partitionMu.Unlock()
+}
+
+// planFaults draws the faults injected into the next KV request sent from
+// the first to the second node.
+func (m *multiTestContext) planFaults(from, to roachpb.NodeID) mtcFaultPlan {
+	plan := mtcFaultPlan{from: from, to: to}
+	m.partitionMu.Lock()
+	link := m.links[[2]roachpb.NodeID{from, to}]
+	m.partitionMu.Unlock()
+	if link == nil {
+		return plan
+	}
+
+	f := link.faults
+	link.mu.Lock()
+	defer link.mu.Unlock()
+	r := link.mu.rand
+	plan.dropRequest = r.Float64() < f.DropRequest
+	plan.dropResponse = r.Float64() < f.DropResponse
+	plan.delay = f.Delay
+	if f.Jitter > 0 {
+		plan.delay += time.Duration(r.Int63n(int64(f.Jitter)))
+	}
+	if reorder := r.Float64() < f.Reorder; reorder && link.mu.held == nil {
+		link.mu.held = make(chan struct{})
+		plan.wait = link.mu.held
+	} else {
+		plan.release, link.mu.held = link.mu.held, nil
+	}
+	return plan
+}
+
+// beforeSend delays the request as planned, and returns an error if the
+// request is to be dropped.
+func (p mtcFaultPlan) beforeSend(ctx context.Context, stopper *stop.Stopper) error {
+	if p.delay > 0 {
+		select {
+		case <-time.After(p.delay):
+		case <-ctx.Done():
+			return roachpb.NewSendError(ctx.Err().Error())
+		case <-stopper.ShouldQuiesce():
+			return roachpb.NewSendError("store is stopped")
+		}
+	}
+	if p.wait != nil {
+		select {
+		case <-p.wait:
+		case <-time.After(mtcMaxReorderDelay):
+		case <-ctx.Done():
+			return roachpb.NewSendError(ctx.Err().Error())
+		case <-stopper.ShouldQuiesce():
+			return roachpb.NewSendError("store is stopped")
+		}
+	}
+	if p.dropRequest {
+		p.afterSend()
+		return roachpb.NewSendError(fmt.Sprintf("request from node %d to node %d dropped", p.from, p.to))
+	}
+	return nil
+}
+
+// afterSend releases the request held back for reordering behind this
+// one, if any.
+func (p mtcFaultPlan) afterSend() {
+	if p.release != nil {
+		close(p.release)
+	}
+}
+
+// interceptRaftMessages replaces the Raft message handler of the store at
+// the specified index with one which drops the messages of partitioned
+// nodes.
+func (m *multiTestContext) interceptRaftMessages(i int, store *storage.Store) {
+	m.transports[i].Listen(store.StoreID(), &mtcPartitionedRaftHandler{
+		RaftMessageHandler: store,
+		mtc:                m,
+		nodeID:             roachpb.NodeID(i + 1),
+	})
+}
+
+// mtcPartitionedRaftHandler is a storage.RaftMessageHandler which drops
+// the messages received from nodes partitioned from its node.
+type mtcPartitionedRaftHandler struct {
+	storage.RaftMessageHandler
+	mtc    *multiTestContext
+	nodeID roachpb.NodeID
+}
+
+func (h *mtcPartitionedRaftHandler) HandleRaftRequest(
+	ctx context.Context, req *storage.RaftMessageRequest, respStream storage.RaftMessageResponseStream,
+) *roachpb.Error {
+	h.mtc.recordRaftTraffic(req, h.nodeID)
+	if h.mtc.isPartitioned(req.FromReplica.NodeID, h.nodeID) {
+		return nil
+	}
+	return h.RaftMessageHandler.HandleRaftRequest(ctx, req, respStream)
+}
+
+func (h *mtcPartitionedRaftHandler) HandleRaftResponse(
+	ctx context.Context, resp *storage.RaftMessageResponse,
+) error {
+	if h.mtc.isPartitioned(resp.FromReplica.NodeID, h.nodeID) {
+		return nil
+	}
+	return h.RaftMessageHandler.HandleRaftResponse(ctx, resp)
+}
+
+func (h *mtcPartitionedRaftHandler) HandleSnapshot(
+	header *storage.SnapshotRequest_Header, respStream storage.SnapshotResponseStream,
+) error {
+	h.mtc.recordRaftSnapshot(header, h.nodeID)
+	if from := header.RaftMessageRequest.FromReplica.NodeID; h.mtc.isPartitioned(from, h.nodeID) {
+		return errors.Errorf("node %d is partitioned from node %d", from, h.nodeID)
+	}
+	return h.RaftMessageHandler.HandleSnapshot(header, respStream)
+}
+
+// mtcRaftTrafficKey identifies the Raft messages of one type sent over the
+// link between two nodes.
+type mtcRaftTrafficKey struct {
+	From, To roachpb.NodeID
+	Type     raftpb.MessageType
+}
+
+// mtcRaftTrafficStats counts Raft messages and their encoded size.
+type mtcRaftTrafficStats struct {
+	Messages, Bytes int64
+}
+
+// mtcRaftTraffic holds the Raft traffic over the links between nodes, by
+// message type. Every heartbeat of a coalesced heartbeat request counts as a
+// message. Snapshots count as a single MsgSnap each, whose size does not
+// include the snapshot data. Messages dropped by partitions are included.
+type mtcRaftTraffic map[mtcRaftTrafficKey]mtcRaftTrafficStats
+
+// Sub returns the traffic which occurred since the earlier snapshot.
+func (t mtcRaftTraffic) Sub(earlier mtcRaftTraffic) mtcRaftTraffic {
+	diff := make(mtcRaftTraffic, len(t))
+	for k, stats := range t {
+		prev := earlier[k]
+		if stats != prev {
+			diff[k] = mtcRaftTrafficStats{
+				Messages: stats.Messages - prev.Messages,
+				Bytes:    stats.Bytes - prev.Bytes,
+			}
+		}
+	}
+	return diff
+}
+
+// Filter returns the sum of the traffic for which include returns true.
+func (t mtcRaftTraffic) Filter(include func(mtcRaftTrafficKey) bool) mtcRaftTrafficStats {
+	var sum mtcRaftTrafficStats
+	for k, stats := range t {
+		if include(k) {
+			sum.Messages += stats.Messages
+			sum.Bytes += stats.Bytes
+		}
+	}
+	return sum
+}
+
+// ByType returns the traffic of the given message type over all links.
+func (t mtcRaftTraffic) ByType(typ raftpb.MessageType) mtcRaftTrafficStats {
+	return t.Filter(func(k mtcRaftTrafficKey) bool { return k.Type == typ })
+}
+
+// recordRaftTraffic accounts for a Raft message request received by the
+// given node.
+func (m *multiTestContext) recordRaftTraffic(req *storage.RaftMessageRequest, to roachpb.NodeID) {
+	key := mtcRaftTrafficKey{From: req.FromReplica.NodeID, To: to}
+	m.partitionMu.Lock()
+	defer m.partitionMu.Unlock()
+	if len(req.Heartbeats) == 0 && len(req.HeartbeatResps) == 0 {
+		key.Type = req.Message.Type
+		m.recordRaftTrafficLocked(key, req.Size())
+		return
+	}
+	key.Type = raftpb.MsgHeartbeat
+	for _, hb := range req.Heartbeats {
+		m.recordRaftTrafficLocked(key, hb.Size())
+	}
+	key.Type = raftpb.MsgHeartbeatResp
+	for _, hb := range req.HeartbeatResps {
+		m.recordRaftTrafficLocked(key, hb.Size())
+	}
+}
+
+// recordRaftSnapshot accounts for a snapshot received by the given node.
+func (m *multiTestContext) recordRaftSnapshot(
+	header *storage.SnapshotRequest_Header, to roachpb.NodeID,
+) {
+	key := mtcRaftTrafficKey{From: header.RaftMessageRequest.FromReplica.NodeID, To: to, Type: raftpb.MsgSnap}
+	m.partitionMu.Lock()
+	defer m.partitionMu.Unlock()
+	m.recordRaftTrafficLocked(key, header.Size())
+}
+
+// recordRaftTrafficLocked accounts for a single Raft message of the given
+// size. partitionMu must be held.
+func (m *multiTestContext) recordRaftTrafficLocked(key mtcRaftTrafficKey, size int) {
+	if m.raftTraffic == nil {
+		m.raftTraffic = make(mtcRaftTraffic)
+	}
+	stats := m.raftTraffic[key]
+	stats.Messages++
+	stats.Bytes += int64(size)
+	m.raftTraffic[key] = stats
+}
+
+// raftTrafficSnapshot returns a copy of the Raft traffic received by all
+// nodes since the multiTestContext was started. Use Sub to compute the
+// traffic caused by a part of a test.
+func (m *multiTestContext) raftTrafficSnapshot() mtcRaftTraffic {
+	m.partitionMu.Lock()
+	defer m.partitionMu.Unlock()
+	snap := make(mtcRaftTraffic, len(m.raftTraffic))
+	for k, stats := range m.raftTraffic {
+		snap[k] = stats
+	}
+	return snap
 }
 
 func (m *multiTestContext) Store(i int) *storage.Store {
@@ -840,6 +1455,10 @@ func (m *multiTestContext) findStartKeyLocked(rangeID roachpb.RangeID) roachpb.R
 	// We can use the first store that returns results because the start
 	// key never changes.
 	for _, s := range m.stores {
+		if s == nil {
+			// Store is stopped.
+			continue
+		}
 		rep, err := s.GetReplica(rangeID)
 		if err == nil && rep.IsInitialized() {
 			return rep.Desc().StartKey
@@ -871,15 +1490,92 @@ func (m *multiTestContext) findMemberStoreLocked(desc roachpb.RangeDescriptor) *
 // so the stores should contain the same persistent storage as before.
 func (m *multiTestContext) restart() {
 	for i := range m.stores {
-		m.stopStore(i)
+		if !m.isRemoved(i) {
+			m.stopStore(i)
+		}
 	}
 	for i := range m.stores {
-		m.restartStore(i)
+		if !m.isRemoved(i) {
+			m.restartStore(i)
+		}
 	}
 }
 
+// AddNewStore creates a new node with a single store after Start, and
+// returns the index of the store. Like the stores created by Start, the
+// store is bootstrapped but holds no replicas.
+func (m *multiTestContext) AddNewStore() int {
+	m.mu.Lock()
+	idx := len(m.stores)
+	m.stores = append(m.stores, nil)
+	m.storePools = append(m.storePools, nil)
+	m.distSenders = append(m.distSenders, nil)
+	m.dbs = append(m.dbs, nil)
+	m.stoppers = append(m.stoppers, nil)
+	m.senders = append(m.senders, nil)
+	m.idents = append(m.idents, roachpb.StoreIdent{})
+	m.grpcServers = append(m.grpcServers, nil)
+	m.transports = append(m.transports, nil)
+	m.gossips = append(m.gossips, nil)
+	m.nodeLivenesses = append(m.nodeLivenesses, nil)
+	m.livenessPaused = append(m.livenessPaused, nil)
+	if m.distinctClocks {
+		m.addSkewedClock()
+	}
+	m.mu.Unlock()
+
+	m.addStore(idx)
+	storage.SucceedsSoon(m.t, func() error {
+		if _, ok := m.gossips[idx].GetSystemConfig(); !ok {
+			return errors.Errorf("system config not available at index %d", idx)
+		}
+		return nil
+	})
+	return idx
+}
+
+// RemoveStore permanently tears down the node of the store at index i:
+// the store is stopped, as by stopStore, the node's RPC server is stopped,
+// its address is forgotten, and its engine is closed. Unlike stopped stores,
+// removed stores cannot be restarted. They read as zero in
+// readIntFromEngines.
+func (m *multiTestContext) RemoveStore(i int) {
+	m.mu.RLock()
+	stopped := m.stoppers[i] == nil
+	m.mu.RUnlock()
+	if !stopped {
+		m.stopStore(i)
+	}
+	m.grpcServers[i].Stop()
+
+	m.mu.Lock()
+	delete(m.nodeIDtoAddr, roachpb.NodeID(i+1))
+	engineStopper := m.engineStoppers[i]
+	m.engineStoppers[i] = nil
+	m.engines[i] = nil
+	m.mu.Unlock()
+	engineStopper.Stop()
+}
+
+// isRemoved returns true if the store at index i was removed by
+// RemoveStore.
+func (m *multiTestContext) isRemoved(i int) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.engines[i] == nil
+}
+
 // replicateRange replicates the given range onto the given stores.
 func (m *multiTestContext) replicateRange(rangeID roachpb.RangeID, dests ...int) {
+	if err := m.replicateRangeErr(rangeID, dests...); err != nil {
+		m.t.Fatal(err)
+	}
+}
+
+// replicateRangeErr is like replicateRange, but returns an error instead of
+// failing the test if a replica cannot be added or does not catch up in
+// time. Replicas added before the failure are left in place.
+func (m *multiTestContext) replicateRangeErr(rangeID roachpb.RangeID, dests ...int) error {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
@@ -895,12 +1591,12 @@ func (m *multiTestContext) replicateRange(rangeID roachpb.RangeID, dests ...int)
 		// not.
 		var desc roachpb.RangeDescriptor
 		if err := m.dbs[dest].GetProto(ctx, keys.RangeDescriptorKey(startKey), &desc); err != nil {
-			m.t.Fatal(err)
+			return err
 		}
 
 		rep, err := m.findMemberStoreLocked(desc).GetReplica(rangeID)
 		if err != nil {
-			m.t.Fatal(err)
+			return err
 		}
 
 		if err := rep.ChangeReplicas(
@@ -912,14 +1608,14 @@ func (m *multiTestContext) replicateRange(rangeID roachpb.RangeID, dests ...int)
 			},
 			&desc,
 		); err != nil {
-			m.t.Fatal(err)
+			return err
 		}
 
 		expectedReplicaIDs[i] = desc.NextReplicaID
 	}
 
 	// Wait for the replication to complete on all destination nodes.
-	util.SucceedsSoon(m.t, func() error {
+	return util.RetryForDuration(util.SucceedsSoonDuration(), func() error {
 		for i, dest := range dests {
 			repl, err := m.stores[dest].GetReplica(rangeID)
 			if err != nil {
@@ -942,6 +1638,14 @@ func (m *multiTestContext) replicateRange(rangeID roachpb.RangeID, dests ...int)
 
 // unreplicateRange removes a replica of the range from the dest store.
 func (m *multiTestContext) unreplicateRange(rangeID roachpb.RangeID, dest int) {
+	if err := m.unreplicateRangeErr(rangeID, dest); err != nil {
+		m.t.Fatal(err)
+	}
+}
+
+// unreplicateRangeErr is like unreplicateRange, but returns an error instead
+// of failing the test if the replica cannot be removed.
+func (m *multiTestContext) unreplicateRangeErr(rangeID roachpb.RangeID, dest int) error {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
@@ -949,17 +1653,17 @@ func (m *multiTestContext) unreplicateRange(rangeID roachpb.RangeID, dest int) {
 
 	var desc roachpb.RangeDescriptor
 	if err := m.dbs[0].GetProto(context.TODO(), keys.RangeDescriptorKey(startKey), &desc); err != nil {
-		m.t.Fatal(err)
+		return err
 	}
 
 	rep, err := m.findMemberStoreLocked(desc).GetReplica(rangeID)
 	if err != nil {
-		m.t.Fatal(err)
+		return err
 	}
 
 	ctx := rep.AnnotateCtx(context.Background())
 
-	if err := rep.ChangeReplicas(
+	return rep.ChangeReplicas(
 		ctx,
 		roachpb.REMOVE_REPLICA,
 		roachpb.ReplicaDescriptor{
@@ -967,9 +1671,115 @@ func (m *multiTestContext) unreplicateRange(rangeID roachpb.RangeID, dest int) {
 			StoreID: m.idents[dest].StoreID,
 		},
 		&desc,
-	); err != nil {
+	)
+}
+
+// lookupRange returns the descriptor of the range containing the given key.
+// A store with a replica of the range supplies its start key, but the
+// descriptor itself is read consistently, so that it reflects all splits
+// and replication changes which have completed.
+func (m *multiTestContext) lookupRange(key roachpb.Key) roachpb.RangeDescriptor {
+	return m.lookupRangeDepth(1, key)
+}
+
+func (m *multiTestContext) lookupRangeDepth(depth int, key roachpb.Key) roachpb.RangeDescriptor {
+	rKey, err := keys.Addr(key)
+	if err != nil {
 		m.t.Fatal(err)
 	}
+	var desc roachpb.RangeDescriptor
+	storage.SucceedsSoonDepth(depth+1, m.t, func() error {
+		var startKey roachpb.RKey
+		m.mu.RLock()
+		for _, s := range m.stores {
+			if s == nil {
+				// Store is stopped.
+				continue
+			}
+			if rep := s.LookupReplica(rKey, nil); rep != nil {
+				startKey = rep.Desc().StartKey
+				break
+			}
+		}
+		m.mu.RUnlock()
+		if startKey == nil {
+			return errors.Errorf("no store has a replica containing %s", key)
+		}
+		desc = roachpb.RangeDescriptor{}
+		if err := m.dbs[0].GetProto(context.TODO(), keys.RangeDescriptorKey(startKey), &desc); err != nil {
+			return err
+		}
+		// The store may not have applied a split of its replica yet, in which
+		// case the descriptor of the left hand side was read.
+		if !desc.ContainsKey(rKey) {
+			return errors.Errorf("%s does not contain %s", desc, key)
+		}
+		return nil
+	})
+	return desc
+}
+
+// splitRange splits the range containing splitKey at that key and returns
+// the descriptors of the left and right hand sides once all running stores
+// which are members of the range have applied the split.
+func (m *multiTestContext) splitRange(
+	splitKey roachpb.Key,
+) (roachpb.RangeDescriptor, roachpb.RangeDescriptor) {
+	rSplitKey, err := keys.Addr(splitKey)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	origDesc := m.lookupRangeDepth(1, splitKey)
+	if err := m.dbs[0].AdminSplit(context.TODO(), splitKey); err != nil {
+		m.t.Fatal(err)
+	}
+	left := m.lookupRangeDepth(1, origDesc.StartKey.AsRawKey())
+	right := m.lookupRangeDepth(1, splitKey)
+	if !left.EndKey.Equal(rSplitKey) || !right.StartKey.Equal(rSplitKey) {
+		m.t.Fatalf("unexpected split of %s at %s: %s, %s", origDesc, splitKey, left, right)
+	}
+
+	storage.SucceedsSoonDepth(1, m.t, func() error {
+		m.mu.RLock()
+		defer m.mu.RUnlock()
+		for _, s := range m.stores {
+			if s == nil {
+				// Store is stopped.
+				continue
+			}
+			if _, ok := origDesc.GetReplicaDescriptor(s.StoreID()); !ok {
+				continue
+			}
+			for _, desc := range []roachpb.RangeDescriptor{left, right} {
+				rep, err := s.GetReplica(desc.RangeID)
+				if err != nil {
+					return err
+				}
+				if !reflect.DeepEqual(*rep.Desc(), desc) {
+					return errors.Errorf("store %d: expected %s, got %s", s.StoreID(), desc, rep.Desc())
+				}
+			}
+		}
+		return nil
+	})
+	return left, right
+}
+
+// readFromEngines reads the current value at the given key from all
+// configured engines. Both returned slices have the same length as
+// mtc.engines; the value of an engine is nil if the key is missing, the
+// store was removed, or the read failed, in which case the error is set.
+func (m *multiTestContext) readFromEngines(key roachpb.Key) ([]*roachpb.Value, []error) {
+	values := make([]*roachpb.Value, len(m.engines))
+	errs := make([]error, len(m.engines))
+	for i, eng := range m.engines {
+		if eng == nil {
+			// The store was removed.
+			continue
+		}
+		values[i], _, errs[i] = engine.MVCCGet(context.Background(), eng, key, m.clock.Now(), true, nil)
+	}
+	return values, errs
 }
 
 // readIntFromEngines reads the current integer value at the given key
@@ -977,9 +1787,12 @@ func (m *multiTestContext) unreplicateRange(rangeID roachpb.RangeID, dest int) {
 // found. Returns a slice of the same length as mtc.engines.
 func (m *multiTestContext) readIntFromEngines(key roachpb.Key) []int64 {
 	results := make([]int64, len(m.engines))
-	for i, eng := range m.engines {
-		val, _, err := engine.MVCCGet(context.Background(), eng, key, m.clock.Now(), true, nil)
-		if err != nil {
+	values, errs := m.readFromEngines(key)
+	for i, val := range values {
+		if m.engines[i] == nil {
+			continue
+		}
+		if err := errs[i]; err != nil {
 			log.Errorf(context.TODO(), "engine %d: error reading from key %s: %s", i, key, err)
 		} else if val == nil {
 			log.Errorf(context.TODO(), "engine %d: missing key %s", i, key)
@@ -997,7 +1810,7 @@ func (m *multiTestContext) readIntFromEngines(key roachpb.Key) []int64 {
 // at the given key to match the expected slice (across all engines).
 // Fails the test if they do not match.
 func (m *multiTestContext) waitForValues(key roachpb.Key, expected []int64) {
-	util.SucceedsSoonDepth(1, m.t, func() error {
+	storage.SucceedsSoonDepth(1, m.t, func() error {
 		actual := m.readIntFromEngines(key)
 		if !reflect.DeepEqual(expected, actual) {
 			return errors.Errorf("expected %v, got %v", expected, actual)
@@ -1006,6 +1819,153 @@ func (m *multiTestContext) waitForValues(key roachpb.Key, expected []int64) {
 	})
 }
 
+// waitForEngineValues waits for the raw bytes values at the given key to
+// match the expected slice (across all engines). A nil entry expects the
+// key to be missing from that engine. Fails the test if they do not match.
+func (m *multiTestContext) waitForEngineValues(key roachpb.Key, expected [][]byte) {
+	decoded := make([]interface{}, len(expected))
+	for i, e := range expected {
+		if e != nil {
+			decoded[i] = e
+		}
+	}
+	m.waitForDecodedValuesDepth(1, key, decoded, func(val *roachpb.Value) (interface{}, error) {
+		return val.GetBytes()
+	})
+}
+
+// waitForDecodedValues waits for the values at the given key, passed
+// through decode, to match the expected slice (across all engines). decode
+// is not invoked for missing keys, which are matched by nil entries. Fails
+// the test, reporting every mismatched engine, if they do not match.
+func (m *multiTestContext) waitForDecodedValues(
+	key roachpb.Key, expected []interface{}, decode func(*roachpb.Value) (interface{}, error),
+) {
+	m.waitForDecodedValuesDepth(1, key, expected, decode)
+}
+
+func (m *multiTestContext) waitForDecodedValuesDepth(
+	depth int,
+	key roachpb.Key,
+	expected []interface{},
+	decode func(*roachpb.Value) (interface{}, error),
+) {
+	storage.SucceedsSoonDepth(depth+1, m.t, func() error {
+		values, errs := m.readFromEngines(key)
+		if len(values) != len(expected) {
+			return errors.Errorf("expected %d values, got %d engines", len(expected), len(values))
+		}
+		var mismatches []string
+		for i, val := range values {
+			var actual interface{}
+			err := errs[i]
+			if err == nil && val != nil {
+				actual, err = decode(val)
+			}
+			if err != nil {
+				mismatches = append(mismatches, fmt.Sprintf("engine %d: %s", i, err))
+			} else if !reflect.DeepEqual(expected[i], actual) {
+				mismatches = append(mismatches,
+					fmt.Sprintf("engine %d: expected %v, got %v", i, expected[i], actual))
+			}
+		}
+		if len(mismatches) > 0 {
+			return errors.Errorf("key %s: %s", key, strings.Join(mismatches, "; "))
+		}
+		return nil
+	})
+}
+
+// findUnresolvedIntents scans the range-local and global keys of all
+// engines for intents and for the records of pending transactions. It
+// returns a description of each one found, including the index of the
+// engine holding it.
+func (m *multiTestContext) findUnresolvedIntents() ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var found []string
+	spans := []roachpb.Span{
+		{Key: keys.LocalRangePrefix, EndKey: keys.LocalRangeMax},
+		{Key: keys.LocalMax, EndKey: roachpb.KeyMax},
+	}
+	for i, eng := range m.engines {
+		if eng == nil {
+			// The store was removed.
+			continue
+		}
+		for _, span := range spans {
+			if err := eng.Iterate(
+				engine.MakeMVCCMetadataKey(span.Key),
+				engine.MakeMVCCMetadataKey(span.EndKey),
+				func(kv engine.MVCCKeyValue) (bool, error) {
+					if kv.Key.IsValue() {
+						return false, nil
+					}
+					var meta enginepb.MVCCMetadata
+					if err := meta.Unmarshal(kv.Value); err != nil {
+						return false, errors.Wrapf(err, "engine %d: unable to decode %s", i, kv.Key)
+					}
+					if meta.Txn != nil {
+						found = append(found, fmt.Sprintf("engine %d: intent on %s of txn %s",
+							i, kv.Key.Key, meta.Txn.Short()))
+						return false, nil
+					}
+					if !meta.IsInline() || !bytes.HasPrefix(kv.Key.Key, keys.LocalRangePrefix) {
+						return false, nil
+					}
+					startKey, _, detail, err := keys.DecodeRangeKey(kv.Key.Key)
+					if err != nil {
+						return false, err
+					}
+					txnID, err := uuid.FromBytes(detail)
+					if err != nil {
+						return false, nil
+					}
+					if !kv.Key.Key.Equal(keys.TransactionKey(startKey, txnID)) {
+						return false, nil
+					}
+					var txn roachpb.Transaction
+					val := roachpb.Value{RawBytes: meta.RawBytes}
+					if err := val.GetProto(&txn); err != nil {
+						return false, errors.Wrapf(err, "engine %d: unable to decode %s", i, kv.Key)
+					}
+					if txn.Status == roachpb.PENDING {
+						found = append(found, fmt.Sprintf("engine %d: pending txn record %s of %s",
+							i, kv.Key.Key, txn.Short()))
+					}
+					return false, nil
+				},
+			); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return found, nil
+}
+
+// checkNoUnresolvedIntents returns an error listing the unresolved intents
+// and pending transaction records on all engines, if there are any.
+func (m *multiTestContext) checkNoUnresolvedIntents() error {
+	found, err := m.findUnresolvedIntents()
+	if err != nil {
+		return err
+	}
+	if len(found) > 0 {
+		return errors.Errorf("found %d unresolved intents and pending txns:\n%s",
+			len(found), strings.Join(found, "\n"))
+	}
+	return nil
+}
+
+// verifyNoUnresolvedIntents waits for all intents to be resolved and all
+// transactions to be finalized on all engines, failing the test with the
+// keys left behind otherwise. Useful for tests of transaction abort paths.
+// Note that transactions run by the stores themselves (for example splits)
+// are reported as well if they are in flight.
+func (m *multiTestContext) verifyNoUnresolvedIntents() {
+	storage.SucceedsSoonDepth(1, m.t, m.checkNoUnresolvedIntents)
+}
+
 // expireLeases increments the context's manual clock far enough into the
 // future that current range leases are expired. Useful for tests which modify
 // replica sets.
@@ -1020,11 +1980,150 @@ func (m *multiTestContext) expireLeases() {
 	}
 }
 
+// expireLease increments the context's manual clock just far enough that the
+// current lease of the specified range is expired, leaving the leases of
+// other ranges (which typically expire later) intact. The lease is read from
+// all replicas of the range and the latest expiration wins, so a replica
+// lagging behind the lease holder does not cause an early return. If the
+// lease is already expired, the clock is not moved.
+func (m *multiTestContext) expireLease(rangeID roachpb.RangeID) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var expiration hlc.Timestamp
+	for _, store := range m.stores {
+		if store == nil {
+			continue
+		}
+		rep, err := store.GetReplica(rangeID)
+		if err != nil {
+			continue
+		}
+		if lease, _ := rep.GetLease(); lease != nil && expiration.Less(lease.Expiration) {
+			expiration = lease.Expiration
+		}
+	}
+	if expiration == (hlc.Timestamp{}) {
+		m.t.Fatalf("no lease found for range %d", rangeID)
+	}
+	if delta := expiration.WallTime - m.clock.PhysicalNow(); delta >= 0 {
+		m.manualClock.Increment(delta + 1)
+	}
+}
+
+// advanceNodeClock skews the clock of the store at index i by delta, which
+// may be negative. The multiTestContext must have been started with
+// distinctClocks.
+func (m *multiTestContext) advanceNodeClock(i int, delta time.Duration) {
+	if !m.distinctClocks {
+		m.t.Fatal("advanceNodeClock requires distinctClocks")
+	}
+	atomic.AddInt64(m.clockSkews[i], delta.Nanoseconds())
+}
+
+// pauseNodeLiveness suspends the liveness heartbeats of the node of the store
+// at index i, so that the node eventually fails liveness while its store
+// keeps running.
+func (m *multiTestContext) pauseNodeLiveness(i int) {
+	atomic.StoreInt32(m.livenessPaused[i], 1)
+}
+
+// resumeNodeLiveness resumes the liveness heartbeats of the node of the
+// store at index i. The node heartbeats right away, so it is live again when
+// the call returns.
+func (m *multiTestContext) resumeNodeLiveness(i int) {
+	atomic.StoreInt32(m.livenessPaused[i], 0)
+	if err := m.nodeLivenesses[i].ManualHeartbeat(); err != nil {
+		m.t.Fatal(err)
+	}
+}
+
+// incrementEpoch has the node of the store at index from increment the
+// liveness epoch of the node of the store at index i, as it would once the
+// latter failed liveness. The heartbeats of node i are paused and the manual
+// clock is moved past the expiration of its liveness record as necessary;
+// use resumeNodeLiveness to let the node heartbeat again.
+func (m *multiTestContext) incrementEpoch(from, i int) {
+	m.pauseNodeLiveness(i)
+	nl := m.nodeLivenesses[from]
+	clock := m.clocks[from]
+	nodeID := m.idents[i].NodeID
+	storage.SucceedsSoonDepth(1, m.t, func() error {
+		liveness, err := nl.GetLiveness(nodeID)
+		if err != nil {
+			return err
+		}
+		// A node is live until the expiration of its liveness record minus
+		// the maximum clock offset.
+		deadline := liveness.Expiration.WallTime - clock.MaxOffset().Nanoseconds()
+		if delta := deadline - clock.PhysicalNow(); delta >= 0 {
+			m.manualClock.Increment(delta + 1)
+		}
+		// The increment fails if the liveness record known to node from is
+		// outdated, for example because of a heartbeat still in flight when
+		// the heartbeats were paused.
+		return nl.IncrementEpoch(context.Background(), nodeID)
+	})
+}
+
+// setEngineLatencies injects the given latencies into the reads, writes and
+// syncs of the engine of the store at index i, simulating a slow disk. The
+// latencies apply until they are changed again, also across restarts of the
+// store; pass zero latencies to restore full speed. The multiTestContext
+// must have been started with slowEngines.
+func (m *multiTestContext) setEngineLatencies(i int, latencies slowEngineLatencies) {
+	eng, ok := m.engines[i].(slowEngine)
+	if !ok {
+		m.t.Fatalf("engine %d of type %T is not a slow engine; set slowEngines", i, m.engines[i])
+	}
+	eng.setLatencies(latencies)
+}
+
+// addSkewedClock appends a clock for a new store to clocks, which can be
+// skewed with advanceNodeClock.
+func (m *multiTestContext) addSkewedClock() {
+	skew := new(int64)
+	m.clockSkews = append(m.clockSkews, skew)
+	m.clocks = append(m.clocks, hlc.NewClock(func() int64 {
+		return m.clock.PhysicalNow() + atomic.LoadInt64(skew)
+	}, m.clock.MaxOffset()))
+}
+
+// verifyClockOffsets returns an error if the clocks of any two stores are
+// further apart than the maximum clock offset, which is when a real
+// cluster would fail RemoteClockMonitor.VerifyClockOffset.
+func (m *multiTestContext) verifyClockOffsets() error {
+	maxOffset := m.clock.MaxOffset()
+	for i := range m.clocks {
+		for j := range m.clocks {
+			offset := time.Duration(m.clocks[i].PhysicalNow() - m.clocks[j].PhysicalNow())
+			if offset > maxOffset {
+				return errors.Errorf("clock of store %d is %s ahead of store %d, more than the maximum offset of %s",
+					i, offset, j, maxOffset)
+			}
+		}
+	}
+	return nil
+}
+
+// expectMaxOffsetViolation sends the request to the store at index to,
+// timestamped by the clock of the store at index from, and fails the test
+// unless the request is rejected for being too far in the future, as it is
+// when the clock of the sender is more than the maximum offset ahead.
+func (m *multiTestContext) expectMaxOffsetViolation(from, to int, args roachpb.Request) {
+	ts := m.clocks[from].Now()
+	_, pErr := client.SendWrappedWith(
+		context.Background(), rg1(m.Store(to)), roachpb.Header{Timestamp: ts}, args)
+	if !testutils.IsPError(pErr, "rejecting command with timestamp in the future") {
+		m.t.Fatalf("%s: expected request from store %d to store %d to be rejected, got %v",
+			testutils.Caller(1), from, to, pErr)
+	}
+}
+
 // getRaftLeader returns the replica that is the current raft leader for the
 // specified rangeID.
 func (m *multiTestContext) getRaftLeader(rangeID roachpb.RangeID) *storage.Replica {
 	var raftLeaderRepl *storage.Replica
-	util.SucceedsSoonDepth(1, m.t, func() error {
+	storage.SucceedsSoonDepth(1, m.t, func() error {
 		m.mu.RLock()
 		defer m.mu.RUnlock()
 		var latestTerm uint64
@@ -1057,6 +2156,253 @@ func (m *multiTestContext) getRaftLeader(rangeID roachpb.RangeID) *storage.Repli
 	return raftLeaderRepl
 }
 
+// mtcChaosOptions configures the chaos injected by StartChaos.
+type mtcChaosOptions struct {
+	// Seed seeds the schedule of events, which makes the sequence of
+	// stores stopped, restarted, partitioned and healed reproducible.
+	Seed int64
+	// Interval is the time between two events. Defaults to 50ms.
+	Interval time.Duration
+	// Stores are the indexes of the stores chaos is inflicted upon.
+	// Defaults to all stores.
+	Stores []int
+	// MaxDown is the maximum number of stores which are stopped or
+	// partitioned at the same time. Defaults to the largest minority of
+	// all stores, so that a range replicated to all stores keeps its
+	// quorum.
+	MaxDown int
+	// If Partition is set, stores are partitioned from all other stores as
+	// well as stopped.
+	Partition bool
+}
+
+// mtcChaosEvent is an entry of the event log of a chaos runner.
+type mtcChaosEvent struct {
+	Time  time.Time
+	Op    string
+	Store int
+}
+
+func (e mtcChaosEvent) String() string {
+	return fmt.Sprintf("%s %s store %d", e.Time.Format("15:04:05.000000"), e.Op, e.Store)
+}
+
+// mtcChaos randomly stops, restarts, partitions and heals the stores of a
+// multiTestContext; see StartChaos.
+type mtcChaos struct {
+	m    *multiTestContext
+	opts mtcChaosOptions
+	rand *rand.Rand
+	// stopped and isolated are the indexes of the stores currently
+	// stopped and partitioned, in the order they went down. They are
+	// only accessed by the chaos goroutine until it has exited.
+	stopped, isolated []int
+	stop              chan struct{}
+	done              chan struct{}
+	// errCh receives the error which made the chaos goroutine exit early,
+	// if any. The test is failed on the test goroutine; see halt.
+	errCh chan error
+	mu    struct {
+		syncutil.Mutex
+		events []mtcChaosEvent
+	}
+}
+
+// StartChaos starts a goroutine which stops, restarts, partitions and
+// heals stores on a schedule derived from opts.Seed until the returned
+// runner is stopped. Stopping the runner restarts and heals all stores it
+// took down. While chaos is running it owns the partition of the
+// multiTestContext, and tests must not stop or restart the stores it
+// operates on themselves.
+func (m *multiTestContext) StartChaos(opts mtcChaosOptions) *mtcChaos {
+	if m.chaos != nil {
+		m.t.Fatal("chaos is already running")
+	}
+	if opts.Seed == 0 && m.deterministic {
+		opts.Seed = m.seed
+	}
+	if opts.Interval == 0 {
+		opts.Interval = 50 * time.Millisecond
+	}
+	if opts.Stores == nil {
+		for i := range m.stores {
+			opts.Stores = append(opts.Stores, i)
+		}
+	}
+	if opts.MaxDown == 0 {
+		opts.MaxDown = (len(m.stores) - 1) / 2
+	}
+	c := &mtcChaos{
+		m:     m,
+		opts:  opts,
+		rand:  rand.New(rand.NewSource(opts.Seed)),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+		errCh: make(chan error, 1),
+	}
+	m.chaos = c
+	go c.run()
+	return c
+}
+
+func (c *mtcChaos) run() {
+	defer close(c.done)
+	ticker := time.NewTicker(c.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.step(); err != nil {
+				c.errCh <- err
+				return
+			}
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// step takes down a random store which is up or brings back a random store
+// which is down.
+func (c *mtcChaos) step() error {
+	var up []int
+	for _, i := range c.opts.Stores {
+		if !c.isDown(i) && !c.m.isRemoved(i) {
+			up = append(up, i)
+		}
+	}
+	down := len(c.stopped) + len(c.isolated)
+	if len(up) > 0 && down < c.opts.MaxDown && (down == 0 || c.rand.Intn(2) == 0) {
+		i := up[c.rand.Intn(len(up))]
+		if c.opts.Partition && c.rand.Intn(2) == 0 {
+			c.isolated = append(c.isolated, i)
+			c.partition()
+			c.record("partition", i)
+		} else {
+			c.m.stopStore(i)
+			c.stopped = append(c.stopped, i)
+			c.record("stop", i)
+		}
+		return nil
+	}
+	if down == 0 {
+		return nil
+	}
+	if n := c.rand.Intn(down); n < len(c.stopped) {
+		i := c.stopped[n]
+		if err := c.m.restartStoreWithConfigErr(i, nil); err != nil {
+			return errors.Wrapf(err, "restarting store %d", i)
+		}
+		c.stopped = append(c.stopped[:n], c.stopped[n+1:]...)
+		c.record("restart", i)
+	} else {
+		n -= len(c.stopped)
+		i := c.isolated[n]
+		c.isolated = append(c.isolated[:n], c.isolated[n+1:]...)
+		c.partition()
+		c.record("heal", i)
+	}
+	return nil
+}
+
+// isDown returns true if the store at index i is stopped or partitioned.
+func (c *mtcChaos) isDown(i int) bool {
+	for _, j := range append(c.stopped, c.isolated...) {
+		if i == j {
+			return true
+		}
+	}
+	return false
+}
+
+// partition partitions each of the isolated stores from all other stores.
+func (c *mtcChaos) partition() {
+	if len(c.isolated) == 0 {
+		c.m.heal()
+		return
+	}
+	var rest []int
+	sets := [][]int{nil}
+	for i := range c.m.stores {
+		isolated := false
+		for _, j := range c.isolated {
+			isolated = isolated || i == j
+		}
+		if isolated {
+			sets = append(sets, []int{i})
+		} else {
+			rest = append(rest, i)
+		}
+	}
+	sets[0] = rest
+	c.m.partition(sets...)
+}
+
+func (c *mtcChaos) record(op string, i int) {
+	e := mtcChaosEvent{Time: timeutil.Now(), Op: op, Store: i}
+	log.Infof(context.TODO(), "chaos: %s", e)
+	c.mu.Lock()
+	c.mu.events = append(c.mu.events, e)
+	c.mu.Unlock()
+}
+
+// Events returns the log of the events of the chaos runner so far.
+func (c *mtcChaos) Events() []mtcChaosEvent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]mtcChaosEvent(nil), c.mu.events...)
+}
+
+// exited returns true if the chaos goroutine exited early because of an
+// error, which is returned by Stop.
+func (c *mtcChaos) exited() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// halt stops the chaos goroutine and returns the error which made it exit
+// early, if any. If the test has failed or is about to, the events of the
+// runner are logged for the postmortem. halt must be called on the test
+// goroutine.
+func (c *mtcChaos) halt() error {
+	close(c.stop)
+	<-c.done
+	c.m.chaos = nil
+	var err error
+	select {
+	case err = <-c.errCh:
+		err = errors.Wrapf(err, "chaos (seed %d)", c.opts.Seed)
+	default:
+	}
+	if err != nil || c.m.t.Failed() {
+		c.m.t.Logf("chaos (seed %d) events:", c.opts.Seed)
+		for _, e := range c.Events() {
+			c.m.t.Log(e)
+		}
+	}
+	return err
+}
+
+// Stop stops the chaos runner, and restarts and heals all stores it took
+// down. The test fails if the chaos goroutine exited early. A runner which
+// is still running when the multiTestContext is stopped is halted without
+// bringing back its stores.
+func (c *mtcChaos) Stop() {
+	if err := c.halt(); err != nil {
+		c.m.t.Fatal(err)
+	}
+	for _, i := range c.stopped {
+		c.m.restartStore(i)
+	}
+	c.stopped = nil
+	c.isolated = nil
+	c.m.heal()
+}
+
 // getArgs returns a GetRequest and GetResponse pair addressed to
 // the default replica for the specified key.
 func getArgs(key roachpb.Key) roachpb.GetRequest {
@@ -1179,3 +2525,106 @@ func verifyRecomputedStats(
 	}
 	return nil
 }
+
+// TestLinkFaults verifies the faults injected into the KV requests sent by
+// the multiTestContext.
+func TestLinkFaults(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	mtc := startMultiTestContext(t, 1)
+	defer mtc.Stop()
+
+	key := roachpb.Key("a")
+	// send increments key by inc over the link from the first store to
+	// itself, returning the channel the reply is sent on.
+	send := func(inc int64) chan kv.BatchCall {
+		var ba roachpb.BatchRequest
+		incArgs := incrementArgs(key, inc)
+		ba.Add(&incArgs)
+		transport, err := mtc.kvTransportFactory(1)(
+			kv.SendOptions{}, nil, kv.ReplicaSlice{{
+				ReplicaDescriptor: roachpb.ReplicaDescriptor{NodeID: 1, StoreID: 1},
+				NodeDesc:          mtc.nodeDesc(1),
+			}}, ba)
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan kv.BatchCall, 1)
+		transport.SendNext(done)
+		return done
+	}
+	// newValue returns the value of key after a successful increment.
+	newValue := func(call kv.BatchCall) int64 {
+		if call.Err != nil {
+			t.Fatal(call.Err)
+		}
+		if call.Reply.Error != nil {
+			t.Fatal(call.Reply.Error)
+		}
+		return call.Reply.Responses[0].GetInner().(*roachpb.IncrementResponse).NewValue
+	}
+
+	// Dropped requests are not evaluated.
+	mtc.setLinkFaults(0, 0, mtcLinkFaults{DropRequest: 1})
+	if call := <-send(1); !testutils.IsError(call.Err, "request from node 1 to node 1 dropped") {
+		t.Fatalf("expected dropped request, got %+v", call)
+	}
+	mtc.waitForValues(key, []int64{0})
+
+	// The requests of dropped responses are evaluated.
+	mtc.setLinkFaults(0, 0, mtcLinkFaults{DropResponse: 1})
+	if call := <-send(1); !testutils.IsError(call.Err, "response from node 1 to node 1 dropped") {
+		t.Fatalf("expected dropped response, got %+v", call)
+	}
+	mtc.waitForValues(key, []int64{1})
+
+	// Delayed requests take at least the delay.
+	const delay = 10 * time.Millisecond
+	mtc.setLinkFaults(0, 0, mtcLinkFaults{Delay: delay})
+	start := timeutil.Now()
+	if v := newValue(<-send(1)); v != 2 {
+		t.Fatalf("expected 2, got %d", v)
+	}
+	if elapsed := timeutil.Since(start); elapsed < delay {
+		t.Errorf("expected request to be delayed by %s, took %s", delay, elapsed)
+	}
+
+	// A request held back for reordering is overtaken by the next one.
+	mtc.setLinkFaults(0, 0, mtcLinkFaults{Reorder: 1})
+	first := send(10)
+	second := send(100)
+	if v := newValue(<-second); v != 102 {
+		t.Errorf("expected second request to be evaluated first, got %d", v)
+	}
+	if v := newValue(<-first); v != 112 {
+		t.Errorf("expected first request to be evaluated last, got %d", v)
+	}
+
+	mtc.clearLinkFaults()
+	if v := newValue(<-send(1)); v != 113 {
+		t.Fatalf("expected 113, got %d", v)
+	}
+}
+
+// TestMultiTestContextSeed verifies that a seeded multiTestContext derives
+// the seeds of its stores from its own seed.
+func TestMultiTestContextSeed(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	mtc := &multiTestContext{seed: 42}
+	mtc.Start(t, 2)
+	defer mtc.Stop()
+
+	if !mtc.deterministic {
+		t.Fatal("expected a seeded multiTestContext to be deterministic")
+	}
+	seeds := map[int64]struct{}{}
+	for i := range mtc.stores {
+		seed := mtc.makeStoreConfig(i).TestingKnobs.RandSeed
+		if seed == 0 || seed != mtc.makeStoreConfig(i).TestingKnobs.RandSeed {
+			t.Errorf("store %d: expected a stable non-zero seed, got %d", i, seed)
+		}
+		seeds[seed] = struct{}{}
+	}
+	if len(seeds) != len(mtc.stores) {
+		t.Errorf("expected distinct seeds per store, got %v", seeds)
+	}
+}
@@ -16,12 +16,21 @@
 
 package engine
 
-import "github.com/cockroachdb/cockroach/pkg/util/hlc"
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+)
 
 const (
-	batchTypeDeletion byte = 0x0
-	batchTypeValue         = 0x1
-	batchTypeMerge         = 0x2
+	batchTypeDeletion       byte = 0x0
+	batchTypeValue               = 0x1
+	batchTypeMerge               = 0x2
+	batchTypeLogData             = 0x3
+	batchTypeSingleDeletion      = 0x7
+	batchTypeRangeDeletion       = 0xF
 
 	// The batch header is composed of an 8-byte sequence number (all zeroes) and
 	// 4-byte count of the number of entries in the batch.
@@ -42,6 +51,7 @@ const (
 //      kTypeDeletion varstring
 //      kTypeSingleDeletion varstring
 //      kTypeMerge varstring varstring
+//      kTypeRangeDeletion varstring varstring
 //      kTypeColumnFamilyValue varint32 varstring varstring
 //      kTypeColumnFamilyDeletion varint32 varstring varstring
 //      kTypeColumnFamilySingleDeletion varint32 varstring varstring
@@ -51,8 +61,9 @@ const (
 //      data: uint8[len]
 //
 // The rocksDBBatchBuilder code currently only supports kTypeValue
-// (batchTypeValue), kTypeDeletion (batchTypeDeletion)and kTypeMerge
-// (batchTypeMerge) operations. Before a batch is written to the RocksDB
+// (batchTypeValue), kTypeDeletion (batchTypeDeletion), kTypeMerge
+// (batchTypeMerge) and kTypeRangeDeletion (batchTypeRangeDeletion)
+// operations. Before a batch is written to the RocksDB
 // write-ahead-log, the sequence number is 0. The "fixed32" format is little
 // endian.
 //
@@ -175,6 +186,33 @@ func (b *rocksDBBatchBuilder) encodeKey(key MVCCKey, extra int) {
 	b.repr[len(b.repr)-1-extra] = byte(timestampLength)
 }
 
+// decodeMVCCKey decodes an MVCC key encoded by encodeKey. The returned key
+// points into encoded.
+func decodeMVCCKey(encoded []byte) (MVCCKey, error) {
+	if len(encoded) == 0 {
+		return MVCCKey{}, errors.New("empty encoded key")
+	}
+	tsLen := int(encoded[len(encoded)-1])
+	keyPart := encoded[:len(encoded)-1]
+	if tsLen > len(keyPart) {
+		return MVCCKey{}, errors.Errorf("invalid encoded key: timestamp length %d exceeds key length %d",
+			tsLen, len(keyPart))
+	}
+	key := MVCCKey{Key: keyPart[:len(keyPart)-tsLen]}
+	ts := keyPart[len(keyPart)-tsLen:]
+	switch tsLen {
+	case 0:
+	case 13:
+		key.Timestamp.Logical = int32(binary.BigEndian.Uint32(ts[9:13]))
+		fallthrough
+	case 9:
+		key.Timestamp.WallTime = int64(binary.BigEndian.Uint64(ts[1:9]))
+	default:
+		return MVCCKey{}, errors.Errorf("invalid encoded key: timestamp length %d", tsLen)
+	}
+	return key, nil
+}
+
 func (b *rocksDBBatchBuilder) encodeKeyValue(key MVCCKey, value []byte, tag byte) {
 	b.maybeInit()
 	b.count++
@@ -207,3 +245,129 @@ func (b *rocksDBBatchBuilder) Clear(key MVCCKey) {
 	b.encodeKey(key, 0)
 	b.repr[pos] = batchTypeDeletion
 }
+
+// ClearRange adds a range deletion tombstone covering [start, end) to the
+// batch. The start key occupies the key position of the record and the end
+// key the value position.
+func (b *rocksDBBatchBuilder) ClearRange(start, end MVCCKey) {
+	b.maybeInit()
+	b.count++
+	pos := len(b.repr)
+	b.encodeKey(start, 0)
+	b.repr[pos] = batchTypeRangeDeletion
+	// encodeKey reserves a leading byte for the record tag which the end key
+	// doesn't need. Encode the end key and then shift it into place.
+	pos = len(b.repr)
+	b.encodeKey(end, 0)
+	copy(b.repr[pos:], b.repr[pos+1:])
+	b.repr = b.repr[:len(b.repr)-1]
+}
+
+// A rocksDBBatchReader iterates over the records in a RocksDB batch
+// representation as constructed by rocksDBBatchBuilder (or by RocksDB
+// itself). Only records for the default column family are supported. Usage:
+//
+//   r, err := newRocksDBBatchReader(repr)
+//   if err != nil { ... }
+//   for r.Next() {
+//     // Use r.typ, r.key and r.value.
+//   }
+//   if err := r.Error(); err != nil { ... }
+type rocksDBBatchReader struct {
+	repr []byte
+	// count is the number of records remaining in the batch, not including
+	// the current one.
+	count uint32
+	err   error
+
+	// The type, key and value of the current record. The key and value point
+	// into repr. The value is only set for batchTypeValue, batchTypeMerge and
+	// batchTypeRangeDeletion records.
+	typ   byte
+	key   []byte
+	value []byte
+}
+
+// newRocksDBBatchReader returns a reader over the records in repr. An error
+// is returned if the batch header is malformed.
+func newRocksDBBatchReader(repr []byte) (*rocksDBBatchReader, error) {
+	if len(repr) < headerSize {
+		return nil, errors.Errorf("batch repr too small: %d < %d", len(repr), headerSize)
+	}
+	return &rocksDBBatchReader{
+		repr:  repr[headerSize:],
+		count: binary.LittleEndian.Uint32(repr[8:headerSize]),
+	}, nil
+}
+
+// Next advances to the next record in the batch, returning false when there
+// are no more records or an error was encountered.
+func (r *rocksDBBatchReader) Next() bool {
+	if r.err != nil {
+		return false
+	}
+	if r.count == 0 {
+		if len(r.repr) != 0 {
+			r.err = errors.Errorf("batch repr has %d trailing bytes", len(r.repr))
+		}
+		return false
+	}
+	r.count--
+	if len(r.repr) == 0 {
+		r.err = errors.New("batch repr truncated: missing record type")
+		return false
+	}
+	r.typ = r.repr[0]
+	r.repr = r.repr[1:]
+	r.key, r.value = nil, nil
+
+	switch r.typ {
+	case batchTypeDeletion, batchTypeSingleDeletion, batchTypeLogData:
+		r.key = r.varstring()
+	case batchTypeValue, batchTypeMerge, batchTypeRangeDeletion:
+		r.key = r.varstring()
+		r.value = r.varstring()
+	default:
+		r.err = errors.Errorf("unexpected batch record type: %d", r.typ)
+	}
+	if r.err != nil {
+		return false
+	}
+	if r.typ == batchTypeLogData {
+		// Log data records are not included in the batch count.
+		r.count++
+	}
+	return true
+}
+
+// Error returns the error, if any, encountered while reading the batch.
+func (r *rocksDBBatchReader) Error() error {
+	return r.err
+}
+
+func (r *rocksDBBatchReader) varstring() []byte {
+	if r.err != nil {
+		return nil
+	}
+	n, w := binary.Uvarint(r.repr)
+	if w <= 0 || n > uint64(len(r.repr)-w) {
+		r.err = errors.New("batch repr truncated: invalid varstring")
+		return nil
+	}
+	s := r.repr[w : w+int(n)]
+	r.repr = r.repr[w+int(n):]
+	return s
+}
+
+// verifyBatchRepr checks that repr is a well-formed batch representation,
+// returning an error describing the first problem found if it isn't. This is
+// used to guard against applying corrupted batches received from other nodes.
+func verifyBatchRepr(repr []byte) error {
+	r, err := newRocksDBBatchReader(repr)
+	if err != nil {
+		return err
+	}
+	for r.Next() {
+	}
+	return r.Error()
+}
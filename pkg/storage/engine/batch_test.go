@@ -27,6 +27,7 @@ import (
 
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/storage/engine/enginepb"
+	"github.com/cockroachdb/cockroach/pkg/testutils"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/cockroachdb/cockroach/pkg/util/protoutil"
@@ -688,6 +689,13 @@ func TestBatchBuilder(t *testing.T) {
 		builder.Merge(key, appender("bar"))
 	}
 
+	start := MVCCKey{roachpb.Key("d"), hlc.Timestamp{}}
+	end := MVCCKey{roachpb.Key("e"), hlc.Timestamp{WallTime: 1, Logical: 1}}
+	if err := dbClearRange(batch.batch, start, end); err != nil {
+		t.Fatal(err)
+	}
+	builder.ClearRange(start, end)
+
 	batchRepr := batch.Repr()
 	builderRepr := builder.Finish()
 	if !bytes.Equal(batchRepr, builderRepr) {
@@ -695,6 +703,166 @@ func TestBatchBuilder(t *testing.T) {
 	}
 }
 
+func TestBatchClearRange(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+	e := NewInMem(roachpb.Attributes{}, 1<<20)
+	stopper.AddCloser(e)
+
+	for _, k := range []string{"a", "b", "c", "d", "e"} {
+		if err := e.Put(mvccKey(k), []byte(k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	scanKeys := func(r Reader) []string {
+		kvs, err := Scan(r, mvccKey("a"), mvccKey("z"), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var keys []string
+		for _, kv := range kvs {
+			keys = append(keys, string(kv.Key.Key))
+		}
+		return keys
+	}
+
+	// Clear a range directly on the engine. A snapshot taken beforehand must
+	// still see the cleared keys.
+	snap := e.NewSnapshot()
+	defer snap.Close()
+	if err := e.ClearRange(mvccKey("a"), mvccKey("b")); err != nil {
+		t.Fatal(err)
+	}
+	if expected, keys := []string{"b", "c", "d", "e"}, scanKeys(e); !reflect.DeepEqual(expected, keys) {
+		t.Fatalf("expected %v, but found %v", expected, keys)
+	}
+	if expected, keys := []string{"a", "b", "c", "d", "e"}, scanKeys(snap); !reflect.DeepEqual(expected, keys) {
+		t.Fatalf("expected %v, but found %v", expected, keys)
+	}
+
+	// Clear a range within a batch. The batch can't be read from after the
+	// tombstone has been added, and the clear is applied on commit.
+	b := e.NewBatch()
+	defer b.Close()
+	if err := b.Put(mvccKey("f"), []byte("f")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.ClearRange(mvccKey("c"), mvccKey("e")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Get(mvccKey("b")); !testutils.IsError(err, "delete range") {
+		t.Fatalf("expected error reading from batch containing range deletion, got %v", err)
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if expected, keys := []string{"b", "e", "f"}, scanKeys(e); !reflect.DeepEqual(expected, keys) {
+		t.Fatalf("expected %v, but found %v", expected, keys)
+	}
+}
+
+func TestBatchReader(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	var builder rocksDBBatchBuilder
+	builder.Put(mvccKey("a"), []byte("value"))
+	builder.Clear(mvccKey("b"))
+	builder.Merge(mvccKey("c"), appender("bar"))
+	builder.ClearRange(mvccKey("d"), mvccKey("e"))
+	repr := builder.Finish()
+
+	r, err := newRocksDBBatchReader(repr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ops []string
+	for r.Next() {
+		switch r.typ {
+		case batchTypeValue:
+			ops = append(ops, fmt.Sprintf("put(%s,%s)", r.key, r.value))
+		case batchTypeDeletion:
+			ops = append(ops, fmt.Sprintf("delete(%s)", r.key))
+		case batchTypeMerge:
+			ops = append(ops, fmt.Sprintf("merge(%s)", r.key))
+		case batchTypeRangeDeletion:
+			ops = append(ops, fmt.Sprintf("delete_range(%s,%s)", r.key, r.value))
+		default:
+			t.Fatalf("unexpected type %d", r.typ)
+		}
+	}
+	if err := r.Error(); err != nil {
+		t.Fatal(err)
+	}
+	// The keys in the batch have the internal MVCC encoding applied which for
+	// this test implies an appended 0 byte.
+	expOps := []string{
+		"put(a\x00,value)", "delete(b\x00)", "merge(c\x00)", "delete_range(d\x00,e\x00)",
+	}
+	if !reflect.DeepEqual(expOps, ops) {
+		t.Fatalf("expected %q, but found %q", expOps, ops)
+	}
+}
+
+func TestApplyBatchReprVerification(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+	e := NewInMem(roachpb.Attributes{}, 1<<20)
+	stopper.AddCloser(e)
+
+	var builder rocksDBBatchBuilder
+	builder.Put(mvccKey("a"), []byte("value"))
+	builder.Put(mvccKey("b"), []byte("value"))
+	valid := append([]byte(nil), builder.Finish()...)
+
+	badCount := append([]byte(nil), valid...)
+	badCount[8] = 3
+	badType := append([]byte(nil), valid...)
+	badType[headerSize] = 0x5 // kTypeColumnFamilyValue
+
+	testCases := []struct {
+		repr   []byte
+		expErr string
+	}{
+		{valid[:headerSize-1], "too small"},
+		{valid[:len(valid)-1], "truncated"},
+		{append(valid[:len(valid):len(valid)], 0), "trailing bytes"},
+		{badCount, "truncated"},
+		{badType, "unexpected batch record type"},
+	}
+	for i, c := range testCases {
+		if err := e.ApplyBatchRepr(c.repr); !testutils.IsError(err, c.expErr) {
+			t.Errorf("%d: engine: expected %q, got %v", i, c.expErr, err)
+		}
+		func() {
+			b := e.NewBatch()
+			defer b.Close()
+			if err := b.ApplyBatchRepr(c.repr); !testutils.IsError(err, c.expErr) {
+				t.Errorf("%d: batch: expected %q, got %v", i, c.expErr, err)
+			}
+		}()
+	}
+
+	// Nothing should have been applied.
+	if kvs, err := Scan(e, mvccKey("a"), mvccKey("z"), 0); err != nil {
+		t.Fatal(err)
+	} else if len(kvs) != 0 {
+		t.Fatalf("expected no keys, found %v", kvs)
+	}
+
+	if err := e.ApplyBatchRepr(valid); err != nil {
+		t.Fatal(err)
+	}
+	if kvs, err := Scan(e, mvccKey("a"), mvccKey("z"), 0); err != nil {
+		t.Fatal(err)
+	} else if len(kvs) != 2 {
+		t.Fatalf("expected 2 keys, found %v", kvs)
+	}
+}
+
 func TestBatchBuilderStress(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 
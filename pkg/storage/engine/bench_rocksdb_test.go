@@ -116,6 +116,22 @@ func BenchmarkMVCCGet100Versions8Bytes_RocksDB(b *testing.B) {
 	runMVCCGet(setupMVCCRocksDB, 100, 8, b)
 }
 
+func BenchmarkMVCCPointScan1Version8Bytes_RocksDB(b *testing.B) {
+	runMVCCPointScan(setupMVCCRocksDB, 1, 8, b)
+}
+
+func BenchmarkMVCCPointScan10Versions8Bytes_RocksDB(b *testing.B) {
+	runMVCCPointScan(setupMVCCRocksDB, 10, 8, b)
+}
+
+func BenchmarkIterSeekPrefix10Versions8Bytes_RocksDB(b *testing.B) {
+	runIterSeek(setupMVCCRocksDB, true /* prefix */, 10, 8, b)
+}
+
+func BenchmarkIterSeekNormal10Versions8Bytes_RocksDB(b *testing.B) {
+	runIterSeek(setupMVCCRocksDB, false /* prefix */, 10, 8, b)
+}
+
 func BenchmarkMVCCComputeStats1Version8Bytes_RocksDB(b *testing.B) {
 	runMVCCComputeStats(setupMVCCRocksDB, 8, b)
 }
@@ -243,6 +259,18 @@ func BenchmarkMVCCBatch100000Put10_RocksDB(b *testing.B) {
 	runMVCCBatchPut(setupMVCCInMemRocksDB, 10, 100000, b)
 }
 
+func BenchmarkMVCCBatchApply1Put10_RocksDB(b *testing.B) {
+	runMVCCBatchApply(setupMVCCInMemRocksDB, 10, 1, b)
+}
+
+func BenchmarkMVCCBatchApply100Put10_RocksDB(b *testing.B) {
+	runMVCCBatchApply(setupMVCCInMemRocksDB, 10, 100, b)
+}
+
+func BenchmarkMVCCBatchApply10000Put10_RocksDB(b *testing.B) {
+	runMVCCBatchApply(setupMVCCInMemRocksDB, 10, 10000, b)
+}
+
 func BenchmarkMVCCBatchTimeSeries282_RocksDB(b *testing.B) {
 	runMVCCBatchTimeSeries(setupMVCCInMemRocksDB, 282, b)
 }
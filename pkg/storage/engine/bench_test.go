@@ -224,6 +224,65 @@ func runMVCCGet(emk engineMaker, numVersions, valueSize int, b *testing.B) {
 	b.StopTimer()
 }
 
+// runMVCCPointScan is identical to runMVCCGet except that it retrieves each
+// key using an MVCCScan over the span [key,key.Next()), which is able to use a
+// prefix iterator.
+func runMVCCPointScan(emk engineMaker, numVersions, valueSize int, b *testing.B) {
+	const overhead = 48          // Per key/value overhead (empirically determined)
+	const targetSize = 512 << 20 // 512 MB
+	numKeys := targetSize / ((overhead + valueSize) * (1 + (numVersions-1)/2))
+
+	eng, _ := setupMVCCData(emk, numVersions, numKeys, valueSize, b)
+	defer eng.Close()
+
+	b.SetBytes(int64(valueSize))
+	b.ResetTimer()
+
+	keyBuf := append(make([]byte, 0, 64), []byte("key-")...)
+	for i := 0; i < b.N; i++ {
+		keyIdx := rand.Int31n(int32(numKeys))
+		key := roachpb.Key(encoding.EncodeUvarintAscending(keyBuf[:4], uint64(keyIdx)))
+		walltime := int64(5 * (rand.Int31n(int32(numVersions)) + 1))
+		ts := makeTS(walltime, 0)
+		kvs, _, _, err := MVCCScan(context.Background(), eng, key, key.Next(), 1, ts, true, nil)
+		if err != nil {
+			b.Fatalf("failed scan: %s", err)
+		}
+		if len(kvs) != 1 {
+			b.Fatalf("failed scan (key not found): %d@%d", keyIdx, walltime)
+		}
+	}
+
+	b.StopTimer()
+}
+
+// runIterSeek performs b.N seeks to random keys using either a prefix or a
+// normal (total order) iterator in order to compare their performance.
+func runIterSeek(emk engineMaker, prefix bool, numVersions, valueSize int, b *testing.B) {
+	const numKeys = 100000
+
+	eng, _ := setupMVCCData(emk, numVersions, numKeys, valueSize, b)
+	defer eng.Close()
+
+	iter := eng.NewIterator(prefix)
+	defer iter.Close()
+
+	b.SetBytes(int64(valueSize))
+	b.ResetTimer()
+
+	keyBuf := append(make([]byte, 0, 64), []byte("key-")...)
+	for i := 0; i < b.N; i++ {
+		keyIdx := rand.Int31n(int32(numKeys))
+		key := roachpb.Key(encoding.EncodeUvarintAscending(keyBuf[:4], uint64(keyIdx)))
+		iter.Seek(MakeMVCCMetadataKey(key))
+		if !iter.Valid() {
+			b.Fatalf("failed seek (key not found): %d", keyIdx)
+		}
+	}
+
+	b.StopTimer()
+}
+
 func runMVCCPut(emk engineMaker, valueSize int, b *testing.B) {
 	rng, _ := randutil.NewPseudoRand()
 	value := roachpb.MakeValueFromBytes(randutil.RandBytes(rng, valueSize))
@@ -361,6 +420,57 @@ func runMVCCBatchPut(emk engineMaker, valueSize, batchSize int, b *testing.B) {
 	b.StopTimer()
 }
 
+// runMVCCBatchApply is the counterpart to runMVCCBatchPut which, instead of
+// evaluating the MVCCPuts, applies the batch representation produced by
+// evaluating them elsewhere. This mirrors followers applying the WriteBatch
+// produced by the proposer instead of re-evaluating the command.
+func runMVCCBatchApply(emk engineMaker, valueSize, batchSize int, b *testing.B) {
+	rng, _ := randutil.NewPseudoRand()
+	value := roachpb.MakeValueFromBytes(randutil.RandBytes(rng, valueSize))
+	keyBuf := append(make([]byte, 0, 64), []byte("key-")...)
+
+	eng := emk(b, fmt.Sprintf("batch_apply_%d_%d", valueSize, batchSize))
+	defer eng.Close()
+
+	// Evaluate the puts on a separate engine, which is equivalent to them being
+	// evaluated on the proposer, and capture the resulting batch reprs.
+	proposer := emk(b, fmt.Sprintf("batch_apply_proposer_%d_%d", valueSize, batchSize))
+	defer proposer.Close()
+	var reprs [][]byte
+	for i := 0; i < b.N; i += batchSize {
+		end := i + batchSize
+		if end > b.N {
+			end = b.N
+		}
+		batch := proposer.NewBatch()
+		for j := i; j < end; j++ {
+			key := roachpb.Key(encoding.EncodeUvarintAscending(keyBuf[:4], uint64(j)))
+			ts := makeTS(timeutil.Now().UnixNano(), 0)
+			if err := MVCCPut(context.Background(), batch, nil, key, ts, value, nil); err != nil {
+				b.Fatalf("failed put: %s", err)
+			}
+		}
+		reprs = append(reprs, append([]byte(nil), batch.Repr()...))
+		batch.Close()
+	}
+
+	b.SetBytes(int64(valueSize))
+	b.ResetTimer()
+
+	for _, repr := range reprs {
+		batch := eng.NewBatch()
+		if err := batch.ApplyBatchRepr(repr); err != nil {
+			b.Fatal(err)
+		}
+		if err := batch.Commit(); err != nil {
+			b.Fatal(err)
+		}
+		batch.Close()
+	}
+
+	b.StopTimer()
+}
+
 // Benchmark batch time series merge operations. This benchmark does not
 // perform any reads and is only used to measure the cost of the periodic time
 // series updates.
@@ -0,0 +1,194 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/dustin/go-humanize"
+	"github.com/pkg/errors"
+)
+
+// The layout of the plaintext header written at the start of every
+// encrypted file. This must be kept in sync with rocksdb/encryption.h.
+const (
+	encryptionHeaderSize  = 64
+	encryptionKeyIDOffset = 9
+	encryptionMaxKeyIDLen = 39
+)
+
+var encryptionMagic = []byte("crdbenc1")
+
+// loadEncryptionKey reads the AES key stored in the specified file,
+// registers it with the encrypted env and returns its ID. The key file must
+// contain exactly 16, 24 or 32 bytes, selecting AES-128, AES-192 or AES-256
+// respectively.
+func loadEncryptionKey(path string) (string, error) {
+	key, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", errors.Wrap(err, "could not read encryption key")
+	}
+	if _, err := aes.NewCipher(key); err != nil {
+		return "", errors.Wrapf(err, "invalid encryption key %s", path)
+	}
+	sum := sha256.Sum256(key)
+	id := hex.EncodeToString(sum[:8])
+	if err := registerEncryptionKey(id, key); err != nil {
+		return "", errors.Wrapf(err, "invalid encryption key %s", path)
+	}
+	return id, nil
+}
+
+// readEncryptionKeyID returns the ID of the key the specified file was
+// encrypted with, or an empty string if the file is not encrypted.
+func readEncryptionKeyID(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var header [encryptionHeaderSize]byte
+	if _, err := io.ReadFull(f, header[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return "", nil
+		}
+		return "", err
+	}
+	if !bytes.Equal(header[:len(encryptionMagic)], encryptionMagic) {
+		return "", nil
+	}
+	n := int(header[len(encryptionMagic)])
+	if n == 0 || n > encryptionMaxKeyIDLen {
+		return "", errors.Errorf("%s: invalid encryption header", path)
+	}
+	return string(header[encryptionKeyIDOffset : encryptionKeyIDOffset+n]), nil
+}
+
+// isEncryptedStore returns whether the store in the specified directory was
+// created with encryption enabled. A store which does not exist yet is not
+// encrypted.
+func isEncryptedStore(dir string) (bool, error) {
+	keyID, err := readEncryptionKeyID(filepath.Join(dir, "CURRENT"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return keyID != "", nil
+}
+
+// EncryptionStatus describes which keys the sstables in a store are
+// encrypted with. Sstables which are not encrypted are accounted for under
+// the empty key ID. Other files (the WAL, MANIFEST, OPTIONS, etc) are not
+// included: they are rewritten with the active key as RocksDB rolls over to
+// new files, and some of them (e.g. IDENTITY) are never rewritten at all.
+type EncryptionStatus struct {
+	// ActiveKeyID is the ID of the key used to encrypt new files. It is empty
+	// when the status was computed without opening the store.
+	ActiveKeyID string
+	Files       map[string]int
+	Bytes       map[string]int64
+}
+
+// Progress returns the fraction of the store's bytes which are encrypted
+// with the active key.
+func (s EncryptionStatus) Progress() float64 {
+	var total int64
+	for _, b := range s.Bytes {
+		total += b
+	}
+	if total == 0 {
+		return 1
+	}
+	return float64(s.Bytes[s.ActiveKeyID]) / float64(total)
+}
+
+func (s EncryptionStatus) String() string {
+	keyIDs := make([]string, 0, len(s.Files))
+	for keyID := range s.Files {
+		keyIDs = append(keyIDs, keyID)
+	}
+	sort.Strings(keyIDs)
+
+	var buf bytes.Buffer
+	if s.ActiveKeyID != "" {
+		fmt.Fprintf(&buf, "active key %s, %.1f%% complete", s.ActiveKeyID, 100*s.Progress())
+	}
+	for _, keyID := range keyIDs {
+		if buf.Len() > 0 {
+			buf.WriteString("; ")
+		}
+		name := keyID
+		if name == "" {
+			name = "unencrypted"
+		}
+		fmt.Fprintf(&buf, "%s: %d files, %s", name, s.Files[keyID],
+			humanize.IBytes(uint64(s.Bytes[keyID])))
+	}
+	return buf.String()
+}
+
+// ComputeEncryptionStatus reads the encryption headers of the sstables in
+// the specified store directory. The store does not need to be open and the
+// keys do not need to be available.
+func ComputeEncryptionStatus(dir string) (EncryptionStatus, error) {
+	status := EncryptionStatus{
+		Files: make(map[string]int),
+		Bytes: make(map[string]int64),
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return status, err
+	}
+	for _, info := range infos {
+		if !info.Mode().IsRegular() || filepath.Ext(info.Name()) != ".sst" {
+			continue
+		}
+		keyID, err := readEncryptionKeyID(filepath.Join(dir, info.Name()))
+		if err != nil {
+			if os.IsNotExist(err) {
+				// The file was removed by RocksDB after we listed it.
+				continue
+			}
+			return status, err
+		}
+		status.Files[keyID]++
+		status.Bytes[keyID] += info.Size()
+	}
+	return status, nil
+}
+
+// EncryptionStatus returns the encryption status of the engine's sstables.
+func (r *RocksDB) EncryptionStatus() (EncryptionStatus, error) {
+	if len(r.dir) == 0 {
+		return EncryptionStatus{}, errors.New("in-memory engines are not encrypted")
+	}
+	status, err := ComputeEncryptionStatus(r.dir)
+	if err != nil {
+		return status, err
+	}
+	status.ActiveKeyID = r.encryptionKeyID
+	return status, nil
+}
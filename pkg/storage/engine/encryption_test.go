@@ -0,0 +1,375 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/testutils"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+)
+
+func writeTestKey(t *testing.T, path string, b byte) string {
+	if err := ioutil.WriteFile(path, bytes.Repeat([]byte{b}, 32), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// sstableKeyIDs returns the set of key IDs the sstables in dir are
+// encrypted with.
+func sstableKeyIDs(t *testing.T, dir string) map[string]struct{} {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make(map[string]struct{})
+	for _, info := range infos {
+		if !strings.HasSuffix(info.Name(), ".sst") {
+			continue
+		}
+		keyID, err := readEncryptionKeyID(filepath.Join(dir, info.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[keyID] = struct{}{}
+	}
+	return ids
+}
+
+// decryptTestFile decrypts the contents of a file encrypted with the
+// specified store key, following the layout described in
+// rocksdb/encryption.cc.
+func decryptTestFile(t *testing.T, key, data []byte) []byte {
+	iv := data[encryptionHeaderSize-aes.BlockSize : encryptionHeaderSize]
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("cockroach file key"))
+	mac.Write(iv)
+	block, err := aes.NewCipher(mac.Sum(nil)[:len(key)])
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var plaintext []byte
+	data = data[encryptionHeaderSize:]
+	for ordinal := uint64(0); len(data) > 0; ordinal++ {
+		n := binary.LittleEndian.Uint32(data)
+		nonce := make([]byte, aead.NonceSize())
+		copy(nonce[len(nonce)-8:], data[4:12])
+		var ad [12]byte
+		binary.LittleEndian.PutUint64(ad[:], ordinal)
+		binary.LittleEndian.PutUint32(ad[8:], n)
+		end := 12 + int(n) + aead.Overhead()
+		if plaintext, err = aead.Open(plaintext, nonce, data[12:end], ad[:]); err != nil {
+			t.Fatalf("chunk %d: %s", ordinal, err)
+		}
+		data = data[end:]
+	}
+	return plaintext
+}
+
+// TestEncryptionCipherCompatibility verifies that sstables are encrypted
+// with standard AES-GCM by decrypting one with the Go implementation and
+// checking for the block-based table magic number in its footer.
+func TestEncryptionCipherCompatibility(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	dir, dirCleanup := testutils.TempDir(t, 0)
+	defer dirCleanup()
+
+	for i, keyLen := range []int{16, 24, 32} {
+		key := bytes.Repeat([]byte{byte(i + 1)}, keyLen)
+		keyPath := filepath.Join(dir, fmt.Sprintf("%d.key", keyLen))
+		if err := ioutil.WriteFile(keyPath, key, 0600); err != nil {
+			t.Fatal(err)
+		}
+		dbDir := filepath.Join(dir, fmt.Sprintf("db%d", keyLen))
+		db, err := NewRocksDBWithConfig(RocksDBConfig{
+			Dir:               dbDir,
+			MaxOpenFiles:      DefaultMaxOpenFiles,
+			EncryptionKeyFile: keyPath,
+		}, RocksDBCache{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Put(mvccKey("a"), []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		tables := db.GetSSTables()
+		db.Close()
+		if len(tables) == 0 {
+			t.Fatalf("%d: expected an sstable", keyLen)
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(dbDir, tables[0].Name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		plaintext := decryptTestFile(t, key, data)
+		const blockBasedTableMagicNumber = 0x88e241b785f4cff7
+		if magic := binary.LittleEndian.Uint64(plaintext[len(plaintext)-8:]); magic != blockBasedTableMagicNumber {
+			t.Errorf("%d: expected magic number %x, found %x", keyLen, uint64(blockBasedTableMagicNumber), magic)
+		}
+	}
+}
+
+func TestRocksDBEncryption(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	dir, dirCleanup := testutils.TempDir(t, 0)
+	defer dirCleanup()
+
+	dbDir := filepath.Join(dir, "db")
+	oldKey := writeTestKey(t, filepath.Join(dir, "old.key"), 1)
+	newKey := writeTestKey(t, filepath.Join(dir, "new.key"), 2)
+	badKey := filepath.Join(dir, "bad.key")
+	if err := ioutil.WriteFile(badKey, []byte("short"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	open := func(key string, oldKeys ...string) (*RocksDB, error) {
+		return NewRocksDBWithConfig(RocksDBConfig{
+			Dir:                   dbDir,
+			MaxOpenFiles:          DefaultMaxOpenFiles,
+			EncryptionKeyFile:     key,
+			OldEncryptionKeyFiles: oldKeys,
+		}, RocksDBCache{})
+	}
+
+	if _, err := open(badKey); !testutils.IsError(err, "invalid encryption key") {
+		t.Fatalf("expected invalid key error, got %v", err)
+	}
+
+	db, err := open(oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put(mvccKey("a"), []byte("secret-value")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	oldKeyID := db.encryptionKeyID
+	db.Close()
+
+	// No file may contain the plaintext value and every file must be
+	// encrypted with the key.
+	status, err := ComputeEncryptionStatus(dbDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := status.Files[""]; n != 0 {
+		t.Fatalf("expected all files to be encrypted, found %d unencrypted: %s", n, status)
+	}
+	infos, err := ioutil.ReadDir(dbDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, info := range infos {
+		data, err := ioutil.ReadFile(filepath.Join(dbDir, info.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(data, []byte("secret-value")) {
+			t.Fatalf("found plaintext value in %s", info.Name())
+		}
+	}
+
+	// An encrypted store cannot be opened without a key.
+	if _, err := open(""); !testutils.IsError(err, "no encryption key was specified") {
+		t.Fatalf("expected missing key error, got %v", err)
+	}
+
+	// Closing the engine interrupts the re-encryption, which is resumed the
+	// next time the engine is opened.
+	db, err = open(newKey, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// Rotate to the new key. The re-encryption may already have completed
+	// before the engine was closed above.
+	db, err = open(newKey, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKeyID := db.encryptionKeyID
+	if db.rotationDone != nil {
+		<-db.rotationDone
+	}
+	if status, err := db.EncryptionStatus(); err != nil {
+		t.Fatal(err)
+	} else if p := status.Progress(); p != 1 {
+		t.Fatalf("expected re-encryption to be complete, found %s", status)
+	}
+	db.Close()
+	ids := sstableKeyIDs(t, dbDir)
+	if _, ok := ids[oldKeyID]; ok {
+		t.Fatalf("expected no sstables encrypted with %s, found %v", oldKeyID, ids)
+	}
+	if _, ok := ids[newKeyID]; !ok {
+		t.Fatalf("expected sstables encrypted with %s, found %v", newKeyID, ids)
+	}
+
+	db, err = open(newKey, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	val, err := db.Get(mvccKey("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(val) != "secret-value" {
+		t.Fatalf("expected secret-value, found %q", val)
+	}
+}
+
+// TestRocksDBEncryptedFile verifies that files written through an encrypted
+// engine can be truncated and appended to, and that tampering with them is
+// detected.
+func TestRocksDBEncryptedFile(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	dir, dirCleanup := testutils.TempDir(t, 0)
+	defer dirCleanup()
+
+	db, err := NewRocksDBWithConfig(RocksDBConfig{
+		Dir:               filepath.Join(dir, "db"),
+		MaxOpenFiles:      DefaultMaxOpenFiles,
+		EncryptionKeyFile: writeTestKey(t, filepath.Join(dir, "key"), 1),
+	}, RocksDBCache{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	data := make([]byte, 10000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	path := filepath.Join(dir, "file")
+	f, err := db.openFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	written := 0
+	appendTo := func(n int) {
+		if err := f.Append(data[written:n]); err != nil {
+			t.Fatal(err)
+		}
+		written = n
+	}
+	truncateTo := func(n int) {
+		if err := f.Truncate(int64(n)); err != nil {
+			t.Fatal(err)
+		}
+		written = n
+	}
+	// Truncate the file within data which is still buffered, and then within
+	// data which was already written to disk by the sync.
+	appendTo(5000)
+	truncateTo(4500)
+	if err := f.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	truncateTo(4200)
+	appendTo(len(data))
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	contents, err := db.readFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(contents, data) {
+		t.Fatalf("expected %d bytes to be read back, found %d differing bytes", len(data), len(contents))
+	}
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, data[:100]) {
+		t.Fatal("found plaintext data in encrypted file")
+	}
+
+	// Flip a bit in the encrypted data of the first chunk.
+	raw[encryptionHeaderSize+100] ^= 1
+	if err := ioutil.WriteFile(path, raw, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.readFile(path); !testutils.IsError(err, "failed authentication") {
+		t.Fatalf("expected authentication error, got %v", err)
+	}
+}
+
+func TestRocksDBEncryptionExistingStore(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	dir, dirCleanup := testutils.TempDir(t, 0)
+	defer dirCleanup()
+
+	db, err := NewRocksDB(
+		roachpb.Attributes{}, filepath.Join(dir, "db"), RocksDBCache{}, 0, DefaultMaxOpenFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	_, err = NewRocksDBWithConfig(RocksDBConfig{
+		Dir:               filepath.Join(dir, "db"),
+		MaxOpenFiles:      DefaultMaxOpenFiles,
+		EncryptionKeyFile: writeTestKey(t, filepath.Join(dir, "key"), 1),
+	}, RocksDBCache{})
+	if !testutils.IsError(err, "cannot enable encryption on existing unencrypted store") {
+		t.Fatalf("expected error enabling encryption, got %v", err)
+	}
+}
+
+func TestEncryptionStatusProgress(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	testCases := []struct {
+		bytes    map[string]int64
+		expected float64
+	}{
+		{nil, 1},
+		{map[string]int64{"a": 10}, 1},
+		{map[string]int64{"a": 10, "b": 30}, 0.25},
+		{map[string]int64{"b": 10, "": 10}, 0},
+	}
+	for i, c := range testCases {
+		s := EncryptionStatus{ActiveKeyID: "a", Bytes: c.bytes}
+		if p := s.Progress(); p != c.expected {
+			t.Errorf("%d: expected progress %f, found %f", i, c.expected, p)
+		}
+	}
+}
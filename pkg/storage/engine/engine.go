@@ -131,6 +131,12 @@ type Writer interface {
 	// Note that clear actually removes entries from the storage
 	// engine, rather than inserting tombstones.
 	Clear(key MVCCKey) error
+	// ClearRange removes all of the items in the range [start,end) by writing
+	// a single range deletion tombstone, which is far cheaper than clearing
+	// each key individually. Iterators created on an engine or snapshot
+	// respect the tombstone. Note that a batch containing a range deletion
+	// cannot be read from (reads return an error) until it is committed.
+	ClearRange(start, end MVCCKey) error
 	// Merge is a high-performance write operation used for values which are
 	// accumulated over several writes. Multiple values can be merged
 	// sequentially into a single key; a subsequent read will return a "merged"
@@ -162,11 +168,31 @@ type Engine interface {
 	Attrs() roachpb.Attributes
 	// Capacity returns capacity details for the engine's available storage.
 	Capacity() (roachpb.StoreCapacity, error)
+	// CompactRange forces compaction of the key span [start,end), which is
+	// useful to reclaim space after large deletions or ingestions. A nil start
+	// or end key leaves the span unbounded on that side. If forceBottommost is
+	// true, files in the bottommost level are rewritten as well. The call
+	// blocks until the compaction is complete.
+	CompactRange(start, end roachpb.Key, forceBottommost bool) error
+	// CreateCheckpoint creates a consistent point-in-time copy of the engine's
+	// on-disk files in dir, which must not already exist. The checkpoint can
+	// be opened as an engine of its own. Files are hard linked where possible,
+	// so checkpoints are cheap to create and do not require stopping writes.
+	CreateCheckpoint(dir string) error
 	// Flush causes the engine to write all in-memory data to disk
 	// immediately.
 	Flush() error
+	// SyncWAL syncs the engine's write-ahead log to disk, making all writes
+	// which preceded the call durable. It is much cheaper than Flush.
+	SyncWAL() error
 	// GetStats retrieves stats from the engine.
 	GetStats() (*Stats, error)
+	// IngestExternalFiles atomically links a slice of externally-built
+	// sstables into the engine's log-structured merge-tree without rewriting
+	// them through the memtable. If move is true, the files are moved (hard
+	// linked) into the engine's directory and the originals removed; otherwise
+	// they are copied and the originals left in place.
+	IngestExternalFiles(paths []string, move bool) error
 	// NewBatch returns a new instance of a batched engine which wraps
 	// this engine. Batched engines accumulate all mutations and apply
 	// them atomically on a call to Commit().
@@ -177,6 +203,15 @@ type Engine interface {
 	// by invoking Close(). Note that snapshots must not be used after the
 	// original engine has been stopped.
 	NewSnapshot() Reader
+	// SetBackgroundRateLimit adjusts the rate in bytes per second at which
+	// background work such as flushes and compactions may write to disk. A
+	// rate of zero removes the limit.
+	SetBackgroundRateLimit(bytesPerSec int64) error
+	// VerifyChecksums reads all of the on-disk data holding keys in the span
+	// [start,end), verifying its checksums, and returns the number of bytes
+	// verified. A nil start or end key leaves the span unbounded on that side.
+	// An error is returned if corruption is detected.
+	VerifyChecksums(start, end roachpb.Key) (int64, error)
 }
 
 // Batch is the interface for batch specific operations.
@@ -222,6 +257,13 @@ type Stats struct {
 	Flushes                  int64
 	Compactions              int64
 	TableReadersMemEstimate  int64
+	// The following stats are derived from background events.
+	CompactionsInProgress int64
+	CompactedBytesRead    int64
+	CompactedBytesWritten int64
+	FlushedBytes          int64
+	WriteStalls           int64
+	WriteStallNanos       int64
 }
 
 // PutProto sets the given key to the protobuf-serialized byte string
@@ -63,6 +63,13 @@ func runWithAllEngines(test func(e Engine, t *testing.T), t *testing.T) {
 	inMem := NewInMem(inMemAttrs, testCacheSize)
 	stopper.AddCloser(inMem)
 	test(inMem, t)
+
+	goEngine, err := NewGoEngine(GoEngineConfig{Attrs: inMemAttrs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stopper.AddCloser(goEngine)
+	test(goEngine, t)
 }
 
 // TestEngineBatchCommit writes a batch containing 10K rows (all the
@@ -155,7 +162,7 @@ func TestEngineBatchStaleCachedIterator(t *testing.T) {
 
 		// Higher-level failure mode. Mostly for documentation.
 		{
-			batch := eng.NewBatch().(*rocksDBBatch)
+			batch := eng.NewBatch()
 			defer batch.Close()
 
 			key := roachpb.Key("z")
@@ -0,0 +1,250 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/storage/engine/rocksdb"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+)
+
+// EventType is the type of a background engine event. The values must be
+// kept in sync with DBEventType in rocksdb/eventlistener.h.
+type EventType int
+
+const (
+	// EventFlushCompleted is reported when a memtable has been flushed to an
+	// sstable.
+	EventFlushCompleted EventType = iota
+	// EventCompactionStarted is reported when a compaction starts writing its
+	// output.
+	EventCompactionStarted
+	// EventCompactionCompleted is reported when a compaction has finished.
+	EventCompactionCompleted
+	// EventWriteStallChanged is reported when writes become delayed or
+	// stopped because flushes or compactions are falling behind, and when
+	// they return to normal.
+	EventWriteStallChanged
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventFlushCompleted:
+		return "flush completed"
+	case EventCompactionStarted:
+		return "compaction started"
+	case EventCompactionCompleted:
+		return "compaction completed"
+	case EventWriteStallChanged:
+		return "write stall changed"
+	}
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+// WriteStallCondition describes whether writes to an engine are being
+// throttled. The values must be kept in sync with DBWriteStallCondition in
+// rocksdb/eventlistener.h.
+type WriteStallCondition int
+
+const (
+	// WriteStallNormal indicates that writes are not throttled.
+	WriteStallNormal WriteStallCondition = iota
+	// WriteStallDelayed indicates that writes are being slowed down.
+	WriteStallDelayed
+	// WriteStallStopped indicates that writes are blocked.
+	WriteStallStopped
+)
+
+func (c WriteStallCondition) String() string {
+	switch c {
+	case WriteStallNormal:
+		return "normal"
+	case WriteStallDelayed:
+		return "delayed"
+	case WriteStallStopped:
+		return "stopped"
+	}
+	return fmt.Sprintf("WriteStallCondition(%d)", int(c))
+}
+
+// Event describes a background event in an engine. Only the fields relevant
+// to the event's type are set.
+type Event struct {
+	Type EventType
+	// JobID identifies the flush or compaction.
+	JobID int
+	// OutputLevel is the level a compaction writes to.
+	OutputLevel int
+	InputFiles  int
+	OutputFiles int
+	InputBytes  int64
+	OutputBytes int64
+	// Duration is the time a compaction took.
+	Duration time.Duration
+	// WriteStall is the new write stall condition.
+	WriteStall WriteStallCondition
+}
+
+func (e Event) String() string {
+	switch e.Type {
+	case EventFlushCompleted:
+		return fmt.Sprintf("%s: job=%d bytes=%s", e.Type, e.JobID,
+			humanize.IBytes(uint64(e.OutputBytes)))
+	case EventCompactionStarted:
+		return fmt.Sprintf("%s: job=%d", e.Type, e.JobID)
+	case EventCompactionCompleted:
+		return fmt.Sprintf("%s: job=%d level=%d in=%d files/%s out=%d files/%s duration=%s",
+			e.Type, e.JobID, e.OutputLevel,
+			e.InputFiles, humanize.IBytes(uint64(e.InputBytes)),
+			e.OutputFiles, humanize.IBytes(uint64(e.OutputBytes)), e.Duration)
+	case EventWriteStallChanged:
+		return fmt.Sprintf("%s: writes %s", e.Type, e.WriteStall)
+	}
+	return e.Type.String()
+}
+
+// EventListener is notified of background events in an engine. OnEvent is
+// invoked from RocksDB's background threads and must not block or call back
+// into the engine.
+type EventListener interface {
+	OnEvent(Event)
+}
+
+// eventStats accumulates the metrics derived from an engine's background
+// events.
+type eventStats struct {
+	compactionsInProgress int64 // accessed atomically
+	compactedBytesRead    int64 // accessed atomically
+	compactedBytesWritten int64 // accessed atomically
+	flushedBytes          int64 // accessed atomically
+	writeStalls           int64 // accessed atomically
+
+	mu struct {
+		syncutil.Mutex
+		condition  WriteStallCondition
+		stallStart time.Time
+		stallTime  time.Duration
+	}
+}
+
+// writeStallDuration returns the total time writes have been delayed or
+// stopped, including any ongoing stall.
+func (s *eventStats) writeStallDuration() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.mu.stallTime
+	if s.mu.condition != WriteStallNormal {
+		d += timeutil.Since(s.mu.stallStart)
+	}
+	return d
+}
+
+// eventEngines is the registry of engines which receive background events,
+// indexed by the listener ID passed to RocksDB. The registry is needed
+// because events are reported from RocksDB's background threads without any
+// reference to the engine they belong to.
+var eventEngines struct {
+	syncutil.RWMutex
+	nextID int
+	m      map[int]*RocksDB
+}
+
+func init() {
+	rocksdb.Event = dispatchEvent
+}
+
+// registerEventEngine registers r to receive background events and returns
+// its listener ID, which is never zero.
+func registerEventEngine(r *RocksDB) int {
+	eventEngines.Lock()
+	defer eventEngines.Unlock()
+	if eventEngines.m == nil {
+		eventEngines.m = make(map[int]*RocksDB)
+	}
+	eventEngines.nextID++
+	eventEngines.m[eventEngines.nextID] = r
+	return eventEngines.nextID
+}
+
+func unregisterEventEngine(id int) {
+	eventEngines.Lock()
+	delete(eventEngines.m, id)
+	eventEngines.Unlock()
+}
+
+func dispatchEvent(listenerID int, info rocksdb.EventInfo) {
+	eventEngines.RLock()
+	r := eventEngines.m[listenerID]
+	eventEngines.RUnlock()
+	if r == nil {
+		return
+	}
+	r.handleEvent(Event{
+		Type:        EventType(info.Type),
+		JobID:       info.JobID,
+		OutputLevel: info.OutputLevel,
+		InputFiles:  info.InputFiles,
+		OutputFiles: info.OutputFiles,
+		InputBytes:  info.InputBytes,
+		OutputBytes: info.OutputBytes,
+		Duration:    time.Duration(info.Micros) * time.Microsecond,
+		WriteStall:  WriteStallCondition(info.StallCondition),
+	})
+}
+
+// handleEvent updates the engine's event metrics, logs the event and passes
+// it on to the engine's event listener, if any.
+func (r *RocksDB) handleEvent(e Event) {
+	ctx := context.TODO()
+	s := &r.eventStats
+	switch e.Type {
+	case EventFlushCompleted:
+		atomic.AddInt64(&s.flushedBytes, e.OutputBytes)
+	case EventCompactionStarted:
+		atomic.AddInt64(&s.compactionsInProgress, 1)
+	case EventCompactionCompleted:
+		atomic.AddInt64(&s.compactionsInProgress, -1)
+		atomic.AddInt64(&s.compactedBytesRead, e.InputBytes)
+		atomic.AddInt64(&s.compactedBytesWritten, e.OutputBytes)
+	case EventWriteStallChanged:
+		s.mu.Lock()
+		now := timeutil.Now()
+		if s.mu.condition != WriteStallNormal {
+			s.mu.stallTime += now.Sub(s.mu.stallStart)
+		} else {
+			atomic.AddInt64(&s.writeStalls, 1)
+		}
+		s.mu.condition = e.WriteStall
+		s.mu.stallStart = now
+		s.mu.Unlock()
+	}
+
+	if e.Type == EventWriteStallChanged {
+		log.Warningf(ctx, "%s: %s", r, e)
+	} else if log.V(1) {
+		log.Infof(ctx, "%s: %s", r, e)
+	}
+	if r.eventListener != nil {
+		r.eventListener.OnEvent(e)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/testutils"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+)
+
+type recordingEventListener struct {
+	syncutil.Mutex
+	events []Event
+}
+
+func (l *recordingEventListener) OnEvent(e Event) {
+	l.Lock()
+	l.events = append(l.events, e)
+	l.Unlock()
+}
+
+func (l *recordingEventListener) count(t EventType) int {
+	l.Lock()
+	defer l.Unlock()
+	var n int
+	for _, e := range l.events {
+		if e.Type == t {
+			n++
+		}
+	}
+	return n
+}
+
+func TestRocksDBEventListener(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	dir, dirCleanup := testutils.TempDir(t, 0)
+	defer dirCleanup()
+
+	listener := &recordingEventListener{}
+	db, err := NewRocksDBWithConfig(RocksDBConfig{
+		Dir:           filepath.Join(dir, "db"),
+		MaxOpenFiles:  DefaultMaxOpenFiles,
+		EventListener: listener,
+	}, RocksDBCache{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Put(mvccKey("a"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CompactRange(nil, nil, true /* forceBottommost */); err != nil {
+		t.Fatal(err)
+	}
+
+	// Flushes and compactions report their events before the corresponding
+	// call returns.
+	if n := listener.count(EventFlushCompleted); n == 0 {
+		t.Errorf("expected a flush event")
+	}
+	started := listener.count(EventCompactionStarted)
+	completed := listener.count(EventCompactionCompleted)
+	if completed == 0 || started != completed {
+		t.Errorf("expected matching compaction events, found %d started and %d completed",
+			started, completed)
+	}
+
+	stats, err := db.GetStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.FlushedBytes == 0 {
+		t.Errorf("expected flushed bytes to be recorded")
+	}
+	if stats.CompactedBytesRead == 0 {
+		t.Errorf("expected compacted bytes to be recorded")
+	}
+	if stats.CompactionsInProgress != 0 {
+		t.Errorf("expected no compactions in progress, found %d", stats.CompactionsInProgress)
+	}
+}
+
+func TestRocksDBWriteStallEvents(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	db := NewInMem(roachpb.Attributes{}, 1<<20)
+	defer db.Close()
+
+	listener := &recordingEventListener{}
+	db.eventListener = listener
+	for _, c := range []WriteStallCondition{
+		WriteStallDelayed, WriteStallStopped, WriteStallNormal, WriteStallStopped,
+	} {
+		db.handleEvent(Event{Type: EventWriteStallChanged, WriteStall: c})
+	}
+
+	stats, err := db.GetStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A transition between delayed and stopped is part of the same stall.
+	if stats.WriteStalls != 2 {
+		t.Errorf("expected 2 write stalls, found %d", stats.WriteStalls)
+	}
+	if stats.WriteStallNanos <= 0 {
+		t.Errorf("expected write stall time to be recorded, found %d", stats.WriteStallNanos)
+	}
+	if n := listener.count(EventWriteStallChanged); n != 4 {
+		t.Errorf("expected 4 write stall events, found %d", n)
+	}
+}
@@ -71,7 +71,7 @@ func (gc GarbageCollector) Filter(keys []MVCCKey, values [][]byte) hlc.Timestamp
 	delTS := hlc.ZeroTimestamp
 	for i, key = range keys {
 		if !key.IsValue() {
-			log.Errorf(context.TODO(), "unexpected MVCC metadata encountered: %q", key)
+			log.Errorf(context.TODO(), "unexpected MVCC metadata encountered: %q", log.Unsafe(key))
 			return hlc.ZeroTimestamp
 		}
 		if gc.Threshold.Less(key.Timestamp) {
@@ -0,0 +1,1099 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/storage/engine/enginepb"
+	"github.com/cockroachdb/cockroach/pkg/storage/engine/gostore"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+)
+
+// A GoEngine is an Engine whose data is stored by gostore, an ordered
+// key/value store implemented entirely in Go. It is much slower than
+// RocksDB and keeps all of its data in memory, but its storage does not
+// depend on cgo, which makes it useful for testing and for platforms where
+// RocksDB is hard to build. Merges use gostore's port of the merge semantics
+// implemented by RocksDB.
+//
+// Keys are stored using the encoding used in batch representations, and the
+// immutable snapshots provided by gostore let snapshots, iterators and
+// batches capture the state of the engine in constant time.
+type GoEngine struct {
+	attrs   roachpb.Attributes
+	dir     string
+	maxSize int64
+	db      *gostore.DB
+}
+
+var _ Engine = &GoEngine{}
+
+// GoEngineConfig holds the configuration parameters used in setting up a new
+// GoEngine instance.
+type GoEngineConfig struct {
+	Attrs roachpb.Attributes
+	// Dir is the directory the engine persists its data to. An empty Dir
+	// creates an in-memory engine.
+	Dir          string
+	MaxSizeBytes int64
+}
+
+// NewGoEngine allocates and returns a new GoEngine. If cfg.Dir is non-empty,
+// the data previously persisted to it is loaded. The caller must call the
+// engine's Close method when the engine is no longer needed.
+func NewGoEngine(cfg GoEngineConfig) (*GoEngine, error) {
+	freezeMergeOperators()
+
+	g := &GoEngine{
+		attrs:   cfg.Attrs,
+		dir:     cfg.Dir,
+		maxSize: cfg.MaxSizeBytes,
+	}
+	if len(g.dir) == 0 {
+		log.Infof(context.TODO(), "opening in memory go engine")
+	} else {
+		log.Infof(context.TODO(), "opening go engine at %q", g.dir)
+		if err := checkWritableDir(g.dir); err != nil {
+			return nil, errors.Wrapf(err, "could not open go engine at %s", g.dir)
+		}
+		if _, err := os.Stat(filepath.Join(g.dir, "CURRENT")); err == nil {
+			return nil, errors.Errorf("%s contains a rocksdb store", g.dir)
+		}
+	}
+	db, err := gostore.Open(gostore.Options{
+		Dir:     g.dir,
+		Compare: compareEncodedMVCCKeys,
+		Merge:   mergeEncodedMVCCKey,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not open go engine at %s", g.dir)
+	}
+	g.db = db
+	return g, nil
+}
+
+// String formatter.
+func (g *GoEngine) String() string {
+	return fmt.Sprintf("%s=%s", g.attrs.Attrs, g.dir)
+}
+
+// apply atomically applies the mutations in a batch representation to the
+// engine.
+func (g *GoEngine) apply(repr []byte) error {
+	b, err := goBatchFromRepr(repr)
+	if err != nil {
+		return err
+	}
+	return g.db.Apply(b)
+}
+
+// state returns a snapshot of the engine along with its sequence number.
+func (g *GoEngine) state() (gostore.Snapshot, uint64) {
+	snap, seq, err := g.db.State()
+	if err != nil {
+		panic("go engine used after being closed")
+	}
+	return snap, seq
+}
+
+func (g *GoEngine) currentSnapshot() gostore.Snapshot {
+	snap, _ := g.state()
+	return snap
+}
+
+// Close closes the engine, syncing any unsynced writes to disk.
+func (g *GoEngine) Close() {
+	if g.db.Closed() {
+		log.Errorf(context.TODO(), "closing closed go engine")
+		return
+	}
+	if len(g.dir) == 0 {
+		if log.V(1) {
+			log.Infof(context.TODO(), "closing in-memory go engine")
+		}
+	} else {
+		log.Infof(context.TODO(), "closing go engine at %q", g.dir)
+	}
+	if err := g.db.Close(); err != nil {
+		log.Errorf(context.TODO(), "%s: %s", g, err)
+	}
+}
+
+// closed returns true if the engine is closed.
+func (g *GoEngine) closed() bool {
+	return g.db.Closed()
+}
+
+// Attrs returns the list of attributes describing this engine.
+func (g *GoEngine) Attrs() roachpb.Attributes {
+	return g.attrs
+}
+
+// Put sets the given key to the value provided.
+func (g *GoEngine) Put(key MVCCKey, value []byte) error {
+	if len(key.Key) == 0 {
+		return emptyKeyError()
+	}
+	var b rocksDBBatchBuilder
+	b.Put(key, value)
+	return g.apply(b.Finish())
+}
+
+// Merge merges the given value into the existing value at key, using the
+// same semantics as RocksDB. Merges are applied eagerly.
+func (g *GoEngine) Merge(key MVCCKey, value []byte) error {
+	if len(key.Key) == 0 {
+		return emptyKeyError()
+	}
+	var b rocksDBBatchBuilder
+	b.Merge(key, value)
+	return g.apply(b.Finish())
+}
+
+// ApplyBatchRepr atomically applies a set of batched updates. An error is
+// returned without applying anything if repr is malformed.
+func (g *GoEngine) ApplyBatchRepr(repr []byte) error {
+	if err := verifyBatchRepr(repr); err != nil {
+		return errors.Wrap(err, "invalid batch repr")
+	}
+	return g.apply(repr)
+}
+
+// Clear removes the item from the engine with the given key.
+func (g *GoEngine) Clear(key MVCCKey) error {
+	if len(key.Key) == 0 {
+		return emptyKeyError()
+	}
+	var b rocksDBBatchBuilder
+	b.Clear(key)
+	return g.apply(b.Finish())
+}
+
+// ClearRange removes the items in the range [start,end).
+func (g *GoEngine) ClearRange(start, end MVCCKey) error {
+	if len(end.Key) == 0 {
+		return emptyKeyError()
+	}
+	var b rocksDBBatchBuilder
+	b.ClearRange(start, end)
+	return g.apply(b.Finish())
+}
+
+// Get returns the value for the given key.
+func (g *GoEngine) Get(key MVCCKey) ([]byte, error) {
+	return goGetValue(g.currentSnapshot(), key)
+}
+
+// GetProto fetches the value at the specified key and unmarshals it.
+func (g *GoEngine) GetProto(
+	key MVCCKey, msg proto.Message,
+) (ok bool, keyBytes, valBytes int64, err error) {
+	return goGetProto(g.currentSnapshot(), key, msg)
+}
+
+// Iterate iterates from start to end keys, invoking f on each key/value
+// pair. See engine.Iterate for details.
+func (g *GoEngine) Iterate(start, end MVCCKey, f func(MVCCKeyValue) (bool, error)) error {
+	return goIterate(g.NewIterator(false), start, end, f)
+}
+
+// NewIterator returns an iterator over the state of the engine at the time
+// the iterator is created. Prefix iteration is not optimized, so prefix
+// iterators behave like ordinary iterators.
+func (g *GoEngine) NewIterator(prefix bool) Iterator {
+	return &goIterator{reader: g, snap: g.currentSnapshot()}
+}
+
+// NewSnapshot returns a read-only view of the current state of the engine.
+func (g *GoEngine) NewSnapshot() Reader {
+	return &goSnapshot{parent: g, snap: g.currentSnapshot()}
+}
+
+// NewBatch returns a new batch wrapping this engine.
+func (g *GoEngine) NewBatch() Batch {
+	b := &goBatch{parent: g}
+	b.distinct.batch = b
+	return b
+}
+
+// Capacity queries the underlying file system for disk capacity information.
+func (g *GoEngine) Capacity() (roachpb.StoreCapacity, error) {
+	return computeCapacity(g.dir, g.maxSize)
+}
+
+// CompactRange rewrites the engine's snapshot file and truncates its log.
+// The whole engine is compacted regardless of the specified span.
+func (g *GoEngine) CompactRange(start, end roachpb.Key, forceBottommost bool) error {
+	return g.db.Compact()
+}
+
+// CreateCheckpoint writes a snapshot of the engine to dir, which must not
+// exist yet. The checkpoint can be opened with NewGoEngine. Checkpoints
+// cannot be created for in-memory engines.
+func (g *GoEngine) CreateCheckpoint(dir string) error {
+	if len(g.dir) == 0 {
+		return errors.New("cannot create a checkpoint of an in-memory go engine")
+	}
+	if dir == "" {
+		return errors.New("checkpoint dir must be non-empty")
+	}
+	if _, err := os.Stat(dir); err == nil {
+		return errors.Errorf("could not create checkpoint at %q: directory exists", dir)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrapf(err, "could not create checkpoint at %q", dir)
+	}
+	if err := g.db.Checkpoint(dir); err != nil {
+		return errors.Wrapf(err, "could not create checkpoint at %q", dir)
+	}
+	return nil
+}
+
+// Flush syncs the engine's log to disk.
+func (g *GoEngine) Flush() error {
+	return g.db.Sync()
+}
+
+// SyncWAL syncs the engine's log to disk, like Flush.
+func (g *GoEngine) SyncWAL() error {
+	return g.db.Sync()
+}
+
+// GetStats returns an empty Stats. The go engine has no caches, memtables
+// or background compactions to report on.
+func (g *GoEngine) GetStats() (*Stats, error) {
+	return &Stats{}, nil
+}
+
+// IngestExternalFiles atomically adds the contents of a slice of sstables
+// created with an SSTWriter to the engine.
+func (g *GoEngine) IngestExternalFiles(paths []string, move bool) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	sst, err := MakeRocksDBSstFileReader()
+	if err != nil {
+		return err
+	}
+	defer sst.Close()
+	for _, path := range paths {
+		if err := sst.AddFile(path); err != nil {
+			return errors.Wrapf(err, "could not read %s", path)
+		}
+	}
+	var b rocksDBBatchBuilder
+	if err := sst.Iterate(MVCCKey{}, MVCCKeyMax, func(kv MVCCKeyValue) (bool, error) {
+		b.Put(kv.Key, kv.Value)
+		return false, nil
+	}); err != nil {
+		return err
+	}
+	if err := g.apply(b.Finish()); err != nil {
+		return err
+	}
+	if move {
+		for _, path := range paths {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SetBackgroundRateLimit is a no-op as the go engine does not perform any
+// background writes.
+func (g *GoEngine) SetBackgroundRateLimit(bytesPerSec int64) error {
+	return nil
+}
+
+// VerifyChecksums returns the size of the data in the span. The go engine
+// verifies the checksums of its files when it is opened and keeps no other
+// on-disk data which could become corrupted.
+func (g *GoEngine) VerifyChecksums(start, end roachpb.Key) (int64, error) {
+	if len(end) == 0 {
+		end = roachpb.KeyMax
+	}
+	snap := g.currentSnapshot()
+	endKey := encodeMVCCKey(MakeMVCCMetadataKey(end))
+	var size int64
+	for k, v, ok := snap.SeekGE(encodeMVCCKey(MakeMVCCMetadataKey(start)), true); ok && compareEncodedMVCCKeys(k, endKey) < 0; k, v, ok = snap.SeekGE(k, false) {
+		size += int64(mustDecodeMVCCKey(k).EncodedSize()) + int64(len(v))
+	}
+	return size, nil
+}
+
+type goSnapshot struct {
+	parent   *GoEngine
+	snap     gostore.Snapshot
+	isClosed bool
+}
+
+// Close releases the snapshot.
+func (s *goSnapshot) Close() {
+	s.snap = gostore.Snapshot{}
+	s.isClosed = true
+}
+
+// closed returns true if the snapshot is closed.
+func (s *goSnapshot) closed() bool {
+	return s.isClosed
+}
+
+// Get returns the value for the given key as of the snapshot.
+func (s *goSnapshot) Get(key MVCCKey) ([]byte, error) {
+	return goGetValue(s.snap, key)
+}
+
+func (s *goSnapshot) GetProto(
+	key MVCCKey, msg proto.Message,
+) (ok bool, keyBytes, valBytes int64, err error) {
+	return goGetProto(s.snap, key, msg)
+}
+
+// Iterate iterates over the keys between start inclusive and end exclusive
+// as of the snapshot, invoking f() on each key/value pair.
+func (s *goSnapshot) Iterate(start, end MVCCKey, f func(MVCCKeyValue) (bool, error)) error {
+	return goIterate(s.NewIterator(false), start, end, f)
+}
+
+// NewIterator returns a new iterator over the snapshot.
+func (s *goSnapshot) NewIterator(prefix bool) Iterator {
+	return &goIterator{reader: s, snap: s.snap}
+}
+
+// goBatch is a batch of mutations to a GoEngine. The mutations are
+// accumulated in a batch representation, which is applied to the engine on
+// commit.
+type goBatch struct {
+	parent  *GoEngine
+	builder rocksDBBatchBuilder
+	// view is the state of the engine with the batch's mutations applied. It
+	// is built on the first read from the batch and updated incrementally
+	// as mutations are added. A write to the engine makes it stale, in which
+	// case it is rebuilt on the next read.
+	view      gostore.Snapshot
+	viewSeq   uint64
+	viewValid bool
+
+	distinct     goDistinctBatch
+	distinctOpen bool
+	committed    bool
+	isClosed     bool
+}
+
+// Close releases the batch. Uncommitted mutations are discarded.
+func (b *goBatch) Close() {
+	b.view = gostore.Snapshot{}
+	b.viewValid = false
+	b.isClosed = true
+}
+
+// closed returns true if the batch is closed.
+func (b *goBatch) closed() bool {
+	return b.isClosed || b.committed
+}
+
+// currentView returns the state of the engine with the batch's mutations
+// applied, rebuilding it if necessary.
+func (b *goBatch) currentView() (gostore.Snapshot, error) {
+	snap, seq := b.parent.state()
+	if b.viewValid && b.viewSeq == seq {
+		return b.view, nil
+	}
+	view, err := applyGoBatchRepr(snap, b.builder.getRepr())
+	if err != nil {
+		return gostore.Snapshot{}, err
+	}
+	b.view, b.viewSeq, b.viewValid = view, seq, true
+	return view, nil
+}
+
+// record adds a mutation to the batch and to its view, if the view has been
+// built. It does not check whether a distinct batch is open.
+func (b *goBatch) record(op func(*rocksDBBatchBuilder)) error {
+	if b.viewValid {
+		var scratch rocksDBBatchBuilder
+		op(&scratch)
+		view, err := applyGoBatchRepr(b.view, scratch.Finish())
+		if err != nil {
+			return err
+		}
+		b.view = view
+	}
+	op(&b.builder)
+	return nil
+}
+
+func (b *goBatch) checkDistinctClosed() {
+	if b.distinctOpen {
+		panic("distinct batch open")
+	}
+}
+
+func (b *goBatch) Put(key MVCCKey, value []byte) error {
+	b.checkDistinctClosed()
+	return b.record(func(w *rocksDBBatchBuilder) { w.Put(key, value) })
+}
+
+func (b *goBatch) Merge(key MVCCKey, value []byte) error {
+	b.checkDistinctClosed()
+	return b.record(func(w *rocksDBBatchBuilder) { w.Merge(key, value) })
+}
+
+func (b *goBatch) Clear(key MVCCKey) error {
+	b.checkDistinctClosed()
+	return b.record(func(w *rocksDBBatchBuilder) { w.Clear(key) })
+}
+
+func (b *goBatch) ClearRange(start, end MVCCKey) error {
+	b.checkDistinctClosed()
+	return b.record(func(w *rocksDBBatchBuilder) { w.ClearRange(start, end) })
+}
+
+// ApplyBatchRepr adds the mutations in repr to the batch. An error is
+// returned without applying anything if repr is malformed.
+func (b *goBatch) ApplyBatchRepr(repr []byte) error {
+	b.checkDistinctClosed()
+	return b.distinct.ApplyBatchRepr(repr)
+}
+
+func (b *goBatch) Get(key MVCCKey) ([]byte, error) {
+	b.checkDistinctClosed()
+	view, err := b.currentView()
+	if err != nil {
+		return nil, err
+	}
+	return goGetValue(view, key)
+}
+
+func (b *goBatch) GetProto(
+	key MVCCKey, msg proto.Message,
+) (ok bool, keyBytes, valBytes int64, err error) {
+	b.checkDistinctClosed()
+	view, err := b.currentView()
+	if err != nil {
+		return false, 0, 0, err
+	}
+	return goGetProto(view, key, msg)
+}
+
+func (b *goBatch) Iterate(start, end MVCCKey, f func(MVCCKeyValue) (bool, error)) error {
+	b.checkDistinctClosed()
+	return goIterate(b.NewIterator(false), start, end, f)
+}
+
+// NewIterator returns an iterator over the batch and underlying engine. The
+// iterator observes mutations added to the batch after it was created the
+// next time it is seeked.
+func (b *goBatch) NewIterator(prefix bool) Iterator {
+	b.checkDistinctClosed()
+	return &goIterator{reader: b, refresh: b.currentView}
+}
+
+func (b *goBatch) Commit() error {
+	if b.committed {
+		panic("this batch was already committed")
+	}
+	b.distinctOpen = false
+	if b.builder.count > 0 {
+		if err := b.parent.apply(b.builder.Finish()); err != nil {
+			return err
+		}
+	}
+	b.committed = true
+	b.view = gostore.Snapshot{}
+	b.viewValid = false
+	return nil
+}
+
+func (b *goBatch) Repr() []byte {
+	return b.builder.getRepr()
+}
+
+// Distinct returns a view of the batch which reads the state of the batch
+// at the time Distinct is called and passes writes through to the batch.
+// The batch itself may not be used until the distinct batch is closed.
+func (b *goBatch) Distinct() ReadWriter {
+	if b.distinctOpen {
+		panic("distinct batch already open")
+	}
+	b.distinct.snap, b.distinct.err = b.currentView()
+	b.distinctOpen = true
+	return &b.distinct
+}
+
+type goDistinctBatch struct {
+	batch *goBatch
+	snap  gostore.Snapshot
+	err   error
+}
+
+func (d *goDistinctBatch) Close() {
+	if !d.batch.distinctOpen {
+		panic("distinct batch not open")
+	}
+	d.batch.distinctOpen = false
+	d.snap = gostore.Snapshot{}
+}
+
+func (d *goDistinctBatch) closed() bool {
+	return d.batch.closed()
+}
+
+func (d *goDistinctBatch) Get(key MVCCKey) ([]byte, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	return goGetValue(d.snap, key)
+}
+
+func (d *goDistinctBatch) GetProto(
+	key MVCCKey, msg proto.Message,
+) (ok bool, keyBytes, valBytes int64, err error) {
+	if d.err != nil {
+		return false, 0, 0, d.err
+	}
+	return goGetProto(d.snap, key, msg)
+}
+
+func (d *goDistinctBatch) Iterate(start, end MVCCKey, f func(MVCCKeyValue) (bool, error)) error {
+	return goIterate(d.NewIterator(false), start, end, f)
+}
+
+func (d *goDistinctBatch) NewIterator(prefix bool) Iterator {
+	return &goIterator{reader: d, snap: d.snap, err: d.err}
+}
+
+func (d *goDistinctBatch) Put(key MVCCKey, value []byte) error {
+	return d.batch.record(func(w *rocksDBBatchBuilder) { w.Put(key, value) })
+}
+
+func (d *goDistinctBatch) Merge(key MVCCKey, value []byte) error {
+	return d.batch.record(func(w *rocksDBBatchBuilder) { w.Merge(key, value) })
+}
+
+func (d *goDistinctBatch) Clear(key MVCCKey) error {
+	return d.batch.record(func(w *rocksDBBatchBuilder) { w.Clear(key) })
+}
+
+func (d *goDistinctBatch) ClearRange(start, end MVCCKey) error {
+	return d.batch.record(func(w *rocksDBBatchBuilder) { w.ClearRange(start, end) })
+}
+
+func (d *goDistinctBatch) ApplyBatchRepr(repr []byte) error {
+	if err := verifyBatchRepr(repr); err != nil {
+		return errors.Wrap(err, "invalid batch repr")
+	}
+	return replayBatchRepr(repr, d)
+}
+
+// goIterator is an iterator over a snapshot of a GoEngine or one of its
+// batches.
+type goIterator struct {
+	reader Reader
+	// refresh, if non-nil, returns the snapshot the iterator is repositioned
+	// in on every seek. It allows batch iterators to observe mutations added
+	// to the batch after they were created.
+	refresh func() (gostore.Snapshot, error)
+	snap    gostore.Snapshot
+	// The encoded and decoded key and the value of the current entry. The
+	// decoded key and the value point into the snapshot.
+	encodedKey []byte
+	key        MVCCKey
+	value      []byte
+	valid      bool
+	err        error
+}
+
+var _ Iterator = &goIterator{}
+
+func (i *goIterator) checkEngineOpen() {
+	if i.reader.closed() {
+		panic("iterator used after backing engine closed")
+	}
+}
+
+func (i *goIterator) maybeRefresh() {
+	if i.refresh != nil {
+		i.snap, i.err = i.refresh()
+	}
+}
+
+func (i *goIterator) setPosition(k, v []byte, ok bool) {
+	i.valid = ok && i.err == nil
+	if !i.valid {
+		i.encodedKey, i.key, i.value = nil, MVCCKey{}, nil
+		return
+	}
+	i.encodedKey, i.key, i.value = k, mustDecodeMVCCKey(k), v
+}
+
+func (i *goIterator) Close() {
+	*i = goIterator{}
+}
+
+func (i *goIterator) Seek(key MVCCKey) {
+	i.checkEngineOpen()
+	i.maybeRefresh()
+	i.setPosition(i.snap.SeekGE(encodeMVCCKey(key), true /* inclusive */))
+}
+
+func (i *goIterator) SeekReverse(key MVCCKey) {
+	i.checkEngineOpen()
+	i.maybeRefresh()
+	if len(key.Key) == 0 {
+		i.setPosition(i.snap.Last())
+		return
+	}
+	i.setPosition(i.snap.SeekLE(encodeMVCCKey(key), true /* inclusive */))
+}
+
+func (i *goIterator) Valid() bool {
+	return i.valid
+}
+
+func (i *goIterator) Next() {
+	i.checkEngineOpen()
+	if i.valid {
+		i.setPosition(i.snap.SeekGE(i.encodedKey, false /* inclusive */))
+	}
+}
+
+func (i *goIterator) Prev() {
+	i.checkEngineOpen()
+	if i.valid {
+		i.setPosition(i.snap.SeekLE(i.encodedKey, false /* inclusive */))
+	}
+}
+
+func (i *goIterator) NextKey() {
+	i.checkEngineOpen()
+	if i.valid {
+		next := encodeMVCCKey(MVCCKey{Key: i.key.Key.Next()})
+		i.setPosition(i.snap.SeekGE(next, true /* inclusive */))
+	}
+}
+
+func (i *goIterator) PrevKey() {
+	i.checkEngineOpen()
+	if i.valid {
+		prev := encodeMVCCKey(MVCCKey{Key: i.key.Key})
+		i.setPosition(i.snap.SeekLE(prev, false /* inclusive */))
+	}
+}
+
+func (i *goIterator) Key() MVCCKey {
+	// Give the key an extra byte of capacity to allow roachpb.Key.Next() to
+	// avoid an allocation. See cToGoKey.
+	key := make([]byte, len(i.key.Key), len(i.key.Key)+1)
+	copy(key, i.key.Key)
+	return MVCCKey{Key: key, Timestamp: i.key.Timestamp}
+}
+
+func (i *goIterator) Value() []byte {
+	return append([]byte(nil), i.value...)
+}
+
+func (i *goIterator) ValueProto(msg proto.Message) error {
+	if len(i.value) == 0 {
+		return nil
+	}
+	return proto.Unmarshal(i.value, msg)
+}
+
+// The keys and values stored in a snapshot are never modified, so they can
+// be returned without copying.
+func (i *goIterator) unsafeKey() MVCCKey {
+	return i.key
+}
+
+func (i *goIterator) unsafeValue() []byte {
+	return i.value
+}
+
+func (i *goIterator) Less(key MVCCKey) bool {
+	return i.unsafeKey().Less(key)
+}
+
+func (i *goIterator) Error() error {
+	return i.err
+}
+
+func (i *goIterator) ComputeStats(
+	start, end MVCCKey, nowNanos int64,
+) (enginepb.MVCCStats, error) {
+	i.checkEngineOpen()
+	if i.err != nil {
+		return enginepb.MVCCStats{}, i.err
+	}
+	return goComputeStats(i.snap, start, end, nowNanos)
+}
+
+// goComputeStats is a Go port of MVCCComputeStats in rocksdb/db.cc, which
+// computes the MVCC stats of the data in [start,end). The two
+// implementations must be kept in sync.
+func goComputeStats(
+	snap gostore.Snapshot, start, end MVCCKey, nowNanos int64,
+) (enginepb.MVCCStats, error) {
+	ageFactor := func(fromNS, toNS int64) int64 {
+		return toNS/1e9 - fromNS/1e9
+	}
+
+	var ms enginepb.MVCCStats
+	var meta enginepb.MVCCMetadata
+	var prevKey roachpb.Key
+	first := false
+
+	encodedEnd := encodeMVCCKey(end)
+	for k, value, ok := snap.SeekGE(encodeMVCCKey(start), true); ok && compareEncodedMVCCKeys(k, encodedEnd) < 0; k, value, ok = snap.SeekGE(k, false) {
+		key := mustDecodeMVCCKey(k)
+		isSys := isSysLocal(key.Key)
+		isValue := key.IsValue()
+		implicitMeta := isValue && !bytes.Equal(key.Key, prevKey)
+		prevKey = key.Key
+
+		if implicitMeta {
+			// No MVCCMetadata entry for this series of keys.
+			meta.Reset()
+			meta.KeyBytes = mvccVersionTimestampSize
+			meta.ValBytes = int64(len(value))
+			meta.Deleted = len(value) == 0
+			meta.Timestamp.WallTime = key.Timestamp.WallTime
+		}
+
+		if !isValue || implicitMeta {
+			metaKeySize := int64(len(key.Key)) + 1
+			var metaValSize int64
+			if !implicitMeta {
+				metaValSize = int64(len(value))
+			}
+			totalBytes := metaKeySize + metaValSize
+			first = true
+
+			if !implicitMeta {
+				if err := proto.Unmarshal(value, &meta); err != nil {
+					return ms, errors.Wrap(err, "unable to decode MVCCMetadata")
+				}
+			}
+
+			if isSys {
+				ms.SysBytes += totalBytes
+				ms.SysCount++
+			} else {
+				if !meta.Deleted {
+					ms.LiveBytes += totalBytes
+					ms.LiveCount++
+				} else {
+					ms.GCBytesAge += totalBytes * ageFactor(meta.Timestamp.WallTime, nowNanos)
+				}
+				ms.KeyBytes += metaKeySize
+				ms.ValBytes += metaValSize
+				ms.KeyCount++
+				if meta.RawBytes != nil {
+					ms.ValCount++
+				}
+			}
+			if !implicitMeta {
+				continue
+			}
+		}
+
+		totalBytes := int64(len(value)) + mvccVersionTimestampSize
+		if isSys {
+			ms.SysBytes += totalBytes
+		} else {
+			if first {
+				first = false
+				if !meta.Deleted {
+					ms.LiveBytes += totalBytes
+				} else {
+					ms.GCBytesAge += totalBytes * ageFactor(meta.Timestamp.WallTime, nowNanos)
+				}
+				if meta.Txn != nil {
+					ms.IntentBytes += totalBytes
+					ms.IntentCount++
+					ms.IntentAge += ageFactor(meta.Timestamp.WallTime, nowNanos)
+				}
+				if meta.KeyBytes != mvccVersionTimestampSize {
+					return ms, errors.Errorf("expected mvcc metadata key bytes to equal %d; got %d",
+						mvccVersionTimestampSize, meta.KeyBytes)
+				}
+				if meta.ValBytes != int64(len(value)) {
+					return ms, errors.Errorf("expected mvcc metadata val bytes to equal %d; got %d",
+						len(value), meta.ValBytes)
+				}
+			} else {
+				ms.GCBytesAge += totalBytes * ageFactor(key.Timestamp.WallTime, nowNanos)
+			}
+			ms.KeyBytes += mvccVersionTimestampSize
+			ms.ValBytes += int64(len(value))
+			ms.ValCount++
+		}
+	}
+
+	ms.LastUpdateNanos = nowNanos
+	return ms, nil
+}
+
+func goGetValue(snap gostore.Snapshot, key MVCCKey) ([]byte, error) {
+	if len(key.Key) == 0 {
+		return nil, emptyKeyError()
+	}
+	value, _ := snap.Get(encodeMVCCKey(key))
+	if len(value) == 0 {
+		return nil, nil
+	}
+	return append([]byte(nil), value...), nil
+}
+
+func goGetProto(
+	snap gostore.Snapshot, key MVCCKey, msg proto.Message,
+) (ok bool, keyBytes, valBytes int64, err error) {
+	if len(key.Key) == 0 {
+		err = emptyKeyError()
+		return
+	}
+	value, _ := snap.Get(encodeMVCCKey(key))
+	if len(value) == 0 {
+		msg.Reset()
+		return
+	}
+	ok = true
+	if msg != nil {
+		err = proto.Unmarshal(value, msg)
+	}
+	keyBytes = int64(key.EncodedSize())
+	valBytes = int64(len(value))
+	return
+}
+
+func goIterate(
+	it Iterator, start, end MVCCKey, f func(MVCCKeyValue) (bool, error),
+) error {
+	defer it.Close()
+	if !start.Less(end) {
+		return nil
+	}
+	it.Seek(start)
+	for ; it.Valid(); it.Next() {
+		k := it.Key()
+		if !k.Less(end) {
+			break
+		}
+		if done, err := f(MVCCKeyValue{Key: k, Value: it.Value()}); done || err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
+
+// batchOpWriter is the subset of Writer needed to replay the mutations in a
+// batch representation.
+type batchOpWriter interface {
+	Clear(key MVCCKey) error
+	ClearRange(start, end MVCCKey) error
+	Merge(key MVCCKey, value []byte) error
+	Put(key MVCCKey, value []byte) error
+}
+
+// replayBatchRepr applies the mutations in a batch representation to w, in
+// order. Keys and values passed to w point into repr.
+func replayBatchRepr(repr []byte, w batchOpWriter) error {
+	r, err := newRocksDBBatchReader(repr)
+	if err != nil {
+		return err
+	}
+	for r.Next() {
+		if r.typ == batchTypeLogData {
+			continue
+		}
+		key, err := decodeMVCCKey(r.key)
+		if err != nil {
+			return err
+		}
+		switch r.typ {
+		case batchTypeValue:
+			err = w.Put(key, r.value)
+		case batchTypeMerge:
+			err = w.Merge(key, r.value)
+		case batchTypeDeletion, batchTypeSingleDeletion:
+			err = w.Clear(key)
+		case batchTypeRangeDeletion:
+			var end MVCCKey
+			if end, err = decodeMVCCKey(r.value); err == nil {
+				err = w.ClearRange(key, end)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return r.Error()
+}
+
+// goBatchFromRepr converts a batch representation into a gostore batch.
+// The keys of the batch keep the encoding used in batch representations.
+func goBatchFromRepr(repr []byte) (*gostore.Batch, error) {
+	r, err := newRocksDBBatchReader(repr)
+	if err != nil {
+		return nil, err
+	}
+	var b gostore.Batch
+	for r.Next() {
+		if r.typ == batchTypeLogData {
+			continue
+		}
+		if _, err := decodeMVCCKey(r.key); err != nil {
+			return nil, err
+		}
+		switch r.typ {
+		case batchTypeValue:
+			b.Put(r.key, r.value)
+		case batchTypeMerge:
+			b.Merge(r.key, r.value)
+		case batchTypeDeletion, batchTypeSingleDeletion:
+			b.Delete(r.key)
+		case batchTypeRangeDeletion:
+			if _, err := decodeMVCCKey(r.value); err != nil {
+				return nil, err
+			}
+			b.DeleteRange(r.key, r.value)
+		}
+	}
+	if err := r.Error(); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// applyGoBatchRepr applies the mutations in a batch representation to snap
+// and returns the resulting snapshot. snap itself is left unmodified, so an
+// error leaves nothing applied.
+func applyGoBatchRepr(snap gostore.Snapshot, repr []byte) (gostore.Snapshot, error) {
+	b, err := goBatchFromRepr(repr)
+	if err != nil {
+		return gostore.Snapshot{}, err
+	}
+	return snap.Apply(b)
+}
+
+// encodeMVCCKey encodes key using the encoding used in batch
+// representations. See rocksDBBatchBuilder.encodeKey.
+func encodeMVCCKey(key MVCCKey) []byte {
+	timestampLength := 0
+	if key.Timestamp != hlc.ZeroTimestamp {
+		timestampLength = 1 + 8
+		if key.Timestamp.Logical != 0 {
+			timestampLength += 4
+		}
+	}
+	buf := make([]byte, len(key.Key)+timestampLength+1)
+	pos := copy(buf, key.Key)
+	if timestampLength > 0 {
+		buf[pos] = 0
+		binary.BigEndian.PutUint64(buf[pos+1:], uint64(key.Timestamp.WallTime))
+		if key.Timestamp.Logical != 0 {
+			binary.BigEndian.PutUint32(buf[pos+9:], uint32(key.Timestamp.Logical))
+		}
+	}
+	buf[len(buf)-1] = byte(timestampLength)
+	return buf
+}
+
+// mustDecodeMVCCKey decodes a key stored in a GoEngine. Keys are validated
+// before they are stored, so decoding cannot fail.
+func mustDecodeMVCCKey(encoded []byte) MVCCKey {
+	key, err := decodeMVCCKey(encoded)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// compareEncodedMVCCKeys compares encoded keys in the same order as
+// compareMVCCKeys. The timestamp of a version is encoded as a zero byte
+// followed by its big endian wall time and non-zero logical time, so newer
+// versions have larger encodings.
+func compareEncodedMVCCKeys(a, b []byte) int {
+	aKey, aTS := splitEncodedMVCCKey(a)
+	bKey, bTS := splitEncodedMVCCKey(b)
+	if c := bytes.Compare(aKey, bKey); c != 0 {
+		return c
+	}
+	switch {
+	case len(aTS) == 0 && len(bTS) == 0:
+		return 0
+	case len(aTS) == 0:
+		return -1
+	case len(bTS) == 0:
+		return 1
+	}
+	return bytes.Compare(bTS, aTS)
+}
+
+// splitEncodedMVCCKey splits an encoded key into its key and timestamp.
+func splitEncodedMVCCKey(encoded []byte) (key, ts []byte) {
+	if len(encoded) == 0 {
+		return nil, nil
+	}
+	tsLen := int(encoded[len(encoded)-1])
+	encoded = encoded[:len(encoded)-1]
+	if tsLen > len(encoded) {
+		tsLen = len(encoded)
+	}
+	return encoded[:len(encoded)-tsLen], encoded[len(encoded)-tsLen:]
+}
+
+// mergeEncodedMVCCKey merges operand into the existing value of an encoded
+// key using the merge semantics of the key.
+func mergeEncodedMVCCKey(encoded, existing, operand []byte) ([]byte, error) {
+	merged, err := gostore.MergeMVCCMetadata(existing, operand, lookupMergeOperator(encoded))
+	if err != nil {
+		return nil, errors.Wrapf(err, "merging %s", mustDecodeMVCCKey(encoded))
+	}
+	return merged, nil
+}
+
+// compareMVCCKeys compares keys in the same order as the RocksDB
+// comparator: by key, and then with the metadata key first followed by
+// versions from newest to oldest.
+func compareMVCCKeys(a, b MVCCKey) int {
+	if c := bytes.Compare(a.Key, b.Key); c != 0 {
+		return c
+	}
+	switch {
+	case a.Timestamp == b.Timestamp:
+		return 0
+	case !a.IsValue():
+		return -1
+	case !b.IsValue():
+		return 1
+	case b.Timestamp.Less(a.Timestamp):
+		return -1
+	}
+	return 1
+}
@@ -0,0 +1,108 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package gostore
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	opPut         byte = 1
+	opMerge       byte = 2
+	opDelete      byte = 3
+	opDeleteRange byte = 4
+)
+
+// A Batch is an ordered list of mutations which is applied atomically. Each
+// mutation is encoded as an op byte followed by the uvarint length prefixed
+// key and value. The value of a range deletion is its end key. The zero
+// value of a Batch is an empty batch ready to use.
+type Batch struct {
+	repr  []byte
+	count int
+}
+
+// Put sets key to value.
+func (b *Batch) Put(key, value []byte) {
+	b.add(opPut, key, value)
+}
+
+// Merge merges value into the existing value of key using the store's
+// merge function.
+func (b *Batch) Merge(key, value []byte) {
+	b.add(opMerge, key, value)
+}
+
+// Delete removes key.
+func (b *Batch) Delete(key []byte) {
+	b.add(opDelete, key, nil)
+}
+
+// DeleteRange removes the keys in [start,end).
+func (b *Batch) DeleteRange(start, end []byte) {
+	b.add(opDeleteRange, start, end)
+}
+
+// Count returns the number of mutations in the batch.
+func (b *Batch) Count() int {
+	return b.count
+}
+
+func (b *Batch) add(op byte, key, value []byte) {
+	var buf [binary.MaxVarintLen64]byte
+	b.repr = append(b.repr, op)
+	b.repr = append(b.repr, buf[:binary.PutUvarint(buf[:], uint64(len(key)))]...)
+	b.repr = append(b.repr, key...)
+	b.repr = append(b.repr, buf[:binary.PutUvarint(buf[:], uint64(len(value)))]...)
+	b.repr = append(b.repr, value...)
+	b.count++
+}
+
+// forEachOp invokes f on each of the mutations in repr, in order. The keys
+// and values passed to f point into repr.
+func forEachOp(repr []byte, f func(op byte, key, value []byte) error) error {
+	for len(repr) > 0 {
+		op := repr[0]
+		repr = repr[1:]
+		var key, value []byte
+		var err error
+		if key, repr, err = decodeBytes(repr); err != nil {
+			return err
+		}
+		if value, repr, err = decodeBytes(repr); err != nil {
+			return err
+		}
+		switch op {
+		case opPut, opMerge, opDelete, opDeleteRange:
+		default:
+			return errors.Errorf("unknown batch op %d", op)
+		}
+		if err := f(op, key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeBytes(buf []byte) ([]byte, []byte, error) {
+	n, size := binary.Uvarint(buf)
+	if size <= 0 || n > uint64(len(buf)-size) {
+		return nil, nil, errors.New("batch truncated")
+	}
+	end := size + int(n)
+	return buf[size:end], buf[end:], nil
+}
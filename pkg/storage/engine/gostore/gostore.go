@@ -0,0 +1,358 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package gostore implements an ordered key/value store entirely in Go. It
+// does not depend on cgo and backs engine.GoEngine, which adapts it to the
+// engine.Engine interface.
+//
+// The data is held in an immutable treap, so snapshots of the store can be
+// taken in constant time. A store with a directory persists its data as a
+// snapshot file holding the full contents of the store plus a log of the
+// batches applied since the snapshot was written. The snapshot is rewritten,
+// and the log truncated, when the log grows large and on Compact.
+package gostore
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+)
+
+const (
+	snapshotFilename     = "GOSTORE-SNAPSHOT"
+	snapshotFilenameTemp = "GOSTORE-SNAPSHOT-TEMP"
+	logFilename          = "GOSTORE-LOG"
+
+	// The snapshot file holds an 8-byte sequence number and a 4-byte
+	// checksum followed by a batch of puts. Each record in the log holds a
+	// 4-byte length and a 4-byte checksum followed by an 8-byte sequence
+	// number and a batch. The checksums cover everything following them and
+	// all integers are little endian.
+	snapshotHeaderSize = 12
+	logHeaderSize      = 8
+
+	// logCompactionThreshold is the size the log must reach, and exceed the
+	// size of the snapshot by, before the snapshot is rewritten.
+	logCompactionThreshold = 64 << 20
+)
+
+// ErrClosed is returned when a closed store is used.
+var ErrClosed = errors.New("store is closed")
+
+// Options holds the parameters used in opening a store.
+type Options struct {
+	// Dir is the directory the store persists its data to. An empty Dir
+	// creates an in-memory store.
+	Dir string
+	// Compare orders the keys of the store. It returns a negative number,
+	// zero or a positive number if a is less than, equal to or greater than
+	// b.
+	Compare func(a, b []byte) int
+	// Merge merges operand into the existing value of key, which is nil if
+	// key does not exist, and returns the new value. The store takes
+	// ownership of the returned slice. Merges are applied eagerly, so Merge
+	// must be deterministic for the log to be replayed correctly.
+	Merge func(key, existing, operand []byte) ([]byte, error)
+}
+
+// A DB is an ordered key/value store. It is safe for concurrent use.
+type DB struct {
+	opts Options
+
+	mu struct {
+		syncutil.Mutex
+		snap Snapshot
+		// seq is incremented by every write. It orders the records in the log
+		// with respect to the snapshot file and lets callers detect that a
+		// snapshot of the store is stale.
+		seq    uint64
+		closed bool
+		// The log file and sizes of the log and snapshot files. The log is nil
+		// for in-memory stores.
+		log          *os.File
+		logSize      int64
+		snapshotSize int64
+	}
+}
+
+// Open opens the store in opts.Dir, loading the data previously persisted
+// to it, or creates an in-memory store if opts.Dir is empty. The caller must
+// call the store's Close method when the store is no longer needed.
+func Open(opts Options) (*DB, error) {
+	db := &DB{opts: opts}
+	db.mu.snap = Snapshot{opts: &db.opts}
+	if len(opts.Dir) == 0 {
+		return db, nil
+	}
+
+	snap, seq, snapshotSize, err := db.readSnapshot(filepath.Join(opts.Dir, snapshotFilename))
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(opts.Dir, logFilename), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	snap, seq, logSize, err := replayLog(f, snap, seq)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	db.mu.snap = snap
+	db.mu.seq = seq
+	db.mu.log = f
+	db.mu.logSize = logSize
+	db.mu.snapshotSize = snapshotSize
+	return db, nil
+}
+
+// readSnapshot loads the snapshot file at the specified path, returning the
+// loaded data, the sequence number of the last write included in it and the
+// size of the file. A missing snapshot file is treated as an empty snapshot.
+func (db *DB) readSnapshot(path string) (Snapshot, uint64, int64, error) {
+	empty := Snapshot{opts: &db.opts}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return empty, 0, 0, nil
+		}
+		return Snapshot{}, 0, 0, err
+	}
+	if len(data) < snapshotHeaderSize {
+		return Snapshot{}, 0, 0, errors.Errorf("%s: snapshot truncated", path)
+	}
+	seq := binary.LittleEndian.Uint64(data[0:8])
+	repr := data[snapshotHeaderSize:]
+	if crc32.ChecksumIEEE(repr) != binary.LittleEndian.Uint32(data[8:12]) {
+		return Snapshot{}, 0, 0, errors.Errorf("%s: snapshot checksum mismatch", path)
+	}
+	snap, err := empty.applyRepr(repr)
+	if err != nil {
+		return Snapshot{}, 0, 0, errors.Wrapf(err, "%s: corrupted snapshot", path)
+	}
+	return snap, seq, int64(len(data)), nil
+}
+
+// replayLog applies the records in the log which were written after the
+// snapshot with the specified sequence number. A record which was only
+// partially written when the process exited, and anything after it, is
+// truncated from the log. The log is left positioned at its end.
+func replayLog(f *os.File, snap Snapshot, seq uint64) (Snapshot, uint64, int64, error) {
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return Snapshot{}, 0, 0, err
+	}
+	var offset int64
+	for len(data) >= logHeaderSize {
+		n := int(binary.LittleEndian.Uint32(data[0:4]))
+		if n < 8 || n > len(data)-logHeaderSize {
+			break
+		}
+		record := data[logHeaderSize : logHeaderSize+n]
+		if crc32.ChecksumIEEE(record) != binary.LittleEndian.Uint32(data[4:8]) {
+			break
+		}
+		if recordSeq := binary.LittleEndian.Uint64(record[0:8]); recordSeq > seq {
+			if snap, err = snap.applyRepr(record[8:]); err != nil {
+				return Snapshot{}, 0, 0, errors.Wrapf(err, "%s: corrupted log record", f.Name())
+			}
+			seq = recordSeq
+		}
+		data = data[logHeaderSize+n:]
+		offset += int64(logHeaderSize + n)
+	}
+	if len(data) > 0 {
+		log.Warningf(context.TODO(), "%s: truncating %d bytes of incomplete log records",
+			f.Name(), len(data))
+		if err := f.Truncate(offset); err != nil {
+			return Snapshot{}, 0, 0, err
+		}
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return Snapshot{}, 0, 0, err
+	}
+	return snap, seq, offset, nil
+}
+
+// writeSnapshot atomically replaces the snapshot file in dir with one
+// holding the data in snap.
+func writeSnapshot(dir string, snap Snapshot, seq uint64) (int64, error) {
+	var b Batch
+	snap.walk(b.Put)
+	data := make([]byte, snapshotHeaderSize+len(b.repr))
+	binary.LittleEndian.PutUint64(data[0:8], seq)
+	binary.LittleEndian.PutUint32(data[8:12], crc32.ChecksumIEEE(b.repr))
+	copy(data[snapshotHeaderSize:], b.repr)
+
+	tempFilename := filepath.Join(dir, snapshotFilenameTemp)
+	f, err := os.Create(tempFilename)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return 0, err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tempFilename, filepath.Join(dir, snapshotFilename)); err != nil {
+		return 0, err
+	}
+	return int64(len(data)), nil
+}
+
+// compactLocked rewrites the snapshot file to include all of the store's
+// data and truncates the log.
+func (db *DB) compactLocked() error {
+	if db.mu.log == nil {
+		return nil
+	}
+	size, err := writeSnapshot(db.opts.Dir, db.mu.snap, db.mu.seq)
+	if err != nil {
+		return errors.Wrapf(err, "could not write snapshot to %s", db.opts.Dir)
+	}
+	if err := db.mu.log.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := db.mu.log.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	db.mu.logSize = 0
+	db.mu.snapshotSize = size
+	return nil
+}
+
+// Apply atomically applies the mutations in b to the store and appends them
+// to the log. Nothing is applied if an error is returned.
+func (db *DB) Apply(b *Batch) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.mu.closed {
+		return ErrClosed
+	}
+	snap, err := db.mu.snap.Apply(b)
+	if err != nil {
+		return err
+	}
+	seq := db.mu.seq + 1
+	if db.mu.log != nil {
+		n := 8 + len(b.repr)
+		record := make([]byte, logHeaderSize+n)
+		binary.LittleEndian.PutUint32(record[0:4], uint32(n))
+		binary.LittleEndian.PutUint64(record[logHeaderSize:], seq)
+		copy(record[logHeaderSize+8:], b.repr)
+		binary.LittleEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(record[logHeaderSize:]))
+		if _, err := db.mu.log.Write(record); err != nil {
+			return errors.Wrap(err, "could not append to log")
+		}
+		db.mu.logSize += int64(len(record))
+	}
+	db.mu.snap = snap
+	db.mu.seq = seq
+
+	if db.mu.logSize > logCompactionThreshold && db.mu.logSize > db.mu.snapshotSize {
+		if err := db.compactLocked(); err != nil {
+			// The write is in the log, so it is durable regardless.
+			log.Warningf(context.TODO(), "%s: %s", db.opts.Dir, err)
+		}
+	}
+	return nil
+}
+
+// State returns a snapshot of the current contents of the store along with
+// its sequence number, which changes on every write.
+func (db *DB) State() (Snapshot, uint64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.mu.closed {
+		return Snapshot{}, 0, ErrClosed
+	}
+	return db.mu.snap, db.mu.seq, nil
+}
+
+// Compact rewrites the snapshot file and truncates the log.
+func (db *DB) Compact() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.mu.closed {
+		return ErrClosed
+	}
+	return db.compactLocked()
+}
+
+// Checkpoint writes a snapshot file holding the current contents of the
+// store to dir, which must exist. The checkpoint can be opened with Open.
+func (db *DB) Checkpoint(dir string) error {
+	snap, seq, err := db.State()
+	if err != nil {
+		return err
+	}
+	_, err = writeSnapshot(dir, snap, seq)
+	return err
+}
+
+// Sync syncs the log to disk.
+func (db *DB) Sync() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.mu.closed {
+		return ErrClosed
+	}
+	if db.mu.log == nil {
+		return nil
+	}
+	return db.mu.log.Sync()
+}
+
+// Close syncs and closes the log. Snapshots of the store remain usable.
+func (db *DB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.mu.closed {
+		return ErrClosed
+	}
+	db.mu.closed = true
+	db.mu.snap = Snapshot{}
+	if db.mu.log == nil {
+		return nil
+	}
+	f := db.mu.log
+	db.mu.log = nil
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return errors.Wrap(err, "could not sync log")
+	}
+	return errors.Wrap(f.Close(), "could not close log")
+}
+
+// Closed returns true if the store is closed.
+func (db *DB) Closed() bool {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.mu.closed
+}
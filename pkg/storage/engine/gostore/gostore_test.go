@@ -0,0 +1,165 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package gostore
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+)
+
+func testOptions(dir string) Options {
+	return Options{
+		Dir:     dir,
+		Compare: bytes.Compare,
+		Merge: func(key, existing, operand []byte) ([]byte, error) {
+			return append(append([]byte(nil), existing...), operand...), nil
+		},
+	}
+}
+
+func scan(t *testing.T, db *DB) []string {
+	snap, _, err := db.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kvs []string
+	for k, v, ok := snap.SeekGE(nil, true); ok; k, v, ok = snap.SeekGE(k, false) {
+		kvs = append(kvs, string(k)+"="+string(v))
+	}
+	return kvs
+}
+
+func TestStoreApply(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	db, err := Open(testOptions(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var b Batch
+	for _, k := range []string{"a", "b", "c", "d", "e"} {
+		b.Put([]byte(k), []byte(k))
+	}
+	b.Merge([]byte("a"), []byte("1"))
+	b.Merge([]byte("f"), []byte("2"))
+	b.Delete([]byte("e"))
+	b.DeleteRange([]byte("b"), []byte("d"))
+	if b.Count() != 9 {
+		t.Fatalf("expected 9 mutations, found %d", b.Count())
+	}
+
+	before, seq, err := db.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Apply(&b); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"a=a1", "d=d", "f=2"}; !reflect.DeepEqual(scan(t, db), expected) {
+		t.Errorf("expected %v, found %v", expected, scan(t, db))
+	}
+
+	// Snapshots taken before the batch was applied do not observe it.
+	if _, ok := before.Get([]byte("a")); ok {
+		t.Errorf("expected snapshot to not contain a")
+	}
+	if _, newSeq, _ := db.State(); newSeq != seq+1 {
+		t.Errorf("expected sequence number %d, found %d", seq+1, newSeq)
+	}
+
+	after, _, _ := db.State()
+	if k, _, ok := after.SeekLE([]byte("e"), true); !ok || string(k) != "d" {
+		t.Errorf("expected to find d, found %q", k)
+	}
+	if k, _, ok := after.SeekGE([]byte("f"), false); ok {
+		t.Errorf("expected to find nothing, found %q", k)
+	}
+	if k, _, ok := after.Last(); !ok || string(k) != "f" {
+		t.Errorf("expected to find f, found %q", k)
+	}
+}
+
+func TestStorePersistence(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	dir, err := ioutil.TempDir("", "TestStorePersistence")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	db, err := Open(testOptions(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, k := range []string{"a", "b", "c"} {
+		var b Batch
+		b.Put([]byte(k), []byte(k))
+		b.Merge([]byte("m"), []byte(k))
+		if err := db.Apply(&b); err != nil {
+			t.Fatal(err)
+		}
+		// Compact part way through so that the data is split between the
+		// snapshot file and the log.
+		if i == 1 {
+			if err := db.Compact(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Append a partially written record to the log, which should be
+	// truncated when the store is reopened.
+	f, err := os.OpenFile(filepath.Join(dir, logFilename), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte{20, 0, 0}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = Open(testOptions(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if expected := []string{"a=a", "b=b", "c=c", "m=abc"}; !reflect.DeepEqual(scan(t, db), expected) {
+		t.Errorf("expected %v, found %v", expected, scan(t, db))
+	}
+	var b Batch
+	b.Delete([]byte("a"))
+	if err := db.Apply(&b); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"b=b", "c=c", "m=abc"}; !reflect.DeepEqual(scan(t, db), expected) {
+		t.Errorf("expected %v, found %v", expected, scan(t, db))
+	}
+}
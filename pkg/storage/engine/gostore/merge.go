@@ -0,0 +1,187 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package gostore
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/storage/engine/enginepb"
+	"github.com/cockroachdb/cockroach/pkg/util/protoutil"
+)
+
+// A MergeFunc merges the raw bytes of two values using a registered merge
+// operator. existing is nil if the key does not have a value yet.
+type MergeFunc func(existing, operand []byte) ([]byte, error)
+
+// MergeMVCCMetadata merges operand into existing, both of which are marshaled
+// MVCCMetadata protos, and returns the marshaled result. If op is nil, the
+// built-in merge semantics are used: byte values are concatenated and time
+// series values are combined, keeping the most recently merged sample at
+// each offset. This is a port of MergeValues in db.cc, which implements
+// the same semantics for RocksDB, and the two must be kept in sync.
+func MergeMVCCMetadata(existing, operand []byte, op MergeFunc) ([]byte, error) {
+	var left, right enginepb.MVCCMetadata
+	if err := left.Unmarshal(existing); err != nil {
+		return nil, errors.Wrap(err, "corrupted existing value")
+	}
+	if err := right.Unmarshal(operand); err != nil {
+		return nil, errors.Wrap(err, "corrupted update value")
+	}
+	if err := mergeValues(&left, right, op); err != nil {
+		return nil, err
+	}
+	return protoutil.Marshal(&left)
+}
+
+func mergeValues(left *enginepb.MVCCMetadata, right enginepb.MVCCMetadata, op MergeFunc) error {
+	if op != nil {
+		result, err := op(left.RawBytes, right.RawBytes)
+		if err != nil {
+			return err
+		}
+		left.RawBytes = append([]byte{}, result...)
+		if right.MergeTimestamp != nil {
+			ts := *right.MergeTimestamp
+			left.MergeTimestamp = &ts
+		}
+		return nil
+	}
+	if left.RawBytes != nil {
+		if right.RawBytes == nil {
+			return errors.New("inconsistent value types for merge (left = bytes, right = ?)")
+		}
+		leftVal, rightVal := roachpb.Value{RawBytes: left.RawBytes}, roachpb.Value{RawBytes: right.RawBytes}
+		leftTS := leftVal.GetTag() == roachpb.ValueType_TIMESERIES
+		rightTS := rightVal.GetTag() == roachpb.ValueType_TIMESERIES
+		if leftTS || rightTS {
+			if !leftTS || !rightTS {
+				return errors.New("inconsistent value types for merging time series data (type(left) != type(right))")
+			}
+			merged, err := mergeTimeSeries(leftVal, rightVal)
+			if err != nil {
+				return err
+			}
+			left.RawBytes = merged
+			return nil
+		}
+		if len(right.RawBytes) > headerSize {
+			left.RawBytes = append(left.RawBytes, right.RawBytes[headerSize:]...)
+		}
+		return nil
+	}
+	left.RawBytes = append([]byte{}, right.RawBytes...)
+	if right.MergeTimestamp != nil {
+		ts := *right.MergeTimestamp
+		left.MergeTimestamp = &ts
+	}
+	if v := (roachpb.Value{RawBytes: left.RawBytes}); v.GetTag() == roachpb.ValueType_TIMESERIES {
+		// As in RocksDB, a value which can't be consolidated is kept as is.
+		if consolidated, err := consolidateTimeSeries(v); err == nil {
+			left.RawBytes = consolidated
+		}
+	}
+	return nil
+}
+
+// headerSize is the size of the checksum and tag which precede the data of
+// a roachpb.Value.
+const headerSize = 5
+
+// mergeTimeSeries merges two time series values which have the same start
+// timestamp and sample duration. The samples of left are assumed to be
+// sorted; only the last sample at each offset is kept, with the samples of
+// right merged after those of left.
+func mergeTimeSeries(left, right roachpb.Value) ([]byte, error) {
+	leftTS, err := left.GetTimeseries()
+	if err != nil {
+		return nil, errors.Wrap(err, "left InternalTimeSeriesData could not be parsed from bytes")
+	}
+	rightTS, err := right.GetTimeseries()
+	if err != nil {
+		return nil, errors.Wrap(err, "right InternalTimeSeriesData could not be parsed from bytes")
+	}
+	if leftTS.StartTimestampNanos != rightTS.StartTimestampNanos {
+		return nil, errors.New("time series merge failed due to mismatched start timestamps")
+	}
+	if leftTS.SampleDurationNanos != rightTS.SampleDurationNanos {
+		return nil, errors.New("time series merge failed due to mismatched sample durations")
+	}
+	sort.Stable(samplesByOffset(rightTS.Samples))
+
+	merged := roachpb.InternalTimeSeriesData{
+		StartTimestampNanos: leftTS.StartTimestampNanos,
+		SampleDurationNanos: leftTS.SampleDurationNanos,
+	}
+	l, r := leftTS.Samples, rightTS.Samples
+	for len(l) > 0 || len(r) > 0 {
+		var offset int32
+		switch {
+		case len(l) == 0:
+			offset = r[0].Offset
+		case len(r) == 0:
+			offset = l[0].Offset
+		case l[0].Offset <= r[0].Offset:
+			offset = l[0].Offset
+		default:
+			offset = r[0].Offset
+		}
+		var sample roachpb.InternalTimeSeriesSample
+		for ; len(l) > 0 && l[0].Offset == offset; l = l[1:] {
+			sample = l[0]
+		}
+		for ; len(r) > 0 && r[0].Offset == offset; r = r[1:] {
+			sample = r[0]
+		}
+		merged.Samples = append(merged.Samples, sample)
+	}
+	return marshalTimeSeries(merged)
+}
+
+// consolidateTimeSeries sorts the samples of a single time series value,
+// keeping only the last of the samples with the same offset.
+func consolidateTimeSeries(v roachpb.Value) ([]byte, error) {
+	ts, err := v.GetTimeseries()
+	if err != nil {
+		return nil, err
+	}
+	sort.Stable(samplesByOffset(ts.Samples))
+	var samples []roachpb.InternalTimeSeriesSample
+	for _, s := range ts.Samples {
+		if n := len(samples); n > 0 && samples[n-1].Offset == s.Offset {
+			samples[n-1] = s
+		} else {
+			samples = append(samples, s)
+		}
+	}
+	ts.Samples = samples
+	return marshalTimeSeries(ts)
+}
+
+func marshalTimeSeries(ts roachpb.InternalTimeSeriesData) ([]byte, error) {
+	var v roachpb.Value
+	if err := v.SetProto(&ts); err != nil {
+		return nil, err
+	}
+	return v.RawBytes, nil
+}
+
+type samplesByOffset []roachpb.InternalTimeSeriesSample
+
+func (s samplesByOffset) Len() int           { return len(s) }
+func (s samplesByOffset) Less(i, j int) bool { return s[i].Offset < s[j].Offset }
+func (s samplesByOffset) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,239 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package gostore
+
+import (
+	"math/rand"
+
+	"github.com/pkg/errors"
+)
+
+// A Snapshot is an immutable view of the contents of a store. Snapshots are
+// cheap to copy and remain valid after the store is modified or closed.
+type Snapshot struct {
+	root *node
+	opts *Options
+}
+
+// Get returns the value of key and whether the key exists.
+func (s Snapshot) Get(key []byte) ([]byte, bool) {
+	n := s.root
+	for n != nil {
+		cmp := s.opts.Compare(key, n.key)
+		if cmp == 0 {
+			return n.value, true
+		}
+		if cmp < 0 {
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+	return nil, false
+}
+
+// SeekGE returns the entry with the smallest key greater than key, or
+// greater than or equal to key if inclusive is set. ok is false if there is
+// no such entry. The returned key and value must not be modified.
+func (s Snapshot) SeekGE(key []byte, inclusive bool) (k, v []byte, ok bool) {
+	var res *node
+	for n := s.root; n != nil; {
+		cmp := s.opts.Compare(n.key, key)
+		if cmp > 0 || (inclusive && cmp == 0) {
+			res = n
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+	return res.entry()
+}
+
+// SeekLE returns the entry with the largest key less than key, or less than
+// or equal to key if inclusive is set. ok is false if there is no such
+// entry. The returned key and value must not be modified.
+func (s Snapshot) SeekLE(key []byte, inclusive bool) (k, v []byte, ok bool) {
+	var res *node
+	for n := s.root; n != nil; {
+		cmp := s.opts.Compare(n.key, key)
+		if cmp < 0 || (inclusive && cmp == 0) {
+			res = n
+			n = n.right
+		} else {
+			n = n.left
+		}
+	}
+	return res.entry()
+}
+
+// Last returns the entry with the largest key. ok is false if the snapshot
+// is empty.
+func (s Snapshot) Last() (k, v []byte, ok bool) {
+	n := s.root
+	for n != nil && n.right != nil {
+		n = n.right
+	}
+	return n.entry()
+}
+
+// Apply returns a snapshot holding the contents of s with the mutations in
+// b applied. s itself is not modified, so an error leaves nothing applied.
+func (s Snapshot) Apply(b *Batch) (Snapshot, error) {
+	return s.applyRepr(b.repr)
+}
+
+func (s Snapshot) applyRepr(repr []byte) (Snapshot, error) {
+	root := s.root
+	err := forEachOp(repr, func(op byte, key, value []byte) error {
+		switch op {
+		case opPut:
+			root = s.put(root, key, append([]byte(nil), value...))
+		case opMerge:
+			existing, _ := Snapshot{root: root, opts: s.opts}.Get(key)
+			merged, err := s.opts.Merge(key, existing, value)
+			if err != nil {
+				return err
+			}
+			root = s.put(root, key, merged)
+		case opDelete:
+			root = s.delete(root, key)
+		case opDeleteRange:
+			left, rest := s.split(root, key)
+			_, right := s.split(rest, value)
+			root = join(left, right)
+		}
+		return nil
+	})
+	if err != nil {
+		return Snapshot{}, errors.Wrap(err, "could not apply batch")
+	}
+	return Snapshot{root: root, opts: s.opts}, nil
+}
+
+// walk invokes f on the entries of the snapshot in key order.
+func (s Snapshot) walk(f func(key, value []byte)) {
+	var walk func(n *node)
+	walk = func(n *node) {
+		for n != nil {
+			walk(n.left)
+			f(n.key, n.value)
+			n = n.right
+		}
+	}
+	walk(s.root)
+}
+
+// node is a node in an immutable treap. Nodes are never modified once they
+// are reachable from a root, so holding on to a root captures the state of
+// the treap: mutations copy the nodes on the path to the nodes they change.
+type node struct {
+	key, value  []byte
+	priority    uint32
+	left, right *node
+}
+
+func (n *node) entry() (k, v []byte, ok bool) {
+	if n == nil {
+		return nil, nil, false
+	}
+	return n.key, n.value, true
+}
+
+// put sets key to value in the treap rooted at n, taking ownership of value
+// and copying key.
+func (s Snapshot) put(n *node, key, value []byte) *node {
+	return s.insert(s.delete(n, key), &node{
+		key:      append([]byte(nil), key...),
+		value:    value,
+		priority: rand.Uint32(),
+	})
+}
+
+// split splits the treap rooted at n into a treap holding the keys less
+// than key and a treap holding the remaining keys.
+func (s Snapshot) split(n *node, key []byte) (*node, *node) {
+	if n == nil {
+		return nil, nil
+	}
+	c := *n
+	if s.opts.Compare(n.key, key) < 0 {
+		var right *node
+		c.right, right = s.split(n.right, key)
+		return &c, right
+	}
+	var left *node
+	left, c.left = s.split(n.left, key)
+	return left, &c
+}
+
+// join joins two treaps, all of whose keys in a are less than those in b.
+func join(a, b *node) *node {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	if a.priority > b.priority {
+		c := *a
+		c.right = join(a.right, b)
+		return &c
+	}
+	c := *b
+	c.left = join(a, b.left)
+	return &c
+}
+
+// insert inserts a new node into the treap rooted at n, which must not
+// contain the node's key.
+func (s Snapshot) insert(n *node, nn *node) *node {
+	if n == nil {
+		return nn
+	}
+	if nn.priority > n.priority {
+		nn.left, nn.right = s.split(n, nn.key)
+		return nn
+	}
+	c := *n
+	if s.opts.Compare(nn.key, n.key) < 0 {
+		c.left = s.insert(n.left, nn)
+	} else {
+		c.right = s.insert(n.right, nn)
+	}
+	return &c
+}
+
+// delete removes key from the treap rooted at n. The treap is returned
+// unmodified if it does not contain key.
+func (s Snapshot) delete(n *node, key []byte) *node {
+	if n == nil {
+		return nil
+	}
+	cmp := s.opts.Compare(key, n.key)
+	if cmp == 0 {
+		return join(n.left, n.right)
+	}
+	c := *n
+	if cmp < 0 {
+		if c.left = s.delete(n.left, key); c.left == n.left {
+			return n
+		}
+	} else {
+		if c.right = s.delete(n.right, key); c.right == n.right {
+			return n
+		}
+	}
+	return &c
+}
@@ -17,13 +17,164 @@
 package engine
 
 import (
+	"bytes"
+	"fmt"
+
 	"github.com/gogo/protobuf/proto"
+	"github.com/pkg/errors"
 
+	"github.com/cockroachdb/cockroach/pkg/keys"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/storage/engine/enginepb"
+	"github.com/cockroachdb/cockroach/pkg/storage/engine/gostore"
+	"github.com/cockroachdb/cockroach/pkg/storage/engine/rocksdb"
 	"github.com/cockroachdb/cockroach/pkg/util/protoutil"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
 )
 
+// MergeOperator defines the semantics of merges to keys with a given
+// prefix. Merges are applied independently by every replica of a range and
+// at different times (when the key is read and when sstables are compacted),
+// so Merge must be deterministic and associative, and every node in a
+// cluster must register the same operators for the same prefixes.
+//
+// Merges are not protected against replays (see the replay advisory in
+// db.cc): a merge which is replayed by raft or retried by a client after an
+// ambiguous error is merged again. An operator must either tolerate that or
+// deduplicate its operands itself.
+type MergeOperator interface {
+	// Merge returns the result of merging operand into existing. existing
+	// has no RawBytes if the key does not have a value yet.
+	Merge(existing, operand roachpb.Value) (roachpb.Value, error)
+}
+
+// mergeOperators is the registry of merge operators. An operator's ID is
+// its index in ops.
+var mergeOperators struct {
+	syncutil.Mutex
+	prefixes []roachpb.Key
+	ops      []MergeOperator
+	// frozen is set once the first engine is opened, after which no more
+	// operators can be registered.
+	frozen bool
+}
+
+func init() {
+	rocksdb.Merge = mergeRegistered
+}
+
+// RegisterMergeOperator registers op as the merge operator for all keys with
+// the specified prefix. Keys without a registered prefix use the built-in
+// merge semantics, which concatenate byte values and combine time series
+// data. RegisterMergeOperator must be called before any engine is opened,
+// typically from an init function, and panics if prefix overlaps the prefix
+// of a previously registered operator.
+func RegisterMergeOperator(prefix roachpb.Key, op MergeOperator) {
+	mergeOperators.Lock()
+	defer mergeOperators.Unlock()
+	if mergeOperators.frozen {
+		panic("merge operators must be registered before any engine is opened")
+	}
+	if len(prefix) == 0 {
+		panic("cannot register a merge operator for an empty prefix")
+	}
+	for _, p := range mergeOperators.prefixes {
+		if bytes.HasPrefix(prefix, p) || bytes.HasPrefix(p, prefix) {
+			panic(fmt.Sprintf("merge operator prefix %s overlaps registered prefix %s", prefix, p))
+		}
+	}
+	mergeOperators.prefixes = append(mergeOperators.prefixes, prefix)
+	mergeOperators.ops = append(mergeOperators.ops, op)
+	setMergeOperatorPrefixes(mergeOperators.prefixes)
+}
+
+// freezeMergeOperators prevents any further merge operators from being
+// registered. Registering an operator once RocksDB may be running merges
+// would let replicas disagree about the result of a merge.
+func freezeMergeOperators() {
+	mergeOperators.Lock()
+	mergeOperators.frozen = true
+	mergeOperators.Unlock()
+}
+
+// lookupMergeOperator returns the merge function of the operator registered
+// for the prefix of the specified encoded key, or nil if the key uses the
+// built-in merge semantics.
+func lookupMergeOperator(encoded []byte) gostore.MergeFunc {
+	mergeOperators.Lock()
+	defer mergeOperators.Unlock()
+	for id, prefix := range mergeOperators.prefixes {
+		if bytes.HasPrefix(encoded, prefix) {
+			return func(existing, operand []byte) ([]byte, error) {
+				return mergeRegistered(id, existing, operand)
+			}
+		}
+	}
+	return nil
+}
+
+// mergeRegistered merges the raw bytes of two MVCC values using the merge
+// operator with the specified ID. It is invoked by RocksDB.
+func mergeRegistered(id int, existing, operand []byte) ([]byte, error) {
+	mergeOperators.Lock()
+	var op MergeOperator
+	if id >= 0 && id < len(mergeOperators.ops) {
+		op = mergeOperators.ops[id]
+	}
+	mergeOperators.Unlock()
+	if op == nil {
+		return nil, errors.Errorf("unknown merge operator %d", id)
+	}
+	result, err := op.Merge(roachpb.Value{RawBytes: existing}, roachpb.Value{RawBytes: operand})
+	if err != nil {
+		return nil, err
+	}
+	return result.RawBytes, nil
+}
+
+// CounterMergeOperator is a MergeOperator for integer values which sums the
+// merged values. A replayed merge adds its delta again, so the resulting
+// counts are only approximate.
+type CounterMergeOperator struct{}
+
+// Merge implements the MergeOperator interface.
+func (CounterMergeOperator) Merge(existing, operand roachpb.Value) (roachpb.Value, error) {
+	delta, err := operand.GetInt()
+	if err != nil {
+		return roachpb.Value{}, err
+	}
+	var sum int64
+	if existing.RawBytes != nil {
+		if sum, err = existing.GetInt(); err != nil {
+			return roachpb.Value{}, err
+		}
+	}
+	var result roachpb.Value
+	result.SetInt(sum + delta)
+	return result, nil
+}
+
+// AppendMergeOperator is a MergeOperator for byte values which appends the
+// merged values, for use as an append-only log.
+type AppendMergeOperator struct{}
+
+// Merge implements the MergeOperator interface.
+func (AppendMergeOperator) Merge(existing, operand roachpb.Value) (roachpb.Value, error) {
+	data, err := operand.GetBytes()
+	if err != nil {
+		return roachpb.Value{}, err
+	}
+	var prev []byte
+	if existing.RawBytes != nil {
+		if prev, err = existing.GetBytes(); err != nil {
+			return roachpb.Value{}, err
+		}
+	}
+	var result roachpb.Value
+	result.SetBytes(append(append([]byte(nil), prev...), data...))
+	return result, nil
+}
+
 // MergeInternalTimeSeriesData exports the engine's C++ merge logic for
 // InternalTimeSeriesData to higher level packages. This is intended primarily
 // for consumption by high level testing of time series functionality.
@@ -53,7 +204,7 @@ func MergeInternalTimeSeriesData(
 		err         error
 	)
 	for _, bytes := range srcBytes {
-		mergedBytes, err = goMerge(mergedBytes, bytes)
+		mergedBytes, err = goMerge(keys.TimeseriesPrefix, mergedBytes, bytes)
 		if err != nil {
 			return roachpb.InternalTimeSeriesData{}, err
 		}
@@ -18,19 +18,56 @@
 package engine
 
 import (
+	"fmt"
 	"math"
 	"math/rand"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/gogo/protobuf/proto"
+	"golang.org/x/net/context"
 
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/storage/engine/enginepb"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/cockroachdb/cockroach/pkg/util/protoutil"
 )
 
+var (
+	counterMergePrefix = roachpb.Key("/merge-counter/")
+	appendMergePrefix  = roachpb.Key("/merge-append/")
+)
+
+// swapMergeOperators replaces the registered merge operators for the
+// duration of a test, returning a function which restores the previous
+// registry. Unlike RegisterMergeOperator it may be called after engines have
+// been opened.
+func swapMergeOperators(prefixes []roachpb.Key, ops []MergeOperator) func() {
+	mergeOperators.Lock()
+	defer mergeOperators.Unlock()
+	oldPrefixes, oldOps, oldFrozen := mergeOperators.prefixes, mergeOperators.ops, mergeOperators.frozen
+	mergeOperators.prefixes, mergeOperators.ops, mergeOperators.frozen = prefixes, ops, false
+	setMergeOperatorPrefixes(prefixes)
+	return func() {
+		mergeOperators.Lock()
+		defer mergeOperators.Unlock()
+		mergeOperators.prefixes, mergeOperators.ops = oldPrefixes, oldOps
+		mergeOperators.frozen = mergeOperators.frozen || oldFrozen
+		setMergeOperatorPrefixes(oldPrefixes)
+	}
+}
+
+// registerTestMergeOperators registers a counter and an append merge operator
+// for the duration of a test.
+func registerTestMergeOperators() func() {
+	return swapMergeOperators(
+		[]roachpb.Key{counterMergePrefix, appendMergePrefix},
+		[]MergeOperator{CounterMergeOperator{}, AppendMergeOperator{}},
+	)
+}
+
 var testtime = int64(-446061360000000000)
 
 type tsSample struct {
@@ -95,10 +132,31 @@ func timeSeriesAsValue(start int64, duration int64, samples ...tsSample) roachpb
 	return v
 }
 
-// TestGoMerge tests the function goMerge but not the integration with
+// mergeImpls are the implementations of the merge semantics: RocksDB's,
+// which goMerge calls through cgo, and the port in gostore used by the
+// GoEngine.
+var mergeImpls = []struct {
+	name  string
+	merge func(key roachpb.Key, existing, update []byte) ([]byte, error)
+}{
+	{"rocksdb", goMerge},
+	{"gostore", func(key roachpb.Key, existing, update []byte) ([]byte, error) {
+		return mergeEncodedMVCCKey(encodeMVCCKey(MakeMVCCMetadataKey(key)), existing, update)
+	}},
+}
+
+// TestGoMerge tests the merge implementations but not the integration with
 // the storage engines. For that, see the engine tests.
 func TestGoMerge(t *testing.T) {
 	defer leaktest.AfterTest(t)()
+	for _, impl := range mergeImpls {
+		t.Run(impl.name, func(t *testing.T) {
+			testMerge(t, impl.merge)
+		})
+	}
+}
+
+func testMerge(t *testing.T, merge func(key roachpb.Key, existing, update []byte) ([]byte, error)) {
 	// Let's start with stuff that should go wrong.
 	badCombinations := []struct {
 		existing, update []byte
@@ -140,9 +198,9 @@ func TestGoMerge(t *testing.T) {
 		},
 	}
 	for i, c := range badCombinations {
-		_, err := goMerge(c.existing, c.update)
+		_, err := merge(roachpb.Key("a"), c.existing, c.update)
 		if err == nil {
-			t.Errorf("goMerge: %d: expected error", i)
+			t.Errorf("merge: %d: expected error", i)
 		}
 	}
 
@@ -160,9 +218,9 @@ func TestGoMerge(t *testing.T) {
 	}
 
 	for i, c := range testCasesAppender {
-		result, err := goMerge(c.existing, c.update)
+		result, err := merge(roachpb.Key("a"), c.existing, c.update)
 		if err != nil {
-			t.Errorf("goMerge error: %d: %v", i, err)
+			t.Errorf("merge error: %d: %v", i, err)
 			continue
 		}
 		var resultV, expectedV enginepb.MVCCMetadata
@@ -173,7 +231,7 @@ func TestGoMerge(t *testing.T) {
 			t.Fatal(err)
 		}
 		if !reflect.DeepEqual(resultV, expectedV) {
-			t.Errorf("goMerge error: %d: want %+v, got %+v", i, expectedV, resultV)
+			t.Errorf("merge error: %d: want %+v, got %+v", i, expectedV, resultV)
 		}
 	}
 
@@ -262,16 +320,16 @@ func TestGoMerge(t *testing.T) {
 		expectedTS := unmarshalTimeSeries(t, c.expected)
 		updateTS := unmarshalTimeSeries(t, c.update)
 
-		// Directly test the C++ implementation of merging using goMerge.  goMerge
-		// operates directly on marshalled bytes.
-		result, err := goMerge(c.existing, c.update)
+		// Directly test the implementation of merging, which operates on
+		// marshalled bytes.
+		result, err := merge(roachpb.Key("a"), c.existing, c.update)
 		if err != nil {
-			t.Errorf("goMerge error on case %d: %s", i, err.Error())
+			t.Errorf("merge error on case %d: %s", i, err.Error())
 			continue
 		}
 		resultTS := unmarshalTimeSeries(t, result)
 		if a, e := resultTS, expectedTS; !reflect.DeepEqual(a, e) {
-			t.Errorf("goMerge returned wrong result on case %d: expected %v, returned %v", i, e, a)
+			t.Errorf("merge returned wrong result on case %d: expected %v, returned %v", i, e, a)
 		}
 
 		// Test the MergeInternalTimeSeriesData method separately.
@@ -306,3 +364,116 @@ func unmarshalTimeSeries(t testing.TB, b []byte) roachpb.InternalTimeSeriesData
 	}
 	return valueTS
 }
+
+// TestRegisteredMergeOperators verifies that merges to keys with a registered
+// prefix use the registered operator, both when the operands are merged on
+// read and when they are merged by a compaction.
+func TestRegisteredMergeOperators(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer registerTestMergeOperators()()
+	engine := NewInMem(roachpb.Attributes{}, 1<<20)
+	defer engine.Close()
+	ctx := context.Background()
+
+	counterKey := append(counterMergePrefix[:len(counterMergePrefix):len(counterMergePrefix)], 'a')
+	appendKey := append(appendMergePrefix[:len(appendMergePrefix):len(appendMergePrefix)], 'a')
+	for _, delta := range []int64{5, -2, 10} {
+		var v roachpb.Value
+		v.SetInt(delta)
+		if err := MVCCMerge(ctx, engine, nil, counterKey, hlc.ZeroTimestamp, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, entry := range []string{"a", "b", "c"} {
+		if err := MVCCMerge(ctx, engine, nil, appendKey, hlc.ZeroTimestamp,
+			roachpb.MakeValueFromString(entry)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	verify := func() {
+		v, _, err := MVCCGet(ctx, engine, counterKey, hlc.ZeroTimestamp, true, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sum, err := v.GetInt(); err != nil {
+			t.Fatal(err)
+		} else if sum != 13 {
+			t.Errorf("expected counter to be 13, found %d", sum)
+		}
+		v, _, err = MVCCGet(ctx, engine, appendKey, hlc.ZeroTimestamp, true, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b, err := v.GetBytes(); err != nil {
+			t.Fatal(err)
+		} else if string(b) != "abc" {
+			t.Errorf("expected log to be %q, found %q", "abc", b)
+		}
+	}
+	verify()
+	if err := engine.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	verify()
+}
+
+func TestRegisterMergeOperatorPanics(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer registerTestMergeOperators()()
+
+	expectPanic := func(prefix roachpb.Key, expected string) {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Errorf("%q: expected panic", prefix)
+			} else if !strings.Contains(fmt.Sprint(r), expected) {
+				t.Errorf("%q: expected panic %q, found %q", prefix, expected, r)
+			}
+		}()
+		RegisterMergeOperator(prefix, CounterMergeOperator{})
+	}
+	// Each prefix duplicates or extends a registered prefix or is empty.
+	expectPanic(counterMergePrefix, "overlaps")
+	expectPanic(append(counterMergePrefix[:len(counterMergePrefix):len(counterMergePrefix)], 'x'), "overlaps")
+	expectPanic(roachpb.Key(nil), "empty prefix")
+
+	// Opening an engine prevents any further registrations.
+	NewInMem(roachpb.Attributes{}, 1<<20).Close()
+	expectPanic(roachpb.Key("/merge-other/"), "before any engine is opened")
+}
+
+// TestRegisteredMergeOperatorMissingValue verifies that a merge operator is
+// passed a nil existing value when a key does not have a value yet.
+func TestRegisteredMergeOperatorMissingValue(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	prefix := roachpb.Key("/merge-missing/")
+	var sawNil []bool
+	defer swapMergeOperators([]roachpb.Key{prefix}, []MergeOperator{
+		mergeOperatorFunc(func(existing, operand roachpb.Value) (roachpb.Value, error) {
+			sawNil = append(sawNil, existing.RawBytes == nil)
+			return operand, nil
+		}),
+	})()
+
+	key := append(prefix[:len(prefix):len(prefix)], 'a')
+	existing := mustMarshal(&enginepb.MVCCMetadata{RawBytes: roachpb.MakeValueFromString("a").RawBytes})
+	update := mustMarshal(&enginepb.MVCCMetadata{RawBytes: roachpb.MakeValueFromString("b").RawBytes})
+	for _, impl := range mergeImpls {
+		sawNil = nil
+		if _, err := impl.merge(key, nil, update); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := impl.merge(key, existing, update); err != nil {
+			t.Fatal(err)
+		}
+		if expected := []bool{true, false}; !reflect.DeepEqual(sawNil, expected) {
+			t.Errorf("%s: expected nil existing values %v, found %v", impl.name, expected, sawNil)
+		}
+	}
+}
+
+type mergeOperatorFunc func(existing, operand roachpb.Value) (roachpb.Value, error)
+
+func (f mergeOperatorFunc) Merge(existing, operand roachpb.Value) (roachpb.Value, error) {
+	return f(existing, operand)
+}
@@ -1341,7 +1341,8 @@ func MVCCMerge(
 	// Encode and merge the MVCC metadata with inlined value.
 	meta := &buf.meta
 	*meta = enginepb.MVCCMetadata{RawBytes: rawBytes}
-	// If non-zero, set the merge timestamp to provide some replay protection.
+	// If non-zero, record the merge timestamp. Note that this does not protect
+	// against replays; see the replay advisory in db.cc.
 	if !timestamp.Equal(hlc.ZeroTimestamp) {
 		buf.ts = timestamp
 		meta.MergeTimestamp = &buf.ts
@@ -1357,6 +1358,30 @@ func MVCCMerge(
 	return err
 }
 
+// MVCCClearRange removes all versions of all keys in the span [key, endKey)
+// using a single range deletion tombstone rather than issuing a delete per key.
+// Unlike MVCCDeleteRange, no MVCC deletion tombstones are written; the data is
+// simply gone. If ms is not nil, the stats for the span are computed before the
+// deletion and subtracted from ms, which is coarser than the per-key accounting
+// performed by the other MVCC operations but avoids touching every key twice.
+func MVCCClearRange(
+	engine ReadWriter, ms *enginepb.MVCCStats, key, endKey roachpb.Key, nowNanos int64,
+) error {
+	start, end := MakeMVCCMetadataKey(key), MakeMVCCMetadataKey(endKey)
+	if ms != nil {
+		// The stats must be computed before the tombstone is written as a batch
+		// containing a range deletion cannot be read from.
+		iter := engine.NewIterator(false)
+		delta, err := iter.ComputeStats(start, end, nowNanos)
+		iter.Close()
+		if err != nil {
+			return err
+		}
+		ms.Subtract(delta)
+	}
+	return engine.ClearRange(start, end)
+}
+
 // MVCCDeleteRange deletes the range of key/value pairs specified by start and
 // end keys. It returns the range of keys deleted when returnedKeys is set,
 // the next span to resume from, and the number of keys deleted.
@@ -1477,13 +1502,15 @@ func getReverseScanMeta(
 
 // mvccScanInternal scans the key range [start,end) up to some maximum number
 // of results. Specify reverse=true to scan in descending instead of ascending
-// order.
+// order. If targetBytes is positive, the scan also stops once the size of the
+// returned keys and values reaches targetBytes.
 func mvccScanInternal(
 	ctx context.Context,
 	engine Reader,
 	key,
 	endKey roachpb.Key,
 	max int64,
+	targetBytes int64,
 	timestamp hlc.Timestamp,
 	consistent bool,
 	txn *roachpb.Transaction,
@@ -1495,10 +1522,17 @@ func mvccScanInternal(
 	}
 
 	var resumeSpan *roachpb.Span
-	intents, err := MVCCIterate(ctx, engine, key, endKey, timestamp, consistent, txn, reverse,
+	var numBytes int64
+	// A forward scan over a single user key can use a prefix iterator which
+	// allows RocksDB to consult the bloom filters and skip sstables that don't
+	// contain the key. Prefix iteration doesn't work correctly across keys
+	// with different user-key prefixes, so it can't be used for larger spans
+	// or in reverse.
+	prefix := !reverse && isSingleKeySpan(key, endKey)
+	intents, err := mvccIterateInternal(ctx, engine, key, endKey, timestamp, consistent, txn, reverse, prefix,
 		func(kv roachpb.KeyValue) (bool, error) {
-			if int64(len(res)) == max {
-				// Another key was found beyond the max limit.
+			if int64(len(res)) == max || (targetBytes > 0 && numBytes >= targetBytes) {
+				// Another key was found beyond the max or target bytes limit.
 				if reverse {
 					resumeSpan = &roachpb.Span{Key: key, EndKey: kv.Key.Next()}
 				} else {
@@ -1507,6 +1541,7 @@ func mvccScanInternal(
 				return true, nil
 			}
 			res = append(res, kv)
+			numBytes += int64(len(kv.Key) + len(kv.Value.RawBytes))
 			return false, nil
 		})
 
@@ -1529,7 +1564,7 @@ func MVCCScan(
 	consistent bool,
 	txn *roachpb.Transaction,
 ) ([]roachpb.KeyValue, *roachpb.Span, []roachpb.Intent, error) {
-	return mvccScanInternal(ctx, engine, key, endKey, max, timestamp,
+	return mvccScanInternal(ctx, engine, key, endKey, max, 0 /* targetBytes */, timestamp,
 		consistent, txn, false /* !reverse */)
 }
 
@@ -1546,10 +1581,39 @@ func MVCCReverseScan(
 	consistent bool,
 	txn *roachpb.Transaction,
 ) ([]roachpb.KeyValue, *roachpb.Span, []roachpb.Intent, error) {
-	return mvccScanInternal(ctx, engine, key, endKey, max, timestamp,
+	return mvccScanInternal(ctx, engine, key, endKey, max, 0 /* targetBytes */, timestamp,
 		consistent, txn, true /* reverse */)
 }
 
+// MVCCScanWithTargetBytes is like MVCCScan, or MVCCReverseScan if reverse is
+// true, but additionally stops once the accumulated size of the returned keys
+// and values reaches targetBytes. At least one result is returned even if it
+// alone exceeds the target, so that a caller paging through the key range
+// always makes progress. A targetBytes of zero disables the limit. If the scan
+// stops early, it returns a span to be used in the next call.
+func MVCCScanWithTargetBytes(
+	ctx context.Context,
+	engine Reader,
+	key,
+	endKey roachpb.Key,
+	max int64,
+	targetBytes int64,
+	timestamp hlc.Timestamp,
+	consistent bool,
+	txn *roachpb.Transaction,
+	reverse bool,
+) ([]roachpb.KeyValue, *roachpb.Span, []roachpb.Intent, error) {
+	return mvccScanInternal(ctx, engine, key, endKey, max, targetBytes, timestamp,
+		consistent, txn, reverse)
+}
+
+// isSingleKeySpan returns true if the span [startKey,endKey) contains at most
+// a single user key (i.e. endKey is startKey.Next()).
+func isSingleKeySpan(startKey, endKey roachpb.Key) bool {
+	return len(endKey) == len(startKey)+1 && endKey[len(startKey)] == 0 &&
+		bytes.Equal(startKey, endKey[:len(startKey)])
+}
+
 // MVCCIterate iterates over the key range [start,end). At each step of the
 // iteration, f() is invoked with the current key/value pair. If f returns
 // true (done) or an error, the iteration stops and the error is propagated.
@@ -1564,6 +1628,25 @@ func MVCCIterate(
 	txn *roachpb.Transaction,
 	reverse bool,
 	f func(roachpb.KeyValue) (bool, error),
+) ([]roachpb.Intent, error) {
+	return mvccIterateInternal(ctx, engine, startKey, endKey, timestamp, consistent, txn, reverse,
+		false /* !prefix */, f)
+}
+
+// mvccIterateInternal is like MVCCIterate, but iterates using a prefix
+// iterator if prefix is true. Callers must not already hold a prefix iterator
+// on the engine, which for batches can only have a single one open at a time.
+func mvccIterateInternal(
+	ctx context.Context,
+	engine Reader,
+	startKey,
+	endKey roachpb.Key,
+	timestamp hlc.Timestamp,
+	consistent bool,
+	txn *roachpb.Transaction,
+	reverse bool,
+	prefix bool,
+	f func(roachpb.KeyValue) (bool, error),
 ) ([]roachpb.Intent, error) {
 	if !consistent && txn != nil {
 		return nil, errors.Errorf("cannot allow inconsistent reads within a transaction")
@@ -1595,7 +1678,7 @@ func MVCCIterate(
 	}
 
 	// Get a new iterator.
-	iter := engine.NewIterator(false)
+	iter := engine.NewIterator(prefix)
 	defer iter.Close()
 
 	// Seeking for the first defined position.
@@ -2030,7 +2113,7 @@ func MVCCResolveWriteIntentRangeUsingIter(
 			err = mvccResolveWriteIntent(ctx, engine, iterAndBuf.iter, ms, intent, iterAndBuf.buf)
 		}
 		if err != nil {
-			log.Warningf(ctx, "failed to resolve intent for key %q: %v", key.Key, err)
+			log.Warningf(ctx, "failed to resolve intent for key %q: %v", log.Unsafe(key.Key), err)
 		} else {
 			num++
 		}
@@ -21,6 +21,8 @@ import (
 	"bytes"
 	"fmt"
 	"math"
+	"os"
+	"os/exec"
 	"reflect"
 	"sort"
 	"strconv"
@@ -83,9 +85,38 @@ var (
 	valueEmpty = roachpb.MakeValueFromString("")
 )
 
+// testEngineEnv selects the engine returned by createTestEngine: the
+// GoEngine if it is set to "go" and RocksDB otherwise.
+const testEngineEnv = "COCKROACH_TEST_ENGINE"
+
+// TestMain runs the tests a second time against the GoEngine once they have
+// passed against RocksDB, so that every test which uses createTestEngine
+// covers both engines.
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if code == 0 && os.Getenv(testEngineEnv) == "" {
+		cmd := exec.Command(os.Args[0], os.Args[1:]...)
+		cmd.Env = append(os.Environ(), testEngineEnv+"=go")
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "tests failed against the GoEngine: %s\n", err)
+			code = 1
+		}
+	}
+	os.Exit(code)
+}
+
 // createTestEngine returns a new in-memory engine with 1MB of storage
 // capacity.
 func createTestEngine() Engine {
+	if os.Getenv(testEngineEnv) == "go" {
+		eng, err := NewGoEngine(GoEngineConfig{MaxSizeBytes: 1 << 20})
+		if err != nil {
+			panic(err)
+		}
+		return eng
+	}
 	return NewInMem(roachpb.Attributes{}, 1<<20)
 }
 
@@ -1249,6 +1280,102 @@ func TestMVCCScanMaxNum(t *testing.T) {
 	}
 }
 
+func TestMVCCScanWithTargetBytes(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	engine := createTestEngine()
+	defer engine.Close()
+
+	value := roachpb.MakeValueFromBytes(bytes.Repeat([]byte("v"), 100))
+	testKeys := []roachpb.Key{testKey1, testKey2, testKey3, testKey4}
+	for _, key := range testKeys {
+		if err := MVCCPut(context.Background(), engine, nil, key, makeTS(1, 0), value, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// All test keys have the same length.
+	kvSize := int64(len(testKey1) + len(value.RawBytes))
+
+	testCases := []struct {
+		max         int64
+		targetBytes int64
+		reverse     bool
+		expected    []roachpb.Key
+		resume      *roachpb.Span
+	}{
+		// No limits.
+		{math.MaxInt64, 0, false, testKeys, nil},
+		// A target below the size of a single result still returns one result.
+		{math.MaxInt64, 1, false, testKeys[:1], &roachpb.Span{Key: testKey2, EndKey: keyMax}},
+		// The result which reaches the target is included.
+		{math.MaxInt64, kvSize + 1, false, testKeys[:2], &roachpb.Span{Key: testKey3, EndKey: keyMax}},
+		{math.MaxInt64, 2 * kvSize, false, testKeys[:2], &roachpb.Span{Key: testKey3, EndKey: keyMax}},
+		// The key limit still applies.
+		{1, 10 * kvSize, false, testKeys[:1], &roachpb.Span{Key: testKey2, EndKey: keyMax}},
+		// Reverse scans resume below the last returned key.
+		{math.MaxInt64, 1, true, []roachpb.Key{testKey4},
+			&roachpb.Span{Key: keyMin, EndKey: testKey3.Next()}},
+	}
+	for i, c := range testCases {
+		kvs, resumeSpan, _, err := MVCCScanWithTargetBytes(context.Background(), engine,
+			keyMin, keyMax, c.max, c.targetBytes, makeTS(1, 0), true, nil, c.reverse)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var actual []roachpb.Key
+		for _, kv := range kvs {
+			actual = append(actual, kv.Key)
+		}
+		if !reflect.DeepEqual(actual, c.expected) {
+			t.Errorf("%d: expected keys %s, found %s", i, c.expected, actual)
+		}
+		if !reflect.DeepEqual(resumeSpan, c.resume) {
+			t.Errorf("%d: expected resume span %+v, found %+v", i, c.resume, resumeSpan)
+		}
+	}
+}
+
+// TestMVCCScanSingleKey verifies that scans over a single key, which use a
+// prefix iterator, return the same results as other scans.
+func TestMVCCScanSingleKey(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	engine := createTestEngine()
+	defer engine.Close()
+
+	for _, key := range []roachpb.Key{testKey1, testKey2, testKey3} {
+		for ts := int64(1); ts <= 3; ts++ {
+			if err := MVCCPut(context.Background(), engine, nil, key, makeTS(ts, 0), value1, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for i, c := range []struct {
+		start, end roachpb.Key
+		single     bool
+		expKeys    []roachpb.Key
+	}{
+		{testKey2, testKey2.Next(), true, []roachpb.Key{testKey2}},
+		{testKey2.Next(), testKey2.Next().Next(), true, nil},
+		{testKey1, testKey3, false, []roachpb.Key{testKey1, testKey2}},
+		{testKey2, testKey2.PrefixEnd(), false, []roachpb.Key{testKey2}},
+	} {
+		if single := isSingleKeySpan(c.start, c.end); single != c.single {
+			t.Errorf("%d: expected single key span %t, got %t", i, c.single, single)
+		}
+		kvs, _, _, err := MVCCScan(context.Background(), engine, c.start, c.end, math.MaxInt64, makeTS(2, 0), true, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var keys []roachpb.Key
+		for _, kv := range kvs {
+			keys = append(keys, kv.Key)
+		}
+		if !reflect.DeepEqual(c.expKeys, keys) {
+			t.Errorf("%d: expected keys %s, got %s", i, c.expKeys, keys)
+		}
+	}
+}
+
 func TestMVCCScanWithKeyPrefix(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	engine := createTestEngine()
@@ -1529,6 +1656,42 @@ func TestMVCCDeleteRange(t *testing.T) {
 	}
 }
 
+// TestMVCCDeleteRangeSingleKeyBatch verifies that deleting a span covering a
+// single key in a batch doesn't attempt to open a second prefix iterator,
+// which batches don't support.
+func TestMVCCDeleteRangeSingleKeyBatch(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	engine := createTestEngine()
+	defer engine.Close()
+
+	if err := MVCCPut(context.Background(), engine, nil, testKey1, makeTS(1, 0), value1, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	batch := engine.NewBatch()
+	defer batch.Close()
+	deleted, resumeSpan, num, err := MVCCDeleteRange(
+		context.Background(), batch, nil, testKey1, testKey1.Next(), math.MaxInt64, makeTS(2, 0), nil, true,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if num != 1 || !reflect.DeepEqual(deleted, []roachpb.Key{testKey1}) || resumeSpan != nil {
+		t.Fatalf("expected only %s to be deleted, got %s (%d), resume span %v", testKey1, deleted, num, resumeSpan)
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	value, _, err := MVCCGet(context.Background(), engine, testKey1, makeTS(2, 0), true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != nil {
+		t.Fatalf("expected %s to be deleted, got %v", testKey1, value)
+	}
+}
+
 func TestMVCCDeleteRangeReturnKeys(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	engine := createTestEngine()
@@ -1769,6 +1932,53 @@ func TestMVCCUncommittedDeleteRangeVisible(t *testing.T) {
 	}
 }
 
+func TestMVCCClearRange(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	engine := createTestEngine()
+	defer engine.Close()
+
+	ms := &enginepb.MVCCStats{}
+	for i, kv := range []struct {
+		key   roachpb.Key
+		value roachpb.Value
+	}{
+		{testKey1, value1},
+		{testKey2, value2},
+		{testKey3, value3},
+		{testKey4, value4},
+	} {
+		if err := MVCCPut(context.Background(), engine, ms, kv.key, makeTS(1, 0), kv.value, nil); err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+	}
+	// Write a second version of one of the cleared keys.
+	if err := MVCCPut(context.Background(), engine, ms, testKey2, makeTS(2, 0), value3, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := MVCCClearRange(engine, ms, testKey2, testKey4, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	kvs, _, _, err := MVCCScan(context.Background(), engine, keyMin, keyMax, math.MaxInt64, makeTS(3, 0), true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kvs) != 2 || !kvs[0].Key.Equal(testKey1) || !kvs[1].Key.Equal(testKey4) {
+		t.Fatalf("expected only %s and %s to remain, found %v", testKey1, testKey4, kvs)
+	}
+
+	iter := engine.NewIterator(false)
+	defer iter.Close()
+	expMS, err := iter.ComputeStats(mvccKey(keyMin), mvccKey(keyMax), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expMS, *ms) {
+		t.Fatalf("expected stats %+v, found %+v", expMS, *ms)
+	}
+}
+
 func TestMVCCDeleteRangeInline(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	engine := createTestEngine()
@@ -3841,7 +4051,7 @@ func TestMVCCTimeSeriesPartialMerge(t *testing.T) {
 		}
 
 		if i == 1 {
-			if err := engine.(InMem).Compact(); err != nil {
+			if err := engine.CompactRange(nil, nil, false /* forceBottommost */); err != nil {
 				t.Fatal(err)
 			}
 		}
@@ -3854,7 +4064,7 @@ func TestMVCCTimeSeriesPartialMerge(t *testing.T) {
 		}
 
 		if i == 1 {
-			if err := engine.(InMem).Compact(); err != nil {
+			if err := engine.CompactRange(nil, nil, false /* forceBottommost */); err != nil {
 				t.Fatal(err)
 			}
 		}
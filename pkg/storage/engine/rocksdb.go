@@ -30,6 +30,7 @@ import (
 	"runtime/debug"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unsafe"
 
@@ -84,6 +85,9 @@ type SSTableInfo struct {
 	Size  int64
 	Start MVCCKey
 	End   MVCCKey
+	// Name is the file name of the sstable relative to the data directory
+	// (e.g. "/000012.sst").
+	Name string
 }
 
 // SSTableInfos is a slice of SSTableInfo structures.
@@ -271,10 +275,50 @@ type RocksDB struct {
 	maxSize      int64              // Used for calculating rebalancing and free space.
 	maxOpenFiles int                // The maximum number of open files this instance will use.
 	deallocated  chan struct{}      // Closed when the underlying handle is deallocated.
+
+	walDir          string        // The directory containing the WAL, if not dir.
+	rateLimit       int64         // The initial background rate limit in bytes/sec.
+	encryptionKeyID string        // The ID of the key new files are encrypted with.
+	rotationCancel  chan struct{} // Closed to stop the background re-encryption.
+	rotationDone    chan struct{} // Closed when the background re-encryption exits.
+
+	eventListener   EventListener // Notified of background events; may be nil.
+	eventListenerID int           // The ID background events are reported with.
+	eventStats      eventStats
 }
 
 var _ Engine = &RocksDB{}
 
+// RocksDBConfig holds the configuration parameters used in setting up a new
+// RocksDB instance.
+type RocksDBConfig struct {
+	Attrs        roachpb.Attributes
+	Dir          string
+	MaxSizeBytes int64
+	MaxOpenFiles int
+	// WALDir, if non-empty, is the directory in which the write-ahead log is
+	// kept. Placing it on a separate low-latency device reduces commit
+	// latency. It must be distinct from Dir.
+	WALDir string
+	// BackgroundRateLimit, if positive, is the rate in bytes per second at
+	// which background flushes and compactions may write. The rate can be
+	// adjusted at runtime with SetBackgroundRateLimit.
+	BackgroundRateLimit int64
+	// EncryptionKeyFile, if non-empty, is the path to the key used to encrypt
+	// all files written by the engine. Encryption must be enabled when the
+	// store is first created.
+	EncryptionKeyFile string
+	// OldEncryptionKeyFiles are the paths to keys which were previously used
+	// to encrypt the store. Any files still encrypted with these keys are
+	// rewritten with the current key in the background after the engine is
+	// opened.
+	OldEncryptionKeyFiles []string
+	// EventListener, if non-nil, is notified of flushes, compactions and
+	// write stalls. Events are also logged and surfaced through GetStats
+	// regardless of whether a listener is configured.
+	EventListener EventListener
+}
+
 // NewRocksDB allocates and returns a new RocksDB object.
 // This creates options and opens the database. If the database
 // doesn't yet exist at the specified directory, one is initialized
@@ -284,16 +328,53 @@ var _ Engine = &RocksDB{}
 func NewRocksDB(
 	attrs roachpb.Attributes, dir string, cache RocksDBCache, maxSize int64, maxOpenFiles int,
 ) (*RocksDB, error) {
-	if dir == "" {
+	return NewRocksDBWithConfig(RocksDBConfig{
+		Attrs:        attrs,
+		Dir:          dir,
+		MaxSizeBytes: maxSize,
+		MaxOpenFiles: maxOpenFiles,
+	}, cache)
+}
+
+// NewRocksDBWithConfig is like NewRocksDB but accepts the full set of
+// configuration parameters.
+func NewRocksDBWithConfig(cfg RocksDBConfig, cache RocksDBCache) (*RocksDB, error) {
+	if cfg.Dir == "" {
 		panic("dir must be non-empty")
 	}
+	if cfg.WALDir != "" {
+		if filepath.Clean(cfg.WALDir) == filepath.Clean(cfg.Dir) {
+			return nil, errors.Errorf("WAL directory %s must be distinct from the data directory", cfg.WALDir)
+		}
+		if err := checkWritableDir(cfg.WALDir); err != nil {
+			return nil, errors.Wrapf(err, "invalid WAL directory %s", cfg.WALDir)
+		}
+	}
+	var encryptionKeyID string
+	if cfg.EncryptionKeyFile != "" {
+		var err error
+		if encryptionKeyID, err = loadEncryptionKey(cfg.EncryptionKeyFile); err != nil {
+			return nil, err
+		}
+		for _, path := range cfg.OldEncryptionKeyFiles {
+			if _, err := loadEncryptionKey(path); err != nil {
+				return nil, err
+			}
+		}
+	} else if len(cfg.OldEncryptionKeyFiles) > 0 {
+		return nil, errors.New("old encryption keys specified without an encryption key")
+	}
 	r := &RocksDB{
-		attrs:        attrs,
-		dir:          dir,
-		cache:        cache.ref(),
-		maxSize:      maxSize,
-		maxOpenFiles: maxOpenFiles,
-		deallocated:  make(chan struct{}),
+		attrs:           cfg.Attrs,
+		dir:             cfg.Dir,
+		cache:           cache.ref(),
+		maxSize:         cfg.MaxSizeBytes,
+		maxOpenFiles:    cfg.MaxOpenFiles,
+		deallocated:     make(chan struct{}),
+		walDir:          cfg.WALDir,
+		rateLimit:       cfg.BackgroundRateLimit,
+		encryptionKeyID: encryptionKeyID,
+		eventListener:   cfg.EventListener,
 	}
 	if err := r.open(); err != nil {
 		return nil, err
@@ -315,12 +396,30 @@ func newMemRocksDB(attrs roachpb.Attributes, cache RocksDBCache, maxSize int64)
 	return r, nil
 }
 
+// checkWritableDir creates the specified directory if it does not exist and
+// verifies that files can be created within it.
+func checkWritableDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, ".writable")
+	if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Remove(f.Name())
+}
+
 // String formatter.
 func (r *RocksDB) String() string {
 	return fmt.Sprintf("%s=%s", r.attrs.Attrs, r.dir)
 }
 
 func (r *RocksDB) open() error {
+	freezeMergeOperators()
+
 	var ver storageVersion
 	if len(r.dir) != 0 {
 		log.Infof(context.TODO(), "opening rocksdb instance at %q", r.dir)
@@ -336,6 +435,17 @@ func (r *RocksDB) open() error {
 			return fmt.Errorf("incompatible rocksdb data version, current:%d, on disk:%d, minimum:%d",
 				versionCurrent, ver, versionMinimum)
 		}
+
+		encrypted, err := isEncryptedStore(r.dir)
+		if err != nil {
+			return err
+		}
+		if encrypted && r.encryptionKeyID == "" {
+			return errors.Errorf("store at %s is encrypted but no encryption key was specified", r.dir)
+		}
+		if !encrypted && r.encryptionKeyID != "" && ver != versionNoFile {
+			return errors.Errorf("cannot enable encryption on existing unencrypted store at %s", r.dir)
+		}
 	} else {
 		log.Infof(context.TODO(), "opening in memory rocksdb instance")
 
@@ -346,17 +456,23 @@ func (r *RocksDB) open() error {
 	blockSize := envutil.EnvOrDefaultBytes("COCKROACH_ROCKSDB_BLOCK_SIZE", defaultBlockSize)
 	walTTL := envutil.EnvOrDefaultDuration("COCKROACH_ROCKSDB_WAL_TTL", 0).Seconds()
 
+	r.eventListenerID = registerEventEngine(r)
 	status := C.DBOpen(&r.rdb, goToCSlice([]byte(r.dir)),
 		C.DBOptions{
-			cache:           r.cache.cache,
-			block_size:      C.uint64_t(blockSize),
-			wal_ttl_seconds: C.uint64_t(walTTL),
-			allow_os_buffer: C.bool(true),
-			logging_enabled: C.bool(log.V(3)),
-			num_cpu:         C.int(runtime.NumCPU()),
-			max_open_files:  C.int(r.maxOpenFiles),
+			cache:                    r.cache.cache,
+			block_size:               C.uint64_t(blockSize),
+			wal_ttl_seconds:          C.uint64_t(walTTL),
+			allow_os_buffer:          C.bool(true),
+			logging_enabled:          C.bool(log.V(3)),
+			num_cpu:                  C.int(runtime.NumCPU()),
+			max_open_files:           C.int(r.maxOpenFiles),
+			encryption_key_id:        goToCSlice([]byte(r.encryptionKeyID)),
+			wal_dir:                  goToCSlice([]byte(r.walDir)),
+			rate_limit_bytes_per_sec: C.int64_t(r.rateLimit),
+			event_listener_id:        C.int(r.eventListenerID),
 		})
 	if err := statusToError(status); err != nil {
+		unregisterEventEngine(r.eventListenerID)
 		return errors.Errorf("could not open rocksdb instance: %s", err)
 	}
 
@@ -372,9 +488,81 @@ func (r *RocksDB) open() error {
 	go func() {
 		<-r.deallocated
 	}()
+
+	if r.encryptionKeyID != "" {
+		status, err := r.EncryptionStatus()
+		if err != nil {
+			return err
+		}
+		log.Infof(context.TODO(), "%s: encryption status: %s", r, status)
+		if status.Progress() < 1 {
+			r.rotationCancel = make(chan struct{})
+			r.rotationDone = make(chan struct{})
+			go func() {
+				defer close(r.rotationDone)
+				r.rotateEncryption()
+			}()
+		}
+	}
 	return nil
 }
 
+// rotateEncryption rewrites the sstables which are not encrypted with the
+// active key by compacting the key span of each such sstable in turn. The
+// WAL and MANIFEST are rewritten as a matter of course when RocksDB rolls
+// over to new files. Rotation stops early if rotationCancel is closed; any
+// remaining sstables are rewritten the next time the engine is opened.
+func (r *RocksDB) rotateEncryption() {
+	ctx := context.TODO()
+	log.Infof(ctx, "%s: re-encrypting data files with key %s", r, r.encryptionKeyID)
+	compacted := make(map[string]struct{})
+	for {
+		var stale *SSTableInfo
+		tables := r.GetSSTables()
+		for i := range tables {
+			keyID, err := readEncryptionKeyID(filepath.Join(r.dir, tables[i].Name))
+			if err != nil {
+				if os.IsNotExist(err) {
+					// The sstable was compacted away after we listed it.
+					continue
+				}
+				log.Warningf(ctx, "%s: unable to re-encrypt data files: %s", r, err)
+				return
+			}
+			if keyID != r.encryptionKeyID {
+				stale = &tables[i]
+				break
+			}
+		}
+		if stale == nil {
+			break
+		}
+		if _, ok := compacted[stale.Name]; ok {
+			log.Warningf(ctx, "%s: unable to re-encrypt data files: %s was not rewritten", r, stale.Name)
+			return
+		}
+		compacted[stale.Name] = struct{}{}
+		select {
+		case <-r.rotationCancel:
+			log.Infof(ctx, "%s: re-encryption interrupted", r)
+			return
+		default:
+		}
+		// The end key of an sstable is inclusive while the end key of a
+		// compaction is exclusive.
+		if err := r.CompactRange(stale.Start.Key, stale.End.Key.Next(), true); err != nil {
+			log.Warningf(ctx, "%s: unable to re-encrypt data files: %s", r, err)
+			return
+		}
+	}
+	status, err := r.EncryptionStatus()
+	if err != nil {
+		log.Warningf(ctx, "%s: unable to compute encryption status: %s", r, err)
+		return
+	}
+	log.Infof(ctx, "%s: re-encryption complete: %s", r, status)
+}
+
 // Close closes the database by deallocating the underlying handle.
 func (r *RocksDB) Close() {
 	if r.rdb == nil {
@@ -388,10 +576,17 @@ func (r *RocksDB) Close() {
 	} else {
 		log.Infof(context.TODO(), "closing rocksdb instance at %q", r.dir)
 	}
+	// Stop any background re-encryption before freeing the handle it is
+	// using. This waits for at most a single sstable to be rewritten.
+	if r.rotationCancel != nil {
+		close(r.rotationCancel)
+		<-r.rotationDone
+	}
 	if r.rdb != nil {
 		C.DBClose(r.rdb)
 		r.rdb = nil
 	}
+	unregisterEventEngine(r.eventListenerID)
 	r.cache.Release()
 	close(r.deallocated)
 }
@@ -431,8 +626,12 @@ func (r *RocksDB) Merge(key MVCCKey, value []byte) error {
 
 // ApplyBatchRepr atomically applies a set of batched updates. Created by
 // calling Repr() on a batch. Using this method is equivalent to constructing
-// and committing a batch whose Repr() equals repr.
+// and committing a batch whose Repr() equals repr. An error is returned
+// without applying anything if repr is malformed.
 func (r *RocksDB) ApplyBatchRepr(repr []byte) error {
+	if err := verifyBatchRepr(repr); err != nil {
+		return errors.Wrap(err, "invalid batch repr")
+	}
 	return dbApplyBatchRepr(r.rdb, repr)
 }
 
@@ -453,6 +652,12 @@ func (r *RocksDB) Clear(key MVCCKey) error {
 	return dbClear(r.rdb, key)
 }
 
+// ClearRange removes the items in the range [start,end) using a single range
+// deletion tombstone.
+func (r *RocksDB) ClearRange(start, end MVCCKey) error {
+	return dbClearRange(r.rdb, start, end)
+}
+
 // Iterate iterates from start to end keys, invoking f on each
 // key/value pair. See engine.Iterate for details.
 func (r *RocksDB) Iterate(start, end MVCCKey, f func(MVCCKeyValue) (bool, error)) error {
@@ -461,16 +666,22 @@ func (r *RocksDB) Iterate(start, end MVCCKey, f func(MVCCKeyValue) (bool, error)
 
 // Capacity queries the underlying file system for disk capacity information.
 func (r *RocksDB) Capacity() (roachpb.StoreCapacity, error) {
+	return computeCapacity(r.dir, r.maxSize)
+}
+
+// computeCapacity returns the capacity of a store in the specified directory
+// whose size is limited to maxSize bytes. A maxSize of zero means the store
+// may use the entire file system.
+func computeCapacity(dir string, maxSize int64) (roachpb.StoreCapacity, error) {
 	fileSystemUsage := gosigar.FileSystemUsage{}
-	dir := r.dir
 	if dir == "" {
 		// This is an in-memory instance. Pretend we're empty since we
 		// don't know better and only use this for testing. Using any
 		// part of the actual file system here can throw off allocator
 		// rebalancing in a hard-to-trace manner. See #7050.
 		return roachpb.StoreCapacity{
-			Capacity:  r.maxSize,
-			Available: r.maxSize,
+			Capacity:  maxSize,
+			Available: maxSize,
 		}, nil
 	}
 	if err := fileSystemUsage.Get(dir); err != nil {
@@ -491,17 +702,17 @@ func (r *RocksDB) Capacity() (roachpb.StoreCapacity, error) {
 	// If no size limitation have been placed on the store size or if the
 	// limitation is greater than what's available, just return the actual
 	// totals.
-	if r.maxSize == 0 || r.maxSize >= fsuTotal || r.dir == "" {
+	if maxSize == 0 || maxSize >= fsuTotal || dir == "" {
 		return roachpb.StoreCapacity{
 			Capacity:  fsuTotal,
 			Available: fsuAvail,
 		}, nil
 	}
 
-	// Find the total size of all the files in the r.dir and all its
+	// Find the total size of all the files in dir and all its
 	// subdirectories.
 	var totalUsedBytes int64
-	if errOuter := filepath.Walk(r.dir, func(path string, info os.FileInfo, err error) error {
+	if errOuter := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return nil
 		}
@@ -513,7 +724,7 @@ func (r *RocksDB) Capacity() (roachpb.StoreCapacity, error) {
 		return roachpb.StoreCapacity{}, errOuter
 	}
 
-	available := r.maxSize - totalUsedBytes
+	available := maxSize - totalUsedBytes
 	if available > fsuAvail {
 		available = fsuAvail
 	}
@@ -522,7 +733,7 @@ func (r *RocksDB) Capacity() (roachpb.StoreCapacity, error) {
 	}
 
 	return roachpb.StoreCapacity{
-		Capacity:  r.maxSize,
+		Capacity:  maxSize,
 		Available: available,
 	}, nil
 }
@@ -532,16 +743,154 @@ func (r *RocksDB) Compact() error {
 	return statusToError(C.DBCompact(r.rdb))
 }
 
+// SetBackgroundRateLimit adjusts the rate in bytes per second at which
+// background flushes and compactions may write. See Engine.
+func (r *RocksDB) SetBackgroundRateLimit(bytesPerSec int64) error {
+	if err := statusToError(C.DBSetRateLimit(r.rdb, C.int64_t(bytesPerSec))); err != nil {
+		return err
+	}
+	if bytesPerSec == 0 {
+		log.Infof(context.TODO(), "%s: background rate limit removed", r)
+	} else {
+		log.Infof(context.TODO(), "%s: background rate limit set to %s/s", r,
+			humanize.IBytes(uint64(bytesPerSec)))
+	}
+	return nil
+}
+
+// CompactRange forces compaction over the specified key span. See
+// Engine.CompactRange.
+func (r *RocksDB) CompactRange(start, end roachpb.Key, forceBottommost bool) error {
+	ctx := context.TODO()
+	before := r.GetSSTables()
+	log.Infof(ctx, "%s: compacting %s-%s (%d sstables, %s)", r, start, end,
+		len(before), humanize.IBytes(uint64(totalSSTableSize(before))))
+	startTime := timeutil.Now()
+	if err := statusToError(C.DBCompactRange(
+		r.rdb, goToCKey(MakeMVCCMetadataKey(start)), goToCKey(MakeMVCCMetadataKey(end)),
+		C.bool(forceBottommost))); err != nil {
+		return errors.Wrapf(err, "compacting %s-%s", start, end)
+	}
+	after := r.GetSSTables()
+	log.Infof(ctx, "%s: compacted %s-%s in %s (%d sstables, %s)", r, start, end,
+		timeutil.Since(startTime), len(after), humanize.IBytes(uint64(totalSSTableSize(after))))
+	return nil
+}
+
+// VerifyChecksums implements the Engine interface. The blocks read are not
+// added to the block cache.
+func (r *RocksDB) VerifyChecksums(start, end roachpb.Key) (int64, error) {
+	if len(end) == 0 {
+		end = roachpb.KeyMax
+	}
+	var bytesVerified C.int64_t
+	if err := statusToError(C.DBVerifyChecksums(
+		r.rdb, goToCKey(MakeMVCCMetadataKey(start)), goToCKey(MakeMVCCMetadataKey(end)),
+		&bytesVerified)); err != nil {
+		return int64(bytesVerified), errors.Wrapf(err, "verifying checksums of %s-%s", start, end)
+	}
+	return int64(bytesVerified), nil
+}
+
+func totalSSTableSize(tables SSTableInfos) int64 {
+	var size int64
+	for _, t := range tables {
+		size += t.Size
+	}
+	return size
+}
+
+// setMergeOperatorPrefixes replaces the key prefixes for which RocksDB
+// invokes a registered merge operator. The operator for prefixes[i] is
+// identified by the ID i.
+func setMergeOperatorPrefixes(prefixes []roachpb.Key) {
+	C.DBClearMergeOperators()
+	for id, prefix := range prefixes {
+		C.DBRegisterMergeOperator(goToCSlice(prefix), C.int(id))
+	}
+}
+
+// registerEncryptionKey makes the AES key with the specified ID available
+// to engines opened with encryption enabled. Files are encrypted and
+// decrypted entirely in C++ so that IO does not need to call back into Go.
+func registerEncryptionKey(keyID string, key []byte) error {
+	return statusToError(C.DBRegisterEncryptionKey(goToCSlice([]byte(keyID)), goToCSlice(key)))
+}
+
+// rocksDBFile is a file written through the Env of a RocksDB instance, which
+// encrypts it if the instance is encrypted.
+type rocksDBFile struct {
+	file *C.DBWritableFile
+}
+
+// openFile creates the file with the specified path through the Env of the
+// engine.
+func (r *RocksDB) openFile(path string) (*rocksDBFile, error) {
+	var file *C.DBWritableFile
+	if err := statusToError(C.DBEnvOpenFile(r.rdb, goToCSlice([]byte(path)), &file)); err != nil {
+		return nil, err
+	}
+	return &rocksDBFile{file: file}, nil
+}
+
+// readFile reads the file with the specified path through the Env of the
+// engine.
+func (r *RocksDB) readFile(path string) ([]byte, error) {
+	var contents C.DBString
+	if err := statusToError(C.DBEnvReadFile(r.rdb, goToCSlice([]byte(path)), &contents)); err != nil {
+		return nil, err
+	}
+	return cStringToGoBytes(contents), nil
+}
+
+func (f *rocksDBFile) Append(data []byte) error {
+	return statusToError(C.DBEnvAppendFile(f.file, goToCSlice(data)))
+}
+
+func (f *rocksDBFile) Truncate(size int64) error {
+	return statusToError(C.DBEnvTruncateFile(f.file, C.uint64_t(size)))
+}
+
+func (f *rocksDBFile) Sync() error {
+	return statusToError(C.DBEnvSyncFile(f.file))
+}
+
+func (f *rocksDBFile) Close() error {
+	return statusToError(C.DBEnvCloseFile(f.file))
+}
+
 // Destroy destroys the underlying filesystem data associated with the database.
 func (r *RocksDB) Destroy() error {
 	return statusToError(C.DBDestroy(goToCSlice([]byte(r.dir))))
 }
 
+// CreateCheckpoint creates a RocksDB checkpoint of this engine in dir. The
+// storage version file is written alongside the checkpoint so that it can be
+// opened directly with NewRocksDB. Checkpoints cannot be created for in-memory
+// engines.
+func (r *RocksDB) CreateCheckpoint(dir string) error {
+	if len(r.dir) == 0 {
+		return errors.New("cannot create a checkpoint of an in-memory rocksdb instance")
+	}
+	if dir == "" {
+		return errors.New("checkpoint dir must be non-empty")
+	}
+	if err := statusToError(C.DBCreateCheckpoint(r.rdb, goToCSlice([]byte(dir)))); err != nil {
+		return errors.Wrapf(err, "could not create checkpoint at %q", dir)
+	}
+	return writeVersionFile(dir)
+}
+
 // Flush causes RocksDB to write all in-memory data to disk immediately.
 func (r *RocksDB) Flush() error {
 	return statusToError(C.DBFlush(r.rdb))
 }
 
+// SyncWAL syncs RocksDB's write-ahead log to disk.
+func (r *RocksDB) SyncWAL() error {
+	return statusToError(C.DBSyncWAL(r.rdb))
+}
+
 // NewIterator returns an iterator over this rocksdb engine.
 func (r *RocksDB) NewIterator(prefix bool) Iterator {
 	return newRocksDBIterator(r.rdb, prefix, r)
@@ -586,6 +935,7 @@ func (r *RocksDB) GetSSTables() SSTableInfos {
 		r.Size = int64(tv.size)
 		r.Start = cToGoKey(tv.start_key)
 		r.End = cToGoKey(tv.end_key)
+		r.Name = cStringToGoString(tv.name)
 		if ptr := tv.start_key.key.data; ptr != nil {
 			C.free(unsafe.Pointer(ptr))
 		}
@@ -633,9 +983,38 @@ func (r *RocksDB) GetStats() (*Stats, error) {
 		Flushes:                  int64(s.flushes),
 		Compactions:              int64(s.compactions),
 		TableReadersMemEstimate:  int64(s.table_readers_mem_estimate),
+		CompactionsInProgress:    atomic.LoadInt64(&r.eventStats.compactionsInProgress),
+		CompactedBytesRead:       atomic.LoadInt64(&r.eventStats.compactedBytesRead),
+		CompactedBytesWritten:    atomic.LoadInt64(&r.eventStats.compactedBytesWritten),
+		FlushedBytes:             atomic.LoadInt64(&r.eventStats.flushedBytes),
+		WriteStalls:              atomic.LoadInt64(&r.eventStats.writeStalls),
+		WriteStallNanos:          r.eventStats.writeStallDuration().Nanoseconds(),
 	}, nil
 }
 
+// IngestExternalFiles atomically links a slice of files into the RocksDB
+// log-structured merge-tree. The files must have been created with a
+// RocksDBSstFileWriter and the key ranges of the files must not overlap each
+// other. See the RocksDB documentation on `AddFile` for the various other
+// restrictions on what can be added. Note that ingestion is not supported by
+// in-memory engines.
+func (r *RocksDB) IngestExternalFiles(paths []string, move bool) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	cPaths := make([]*C.char, len(paths))
+	for i := range paths {
+		cPaths[i] = C.CString(paths[i])
+	}
+	defer func() {
+		for _, p := range cPaths {
+			C.free(unsafe.Pointer(p))
+		}
+	}()
+	return statusToError(C.DBIngestExternalFiles(
+		r.rdb, &cPaths[0], C.size_t(len(cPaths)), C.bool(move)))
+}
+
 type rocksDBSnapshot struct {
 	parent *RocksDB
 	handle *C.DBEngine
@@ -755,6 +1134,11 @@ func (r *distinctBatch) Clear(key MVCCKey) error {
 	return nil
 }
 
+func (r *distinctBatch) ClearRange(start, end MVCCKey) error {
+	r.builder.ClearRange(start, end)
+	return nil
+}
+
 func (r *distinctBatch) close() {
 	if i := &r.prefixIter.rocksDBIterator; i.iter != nil {
 		i.destroy()
@@ -909,11 +1293,21 @@ func (r *rocksDBBatch) Merge(key MVCCKey, value []byte) error {
 }
 
 // ApplyBatchRepr atomically applies a set of batched updates to the current
-// batch (the receiver).
+// batch (the receiver). An error is returned without applying anything if
+// repr is malformed.
 func (r *rocksDBBatch) ApplyBatchRepr(repr []byte) error {
 	if r.distinctOpen {
 		panic("distinct batch open")
 	}
+	if err := verifyBatchRepr(repr); err != nil {
+		return errors.Wrap(err, "invalid batch repr")
+	}
+	return r.applyBatchRepr(repr)
+}
+
+// applyBatchRepr is like ApplyBatchRepr but skips verification of repr. It is
+// used to apply the batch's own mutations.
+func (r *rocksDBBatch) applyBatchRepr(repr []byte) error {
 	r.flushMutations()
 	r.flushes++ // make sure that Repr() doesn't take a shortcut
 	return dbApplyBatchRepr(r.batch, repr)
@@ -954,6 +1348,18 @@ func (r *rocksDBBatch) Clear(key MVCCKey) error {
 	return nil
 }
 
+// ClearRange adds a range deletion tombstone for [start,end) to the batch.
+// Subsequent reads from the batch will return an error, and iterators created
+// on the batch before the call will not observe the tombstone.
+func (r *rocksDBBatch) ClearRange(start, end MVCCKey) error {
+	if r.distinctOpen {
+		panic("distinct batch open")
+	}
+	r.distinctNeedsFlush = true
+	r.builder.ClearRange(start, end)
+	return nil
+}
+
 // NewIterator returns an iterator over the batch and underlying engine. Note
 // that the returned iterator is cached and re-used for the lifetime of the
 // batch. A panic will be thrown if multiple prefix or normal (non-prefix)
@@ -999,7 +1405,7 @@ func (r *rocksDBBatch) Commit() error {
 
 		// Fast-path which avoids flushing mutations to the C++ batch. Instead, we
 		// directly apply the mutations to the database.
-		if err := r.parent.ApplyBatchRepr(r.builder.Finish()); err != nil {
+		if err := dbApplyBatchRepr(r.parent.rdb, r.builder.Finish()); err != nil {
 			return err
 		}
 	}
@@ -1044,7 +1450,7 @@ func (r *rocksDBBatch) flushMutations() {
 	r.flushes++
 	r.flushedCount += r.builder.count
 	r.flushedSize += len(r.builder.repr)
-	if err := r.ApplyBatchRepr(r.builder.Finish()); err != nil {
+	if err := r.applyBatchRepr(r.builder.Finish()); err != nil {
 		panic(err)
 	}
 	// Force a seek of the underlying iterator on the next Seek/ReverseSeek.
@@ -1330,11 +1736,12 @@ func statusToError(s C.DBStatus) error {
 }
 
 // goMerge takes existing and update byte slices that are expected to
-// be marshalled roachpb.Values and merges the two values returning a
-// marshalled roachpb.Value or an error.
-func goMerge(existing, update []byte) ([]byte, error) {
+// be marshalled roachpb.Values and merges the two values using the merge
+// semantics of key, returning a marshalled roachpb.Value or an error.
+func goMerge(key roachpb.Key, existing, update []byte) ([]byte, error) {
 	var result C.DBString
-	status := C.DBMergeOne(goToCSlice(existing), goToCSlice(update), &result)
+	status := C.DBMergeOne(goToCKey(MakeMVCCMetadataKey(key)), goToCSlice(existing),
+		goToCSlice(update), &result)
 	if status.data != nil {
 		return nil, errors.Errorf("%s: existing=%q, update=%q",
 			cStringToGoString(status), existing, update)
@@ -1421,6 +1828,13 @@ func dbClear(rdb *C.DBEngine, key MVCCKey) error {
 	return statusToError(C.DBDelete(rdb, goToCKey(key)))
 }
 
+func dbClearRange(rdb *C.DBEngine, start, end MVCCKey) error {
+	if len(end.Key) == 0 {
+		return emptyKeyError()
+	}
+	return statusToError(C.DBDeleteRange(rdb, goToCKey(start), goToCKey(end)))
+}
+
 func dbIterate(
 	rdb *C.DBEngine, engine Reader, start, end MVCCKey, f func(MVCCKeyValue) (bool, error),
 ) error {
@@ -26,6 +26,7 @@
 #include "rocksdb/filter_policy.h"
 #include "rocksdb/merge_operator.h"
 #include "rocksdb/options.h"
+#include "rocksdb/rate_limiter.h"
 #include "rocksdb/slice_transform.h"
 #include "rocksdb/statistics.h"
 #include "rocksdb/sst_file_writer.h"
@@ -38,9 +39,11 @@
 #include "cockroach/pkg/storage/engine/enginepb/mvcc.pb.h"
 #include "db.h"
 #include "encoding.h"
+#include "encryption.h"
 #include "eventlistener.h"
 
 #include <iostream>
+#include <mutex>
 
 extern "C" {
 #include "_cgo_export.h"
@@ -60,6 +63,7 @@ struct DBEngine {
   virtual DBStatus Put(DBKey key, DBSlice value) = 0;
   virtual DBStatus Merge(DBKey key, DBSlice value) = 0;
   virtual DBStatus Delete(DBKey key) = 0;
+  virtual DBStatus DeleteRange(DBKey start, DBKey end) = 0;
   virtual DBStatus CommitBatch() = 0;
   virtual DBStatus ApplyBatchRepr(DBSlice repr) = 0;
   virtual DBSlice BatchRepr() = 0;
@@ -72,7 +76,7 @@ struct DBEngine {
 };
 
 struct DBImpl : public DBEngine {
-  std::unique_ptr<rocksdb::Env> memenv;
+  std::unique_ptr<rocksdb::Env> env;
   std::unique_ptr<rocksdb::DB> rep_deleter;
   rocksdb::ReadOptions const read_opts;
   std::shared_ptr<rocksdb::Cache> block_cache;
@@ -84,7 +88,7 @@ struct DBImpl : public DBEngine {
   DBImpl(rocksdb::DB* r, rocksdb::Env* m, std::shared_ptr<rocksdb::Cache> bc,
     std::shared_ptr<DBEventListener> event_listener)
       : DBEngine(r),
-        memenv(m),
+        env(m),
         rep_deleter(r),
         block_cache(bc),
         event_listener(event_listener) {
@@ -100,6 +104,7 @@ struct DBImpl : public DBEngine {
   virtual DBStatus Put(DBKey key, DBSlice value);
   virtual DBStatus Merge(DBKey key, DBSlice value);
   virtual DBStatus Delete(DBKey key);
+  virtual DBStatus DeleteRange(DBKey start, DBKey end);
   virtual DBStatus CommitBatch();
   virtual DBStatus ApplyBatchRepr(DBSlice repr);
   virtual DBSlice BatchRepr();
@@ -110,6 +115,7 @@ struct DBImpl : public DBEngine {
 
 struct DBBatch : public DBEngine {
   int updates;
+  bool has_delete_range;
   rocksdb::WriteBatchWithIndex batch;
   rocksdb::ReadOptions const read_opts;
 
@@ -120,6 +126,7 @@ struct DBBatch : public DBEngine {
   virtual DBStatus Put(DBKey key, DBSlice value);
   virtual DBStatus Merge(DBKey key, DBSlice value);
   virtual DBStatus Delete(DBKey key);
+  virtual DBStatus DeleteRange(DBKey start, DBKey end);
   virtual DBStatus CommitBatch();
   virtual DBStatus ApplyBatchRepr(DBSlice repr);
   virtual DBSlice BatchRepr();
@@ -144,6 +151,7 @@ struct DBSnapshot : public DBEngine {
   virtual DBStatus Put(DBKey key, DBSlice value);
   virtual DBStatus Merge(DBKey key, DBSlice value);
   virtual DBStatus Delete(DBKey key);
+  virtual DBStatus DeleteRange(DBKey start, DBKey end);
   virtual DBStatus CommitBatch();
   virtual DBStatus ApplyBatchRepr(DBSlice repr);
   virtual DBSlice BatchRepr();
@@ -168,6 +176,11 @@ const rocksdb::Slice kKeyLocalMax("\x02", 1);
 
 const DBStatus kSuccess = { NULL, 0 };
 
+// kUnlimitedRate is the rate in bytes per second used for the background
+// rate limiter when no limit is configured. It is high enough to never
+// throttle, yet low enough to avoid overflow in the limiter's arithmetic.
+const int64_t kUnlimitedRate = int64_t(1) << 40;  // 1 TiB/s
+
 std::string ToString(DBSlice s) {
   return std::string(s.data, s.len);
 }
@@ -483,8 +496,9 @@ class DBPrefixExtractor : public rocksdb::SliceTransform {
 
 class DBBatchInserter : public rocksdb::WriteBatch::Handler {
  public:
-  DBBatchInserter(rocksdb::WriteBatchWithIndex* batch)
-      : batch_(batch) {
+  DBBatchInserter(rocksdb::WriteBatchWithIndex* batch, bool* has_delete_range)
+      : batch_(batch),
+        has_delete_range_(has_delete_range) {
   }
 
   virtual void Put(const rocksdb::Slice& key, const rocksdb::Slice& value) {
@@ -496,9 +510,23 @@ class DBBatchInserter : public rocksdb::WriteBatch::Handler {
   virtual void Merge(const rocksdb::Slice& key, const rocksdb::Slice& value) {
     batch_->Merge(key, value);
   }
+  virtual rocksdb::Status DeleteRangeCF(uint32_t column_family_id,
+                                        const rocksdb::Slice& begin_key,
+                                        const rocksdb::Slice& end_key) {
+    if (column_family_id != 0) {
+      return rocksdb::Status::InvalidArgument("DeleteRangeCF not implemented");
+    }
+    // WriteBatchWithIndex does not index range deletions. Add the
+    // tombstone to the underlying WriteBatch so that it is applied on
+    // commit and mark the batch as unreadable.
+    *has_delete_range_ = true;
+    batch_->GetWriteBatch()->DeleteRange(begin_key, end_key);
+    return rocksdb::Status::OK();
+  }
 
  private:
   rocksdb::WriteBatchWithIndex* const batch_;
+  bool* const has_delete_range_;
 };
 
 // Method used to sort InternalTimeSeriesSamples.
@@ -700,22 +728,87 @@ bool ConsolidateTimeSeriesValue(std::string *val, rocksdb::Logger* logger) {
   return true;
 }
 
-bool MergeValues(cockroach::storage::engine::enginepb::MVCCMetadata *left,
+// MergeOperatorRegistry holds the key prefixes with a registered
+// merge operator along with the ID used to identify the operator to
+// the Go side. Merges run on RocksDB's background threads, so the
+// registry is guarded by a mutex.
+struct MergeOperatorRegistry {
+  std::mutex mu;
+  std::vector<std::pair<std::string, int> > ops;
+};
+
+MergeOperatorRegistry* GetMergeOperatorRegistry() {
+  static MergeOperatorRegistry* registry = new MergeOperatorRegistry;
+  return registry;
+}
+
+// LookupMergeOperator returns the ID of the merge operator registered
+// for the prefix of the specified encoded key, or -1 if the key uses
+// the built-in merge semantics.
+int LookupMergeOperator(const rocksdb::Slice& key) {
+  MergeOperatorRegistry* registry = GetMergeOperatorRegistry();
+  std::lock_guard<std::mutex> guard(registry->mu);
+  for (const auto& op : registry->ops) {
+    if (key.starts_with(op.first)) {
+      return op.second;
+    }
+  }
+  return -1;
+}
+
+// MergeRegisteredValues merges two values using the merge operator
+// registered on the Go side with the specified ID.
+bool MergeRegisteredValues(int op_id,
+                           cockroach::storage::engine::enginepb::MVCCMetadata *left,
+                           const cockroach::storage::engine::enginepb::MVCCMetadata &right,
+                           rocksdb::Logger* logger) {
+  char* result = NULL;
+  int result_len = 0;
+  // A NULL existing value tells the Go side that the key does not have a
+  // value yet, as opposed to having an empty one.
+  char* err = rocksDBMerge(
+      op_id,
+      left->has_raw_bytes() ? const_cast<char*>(left->raw_bytes().data()) : NULL,
+      int(left->raw_bytes().size()),
+      const_cast<char*>(right.raw_bytes().data()), int(right.raw_bytes().size()),
+      &result, &result_len);
+  if (err != NULL) {
+    rocksdb::Warn(logger, "merge operator %d failed: %s", op_id, err);
+    free(err);
+    return false;
+  }
+  left->set_raw_bytes(result, result_len);
+  free(result);
+  if (right.has_merge_timestamp()) {
+    left->mutable_merge_timestamp()->CopyFrom(right.merge_timestamp());
+  }
+  return true;
+}
+
+bool MergeValues(const rocksdb::Slice& key,
+                 cockroach::storage::engine::enginepb::MVCCMetadata *left,
                  const cockroach::storage::engine::enginepb::MVCCMetadata &right,
                  bool full_merge, rocksdb::Logger* logger) {
+  // Replay Advisory: Because merge commands pass through raft, it is possible
+  // for merging values to be "replayed", and a MergeRequest whose outcome was
+  // ambiguous may also be retried by its client. Nothing here detects a
+  // replay: the merge timestamp is carried along but never compared. Time
+  // series data is safe against replay, as a replayed sample replaces the
+  // identical sample at the same offset. Every other merge is applied again:
+  // a replayed byte slice is appended twice and a replayed operand of a
+  // registered counter operator adds its delta twice, so counters maintained
+  // by merges are approximate unless their operands carry enough information
+  // (e.g. a unique ID) for the operator to drop duplicates.
+  const int op_id = LookupMergeOperator(key);
+  if (op_id >= 0) {
+    return MergeRegisteredValues(op_id, left, right, logger);
+  }
   if (left->has_raw_bytes()) {
     if (!right.has_raw_bytes()) {
       rocksdb::Warn(logger, "inconsistent value types for merge (left = bytes, right = ?)");
       return false;
     }
 
-    // Replay Advisory: Because merge commands pass through raft, it is possible
-    // for merging values to be "replayed". Currently, the only actual use of
-    // the merge system is for time series data, which is safe against replay;
-    // however, this property is not general for all potential mergeable types.
-    // If a future need arises to merge another type of data, replay protection
-    // will likely need to be a consideration.
-
     if (IsTimeSeriesData(left->raw_bytes()) || IsTimeSeriesData(right.raw_bytes())) {
       // The right operand must also be a time series.
       if (!IsTimeSeriesData(left->raw_bytes()) || !IsTimeSeriesData(right.raw_bytes())) {
@@ -755,6 +848,28 @@ DBStatus MergeResult(cockroach::storage::engine::enginepb::MVCCMetadata* meta, D
   return kSuccess;
 }
 
+// MergeOneForKey merges update into existing using the merge semantics
+// of the specified encoded key.
+DBStatus MergeOneForKey(const rocksdb::Slice& key, DBSlice existing,
+                        DBSlice update, DBString* new_value) {
+  new_value->len = 0;
+
+  cockroach::storage::engine::enginepb::MVCCMetadata meta;
+  if (!meta.ParseFromArray(existing.data, existing.len)) {
+    return ToDBString("corrupted existing value");
+  }
+
+  cockroach::storage::engine::enginepb::MVCCMetadata update_meta;
+  if (!update_meta.ParseFromArray(update.data, update.len)) {
+    return ToDBString("corrupted update value");
+  }
+
+  if (!MergeValues(key, &meta, update_meta, true, NULL)) {
+    return ToDBString("incompatible merge values");
+  }
+  return MergeResult(&meta, new_value);
+}
+
 class DBMergeOperator : public rocksdb::MergeOperator {
   virtual const char* Name() const {
     return "cockroach_merge_operator";
@@ -792,7 +907,7 @@ class DBMergeOperator : public rocksdb::MergeOperator {
     }
 
     for (int i = 0; i < operand_list.size(); i++) {
-      if (!MergeOne(&meta, operand_list[i], true, logger)) {
+      if (!MergeOne(key, &meta, operand_list[i], true, logger)) {
         return false;
       }
     }
@@ -812,7 +927,7 @@ class DBMergeOperator : public rocksdb::MergeOperator {
     cockroach::storage::engine::enginepb::MVCCMetadata meta;
 
     for (int i = 0; i < operand_list.size(); i++) {
-      if (!MergeOne(&meta, operand_list[i], false, logger)) {
+      if (!MergeOne(key, &meta, operand_list[i], false, logger)) {
         return false;
       }
     }
@@ -825,7 +940,8 @@ class DBMergeOperator : public rocksdb::MergeOperator {
   }
 
  private:
-  bool MergeOne(cockroach::storage::engine::enginepb::MVCCMetadata* meta,
+  bool MergeOne(const rocksdb::Slice& key,
+                cockroach::storage::engine::enginepb::MVCCMetadata* meta,
                 const rocksdb::Slice& operand,
                 bool full_merge,
                 rocksdb::Logger* logger) const {
@@ -834,7 +950,7 @@ class DBMergeOperator : public rocksdb::MergeOperator {
       rocksdb::Warn(logger, "corrupted operand value");
       return false;
     }
-    return MergeValues(meta, operand_meta, full_merge, logger);
+    return MergeValues(key, meta, operand_meta, full_merge, logger);
   }
 };
 
@@ -1011,8 +1127,8 @@ DBStatus ProcessDeltaKey(Getter* base, rocksdb::WBWIIterator* delta,
           value->len = 0;
         }
         if (existing.data != NULL) {
-          DBStatus status = DBMergeOne(
-              ToDBSlice(existing), ToDBSlice(entry.value), value);
+          DBStatus status = MergeOneForKey(
+              key, ToDBSlice(existing), ToDBSlice(entry.value), value);
           free(existing.data);
           if (status.data != NULL) {
             return status;
@@ -1356,6 +1472,7 @@ DBSSTable* DBEngine::GetSSTables(int* n) {
   for (int i = 0; i < metadata.size(); i++) {
     tables[i].level = metadata[i].level;
     tables[i].size = metadata[i].size;
+    tables[i].name = ToDBString(metadata[i].name);
 
     rocksdb::Slice tmp;
     if (DecodeKey(metadata[i].smallestkey, &tmp,
@@ -1405,7 +1522,8 @@ DBString DBEngine::GetUserProperties() {
 DBBatch::DBBatch(DBEngine* db)
     : DBEngine(db->rep),
       batch(&kComparator),
-      updates(0) {
+      updates(0),
+      has_delete_range(false) {
 }
 
 DBCache* DBNewCache(uint64_t size) {
@@ -1519,6 +1637,15 @@ DBStatus DBOpen(DBEngine **db, DBSlice dir, DBOptions db_opts) {
   options.statistics = rocksdb::CreateDBStatistics();
   options.table_factory.reset(rocksdb::NewBlockBasedTableFactory(table_options));
   options.max_open_files = db_opts.max_open_files;
+  if (db_opts.wal_dir.len > 0) {
+    options.wal_dir = ToString(db_opts.wal_dir);
+  }
+  // Throttle background flushes and compactions so that they do not
+  // saturate the disk and starve foreground writes. The limiter is
+  // always created, even when no limit is configured, so that a limit
+  // can be imposed later via DBSetRateLimit.
+  options.rate_limiter.reset(rocksdb::NewGenericRateLimiter(
+      db_opts.rate_limit_bytes_per_sec > 0 ? db_opts.rate_limit_bytes_per_sec : kUnlimitedRate));
 
   // Do not create bloom filters for the last level (i.e. the largest
   // level which contains data in the LSM store). Setting this option
@@ -1602,14 +1729,21 @@ DBStatus DBOpen(DBEngine **db, DBSlice dir, DBOptions db_opts) {
   options.target_file_size_base = options.max_bytes_for_level_base / 4;
   options.target_file_size_multiplier = 2;
 
-  // Register listener for tracking RocksDB stats.
-  std::shared_ptr<DBEventListener> event_listener(new DBEventListener);
+  // Register listener for tracking RocksDB stats and reporting
+  // background events.
+  std::shared_ptr<DBEventListener> event_listener(
+      new DBEventListener(db_opts.event_listener_id));
   options.listeners.emplace_back(event_listener);
 
-  std::unique_ptr<rocksdb::Env> memenv;
+  std::unique_ptr<rocksdb::Env> env;
   if (dir.len == 0) {
-    memenv.reset(rocksdb::NewMemEnv(rocksdb::Env::Default()));
-    options.env = memenv.get();
+    env.reset(rocksdb::NewMemEnv(rocksdb::Env::Default()));
+    options.env = env.get();
+  } else if (db_opts.encryption_key_id.len > 0) {
+    // Encrypt all files written by RocksDB (sstables, WAL, MANIFEST,
+    // etc) with the active key.
+    env.reset(NewEncryptedEnv(rocksdb::Env::Default(), ToString(db_opts.encryption_key_id)));
+    options.env = env.get();
   }
 
   rocksdb::DB *db_ptr;
@@ -1617,7 +1751,7 @@ DBStatus DBOpen(DBEngine **db, DBSlice dir, DBOptions db_opts) {
   if (!status.ok()) {
     return ToDBStatus(status);
   }
-  *db = new DBImpl(db_ptr, memenv.release(), table_options.block_cache, event_listener);
+  *db = new DBImpl(db_ptr, env.release(), table_options.block_cache, event_listener);
   return kSuccess;
 }
 
@@ -1630,21 +1764,93 @@ void DBClose(DBEngine* db) {
   delete db;
 }
 
+DBStatus DBRegisterEncryptionKey(DBSlice key_id, DBSlice key) {
+  if (!RegisterEncryptionKey(ToString(key_id), ToString(key))) {
+    return FmtStatus("invalid key length: %d", int(key.len));
+  }
+  return kSuccess;
+}
+
 DBStatus DBFlush(DBEngine* db) {
   rocksdb::FlushOptions options;
   options.wait = true;
   return ToDBStatus(db->rep->Flush(options));
 }
 
+DBStatus DBSyncWAL(DBEngine* db) {
+  return ToDBStatus(db->rep->SyncWAL());
+}
+
+DBStatus DBSetRateLimit(DBEngine* db, int64_t bytes_per_sec) {
+  if (bytes_per_sec < 0) {
+    return FmtStatus("invalid rate limit: %lld", (long long)bytes_per_sec);
+  }
+  const rocksdb::Options &opts = db->rep->GetOptions();
+  opts.rate_limiter->SetBytesPerSecond(bytes_per_sec > 0 ? bytes_per_sec : kUnlimitedRate);
+  return kSuccess;
+}
+
 DBStatus DBCompact(DBEngine* db) {
-  rocksdb::CompactRangeOptions options;
   // By default, RocksDB doesn't recompact the bottom level (unless
   // there is a compaction filter, which we don't use). However,
   // recompacting the bottom layer is necessary to pick up changes to
   // settings like bloom filter configurations (which is the biggest
   // reason we currently have to use this function).
-  options.bottommost_level_compaction = rocksdb::BottommostLevelCompaction::kForce;
-  return ToDBStatus(db->rep->CompactRange(options, NULL, NULL));
+  DBKey unbounded = {};
+  return DBCompactRange(db, unbounded, unbounded, true);
+}
+
+DBStatus DBCompactRange(DBEngine* db, DBKey start, DBKey end, bool force_bottommost) {
+  rocksdb::CompactRangeOptions options;
+  if (force_bottommost) {
+    options.bottommost_level_compaction = rocksdb::BottommostLevelCompaction::kForce;
+  }
+
+  std::string start_key;
+  std::string end_key;
+  rocksdb::Slice start_slice;
+  rocksdb::Slice end_slice;
+  rocksdb::Slice* start_ptr = NULL;
+  rocksdb::Slice* end_ptr = NULL;
+  if (start.key.len > 0) {
+    start_key = EncodeKey(start);
+    start_slice = start_key;
+    start_ptr = &start_slice;
+  }
+  if (end.key.len > 0) {
+    end_key = EncodeKey(end);
+    end_slice = end_key;
+    end_ptr = &end_slice;
+  }
+  return ToDBStatus(db->rep->CompactRange(options, start_ptr, end_ptr));
+}
+
+DBStatus DBVerifyChecksums(DBEngine* db, DBKey start, DBKey end, int64_t* bytes_verified) {
+  const std::string end_key = EncodeKey(end);
+  const rocksdb::Slice end_slice(end_key);
+
+  rocksdb::ReadOptions opts;
+  opts.verify_checksums = true;
+  opts.fill_cache = false;
+  opts.total_order_seek = true;
+  opts.iterate_upper_bound = &end_slice;
+
+  *bytes_verified = 0;
+  std::unique_ptr<rocksdb::Iterator> iter(db->rep->NewIterator(opts));
+  for (iter->Seek(EncodeKey(start)); iter->Valid(); iter->Next()) {
+    *bytes_verified += iter->key().size() + iter->value().size();
+  }
+  return ToDBStatus(iter->status());
+}
+
+DBStatus DBCreateCheckpoint(DBEngine* db, DBSlice dir) {
+  rocksdb::Checkpoint* checkpoint;
+  rocksdb::Status status = rocksdb::Checkpoint::Create(db->rep, &checkpoint);
+  if (!status.ok()) {
+    return ToDBStatus(status);
+  }
+  std::unique_ptr<rocksdb::Checkpoint> checkpoint_deleter(checkpoint);
+  return ToDBStatus(checkpoint->CreateCheckpoint(ToString(dir)));
 }
 
 DBStatus DBImpl::Put(DBKey key, DBSlice value) {
@@ -1691,6 +1897,9 @@ DBStatus DBImpl::Get(DBKey key, DBString* value) {
 }
 
 DBStatus DBBatch::Get(DBKey key, DBString* value) {
+  if (has_delete_range) {
+    return FmtStatus("cannot read from a batch containing delete range entries");
+  }
   DBGetter base(rep, read_opts, EncodeKey(key));
   if (updates == 0) {
     return base.Get(value);
@@ -1728,6 +1937,31 @@ DBStatus DBDelete(DBEngine *db, DBKey key) {
   return db->Delete(key);
 }
 
+DBStatus DBImpl::DeleteRange(DBKey start, DBKey end) {
+  rocksdb::WriteOptions options;
+  return ToDBStatus(rep->DeleteRange(options, rep->DefaultColumnFamily(),
+                                     EncodeKey(start), EncodeKey(end)));
+}
+
+DBStatus DBBatch::DeleteRange(DBKey start, DBKey end) {
+  // WriteBatchWithIndex does not support range deletions, so the
+  // tombstone is added to the underlying WriteBatch. Reads from the
+  // batch are disallowed from this point on as they would not see
+  // the effect of the tombstone.
+  ++updates;
+  has_delete_range = true;
+  batch.GetWriteBatch()->DeleteRange(EncodeKey(start), EncodeKey(end));
+  return kSuccess;
+}
+
+DBStatus DBSnapshot::DeleteRange(DBKey start, DBKey end) {
+  return FmtStatus("unsupported");
+}
+
+DBStatus DBDeleteRange(DBEngine* db, DBKey start, DBKey end) {
+  return db->DeleteRange(start, end);
+}
+
 DBStatus DBImpl::CommitBatch() {
   return FmtStatus("unsupported");
 }
@@ -1757,9 +1991,12 @@ DBStatus DBImpl::ApplyBatchRepr(DBSlice repr) {
 DBStatus DBBatch::ApplyBatchRepr(DBSlice repr) {
   // TODO(peter): It would be slightly more efficient to iterate over
   // repr directly instead of first converting it to a string.
-  DBBatchInserter inserter(&batch);
+  DBBatchInserter inserter(&batch, &has_delete_range);
   rocksdb::WriteBatch batch(ToString(repr));
-  batch.Iterate(&inserter);
+  rocksdb::Status status = batch.Iterate(&inserter);
+  if (!status.ok()) {
+    return ToDBStatus(status);
+  }
   updates += batch.Count();
   return kSuccess;
 }
@@ -1807,6 +2044,11 @@ DBIterator* DBImpl::NewIter(bool prefix) {
 
 DBIterator* DBBatch::NewIter(bool prefix) {
   DBIterator* iter = new DBIterator;
+  if (has_delete_range) {
+    iter->rep.reset(rocksdb::NewErrorIterator(rocksdb::Status::NotSupported(
+        "cannot read from a batch containing delete range entries")));
+    return iter;
+  }
   rocksdb::ReadOptions opts = read_opts;
   opts.prefix_same_as_start = prefix;
   opts.total_order_seek = !prefix;
@@ -1970,23 +2212,20 @@ DBStatus DBIterError(DBIterator* iter) {
   return ToDBStatus(iter->rep->status());
 }
 
-DBStatus DBMergeOne(DBSlice existing, DBSlice update, DBString* new_value) {
-  new_value->len = 0;
-
-  cockroach::storage::engine::enginepb::MVCCMetadata meta;
-  if (!meta.ParseFromArray(existing.data, existing.len)) {
-    return ToDBString("corrupted existing value");
-  }
+DBStatus DBMergeOne(DBKey key, DBSlice existing, DBSlice update, DBString* new_value) {
+  return MergeOneForKey(EncodeKey(key), existing, update, new_value);
+}
 
-  cockroach::storage::engine::enginepb::MVCCMetadata update_meta;
-  if (!update_meta.ParseFromArray(update.data, update.len)) {
-    return ToDBString("corrupted update value");
-  }
+void DBRegisterMergeOperator(DBSlice prefix, int id) {
+  MergeOperatorRegistry* registry = GetMergeOperatorRegistry();
+  std::lock_guard<std::mutex> guard(registry->mu);
+  registry->ops.push_back(std::make_pair(ToString(prefix), id));
+}
 
-  if (!MergeValues(&meta, update_meta, true, NULL)) {
-    return ToDBString("incompatible merge values");
-  }
-  return MergeResult(&meta, new_value);
+void DBClearMergeOperators() {
+  MergeOperatorRegistry* registry = GetMergeOperatorRegistry();
+  std::lock_guard<std::mutex> guard(registry->mu);
+  registry->ops.clear();
 }
 
 const int64_t kNanosecondPerSecond = 1e9;
@@ -2136,6 +2375,18 @@ DBStatus DBEngineAddFile(DBEngine* db, DBSlice path) {
   return kSuccess;
 }
 
+DBStatus DBIngestExternalFiles(DBEngine* db, char** paths, size_t len, bool move_files) {
+  std::vector<std::string> paths_vec;
+  for (size_t i = 0; i < len; i++) {
+    paths_vec.push_back(paths[i]);
+  }
+  rocksdb::Status status = db->rep->AddFile(paths_vec, move_files);
+  if (!status.ok()) {
+    return ToDBStatus(status);
+  }
+  return kSuccess;
+}
+
 struct DBSstFileWriter {
   std::unique_ptr<rocksdb::Options> options;
   rocksdb::ImmutableCFOptions ioptions;
@@ -2179,3 +2430,48 @@ DBStatus DBSstFileWriterClose(DBSstFileWriter* fw) {
   }
   return kSuccess;
 }
+
+struct DBWritableFile {
+  std::unique_ptr<rocksdb::WritableFile> rep;
+};
+
+DBStatus DBEnvOpenFile(DBEngine* db, DBSlice path, DBWritableFile** file) {
+  std::unique_ptr<rocksdb::WritableFile> rep;
+  rocksdb::Status status = db->rep->GetEnv()->NewWritableFile(
+      ToString(path), &rep, rocksdb::EnvOptions());
+  if (!status.ok()) {
+    return ToDBStatus(status);
+  }
+  *file = new DBWritableFile;
+  (*file)->rep = std::move(rep);
+  return kSuccess;
+}
+
+DBStatus DBEnvAppendFile(DBWritableFile* file, DBSlice data) {
+  return ToDBStatus(file->rep->Append(ToSlice(data)));
+}
+
+DBStatus DBEnvTruncateFile(DBWritableFile* file, uint64_t size) {
+  return ToDBStatus(file->rep->Truncate(size));
+}
+
+DBStatus DBEnvSyncFile(DBWritableFile* file) {
+  return ToDBStatus(file->rep->Sync());
+}
+
+DBStatus DBEnvCloseFile(DBWritableFile* file) {
+  rocksdb::Status status = file->rep->Close();
+  delete file;
+  return ToDBStatus(status);
+}
+
+DBStatus DBEnvReadFile(DBEngine* db, DBSlice path, DBString* contents) {
+  std::string data;
+  rocksdb::Status status = rocksdb::ReadFileToString(
+      db->rep->GetEnv(), ToString(path), &data);
+  if (!status.ok()) {
+    return ToDBStatus(status);
+  }
+  *contents = ToDBString(data);
+  return kSuccess;
+}
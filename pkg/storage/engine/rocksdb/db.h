@@ -67,6 +67,18 @@ typedef struct {
   bool logging_enabled;
   int num_cpu;
   int max_open_files;
+  // If non-empty, all files are encrypted with the key identified by
+  // encryption_key_id.
+  DBSlice encryption_key_id;
+  // If non-empty, the directory in which the write-ahead log is kept.
+  DBSlice wal_dir;
+  // If positive, the rate in bytes per second at which background
+  // flushes and compactions may write. Otherwise background work is
+  // unthrottled until a limit is set via DBSetRateLimit.
+  int64_t rate_limit_bytes_per_sec;
+  // If non-zero, background events are reported to the Go event
+  // listener registered with this ID.
+  int event_listener_id;
 } DBOptions;
 
 // Create a new cache with the specified size.
@@ -92,13 +104,42 @@ DBStatus DBDestroy(DBSlice dir);
 // Closes the database, freeing memory and other resources.
 void DBClose(DBEngine* db);
 
+// Registers the AES key with the specified ID for use by engines opened
+// with encryption enabled. The key must be 16, 24 or 32 bytes long.
+DBStatus DBRegisterEncryptionKey(DBSlice key_id, DBSlice key);
+
 // Flushes all mem-table data to disk, blocking until the operation is
 // complete.
 DBStatus DBFlush(DBEngine* db);
 
+// Syncs the write-ahead log to disk, making all preceding writes durable.
+DBStatus DBSyncWAL(DBEngine* db);
+
+// Sets the rate in bytes per second at which background flushes and
+// compactions may write. A rate of zero removes the limit.
+DBStatus DBSetRateLimit(DBEngine* db, int64_t bytes_per_sec);
+
 // Forces an immediate compaction over all keys.
 DBStatus DBCompact(DBEngine* db);
 
+// Forces an immediate compaction over the keys in the range
+// [start,end). An empty start or end key leaves the range unbounded on
+// that side. If force_bottommost is true, files in the bottommost level
+// are rewritten as well.
+DBStatus DBCompactRange(DBEngine* db, DBKey start, DBKey end, bool force_bottommost);
+
+// Reads every block of the sstables and memtables holding keys in the
+// range [start,end), verifying their checksums without populating the
+// block cache. Returns a corruption error naming the affected file on
+// the first checksum mismatch. The total size of the keys and values
+// read is stored in bytes_verified.
+DBStatus DBVerifyChecksums(DBEngine* db, DBKey start, DBKey end, int64_t* bytes_verified);
+
+// Creates a consistent point-in-time snapshot of the database's files
+// in "dir", which must not already exist. Immutable files (sstables)
+// are hard linked where possible and the remaining files are copied.
+DBStatus DBCreateCheckpoint(DBEngine* db, DBSlice dir);
+
 // Sets the database entry for "key" to "value".
 DBStatus DBPut(DBEngine* db, DBKey key, DBSlice value);
 
@@ -111,6 +152,11 @@ DBStatus DBGet(DBEngine* db, DBKey key, DBString* value);
 // Deletes the database entry for "key".
 DBStatus DBDelete(DBEngine* db, DBKey key);
 
+// Deletes all of the database entries in the range [start,end) by
+// writing a single range deletion tombstone. Note that reads from a
+// batch containing a range deletion tombstone are not supported.
+DBStatus DBDeleteRange(DBEngine* db, DBKey start, DBKey end);
+
 // Applies a batch of operations (puts, merges and deletes) to the
 // database atomically. It is only valid to call this function on an
 // engine created by DBNewBatch.
@@ -174,9 +220,17 @@ DBIterState DBIterPrev(DBIterator* iter, bool skip_current_key_versions);
 DBStatus DBIterError(DBIterator* iter);
 
 // Implements the merge operator on a single pair of values. update is
-// merged with existing. This method is provided for invocation from
-// Go code.
-DBStatus DBMergeOne(DBSlice existing, DBSlice update, DBString* new_value);
+// merged with existing using the merge semantics of key. This method
+// is provided for invocation from Go code.
+DBStatus DBMergeOne(DBKey key, DBSlice existing, DBSlice update, DBString* new_value);
+
+// Registers a merge operator, implemented by the Go function with the
+// specified ID, for all keys with the specified prefix. Keys without a
+// registered prefix use the built-in merge semantics.
+void DBRegisterMergeOperator(DBSlice prefix, int id);
+
+// Removes all registered merge operators.
+void DBClearMergeOperators();
 
 typedef struct {
   DBStatus status;
@@ -220,10 +274,11 @@ typedef struct {
   uint64_t size;
   DBKey start_key;
   DBKey end_key;
+  DBString name;
 } DBSSTable;
 
 // Retrieve stats about all of the live sstables. Note that the tables
-// array must be freed along with the start_key and end_key of each
+// array must be freed along with the start_key, end_key and name of each
 // table.
 DBSSTable* DBGetSSTables(DBEngine* db, int* n);
 
@@ -236,6 +291,13 @@ DBString DBGetUserProperties(DBEngine* db);
 // documentation on `AddFile` for the various restrictions on what can be added.
 DBStatus DBEngineAddFile(DBEngine* db, DBSlice path);
 
+// Bulk adds the files at the given paths to a database, all at once. If
+// move_files is true, the files are hard linked into the database
+// directory and the originals removed; otherwise they are copied. See
+// the RocksDB documentation on `AddFile` for the various restrictions on
+// what can be added.
+DBStatus DBIngestExternalFiles(DBEngine* db, char** paths, size_t len, bool move_files);
+
 typedef struct DBSstFileWriter DBSstFileWriter;
 
 // Creates a new SstFileWriter with the default configuration.
@@ -254,6 +316,29 @@ DBStatus DBSstFileWriterAdd(DBSstFileWriter* fw, DBKey key, DBSlice val);
 // memory and other resources. At least one kv entry must have been added.
 DBStatus DBSstFileWriterClose(DBSstFileWriter* fw);
 
+typedef struct DBWritableFile DBWritableFile;
+
+// Creates a file at the given path through the Env of the engine, which
+// encrypts it if the engine is encrypted. The file must be closed with
+// DBEnvCloseFile.
+DBStatus DBEnvOpenFile(DBEngine* db, DBSlice path, DBWritableFile** file);
+
+// Appends data to a file opened with DBEnvOpenFile.
+DBStatus DBEnvAppendFile(DBWritableFile* file, DBSlice data);
+
+// Truncates a file opened with DBEnvOpenFile to the given size.
+DBStatus DBEnvTruncateFile(DBWritableFile* file, uint64_t size);
+
+// Syncs a file opened with DBEnvOpenFile to disk.
+DBStatus DBEnvSyncFile(DBWritableFile* file);
+
+// Closes a file opened with DBEnvOpenFile and frees it.
+DBStatus DBEnvCloseFile(DBWritableFile* file);
+
+// Reads the contents of the file at the given path through the Env of the
+// engine, decrypting it if it is encrypted.
+DBStatus DBEnvReadFile(DBEngine* db, DBSlice path, DBString* contents);
+
 #ifdef __cplusplus
 }  // extern "C"
 #endif
@@ -0,0 +1,753 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+#include <string.h>
+#include <algorithm>
+#include <map>
+#include <memory>
+#include <mutex>
+#include <openssl/evp.h>
+#include <openssl/hmac.h>
+#include <openssl/rand.h>
+#include "encryption.h"
+
+namespace {
+
+const char kEncryptionMagic[] = "crdbenc1";
+const size_t kEncryptionMagicSize = 8;
+const size_t kEncryptionKeyIDOffset = 9;
+const size_t kEncryptionMaxKeyIDSize = 39;
+const size_t kEncryptionIVOffset = 48;
+const size_t kEncryptionIVSize = 16;
+
+// The data following the header is split into chunks which are encrypted
+// and authenticated independently with AES-GCM. Each chunk is stored in a
+// frame laid out as:
+//
+//   [0, 4)     length of the chunk's data (little-endian)
+//   [4, 12)    sequence number of the frame (little-endian)
+//   [12, n)    encrypted data
+//   [n, n+16)  authentication tag
+//
+// All chunks but the last one of a file hold kChunkSize bytes, which allows
+// the frame holding an offset to be located without reading the preceding
+// frames. Files which are only read sequentially (the WAL, MANIFEST, etc)
+// may contain shorter chunks wherever they were flushed.
+const size_t kChunkSize = 4096;
+const size_t kFrameHeaderSize = 12;
+const size_t kTagSize = 16;
+const size_t kFrameSize = kFrameHeaderSize + kChunkSize + kTagSize;
+const size_t kNonceSize = 12;
+
+// kFileKeyLabel is mixed into the derivation of the per-file keys.
+const char kFileKeyLabel[] = "cockroach file key";
+
+void putU32(char* b, uint32_t v) {
+  for (int i = 0; i < 4; i++) {
+    b[i] = char(v >> (8 * i));
+  }
+}
+
+void putU64(char* b, uint64_t v) {
+  for (int i = 0; i < 8; i++) {
+    b[i] = char(v >> (8 * i));
+  }
+}
+
+uint32_t getU32(const char* b) {
+  uint32_t v = 0;
+  for (int i = 3; i >= 0; i--) {
+    v = (v << 8) | uint8_t(b[i]);
+  }
+  return v;
+}
+
+struct cipherCtxDeleter {
+  void operator()(EVP_CIPHER_CTX* ctx) const { EVP_CIPHER_CTX_free(ctx); }
+};
+
+typedef std::unique_ptr<EVP_CIPHER_CTX, cipherCtxDeleter> cipherCtx;
+
+// fileCipher seals and opens the frames of a single file. The data of
+// every file is encrypted with its own key, which is derived from the
+// store key and the file's random IV with HMAC-SHA256, so that the
+// sequence numbers used as GCM nonces are never reused under a key.
+class fileCipher {
+ public:
+  // Init derives the file key from the specified store key, which must be
+  // 16, 24 or 32 bytes long. Returns false if the key is invalid.
+  bool Init(const std::string& store_key, const std::string& iv) {
+    switch (store_key.size()) {
+      case 16:
+        aead_ = EVP_aes_128_gcm();
+        break;
+      case 24:
+        aead_ = EVP_aes_192_gcm();
+        break;
+      case 32:
+        aead_ = EVP_aes_256_gcm();
+        break;
+      default:
+        return false;
+    }
+    std::string msg(kFileKeyLabel);
+    msg.append(iv);
+    unsigned char digest[EVP_MAX_MD_SIZE];
+    unsigned int digest_len = 0;
+    if (HMAC(EVP_sha256(), store_key.data(), int(store_key.size()),
+             reinterpret_cast<const unsigned char*>(msg.data()), msg.size(),
+             digest, &digest_len) == nullptr) {
+      return false;
+    }
+    key_.assign(reinterpret_cast<const char*>(digest), store_key.size());
+    return true;
+  }
+
+  // Seal encrypts the n bytes of data as the frame with the specified
+  // ordinal within the file and sequence number, which must be unique
+  // within the file, and appends the frame to out.
+  rocksdb::Status Seal(uint64_t ordinal, uint64_t seq, const char* data, size_t n,
+                       std::string* out) const {
+    const size_t start = out->size();
+    out->resize(start + kFrameHeaderSize + n + kTagSize);
+    char* frame = &(*out)[start];
+    putU32(frame, uint32_t(n));
+    putU64(frame + 4, seq);
+    cipherCtx ctx(EVP_CIPHER_CTX_new());
+    int len = 0;
+    char aad[12];
+    makeAAD(ordinal, uint32_t(n), aad);
+    char nonce[kNonceSize];
+    makeNonce(seq, nonce);
+    if (ctx == nullptr ||
+        EVP_EncryptInit_ex(ctx.get(), aead_, nullptr, nullptr, nullptr) != 1 ||
+        EVP_CIPHER_CTX_ctrl(ctx.get(), EVP_CTRL_GCM_SET_IVLEN, kNonceSize, nullptr) != 1 ||
+        EVP_EncryptInit_ex(ctx.get(), nullptr, nullptr, bytes(key_.data()), bytes(nonce)) != 1 ||
+        EVP_EncryptUpdate(ctx.get(), nullptr, &len, bytes(aad), sizeof(aad)) != 1 ||
+        EVP_EncryptUpdate(ctx.get(), mutableBytes(frame + kFrameHeaderSize), &len,
+                          bytes(data), int(n)) != 1 ||
+        EVP_EncryptFinal_ex(ctx.get(), mutableBytes(frame + kFrameHeaderSize + len), &len) != 1 ||
+        EVP_CIPHER_CTX_ctrl(ctx.get(), EVP_CTRL_GCM_GET_TAG, kTagSize,
+                            frame + kFrameHeaderSize + n) != 1) {
+      out->resize(start);
+      return rocksdb::Status::IOError("unable to encrypt data");
+    }
+    return rocksdb::Status::OK();
+  }
+
+  // Open authenticates and decrypts the frame with the specified ordinal
+  // within the file, whose data is n bytes long, into out.
+  rocksdb::Status Open(uint64_t ordinal, const char* frame, size_t n, char* out) const {
+    uint64_t seq = 0;
+    for (int i = 7; i >= 0; i--) {
+      seq = (seq << 8) | uint8_t(frame[4 + i]);
+    }
+    cipherCtx ctx(EVP_CIPHER_CTX_new());
+    int len = 0;
+    char aad[12];
+    makeAAD(ordinal, uint32_t(n), aad);
+    char nonce[kNonceSize];
+    makeNonce(seq, nonce);
+    // The tag is only read by OpenSSL, but the control interface is not
+    // const-correct.
+    char tag[kTagSize];
+    memcpy(tag, frame + kFrameHeaderSize + n, kTagSize);
+    if (ctx == nullptr ||
+        EVP_DecryptInit_ex(ctx.get(), aead_, nullptr, nullptr, nullptr) != 1 ||
+        EVP_CIPHER_CTX_ctrl(ctx.get(), EVP_CTRL_GCM_SET_IVLEN, kNonceSize, nullptr) != 1 ||
+        EVP_DecryptInit_ex(ctx.get(), nullptr, nullptr, bytes(key_.data()), bytes(nonce)) != 1 ||
+        EVP_DecryptUpdate(ctx.get(), nullptr, &len, bytes(aad), sizeof(aad)) != 1 ||
+        EVP_DecryptUpdate(ctx.get(), mutableBytes(out), &len,
+                          bytes(frame + kFrameHeaderSize), int(n)) != 1 ||
+        EVP_CIPHER_CTX_ctrl(ctx.get(), EVP_CTRL_GCM_SET_TAG, kTagSize, tag) != 1) {
+      return rocksdb::Status::IOError("unable to decrypt data");
+    }
+    if (EVP_DecryptFinal_ex(ctx.get(), mutableBytes(out + len), &len) != 1) {
+      return rocksdb::Status::Corruption("encrypted data failed authentication");
+    }
+    return rocksdb::Status::OK();
+  }
+
+ private:
+  static const unsigned char* bytes(const char* p) {
+    return reinterpret_cast<const unsigned char*>(p);
+  }
+  static unsigned char* mutableBytes(char* p) {
+    return reinterpret_cast<unsigned char*>(p);
+  }
+
+  // The additional data binds a frame to its position in the file and to
+  // its length, so that frames cannot be reordered or truncated.
+  static void makeAAD(uint64_t ordinal, uint32_t n, char* aad) {
+    putU64(aad, ordinal);
+    putU32(aad + 8, n);
+  }
+
+  static void makeNonce(uint64_t seq, char* nonce) {
+    memset(nonce, 0, kNonceSize);
+    putU64(nonce + kNonceSize - 8, seq);
+  }
+
+  const EVP_CIPHER* aead_;
+  std::string key_;
+};
+
+// keyRegistry holds the keys which can be used to encrypt and decrypt
+// files, indexed by key ID. Keys are registered from Go when the key
+// files are loaded and are never removed.
+struct keyRegistry {
+  std::mutex mu;
+  std::map<std::string, std::string> keys;
+};
+
+keyRegistry* getKeyRegistry() {
+  static keyRegistry* registry = new keyRegistry;
+  return registry;
+}
+
+bool lookupKey(const std::string& key_id, std::string* key) {
+  keyRegistry* registry = getKeyRegistry();
+  std::lock_guard<std::mutex> guard(registry->mu);
+  auto it = registry->keys.find(key_id);
+  if (it == registry->keys.end()) {
+    return false;
+  }
+  *key = it->second;
+  return true;
+}
+
+// encryptionParams holds the per-file parameters recorded in the
+// encryption header along with the file's cipher, which is set up once
+// when the file is opened.
+struct encryptionParams {
+  std::string key_id;
+  std::string iv;
+  std::shared_ptr<const fileCipher> cipher;
+};
+
+rocksdb::Status initCipher(const std::string& fname, encryptionParams* params) {
+  std::string key;
+  if (!lookupKey(params->key_id, &key)) {
+    return rocksdb::Status::InvalidArgument(fname, "unknown encryption key " + params->key_id);
+  }
+  std::shared_ptr<fileCipher> cipher(new fileCipher);
+  if (!cipher->Init(key, params->iv)) {
+    return rocksdb::Status::InvalidArgument(fname, "invalid encryption key " + params->key_id);
+  }
+  params->cipher = cipher;
+  return rocksdb::Status::OK();
+}
+
+std::string encodeHeader(const encryptionParams& params) {
+  std::string header(kEncryptionHeaderSize, '\0');
+  memcpy(&header[0], kEncryptionMagic, kEncryptionMagicSize);
+  header[kEncryptionMagicSize] = char(params.key_id.size());
+  memcpy(&header[kEncryptionKeyIDOffset], params.key_id.data(), params.key_id.size());
+  memcpy(&header[kEncryptionIVOffset], params.iv.data(), kEncryptionIVSize);
+  return header;
+}
+
+rocksdb::Status decodeHeader(const std::string& fname, const rocksdb::Slice& header,
+                             encryptionParams* params) {
+  if (header.size() != kEncryptionHeaderSize ||
+      memcmp(header.data(), kEncryptionMagic, kEncryptionMagicSize) != 0) {
+    return rocksdb::Status::Corruption(fname, "file is not encrypted");
+  }
+  size_t key_id_len = uint8_t(header[kEncryptionMagicSize]);
+  if (key_id_len == 0 || key_id_len > kEncryptionMaxKeyIDSize) {
+    return rocksdb::Status::Corruption(fname, "invalid encryption key ID");
+  }
+  params->key_id.assign(header.data() + kEncryptionKeyIDOffset, key_id_len);
+  params->iv.assign(header.data() + kEncryptionIVOffset, kEncryptionIVSize);
+  return initCipher(fname, params);
+}
+
+// frameDataSize validates the header of the frame at the start of the
+// specified bytes and returns the length of its data, or 0 if the frame is
+// incomplete.
+rocksdb::Status frameDataSize(const rocksdb::Slice& frame, size_t* n) {
+  *n = 0;
+  if (frame.size() < kFrameHeaderSize) {
+    return rocksdb::Status::OK();
+  }
+  const size_t len = getU32(frame.data());
+  if (len == 0 || len > kChunkSize) {
+    return rocksdb::Status::Corruption("invalid encrypted chunk length");
+  }
+  if (frame.size() >= kFrameHeaderSize + len + kTagSize) {
+    *n = len;
+  }
+  return rocksdb::Status::OK();
+}
+
+// isRandomAccessFile returns whether RocksDB reads the file with the
+// specified name at arbitrary offsets, which requires all of its chunks
+// but the last one to be full.
+bool isRandomAccessFile(const std::string& fname) {
+  const std::string suffix = ".sst";
+  return fname.size() >= suffix.size() &&
+      fname.compare(fname.size() - suffix.size(), suffix.size(), suffix) == 0;
+}
+
+// EncryptedWritableFile encrypts all data appended to it. Data is
+// buffered until a chunk is full. Partial chunks are written when the
+// file is synced or closed and, unless the file is read at arbitrary
+// offsets, when it is flushed.
+class EncryptedWritableFile : public rocksdb::WritableFile {
+ public:
+  EncryptedWritableFile(std::unique_ptr<rocksdb::WritableFile>&& base,
+                        const encryptionParams& params, bool flush_partial_chunks)
+      : base_(std::move(base)),
+        params_(params),
+        flush_partial_chunks_(flush_partial_chunks),
+        offset_(0),
+        frames_(0),
+        next_seq_(0),
+        physical_size_(kEncryptionHeaderSize),
+        last_frame_offset_(0),
+        last_frame_physical_offset_(0),
+        has_last_frame_(false) {
+  }
+
+  rocksdb::Status Append(const rocksdb::Slice& data) override {
+    pending_.append(data.data(), data.size());
+    offset_ += data.size();
+    return writeChunks(false);
+  }
+  rocksdb::Status PositionedAppend(const rocksdb::Slice& data, uint64_t offset) override {
+    return rocksdb::Status::NotSupported("positioned appends to encrypted files");
+  }
+  rocksdb::Status Truncate(uint64_t size) override {
+    if (size > offset_) {
+      return rocksdb::Status::InvalidArgument("cannot extend encrypted file by truncation");
+    }
+    const uint64_t pending_offset = offset_ - pending_.size();
+    if (size >= pending_offset) {
+      // Only buffered data is discarded.
+      pending_.resize(size - pending_offset);
+      offset_ = size;
+      return rocksdb::Status::OK();
+    }
+    if (!has_last_frame_ || size < last_frame_offset_) {
+      return rocksdb::Status::NotSupported(
+          "encrypted files can only be truncated within their last chunk");
+    }
+    // Remove the last frame from the file and buffer the part of its data
+    // which is retained, to be written again in a frame with a new
+    // sequence number.
+    rocksdb::Status s = base_->Truncate(last_frame_physical_offset_);
+    if (!s.ok()) {
+      return s;
+    }
+    pending_.assign(last_frame_.data(), size - last_frame_offset_);
+    offset_ = size;
+    physical_size_ = last_frame_physical_offset_;
+    frames_--;
+    has_last_frame_ = false;
+    return s;
+  }
+  rocksdb::Status Close() override {
+    rocksdb::Status s = writeChunks(true);
+    if (!s.ok()) {
+      return s;
+    }
+    return base_->Close();
+  }
+  rocksdb::Status Flush() override {
+    rocksdb::Status s = writeChunks(flush_partial_chunks_);
+    if (!s.ok()) {
+      return s;
+    }
+    return base_->Flush();
+  }
+  rocksdb::Status Sync() override {
+    rocksdb::Status s = writeChunks(true);
+    if (!s.ok()) {
+      return s;
+    }
+    return base_->Sync();
+  }
+  rocksdb::Status Fsync() override {
+    rocksdb::Status s = writeChunks(true);
+    if (!s.ok()) {
+      return s;
+    }
+    return base_->Fsync();
+  }
+  bool IsSyncThreadSafe() const override { return false; }
+  uint64_t GetFileSize() override { return offset_; }
+
+ private:
+  // writeChunks writes the full chunks of buffered data and, if partial is
+  // true, the remaining buffered data as a partial chunk.
+  rocksdb::Status writeChunks(bool partial) {
+    size_t written = 0;
+    rocksdb::Status s;
+    while (s.ok() && written < pending_.size()) {
+      const size_t n = std::min(kChunkSize, pending_.size() - written);
+      if (n < kChunkSize && !partial) {
+        break;
+      }
+      frame_.clear();
+      s = params_.cipher->Seal(frames_, next_seq_++, pending_.data() + written, n, &frame_);
+      if (s.ok()) {
+        s = base_->Append(frame_);
+      }
+      if (s.ok()) {
+        last_frame_.assign(pending_.data() + written, n);
+        last_frame_offset_ = offset_ - (pending_.size() - written);
+        last_frame_physical_offset_ = physical_size_;
+        has_last_frame_ = true;
+        physical_size_ += frame_.size();
+        frames_++;
+        written += n;
+      }
+    }
+    pending_.erase(0, written);
+    return s;
+  }
+
+  std::unique_ptr<rocksdb::WritableFile> base_;
+  const encryptionParams params_;
+  const bool flush_partial_chunks_;
+  // The logical size of the file, including buffered data.
+  uint64_t offset_;
+  // The number of frames written and the sequence number of the next
+  // frame. Sequence numbers are not reused when a frame is truncated.
+  uint64_t frames_;
+  uint64_t next_seq_;
+  uint64_t physical_size_;
+  std::string pending_;
+  std::string frame_;
+  // The data and location of the last frame written, which is retained to
+  // support truncation within it.
+  std::string last_frame_;
+  uint64_t last_frame_offset_;
+  uint64_t last_frame_physical_offset_;
+  bool has_last_frame_;
+};
+
+// EncryptedSequentialFile decrypts data as it is read. An incomplete
+// frame at the end of the file, as left behind by a crash, is treated as
+// the end of the file.
+class EncryptedSequentialFile : public rocksdb::SequentialFile {
+ public:
+  EncryptedSequentialFile(std::unique_ptr<rocksdb::SequentialFile>&& base,
+                          const encryptionParams& params)
+      : base_(std::move(base)),
+        params_(params),
+        frames_(0),
+        pos_(0) {
+  }
+
+  rocksdb::Status Read(size_t n, rocksdb::Slice* result, char* scratch) override {
+    size_t read = 0;
+    rocksdb::Status s = consume(n, scratch, &read);
+    *result = rocksdb::Slice(scratch, read);
+    return s;
+  }
+  rocksdb::Status Skip(uint64_t n) override {
+    size_t skipped = 0;
+    return consume(n, nullptr, &skipped);
+  }
+
+ private:
+  // consume reads up to n bytes into out, or skips them if out is null.
+  rocksdb::Status consume(uint64_t n, char* out, size_t* consumed) {
+    while (*consumed < n) {
+      if (pos_ == chunk_.size()) {
+        bool eof = false;
+        rocksdb::Status s = readChunk(&eof);
+        if (!s.ok() || eof) {
+          return s;
+        }
+      }
+      const size_t m = size_t(std::min<uint64_t>(n - *consumed, chunk_.size() - pos_));
+      if (out != nullptr) {
+        memcpy(out + *consumed, chunk_.data() + pos_, m);
+      }
+      pos_ += m;
+      *consumed += m;
+    }
+    return rocksdb::Status::OK();
+  }
+
+  rocksdb::Status readChunk(bool* eof) {
+    frame_.resize(kFrameSize);
+    rocksdb::Slice header;
+    rocksdb::Status s = base_->Read(kFrameHeaderSize, &header, &frame_[0]);
+    if (!s.ok()) {
+      return s;
+    }
+    if (header.size() < kFrameHeaderSize) {
+      *eof = true;
+      return s;
+    }
+    if (header.data() != frame_.data()) {
+      memmove(&frame_[0], header.data(), header.size());
+    }
+    const size_t len = getU32(frame_.data());
+    if (len == 0 || len > kChunkSize) {
+      return rocksdb::Status::Corruption("invalid encrypted chunk length");
+    }
+    rocksdb::Slice body;
+    s = base_->Read(len + kTagSize, &body, &frame_[kFrameHeaderSize]);
+    if (!s.ok()) {
+      return s;
+    }
+    if (body.size() < len + kTagSize) {
+      *eof = true;
+      return s;
+    }
+    if (body.data() != frame_.data() + kFrameHeaderSize) {
+      memmove(&frame_[kFrameHeaderSize], body.data(), body.size());
+    }
+    chunk_.resize(len);
+    s = params_.cipher->Open(frames_, frame_.data(), len, &chunk_[0]);
+    if (!s.ok()) {
+      chunk_.clear();
+      return s;
+    }
+    frames_++;
+    pos_ = 0;
+    return s;
+  }
+
+  std::unique_ptr<rocksdb::SequentialFile> base_;
+  const encryptionParams params_;
+  uint64_t frames_;
+  std::string frame_;
+  // The decrypted data of the current chunk and the position of the next
+  // byte to read from it.
+  std::string chunk_;
+  size_t pos_;
+};
+
+// EncryptedRandomAccessFile decrypts data as it is read. It requires all
+// chunks of the file but the last one to be full.
+class EncryptedRandomAccessFile : public rocksdb::RandomAccessFile {
+ public:
+  EncryptedRandomAccessFile(std::unique_ptr<rocksdb::RandomAccessFile>&& base,
+                            const encryptionParams& params)
+      : base_(std::move(base)),
+        params_(params) {
+  }
+
+  rocksdb::Status Read(uint64_t offset, size_t n, rocksdb::Slice* result,
+                       char* scratch) const override {
+    *result = rocksdb::Slice(scratch, 0);
+    if (n == 0) {
+      return rocksdb::Status::OK();
+    }
+    const uint64_t first = offset / kChunkSize;
+    const uint64_t last = (offset + n - 1) / kChunkSize;
+    std::string buf((last - first + 1) * kFrameSize, '\0');
+    rocksdb::Slice raw;
+    rocksdb::Status s = base_->Read(kEncryptionHeaderSize + first * kFrameSize, buf.size(),
+                                    &raw, &buf[0]);
+    if (!s.ok()) {
+      return s;
+    }
+    std::string chunk(kChunkSize, '\0');
+    size_t read = 0;
+    for (uint64_t i = first; i <= last && !raw.empty(); i++) {
+      size_t len = 0;
+      s = frameDataSize(raw, &len);
+      if (!s.ok()) {
+        return s;
+      }
+      if (len == 0) {
+        return rocksdb::Status::Corruption("incomplete encrypted chunk");
+      }
+      const size_t frame_size = kFrameHeaderSize + len + kTagSize;
+      if (len < kChunkSize && raw.size() > frame_size) {
+        return rocksdb::Status::Corruption("unexpected partial encrypted chunk");
+      }
+      s = params_.cipher->Open(i, raw.data(), len, &chunk[0]);
+      if (!s.ok()) {
+        return s;
+      }
+      const size_t start = i == first ? size_t(offset % kChunkSize) : 0;
+      if (start >= len) {
+        break;
+      }
+      const size_t m = std::min(len - start, n - read);
+      memcpy(scratch + read, chunk.data() + start, m);
+      read += m;
+      if (len < kChunkSize) {
+        // This was the last chunk of the file.
+        break;
+      }
+      raw.remove_prefix(frame_size);
+    }
+    *result = rocksdb::Slice(scratch, read);
+    return s;
+  }
+  size_t GetUniqueId(char* id, size_t max_size) const override {
+    return base_->GetUniqueId(id, max_size);
+  }
+  void Hint(AccessPattern pattern) override { base_->Hint(pattern); }
+
+ private:
+  std::unique_ptr<rocksdb::RandomAccessFile> base_;
+  const encryptionParams params_;
+};
+
+// EncryptedEnv wraps a base Env, encrypting every file created through
+// it with the active key and decrypting files with whichever key they
+// were written with.
+class EncryptedEnv : public rocksdb::EnvWrapper {
+ public:
+  EncryptedEnv(rocksdb::Env* base, const std::string& active_key_id)
+      : rocksdb::EnvWrapper(base),
+        active_key_id_(active_key_id) {
+  }
+
+  rocksdb::Status NewWritableFile(const std::string& fname,
+                                  std::unique_ptr<rocksdb::WritableFile>* result,
+                                  const rocksdb::EnvOptions& options) override {
+    encryptionParams params;
+    params.key_id = active_key_id_;
+    params.iv.resize(kEncryptionIVSize);
+    if (RAND_bytes(reinterpret_cast<unsigned char*>(&params.iv[0]), int(params.iv.size())) != 1) {
+      return rocksdb::Status::IOError(fname, "unable to generate encryption IV");
+    }
+    rocksdb::Status s = initCipher(fname, &params);
+    if (!s.ok()) {
+      return s;
+    }
+    std::unique_ptr<rocksdb::WritableFile> base;
+    s = target()->NewWritableFile(fname, &base, options);
+    if (!s.ok()) {
+      return s;
+    }
+    s = base->Append(encodeHeader(params));
+    if (!s.ok()) {
+      return s;
+    }
+    result->reset(new EncryptedWritableFile(std::move(base), params, !isRandomAccessFile(fname)));
+    return rocksdb::Status::OK();
+  }
+
+  rocksdb::Status ReuseWritableFile(const std::string& fname,
+                                    const std::string& old_fname,
+                                    std::unique_ptr<rocksdb::WritableFile>* result,
+                                    const rocksdb::EnvOptions& options) override {
+    // A recycled file is given a fresh IV, and thus a fresh file key.
+    rocksdb::Status s = target()->RenameFile(old_fname, fname);
+    if (!s.ok()) {
+      return s;
+    }
+    return NewWritableFile(fname, result, options);
+  }
+
+  rocksdb::Status NewSequentialFile(const std::string& fname,
+                                    std::unique_ptr<rocksdb::SequentialFile>* result,
+                                    const rocksdb::EnvOptions& options) override {
+    std::unique_ptr<rocksdb::SequentialFile> base;
+    rocksdb::Status s = target()->NewSequentialFile(fname, &base, options);
+    if (!s.ok()) {
+      return s;
+    }
+    char scratch[kEncryptionHeaderSize];
+    rocksdb::Slice header;
+    s = base->Read(kEncryptionHeaderSize, &header, scratch);
+    if (!s.ok()) {
+      return s;
+    }
+    encryptionParams params;
+    s = decodeHeader(fname, header, &params);
+    if (!s.ok()) {
+      return s;
+    }
+    result->reset(new EncryptedSequentialFile(std::move(base), params));
+    return rocksdb::Status::OK();
+  }
+
+  rocksdb::Status NewRandomAccessFile(const std::string& fname,
+                                      std::unique_ptr<rocksdb::RandomAccessFile>* result,
+                                      const rocksdb::EnvOptions& options) override {
+    std::unique_ptr<rocksdb::RandomAccessFile> base;
+    rocksdb::Status s = target()->NewRandomAccessFile(fname, &base, options);
+    if (!s.ok()) {
+      return s;
+    }
+    char scratch[kEncryptionHeaderSize];
+    rocksdb::Slice header;
+    s = base->Read(0, kEncryptionHeaderSize, &header, scratch);
+    if (!s.ok()) {
+      return s;
+    }
+    encryptionParams params;
+    s = decodeHeader(fname, header, &params);
+    if (!s.ok()) {
+      return s;
+    }
+    result->reset(new EncryptedRandomAccessFile(std::move(base), params));
+    return rocksdb::Status::OK();
+  }
+
+  rocksdb::Status GetFileSize(const std::string& fname, uint64_t* size) override {
+    rocksdb::Status s = target()->GetFileSize(fname, size);
+    if (!s.ok()) {
+      return s;
+    }
+    *size = logicalSize(*size);
+    return s;
+  }
+
+  rocksdb::Status GetChildrenFileAttributes(
+      const std::string& dir, std::vector<FileAttributes>* result) override {
+    rocksdb::Status s = target()->GetChildrenFileAttributes(dir, result);
+    if (!s.ok()) {
+      return s;
+    }
+    for (auto& attrs : *result) {
+      attrs.size_bytes = logicalSize(attrs.size_bytes);
+    }
+    return s;
+  }
+
+ private:
+  // logicalSize returns the size of the data stored in an encrypted file of
+  // the specified size. It is exact for files whose chunks are all full but
+  // the last one, and an upper bound otherwise.
+  static uint64_t logicalSize(uint64_t size) {
+    if (size < kEncryptionHeaderSize) {
+      return 0;
+    }
+    size -= kEncryptionHeaderSize;
+    const uint64_t rem = size % kFrameSize;
+    const uint64_t overhead = kFrameHeaderSize + kTagSize;
+    return (size / kFrameSize) * kChunkSize + (rem > overhead ? rem - overhead : 0);
+  }
+
+  const std::string active_key_id_;
+};
+
+}  // namespace
+
+bool RegisterEncryptionKey(const std::string& key_id, const std::string& key) {
+  if (key.size() != 16 && key.size() != 24 && key.size() != 32) {
+    return false;
+  }
+  keyRegistry* registry = getKeyRegistry();
+  std::lock_guard<std::mutex> guard(registry->mu);
+  registry->keys[key_id] = key;
+  return true;
+}
+
+rocksdb::Env* NewEncryptedEnv(rocksdb::Env* base, const std::string& active_key_id) {
+  return new EncryptedEnv(base, active_key_id);
+}
@@ -0,0 +1,51 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.  See the License for the specific language governing
+// permissions and limitations under the License.
+
+#ifndef ROACHLIB_ENCRYPTION_H
+#define ROACHLIB_ENCRYPTION_H
+
+#include <string>
+
+#include <rocksdb/env.h>
+
+// kEncryptionHeaderSize is the size of the plaintext header written at
+// the start of every encrypted file. The header layout is:
+//
+//   [0, 8)    magic ("crdbenc1")
+//   [8]       length of the key ID
+//   [9, 48)   key ID, zero padded
+//   [48, 64)  initialization vector
+//
+// The header is read by the Go side (see engine/encryption.go) when
+// reporting encryption status, so the two must be kept in sync. The header
+// is followed by the file's data, encrypted and authenticated in chunks
+// with AES-GCM under a key derived from the store key and the IV (see
+// encryption.cc). Data which was tampered with fails to decrypt with a
+// Corruption status.
+const size_t kEncryptionHeaderSize = 64;
+
+// RegisterEncryptionKey makes the AES key with the specified ID
+// available for encrypting and decrypting files. The key must be 16, 24
+// or 32 bytes long, selecting AES-128, AES-192 or AES-256. Returns false
+// if the key is invalid.
+bool RegisterEncryptionKey(const std::string& key_id, const std::string& key);
+
+// NewEncryptedEnv returns an Env which transparently encrypts all files
+// created through it with the key identified by active_key_id. Files
+// written with other keys remain readable as long as those keys have
+// been registered, which allows keys to be rotated by rewriting files in
+// the background. The returned Env does not take ownership of base.
+rocksdb::Env* NewEncryptedEnv(rocksdb::Env* base, const std::string& active_key_id);
+
+#endif // ROACHLIB_ENCRYPTION_H
@@ -16,12 +16,15 @@
 
 #include <rocksdb/table_properties.h>
 #include "eventlistener.h"
+#include "_cgo_export.h"
 
 static const bool kDebug = false;
 
-DBEventListener::DBEventListener()
-  : flushes_(0),
-    compactions_(0) {
+DBEventListener::DBEventListener(int listener_id)
+  : listener_id_(listener_id),
+    flushes_(0),
+    compactions_(0),
+    stall_condition_(kWriteStallNormal) {
 }
 
 void DBEventListener::OnFlushCompleted(rocksdb::DB* db, const rocksdb::FlushJobInfo& flush_job_info) {
@@ -34,6 +37,15 @@ void DBEventListener::OnFlushCompleted(rocksdb::DB* db, const rocksdb::FlushJobI
             p.index_size / float(p.num_entries),
             p.filter_size / float(p.num_entries));
   }
+
+  if (listener_id_ != 0) {
+    const rocksdb::TableProperties &p = flush_job_info.table_properties;
+    rocksDBEvent(listener_id_, kEventFlushCompleted, flush_job_info.job_id,
+                 0 /* output level */, 0 /* input files */, 1 /* output files */,
+                 0 /* input bytes */, p.data_size + p.index_size + p.filter_size,
+                 0 /* micros */, kWriteStallNormal);
+    CheckWriteStall(db);
+  }
 }
 
 void DBEventListener::OnCompactionCompleted(rocksdb::DB* db, const rocksdb::CompactionJobInfo& ci) {
@@ -49,6 +61,57 @@ void DBEventListener::OnCompactionCompleted(rocksdb::DB* db, const rocksdb::Comp
               p.filter_size / float(p.num_entries));
     }
   }
+
+  if (listener_id_ != 0) {
+    {
+      std::lock_guard<std::mutex> guard(mu_);
+      if (compaction_jobs_.erase(ci.job_id) == 0) {
+        // A compaction which did not write any output files (for
+        // example, one which only deleted obsolete data) still needs a
+        // matching start event.
+        rocksDBEvent(listener_id_, kEventCompactionStarted, ci.job_id, ci.output_level,
+                     0, 0, 0, 0, 0, kWriteStallNormal);
+      }
+    }
+    rocksDBEvent(listener_id_, kEventCompactionCompleted, ci.job_id, ci.output_level,
+                 int(ci.input_files.size()), int(ci.output_files.size()),
+                 ci.stats.total_input_bytes, ci.stats.total_output_bytes,
+                 ci.stats.elapsed_micros, kWriteStallNormal);
+    CheckWriteStall(db);
+  }
+}
+
+void DBEventListener::OnTableFileCreationStarted(const rocksdb::TableFileCreationBriefInfo& info) {
+  if (listener_id_ == 0 || info.reason != rocksdb::TableFileCreationReason::kCompaction) {
+    return;
+  }
+  std::lock_guard<std::mutex> guard(mu_);
+  if (compaction_jobs_.insert(info.job_id).second) {
+    rocksDBEvent(listener_id_, kEventCompactionStarted, info.job_id, 0 /* output level */,
+                 0, 0, 0, 0, 0, kWriteStallNormal);
+  }
+}
+
+void DBEventListener::CheckWriteStall(rocksdb::DB* db) {
+  uint64_t stopped = 0;
+  uint64_t delayed_rate = 0;
+  if (!db->GetIntProperty("rocksdb.is-write-stopped", &stopped) ||
+      !db->GetIntProperty("rocksdb.actual-delayed-write-rate", &delayed_rate)) {
+    return;
+  }
+  DBWriteStallCondition condition = kWriteStallNormal;
+  if (stopped != 0) {
+    condition = kWriteStallStopped;
+  } else if (delayed_rate != 0) {
+    condition = kWriteStallDelayed;
+  }
+
+  std::lock_guard<std::mutex> guard(mu_);
+  if (condition == stall_condition_) {
+    return;
+  }
+  stall_condition_ = condition;
+  rocksDBEvent(listener_id_, kEventWriteStallChanged, 0, 0, 0, 0, 0, 0, 0, condition);
 }
 
 uint64_t DBEventListener::GetFlushes() const {
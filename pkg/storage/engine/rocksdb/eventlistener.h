@@ -18,15 +18,37 @@
 #define ROACHLIB_EVENTLISTENER_H
 
 #include <atomic>
+#include <mutex>
+#include <set>
 
 #include <rocksdb/db.h>
 
-// DBEventListener is an implementation of RocksDB's EventListener interface
-// used to collect information on RocksDB events that could be of interest
-// to CockroachDB users.
+// The types of events reported to Go. These must be kept in sync with
+// the EventType constants in engine/event_listener.go.
+enum DBEventType {
+  kEventFlushCompleted = 0,
+  kEventCompactionStarted = 1,
+  kEventCompactionCompleted = 2,
+  kEventWriteStallChanged = 3,
+};
+
+// The write stall conditions reported to Go. These must be kept in
+// sync with the WriteStallCondition constants in
+// engine/event_listener.go.
+enum DBWriteStallCondition {
+  kWriteStallNormal = 0,
+  kWriteStallDelayed = 1,
+  kWriteStallStopped = 2,
+};
+
+// DBEventListener is an implementation of RocksDB's EventListener
+// interface which counts flushes and compactions and, if given a
+// non-zero listener ID, reports flushes, compactions and changes to
+// the write stall condition to the Go listener registered with that
+// ID.
 class DBEventListener : public rocksdb::EventListener {
  public:
-  DBEventListener();
+  DBEventListener(int listener_id);
   virtual ~DBEventListener() { }
 
   uint64_t GetFlushes() const;
@@ -35,10 +57,24 @@ class DBEventListener : public rocksdb::EventListener {
   // EventListener methods.
   virtual void OnFlushCompleted(rocksdb::DB* db, const rocksdb::FlushJobInfo& flush_job_info) override;
   virtual void OnCompactionCompleted(rocksdb::DB* db, const rocksdb::CompactionJobInfo& ci) override;
+  virtual void OnTableFileCreationStarted(const rocksdb::TableFileCreationBriefInfo& info) override;
 
  private:
+  // CheckWriteStall reports a change to the write stall condition of
+  // db, if any.
+  void CheckWriteStall(rocksdb::DB* db);
+
+  const int listener_id_;
   std::atomic<uint64_t> flushes_;
   std::atomic<uint64_t> compactions_;
+
+  std::mutex mu_;
+  // The IDs of the compaction jobs which have been reported as started
+  // but have not completed yet. RocksDB does not notify listeners when
+  // a compaction starts, so a compaction is considered started when it
+  // begins writing its first output file.
+  std::set<int> compaction_jobs_;
+  DBWriteStallCondition stall_condition_;
 };
 
 
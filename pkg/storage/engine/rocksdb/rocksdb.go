@@ -17,6 +17,9 @@
 package rocksdb
 
 import (
+	"errors"
+	"unsafe"
+
 	// Link against the protobuf, rocksdb, and snappy libraries. This is
 	// explicit because these Go libraries do not export any Go symbols.
 	_ "github.com/cockroachdb/c-protobuf"
@@ -28,8 +31,14 @@ import (
 // #cgo darwin LDFLAGS: -Wl,-undefined -Wl,dynamic_lookup
 // #cgo !darwin LDFLAGS: -Wl,-unresolved-symbols=ignore-all
 // #cgo linux LDFLAGS: -lrt
+// #cgo LDFLAGS: -lcrypto
+// #include <stdint.h>
+// #include <stdlib.h>
 import "C"
 
+// maxArrayLen is a safe maximum length for slices backed by C memory.
+const maxArrayLen = 1<<31 - 1
+
 // Logger is a logging function to be set by the importing package. Its
 // presence allows us to avoid depending on a logging package.
 var Logger = func(string, ...interface{}) {}
@@ -40,3 +49,84 @@ func rocksDBLog(s *C.char, n C.int) {
 	// when RocksDB.Open() is called.
 	Logger("%s", C.GoStringN(s, n))
 }
+
+// Merge is a merge function to be set by the importing package. It merges
+// operand into existing using the merge operator with the specified ID,
+// both of which are the raw bytes of MVCC values. Its presence allows merge
+// semantics to be implemented in Go.
+var Merge = func(id int, existing, operand []byte) ([]byte, error) {
+	return nil, errors.New("no merge operators are registered")
+}
+
+//export rocksDBMerge
+func rocksDBMerge(
+	id C.int,
+	existing *C.char,
+	existingLen C.int,
+	operand *C.char,
+	operandLen C.int,
+	result **C.char,
+	resultLen *C.int,
+) *C.char {
+	// C.GoBytes never returns nil, so a missing existing value must be
+	// translated explicitly.
+	var existingBytes []byte
+	if existing != nil {
+		existingBytes = C.GoBytes(unsafe.Pointer(existing), existingLen)
+	}
+	merged, err := Merge(int(id), existingBytes, C.GoBytes(unsafe.Pointer(operand), operandLen))
+	if err != nil {
+		// The caller is responsible for freeing the returned string.
+		return C.CString(err.Error())
+	}
+	// The caller is responsible for freeing the result.
+	*result = (*C.char)(C.CBytes(merged))
+	*resultLen = C.int(len(merged))
+	return nil
+}
+
+// EventInfo describes a background event in a RocksDB instance. The meaning
+// of the fields is defined by the engine package.
+type EventInfo struct {
+	Type           int
+	JobID          int
+	OutputLevel    int
+	InputFiles     int
+	OutputFiles    int
+	InputBytes     int64
+	OutputBytes    int64
+	Micros         int64
+	StallCondition int
+}
+
+// Event is a function to be set by the importing package. It is invoked
+// from RocksDB's background threads with the details of flushes, compactions
+// and changes to the write stall condition in the RocksDB instance with the
+// specified listener ID, and must not block.
+var Event = func(listenerID int, info EventInfo) {}
+
+//export rocksDBEvent
+func rocksDBEvent(
+	listenerID C.int,
+	eventType C.int,
+	jobID C.int,
+	outputLevel C.int,
+	inputFiles C.int,
+	outputFiles C.int,
+	inputBytes C.int64_t,
+	outputBytes C.int64_t,
+	micros C.int64_t,
+	stallCondition C.int,
+) {
+	Event(int(listenerID), EventInfo{
+		Type:           int(eventType),
+		JobID:          int(jobID),
+		OutputLevel:    int(outputLevel),
+		InputFiles:     int(inputFiles),
+		OutputFiles:    int(outputFiles),
+		InputBytes:     int64(inputBytes),
+		OutputBytes:    int64(outputBytes),
+		Micros:         int64(micros),
+		StallCondition: int(stallCondition),
+	})
+}
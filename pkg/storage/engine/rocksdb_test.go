@@ -23,6 +23,7 @@ import (
 	"math/rand"
 	"os"
 	"path/filepath"
+	"reflect"
 	"sort"
 	"strconv"
 	"testing"
@@ -573,3 +574,356 @@ func TestRocksDBTimeBound(t *testing.T) {
 		t.Fatalf("got max %v expected %v", sst.TsMax, maxTimestamp)
 	}
 }
+
+// writeTestSST writes the supplied keys, which must be sorted, to a new
+// sstable at path. The value for each key is the key itself.
+func writeTestSST(t *testing.T, path string, keys ...string) {
+	sst := MakeRocksDBSstFileWriter()
+	if err := sst.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range keys {
+		kv := MVCCKeyValue{Key: mvccKey(k), Value: []byte(k)}
+		if err := sst.Add(kv); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sst.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRocksDBIngestExternalFiles(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	dir, dirCleanup := testutils.TempDir(t, 0)
+	defer dirCleanup()
+
+	db, err := NewRocksDB(
+		roachpb.Attributes{}, filepath.Join(dir, "db"), RocksDBCache{}, 0, DefaultMaxOpenFiles)
+	if err != nil {
+		t.Fatalf("could not create new rocksdb db instance at %s: %v", dir, err)
+	}
+	defer db.Close()
+
+	exists := func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+
+	// Ingest two files with disjoint key ranges in a single call, one by
+	// copying and the other by moving.
+	copyPath := filepath.Join(dir, "copy.sst")
+	movePath := filepath.Join(dir, "move.sst")
+	writeTestSST(t, copyPath, "a", "b", "c")
+	writeTestSST(t, movePath, "d", "e")
+
+	if err := db.IngestExternalFiles([]string{copyPath}, false /* move */); err != nil {
+		t.Fatal(err)
+	}
+	if !exists(copyPath) {
+		t.Errorf("expected %s to remain after copying ingestion", copyPath)
+	}
+	if err := db.IngestExternalFiles([]string{movePath}, true /* move */); err != nil {
+		t.Fatal(err)
+	}
+	if exists(movePath) {
+		t.Errorf("expected %s to be removed after moving ingestion", movePath)
+	}
+
+	kvs, err := Scan(db, mvccKey("a"), mvccKey("z"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []string
+	for _, kv := range kvs {
+		found = append(found, string(kv.Value))
+	}
+	if expected := []string{"a", "b", "c", "d", "e"}; !reflect.DeepEqual(expected, found) {
+		t.Fatalf("expected %s, found %s", expected, found)
+	}
+
+	// Files with overlapping key ranges cannot be ingested together.
+	overlap1 := filepath.Join(dir, "overlap1.sst")
+	overlap2 := filepath.Join(dir, "overlap2.sst")
+	writeTestSST(t, overlap1, "m", "o")
+	writeTestSST(t, overlap2, "n", "p")
+	if err := db.IngestExternalFiles([]string{overlap1, overlap2}, false /* move */); err == nil {
+		t.Fatal("expected error ingesting files with overlapping key ranges")
+	}
+	if kvs, err := Scan(db, mvccKey("m"), mvccKey("z"), 0); err != nil {
+		t.Fatal(err)
+	} else if len(kvs) != 0 {
+		t.Fatalf("expected failed ingestion to be atomic, found %d keys", len(kvs))
+	}
+
+	// Ingesting nothing is a no-op.
+	if err := db.IngestExternalFiles(nil, true /* move */); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRocksDBCreateCheckpoint(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	dir, dirCleanup := testutils.TempDir(t, 0)
+	defer dirCleanup()
+
+	db, err := NewRocksDB(
+		roachpb.Attributes{}, filepath.Join(dir, "db"), RocksDBCache{}, 0, DefaultMaxOpenFiles)
+	if err != nil {
+		t.Fatalf("could not create new rocksdb db instance at %s: %v", dir, err)
+	}
+	defer db.Close()
+
+	// Write one key which is flushed to an sstable and another which is only
+	// present in the memtable/WAL. Both must be present in the checkpoint.
+	if err := db.Put(mvccKey("a"), []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put(mvccKey("b"), []byte("b")); err != nil {
+		t.Fatal(err)
+	}
+
+	checkpointDir := filepath.Join(dir, "checkpoint")
+	if err := db.CreateCheckpoint(checkpointDir); err != nil {
+		t.Fatal(err)
+	}
+	// Writes after the checkpoint must not be visible in it.
+	if err := db.Put(mvccKey("c"), []byte("c")); err != nil {
+		t.Fatal(err)
+	}
+	// A checkpoint cannot be created on top of an existing directory.
+	if err := db.CreateCheckpoint(checkpointDir); err == nil {
+		t.Fatal("expected error creating checkpoint in existing directory")
+	}
+
+	checkpoint, err := NewRocksDB(
+		roachpb.Attributes{}, checkpointDir, RocksDBCache{}, 0, DefaultMaxOpenFiles)
+	if err != nil {
+		t.Fatalf("could not open checkpoint at %s: %v", checkpointDir, err)
+	}
+	defer checkpoint.Close()
+
+	kvs, err := Scan(checkpoint, mvccKey("a"), mvccKey("z"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []string
+	for _, kv := range kvs {
+		found = append(found, string(kv.Value))
+	}
+	if expected := []string{"a", "b"}; !reflect.DeepEqual(expected, found) {
+		t.Fatalf("expected %s, found %s", expected, found)
+	}
+}
+
+func TestRocksDBCreateCheckpointInMem(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	db := NewInMem(roachpb.Attributes{}, testCacheSize)
+	defer db.Close()
+
+	if err := db.CreateCheckpoint(os.TempDir()); !testutils.IsError(err, "in-memory") {
+		t.Fatalf("expected in-memory error, got %v", err)
+	}
+}
+
+func TestRocksDBWALDir(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	dir, dirCleanup := testutils.TempDir(t, 0)
+	defer dirCleanup()
+
+	cfg := RocksDBConfig{
+		Dir:          filepath.Join(dir, "db"),
+		MaxOpenFiles: DefaultMaxOpenFiles,
+		WALDir:       filepath.Join(dir, "db"),
+	}
+	if _, err := NewRocksDBWithConfig(cfg, RocksDBCache{}); !testutils.IsError(err, "must be distinct") {
+		t.Fatalf("expected distinct WAL directory error, got %v", err)
+	}
+
+	cfg.WALDir = filepath.Join(dir, "wal")
+	db, err := NewRocksDBWithConfig(cfg, RocksDBCache{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put(mvccKey("a"), []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	countLogs := func(dir string) int {
+		logs, err := filepath.Glob(filepath.Join(dir, "*.log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(logs)
+	}
+	if n := countLogs(cfg.WALDir); n == 0 {
+		t.Fatalf("expected WAL files in %s", cfg.WALDir)
+	}
+	if n := countLogs(cfg.Dir); n != 0 {
+		t.Fatalf("expected no WAL files in %s, found %d", cfg.Dir, n)
+	}
+
+	// The unflushed write must be recovered from the WAL directory.
+	db, err = NewRocksDBWithConfig(cfg, RocksDBCache{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	val, err := db.Get(mvccKey("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(val) != "a" {
+		t.Fatalf("expected a, found %q", val)
+	}
+}
+
+func TestRocksDBCompactRange(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	db := NewInMem(roachpb.Attributes{}, 1<<20)
+	defer db.Close()
+
+	// Create several level 0 sstables spanning "a" through "d".
+	for _, k := range []string{"a", "b", "c", "d"} {
+		if err := db.Put(mvccKey(k), []byte(k)); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	countLevel0 := func() int {
+		var n int
+		for _, table := range db.GetSSTables() {
+			if table.Level == 0 {
+				n++
+			}
+		}
+		return n
+	}
+	if n := countLevel0(); n == 0 {
+		t.Fatal("expected level 0 sstables")
+	}
+	if err := db.CompactRange(nil, nil, true /* forceBottommost */); err != nil {
+		t.Fatal(err)
+	}
+	if n := countLevel0(); n != 0 {
+		t.Fatalf("expected no level 0 sstables after compaction, found %d", n)
+	}
+
+	// Compacting a bounded span must leave the data intact.
+	if err := db.CompactRange(roachpb.Key("b"), roachpb.Key("c"), false); err != nil {
+		t.Fatal(err)
+	}
+	kvs, err := Scan(db, mvccKey("a"), mvccKey("z"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kvs) != 4 {
+		t.Fatalf("expected 4 keys, found %d", len(kvs))
+	}
+}
+
+func TestRocksDBSetBackgroundRateLimit(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	dir, dirCleanup := testutils.TempDir(t, 0)
+	defer dirCleanup()
+
+	unlimited, err := NewRocksDB(
+		roachpb.Attributes{}, filepath.Join(dir, "unlimited"), RocksDBCache{}, 0, DefaultMaxOpenFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlimited.Close()
+	// A limit can be imposed on an engine opened without one.
+	if err := unlimited.SetBackgroundRateLimit(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+
+	limited, err := NewRocksDBWithConfig(RocksDBConfig{
+		Dir:                 filepath.Join(dir, "limited"),
+		MaxOpenFiles:        DefaultMaxOpenFiles,
+		BackgroundRateLimit: 1 << 20,
+	}, RocksDBCache{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer limited.Close()
+	if err := limited.SetBackgroundRateLimit(4 << 20); err != nil {
+		t.Fatal(err)
+	}
+	if err := limited.SetBackgroundRateLimit(-1); !testutils.IsError(err, "invalid rate limit") {
+		t.Fatalf("expected invalid rate limit error, got %v", err)
+	}
+
+	// Background work must still make progress under the limit.
+	if err := limited.Put(mvccKey("a"), []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := limited.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := limited.Compact(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRocksDBVerifyChecksums(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	dir, dirCleanup := testutils.TempDir(t, 0)
+	defer dirCleanup()
+
+	// Disable the block cache so that every verification reads from disk.
+	db, err := NewRocksDB(roachpb.Attributes{}, dir, RocksDBCache{}, 0, DefaultMaxOpenFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, k := range []string{"a", "b", "c"} {
+		if err := db.Put(mvccKey(k), []byte(k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := db.VerifyChecksums(nil, nil); err != nil {
+		t.Fatal(err)
+	} else if n == 0 {
+		t.Fatal("expected data to be verified")
+	}
+	if n, err := db.VerifyChecksums(roachpb.Key("x"), roachpb.Key("z")); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatalf("expected nothing to be verified in an empty span, got %d bytes", n)
+	}
+
+	// Corrupt the data block of the flushed sstable.
+	paths, err := filepath.Glob(filepath.Join(dir, "*.sst"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 {
+		t.Fatalf("expected 1 sstable, found %s", paths)
+	}
+	f, err := os.OpenFile(paths[0], os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte{0xff, 0xff, 0xff, 0xff}, 8); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.VerifyChecksums(nil, nil); !testutils.IsError(err, "[Cc]orruption") {
+		t.Fatalf("expected corruption error, got %v", err)
+	}
+}
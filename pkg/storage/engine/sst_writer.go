@@ -0,0 +1,152 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// SSTWriter builds an sstable holding MVCC key/value pairs in the encoding
+// used by the engine, suitable for passing to Engine.IngestExternalFiles.
+// Keys must be added in increasing order: by key, and then with the metadata
+// key first followed by versions from newest to oldest.
+//
+// Unlike RocksDBSstFileWriter, an SSTWriter validates the key order itself
+// and removes the partially-written file if it is abandoned, which makes it
+// the preferred way to produce sstables outside of the engine package.
+type SSTWriter struct {
+	fw   RocksDBSstFileWriter
+	path string
+	// firstKey and lastKey are the first and most recently added keys.
+	firstKey   MVCCKey
+	lastKey    MVCCKey
+	count      int64
+	estimate   int64
+	isFinished bool
+}
+
+// SSTInfo describes a finished sstable.
+type SSTInfo struct {
+	// Path is the location of the sstable.
+	Path string
+	// Count is the number of key/value pairs in the sstable.
+	Count int64
+	// DataSize is the total size of the keys and values in the sstable.
+	DataSize int64
+	// FileSize is the size of the sstable on disk.
+	FileSize int64
+	// FirstKey and LastKey are the smallest and largest keys in the sstable.
+	FirstKey, LastKey MVCCKey
+}
+
+// MakeSSTWriter creates an sstable at path, replacing any existing file. The
+// caller must call either Finish or Close on the returned writer.
+func MakeSSTWriter(path string) (*SSTWriter, error) {
+	w := &SSTWriter{fw: MakeRocksDBSstFileWriter(), path: path}
+	if err := w.fw.Open(path); err != nil {
+		_ = w.fw.Close()
+		_ = os.Remove(path)
+		return nil, errors.Wrapf(err, "could not create sstable at %q", path)
+	}
+	return w, nil
+}
+
+// Add appends a key/value pair to the sstable. An error is returned if the
+// key is not greater than the previously added key.
+func (w *SSTWriter) Add(kv MVCCKeyValue) error {
+	if w.isFinished {
+		return errors.New("cannot call Add on a finished writer")
+	}
+	if len(kv.Key.Key) == 0 {
+		return emptyKeyError()
+	}
+	if w.count > 0 && compareMVCCKeys(kv.Key, w.lastKey) <= 0 {
+		return errors.Errorf("keys must be added in strictly increasing order: %s is not after %s",
+			kv.Key, w.lastKey)
+	}
+	if err := w.fw.Add(kv); err != nil {
+		return err
+	}
+	if w.count == 0 {
+		w.firstKey = copyMVCCKey(kv.Key)
+	}
+	w.lastKey = copyMVCCKey(kv.Key)
+	w.count++
+	w.estimate += int64(kv.Key.EncodedSize()) + int64(len(kv.Value))
+	return nil
+}
+
+// copyMVCCKey returns a copy of key which does not share memory with it.
+func copyMVCCKey(key MVCCKey) MVCCKey {
+	return MVCCKey{Key: append([]byte(nil), key.Key...), Timestamp: key.Timestamp}
+}
+
+// Count returns the number of key/value pairs added so far.
+func (w *SSTWriter) Count() int64 {
+	return w.count
+}
+
+// EstimatedSize returns an estimate of the size of the sstable so far, which
+// is the total encoded size of the keys and values added to it. The sstable
+// on disk is usually somewhat smaller due to key prefix compression and
+// block compression.
+func (w *SSTWriter) EstimatedSize() int64 {
+	return w.estimate
+}
+
+// Finish completes the sstable, flushing it to disk, and returns a
+// description of it. At least one key/value pair must have been added. On
+// error the partially-written file is removed.
+func (w *SSTWriter) Finish() (SSTInfo, error) {
+	if w.isFinished {
+		return SSTInfo{}, errors.New("writer is already finished")
+	}
+	if w.count == 0 {
+		w.Close()
+		return SSTInfo{}, errors.New("cannot finish an empty sstable")
+	}
+	w.isFinished = true
+	if err := w.fw.Close(); err != nil {
+		_ = os.Remove(w.path)
+		return SSTInfo{}, errors.Wrapf(err, "could not finish sstable at %q", w.path)
+	}
+	fi, err := os.Stat(w.path)
+	if err != nil {
+		return SSTInfo{}, err
+	}
+	return SSTInfo{
+		Path:     w.path,
+		Count:    w.count,
+		DataSize: w.fw.DataSize,
+		FileSize: fi.Size(),
+		FirstKey: w.firstKey,
+		LastKey:  w.lastKey,
+	}, nil
+}
+
+// Close abandons an unfinished sstable, removing the partially-written file.
+// It is a no-op if Finish has been called, so it is safe to defer.
+func (w *SSTWriter) Close() {
+	if w.isFinished {
+		return
+	}
+	w.isFinished = true
+	// RocksDB refuses to finish an empty sstable, but the error is irrelevant
+	// as the file is removed regardless.
+	_ = w.fw.Close()
+	_ = os.Remove(w.path)
+}
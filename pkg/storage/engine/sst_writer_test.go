@@ -0,0 +1,127 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/testutils"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+)
+
+func TestSSTWriter(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	dir, dirCleanup := testutils.TempDir(t, 0)
+	defer dirCleanup()
+
+	kvs := []MVCCKeyValue{
+		{Key: MVCCKey{Key: roachpb.Key("a"), Timestamp: hlc.Timestamp{WallTime: 2}}, Value: []byte("a2")},
+		{Key: MVCCKey{Key: roachpb.Key("a"), Timestamp: hlc.Timestamp{WallTime: 1}}, Value: []byte("a1")},
+		{Key: MVCCKey{Key: roachpb.Key("b")}, Value: []byte("b")},
+	}
+
+	path := filepath.Join(dir, "data.sst")
+	sst, err := MakeSSTWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sst.Close()
+	var estimate int64
+	for _, kv := range kvs {
+		if err := sst.Add(kv); err != nil {
+			t.Fatal(err)
+		}
+		estimate += int64(kv.Key.EncodedSize()) + int64(len(kv.Value))
+	}
+	if sst.Count() != int64(len(kvs)) {
+		t.Errorf("expected count %d, got %d", len(kvs), sst.Count())
+	}
+	if sst.EstimatedSize() != estimate {
+		t.Errorf("expected estimated size %d, got %d", estimate, sst.EstimatedSize())
+	}
+
+	// Keys which are not in increasing order are rejected without
+	// invalidating the writer.
+	if err := sst.Add(kvs[1]); !testutils.IsError(err, "strictly increasing order") {
+		t.Fatalf("expected ordering error, got %v", err)
+	}
+
+	info, err := sst.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Count != int64(len(kvs)) || info.FileSize == 0 {
+		t.Errorf("unexpected sstable info %+v", info)
+	}
+	if !info.FirstKey.Equal(kvs[0].Key) || !info.LastKey.Equal(kvs[2].Key) {
+		t.Errorf("expected key bounds [%s,%s], got [%s,%s]",
+			kvs[0].Key, kvs[2].Key, info.FirstKey, info.LastKey)
+	}
+
+	db, err := NewRocksDB(
+		roachpb.Attributes{}, filepath.Join(dir, "db"), RocksDBCache{}, 0, DefaultMaxOpenFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.IngestExternalFiles([]string{info.Path}, false /* move */); err != nil {
+		t.Fatal(err)
+	}
+	found, err := Scan(db, MVCCKey{Key: roachpb.KeyMin}, MVCCKeyMax, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(kvs, found) {
+		t.Fatalf("expected %v, found %v", kvs, found)
+	}
+}
+
+func TestSSTWriterAbandon(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	dir, dirCleanup := testutils.TempDir(t, 0)
+	defer dirCleanup()
+
+	path := filepath.Join(dir, "data.sst")
+	sst, err := MakeSSTWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sst.Finish(); !testutils.IsError(err, "empty sstable") {
+		t.Fatalf("expected empty sstable error, got %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected %s to be removed, got %v", path, err)
+	}
+
+	sst, err = MakeSSTWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sst.Add(MVCCKeyValue{Key: mvccKey("a"), Value: []byte("a")}); err != nil {
+		t.Fatal(err)
+	}
+	sst.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected %s to be removed, got %v", path, err)
+	}
+	if err := sst.Add(MVCCKeyValue{Key: mvccKey("b"), Value: []byte("b")}); err == nil {
+		t.Fatal("expected error adding to a closed writer")
+	}
+}
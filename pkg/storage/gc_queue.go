@@ -34,6 +34,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/storage/engine"
 	"github.com/cockroachdb/cockroach/pkg/storage/engine/enginepb"
+	"github.com/cockroachdb/cockroach/pkg/util/envutil"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
@@ -51,6 +52,10 @@ const (
 	// intentAgeNormalization is the average age of outstanding intents
 	// which amount to a score of "1" added to total replica priority.
 	intentAgeNormalization = 24 * time.Hour // 1 day
+	// gcKeyOverheadBytes is the overhead, in bytes, assumed for each key
+	// in a GC request when chunking keys by size. It accounts for the encoded
+	// timestamp and protobuf framing.
+	gcKeyOverheadBytes = 16
 	// intentAgeThreshold is the threshold after which an extant intent
 	// will be resolved.
 	intentAgeThreshold = 2 * time.Hour // 2 hour
@@ -78,6 +83,15 @@ const (
 	gcTaskLimit = 25
 )
 
+var (
+	// gcMaxKeysPerRequest and gcMaxBytesPerRequest bound the number of keys
+	// and the size of the keys sent in a single GCRequest. Larger sets of GC'able
+	// keys are split across multiple requests so that each results in a raft
+	// command of bounded size.
+	gcMaxKeysPerRequest  = envutil.EnvOrDefaultInt("COCKROACH_GC_MAX_KEYS_PER_REQUEST", 10000)
+	gcMaxBytesPerRequest = envutil.EnvOrDefaultBytes("COCKROACH_GC_MAX_BYTES_PER_REQUEST", 1<<20)
+)
+
 // gcQueue manages a queue of replicas slated to be scanned in their
 // entirety using the MVCC versions iterator. The gc queue manages the
 // following tasks:
@@ -322,29 +336,59 @@ func (gcq *gcQueue) process(
 
 	info.updateMetrics(gcq.store.metrics)
 
-	var ba roachpb.BatchRequest
-	var gcArgs roachpb.GCRequest
-	// TODO(tschottdorf): This is one of these instances in which we want
-	// to be more careful that the request ends up on the correct Replica,
-	// and we might have to worry about mixing range-local and global keys
-	// in a batch which might end up spanning Ranges by the time it executes.
-	gcArgs.Key = desc.StartKey.AsRawKey()
-	gcArgs.EndKey = desc.EndKey.AsRawKey()
-	gcArgs.Keys = gcKeys
-	gcArgs.Threshold = info.Threshold
-	gcArgs.TxnSpanGCThreshold = info.TxnSpanGCThreshold
-
-	// Technically not needed since we're talking directly to the Range.
-	ba.RangeID = desc.RangeID
-	ba.Timestamp = now
-	ba.Add(&gcArgs)
-	if _, pErr := repl.Send(ctx, ba); pErr != nil {
-		log.ErrEvent(ctx, pErr.String())
-		return pErr.GoError()
+	// Send the GC'able keys in chunks of bounded size. If sending a chunk
+	// fails, the keys from the preceding chunks have already been collected
+	// and won't be returned by the next GC run, which thus resumes where this
+	// one left off.
+	chunks := chunkGCKeys(gcKeys, gcMaxKeysPerRequest, gcMaxBytesPerRequest)
+	for i, chunk := range chunks {
+		var ba roachpb.BatchRequest
+		var gcArgs roachpb.GCRequest
+		// TODO(tschottdorf): This is one of these instances in which we want
+		// to be more careful that the request ends up on the correct Replica,
+		// and we might have to worry about mixing range-local and global keys
+		// in a batch which might end up spanning Ranges by the time it executes.
+		gcArgs.Key = desc.StartKey.AsRawKey()
+		gcArgs.EndKey = desc.EndKey.AsRawKey()
+		gcArgs.Keys = chunk
+		// The thresholds are sent with every chunk. Applying them more than
+		// once is harmless as they are only ever ratcheted forward.
+		gcArgs.Threshold = info.Threshold
+		gcArgs.TxnSpanGCThreshold = info.TxnSpanGCThreshold
+
+		// Technically not needed since we're talking directly to the Range.
+		ba.RangeID = desc.RangeID
+		ba.Timestamp = now
+		ba.Add(&gcArgs)
+		if _, pErr := repl.Send(ctx, ba); pErr != nil {
+			log.ErrEventf(ctx, "GC request %d/%d failed: %s", i+1, len(chunks), pErr)
+			return pErr.GoError()
+		}
 	}
 	return nil
 }
 
+// chunkGCKeys splits keys into chunks containing at most maxKeys keys and, as
+// long as a single key doesn't exceed it, at most maxBytes bytes of keys. At
+// least one (possibly empty) chunk is always returned so that the GC
+// thresholds are sent even when there is nothing to collect.
+func chunkGCKeys(
+	keys []roachpb.GCRequest_GCKey, maxKeys int, maxBytes int64,
+) [][]roachpb.GCRequest_GCKey {
+	var chunks [][]roachpb.GCRequest_GCKey
+	var start int
+	var bytes int64
+	for i, k := range keys {
+		size := int64(len(k.Key)) + gcKeyOverheadBytes
+		if i > start && (i-start >= maxKeys || bytes+size > maxBytes) {
+			chunks = append(chunks, keys[start:i])
+			start, bytes = i, 0
+		}
+		bytes += size
+	}
+	return append(chunks, keys[start:])
+}
+
 // GCInfo contains statistics and insights from a GC run.
 type GCInfo struct {
 	// Now is the timestamp used for age computations.
@@ -477,7 +521,7 @@ func RunGC(
 		if len(keys) > 1 {
 			meta := &enginepb.MVCCMetadata{}
 			if err := proto.Unmarshal(vals[0], meta); err != nil {
-				log.Errorf(ctx, "unable to unmarshal MVCC metadata for key %q: %s", keys[0], err)
+				log.Errorf(ctx, "unable to unmarshal MVCC metadata for key %q: %s", log.Unsafe(keys[0]), err)
 			} else {
 				// In the event that there's an active intent, send for
 				// intent resolution if older than the threshold.
@@ -32,7 +32,6 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/storage/engine"
 	"github.com/cockroachdb/cockroach/pkg/storage/engine/enginepb"
 	"github.com/cockroachdb/cockroach/pkg/storage/storagebase"
-	"github.com/cockroachdb/cockroach/pkg/util"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
@@ -331,6 +330,57 @@ func TestGCQueueProcess(t *testing.T) {
 	}
 }
 
+// TestChunkGCKeys verifies that GC keys are split into chunks limited by
+// both their number and their size.
+func TestChunkGCKeys(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	makeKeys := func(sizes ...int) []roachpb.GCRequest_GCKey {
+		var keys []roachpb.GCRequest_GCKey
+		for _, size := range sizes {
+			keys = append(keys, roachpb.GCRequest_GCKey{Key: make(roachpb.Key, size)})
+		}
+		return keys
+	}
+	chunkSizes := func(chunks [][]roachpb.GCRequest_GCKey) []int {
+		var sizes []int
+		for _, c := range chunks {
+			sizes = append(sizes, len(c))
+		}
+		return sizes
+	}
+
+	testCases := []struct {
+		keys     []roachpb.GCRequest_GCKey
+		maxKeys  int
+		maxBytes int64
+		expected []int
+	}{
+		// No keys still results in a single (empty) request.
+		{nil, 10, 1000, []int{0}},
+		{makeKeys(4, 4, 4), 10, 1000, []int{3}},
+		// Limited by key count.
+		{makeKeys(4, 4, 4, 4, 4), 2, 1000, []int{2, 2, 1}},
+		// Limited by bytes: each key accounts for 4+gcKeyOverheadBytes bytes.
+		{makeKeys(4, 4, 4, 4, 4), 10, 2 * (4 + gcKeyOverheadBytes), []int{2, 2, 1}},
+		// A key larger than the byte limit gets a chunk of its own.
+		{makeKeys(4, 100, 4), 10, 2 * (4 + gcKeyOverheadBytes), []int{1, 1, 1}},
+	}
+	for i, c := range testCases {
+		chunks := chunkGCKeys(c.keys, c.maxKeys, c.maxBytes)
+		if sizes := chunkSizes(chunks); !reflect.DeepEqual(c.expected, sizes) {
+			t.Errorf("%d: expected chunk sizes %v, got %v", i, c.expected, sizes)
+		}
+		var total int
+		for _, chunk := range chunks {
+			total += len(chunk)
+		}
+		if total != len(c.keys) {
+			t.Errorf("%d: expected %d keys in chunks, got %d", i, len(c.keys), total)
+		}
+	}
+}
+
 func TestGCQueueTransactionTable(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 
@@ -496,7 +546,7 @@ func TestGCQueueTransactionTable(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	util.SucceedsSoon(t, func() error {
+	SucceedsSoon(t, func() error {
 		for strKey, sp := range testCases {
 			txn := &roachpb.Transaction{}
 			key := keys.TransactionKey(roachpb.Key(strKey), *txns[strKey].ID)
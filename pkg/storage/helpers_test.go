@@ -30,9 +30,27 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/internal/client"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/storage/engine/enginepb"
+	"github.com/cockroachdb/cockroach/pkg/util"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 )
 
+// succeedsSoonOptions are used by the tests in this directory to wait for
+// conditions. Logging the progress of slow conditions helps to tell stuck
+// tests from slow machines.
+var succeedsSoonOptions = util.SucceedsSoonOptions{ProgressInterval: 5 * time.Second}
+
+// SucceedsSoon is like util.SucceedsSoon, but with the options used by the
+// tests in this directory.
+func SucceedsSoon(t util.Tester, fn func() error) {
+	util.SucceedsSoonWithOptionsDepth(1, t, succeedsSoonOptions, fn)
+}
+
+// SucceedsSoonDepth is like SucceedsSoon but with an additional stack depth
+// offset.
+func SucceedsSoonDepth(depth int, t util.Tester, fn func() error) {
+	util.SucceedsSoonWithOptionsDepth(depth+1, t, succeedsSoonOptions, fn)
+}
+
 // AddReplica adds the replica to the store's replica map and to the sorted
 // replicasByKey slice. To be used only by unittests.
 func (s *Store) AddReplica(repl *Replica) error {
@@ -146,12 +164,42 @@ func (s *Store) SetSplitQueueActive(active bool) {
 	s.setSplitQueueActive(active)
 }
 
+// SetQueueActive enables or disables the queue with the given name, such
+// as "replicate", "replicaGC", "raftlog", "split" or "gc".
+func (s *Store) SetQueueActive(name string, active bool) error {
+	return s.setQueueActive(name, active)
+}
+
+// QueueActive returns whether the queue with the given name is enabled.
+func (s *Store) QueueActive(name string) (bool, error) {
+	q, err := s.queueByName(name)
+	if err != nil {
+		return false, err
+	}
+	return !q.Disabled(), nil
+}
+
 // SetReplicaScannerActive enables or disables the scanner. Note that while
 // inactive, removals are still processed.
 func (s *Store) SetReplicaScannerActive(active bool) {
 	s.setScannerActive(active)
 }
 
+// SetQueuesActive enables or disables the scanner and all queues of the
+// store.
+func (s *Store) SetQueuesActive(active bool) {
+	s.setScannerActive(active)
+	for _, q := range s.allQueues() {
+		q.SetDisabled(!active)
+	}
+}
+
+// VisitReplicas invokes the visitor on each of the store's replicas until
+// the visitor returns false.
+func (s *Store) VisitReplicas(visitor func(*Replica) bool) {
+	newStoreReplicaVisitor(s).Visit(visitor)
+}
+
 // EnqueueRaftUpdateCheck enqueues the replica for a Raft update check, forcing
 // the replica's Raft group into existence.
 func (s *Store) EnqueueRaftUpdateCheck(rangeID roachpb.RangeID) {
@@ -60,6 +60,10 @@ var (
 	// Range metrics.
 	metaAvailableRangeCount = metric.Metadata{Name: "ranges.available"}
 
+	// Request metrics.
+	metaRequestRate = metric.Metadata{Name: "requests.persecond",
+		Help: "Number of batch requests received by the store per second, over the last minute"}
+
 	// Replication metrics.
 	metaReplicaAllocatorNoopCount       = metric.Metadata{Name: "ranges.allocator.noop"}
 	metaReplicaAllocatorRemoveCount     = metric.Metadata{Name: "ranges.allocator.remove"}
@@ -106,6 +110,44 @@ var (
 		Name: "rocksdb.num-sstables",
 		Help: "Number of rocksdb SSTables",
 	}
+	metaRdbCompactionsInProgress = metric.Metadata{
+		Name: "rocksdb.compactions.in-progress",
+		Help: "Number of rocksdb compactions currently running",
+	}
+	metaRdbCompactedBytesRead = metric.Metadata{
+		Name: "rocksdb.compacted-bytes-read",
+		Help: "Bytes read by rocksdb compactions",
+	}
+	metaRdbCompactedBytesWritten = metric.Metadata{
+		Name: "rocksdb.compacted-bytes-written",
+		Help: "Bytes written by rocksdb compactions",
+	}
+	metaRdbFlushedBytes = metric.Metadata{
+		Name: "rocksdb.flushed-bytes",
+		Help: "Bytes written by rocksdb memtable flushes",
+	}
+	metaRdbWriteStalls = metric.Metadata{
+		Name: "rocksdb.write-stalls",
+		Help: "Number of times rocksdb delayed or stopped writes",
+	}
+	metaRdbWriteStallNanos = metric.Metadata{
+		Name: "rocksdb.write-stall-nanos",
+		Help: "Total time rocksdb writes have been delayed or stopped",
+	}
+
+	// Scrubber metrics.
+	metaScrubberPasses = metric.Metadata{
+		Name: "scrubber.passes",
+		Help: "Number of completed passes of the checksum scrubber over the store",
+	}
+	metaScrubberBytesVerified = metric.Metadata{
+		Name: "scrubber.bytes-verified",
+		Help: "Bytes of on-disk data whose checksums were verified by the scrubber",
+	}
+	metaScrubberCorruptions = metric.Metadata{
+		Name: "scrubber.corruptions",
+		Help: "Number of replicas in which the scrubber found corrupted data",
+	}
 
 	// Range event metrics.
 	metaRangeSplits                     = metric.Metadata{Name: "range.splits"}
@@ -190,65 +232,65 @@ var (
 	}
 
 	// Replica queue metrics.
-	metaGCQueueSuccesses = metric.Metadata{Name: "queue.gc.process.success",
-		Help: "Number of replicas successfully processed by the GC queue"}
-	metaGCQueueFailures = metric.Metadata{Name: "queue.gc.process.failure",
-		Help: "Number of replicas which failed processing in the GC queue"}
-	metaGCQueuePending = metric.Metadata{Name: "queue.gc.pending",
-		Help: "Number of pending replicas in the GC queue"}
-	metaGCQueueProcessingNanos = metric.Metadata{Name: "queue.gc.processingnanos",
-		Help: "Nanoseconds spent processing replicas in the GC queue"}
-	metaRaftLogQueueSuccesses = metric.Metadata{Name: "queue.raftlog.process.success",
-		Help: "Number of replicas successfully processed by the raft log queue"}
-	metaRaftLogQueueFailures = metric.Metadata{Name: "queue.raftlog.process.failure",
-		Help: "Number of replicas which failed processing in the raft log queue"}
-	metaRaftLogQueuePending = metric.Metadata{Name: "queue.raftlog.pending",
-		Help: "Number of pending replicas in the raft log queue"}
-	metaRaftLogQueueProcessingNanos = metric.Metadata{Name: "queue.raftlog.processingnanos",
-		Help: "Nanoseconds spent processing replicas in the raft log queue"}
-	metaConsistencyQueueSuccesses = metric.Metadata{Name: "queue.consistency.process.success",
-		Help: "Number of replicas successfully processed by the consistency checker queue"}
-	metaConsistencyQueueFailures = metric.Metadata{Name: "queue.consistency.process.failure",
-		Help: "Number of replicas which failed processing in the consistency checker queue"}
-	metaConsistencyQueuePending = metric.Metadata{Name: "queue.consistency.pending",
-		Help: "Number of pending replicas in the consistency checker queue"}
-	metaConsistencyQueueProcessingNanos = metric.Metadata{Name: "queue.consistency.processingnanos",
-		Help: "Nanoseconds spent processing replicas in the consistency checker queue"}
-	metaReplicaGCQueueSuccesses = metric.Metadata{Name: "queue.replicagc.process.success",
-		Help: "Number of replicas successfully processed by the replica GC queue"}
-	metaReplicaGCQueueFailures = metric.Metadata{Name: "queue.replicagc.process.failure",
-		Help: "Number of replicas which failed processing in the replica GC queue"}
-	metaReplicaGCQueuePending = metric.Metadata{Name: "queue.replicagc.pending",
-		Help: "Number of pending replicas in the replica GC queue"}
-	metaReplicaGCQueueProcessingNanos = metric.Metadata{Name: "queue.replicagc.processingnanos",
-		Help: "Nanoseconds spent processing replicas in the replica GC queue"}
-	metaReplicateQueueSuccesses = metric.Metadata{Name: "queue.replicate.process.success",
-		Help: "Number of replicas successfully processed by the replicate queue"}
-	metaReplicateQueueFailures = metric.Metadata{Name: "queue.replicate.process.failure",
-		Help: "Number of replicas which failed processing in the replicate queue"}
-	metaReplicateQueuePending = metric.Metadata{Name: "queue.replicate.pending",
-		Help: "Number of pending replicas in the replicate queue"}
-	metaReplicateQueueProcessingNanos = metric.Metadata{Name: "queue.replicate.processingnanos",
-		Help: "Nanoseconds spent processing replicas in the replicate queue"}
+	metaGCQueueSuccesses = queueMetadata("gc", "process.success",
+		"Number of replicas successfully processed by the GC queue")
+	metaGCQueueFailures = queueMetadata("gc", "process.failure",
+		"Number of replicas which failed processing in the GC queue")
+	metaGCQueuePending = queueMetadata("gc", "pending",
+		"Number of pending replicas in the GC queue")
+	metaGCQueueProcessingNanos = queueMetadata("gc", "processingnanos",
+		"Nanoseconds spent processing replicas in the GC queue")
+	metaRaftLogQueueSuccesses = queueMetadata("raftlog", "process.success",
+		"Number of replicas successfully processed by the raft log queue")
+	metaRaftLogQueueFailures = queueMetadata("raftlog", "process.failure",
+		"Number of replicas which failed processing in the raft log queue")
+	metaRaftLogQueuePending = queueMetadata("raftlog", "pending",
+		"Number of pending replicas in the raft log queue")
+	metaRaftLogQueueProcessingNanos = queueMetadata("raftlog", "processingnanos",
+		"Nanoseconds spent processing replicas in the raft log queue")
+	metaConsistencyQueueSuccesses = queueMetadata("consistency", "process.success",
+		"Number of replicas successfully processed by the consistency checker queue")
+	metaConsistencyQueueFailures = queueMetadata("consistency", "process.failure",
+		"Number of replicas which failed processing in the consistency checker queue")
+	metaConsistencyQueuePending = queueMetadata("consistency", "pending",
+		"Number of pending replicas in the consistency checker queue")
+	metaConsistencyQueueProcessingNanos = queueMetadata("consistency", "processingnanos",
+		"Nanoseconds spent processing replicas in the consistency checker queue")
+	metaReplicaGCQueueSuccesses = queueMetadata("replicagc", "process.success",
+		"Number of replicas successfully processed by the replica GC queue")
+	metaReplicaGCQueueFailures = queueMetadata("replicagc", "process.failure",
+		"Number of replicas which failed processing in the replica GC queue")
+	metaReplicaGCQueuePending = queueMetadata("replicagc", "pending",
+		"Number of pending replicas in the replica GC queue")
+	metaReplicaGCQueueProcessingNanos = queueMetadata("replicagc", "processingnanos",
+		"Nanoseconds spent processing replicas in the replica GC queue")
+	metaReplicateQueueSuccesses = queueMetadata("replicate", "process.success",
+		"Number of replicas successfully processed by the replicate queue")
+	metaReplicateQueueFailures = queueMetadata("replicate", "process.failure",
+		"Number of replicas which failed processing in the replicate queue")
+	metaReplicateQueuePending = queueMetadata("replicate", "pending",
+		"Number of pending replicas in the replicate queue")
+	metaReplicateQueueProcessingNanos = queueMetadata("replicate", "processingnanos",
+		"Nanoseconds spent processing replicas in the replicate queue")
 	metaReplicateQueuePurgatory = metric.Metadata{Name: "queue.replicate.purgatory",
 		Help: "Number of replicas in the replicate queue's purgatory, awaiting allocation options"}
-	metaSplitQueueSuccesses = metric.Metadata{Name: "queue.split.process.success",
-		Help: "Number of replicas successfully processed by the split queue"}
-	metaSplitQueueFailures = metric.Metadata{Name: "queue.split.process.failure",
-		Help: "Number of replicas which failed processing in the split queue"}
-	metaSplitQueuePending = metric.Metadata{Name: "queue.split.pending",
-		Help: "Number of pending replicas in the split queue"}
-	metaSplitQueueProcessingNanos = metric.Metadata{Name: "queue.split.processingnanos",
-		Help: "Nanoseconds spent processing replicas in the split queue"}
-
-	metaTimeSeriesMaintenanceQueueSuccesses = metric.Metadata{Name: "queue.tsmaintenance.process.success",
-		Help: "Number of replicas successfully processed by the time series maintenance queue"}
-	metaTimeSeriesMaintenanceQueueFailures = metric.Metadata{Name: "queue.tsmaintenance.process.failure",
-		Help: "Number of replicas which failed processing in the time series maintenance queue"}
-	metaTimeSeriesMaintenanceQueuePending = metric.Metadata{Name: "queue.tsmaintenance.pending",
-		Help: "Number of pending replicas in the time series maintenance queue"}
-	metaTimeSeriesMaintenanceQueueProcessingNanos = metric.Metadata{Name: "queue.tsmaintenance.processingnanos",
-		Help: "Nanoseconds spent processing replicas in the time series maintenance queue"}
+	metaSplitQueueSuccesses = queueMetadata("split", "process.success",
+		"Number of replicas successfully processed by the split queue")
+	metaSplitQueueFailures = queueMetadata("split", "process.failure",
+		"Number of replicas which failed processing in the split queue")
+	metaSplitQueuePending = queueMetadata("split", "pending",
+		"Number of pending replicas in the split queue")
+	metaSplitQueueProcessingNanos = queueMetadata("split", "processingnanos",
+		"Nanoseconds spent processing replicas in the split queue")
+
+	metaTimeSeriesMaintenanceQueueSuccesses = queueMetadata("tsmaintenance", "process.success",
+		"Number of replicas successfully processed by the time series maintenance queue")
+	metaTimeSeriesMaintenanceQueueFailures = queueMetadata("tsmaintenance", "process.failure",
+		"Number of replicas which failed processing in the time series maintenance queue")
+	metaTimeSeriesMaintenanceQueuePending = queueMetadata("tsmaintenance", "pending",
+		"Number of pending replicas in the time series maintenance queue")
+	metaTimeSeriesMaintenanceQueueProcessingNanos = queueMetadata("tsmaintenance", "processingnanos",
+		"Nanoseconds spent processing replicas in the time series maintenance queue")
 
 	// GCInfo cumulative totals.
 	metaGCNumKeysAffected = metric.Metadata{Name: "queue.gc.info.numkeysaffected",
@@ -290,6 +332,25 @@ var (
 		Help: "Duration of Raft Scheduler mutex critical sections"}
 )
 
+// queueMetricFamilyHelp holds the help texts of the metrics which are
+// maintained for every replica queue; see queueMetadata.
+var queueMetricFamilyHelp = map[string]string{
+	"process.success": "Number of replicas successfully processed by the queue",
+	"process.failure": "Number of replicas which failed processing in the queue",
+	"pending":         "Number of pending replicas in the queue",
+	"processingnanos": "Nanoseconds spent processing replicas in the queue",
+}
+
+// queueMetadata returns the metadata of the given metric of the named replica
+// queue. The metric is named "queue.<queue>.<suffix>", but it is exported to
+// prometheus as "queue_<suffix>" labeled with the queue, so that the queues
+// can be compared and aggregated. For one release, it is also still exported
+// as "queue_<queue>_<suffix>".
+func queueMetadata(queue, suffix, help string) metric.Metadata {
+	meta := metric.Metadata{Name: "queue." + queue + "." + suffix, Help: help}
+	return meta.InFamily("queue."+suffix, queueMetricFamilyHelp[suffix], "queue", queue)
+}
+
 // StoreMetrics is the set of metrics for a given store.
 type StoreMetrics struct {
 	registry *metric.Registry
@@ -315,6 +376,9 @@ type StoreMetrics struct {
 	// Range metrics.
 	AvailableRangeCount *metric.Gauge
 
+	// Request metrics.
+	RequestRate *metric.WindowedRate
+
 	// Replication metrics.
 	ReplicaAllocatorNoopCount       *metric.Gauge
 	ReplicaAllocatorRemoveCount     *metric.Gauge
@@ -360,12 +424,23 @@ type StoreMetrics struct {
 	RdbTableReadersMemEstimate  *metric.Gauge
 	RdbReadAmplification        *metric.Gauge
 	RdbNumSSTables              *metric.Gauge
+	RdbCompactionsInProgress    *metric.Gauge
+	RdbCompactedBytesRead       *metric.Gauge
+	RdbCompactedBytesWritten    *metric.Gauge
+	RdbFlushedBytes             *metric.Gauge
+	RdbWriteStalls              *metric.Gauge
+	RdbWriteStallNanos          *metric.Gauge
 
 	// TODO(mrtracy): This should be removed as part of #4465. This is only
 	// maintained to keep the current structure of StatusSummaries; it would be
 	// better to convert the Gauges above into counters which are adjusted
 	// accordingly.
 
+	// Scrubber metrics.
+	ScrubberPasses        *metric.Counter
+	ScrubberBytesVerified *metric.Counter
+	ScrubberCorruptions   *metric.Counter
+
 	// Range event metrics.
 	RangeSplits                     *metric.Counter
 	RangeAdds                       *metric.Counter
@@ -489,6 +564,9 @@ func newStoreMetrics(sampleInterval time.Duration) *StoreMetrics {
 		// Range metrics.
 		AvailableRangeCount: metric.NewGauge(metaAvailableRangeCount),
 
+		// Request metrics.
+		RequestRate: metric.NewWindowedRate(metaRequestRate, time.Minute),
+
 		// Replication metrics.
 		ReplicaAllocatorNoopCount:       metric.NewGauge(metaReplicaAllocatorNoopCount),
 		ReplicaAllocatorRemoveCount:     metric.NewGauge(metaReplicaAllocatorRemoveCount),
@@ -532,6 +610,17 @@ func newStoreMetrics(sampleInterval time.Duration) *StoreMetrics {
 		RdbTableReadersMemEstimate:  metric.NewGauge(metaRdbTableReadersMemEstimate),
 		RdbReadAmplification:        metric.NewGauge(metaRdbReadAmplification),
 		RdbNumSSTables:              metric.NewGauge(metaRdbNumSSTables),
+		RdbCompactionsInProgress:    metric.NewGauge(metaRdbCompactionsInProgress),
+		RdbCompactedBytesRead:       metric.NewGauge(metaRdbCompactedBytesRead),
+		RdbCompactedBytesWritten:    metric.NewGauge(metaRdbCompactedBytesWritten),
+		RdbFlushedBytes:             metric.NewGauge(metaRdbFlushedBytes),
+		RdbWriteStalls:              metric.NewGauge(metaRdbWriteStalls),
+		RdbWriteStallNanos:          metric.NewGauge(metaRdbWriteStallNanos),
+
+		// Scrubber metrics.
+		ScrubberPasses:        metric.NewCounter(metaScrubberPasses),
+		ScrubberBytesVerified: metric.NewCounter(metaScrubberBytesVerified),
+		ScrubberCorruptions:   metric.NewCounter(metaScrubberCorruptions),
 
 		// Range event metrics.
 		RangeSplits:                     metric.NewCounter(metaRangeSplits),
@@ -713,6 +802,12 @@ func (sm *StoreMetrics) updateRocksDBStats(stats engine.Stats) {
 	sm.RdbFlushes.Update(stats.Flushes)
 	sm.RdbCompactions.Update(stats.Compactions)
 	sm.RdbTableReadersMemEstimate.Update(stats.TableReadersMemEstimate)
+	sm.RdbCompactionsInProgress.Update(stats.CompactionsInProgress)
+	sm.RdbCompactedBytesRead.Update(stats.CompactedBytesRead)
+	sm.RdbCompactedBytesWritten.Update(stats.CompactedBytesWritten)
+	sm.RdbFlushedBytes.Update(stats.FlushedBytes)
+	sm.RdbWriteStalls.Update(stats.WriteStalls)
+	sm.RdbWriteStallNanos.Update(stats.WriteStallNanos)
 }
 
 func (sm *StoreMetrics) leaseRequestComplete(success bool) {
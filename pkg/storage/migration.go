@@ -39,8 +39,11 @@ import (
 // mean that the replica was further ahead or had voted, and so there's no
 // guarantee that this will be correct. But it will be correct in the majority
 // of cases, and some state *has* to be recovered.
+//
+// The HardState is read from and written to raftBatch, which differs from
+// batch if the store keeps its raft state in a dedicated raft engine.
 func migrate7310And6991(
-	ctx context.Context, batch engine.ReadWriter, desc roachpb.RangeDescriptor,
+	ctx context.Context, batch, raftBatch engine.ReadWriter, desc roachpb.RangeDescriptor,
 ) error {
 	state, err := loadState(ctx, batch, &desc)
 	if err != nil {
@@ -56,7 +59,7 @@ func migrate7310And6991(
 		log.Warningf(ctx, "migration: synthesized TruncatedState for %+v", desc)
 	}
 
-	hs, err := loadHardState(ctx, batch, desc.RangeID)
+	hs, err := loadHardState(ctx, raftBatch, desc.RangeID)
 	if err != nil {
 		return errors.Wrap(err, "unable to load HardState")
 	}
@@ -65,7 +68,7 @@ func migrate7310And6991(
 	// index (which would error out and fatal us).
 	if hs.Commit == 0 {
 		log.Warningf(ctx, "migration: synthesized HardState for %+v", desc)
-		if err := synthesizeHardState(ctx, batch, state, hs); err != nil {
+		if err := synthesizeHardState(ctx, raftBatch, state, hs); err != nil {
 			return errors.Wrap(err, "could not migrate HardState")
 		}
 	}
@@ -38,7 +38,7 @@ func TestMigrate7310And6991(t *testing.T) {
 
 	desc := *testRangeDescriptor()
 
-	if err := migrate7310And6991(context.Background(), eng, desc); err != nil {
+	if err := migrate7310And6991(context.Background(), eng, eng, desc); err != nil {
 		t.Fatal(err)
 	}
 
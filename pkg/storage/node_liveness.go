@@ -58,6 +58,15 @@ type LivenessMetrics struct {
 	EpochIncrements    *metric.Counter
 }
 
+// NodeLivenessTestingKnobs allows tests to override the behavior of
+// NodeLiveness.
+type NodeLivenessTestingKnobs struct {
+	// PauseHeartbeat, if set, is called before every heartbeat of the
+	// heartbeat loop, which skips the heartbeat if it returns true.
+	// ManualHeartbeat is not affected.
+	PauseHeartbeat func() bool
+}
+
 // NodeLiveness encapsulates information on node liveness and provides
 // an API for querying, updating, and invalidating node
 // liveness. Nodes periodically "heartbeat" the range holding the node
@@ -74,6 +83,7 @@ type NodeLiveness struct {
 	livenessThreshold time.Duration
 	heartbeatInterval time.Duration
 	metrics           LivenessMetrics
+	knobs             NodeLivenessTestingKnobs
 
 	mu struct {
 		syncutil.RWMutex
@@ -91,6 +101,7 @@ func NewNodeLiveness(
 	g *gossip.Gossip,
 	livenessThreshold time.Duration,
 	heartbeatInterval time.Duration,
+	knobs NodeLivenessTestingKnobs,
 ) *NodeLiveness {
 	nl := &NodeLiveness{
 		ambientCtx:        ambient,
@@ -100,6 +111,7 @@ func NewNodeLiveness(
 		livenessThreshold: livenessThreshold,
 		heartbeatInterval: heartbeatInterval,
 		stopHeartbeat:     make(chan struct{}),
+		knobs:             knobs,
 		metrics: LivenessMetrics{
 			HeartbeatSuccesses: metric.NewCounter(metaHeartbeatSuccesses),
 			HeartbeatFailures:  metric.NewCounter(metaHeartbeatFailures),
@@ -136,11 +148,13 @@ func (nl *NodeLiveness) StartHeartbeat(ctx context.Context, stopper *stop.Stoppe
 		ticker := time.NewTicker(nl.heartbeatInterval)
 		defer ticker.Stop()
 		for {
-			ctx, sp := ambient.AnnotateCtxWithSpan(context.Background(), "heartbeat")
-			if err := nl.heartbeat(ctx); err != nil {
-				log.Errorf(ctx, "failed liveness heartbeat: %s", err)
+			if nl.knobs.PauseHeartbeat == nil || !nl.knobs.PauseHeartbeat() {
+				ctx, sp := ambient.AnnotateCtxWithSpan(context.Background(), "heartbeat")
+				if err := nl.heartbeat(ctx); err != nil {
+					log.Errorf(ctx, "failed liveness heartbeat: %s", err)
+				}
+				sp.Finish()
 			}
-			sp.Finish()
 			select {
 			case <-ticker.C:
 			case <-nl.stopHeartbeat:
@@ -177,8 +191,12 @@ func (nl *NodeLiveness) heartbeat(ctx context.Context) error {
 		}
 	}
 
-	// Retry heartbeat in the event the conditional put fails.
-	for r := retry.StartWithCtx(ctx, base.DefaultRetryOptions()); r.Next(); {
+	// Retry heartbeat in the event the conditional put fails, but not past
+	// the heartbeat interval, at which point the next heartbeat takes over.
+	opts := base.DefaultRetryOptions()
+	opts.MaxDuration = nl.heartbeatInterval
+	r := retry.StartWithCtx(ctx, opts)
+	for r.Next() {
 		newLiveness.Expiration = nl.clock.Now().Add(nl.livenessThreshold.Nanoseconds(), 0)
 		tryAgain := false
 		if err := nl.updateLiveness(ctx, nodeID, &newLiveness, oldLiveness, func(actual Liveness) {
@@ -193,6 +211,10 @@ func (nl *NodeLiveness) heartbeat(ctx context.Context) error {
 			break
 		}
 	}
+	if err := r.Err(nil); err != nil {
+		nl.metrics.HeartbeatFailures.Inc(1)
+		return err
+	}
 
 	log.VEventf(ctx, 1, "heartbeat node %d liveness with expiration %s", nodeID, newLiveness.Expiration)
 	nl.mu.Lock()
@@ -232,6 +254,23 @@ func (nl *NodeLiveness) getLivenessLocked(nodeID roachpb.NodeID) (Liveness, erro
 	return l, nil
 }
 
+// DeadDecommissionedNodes returns the IDs of the decommissioning nodes
+// whose liveness records expired more than deadFor ago, according to the
+// last liveness gossip received. Nodes which are merely dead are not
+// returned, as they may still come back.
+func (nl *NodeLiveness) DeadDecommissionedNodes(deadFor time.Duration) []roachpb.NodeID {
+	nl.mu.Lock()
+	defer nl.mu.Unlock()
+	now := nl.clock.Now()
+	var nodeIDs []roachpb.NodeID
+	for nodeID, l := range nl.mu.nodes {
+		if l.Decommissioning && l.Expiration.Add(deadFor.Nanoseconds(), 0).Less(now) {
+			nodeIDs = append(nodeIDs, nodeID)
+		}
+	}
+	return nodeIDs
+}
+
 // IncrementEpoch is called by nodes on other nodes in order to
 // increment the current liveness epoch, thereby invalidating anything
 // relying on the liveness of the previous epoch. This method does a
@@ -262,6 +301,49 @@ func (nl *NodeLiveness) IncrementEpoch(ctx context.Context, nodeID roachpb.NodeI
 	return nil
 }
 
+// SetDecommissioning marks the specified node as decommissioning, or
+// clears the mark if decommissioning is false. A node which is
+// decommissioning and stays dead for long enough is removed from the
+// cluster. This method does a conditional put on the node liveness
+// record, retrying if the record was concurrently updated (e.g. by a
+// heartbeat of the node), and if successful, stores the updated liveness
+// record in the nodes map.
+func (nl *NodeLiveness) SetDecommissioning(
+	ctx context.Context, nodeID roachpb.NodeID, decommissioning bool,
+) error {
+	liveness, err := nl.GetLiveness(nodeID)
+	if err != nil {
+		return err
+	}
+	for {
+		if liveness.Decommissioning == decommissioning {
+			return nil
+		}
+		newLiveness := liveness
+		newLiveness.Decommissioning = decommissioning
+		tryAgain := false
+		if err := nl.updateLiveness(ctx, nodeID, &newLiveness, &liveness, func(actual Liveness) {
+			liveness = actual
+			tryAgain = true
+		}); err != nil {
+			return err
+		}
+		if tryAgain {
+			continue
+		}
+
+		log.Infof(ctx, "set node %d decommissioning to %t", nodeID, decommissioning)
+		nl.mu.Lock()
+		defer nl.mu.Unlock()
+		if nodeID == nl.mu.self.NodeID {
+			nl.mu.self = newLiveness
+		} else {
+			nl.mu.nodes[nodeID] = newLiveness
+		}
+		return nil
+	}
+}
+
 // Metrics returns a struct which contains metrics related to node
 // liveness activity.
 func (nl *NodeLiveness) Metrics() LivenessMetrics {
@@ -329,12 +411,14 @@ func (nl *NodeLiveness) livenessGossipUpdate(key string, content roachpb.Value)
 	}
 
 	// If there's an existing liveness record, only update the received
-	// timestamp if this is our first receipt of this node's liveness
-	// or if the expiration or epoch was advanced.
+	// timestamp if this is our first receipt of this node's liveness,
+	// if the expiration or epoch was advanced, or if the node was marked
+	// or unmarked as decommissioning.
 	nl.mu.Lock()
 	defer nl.mu.Unlock()
 	exLiveness, ok := nl.mu.nodes[liveness.NodeID]
-	if !ok || exLiveness.Expiration.Less(liveness.Expiration) || exLiveness.Epoch < liveness.Epoch {
+	if !ok || exLiveness.Expiration.Less(liveness.Expiration) || exLiveness.Epoch < liveness.Epoch ||
+		exLiveness.Decommissioning != liveness.Decommissioning {
 		nl.mu.nodes[liveness.NodeID] = liveness
 	}
 }
@@ -21,6 +21,7 @@ import (
 	"sort"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 	"golang.org/x/net/context"
@@ -30,13 +31,12 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/storage"
 	"github.com/cockroachdb/cockroach/pkg/testutils"
-	"github.com/cockroachdb/cockroach/pkg/util"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
 )
 
 func verifyLiveness(t *testing.T, mtc *multiTestContext) {
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		for _, nl := range mtc.nodeLivenesses {
 			for _, g := range mtc.gossips {
 				live, err := nl.IsLive(g.NodeID.Get())
@@ -128,7 +128,7 @@ func TestNodeLivenessEpochIncrement(t *testing.T) {
 	}
 
 	// Verify that the epoch has been advanced.
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		newLiveness, err := mtc.nodeLivenesses[0].GetLiveness(deadNodeID)
 		if err != nil {
 			return err
@@ -151,6 +151,90 @@ func TestNodeLivenessEpochIncrement(t *testing.T) {
 	}
 }
 
+// TestNodeLivenessDeadDecommissionedNodes verifies that only nodes which
+// are decommissioning are reported, and only once their liveness records
+// have been expired for the specified duration.
+func TestNodeLivenessDeadDecommissionedNodes(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	mtc := startMultiTestContext(t, 2)
+	defer mtc.Stop()
+
+	verifyLiveness(t, mtc)
+	stopNodeLivenessHeartbeats(mtc)
+
+	deadNodeID := mtc.gossips[1].NodeID.Get()
+	if err := mtc.nodeLivenesses[0].SetDecommissioning(
+		context.Background(), deadNodeID, true); err != nil {
+		t.Fatal(err)
+	}
+	liveness, err := mtc.nodeLivenesses[0].GetLiveness(deadNodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !liveness.Decommissioning {
+		t.Fatalf("expected node %d to be decommissioning", deadNodeID)
+	}
+	const deadFor = time.Minute
+	if dead := mtc.nodeLivenesses[0].DeadDecommissionedNodes(deadFor); len(dead) != 0 {
+		t.Fatalf("expected no dead nodes, found %v", dead)
+	}
+
+	// Advance the clock to the expiration of the liveness record; the node
+	// is not live, but it has not been dead for long enough.
+	mtc.manualClock.Set(liveness.Expiration.WallTime)
+	if dead := mtc.nodeLivenesses[0].DeadDecommissionedNodes(deadFor); len(dead) != 0 {
+		t.Fatalf("expected no dead nodes, found %v", dead)
+	}
+
+	// Both nodes are now dead for long enough, but only the decommissioning
+	// one is reported.
+	mtc.manualClock.Increment(deadFor.Nanoseconds() + 1)
+	dead := mtc.nodeLivenesses[0].DeadDecommissionedNodes(deadFor)
+	if len(dead) != 1 || dead[0] != deadNodeID {
+		t.Errorf("expected only node %d to be reported, found %v", deadNodeID, dead)
+	}
+}
+
+// TestNodeLivenessPauseAndIncrementEpoch verifies that the multiTestContext
+// can have a node fail liveness and lose its epoch while its store keeps
+// running, and that the node becomes live again at the new epoch once its
+// heartbeats are resumed.
+func TestNodeLivenessPauseAndIncrementEpoch(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	mtc := startMultiTestContext(t, 2)
+	defer mtc.Stop()
+
+	verifyLiveness(t, mtc)
+	deadNodeID := mtc.gossips[1].NodeID.Get()
+	oldLiveness, err := mtc.nodeLivenesses[0].GetLiveness(deadNodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mtc.incrementEpoch(0, 1)
+	newLiveness, err := mtc.nodeLivenesses[0].GetLiveness(deadNodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newLiveness.Epoch != oldLiveness.Epoch+1 {
+		t.Errorf("expected epoch %d, got %d", oldLiveness.Epoch+1, newLiveness.Epoch)
+	}
+	if live, err := mtc.nodeLivenesses[0].IsLive(deadNodeID); live || err != nil {
+		t.Errorf("expected node %d not to be live: %t, %v", deadNodeID, live, err)
+	}
+	if mtc.stores[1] == nil {
+		t.Fatal("expected store 1 to keep running")
+	}
+
+	mtc.resumeNodeLiveness(1)
+	verifyLiveness(t, mtc)
+	if self, err := mtc.nodeLivenesses[1].Self(); err != nil {
+		t.Fatal(err)
+	} else if self.Epoch != newLiveness.Epoch {
+		t.Errorf("expected node %d to heartbeat at epoch %d, got %d", deadNodeID, newLiveness.Epoch, self.Epoch)
+	}
+}
+
 // TestNodeLivenessRestart verifies that if nodes are shutdown and
 // restarted, the node liveness records are re-gossiped immediately.
 func TestNodeLivenessRestart(t *testing.T) {
@@ -194,7 +278,7 @@ func TestNodeLivenessRestart(t *testing.T) {
 
 	// Restart store and verify gossip contains liveness record for nodes 1&2.
 	mtc.restartStore(0)
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		keysMu.Lock()
 		defer keysMu.Unlock()
 		sort.Strings(keysMu.keys)
@@ -227,7 +311,7 @@ func TestNodeLivenessSelf(t *testing.T) {
 	g.RegisterCallback(key, func(_ string, val roachpb.Value) {
 		atomic.AddInt32(&count, 1)
 	})
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		if err := g.AddInfoProto(key, &storage.Liveness{
 			NodeID: 1,
 			Epoch:  2,
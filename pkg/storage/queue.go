@@ -469,13 +469,18 @@ func (bq *baseQueue) processLoop(clock *hlc.Clock, stopper *stop.Stopper) {
 			case <-nextTime:
 				repl := bq.pop()
 				if repl != nil {
-					if stopper.RunTask(func() {
+					err := stopper.RunTaskWithClass(stop.BackgroundTask, func() {
 						annotatedCtx := repl.AnnotateCtx(ctx)
 						if err := bq.processReplica(annotatedCtx, repl, clock); err != nil {
 							// Maybe add failing replica to purgatory if the queue supports it.
 							bq.maybeAddToPurgatory(annotatedCtx, repl, err, clock, stopper)
 						}
-					}) != nil {
+					})
+					if err == stop.ErrTaskRejected {
+						// The node is draining. The replica is dropped; the scanner
+						// adds it again once the node accepts background tasks.
+						log.VEventf(ctx, 1, "%s: not processing: %s", repl, err)
+					} else if err != nil {
 						return
 					}
 				}
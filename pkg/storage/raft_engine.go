@@ -0,0 +1,257 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/keys"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/storage/engine"
+	"github.com/cockroachdb/cockroach/pkg/util/envutil"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+)
+
+// dedicatedRaftStorage determines whether stores created by the server are
+// given a dedicated engine for their raft log entries and HardState.
+//
+// The first time a store is started with a raft engine, the raft state of all
+// of its ranges is moved from the main engine into the raft engine. From then
+// on the raft engine is the only home of the raft log and HardState, so a
+// store which has been migrated keeps using its raft engine even if dedicated
+// raft storage is disabled again.
+var dedicatedRaftStorage = envutil.EnvOrDefaultBool("COCKROACH_DEDICATED_RAFT_STORAGE", false)
+
+// DedicatedRaftStorageEnabled returns whether stores should be given a
+// dedicated engine for their raft data.
+func DedicatedRaftStorageEnabled() bool {
+	return dedicatedRaftStorage
+}
+
+// RaftEngine returns the store's dedicated raft engine, or nil if the store
+// keeps its raft data only in its main engine.
+func (s *Store) RaftEngine() engine.Engine {
+	return s.raftEngine
+}
+
+// raftStateEngine returns the engine to which the store writes and from which
+// it reads raft log entries, HardStates and last indexes.
+func (s *Store) raftStateEngine() engine.Engine {
+	if s.raftEngine != nil {
+		return s.raftEngine
+	}
+	return s.engine
+}
+
+// unreplicatedRaftStateSpans returns the spans of the range-ID local keys
+// which hold a range's HardState, last index and log.
+func unreplicatedRaftStateSpans(rangeID roachpb.RangeID) []roachpb.Span {
+	hsKey := keys.RaftHardStateKey(rangeID)
+	lastIndexKey := keys.RaftLastIndexKey(rangeID)
+	logPrefix := keys.RaftLogPrefix(rangeID)
+	return []roachpb.Span{
+		{Key: hsKey, EndKey: hsKey.Next()},
+		{Key: lastIndexKey, EndKey: lastIndexKey.Next()},
+		{Key: logPrefix, EndKey: logPrefix.PrefixEnd()},
+	}
+}
+
+// raftStateSpans returns the spans of the range-ID local keys which make up a
+// range's raft state in the raft engine: its HardState, last index, log and
+// truncated state. The truncated state is replicated, but a copy of it is
+// needed to interpret the log.
+func raftStateSpans(rangeID roachpb.RangeID) []roachpb.Span {
+	truncStateKey := keys.RaftTruncatedStateKey(rangeID)
+	return append(unreplicatedRaftStateSpans(rangeID),
+		roachpb.Span{Key: truncStateKey, EndKey: truncStateKey.Next()})
+}
+
+// clearSpans removes the specified spans from the specified engine.
+func clearSpans(eng engine.Writer, spans []roachpb.Span) error {
+	for _, span := range spans {
+		if err := eng.ClearRange(
+			engine.MakeMVCCMetadataKey(span.Key), engine.MakeMVCCMetadataKey(span.EndKey),
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clearRaftState removes a range's raft state from the specified engine.
+func clearRaftState(eng engine.Writer, rangeID roachpb.RangeID) error {
+	return clearSpans(eng, raftStateSpans(rangeID))
+}
+
+// migrateRaftEngine moves the raft state of all of the store's ranges from the
+// main engine into the raft engine the first time the store is started with a
+// raft engine. The store's ident is written to the raft engine once the
+// migration has completed; a migration interrupted by a crash is simply
+// repeated on the next start as handOffRaftState is idempotent.
+func (s *Store) migrateRaftEngine(ctx context.Context) error {
+	var ident roachpb.StoreIdent
+	ok, err := engine.MVCCGetProto(
+		ctx, s.raftEngine, keys.StoreIdentKey(), hlc.ZeroTimestamp, true, nil, &ident)
+	if err != nil {
+		return err
+	}
+	if ok {
+		if ident != s.Ident {
+			return errors.Errorf("raft engine belongs to store %+v, not %+v", ident, s.Ident)
+		}
+		return nil
+	}
+
+	log.Infof(ctx, "migrating raft state to the raft engine")
+	var rangeIDs []roachpb.RangeID
+	iter := s.engine.NewIterator(false /* prefix */)
+	iter.Seek(engine.MakeMVCCMetadataKey(roachpb.Key(keys.LocalRangeIDPrefix)))
+	for iter.Valid() {
+		key := iter.Key().Key
+		if !bytes.HasPrefix(key, keys.LocalRangeIDPrefix) {
+			break
+		}
+		rangeID, _, _, _, err := keys.DecodeRangeIDKey(key)
+		if err != nil {
+			iter.Close()
+			return err
+		}
+		rangeIDs = append(rangeIDs, rangeID)
+		// Skip the remaining keys of the range.
+		iter.Seek(engine.MakeMVCCMetadataKey(keys.MakeRangeIDPrefix(rangeID + 1)))
+	}
+	err = iter.Error()
+	iter.Close()
+	if err != nil {
+		return err
+	}
+	for _, rangeID := range rangeIDs {
+		if err := s.handOffRaftState(ctx, rangeID); err != nil {
+			return errors.Wrapf(err, "could not migrate raft state of range %d", rangeID)
+		}
+	}
+	if err := engine.MVCCPutProto(
+		ctx, s.raftEngine, nil, keys.StoreIdentKey(), hlc.ZeroTimestamp, nil, &s.Ident,
+	); err != nil {
+		return err
+	}
+	log.Infof(ctx, "migrated raft state of %d ranges to the raft engine", len(rangeIDs))
+	return nil
+}
+
+// handOffRaftState moves a range's raft state from the main engine into the
+// raft engine if the main engine holds any. Raft state is only written to the
+// main engine by the migration of an existing store and by operations which
+// write replicated and raft state together (bootstrapping, splits and
+// snapshots), so this is a no-op except after one of those. The raft engine's
+// copy is committed before the main engine's is removed, which makes the
+// hand-off safe to repeat after a crash.
+func (s *Store) handOffRaftState(ctx context.Context, rangeID roachpb.RangeID) error {
+	if s.raftEngine == nil {
+		return nil
+	}
+	var pending bool
+	for _, key := range []roachpb.Key{
+		keys.RaftHardStateKey(rangeID), keys.RaftLastIndexKey(rangeID),
+	} {
+		v, err := s.engine.Get(engine.MakeMVCCMetadataKey(key))
+		if err != nil {
+			return err
+		}
+		pending = pending || v != nil
+	}
+	if !pending {
+		return nil
+	}
+
+	batch := s.raftEngine.NewBatch()
+	defer batch.Close()
+	if err := clearRaftState(batch, rangeID); err != nil {
+		return err
+	}
+	snap := s.engine.NewSnapshot()
+	defer snap.Close()
+	for _, span := range raftStateSpans(rangeID) {
+		if err := snap.Iterate(
+			engine.MakeMVCCMetadataKey(span.Key), engine.MakeMVCCMetadataKey(span.EndKey),
+			func(kv engine.MVCCKeyValue) (bool, error) {
+				return false, batch.Put(kv.Key, kv.Value)
+			},
+		); err != nil {
+			return err
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		return err
+	}
+
+	mainBatch := s.engine.NewBatch()
+	defer mainBatch.Close()
+	if err := clearSpans(mainBatch, unreplicatedRaftStateSpans(rangeID)); err != nil {
+		return err
+	}
+	return mainBatch.Commit()
+}
+
+// loadRaftEngineState prepares the raft engine before a replica's raft state
+// is loaded from it. It completes a hand-off of raft state from the main
+// engine which was interrupted by a crash and brings the raft engine's log up
+// to date with a truncation which was committed to the main engine but not to
+// the raft engine.
+func (s *Store) loadRaftEngineState(
+	ctx context.Context, rangeID roachpb.RangeID, truncState *roachpb.RaftTruncatedState,
+) error {
+	if s.raftEngine == nil {
+		return nil
+	}
+	if err := s.handOffRaftState(ctx, rangeID); err != nil {
+		return err
+	}
+	if truncState == nil {
+		return nil
+	}
+	raftTruncState, err := loadTruncatedState(ctx, s.raftEngine, rangeID)
+	if err != nil {
+		return err
+	}
+	if raftTruncState.Index < truncState.Index {
+		return s.truncateRaftEngineLog(ctx, rangeID, *truncState)
+	}
+	return nil
+}
+
+// truncateRaftEngineLog removes a range's log entries up to and including
+// the truncated index from the raft engine and records the new truncated
+// state.
+func (s *Store) truncateRaftEngineLog(
+	ctx context.Context, rangeID roachpb.RangeID, truncState roachpb.RaftTruncatedState,
+) error {
+	batch := s.raftEngine.NewBatch()
+	defer batch.Close()
+	if err := batch.ClearRange(
+		engine.MakeMVCCMetadataKey(keys.RaftLogKey(rangeID, 0)),
+		engine.MakeMVCCMetadataKey(keys.RaftLogKey(rangeID, truncState.Index+1)),
+	); err != nil {
+		return err
+	}
+	if err := setTruncatedState(ctx, batch, nil /* ms */, rangeID, truncState); err != nil {
+		return err
+	}
+	return batch.Commit()
+}
@@ -0,0 +1,234 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"testing"
+
+	"github.com/coreos/etcd/raft/raftpb"
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/keys"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/storage/engine"
+	"github.com/cockroachdb/cockroach/pkg/testutils"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+)
+
+// TestHandOffRaftState verifies that a range's raft state is moved from the
+// main engine into the raft engine, replacing whatever the raft engine held
+// before, and that replicated data other than the truncated state is neither
+// copied nor removed.
+func TestHandOffRaftState(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	ctx := context.Background()
+
+	eng := engine.NewInMem(roachpb.Attributes{}, 1<<20)
+	defer eng.Close()
+	raftEng := engine.NewInMem(roachpb.Attributes{}, 1<<20)
+	defer raftEng.Close()
+	s := &Store{engine: eng, raftEngine: raftEng}
+
+	const rangeID = roachpb.RangeID(1)
+	hs := raftpb.HardState{Term: 5, Vote: 1, Commit: 10}
+	if err := setHardState(ctx, eng, rangeID, hs); err != nil {
+		t.Fatal(err)
+	}
+	if err := setLastIndex(ctx, eng, rangeID, 10); err != nil {
+		t.Fatal(err)
+	}
+	logKey := engine.MakeMVCCMetadataKey(keys.RaftLogKey(rangeID, 10))
+	if err := eng.Put(logKey, []byte("entry")); err != nil {
+		t.Fatal(err)
+	}
+	truncState := roachpb.RaftTruncatedState{Index: 9, Term: 5}
+	if err := setTruncatedState(ctx, eng, nil, rangeID, truncState); err != nil {
+		t.Fatal(err)
+	}
+	// Replicated data must not be copied.
+	leaseKey := engine.MakeMVCCMetadataKey(keys.RangeLeaseKey(rangeID))
+	if err := eng.Put(leaseKey, []byte("lease")); err != nil {
+		t.Fatal(err)
+	}
+	// Stale raft state in the raft engine is replaced.
+	staleKey := engine.MakeMVCCMetadataKey(keys.RaftLogKey(rangeID, 11))
+	if err := raftEng.Put(staleKey, []byte("stale")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.handOffRaftState(ctx, rangeID); err != nil {
+		t.Fatal(err)
+	}
+	if actual, err := loadHardState(ctx, raftEng, rangeID); err != nil {
+		t.Fatal(err)
+	} else if actual != hs {
+		t.Fatalf("expected %+v, found %+v", hs, actual)
+	}
+	if v, err := raftEng.Get(logKey); err != nil {
+		t.Fatal(err)
+	} else if string(v) != "entry" {
+		t.Fatalf("expected log entry to be moved, found %q", v)
+	}
+	if actual, err := loadTruncatedState(ctx, raftEng, rangeID); err != nil {
+		t.Fatal(err)
+	} else if actual != truncState {
+		t.Fatalf("expected %+v, found %+v", truncState, actual)
+	}
+	for _, c := range []struct {
+		eng   engine.Engine
+		key   engine.MVCCKey
+		value string
+	}{
+		{raftEng, staleKey, ""},
+		{raftEng, leaseKey, ""},
+		{eng, logKey, ""},
+		{eng, engine.MakeMVCCMetadataKey(keys.RaftHardStateKey(rangeID)), ""},
+		{eng, engine.MakeMVCCMetadataKey(keys.RaftLastIndexKey(rangeID)), ""},
+		{eng, leaseKey, "lease"},
+	} {
+		if v, err := c.eng.Get(c.key); err != nil {
+			t.Fatal(err)
+		} else if string(v) != c.value {
+			t.Errorf("%s: expected %q, found %q", c.key, c.value, v)
+		}
+	}
+	if actual, err := loadTruncatedState(ctx, eng, rangeID); err != nil {
+		t.Fatal(err)
+	} else if actual != truncState {
+		t.Fatalf("expected replicated truncated state to be kept, found %+v", actual)
+	}
+
+	// Once the raft state has been handed off, the raft engine is left alone.
+	if err := raftEng.Put(staleKey, []byte("entry")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.handOffRaftState(ctx, rangeID); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := raftEng.Get(staleKey); err != nil {
+		t.Fatal(err)
+	} else if string(v) != "entry" {
+		t.Fatalf("expected raft engine to be left alone, found %q", v)
+	}
+	if s.raftStateEngine() != raftEng {
+		t.Fatal("expected raft state to be read from the raft engine")
+	}
+
+	if err := clearRaftState(raftEng, rangeID); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := raftEng.Get(logKey); err != nil {
+		t.Fatal(err)
+	} else if v != nil {
+		t.Fatalf("expected log entry to be cleared, found %q", v)
+	}
+}
+
+// TestMigrateRaftEngine verifies that the raft state of all ranges is moved
+// into the raft engine once, and that a raft engine can't be used with a
+// different store.
+func TestMigrateRaftEngine(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	ctx := context.Background()
+
+	eng := engine.NewInMem(roachpb.Attributes{}, 1<<20)
+	defer eng.Close()
+	raftEng := engine.NewInMem(roachpb.Attributes{}, 1<<20)
+	defer raftEng.Close()
+	s := &Store{engine: eng, raftEngine: raftEng}
+	s.Ident = roachpb.StoreIdent{NodeID: 1, StoreID: 1}
+
+	rangeIDs := []roachpb.RangeID{1, 2, 300}
+	for _, rangeID := range rangeIDs {
+		hs := raftpb.HardState{Term: 5, Commit: uint64(rangeID)}
+		if err := setHardState(ctx, eng, rangeID, hs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.migrateRaftEngine(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, rangeID := range rangeIDs {
+		if hs, err := loadHardState(ctx, raftEng, rangeID); err != nil {
+			t.Fatal(err)
+		} else if hs.Commit != uint64(rangeID) {
+			t.Errorf("r%d: expected HardState to be migrated, found %+v", rangeID, hs)
+		}
+	}
+
+	// A migrated store is not migrated again.
+	hs := raftpb.HardState{Term: 6, Commit: 7}
+	if err := setHardState(ctx, eng, rangeIDs[0], hs); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.migrateRaftEngine(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if actual, err := loadHardState(ctx, raftEng, rangeIDs[0]); err != nil {
+		t.Fatal(err)
+	} else if actual == hs {
+		t.Fatal("expected raft engine not to be migrated again")
+	}
+
+	s.Ident.StoreID = 2
+	if err := s.migrateRaftEngine(ctx); !testutils.IsError(err, "raft engine belongs to store") {
+		t.Fatalf("expected error about the raft engine's store, got %v", err)
+	}
+}
+
+// TestLoadRaftEngineStateTruncates verifies that a log truncation which was
+// not applied to the raft engine is redone when the replica is loaded.
+func TestLoadRaftEngineStateTruncates(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	ctx := context.Background()
+
+	eng := engine.NewInMem(roachpb.Attributes{}, 1<<20)
+	defer eng.Close()
+	raftEng := engine.NewInMem(roachpb.Attributes{}, 1<<20)
+	defer raftEng.Close()
+	s := &Store{engine: eng, raftEngine: raftEng}
+
+	const rangeID = roachpb.RangeID(1)
+	for i := uint64(5); i <= 10; i++ {
+		if err := raftEng.Put(
+			engine.MakeMVCCMetadataKey(keys.RaftLogKey(rangeID, i)), []byte("entry"),
+		); err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldTruncState := roachpb.RaftTruncatedState{Index: 4, Term: 5}
+	if err := setTruncatedState(ctx, raftEng, nil, rangeID, oldTruncState); err != nil {
+		t.Fatal(err)
+	}
+
+	truncState := roachpb.RaftTruncatedState{Index: 7, Term: 5}
+	if err := s.loadRaftEngineState(ctx, rangeID, &truncState); err != nil {
+		t.Fatal(err)
+	}
+	if actual, err := loadTruncatedState(ctx, raftEng, rangeID); err != nil {
+		t.Fatal(err)
+	} else if actual != truncState {
+		t.Fatalf("expected %+v, found %+v", truncState, actual)
+	}
+	for i := uint64(5); i <= 10; i++ {
+		v, err := raftEng.Get(engine.MakeMVCCMetadataKey(keys.RaftLogKey(rangeID, i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if truncated := i <= truncState.Index; truncated != (v == nil) {
+			t.Errorf("entry %d: expected truncated=%t, found %q", i, truncated, v)
+		}
+	}
+}
@@ -25,7 +25,6 @@ import (
 
 	"github.com/cockroachdb/cockroach/pkg/internal/client"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
-	"github.com/cockroachdb/cockroach/pkg/util"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/coreos/etcd/raft"
 	"github.com/pkg/errors"
@@ -176,7 +175,7 @@ func TestGetTruncatableIndexes(t *testing.T) {
 	// There can be a delay from when the truncation command is issued and the
 	// indexes updating.
 	var cFirst, cTruncatable, cOldest uint64
-	util.SucceedsSoon(t, func() error {
+	SucceedsSoon(t, func() error {
 		var err error
 		cFirst, cTruncatable, cOldest, err = getIndexes()
 		if err != nil {
@@ -393,12 +393,24 @@ func (t *RaftTransport) GetCircuitBreaker(nodeID roachpb.NodeID) *circuit.Breake
 	defer t.mu.Unlock()
 	breaker, ok := t.mu.breakers[nodeID]
 	if !ok {
-		breaker = t.rpcContext.NewBreaker()
+		breaker = t.rpcContext.NewBreaker(fmt.Sprintf("raft.n%d", nodeID))
 		t.mu.breakers[nodeID] = breaker
 	}
 	return breaker
 }
 
+// RemoveCircuitBreaker removes the circuit breaker controlling connection
+// attempts to the specified node, along with its metrics. It is called
+// once the node has been removed from the cluster.
+func (t *RaftTransport) RemoveCircuitBreaker(nodeID roachpb.NodeID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if breaker, ok := t.mu.breakers[nodeID]; ok {
+		t.rpcContext.RemoveBreaker(breaker)
+		delete(t.mu.breakers, nodeID)
+	}
+}
+
 // connectAndProcess connects to the node and then processes the
 // provided channel containing a queue of raft messages until there is
 // an unrecoverable error with the underlying connection. A circuit
@@ -422,7 +434,10 @@ func (t *RaftTransport) connectAndProcess(
 		if err != nil {
 			return err
 		}
-		conn, err := t.rpcContext.GRPCDial(addr.String(), grpc.WithBlock())
+		// Raft messages use a dedicated connection so that they don't queue
+		// up behind user traffic. Snapshots, which are large, stay on the
+		// default connection.
+		conn, err := t.rpcContext.GRPCDialClass(addr.String(), rpc.SystemClass, grpc.WithBlock())
 		if err != nil {
 			return err
 		}
@@ -95,6 +95,17 @@ var txnAutoGC = true
 
 var tickQuiesced = envutil.EnvOrDefaultBool("COCKROACH_TICK_QUIESCED", true)
 
+// maxCommandSize is the maximum size of an encoded raft command. Larger
+// commands are rejected at proposal time as they would bloat the raft log and
+// stall replication for the range.
+var maxCommandSize = envutil.EnvOrDefaultBytes("COCKROACH_MAX_COMMAND_SIZE", 64<<20)
+
+// systemConfigSnapshotInterval is the maximum age of the system config
+// against which gossiped system config deltas are computed. Once exceeded,
+// the next change gossips the full system config instead.
+var systemConfigSnapshotInterval = envutil.EnvOrDefaultDuration(
+	"COCKROACH_SYSTEM_CONFIG_SNAPSHOT_INTERVAL", 10*time.Minute)
+
 // Whether to enable experimental support for proposer-evaluated KV.
 var propEvalKV = func() bool {
 	enabled := envutil.EnvOrDefaultBool("COCKROACH_PROPOSER_EVALUATED_KV", false)
@@ -215,6 +226,14 @@ type atomicDescString struct {
 	strPtr unsafe.Pointer
 }
 
+// descString holds the parts of the string representation of a range. The
+// span may contain user data and is kept apart from the IDs so that it can
+// be redacted from logs on its own.
+type descString struct {
+	ids  string
+	span string
+}
+
 // store atomically updates d.strPtr with the string representation of desc.
 func (d *atomicDescString) store(replicaID roachpb.ReplicaID, desc *roachpb.RangeDescriptor) {
 	var buf bytes.Buffer
@@ -224,22 +243,26 @@ func (d *atomicDescString) store(replicaID roachpb.ReplicaID, desc *roachpb.Rang
 	} else {
 		fmt.Fprintf(&buf, "%d:", replicaID)
 	}
+	str := descString{ids: buf.String()}
 
+	buf.Reset()
 	if !desc.IsInitialized() {
 		buf.WriteString("{-}")
 	} else {
 		const maxRangeChars = 30
 		keys.PrettyPrintRange(&buf, roachpb.Key(desc.StartKey), roachpb.Key(desc.EndKey), maxRangeChars)
 	}
+	str.span = buf.String()
 
-	str := buf.String()
 	atomic.StorePointer(&d.strPtr, unsafe.Pointer(&str))
 }
 
 // String returns the string representation of the range; since we are not
-// using a lock, the copy might be inconsistent.
+// using a lock, the copy might be inconsistent. The span is redacted when
+// --redact-logs is enabled.
 func (d *atomicDescString) String() string {
-	return *(*string)(atomic.LoadPointer(&d.strPtr))
+	str := (*descString)(atomic.LoadPointer(&d.strPtr))
+	return str.ids + fmt.Sprint(log.Unsafe(str.span))
 }
 
 // A Replica is a contiguous keyspace with writes managed via an
@@ -259,7 +282,13 @@ type Replica struct {
 	// must only be accessed from maybeGossipSystemConfig (which in turn is
 	// only called from the Raft-processing goroutine).
 	systemDBHash []byte
-	abortCache   *AbortCache // Avoids anomalous reads after abort
+	// The system config last gossiped in full and the time at which it was
+	// gossiped. Subsequent changes are gossiped as deltas relative to it.
+	// Same synchronization as systemDBHash, except that the base is also
+	// reset from leasePostApply (also on the Raft-processing goroutine).
+	systemConfigBase     *config.SystemConfig
+	systemConfigBaseTime time.Time
+	abortCache           *AbortCache // Avoids anomalous reads after abort
 
 	// creatingReplica is set when a replica is created as uninitialized
 	// via a raft message.
@@ -570,8 +599,9 @@ func newReplica(rangeID roachpb.RangeID, store *Store) *Replica {
 
 	// Init rangeStr with the range ID.
 	r.rangeStr.store(0, &roachpb.RangeDescriptor{RangeID: rangeID})
-	// Add replica log tag - the value is rangeStr.String().
-	r.AmbientContext.AddLogTag("r", &r.rangeStr)
+	// Add replica log tag - the value is rangeStr.String(), which redacts
+	// the span itself.
+	r.AmbientContext.AddLogTag("r", log.Safe(&r.rangeStr))
 
 	raftMuLogger := syncutil.ThresholdLogger(
 		r.AnnotateCtx(context.Background()),
@@ -676,7 +706,10 @@ func (r *Replica) initLocked(
 	}
 	r.rangeStr.store(0, r.mu.state.Desc)
 
-	r.mu.lastIndex, err = loadLastIndex(ctx, r.store.Engine(), r.RangeID)
+	if err := r.store.loadRaftEngineState(ctx, r.RangeID, r.mu.state.TruncatedState); err != nil {
+		return err
+	}
+	r.mu.lastIndex, err = loadLastIndex(ctx, r.store.raftStateEngine(), r.RangeID)
 	if err != nil {
 		return err
 	}
@@ -731,7 +764,13 @@ func (r *Replica) destroyDataRaftMuLocked(ctx context.Context) error {
 	if err := r.setTombstoneKey(ctx, batch, desc); err != nil {
 		return err
 	}
-	return batch.Commit()
+	if err := batch.Commit(); err != nil {
+		return err
+	}
+	if r.store.raftEngine != nil {
+		return clearRaftState(r.store.raftEngine, desc.RangeID)
+	}
+	return nil
 }
 
 func (r *Replica) setTombstoneKey(
@@ -2166,6 +2205,9 @@ func defaultSubmitProposalLocked(r *Replica, p *EvalResult) error {
 	if err != nil {
 		return err
 	}
+	if int64(len(data)) > maxCommandSize {
+		return errors.Errorf("command is too large: %d bytes (max: %d)", len(data), maxCommandSize)
+	}
 	defer r.store.enqueueRaftUpdateCheck(r.RangeID)
 
 	var changeReplicas *storagebase.ChangeReplicas
@@ -2214,7 +2256,7 @@ func defaultSubmitProposalLocked(r *Replica, p *EvalResult) error {
 
 	return r.withRaftGroupLocked(true, func(raftGroup *raft.RawNode) (bool, error) {
 		if log.V(4) {
-			log.Infof(ctx, "proposing command %x", p.Local.idKey)
+			log.Infof(ctx, "proposing command %x", log.Safe(p.Local.idKey))
 		}
 		// We're proposing a command so there is no need to wake the leader if we
 		// were quiesced.
@@ -2392,7 +2434,7 @@ func (r *Replica) handleRaftReadyRaftMuLocked(
 			return stats, err
 		}
 
-		if lastIndex, err = loadLastIndex(ctx, r.store.Engine(), r.RangeID); err != nil {
+		if lastIndex, err = loadLastIndex(ctx, r.store.raftStateEngine(), r.RangeID); err != nil {
 			return stats, err
 		}
 		// We refresh pending commands after applying a snapshot because this
@@ -2407,7 +2449,9 @@ func (r *Replica) handleRaftReadyRaftMuLocked(
 		}
 	}
 
-	batch := r.store.Engine().NewBatch()
+	// The log entries and HardState go to the raft engine if the store has
+	// one, in which case the main engine is not written to here at all.
+	batch := r.store.raftStateEngine().NewBatch()
 	defer batch.Close()
 
 	// We know that all of the writes from here forward will be to distinct keys.
@@ -2952,9 +2996,8 @@ func (r *Replica) sendRaftMessage(ctx context.Context, msg raftpb.Message) {
 			beganStreaming = true
 			r.store.Stopper().RunWorker(func() {
 				defer r.CloseOutSnap()
-				if err := r.store.cfg.Transport.SendSnapshot(
+				if err := r.sendSnapshot(
 					ctx,
-					r.store.allocator.storePool,
 					SnapshotRequest_Header{
 						RangeDescriptor: *r.Desc(),
 						RaftMessageRequest: RaftMessageRequest{
@@ -2966,7 +3009,7 @@ func (r *Replica) sendRaftMessage(ctx context.Context, msg raftpb.Message) {
 						},
 						RangeSize:  r.GetMVCCStats().Total(),
 						CanDecline: false,
-					}, snap, r.store.Engine().NewBatch); err != nil {
+					}, snap); err != nil {
 					log.Warningf(ctx, "failed to send snapshot: %s", err)
 				}
 				// Report the snapshot status to Raft, which expects us to do this once
@@ -3018,6 +3061,21 @@ func (r *Replica) addUnreachableRemoteReplica(remoteReplica roachpb.ReplicaID) {
 	r.unreachablesMu.Unlock()
 }
 
+// sendSnapshot streams the given outgoing snapshot to the recipient
+// specified in its header. The caller is responsible for closing the
+// OutgoingSnapshot.
+func (r *Replica) sendSnapshot(
+	ctx context.Context, header SnapshotRequest_Header, snap *OutgoingSnapshot,
+) error {
+	if fn := r.store.TestingKnobs().BeforeSnapshotSend; fn != nil {
+		if err := fn(header); err != nil {
+			return err
+		}
+	}
+	return r.store.cfg.Transport.SendSnapshot(
+		ctx, r.store.allocator.storePool, header, snap, r.store.Engine().NewBatch)
+}
+
 // sendRaftMessageRequest sends a raft message, returning false if the message
 // was dropped. It is the caller's responsibility to call ReportUnreachable on
 // the Raft group.
@@ -3074,7 +3132,7 @@ func (r *Replica) processRaftCommand(
 	}
 
 	if log.V(4) {
-		log.Infof(ctx, "processing command %x: maxLeaseIndex=%d", idKey, raftCmd.MaxLeaseIndex)
+		log.Infof(ctx, "processing command %x: maxLeaseIndex=%d", log.Safe(idKey), raftCmd.MaxLeaseIndex)
 	}
 
 	// TODO(bdarnell): the isConsistencyRelated field is insufficiently tested;
@@ -3259,6 +3317,15 @@ func (r *Replica) processRaftCommand(
 			forcedErr = pErr
 		}
 
+		if filter := r.store.cfg.TestingKnobs.TestingPreApplyFilter; forcedErr == nil && filter != nil {
+			forcedErr = filter(storagebase.ApplyFilterArgs{
+				CmdID:                idKey,
+				ReplicatedEvalResult: *raftCmd.ReplicatedEvalResult,
+				StoreID:              r.store.StoreID(),
+				RangeID:              r.RangeID,
+			})
+		}
+
 		if forcedErr != nil {
 			// Apply an empty entry.
 			if raftCmd.ReplicatedEvalResult != nil {
@@ -3931,6 +3998,16 @@ func (r *Replica) executeBatch(
 			maxKeys -= retResults
 		}
 
+		if ba.Header.TargetBytes > 0 {
+			// Keep track of how many bytes remain to be returned. Once the
+			// target is reached, the remaining span requests behave as if the
+			// key limit had been reached.
+			ba.Header.TargetBytes -= reply.Header().NumBytes
+			if ba.Header.TargetBytes <= 0 {
+				maxKeys = 0
+			}
+		}
+
 		// If transactional, we use ba.Txn for each individual command and
 		// accumulate updates to it.
 		// TODO(spencer,tschottdorf): need copy-on-write behavior for the
@@ -4127,13 +4204,35 @@ func (r *Replica) maybeGossipSystemConfig() {
 	}
 
 	cfg := &config.SystemConfig{Values: kvs}
+	// Gossip only the changes since the last full system config while they
+	// are substantially smaller, falling back to the full system config
+	// periodically so that the deltas (which are cumulative) stay small.
+	// Nodes running versions which predate the deltas would ignore them, so
+	// the full system config is gossiped until every node supports them.
+	now := r.store.Clock().PhysicalTime()
+	if base := r.systemConfigBase; base != nil &&
+		now.Sub(r.systemConfigBaseTime) < systemConfigSnapshotInterval &&
+		r.store.Gossip().SystemConfigDeltasSupported() {
+		delta := cfg.Diff(*base)
+		if delta.Size() < cfg.Size()/2 {
+			if err := r.store.Gossip().AddInfoProto(gossip.KeySystemConfigDelta, &delta, 0); err != nil {
+				log.Errorf(ctx, "failed to gossip system config delta: %s", err)
+				return
+			}
+			r.systemDBHash = hash
+			return
+		}
+	}
+
 	if err := r.store.Gossip().AddInfoProto(gossip.KeySystemConfig, cfg, 0); err != nil {
 		log.Errorf(ctx, "failed to gossip system config: %s", err)
 		return
 	}
 
-	// Successfully gossiped. Update tracking hash.
+	// Successfully gossiped. Update tracking hash and delta base.
 	r.systemDBHash = hash
+	r.systemConfigBase = cfg
+	r.systemConfigBaseTime = now
 }
 
 // maybeGossipNodeLiveness gossips information for all node liveness
@@ -48,6 +48,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/protoutil"
 	"github.com/cockroachdb/cockroach/pkg/util/retry"
+	"github.com/cockroachdb/cockroach/pkg/util/stop"
 	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 	"github.com/cockroachdb/cockroach/pkg/util/uuid"
 )
@@ -159,6 +160,9 @@ func (r *Replica) executeCmd(
 	case *roachpb.LeaseInfoRequest:
 		resp := reply.(*roachpb.LeaseInfoResponse)
 		*resp, err = r.LeaseInfo(ctx, *tArgs)
+	case *roachpb.QueryIntentRequest:
+		resp := reply.(*roachpb.QueryIntentResponse)
+		*resp, err = r.QueryIntent(ctx, batch, *tArgs)
 	case *roachpb.ComputeChecksumRequest:
 		resp := reply.(*roachpb.ComputeChecksumResponse)
 		*resp, pd, err = r.ComputeChecksum(ctx, batch, ms, h, *tArgs)
@@ -363,7 +367,8 @@ func (r *Replica) DeleteRange(
 
 // Scan scans the key range specified by start key through end key in ascending order up to some
 // maximum number of results. maxKeys stores the number of scan results remaining for this
-// batch (MaxInt64 for no limit).
+// batch (MaxInt64 for no limit). h.TargetBytes stores the number of bytes remaining for this
+// batch (zero for no limit).
 func (r *Replica) Scan(
 	ctx context.Context,
 	batch engine.ReadWriter,
@@ -371,14 +376,17 @@ func (r *Replica) Scan(
 	maxKeys int64,
 	args roachpb.ScanRequest,
 ) (roachpb.ScanResponse, *roachpb.Span, int64, EvalResult, error) {
-	rows, resumeSpan, intents, err := engine.MVCCScan(ctx, batch, args.Key, args.EndKey, maxKeys, h.Timestamp,
-		h.ReadConsistency == roachpb.CONSISTENT, h.Txn)
-	return roachpb.ScanResponse{Rows: rows}, resumeSpan, int64(len(rows)), intentsToEvalResult(intents, &args), err
+	rows, resumeSpan, intents, err := engine.MVCCScanWithTargetBytes(ctx, batch, args.Key, args.EndKey,
+		maxKeys, h.TargetBytes, h.Timestamp, h.ReadConsistency == roachpb.CONSISTENT, h.Txn, false /* !reverse */)
+	reply := roachpb.ScanResponse{Rows: rows}
+	reply.NumBytes = rowsSize(rows)
+	return reply, resumeSpan, int64(len(rows)), intentsToEvalResult(intents, &args), err
 }
 
 // ReverseScan scans the key range specified by start key through end key in descending order up to
 // some maximum number of results. maxKeys stores the number of scan results remaining for
-// this batch (MaxInt64 for no limit).
+// this batch (MaxInt64 for no limit). h.TargetBytes stores the number of bytes remaining for
+// this batch (zero for no limit).
 func (r *Replica) ReverseScan(
 	ctx context.Context,
 	batch engine.ReadWriter,
@@ -386,9 +394,21 @@ func (r *Replica) ReverseScan(
 	maxKeys int64,
 	args roachpb.ReverseScanRequest,
 ) (roachpb.ReverseScanResponse, *roachpb.Span, int64, EvalResult, error) {
-	rows, resumeSpan, intents, err := engine.MVCCReverseScan(ctx, batch, args.Key, args.EndKey, maxKeys,
-		h.Timestamp, h.ReadConsistency == roachpb.CONSISTENT, h.Txn)
-	return roachpb.ReverseScanResponse{Rows: rows}, resumeSpan, int64(len(rows)), intentsToEvalResult(intents, &args), err
+	rows, resumeSpan, intents, err := engine.MVCCScanWithTargetBytes(ctx, batch, args.Key, args.EndKey,
+		maxKeys, h.TargetBytes, h.Timestamp, h.ReadConsistency == roachpb.CONSISTENT, h.Txn, true /* reverse */)
+	reply := roachpb.ReverseScanResponse{Rows: rows}
+	reply.NumBytes = rowsSize(rows)
+	return reply, resumeSpan, int64(len(rows)), intentsToEvalResult(intents, &args), err
+}
+
+// rowsSize returns the size of the keys and values of the rows, as counted
+// towards the TargetBytes of a batch.
+func rowsSize(rows []roachpb.KeyValue) int64 {
+	var size int64
+	for _, kv := range rows {
+		size += int64(len(kv.Key) + len(kv.Value.RawBytes))
+	}
+	return size
 }
 
 func verifyTransaction(h roachpb.Header, args roachpb.Request) error {
@@ -1590,6 +1610,18 @@ func (r *Replica) TruncateLog(
 		hlc.ZeroTimestamp, nil /* txn */, false /* returnKeys */); err != nil {
 		return reply, EvalResult{}, err
 	}
+	if raftEng := r.store.RaftEngine(); raftEng != nil {
+		// The log lives in the raft engine, from which the entries are removed
+		// when the truncation is applied.
+		iter := raftEng.NewIterator(false /* prefix */)
+		ms, err := iter.ComputeStats(
+			engine.MakeMVCCMetadataKey(start), engine.MakeMVCCMetadataKey(end), 0 /* nowNanos */)
+		iter.Close()
+		if err != nil {
+			return reply, EvalResult{}, err
+		}
+		diff.SysBytes = -ms.SysBytes
+	}
 	r.mu.Lock()
 	raftLogSize := r.mu.raftLogSize + diff.SysBytes
 	r.mu.Unlock()
@@ -1900,8 +1932,10 @@ func (r *Replica) CheckConsistency(
 		}
 		logFunc(ctx, "consistency check failed with %d inconsistent replicas", inconsistencyCount)
 	} else {
-		if err := r.store.stopper.RunAsyncTask(
-			r.AnnotateCtx(context.Background()), func(ctx context.Context) {
+		// Fetching the details is maintenance work, which is given up while
+		// the node is draining.
+		if err := r.store.stopper.RunAsyncTaskWithClass(
+			r.AnnotateCtx(context.Background()), stop.BackgroundTask, func(ctx context.Context) {
 				log.Errorf(ctx, "consistency check failed with %d inconsistent replicas; fetching details",
 					inconsistencyCount)
 				// Keep the request from crossing the local->global boundary.
@@ -2374,7 +2408,7 @@ func (r *Replica) adminSplitWithDescriptor(
 	leftDesc.EndKey = splitKey
 
 	log.Infof(ctx, "initiating a split of this range at key %s [r%d]",
-		splitKey, rightDesc.RangeID)
+		log.Unsafe(splitKey), rightDesc.RangeID)
 
 	if err := r.store.DB().Txn(ctx, func(txn *client.Txn) error {
 		log.Event(ctx, "split closure begins")
@@ -2733,7 +2767,7 @@ func (r *Replica) splitTrigger(
 		// to not reading from the batch is that we won't see any writes to the
 		// right hand side's hard state that were previously made in the batch
 		// (which should be impossible).
-		oldHS, err := loadHardState(ctx, r.store.Engine(), split.RightDesc.RangeID)
+		oldHS, err := loadHardState(ctx, r.store.raftStateEngine(), split.RightDesc.RangeID)
 		if err != nil {
 			return enginepb.MVCCStats{}, EvalResult{}, errors.Wrap(err, "unable to load hard state")
 		}
@@ -3232,8 +3266,7 @@ func (r *Replica) ChangeReplicas(
 				// Recipients can choose to decline preemptive snapshots.
 				CanDecline: true,
 			}
-			if err := r.store.cfg.Transport.SendSnapshot(
-				ctx, r.store.allocator.storePool, req, snap, r.store.Engine().NewBatch); err != nil {
+			if err := r.sendSnapshot(ctx, req, snap); err != nil {
 				return &preemptiveSnapshotError{
 					errors.Wrapf(err, "%s: change replicas aborted due to failed preemptive snapshot", r),
 				}
@@ -3416,3 +3449,26 @@ func (r *Replica) LeaseInfo(
 	}
 	return reply, nil
 }
+
+// QueryIntent checks whether the transaction specified in the request has
+// written an intent at the key. An intent only matches if it was written in
+// the same epoch and at a timestamp no higher than the transaction's. If
+// ErrorIfMissing is set, a missing intent results in an error.
+func (r *Replica) QueryIntent(
+	ctx context.Context, batch engine.ReadWriter, args roachpb.QueryIntentRequest,
+) (roachpb.QueryIntentResponse, error) {
+	var reply roachpb.QueryIntentResponse
+	var meta enginepb.MVCCMetadata
+	ok, _, _, err := batch.GetProto(engine.MakeMVCCMetadataKey(args.Key), &meta)
+	if err != nil {
+		return reply, err
+	}
+	reply.FoundIntent = ok && meta.Txn != nil &&
+		roachpb.TxnIDEqual(meta.Txn.ID, args.Txn.ID) &&
+		meta.Txn.Epoch == args.Txn.Epoch &&
+		!args.Txn.Timestamp.Less(meta.Txn.Timestamp)
+	if !reply.FoundIntent && args.ErrorIfMissing {
+		return reply, errors.Errorf("intent of txn %s missing at key %s", args.Txn.Short(), args.Key)
+	}
+	return reply, nil
+}
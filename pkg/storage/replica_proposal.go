@@ -353,6 +353,11 @@ func (r *Replica) leasePostApply(
 		r.mu.tsCache.SetLowWater(newLease.Start)
 		r.mu.Unlock()
 
+		// The system config may have been gossiped by other lease holders
+		// since this replica last gossiped it, so the next gossip must be a
+		// full system config rather than a delta against a stale base.
+		r.systemConfigBase = nil
+
 		// Gossip the first range whenever its lease is acquired. We check to
 		// make sure the lease is active so that a trailing replica won't process
 		// an old lease request and attempt to gossip the first range.
@@ -561,6 +566,13 @@ func (r *Replica) handleReplicatedEvalResult(
 		// Clear any entries in the Raft log entry cache for this range up
 		// to and including the most recently truncated index.
 		r.store.raftEntryCache.clearTo(r.RangeID, newTruncState.Index+1)
+		if r.store.raftEngine != nil {
+			// A truncation which is lost in a crash is redone when the
+			// replica is loaded again.
+			if err := r.store.truncateRaftEngineLog(ctx, r.RangeID, *newTruncState); err != nil {
+				log.Fatal(ctx, errors.Wrap(err, "unable to truncate raft engine log"))
+			}
+		}
 	}
 
 	if newThresh := rResult.State.GCThreshold; newThresh != hlc.ZeroTimestamp {
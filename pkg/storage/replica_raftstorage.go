@@ -55,7 +55,7 @@ var _ raft.Storage = (*Replica)(nil)
 // InitialState requires that the replica lock be held.
 func (r *Replica) InitialState() (raftpb.HardState, raftpb.ConfState, error) {
 	ctx := r.AnnotateCtx(context.TODO())
-	hs, err := loadHardState(ctx, r.store.Engine(), r.RangeID)
+	hs, err := loadHardState(ctx, r.store.raftStateEngine(), r.RangeID)
 	// For uninitialized ranges, membership is unknown at this point.
 	if raft.IsEmptyHardState(hs) || err != nil {
 		return raftpb.HardState{}, raftpb.ConfState{}, err
@@ -73,7 +73,7 @@ func (r *Replica) InitialState() (raftpb.HardState, raftpb.ConfState, error) {
 // maxBytes. Passing maxBytes equal to zero disables size checking.
 // Entries requires that the replica lock is held.
 func (r *Replica) Entries(lo, hi, maxBytes uint64) ([]raftpb.Entry, error) {
-	snap := r.store.NewSnapshot()
+	snap := r.store.raftStateEngine().NewSnapshot()
 	defer snap.Close()
 	ctx := r.AnnotateCtx(context.TODO())
 	return entries(ctx, snap, r.RangeID, r.store.raftEntryCache, lo, hi, maxBytes)
@@ -195,7 +195,7 @@ func iterateEntries(
 // Term implements the raft.Storage interface.
 // Term requires that the replica lock is held.
 func (r *Replica) Term(i uint64) (uint64, error) {
-	snap := r.store.NewSnapshot()
+	snap := r.store.raftStateEngine().NewSnapshot()
 	defer snap.Close()
 	ctx := r.AnnotateCtx(context.TODO())
 	return term(ctx, snap, r.RangeID, r.store.raftEntryCache, i)
@@ -313,14 +313,25 @@ func (r *Replica) snapshotWithContext(
 	ctx, sp := r.AnnotateCtxWithSpan(ctx, "snapshot")
 	defer sp.Finish()
 	snap := r.store.NewSnapshot()
+	// The raft engine snapshot is taken second so that it contains all of the
+	// log entries up to the applied index of the main engine snapshot. Entries
+	// are only removed from the raft engine after the truncated state has been
+	// updated under the replica lock, which is held here.
+	raftSnap := snap
+	if r.store.raftEngine != nil {
+		raftSnap = r.store.raftEngine.NewSnapshot()
+	}
 	log.Eventf(ctx, "new engine snapshot for replica %s", r)
 
 	// Delegate to a static function to make sure that we do not depend
 	// on any indirect calls to r.store.Engine() (or other in-memory
 	// state of the Replica). Everything must come from the snapshot.
-	snapData, err := snapshot(ctx, snapType, snap, rangeID, r.store.raftEntryCache, startKey)
+	snapData, err := snapshot(ctx, snapType, snap, raftSnap, rangeID, r.store.raftEntryCache, startKey)
 	if err != nil {
 		log.Errorf(ctx, "error generating snapshot: %s", err)
+		if raftSnap != snap {
+			raftSnap.Close()
+		}
 		return nil, err
 	}
 	log.Event(ctx, "snapshot generated")
@@ -376,6 +387,9 @@ type OutgoingSnapshot struct {
 	RaftSnap raftpb.Snapshot
 	// The RocksDB snapshot that will be streamed from.
 	EngineSnap engine.Reader
+	// The snapshot of the engine holding the raft log, from which the log
+	// entries are read. It is EngineSnap unless the store has a raft engine.
+	RaftEngineSnap engine.Reader
 	// The complete range iterator for the snapshot to stream.
 	Iter *ReplicaDataIterator
 	// True if a goroutine has scheduled a call to CloseOutSnap for this snap.
@@ -401,6 +415,9 @@ func (r *Replica) CloseOutSnap() {
 	defer r.mu.Unlock()
 	r.mu.outSnap.Iter.Close()
 	r.mu.outSnap.EngineSnap.Close()
+	if r.mu.outSnap.RaftEngineSnap != r.mu.outSnap.EngineSnap {
+		r.mu.outSnap.RaftEngineSnap.Close()
+	}
 	r.mu.outSnap = OutgoingSnapshot{}
 	close(r.mu.outSnapDone)
 	r.store.ReleaseRaftSnapshot()
@@ -411,6 +428,7 @@ func snapshot(
 	ctx context.Context,
 	snapType string,
 	snap engine.Reader,
+	raftSnap engine.Reader,
 	rangeID roachpb.RangeID,
 	eCache *raftEntryCache,
 	startKey roachpb.RKey,
@@ -445,7 +463,7 @@ func snapshot(
 		cs.Nodes = append(cs.Nodes, uint64(rep.ReplicaID))
 	}
 
-	term, err := term(ctx, snap, rangeID, eCache, appliedIndex)
+	term, err := term(ctx, raftSnap, rangeID, eCache, appliedIndex)
 	if err != nil {
 		return OutgoingSnapshot{}, errors.Errorf("failed to fetch term of %d: %s", appliedIndex, err)
 	}
@@ -458,9 +476,10 @@ func snapshot(
 	log.Infof(ctx, "generated %s snapshot %s at index %d",
 		snapType, snapUUID.Short(), appliedIndex)
 	return OutgoingSnapshot{
-		EngineSnap: snap,
-		Iter:       iter,
-		SnapUUID:   snapUUID,
+		EngineSnap:     snap,
+		RaftEngineSnap: raftSnap,
+		Iter:           iter,
+		SnapUUID:       snapUUID,
 		RaftSnap: raftpb.Snapshot{
 			Data: snapUUID.GetBytes(),
 			Metadata: raftpb.SnapshotMetadata{
@@ -711,6 +730,11 @@ func (r *Replica) applySnapshot(
 	if err := batch.Commit(); err != nil {
 		return err
 	}
+	// The snapshot's raft state was written to the main engine together with
+	// its replicated data; move it to the raft engine (if any).
+	if err := r.store.handOffRaftState(ctx, r.RangeID); err != nil {
+		return err
+	}
 	stats.commit = timeutil.Now()
 
 	r.mu.Lock()
@@ -49,7 +49,6 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/storage/engine/enginepb"
 	"github.com/cockroachdb/cockroach/pkg/storage/storagebase"
 	"github.com/cockroachdb/cockroach/pkg/testutils"
-	"github.com/cockroachdb/cockroach/pkg/util"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
@@ -168,7 +167,7 @@ func (tc *testContext) StartWithStoreConfig(t testing.TB, cfg StoreConfig) {
 		// store will be passed to the sender after it is created and bootstrapped.
 		sender := &testSender{}
 		cfg.DB = client.NewDB(sender)
-		tc.store = NewStore(cfg, tc.engine, &roachpb.NodeDescriptor{NodeID: 1})
+		tc.store = NewStore(cfg, tc.engine, nil /* raftEng */, &roachpb.NodeDescriptor{NodeID: 1})
 		if err := tc.store.Bootstrap(roachpb.StoreIdent{
 			ClusterID: uuid.MakeV4(),
 			NodeID:    1,
@@ -268,7 +267,7 @@ func (tc *testContext) initConfigs(realRange bool, t testing.TB) error {
 		return err
 	}
 
-	util.SucceedsSoon(t, func() error {
+	SucceedsSoon(t, func() error {
 		if _, ok := tc.gossip.GetSystemConfig(); !ok {
 			return errors.Errorf("expected system config to be set")
 		}
@@ -601,7 +600,7 @@ func TestBehaviorDuringLeaseTransfer(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	util.SucceedsSoon(t, func() error {
+	SucceedsSoon(t, func() error {
 		tc.repl.mu.Lock()
 		defer tc.repl.mu.Unlock()
 		_, pending := tc.repl.mu.pendingLeaseRequest.TransferInProgress(repDesc.ReplicaID)
@@ -973,7 +972,7 @@ func TestReplicaGossipConfigsOnLease(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	util.SucceedsSoon(t, func() error {
+	SucceedsSoon(t, func() error {
 		cfg, ok := tc.gossip.GetSystemConfig()
 		if !ok {
 			return errors.Errorf("expected system config to be set")
@@ -1717,7 +1716,7 @@ func TestAcquireLease(t *testing.T) {
 		}
 		// Since the command we sent above does not get blocked on the lease
 		// extension, we need to wait for it to go through.
-		util.SucceedsSoon(t, func() error {
+		SucceedsSoon(t, func() error {
 			newLease, _ := tc.repl.getLease()
 			if !lease.StartStasis.Less(newLease.StartStasis) {
 				return errors.Errorf("%d: lease did not get extended: %+v to %+v", i, lease, newLease)
@@ -2188,7 +2187,7 @@ func TestReplicaCommandQueueCancellation(t *testing.T) {
 	cmd3Done := startBlockingCmd(ctx, key1, key2)
 
 	// Wait until both commands are in the command queue.
-	util.SucceedsSoon(t, func() error {
+	SucceedsSoon(t, func() error {
 		tc.repl.cmdQMu.Lock()
 		chans := tc.repl.cmdQMu.global.getWait(false, roachpb.Span{Key: key1}, roachpb.Span{Key: key2})
 		tc.repl.cmdQMu.Unlock()
@@ -2253,6 +2252,28 @@ func TestReplicaUseTSCache(t *testing.T) {
 	}
 }
 
+// TestReplicaMaxCommandSize verifies that commands which exceed the maximum
+// raft command size are rejected at proposal time.
+func TestReplicaMaxCommandSize(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	tc := testContext{}
+	tc.Start(t)
+	defer tc.Stop()
+
+	defer func(size int64) { maxCommandSize = size }(maxCommandSize)
+	maxCommandSize = 1 << 10
+
+	pArgs := putArgs([]byte("a"), make([]byte, maxCommandSize))
+	if _, pErr := tc.SendWrapped(&pArgs); !testutils.IsPError(pErr, "command is too large") {
+		t.Fatalf("expected command too large error, got %v", pErr)
+	}
+
+	pArgs = putArgs([]byte("a"), []byte("value"))
+	if _, pErr := tc.SendWrapped(&pArgs); pErr != nil {
+		t.Fatal(pErr)
+	}
+}
+
 // TestReplicaNoTSCacheInconsistent verifies that the timestamp cache
 // is not affected by inconsistent reads.
 func TestReplicaNoTSCacheInconsistent(t *testing.T) {
@@ -3601,7 +3622,7 @@ func TestEndTransactionDirectGC(t *testing.T) {
 
 			rightRng, txn := setupResolutionTest(t, tc, testKey, splitKey, false /* generate abort cache entry */)
 
-			util.SucceedsSoon(t, func() error {
+			SucceedsSoon(t, func() error {
 				if gr, _, err := tc.repl.Get(
 					ctx, tc.engine, roachpb.Header{},
 					roachpb.GetRequest{Span: roachpb.Span{
@@ -3661,7 +3682,7 @@ func TestEndTransactionDirectGCFailure(t *testing.T) {
 	// happened and subsequently issue a bogus Put which is likely to make it
 	// into Raft only after a rogue GCRequest (at least sporadically), which
 	// would trigger a Fatal from the command filter.
-	util.SucceedsSoon(t, func() error {
+	SucceedsSoon(t, func() error {
 		if atomic.LoadInt64(&count) == 0 {
 			return errors.Errorf("intent resolution not attempted yet")
 		} else if err := tc.store.DB().Put(context.TODO(), "panama", "banana"); err != nil {
@@ -3739,7 +3760,7 @@ func TestReplicaResolveIntentNoWait(t *testing.T) {
 		}}, false /* !wait */, false /* !poison; irrelevant */); pErr != nil {
 		t.Fatal(pErr)
 	}
-	util.SucceedsSoon(t, func() error {
+	SucceedsSoon(t, func() error {
 		if atomic.LoadInt32(&seen) > 0 {
 			return nil
 		}
@@ -3747,6 +3768,64 @@ func TestReplicaResolveIntentNoWait(t *testing.T) {
 	})
 }
 
+// TestReplicaQueryIntent verifies that QueryIntent only finds intents
+// written by the specified transaction in the same epoch, and that it
+// returns an error for missing intents if requested.
+func TestReplicaQueryIntent(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	tc := testContext{}
+	tc.Start(t)
+	defer tc.Stop()
+
+	key := roachpb.Key("a")
+	txn := newTransaction("test", key, 1, enginepb.SERIALIZABLE, tc.Clock())
+	pArgs := putArgs(key, []byte("value"))
+	if _, pErr := maybeWrapWithBeginTransaction(context.Background(), tc.Sender(), roachpb.Header{
+		Txn: txn,
+	}, &pArgs); pErr != nil {
+		t.Fatal(pErr)
+	}
+
+	otherTxn := newTransaction("other", key, 1, enginepb.SERIALIZABLE, tc.Clock())
+	nextEpoch := txn.TxnMeta
+	nextEpoch.Epoch++
+	earlier := txn.TxnMeta
+	earlier.Timestamp = earlier.Timestamp.Prev()
+
+	testCases := []struct {
+		key   roachpb.Key
+		txn   enginepb.TxnMeta
+		found bool
+	}{
+		{key, txn.TxnMeta, true},
+		{key, otherTxn.TxnMeta, false},
+		{key, nextEpoch, false},
+		{key, earlier, false},
+		{roachpb.Key("b"), txn.TxnMeta, false},
+	}
+	for i, test := range testCases {
+		qArgs := roachpb.QueryIntentRequest{
+			Span: roachpb.Span{Key: test.key},
+			Txn:  test.txn,
+		}
+		reply, pErr := tc.SendWrapped(&qArgs)
+		if pErr != nil {
+			t.Fatalf("%d: %s", i, pErr)
+		}
+		if found := reply.(*roachpb.QueryIntentResponse).FoundIntent; found != test.found {
+			t.Errorf("%d: expected found=%t, got %t", i, test.found, found)
+		}
+
+		qArgs.ErrorIfMissing = true
+		_, pErr = tc.SendWrapped(&qArgs)
+		if test.found && pErr != nil {
+			t.Errorf("%d: unexpected error: %s", i, pErr)
+		} else if !test.found && !testutils.IsPError(pErr, "intent of txn .* missing") {
+			t.Errorf("%d: expected missing intent error, got %v", i, pErr)
+		}
+	}
+}
+
 // TestAbortCachePoisonOnResolve verifies that when an intent is
 // aborted, the abort cache on the respective Range is poisoned and
 // the pushee is presented with a txn abort on its next contact with
@@ -5384,7 +5463,7 @@ func TestReplicaLoadSystemConfigSpanIntent(t *testing.T) {
 	// In the loop, wait until the intent is aborted. Then write a "real" value
 	// there and verify that we can now load the data as expected.
 	v := roachpb.MakeValueFromString("foo")
-	util.SucceedsSoon(t, func() error {
+	SucceedsSoon(t, func() error {
 		if err := engine.MVCCPut(context.Background(), repl.store.Engine(), &enginepb.MVCCStats{},
 			keys.SystemConfigSpan.Key, repl.store.Clock().Now(), v, nil); err != nil {
 			return err
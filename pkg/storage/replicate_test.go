@@ -20,7 +20,7 @@ import (
 	"testing"
 
 	"github.com/cockroachdb/cockroach/pkg/server"
-	"github.com/cockroachdb/cockroach/pkg/util"
+	"github.com/cockroachdb/cockroach/pkg/storage"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/pkg/errors"
 )
@@ -43,7 +43,7 @@ func TestEagerReplication(t *testing.T) {
 	// replicateQueue after a split occurs happens after the update of the
 	// descriptors in meta2 leaving a tiny window of time in which the newly
 	// split replica will not have been added to purgatory. Thus we loop.
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		// After the initial splits have been performed, all of the resulting ranges
 		// should be present in replicate queue purgatory (because we only have a
 		// single store in the test and thus replication cannot succeed).
@@ -21,7 +21,6 @@ import (
 	"testing"
 
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
-	"github.com/cockroachdb/cockroach/pkg/util"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/stop"
@@ -199,7 +198,7 @@ func TestSchedulerLoop(t *testing.T) {
 	s.Start(stopper)
 	s.EnqueueRaftTick(1, 2, 3)
 
-	util.SucceedsSoon(t, func() error {
+	SucceedsSoon(t, func() error {
 		const expected = "ready=[] request=[] tick=[1:1,2:1,3:1]"
 		if s := p.String(); expected != s {
 			return errors.Errorf("expected %s, but got %s", expected, s)
@@ -232,7 +231,7 @@ func TestSchedulerBuffering(t *testing.T) {
 	for _, c := range testCases {
 		s.signal(s.enqueueN(c.state, 1, 1, 1, 1, 1))
 
-		util.SucceedsSoon(t, func() error {
+		SucceedsSoon(t, func() error {
 			if s := p.String(); c.expected != s {
 				return errors.Errorf("expected %s, but got %s", c.expected, s)
 			}
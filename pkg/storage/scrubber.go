@@ -0,0 +1,110 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+)
+
+// scrubConsistencyCheckPriority is the priority with which replicas found
+// to contain corrupted data are added to the consistency queue. The
+// consistency scanner adds replicas with a priority of 1.
+const scrubConsistencyCheckPriority = 10.0
+
+// startScrubber starts a worker which verifies the checksums of the store's
+// on-disk data one replica at a time, pacing itself so that a full pass over
+// the store takes ScrubInterval. Latent disk corruption is otherwise only
+// found when the corrupted data happens to be read. Replicas in which
+// corruption is found are handed to the consistency checker.
+func (s *Store) startScrubber() {
+	if s.cfg.ScrubInterval <= 0 {
+		return
+	}
+	s.stopper.RunWorker(func() {
+		ctx := s.AnnotateCtx(context.Background())
+		for {
+			if !s.scrubPass(ctx, s.cfg.ScrubInterval) {
+				return
+			}
+		}
+	})
+}
+
+// scrubPass verifies the data of each of the store's replicas, spreading
+// the work evenly over interval. It returns false if the stopper began
+// stopping before the pass completed.
+func (s *Store) scrubPass(ctx context.Context, interval time.Duration) bool {
+	var replicas []*Replica
+	newStoreReplicaVisitor(s).Visit(func(repl *Replica) bool {
+		replicas = append(replicas, repl)
+		return true
+	})
+
+	start := timeutil.Now()
+	wait := interval
+	if len(replicas) > 0 {
+		wait = interval / time.Duration(len(replicas))
+	}
+	var timer timeutil.Timer
+	defer timer.Stop()
+	// Wait before each replica, and for a full interval if there are no
+	// replicas, so that passes over small stores do not spin.
+	for i := 0; i == 0 || i < len(replicas); i++ {
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+			timer.Read = true
+		case <-s.stopper.ShouldStop():
+			return false
+		}
+		if i >= len(replicas) || replicas[i].IsDestroyed() != nil {
+			continue
+		}
+		_ = s.scrubReplica(ctx, replicas[i])
+	}
+
+	s.metrics.ScrubberPasses.Inc(1)
+	if log.V(1) {
+		log.Infof(ctx, "scrubbed %d replicas in %s", len(replicas), timeutil.Since(start))
+	}
+	return true
+}
+
+// scrubReplica verifies the checksums of all of the data of the replica,
+// including its range-local keys. If corruption is found, it is reported
+// and the replica is queued for a consistency check, which determines
+// whether the corruption affects the replica's replicated state.
+func (s *Store) scrubReplica(ctx context.Context, repl *Replica) error {
+	for _, r := range makeAllKeyRanges(repl.Desc()) {
+		n, err := s.engine.VerifyChecksums(r.start.Key, r.end.Key)
+		s.metrics.ScrubberBytesVerified.Inc(n)
+		if err != nil {
+			s.metrics.ScrubberCorruptions.Inc(1)
+			log.Errorf(ctx, "%s: corrupted data found in %s-%s: %s", repl, r.start, r.end, err)
+			if s.replicaConsistencyQueue != nil {
+				if _, qErr := s.replicaConsistencyQueue.Add(repl, scrubConsistencyCheckPriority); qErr != nil {
+					log.Warningf(ctx, "%s: unable to queue consistency check: %s", repl, qErr)
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
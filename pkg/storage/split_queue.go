@@ -100,7 +100,7 @@ func (sq *splitQueue) process(
 	desc := r.Desc()
 	splitKeys := sysCfg.ComputeSplitKeys(desc.StartKey, desc.EndKey)
 	if len(splitKeys) > 0 {
-		log.Infof(ctx, "splitting at keys %v", splitKeys)
+		log.Infof(ctx, "splitting at keys %v", log.Unsafe(splitKeys))
 		for _, splitKey := range splitKeys {
 			if _, pErr := r.adminSplitWithDescriptor(
 				ctx,
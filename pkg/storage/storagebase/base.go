@@ -61,7 +61,7 @@ func (f *FilterArgs) InRaftCmd() bool {
 type ReplicaCommandFilter func(args FilterArgs) *roachpb.Error
 
 // A ReplicaApplyFilter can be used in testing to influence the error returned
-// from proposals after they apply.
+// from proposals before or after they apply, or to delay their application.
 type ReplicaApplyFilter func(args ApplyFilterArgs) *roachpb.Error
 
 // ReplicaResponseFilter is used in unittests to modify the outbound
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"math/rand"
 	"runtime"
 	"sync"
 	"sync/atomic"
@@ -65,8 +66,6 @@ const (
 	defaultHeartbeatIntervalTicks   = 5
 	defaultRaftElectionTimeoutTicks = 15
 	defaultAsyncSnapshotMaxAge      = time.Minute
-	// ttlStoreGossip is time-to-live for store-related info.
-	ttlStoreGossip = 2 * time.Minute
 
 	// preemptiveSnapshotRaftGroupID is a bogus ID for which a Raft group is
 	// temporarily created during the application of a preemptive snapshot.
@@ -150,6 +149,24 @@ func TestStoreConfig(clock *hlc.Clock) StoreConfig {
 	}
 }
 
+// QuiescentTestStoreConfig is like TestStoreConfig, but turns off the
+// background processing of the store: the replica scanner and all of its
+// queues, consistency checks and periodic gossiping. Tests which need one of
+// them clear the corresponding testing knob (for example DisableSplitQueue)
+// or set the corresponding interval again.
+func QuiescentTestStoreConfig(clock *hlc.Clock) StoreConfig {
+	cfg := TestStoreConfig(clock)
+	cfg.ConsistencyCheckInterval = 0
+	cfg.TestingKnobs.DisableScanner = true
+	cfg.TestingKnobs.DisableGCQueue = true
+	cfg.TestingKnobs.DisableSplitQueue = true
+	cfg.TestingKnobs.DisableReplicateQueue = true
+	cfg.TestingKnobs.DisableReplicaGCQueue = true
+	cfg.TestingKnobs.DisableRaftLogQueue = true
+	cfg.TestingKnobs.DisablePeriodicGossips = true
+	return cfg
+}
+
 var (
 	raftMaxSizePerMsg   = envutil.EnvOrDefaultInt("COCKROACH_RAFT_MAX_SIZE_PER_MSG", 16*1024)
 	raftMaxInflightMsgs = envutil.EnvOrDefaultInt("COCKROACH_RAFT_MAX_INFLIGHT_MSGS", 4)
@@ -347,6 +364,7 @@ type Store struct {
 	cfg                     StoreConfig
 	db                      *client.DB
 	engine                  engine.Engine               // The underlying key-value store
+	raftEngine              engine.Engine               // Dedicated engine for raft data; may be nil
 	allocator               Allocator                   // Makes allocation decisions
 	rangeIDAlloc            *idAllocator                // Range ID allocator
 	gcQueue                 *gcQueue                    // Garbage collection queue
@@ -591,6 +609,11 @@ type StoreConfig struct {
 	// replication consistency check failure.
 	ConsistencyCheckPanicOnFailure bool
 
+	// ScrubInterval is the time over which the scrubber spreads a full pass
+	// verifying the checksums of the store's on-disk data. A value of zero
+	// disables the scrubber.
+	ScrubInterval time.Duration
+
 	// AllocatorOptions configures how the store will attempt to rebalance its
 	// replicas to other stores.
 	AllocatorOptions AllocatorOptions
@@ -633,10 +656,21 @@ type StoreTestingKnobs struct {
 	// If your filter is not idempotent, consider wrapping it in a
 	// ReplayProtectionFilterWrapper.
 	TestingCommandFilter storagebase.ReplicaCommandFilter
-	TestingApplyFilter   storagebase.ReplicaApplyFilter
-	// TestingResponseFilter is called after the replica processes a
-	// command in order for unittests to modify the batch response,
-	// error returned to the client, or to simulate network failures.
+	// TestingPreApplyFilter is called on every replica before a command
+	// is applied to the state machine, and may block to delay the
+	// application. If it returns an error, the command is applied as an
+	// empty entry and the error is returned to the proposer; the filter must
+	// then return the same error on all replicas to keep them consistent.
+	TestingPreApplyFilter storagebase.ReplicaApplyFilter
+	// TestingApplyFilter is called on every replica after a command has
+	// been applied to the state machine. An error it returns is passed to
+	// the proposer, but the command remains applied.
+	TestingApplyFilter storagebase.ReplicaApplyFilter
+	// TestingResponseFilter is called with the batch request and response
+	// after the replica successfully processes a command, before the
+	// response leaves the store, in order for unittests to modify the batch
+	// response, error returned to the client, or to simulate network
+	// failures and ambiguous results.
 	TestingResponseFilter storagebase.ReplicaResponseFilter
 	// If non-nil, BadChecksumPanic is called by CheckConsistency() instead of
 	// panicking on a checksum mismatch.
@@ -674,8 +708,22 @@ type StoreTestingKnobs struct {
 	// replica.TransferLease() encounters an in-progress lease extension.
 	// nextLeader is the replica that we're trying to transfer the lease to.
 	LeaseTransferBlockedOnExtensionEvent func(nextLeader roachpb.ReplicaDescriptor)
+	// BeforeSnapshotSend, if set, is called with the header of every
+	// snapshot (Raft or preemptive) the store is about to send. It may block
+	// to delay the snapshot; if it returns an error, the snapshot is not
+	// sent and the error is treated as a failure to send it.
+	BeforeSnapshotSend func(header SnapshotRequest_Header) error
+	// BeforeSnapshotApply, if set, is called with the header of every
+	// snapshot the store has received, before the snapshot is applied. It
+	// may block to delay the application; if it returns an error, the
+	// snapshot is rejected with that error.
+	BeforeSnapshotApply func(header SnapshotRequest_Header) error
 	// DisableReplicaGCQueue disables the replication queue.
 	DisableReplicaGCQueue bool
+	// DisableGCQueue disables the GC queue.
+	DisableGCQueue bool
+	// DisableRaftLogQueue disables the raft log queue.
+	DisableRaftLogQueue bool
 	// DisableReplicateQueue disables the replication queue.
 	DisableReplicateQueue bool
 	// DisableSplitQueue disables the split queue.
@@ -705,6 +753,12 @@ type StoreTestingKnobs struct {
 	// SkipMinSizeCheck, if set, makes the store creation process skip the check
 	// for a minimum size.
 	SkipMinSizeCheck bool
+	// RandSeed, if non-zero, seeds the random decisions of the store's
+	// allocator, which makes them reproducible.
+	RandSeed int64
+	// NodeLiveness contains the testing knobs of the node liveness of the
+	// node the store belongs to.
+	NodeLiveness NodeLivenessTestingKnobs
 }
 
 var _ base.ModuleTestingKnobs = &StoreTestingKnobs{}
@@ -720,6 +774,7 @@ func (sc *StoreConfig) Valid() bool {
 		sc.RaftTickInterval != 0 && sc.RaftHeartbeatIntervalTicks > 0 &&
 		sc.RaftElectionTimeoutTicks > 0 && sc.ScanInterval >= 0 &&
 		sc.ConsistencyCheckInterval >= 0 &&
+		sc.ScrubInterval >= 0 &&
 		sc.AmbientCtx.Tracer != nil
 }
 
@@ -763,7 +818,9 @@ func (sc *StoreConfig) SetDefaults() {
 }
 
 // NewStore returns a new instance of a store.
-func NewStore(cfg StoreConfig, eng engine.Engine, nodeDesc *roachpb.NodeDescriptor) *Store {
+func NewStore(
+	cfg StoreConfig, eng, raftEng engine.Engine, nodeDesc *roachpb.NodeDescriptor,
+) *Store {
 	// TODO(tschottdorf) find better place to set these defaults.
 	cfg.SetDefaults()
 
@@ -778,6 +835,9 @@ func NewStore(cfg StoreConfig, eng engine.Engine, nodeDesc *roachpb.NodeDescript
 		nodeDesc:  nodeDesc,
 		metrics:   newStoreMetrics(cfg.MetricsSampleInterval),
 	}
+	if seed := cfg.TestingKnobs.RandSeed; seed != 0 {
+		s.allocator.randGen = makeAllocatorRand(rand.NewSource(seed))
+	}
 
 	// EnableCoalescedHeartbeats is enabled by TestStoreConfig, so in that case
 	// ignore the environment variable. Otherwise, use whatever the environment
@@ -787,6 +847,10 @@ func NewStore(cfg StoreConfig, eng engine.Engine, nodeDesc *roachpb.NodeDescript
 			"COCKROACH_ENABLE_COALESCED_HEARTBEATS", false)
 	}
 
+	if raftEng != nil && raftEng != eng {
+		s.raftEngine = raftEng
+	}
+
 	s.intentResolver = newIntentResolver(s)
 	s.raftEntryCache = newRaftEntryCache(cfg.RaftEntryCacheSize)
 	s.drainLeases.Store(false)
@@ -849,6 +913,12 @@ func NewStore(cfg StoreConfig, eng engine.Engine, nodeDesc *roachpb.NodeDescript
 	if cfg.TestingKnobs.DisableReplicaGCQueue {
 		s.setReplicaGCQueueActive(false)
 	}
+	if cfg.TestingKnobs.DisableGCQueue {
+		s.setGCQueueActive(false)
+	}
+	if cfg.TestingKnobs.DisableRaftLogQueue {
+		s.setRaftLogQueueActive(false)
+	}
 	if cfg.TestingKnobs.DisableReplicateQueue {
 		s.setReplicateQueueActive(false)
 	}
@@ -962,12 +1032,22 @@ func IterateRangeDescriptors(
 func (s *Store) migrate(ctx context.Context, desc roachpb.RangeDescriptor) {
 	batch := s.engine.NewBatch()
 	defer batch.Close()
-	if err := migrate7310And6991(ctx, batch, desc); err != nil {
+	raftBatch := batch
+	if s.raftEngine != nil {
+		raftBatch = s.raftEngine.NewBatch()
+		defer raftBatch.Close()
+	}
+	if err := migrate7310And6991(ctx, batch, raftBatch, desc); err != nil {
 		log.Fatal(ctx, errors.Wrap(err, "during migration"))
 	}
 	if err := batch.Commit(); err != nil {
 		log.Fatal(ctx, errors.Wrap(err, "could not migrate Raft state"))
 	}
+	if raftBatch != batch {
+		if err := raftBatch.Commit(); err != nil {
+			log.Fatal(ctx, errors.Wrap(err, "could not migrate Raft state"))
+		}
+	}
 }
 
 // ReadStoreIdent reads the StoreIdent from the store.
@@ -985,6 +1065,29 @@ func ReadStoreIdent(ctx context.Context, eng engine.Engine) (roachpb.StoreIdent,
 	return ident, err
 }
 
+// ReadHLCUpperBound returns the upper bound on the wall time of the node's
+// clock persisted to the store by WriteHLCUpperBound, or zero if none was
+// persisted.
+func ReadHLCUpperBound(ctx context.Context, eng engine.Engine) (int64, error) {
+	var ts hlc.Timestamp
+	if _, err := engine.MVCCGetProto(
+		ctx, eng, keys.StoreHLCUpperBoundKey(), hlc.ZeroTimestamp, true, nil, &ts); err != nil {
+		return 0, err
+	}
+	return ts.WallTime, nil
+}
+
+// WriteHLCUpperBound durably persists an upper bound on the wall time of the
+// node's clock, which the clock is kept above after a restart.
+func WriteHLCUpperBound(ctx context.Context, eng engine.Engine, wallTime int64) error {
+	ts := hlc.Timestamp{WallTime: wallTime}
+	if err := engine.MVCCPutProto(
+		ctx, eng, nil, keys.StoreHLCUpperBoundKey(), hlc.ZeroTimestamp, nil, &ts); err != nil {
+		return err
+	}
+	return eng.SyncWAL()
+}
+
 // Start the engine, set the GC and read the StoreIdent.
 func (s *Store) Start(ctx context.Context, stopper *stop.Stopper) error {
 	s.stopper = stopper
@@ -1028,6 +1131,14 @@ func (s *Store) Start(ctx context.Context, stopper *stop.Stopper) error {
 	now := s.cfg.Clock.Now()
 	s.startedAt = now.WallTime
 
+	// Move the raft state of the store's ranges into its raft engine before
+	// the ranges are migrated and their replicas are loaded below.
+	if s.raftEngine != nil {
+		if err := s.migrateRaftEngine(ctx); err != nil {
+			return err
+		}
+	}
+
 	// Iterate over all range descriptors, ignoring uncommitted versions
 	// (consistent=false). Uncommitted intents which have been abandoned
 	// due to a split crashing halfway will simply be resolved on the
@@ -1196,6 +1307,9 @@ func (s *Store) Start(ctx context.Context, stopper *stop.Stopper) error {
 			}
 		})
 
+		// Start the checksum scrubber.
+		s.startScrubber()
+
 		// Run metrics computation up front to populate initial statistics.
 		if err = s.ComputeMetrics(-1); err != nil {
 			log.Infof(ctx, "%s: failed initial metrics computation: %s", s, err)
@@ -1342,7 +1456,7 @@ func (s *Store) GossipStore(ctx context.Context) error {
 	// Unique gossip key per store.
 	gossipStoreKey := gossip.MakeStoreKey(storeDesc.StoreID)
 	// Gossip store descriptor.
-	if err := s.cfg.Gossip.AddInfoProto(gossipStoreKey, storeDesc, ttlStoreGossip); err != nil {
+	if err := s.cfg.Gossip.AddInfoProtoWithTTLClass(gossipStoreKey, storeDesc, gossip.TTLEphemeral); err != nil {
 		return err
 	}
 	// Once we have gossiped the store descriptor the first time, other nodes
@@ -1393,7 +1507,7 @@ func (s *Store) GossipDeadReplicas(ctx context.Context) error {
 	// Unique gossip key per store.
 	key := gossip.MakeDeadReplicasKey(s.StoreID())
 	// Gossip dead replicas.
-	return s.cfg.Gossip.AddInfoProto(key, &deadReplicas, ttlStoreGossip)
+	return s.cfg.Gossip.AddInfoProtoWithTTLClass(key, &deadReplicas, gossip.TTLEphemeral)
 }
 
 // Bootstrap writes a new store ident to the underlying engine. To
@@ -1701,6 +1815,8 @@ func splitPostApply(
 	if err != nil {
 		log.Fatalf(ctx, "unable to find RHS replica: %s", err)
 	}
+	// Initializing the RHS moves the raft state written by the split trigger
+	// into the raft engine (if any) before loading it.
 	if err := rightRng.init(&split.RightDesc, r.store.Clock(), 0); err != nil {
 		log.Fatal(ctx, err)
 	}
@@ -2242,6 +2358,7 @@ func (s *Store) Send(
 	// Attach any log tags from the store to the context (which normally
 	// comes from gRPC).
 	ctx = s.AnnotateCtx(ctx)
+	s.metrics.RequestRate.Add(1)
 	for _, union := range ba.Requests {
 		arg := union.GetInner()
 		header := arg.Header()
@@ -2612,6 +2729,12 @@ func (s *Store) HandleSnapshot(header *SnapshotRequest_Header, stream SnapshotRe
 				return sendSnapError(errors.Wrap(err, "invalid snapshot"))
 			}
 
+			if fn := s.cfg.TestingKnobs.BeforeSnapshotApply; fn != nil {
+				if err := fn(*header); err != nil {
+					return sendSnapError(errors.Wrap(err, "snapshot rejected"))
+				}
+			}
+
 			inSnap := IncomingSnapshot{
 				SnapUUID:        snapUUID,
 				RangeDescriptor: header.RangeDescriptor,
@@ -3147,7 +3270,7 @@ func sendSnapshot(
 		return false, err
 	}
 
-	if err := iterateEntries(ctx, snap.EngineSnap, rangeID, firstIndex, endIndex, scanFunc); err != nil {
+	if err := iterateEntries(ctx, snap.RaftEngineSnap, rangeID, firstIndex, endIndex, scanFunc); err != nil {
 		return err
 	}
 	if err := stream.Send(&SnapshotRequest{LogEntries: logEntries, Final: true}); err != nil {
@@ -3860,6 +3983,17 @@ func (s *Store) ComputeStatsForKeySpan(startKey, endKey roachpb.RKey) (enginepb.
 	return output, count
 }
 
+// CompactKeySpan forces a compaction of the store's engine over the span
+// [startKey, endKey). It is intended for operators who need to reclaim space
+// after large deletions or ingestions without waiting for RocksDB to get
+// around to it. The call blocks until the compaction completes.
+func (s *Store) CompactKeySpan(
+	ctx context.Context, startKey, endKey roachpb.RKey, forceBottommost bool,
+) error {
+	log.Infof(ctx, "manual compaction of %s-%s requested", log.Unsafe(startKey), log.Unsafe(endKey))
+	return s.engine.CompactRange(startKey.AsRawKey(), endKey.AsRawKey(), forceBottommost)
+}
+
 // FrozenStatus returns all of the Store's Replicas which are frozen (if the
 // parameter is true) or unfrozen (otherwise). It makes no attempt to prevent
 // new data being rebalanced to the Store, and thus does not guarantee that the
@@ -3895,6 +4029,9 @@ func (s *Store) reserve(ctx context.Context, req reservationRequest) reservation
 // The methods below can be used to control a store's queues. Stopping a queue
 // is only meant to happen in tests.
 
+func (s *Store) setGCQueueActive(active bool) {
+	s.gcQueue.SetDisabled(!active)
+}
 func (s *Store) setRaftLogQueueActive(active bool) {
 	s.raftLogQueue.SetDisabled(!active)
 }
@@ -3910,3 +4047,40 @@ func (s *Store) setSplitQueueActive(active bool) {
 func (s *Store) setScannerActive(active bool) {
 	s.scanner.SetDisabled(!active)
 }
+
+// setQueueActive enables or disables the queue with the given name, which
+// is the name the queue was created with (e.g. "replicate" or "raftlog").
+func (s *Store) setQueueActive(name string, active bool) error {
+	q, err := s.queueByName(name)
+	if err != nil {
+		return err
+	}
+	q.SetDisabled(!active)
+	return nil
+}
+
+// allQueues returns all queues of the store.
+func (s *Store) allQueues() []*baseQueue {
+	queues := []*baseQueue{
+		s.gcQueue.baseQueue,
+		s.splitQueue.baseQueue,
+		s.replicateQueue.baseQueue,
+		s.replicaGCQueue.baseQueue,
+		s.raftLogQueue.baseQueue,
+		s.replicaConsistencyQueue.baseQueue,
+	}
+	if s.tsMaintenanceQueue != nil {
+		queues = append(queues, s.tsMaintenanceQueue.baseQueue)
+	}
+	return queues
+}
+
+// queueByName returns the queue with the given name.
+func (s *Store) queueByName(name string) (*baseQueue, error) {
+	for _, q := range s.allQueues() {
+		if q.name == name {
+			return q, nil
+		}
+	}
+	return nil, errors.Errorf("unknown queue %q", name)
+}
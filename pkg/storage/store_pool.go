@@ -248,6 +248,9 @@ func NewStorePool(
 	g.RegisterCallback(storeRegex, sp.storeGossipUpdate)
 	deadReplicasRegex := gossip.MakePrefixPattern(gossip.KeyDeadReplicasPrefix)
 	g.RegisterCallback(deadReplicasRegex, sp.deadReplicasGossipUpdate)
+	g.RegisterExpirationCallback(deadReplicasRegex, sp.clearDeadReplicas)
+	nodeRegex := gossip.MakePrefixPattern(gossip.KeyNodeIDPrefix)
+	g.RegisterCallback(nodeRegex, sp.nodeGossipUpdate)
 	sp.start(stopper)
 
 	return sp
@@ -272,8 +275,10 @@ func (sp *StorePool) String() string {
 		if detail.dead {
 			_, _ = buf.WriteString("*")
 		}
-		fmt.Fprintf(&buf, ": range-count=%d fraction-used=%.2f",
-			detail.desc.Capacity.RangeCount, detail.desc.Capacity.FractionUsed())
+		if detail.desc != nil {
+			fmt.Fprintf(&buf, ": range-count=%d fraction-used=%.2f",
+				detail.desc.Capacity.RangeCount, detail.desc.Capacity.FractionUsed())
+		}
 		throttled := detail.throttledUntil.Sub(now)
 		if throttled > 0 {
 			fmt.Fprintf(&buf, " [throttled=%.1fs]", throttled.Seconds())
@@ -284,7 +289,11 @@ func (sp *StorePool) String() string {
 }
 
 // storeGossipUpdate is the gossip callback used to keep the StorePool up to date.
-func (sp *StorePool) storeGossipUpdate(_ string, content roachpb.Value) {
+func (sp *StorePool) storeGossipUpdate(key string, content roachpb.Value) {
+	if gossip.IsTombstone(key, content) {
+		sp.removeStore(key)
+		return
+	}
 	var storeDesc roachpb.StoreDescriptor
 	if err := content.GetProto(&storeDesc); err != nil {
 		ctx := sp.AnnotateCtx(context.TODO())
@@ -301,7 +310,11 @@ func (sp *StorePool) storeGossipUpdate(_ string, content roachpb.Value) {
 }
 
 // deadReplicasGossipUpdate is the gossip callback used to keep the StorePool up to date.
-func (sp *StorePool) deadReplicasGossipUpdate(_ string, content roachpb.Value) {
+func (sp *StorePool) deadReplicasGossipUpdate(key string, content roachpb.Value) {
+	if gossip.IsTombstone(key, content) {
+		sp.clearDeadReplicas(key)
+		return
+	}
 	var replicas roachpb.StoreDeadReplicas
 	if err := content.GetProto(&replicas); err != nil {
 		ctx := sp.AnnotateCtx(context.TODO())
@@ -319,6 +332,82 @@ func (sp *StorePool) deadReplicasGossipUpdate(_ string, content roachpb.Value) {
 	detail.deadReplicas = deadReplicas
 }
 
+// nodeGossipUpdate is the gossip callback used to remove the stores of
+// removed nodes from the StorePool, even if their store descriptors were
+// not removed along with the node.
+func (sp *StorePool) nodeGossipUpdate(key string, content roachpb.Value) {
+	if !gossip.IsTombstone(key, content) {
+		return
+	}
+	ctx := sp.AnnotateCtx(context.TODO())
+	nodeID, err := gossip.NodeIDFromKey(key)
+	if err != nil {
+		log.Error(ctx, err)
+		return
+	}
+
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	for storeID, detail := range sp.mu.storeDetails {
+		if detail.desc != nil && detail.desc.Node.NodeID == nodeID {
+			sp.removeStoreLocked(ctx, storeID)
+		}
+	}
+}
+
+// clearDeadReplicas clears the dead replicas of the store whose dead
+// replicas were removed from gossip under key, either by a tombstone or
+// because they expired.
+func (sp *StorePool) clearDeadReplicas(key string) {
+	storeID, err := gossip.StoreIDFromKey(key)
+	if err != nil {
+		ctx := sp.AnnotateCtx(context.TODO())
+		log.Error(ctx, err)
+		return
+	}
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if detail, ok := sp.mu.storeDetails[storeID]; ok {
+		detail.deadReplicas = make(map[roachpb.RangeID][]roachpb.ReplicaDescriptor)
+	}
+}
+
+// removeStore marks the store whose descriptor was removed from gossip
+// under key as removed from the pool.
+func (sp *StorePool) removeStore(key string) {
+	ctx := sp.AnnotateCtx(context.TODO())
+	storeID, err := gossip.StoreIDFromKey(key)
+	if err != nil {
+		log.Error(ctx, err)
+		return
+	}
+
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	sp.removeStoreLocked(ctx, storeID)
+}
+
+// removeStoreLocked marks the specified store as dead and stops checking
+// it for liveness. The store is kept in the pool, rather than deleted, so
+// that it is not recreated as presumed alive by getStoreDetailLocked and
+// the replicas still on it keep being considered dead. The lock must be
+// held in write mode.
+func (sp *StorePool) removeStoreLocked(ctx context.Context, storeID roachpb.StoreID) {
+	detail, ok := sp.mu.storeDetails[storeID]
+	if !ok {
+		detail = newStoreDetail(ctx)
+		sp.mu.storeDetails[storeID] = detail
+	}
+	if detail.index >= 0 {
+		heap.Remove(&sp.mu.queue, detail.index)
+	}
+	if !detail.dead {
+		detail.markDead(sp.clock.Now())
+	}
+	detail.deadReplicas = make(map[roachpb.RangeID][]roachpb.ReplicaDescriptor)
+	log.Infof(ctx, "removed store %d from store pool", storeID)
+}
+
 // start will run continuously and mark stores as offline if they haven't been
 // heard from in longer than timeUntilStoreDead.
 func (sp *StorePool) start(stopper *stop.Stopper) {
@@ -391,6 +480,20 @@ func (sp *StorePool) getStoreDetailLocked(storeID roachpb.StoreID) *storeDetail
 	return detail
 }
 
+// NodeStoreIDs returns the IDs of the stores of the specified node for
+// which a descriptor has been received.
+func (sp *StorePool) NodeStoreIDs(nodeID roachpb.NodeID) []roachpb.StoreID {
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
+	var storeIDs []roachpb.StoreID
+	for storeID, detail := range sp.mu.storeDetails {
+		if detail.desc != nil && detail.desc.Node.NodeID == nodeID {
+			storeIDs = append(storeIDs, storeID)
+		}
+	}
+	return storeIDs
+}
+
 // getStoreDescriptor returns the latest store descriptor for the given
 // storeID.
 func (sp *StorePool) getStoreDescriptor(storeID roachpb.StoreID) (roachpb.StoreDescriptor, bool) {
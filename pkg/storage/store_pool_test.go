@@ -28,7 +28,6 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/rpc"
 	"github.com/cockroachdb/cockroach/pkg/testutils/gossiputil"
-	"github.com/cockroachdb/cockroach/pkg/util"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
@@ -102,10 +101,111 @@ func TestStorePoolGossipUpdate(t *testing.T) {
 	sp.mu.RUnlock()
 }
 
+// TestStorePoolRemoveStore verifies that a store is marked dead and no
+// longer checked for liveness once its descriptor is removed from gossip,
+// and that it stays dead.
+func TestStorePoolRemoveStore(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper, g, _, sp := createTestStorePool(TestTimeUntilStoreDeadOff, false /* deterministic */)
+	defer stopper.Stop()
+	sg := gossiputil.NewStoreGossiper(g)
+	sg.GossipStores(uniqueStore, t)
+
+	if err := g.RemoveStore(2); err != nil {
+		t.Fatal(err)
+	}
+	SucceedsSoon(t, func() error {
+		sp.mu.RLock()
+		defer sp.mu.RUnlock()
+		if detail, ok := sp.mu.storeDetails[2]; !ok || !detail.dead {
+			return errors.New("store 2 is not dead in the pool's store list")
+		}
+		if a := sp.mu.queue.Len(); a != 0 {
+			return errors.Errorf("expected no stores in the queue, found %d", a)
+		}
+		return nil
+	})
+
+	// Looking up the removed store must not bring it back to life.
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if detail := sp.getStoreDetailLocked(2); !detail.dead {
+		t.Errorf("expected store 2 to stay dead")
+	}
+}
+
+// TestStorePoolRemoveNode verifies that the stores of a node are marked
+// dead once the node is removed from gossip, even if their store
+// descriptors are not.
+func TestStorePoolRemoveNode(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper, g, _, sp := createTestStorePool(TestTimeUntilStoreDeadOff, false /* deterministic */)
+	defer stopper.Stop()
+	sg := gossiputil.NewStoreGossiper(g)
+	sg.GossipStores(uniqueStore, t)
+
+	if err := g.RemoveNode(uniqueStore[0].Node.NodeID, nil); err != nil {
+		t.Fatal(err)
+	}
+	SucceedsSoon(t, func() error {
+		sp.mu.RLock()
+		defer sp.mu.RUnlock()
+		if detail, ok := sp.mu.storeDetails[uniqueStore[0].StoreID]; !ok || !detail.dead {
+			return errors.Errorf("store %d is not dead in the pool's store list", uniqueStore[0].StoreID)
+		}
+		return nil
+	})
+}
+
+// TestStorePoolExpireDeadReplicas verifies that a store's dead replicas
+// are cleared once they expire from gossip.
+func TestStorePoolExpireDeadReplicas(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper, g, _, sp := createTestStorePool(TestTimeUntilStoreDeadOff, false /* deterministic */)
+	defer stopper.Stop()
+	sg := gossiputil.NewStoreGossiper(g)
+	sg.GossipStores(uniqueStore, t)
+
+	key := gossip.MakeDeadReplicasKey(2)
+	deadReplicas := &roachpb.StoreDeadReplicas{
+		StoreID: 2,
+		Replicas: []roachpb.ReplicaIdent{{
+			RangeID: 1,
+			Replica: roachpb.ReplicaDescriptor{NodeID: 1, StoreID: 2, ReplicaID: 1},
+		}},
+	}
+	if err := g.AddInfoProto(key, deadReplicas, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	deadReplicaCount := func() int {
+		sp.mu.RLock()
+		defer sp.mu.RUnlock()
+		return len(sp.mu.storeDetails[2].deadReplicas)
+	}
+	SucceedsSoon(t, func() error {
+		if deadReplicaCount() == 0 {
+			return errors.New("dead replicas not yet received")
+		}
+		return nil
+	})
+
+	// Accessing the expired info removes it from gossip.
+	time.Sleep(time.Millisecond)
+	if _, err := g.GetInfo(key); err == nil {
+		t.Fatal("expected dead replicas to have expired")
+	}
+	SucceedsSoon(t, func() error {
+		if n := deadReplicaCount(); n != 0 {
+			return errors.Errorf("expected dead replicas to be cleared, found %d", n)
+		}
+		return nil
+	})
+}
+
 // waitUntilDead will block until the specified store is marked as dead.
 func waitUntilDead(t *testing.T, mc *hlc.ManualClock, sp *StorePool, storeID roachpb.StoreID) {
 	lastTime := timeutil.Now()
-	util.SucceedsSoon(t, func() error {
+	SucceedsSoon(t, func() error {
 		curTime := timeutil.Now()
 		mc.Increment(curTime.UnixNano() - lastTime.UnixNano())
 		lastTime = curTime
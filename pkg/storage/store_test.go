@@ -45,7 +45,6 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/storage/engine/enginepb"
 	"github.com/cockroachdb/cockroach/pkg/storage/storagebase"
 	"github.com/cockroachdb/cockroach/pkg/testutils"
-	"github.com/cockroachdb/cockroach/pkg/util"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
@@ -142,6 +141,17 @@ func (db *testSender) Send(
 // Some fields of ctx are populated by this function.
 func createTestStoreWithoutStart(t testing.TB, cfg *StoreConfig) (*Store, *stop.Stopper) {
 	stopper := stop.NewStopper()
+	eng := engine.NewInMem(roachpb.Attributes{}, 10<<20)
+	stopper.AddCloser(eng)
+	return createTestStoreWithEngineWithoutStart(t, cfg, stopper, eng), stopper
+}
+
+// createTestStoreWithEngineWithoutStart is like createTestStoreWithoutStart,
+// but creates the store on the specified engine, which the stopper is
+// expected to close.
+func createTestStoreWithEngineWithoutStart(
+	t testing.TB, cfg *StoreConfig, stopper *stop.Stopper, eng engine.Engine,
+) *Store {
 	// Setup fake zone config handler.
 	config.TestingSetupZoneConfigHook(stopper)
 
@@ -163,12 +173,10 @@ func createTestStoreWithoutStart(t testing.TB, cfg *StoreConfig) (*Store, *stop.
 		stopper,
 		/* deterministic */ false,
 	)
-	eng := engine.NewInMem(roachpb.Attributes{}, 10<<20)
-	stopper.AddCloser(eng)
 	cfg.Transport = NewDummyRaftTransport()
 	sender := &testSender{}
 	cfg.DB = client.NewDB(sender)
-	store := NewStore(*cfg, eng, &roachpb.NodeDescriptor{NodeID: 1})
+	store := NewStore(*cfg, eng, nil /* raftEng */, &roachpb.NodeDescriptor{NodeID: 1})
 	sender.store = store
 	if err := store.Bootstrap(roachpb.StoreIdent{NodeID: 1, StoreID: 1}); err != nil {
 		t.Fatal(err)
@@ -176,10 +184,12 @@ func createTestStoreWithoutStart(t testing.TB, cfg *StoreConfig) (*Store, *stop.
 	if err := store.BootstrapRange(nil); err != nil {
 		t.Fatal(err)
 	}
-	return store, stopper
+	return store
 }
 
-func createTestStore(t testing.TB) (*Store, *hlc.ManualClock, *stop.Stopper) {
+// testStoreConfigWithManualClock returns the store config used by
+// createTestStore, along with the manual clock driving the config's clock.
+func testStoreConfigWithManualClock() (StoreConfig, *hlc.ManualClock) {
 	manual := hlc.NewManualClock(123)
 	cfg := TestStoreConfig(hlc.NewClock(manual.UnixNano, time.Nanosecond))
 	// Many tests using this test harness (as opposed to higher-level
@@ -192,10 +202,38 @@ func createTestStore(t testing.TB) (*Store, *hlc.ManualClock, *stop.Stopper) {
 	// The scanner affects background operations; we must also disable
 	// the split queue separately to cover event-driven splits.
 	cfg.TestingKnobs.DisableSplitQueue = true
+	return cfg, manual
+}
+
+func createTestStore(t testing.TB) (*Store, *hlc.ManualClock, *stop.Stopper) {
+	cfg, manual := testStoreConfigWithManualClock()
 	store, stopper := createTestStoreWithConfig(t, &cfg)
 	return store, manual, stopper
 }
 
+// createTestStoreOnDisk is like createTestStore, but backs the store by a
+// RocksDB engine in a temporary directory, for tests which depend on the
+// behavior of a real engine, such as compactions. The engine is closed and
+// the directory removed when the returned stopper is stopped.
+func createTestStoreOnDisk(t testing.TB) (*Store, *hlc.ManualClock, *stop.Stopper) {
+	cfg, manual := testStoreConfigWithManualClock()
+	stopper := stop.NewStopper()
+	dir, cleanup := testutils.TempDir(t, 1)
+	eng, err := engine.NewRocksDB(roachpb.Attributes{}, dir, engine.RocksDBCache{},
+		0, engine.DefaultMaxOpenFiles)
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	// Closers run in the order they were added, so the engine is closed
+	// before its directory is removed.
+	stopper.AddCloser(eng)
+	stopper.AddCloser(stop.CloserFn(cleanup))
+	store := createTestStoreWithEngineWithoutStart(t, &cfg, stopper, eng)
+	startTestStore(t, store, stopper)
+	return store, manual, stopper
+}
+
 // createTestStore creates a test store using an in-memory
 // engine. It returns the store, the store clock's manual unix nanos time
 // and a stopper. The caller is responsible for stopping the stopper
@@ -203,6 +241,13 @@ func createTestStore(t testing.TB) (*Store, *hlc.ManualClock, *stop.Stopper) {
 func createTestStoreWithConfig(t testing.TB, cfg *StoreConfig) (*Store, *stop.Stopper) {
 
 	store, stopper := createTestStoreWithoutStart(t, cfg)
+	startTestStore(t, store, stopper)
+	return store, stopper
+}
+
+// startTestStore starts a store created by createTestStoreWithoutStart
+// with an empty system config.
+func startTestStore(t testing.TB, store *Store, stopper *stop.Stopper) {
 	// Put an empty system config into gossip.
 	if err := store.Gossip().AddInfoProto(gossip.KeySystemConfig,
 		&config.SystemConfig{}, 0); err != nil {
@@ -212,10 +257,62 @@ func createTestStoreWithConfig(t testing.TB, cfg *StoreConfig) (*Store, *stop.St
 		t.Fatal(err)
 	}
 	store.WaitForInit()
-	return store, stopper
+}
+
+// TestCreateTestStoreOnDisk verifies that stores created by
+// createTestStoreOnDisk are backed by RocksDB, and retain their data across
+// compactions.
+func TestCreateTestStoreOnDisk(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	store, _, stopper := createTestStoreOnDisk(t)
+	defer stopper.Stop()
+
+	rocksdb, ok := store.Engine().(*engine.RocksDB)
+	if !ok {
+		t.Fatalf("expected a RocksDB engine, got %T", store.Engine())
+	}
+	pArgs := putArgs([]byte("a"), []byte("value"))
+	if _, pErr := client.SendWrapped(context.Background(), store.testSender(), &pArgs); pErr != nil {
+		t.Fatal(pErr)
+	}
+	if err := rocksdb.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	gArgs := getArgs([]byte("a"))
+	reply, pErr := client.SendWrapped(context.Background(), store.testSender(), &gArgs)
+	if pErr != nil {
+		t.Fatal(pErr)
+	}
+	if v := reply.(*roachpb.GetResponse).Value; v == nil {
+		t.Fatal("expected value after compaction")
+	} else if b, err := v.GetBytes(); err != nil || !bytes.Equal(b, []byte("value")) {
+		t.Fatalf("unexpected value after compaction: %q (%v)", b, err)
+	}
 }
 
 // TestStoreInitAndBootstrap verifies store initialization and bootstrap.
+// TestHLCUpperBound verifies that the persisted upper bound on the wall time
+// of the clock can be read back, and reads as zero when missing.
+func TestHLCUpperBound(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	eng := engine.NewInMem(roachpb.Attributes{}, 1<<20)
+	defer eng.Close()
+
+	ctx := context.Background()
+	for _, exp := range []int64{0, 123, 456} {
+		if exp != 0 {
+			if err := WriteHLCUpperBound(ctx, eng, exp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if wallTime, err := ReadHLCUpperBound(ctx, eng); err != nil {
+			t.Fatal(err)
+		} else if wallTime != exp {
+			t.Errorf("expected upper bound %d, got %d", exp, wallTime)
+		}
+	}
+}
+
 func TestStoreInitAndBootstrap(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	// We need a fixed clock to avoid LastUpdateNanos drifting on us.
@@ -225,7 +322,7 @@ func TestStoreInitAndBootstrap(t *testing.T) {
 	eng := engine.NewInMem(roachpb.Attributes{}, 1<<20)
 	stopper.AddCloser(eng)
 	cfg.Transport = NewDummyRaftTransport()
-	store := NewStore(cfg, eng, &roachpb.NodeDescriptor{NodeID: 1})
+	store := NewStore(cfg, eng, nil /* raftEng */, &roachpb.NodeDescriptor{NodeID: 1})
 
 	// Can't start as haven't bootstrapped.
 	if err := store.Start(context.Background(), stopper); err == nil {
@@ -256,7 +353,7 @@ func TestStoreInitAndBootstrap(t *testing.T) {
 	}
 
 	// Now, attempt to initialize a store with a now-bootstrapped range.
-	store = NewStore(cfg, eng, &roachpb.NodeDescriptor{NodeID: 1})
+	store = NewStore(cfg, eng, nil /* raftEng */, &roachpb.NodeDescriptor{NodeID: 1})
 	if err := store.Start(context.Background(), stopper); err != nil {
 		t.Errorf("failure initializing bootstrapped store: %s", err)
 	}
@@ -291,7 +388,7 @@ func TestBootstrapOfNonEmptyStore(t *testing.T) {
 	}
 	cfg := TestStoreConfig(nil)
 	cfg.Transport = NewDummyRaftTransport()
-	store := NewStore(cfg, eng, &roachpb.NodeDescriptor{NodeID: 1})
+	store := NewStore(cfg, eng, nil /* raftEng */, &roachpb.NodeDescriptor{NodeID: 1})
 
 	// Can't init as haven't bootstrapped.
 	switch err := errors.Cause(store.Start(context.Background(), stopper)); err.(type) {
@@ -721,6 +818,52 @@ func TestStoreSend(t *testing.T) {
 	}
 }
 
+// TestStoreResponseFilter verifies that the TestingResponseFilter can
+// replace the response of a command with an error after the command has
+// been executed, and modify responses.
+func TestStoreResponseFilter(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	cfg, _ := testStoreConfigWithManualClock()
+	cfg.TestingKnobs.TestingResponseFilter = func(
+		ba roachpb.BatchRequest, br *roachpb.BatchResponse,
+	) *roachpb.Error {
+		if args, ok := ba.GetArg(roachpb.Put); ok && bytes.Equal(args.Header().Key, roachpb.Key("a")) {
+			return roachpb.NewErrorf("injected")
+		}
+		if args, ok := ba.GetArg(roachpb.Get); ok && bytes.Equal(args.Header().Key, roachpb.Key("b")) {
+			br.Responses[0].GetInner().(*roachpb.GetResponse).Value = nil
+		}
+		return nil
+	}
+	store, stopper := createTestStoreWithConfig(t, &cfg)
+	defer stopper.Stop()
+
+	// The put fails with an ambiguous result: the client sees an error
+	// although the value was written.
+	pArgs := putArgs([]byte("a"), []byte("value"))
+	if _, pErr := client.SendWrapped(context.Background(), store.testSender(), &pArgs); !testutils.IsPError(pErr, "injected") {
+		t.Fatalf("expected injected error, got %v", pErr)
+	}
+	gArgs := getArgs([]byte("a"))
+	if reply, pErr := client.SendWrapped(context.Background(), store.testSender(), &gArgs); pErr != nil {
+		t.Fatal(pErr)
+	} else if reply.(*roachpb.GetResponse).Value == nil {
+		t.Fatal("expected the put to have been executed")
+	}
+
+	// The value read is removed from the response.
+	pArgs = putArgs([]byte("b"), []byte("value"))
+	if _, pErr := client.SendWrapped(context.Background(), store.testSender(), &pArgs); pErr != nil {
+		t.Fatal(pErr)
+	}
+	gArgs = getArgs([]byte("b"))
+	if reply, pErr := client.SendWrapped(context.Background(), store.testSender(), &gArgs); pErr != nil {
+		t.Fatal(pErr)
+	} else if v := reply.(*roachpb.GetResponse).Value; v != nil {
+		t.Fatalf("expected the value to be filtered from the response, got %s", v)
+	}
+}
+
 // TestStoreObservedTimestamp verifies that execution of a transactional
 // command on a Store always returns a timestamp observation, either per the
 // error's or the response's transaction, as well as an originating NodeID.
@@ -1166,7 +1309,7 @@ func TestStoreSetRangesMaxBytes(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	util.SucceedsSoon(t, func() error {
+	SucceedsSoon(t, func() error {
 		for _, test := range testData {
 			if mb := test.repl.GetMaxBytes(); mb != test.expMaxBytes {
 				return errors.Errorf("range max bytes values did not change to %d; got %d", test.expMaxBytes, mb)
@@ -1683,7 +1826,7 @@ func TestStoreReadInconsistent(t *testing.T) {
 		}
 		// However, it will be read eventually, as B's intent can be
 		// resolved asynchronously as txn B is committed.
-		util.SucceedsSoon(t, func() error {
+		SucceedsSoon(t, func() error {
 			if reply, pErr := client.SendWrappedWith(context.Background(), store.testSender(), roachpb.Header{
 				ReadConsistency: roachpb.INCONSISTENT,
 			}, &gArgs); pErr != nil {
@@ -1891,7 +2034,7 @@ func TestStoreScanInconsistentResolvesIntents(t *testing.T) {
 
 	// Scan the range repeatedly until we've verified count.
 	sArgs := scanArgs(keys[0], keys[9].Next())
-	util.SucceedsSoon(t, func() error {
+	SucceedsSoon(t, func() error {
 		if reply, pErr := client.SendWrappedWith(context.Background(), store.testSender(), roachpb.Header{
 			ReadConsistency: roachpb.INCONSISTENT,
 		}, &sArgs); pErr != nil {
@@ -2454,7 +2597,7 @@ func TestStoreRemovePlaceholderOnRaftIgnored(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	util.SucceedsSoon(t, func() error {
+	SucceedsSoon(t, func() error {
 		s.mu.Lock()
 		numPlaceholders := len(s.mu.replicaPlaceholders)
 		s.mu.Unlock()
@@ -2636,3 +2779,147 @@ func TestSendSnapshotThrottling(t *testing.T) {
 		}
 	}
 }
+
+// TestStoreCompactKeySpan verifies that a manual compaction of a key span
+// moves flushed data out of level 0.
+func TestStoreCompactKeySpan(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	store, _, stopper := createTestStore(t)
+	defer stopper.Stop()
+
+	key := roachpb.Key("a")
+	if err := engine.MVCCPut(context.Background(), store.Engine(), nil, key,
+		hlc.ZeroTimestamp, roachpb.MakeValueFromString("value"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Engine().Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CompactKeySpan(context.Background(), roachpb.RKeyMin, roachpb.RKeyMax, true); err != nil {
+		t.Fatal(err)
+	}
+	eng := store.Engine().(interface {
+		GetSSTables() engine.SSTableInfos
+	})
+	for _, table := range eng.GetSSTables() {
+		if table.Level == 0 {
+			t.Fatalf("expected no level 0 sstables after compaction, found %+v", table)
+		}
+	}
+}
+
+// TestStoreScrubReplica verifies that scrubbing a replica verifies the
+// checksums of its data without reporting corruption.
+func TestStoreScrubReplica(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	store, _, stopper := createTestStore(t)
+	defer stopper.Stop()
+
+	key := roachpb.Key("a")
+	if err := engine.MVCCPut(context.Background(), store.Engine(), nil, key,
+		hlc.ZeroTimestamp, roachpb.MakeValueFromString("value"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Engine().Flush(); err != nil {
+		t.Fatal(err)
+	}
+	repl := store.LookupReplica(roachpb.RKey(key), nil)
+	if repl == nil {
+		t.Fatalf("no replica found for key %s", key)
+	}
+	if err := store.scrubReplica(context.Background(), repl); err != nil {
+		t.Fatal(err)
+	}
+	if n := store.metrics.ScrubberBytesVerified.Count(); n == 0 {
+		t.Error("expected the scrubber to verify some data")
+	}
+	if n := store.metrics.ScrubberCorruptions.Count(); n != 0 {
+		t.Errorf("expected no corruptions, found %d", n)
+	}
+}
+
+// TestStoreSetQueueActive verifies that the queues of a store can be
+// disabled by knobs and toggled by name at runtime.
+func TestStoreSetQueueActive(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	cfg, _ := testStoreConfigWithManualClock()
+	cfg.TestingKnobs.DisableGCQueue = true
+	cfg.TestingKnobs.DisableRaftLogQueue = true
+	store, stopper := createTestStoreWithConfig(t, &cfg)
+	defer stopper.Stop()
+
+	for name, disabled := range map[string]bool{
+		"gc":        true,
+		"raftlog":   true,
+		"split":     true,
+		"replicate": false,
+		"replicaGC": false,
+	} {
+		q, err := store.queueByName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if q.Disabled() != disabled {
+			t.Errorf("%s: expected disabled=%t", name, disabled)
+		}
+		if err := store.setQueueActive(name, disabled); err != nil {
+			t.Fatal(err)
+		}
+		if q.Disabled() == disabled {
+			t.Errorf("%s: expected disabled=%t after toggling", name, !disabled)
+		}
+	}
+	if err := store.setQueueActive("unknown", true); !testutils.IsError(err, "unknown queue") {
+		t.Errorf("expected unknown queue error, got %v", err)
+	}
+}
+
+// TestQuiescentTestStoreConfig verifies that a store created with
+// QuiescentTestStoreConfig has no background processing enabled, except for
+// what the test re-enables.
+func TestQuiescentTestStoreConfig(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	manual := hlc.NewManualClock(123)
+	cfg := QuiescentTestStoreConfig(hlc.NewClock(manual.UnixNano, time.Nanosecond))
+	cfg.TestingKnobs.DisableSplitQueue = false
+	store, stopper := createTestStoreWithConfig(t, &cfg)
+	defer stopper.Stop()
+
+	if !store.scanner.GetDisabled() {
+		t.Error("expected scanner to be disabled")
+	}
+	if !store.consistencyScanner.GetDisabled() {
+		t.Error("expected consistency scanner to be disabled")
+	}
+	for _, q := range store.allQueues() {
+		// The consistency queue is only fed by the consistency scanner.
+		if q.name == "split" || q == store.replicaConsistencyQueue.baseQueue {
+			if q.Disabled() {
+				t.Errorf("%s: expected queue to be enabled", q.name)
+			}
+		} else if !q.Disabled() {
+			t.Errorf("%s: expected queue to be disabled", q.name)
+		}
+	}
+}
+
+// TestStoreRandSeed verifies that stores created with the same RandSeed
+// make the same random decisions.
+func TestStoreRandSeed(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	var values [2][]int64
+	for i := range values {
+		cfg, _ := testStoreConfigWithManualClock()
+		cfg.TestingKnobs.RandSeed = 42
+		store, stopper := createTestStoreWithConfig(t, &cfg)
+		store.allocator.randGen.Lock()
+		for j := 0; j < 10; j++ {
+			values[i] = append(values[i], store.allocator.randGen.Int63())
+		}
+		store.allocator.randGen.Unlock()
+		stopper.Stop()
+	}
+	if !reflect.DeepEqual(values[0], values[1]) {
+		t.Fatalf("expected identical random sequences, got %v and %v", values[0], values[1])
+	}
+}
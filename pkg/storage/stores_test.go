@@ -149,7 +149,7 @@ func TestStoresLookupReplica(t *testing.T) {
 		e[i] = engine.NewInMem(roachpb.Attributes{}, 1<<20)
 		stopper.AddCloser(e[i])
 		cfg.Transport = NewDummyRaftTransport()
-		s[i] = NewStore(cfg, e[i], &roachpb.NodeDescriptor{NodeID: 1})
+		s[i] = NewStore(cfg, e[i], nil /* raftEng */, &roachpb.NodeDescriptor{NodeID: 1})
 		s[i].Ident.StoreID = rng.storeID
 
 		d[i] = &roachpb.RangeDescriptor{
@@ -239,7 +239,7 @@ func createStores(count int, t *testing.T) (*hlc.ManualClock, []*Store, *Stores,
 		cfg.Transport = NewDummyRaftTransport()
 		eng := engine.NewInMem(roachpb.Attributes{}, 1<<20)
 		stopper.AddCloser(eng)
-		s := NewStore(cfg, eng, &roachpb.NodeDescriptor{NodeID: 1})
+		s := NewStore(cfg, eng, nil /* raftEng */, &roachpb.NodeDescriptor{NodeID: 1})
 		storeIDAlloc++
 		s.Ident.StoreID = storeIDAlloc
 		stores = append(stores, s)
@@ -32,7 +32,6 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/testutils/serverutils"
 	"github.com/cockroachdb/cockroach/pkg/ts"
 	"github.com/cockroachdb/cockroach/pkg/ts/tspb"
-	"github.com/cockroachdb/cockroach/pkg/util"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
@@ -127,7 +126,7 @@ func TestTimeSeriesMaintenanceQueue(t *testing.T) {
 	}
 
 	// Wait for splits to complete and system config to be available.
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		if a, e := store.ReplicaCount(), len(expectedEndKeys); a != e {
 			return fmt.Errorf("expected %d replicas in store; found %d", a, e)
 		}
@@ -141,7 +140,7 @@ func TestTimeSeriesMaintenanceQueue(t *testing.T) {
 	store.ForceTimeSeriesMaintenanceQueueProcess()
 
 	// Wait for processing to complete.
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		model.Lock()
 		defer model.Unlock()
 		if a, e := model.containsCalled, len(expectedStartKeys); a != e {
@@ -249,7 +248,7 @@ func TestTimeSeriesMaintenanceQueueServer(t *testing.T) {
 	store.ForceTimeSeriesMaintenanceQueueProcess()
 
 	// Verify the older datapoint has been pruned.
-	util.SucceedsSoon(t, func() error {
+	storage.SucceedsSoon(t, func() error {
 		actualDatapoints, err = getDatapoints()
 		if err != nil {
 			return err
@@ -85,7 +85,7 @@ type InitSenderFn func(
 func (ltc *LocalTestCluster) Start(t util.Tester, baseCtx *base.Config, initSender InitSenderFn) {
 	ambient := log.AmbientContext{Tracer: tracing.NewTracer()}
 	nc := &base.NodeIDContainer{}
-	ambient.AddLogTag("n", nc)
+	ambient.AddLogTag("n", log.Safe(nc))
 
 	nodeID := roachpb.NodeID(1)
 	nodeDesc := &roachpb.NodeDescriptor{NodeID: nodeID}
@@ -119,7 +119,7 @@ func (ltc *LocalTestCluster) Start(t util.Tester, baseCtx *base.Config, initSend
 	cfg.Gossip = ltc.Gossip
 	cfg.Transport = transport
 	cfg.MetricsSampleInterval = metric.TestSampleInterval
-	ltc.Store = storage.NewStore(cfg, ltc.Eng, nodeDesc)
+	ltc.Store = storage.NewStore(cfg, ltc.Eng, nil /* raftEng */, nodeDesc)
 	if err := ltc.Store.Bootstrap(roachpb.StoreIdent{NodeID: nodeID, StoreID: 1}); err != nil {
 		t.Fatalf("unable to start local test cluster: %s", err)
 	}
@@ -206,10 +206,10 @@ func (tc *TestCluster) WaitForStores(t testing.TB, g *gossip.Gossip) {
 	storesDone := make(chan error)
 	storesDoneOnce := storesDone
 	unregister := g.RegisterCallback(gossip.MakePrefixPattern(gossip.KeyStorePrefix),
-		func(_ string, content roachpb.Value) {
+		func(key string, content roachpb.Value) {
 			storesMu.Lock()
 			defer storesMu.Unlock()
-			if storesDoneOnce == nil {
+			if storesDoneOnce == nil || gossip.IsTombstone(key, content) {
 				return
 			}
 
@@ -457,7 +457,7 @@ func (tc *TestCluster) FindRangeLeaseHolder(
 // startKey and then verifies that each replica in the range
 // descriptor has been created.
 func (tc *TestCluster) WaitForSplitAndReplication(startKey roachpb.Key) error {
-	return util.RetryForDuration(util.DefaultSucceedsSoonDuration, func() error {
+	return util.RetryForDuration(util.SucceedsSoonDuration(), func() error {
 		desc, err := tc.LookupRange(startKey)
 		if err != nil {
 			return errors.Wrapf(err, "unable to lookup range for %s", startKey)
@@ -71,6 +71,18 @@ type Clock struct {
 		// lastPhysicalTime reports the last measured physical time. This
 		// is used to detect clock jumps.
 		lastPhysicalTime int64
+
+		// forwardJumpThreshold is the largest forward jump between successive
+		// readings of the physical clock which is tolerated. Zero disables the
+		// check. See MonitorForwardClockJumps.
+		forwardJumpThreshold int64
+		// forwardJump is the largest forward jump above the threshold since
+		// the last check.
+		forwardJump int64
+
+		// wallTimeUpperBound is the largest wall time the clock may reach.
+		// Zero disables the check. See SetWallTimeUpperBound.
+		wallTimeUpperBound int64
 	}
 }
 
@@ -133,6 +145,57 @@ func (c *Clock) MaxOffset() time.Duration {
 	return c.maxOffset
 }
 
+// MonitorForwardClockJumps reads the physical clock every tenth of the given
+// threshold until done is closed, and calls onJump whenever two successive
+// readings of the physical clock (including those made by Now and Update)
+// were further apart than the threshold. A forward jump of the system clock,
+// unlike a backward one, is not otherwise noticed, but may violate the
+// assumptions of leases and of the uncertainty interval.
+//
+// MonitorForwardClockJumps blocks until done is closed and is meant to be
+// run by a worker of the caller's stopper. onJump is called from that worker
+// without holding the clock's lock. Note that a stalled process (for example,
+// one which was swapped out) looks like a forward jump as well.
+func (c *Clock) MonitorForwardClockJumps(
+	threshold time.Duration, onJump func(jump time.Duration), done <-chan struct{},
+) {
+	c.mu.Lock()
+	// Take a fresh reading first, as the previous one may be arbitrarily old.
+	c.getPhysicalClockLocked()
+	c.mu.forwardJumpThreshold = int64(threshold)
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.mu.forwardJumpThreshold = 0
+		c.mu.forwardJump = 0
+		c.mu.Unlock()
+	}()
+
+	ticker := time.NewTicker(threshold / 10)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if jump := c.checkForwardJump(); jump > 0 {
+				onJump(jump)
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// checkForwardJump reads the physical clock and returns the largest forward
+// jump above the threshold since the last check, or zero if there was none.
+func (c *Clock) checkForwardJump() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.getPhysicalClockLocked()
+	jump := c.mu.forwardJump
+	c.mu.forwardJump = 0
+	return time.Duration(jump)
+}
+
 // getPhysicalClockLocked returns the current physical clock and checks for
 // time jumps.
 func (c *Clock) getPhysicalClockLocked() int64 {
@@ -140,16 +203,39 @@ func (c *Clock) getPhysicalClockLocked() int64 {
 
 	if c.mu.lastPhysicalTime != 0 {
 		interval := c.mu.lastPhysicalTime - newTime
-		if interval > int64(c.maxOffset/10) {
+		if interval > int64(c.MaxOffset()/10) {
 			c.mu.monotonicityErrorsCount++
 			log.Warningf(context.TODO(), "backward time jump detected (%f seconds)", float64(newTime-c.mu.lastPhysicalTime)/1e9)
 		}
+		if threshold := c.mu.forwardJumpThreshold; threshold > 0 &&
+			-interval > threshold && -interval > c.mu.forwardJump {
+			c.mu.forwardJump = -interval
+		}
 	}
 
 	c.mu.lastPhysicalTime = newTime
 	return newTime
 }
 
+// SetWallTimeUpperBound sets the largest wall time the clock may reach. The
+// process is terminated rather than handing out a timestamp beyond it. This
+// is used to keep the clock monotonic across restarts: the upper bound is
+// persisted before it is set, and a restarted clock is kept above the
+// persisted value.
+func (c *Clock) SetWallTimeUpperBound(upperBound int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.mu.wallTimeUpperBound = upperBound
+}
+
+// enforceWallTimeWithinBoundLocked terminates the process if the wall time
+// of the clock exceeds its upper bound.
+func (c *Clock) enforceWallTimeWithinBoundLocked() {
+	if bound := c.mu.wallTimeUpperBound; bound != 0 && c.mu.timestamp.WallTime > bound {
+		log.Fatalf(context.TODO(), "wall time %d is past the persisted upper bound %d", c.mu.timestamp.WallTime, bound)
+	}
+}
+
 // Now returns a timestamp associated with an event from
 // the local machine that may be sent to other members
 // of the distributed network. This is the counterpart
@@ -166,6 +252,7 @@ func (c *Clock) Now() Timestamp {
 		c.mu.timestamp.WallTime = physicalClock
 		c.mu.timestamp.Logical = 0
 	}
+	c.enforceWallTimeWithinBoundLocked()
 	return c.mu.timestamp
 }
 
@@ -201,6 +288,7 @@ func (c *Clock) Update(rt Timestamp) Timestamp {
 		// as the new wall time and the logical clock is reset.
 		c.mu.timestamp.WallTime = physicalClock
 		c.mu.timestamp.Logical = 0
+		c.enforceWallTimeWithinBoundLocked()
 		return c.mu.timestamp
 	}
 
@@ -209,7 +297,7 @@ func (c *Clock) Update(rt Timestamp) Timestamp {
 	// the logical clock comes into play.
 	if rt.WallTime > c.mu.timestamp.WallTime {
 		offset := time.Duration(rt.WallTime-physicalClock) * time.Nanosecond
-		if c.maxOffset > 0 && offset > c.maxOffset {
+		if maxOffset := c.MaxOffset(); maxOffset > 0 && offset > maxOffset {
 			log.Warningf(context.TODO(), "remote wall time is too far ahead (%s) to be trustworthy - updating anyway", offset)
 		}
 		// The remote clock is ahead of ours, and we update
@@ -228,5 +316,6 @@ func (c *Clock) Update(rt Timestamp) Timestamp {
 		}
 		c.mu.timestamp.Logical++
 	}
+	c.enforceWallTimeWithinBoundLocked()
 	return c.mu.timestamp
 }
@@ -197,3 +197,68 @@ func TestHLCMonotonicityCheck(t *testing.T) {
 		}
 	}
 }
+
+func TestHLCForwardJumpCheck(t *testing.T) {
+	m := NewManualClock(1)
+	c := NewClock(m.UnixNano, time.Nanosecond)
+	c.mu.Lock()
+	c.mu.forwardJumpThreshold = int64(time.Hour)
+	c.mu.Unlock()
+
+	m.Increment(int64(30 * time.Minute))
+	c.Now()
+	if jump := c.checkForwardJump(); jump != 0 {
+		t.Errorf("expected no jump, got %s", jump)
+	}
+
+	// The largest jump since the last check is reported, once.
+	m.Increment(int64(2 * time.Hour))
+	c.Now()
+	m.Increment(int64(3 * time.Hour))
+	c.PhysicalNow()
+	m.Increment(int64(time.Minute))
+	if jump := c.checkForwardJump(); jump != 3*time.Hour {
+		t.Errorf("expected a jump of 3h, got %s", jump)
+	}
+	if jump := c.checkForwardJump(); jump != 0 {
+		t.Errorf("expected no jump, got %s", jump)
+	}
+}
+
+func TestHLCMonitorForwardClockJumps(t *testing.T) {
+	m := NewManualClock(1)
+	c := NewClock(m.UnixNano, time.Nanosecond)
+	jumps := make(chan time.Duration, 1)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		c.MonitorForwardClockJumps(10*time.Millisecond, func(jump time.Duration) {
+			// The clock's lock is not held, so the clock can be used.
+			c.Now()
+			select {
+			case jumps <- jump:
+			default:
+			}
+		}, done)
+	}()
+
+	// Jumps made before the monitor has started are not reported, so keep
+	// jumping until one is.
+	deadline := time.After(10 * time.Second)
+	for reported := false; !reported; {
+		m.Increment(int64(time.Hour))
+		select {
+		case jump := <-jumps:
+			if jump < time.Hour {
+				t.Errorf("expected a jump of at least 1h, got %s", jump)
+			}
+			reported = true
+		case <-time.After(5 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("no jump was reported")
+		}
+	}
+	close(done)
+	<-stopped
+}
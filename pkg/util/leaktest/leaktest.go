@@ -8,17 +8,83 @@
 package leaktest
 
 import (
+	"fmt"
 	"runtime"
 	"sort"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
 	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 )
 
+// allowedGoroutine is a long-lived background goroutine registered with
+// AllowGoroutine.
+type allowedGoroutine struct {
+	pattern string
+	owner   string
+}
+
+var allowed struct {
+	syncutil.Mutex
+	goroutines []allowedGoroutine
+}
+
+func init() {
+	AllowGoroutine("github.com/cockroachdb/cockroach/pkg/util/log.init", "util/log")
+	// Go1.7 added a goroutine to network dialing that doesn't shut down
+	// quickly.
+	AllowGoroutine("created by net.(*netFD).connect", "net")
+}
+
+// AllowGoroutine declares a long-lived background goroutine which is not
+// considered leaked by AfterTest: goroutines whose stack contains pattern
+// are ignored. The owner names the package or component which starts the
+// goroutine; registering a pattern which another owner registered already
+// panics. Packages typically register their goroutines from an init
+// function in their tests.
+func AllowGoroutine(pattern, owner string) {
+	allowed.Lock()
+	defer allowed.Unlock()
+	for _, g := range allowed.goroutines {
+		if g.pattern == pattern {
+			if g.owner != owner {
+				panic(fmt.Sprintf("leaktest: goroutine %q of %s is already registered by %s",
+					pattern, owner, g.owner))
+			}
+			return
+		}
+	}
+	allowed.goroutines = append(allowed.goroutines, allowedGoroutine{pattern: pattern, owner: owner})
+}
+
+// isAllowed returns whether the stack belongs to a goroutine registered
+// with AllowGoroutine.
+func isAllowed(stack string) bool {
+	allowed.Lock()
+	defer allowed.Unlock()
+	for _, g := range allowed.goroutines {
+		if strings.Contains(stack, g.pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// goroutineID returns the ID of the goroutine from its stack dump, which
+// starts with a header of the form "goroutine 12 [running]:".
+func goroutineID(g string) string {
+	fields := strings.Fields(g)
+	if len(fields) < 2 || fields[0] != "goroutine" {
+		return ""
+	}
+	return fields[1]
+}
+
 // interestingGoroutines returns all goroutines we care about for the purpose
-// of leak checking. It excludes testing or runtime ones.
+// of leak checking. It excludes testing or runtime ones, and those
+// registered with AllowGoroutine.
 func interestingGoroutines() (gs []string) {
 	buf := make([]byte, 2<<20)
 	buf = buf[:runtime.Stack(buf, true)]
@@ -32,11 +98,7 @@ func interestingGoroutines() (gs []string) {
 			continue
 		}
 
-		if stack == "" ||
-			strings.Contains(stack, "github.com/cockroachdb/cockroach/pkg/util/log.init") ||
-			// Go1.7 added a goroutine to network dialing that doesn't shut down
-			// quickly.
-			strings.Contains(stack, "created by net.(*netFD).connect") ||
+		if stack == "" || isAllowed(stack) ||
 			// Below are the stacks ignored by the upstream leaktest code.
 			strings.Contains(stack, "testing.Main(") ||
 			strings.Contains(stack, "testing.tRunner(") ||
@@ -57,13 +119,42 @@ func interestingGoroutines() (gs []string) {
 	return
 }
 
+// An Option configures AfterTest.
+type Option func(*options)
+
+type options struct {
+	ignorePreexisting bool
+}
+
+// IgnorePreexisting makes AfterTest ignore all goroutines which were
+// running when it was called. By default, such a goroutine is only ignored
+// if its stack is unchanged at the end of the test, so a pre-existing
+// goroutine which moved on is reported as leaked.
+func IgnorePreexisting() Option {
+	return func(o *options) {
+		o.ignorePreexisting = true
+	}
+}
+
 // AfterTest snapshots the currently-running goroutines and returns a
 // function to be run at the end of tests to see whether any
 // goroutines leaked.
-func AfterTest(t testing.TB) func() {
+func AfterTest(t testing.TB, opts ...Option) func() {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	// The goroutines are identified by their stacks, or by their IDs when
+	// ignoring all pre-existing goroutines.
+	key := func(g string) string {
+		if o.ignorePreexisting {
+			return goroutineID(g)
+		}
+		return g
+	}
 	orig := map[string]bool{}
 	for _, g := range interestingGoroutines() {
-		orig[g] = true
+		orig[key(g)] = true
 	}
 	return func() {
 		if t.Failed() {
@@ -78,7 +169,7 @@ func AfterTest(t testing.TB) func() {
 		for {
 			var leaked []string
 			for _, g := range interestingGoroutines() {
-				if !orig[g] {
+				if !orig[key(g)] {
 					leaked = append(leaked, g)
 				}
 			}
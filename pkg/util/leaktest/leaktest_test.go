@@ -0,0 +1,84 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package leaktest
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func blockedInAllowedWorker(ch chan struct{}) {
+	<-ch
+}
+
+func hasGoroutine(pattern string) bool {
+	for _, g := range interestingGoroutines() {
+		if strings.Contains(g, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAllowGoroutine(t *testing.T) {
+	const pattern = "leaktest.blockedInAllowedWorker"
+	ch := make(chan struct{})
+	defer close(ch)
+	started := make(chan struct{})
+	go func() {
+		close(started)
+		blockedInAllowedWorker(ch)
+	}()
+	<-started
+
+	// The goroutine may not have reached the worker function yet.
+	for i := 0; !hasGoroutine(pattern); i++ {
+		if i == 1000 {
+			t.Fatal("expected the worker to be reported before it is allowed")
+		}
+		runtime.Gosched()
+	}
+	AllowGoroutine(pattern, "leaktest")
+	if hasGoroutine(pattern) {
+		t.Fatal("expected the allowed worker to be ignored")
+	}
+
+	// Registering the pattern again is fine for the same owner only.
+	AllowGoroutine(pattern, "leaktest")
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Error("expected a registration by another owner to panic")
+			}
+		}()
+		AllowGoroutine(pattern, "other")
+	}()
+}
+
+func TestGoroutineID(t *testing.T) {
+	for _, tc := range []struct {
+		g, expected string
+	}{
+		{"goroutine 12 [running]:\nmain.main()", "12"},
+		{"goroutine 7 [chan receive, 2 minutes]:", "7"},
+		{"", ""},
+		{"created by main.main", ""},
+	} {
+		if id := goroutineID(tc.g); id != tc.expected {
+			t.Errorf("%q: expected ID %q, got %q", tc.g, tc.expected, id)
+		}
+	}
+}
@@ -182,7 +182,7 @@ func (l *level) set(val level) {
 
 // String is part of the flag.Value interface.
 func (l *level) String() string {
-	return strconv.FormatInt(int64(*l), 10)
+	return strconv.FormatInt(int64(l.get()), 10)
 }
 
 // Set is part of the flag.Value interface.
@@ -349,6 +349,9 @@ var entryRE = regexp.MustCompile(
 // describing the next entry's length.
 type EntryDecoder struct {
 	scanner *bufio.Scanner
+	// json is set if the input holds entries in the JSON format, which is
+	// determined from its first byte.
+	json, detected bool
 }
 
 // NewEntryDecoder creates a new instance of EntryDecoder.
@@ -368,6 +371,12 @@ func (d *EntryDecoder) Decode(entry *Entry) error {
 			return io.EOF
 		}
 		b := d.scanner.Bytes()
+		if d.json {
+			if len(bytes.TrimSpace(b)) == 0 {
+				continue
+			}
+			return decodeJSONEntry(b, entry)
+		}
 		m := entryRE.FindSubmatch(b)
 		if m == nil {
 			continue
@@ -400,6 +409,14 @@ func (d *EntryDecoder) split(data []byte, atEOF bool) (advance int, token []byte
 	if atEOF && len(data) == 0 {
 		return 0, nil, nil
 	}
+	if !d.detected {
+		d.detected = true
+		d.json = data[0] == '{'
+	}
+	if d.json {
+		// JSON entries are escaped and thus occupy a single line each.
+		return bufio.ScanLines(data, atEOF)
+	}
 	// We assume we're currently positioned at a log entry. We want to find the
 	// next one so we start our search at data[1].
 	i := entryRE.FindIndex(data[1:])
@@ -595,6 +612,12 @@ type loggingT struct {
 	// Level flag. Handled atomically.
 	stderrThreshold Severity // The -alsologtostderr flag.
 
+	// Format flag. Handled atomically.
+	format logFormat // The --log-format flag.
+
+	// Redaction flag. Handled atomically.
+	redact redactFlag // The --redact-logs flag.
+
 	// freeList is a list of byte buffers, maintained under freeListMu.
 	freeList *buffer
 	// freeListMu maintains the free list. It is separate from the main mutex
@@ -611,6 +634,8 @@ type loggingT struct {
 	mu syncutil.Mutex
 	// file holds writer for each of the log types.
 	file [Severity_NONE]flushSyncWriter
+	// sinks holds the sinks registered through AddSink.
+	sinks []*sinkWorker
 	// pcs is used in V to avoid an allocation when computing the caller's PC.
 	pcs [1]uintptr
 	// vmap is a cache of the V Level for each V() call site, identified by PC.
@@ -689,8 +714,9 @@ func (l *loggingT) putBuffer(b *buffer) {
 
 // outputLogEntry marshals a log entry proto into bytes, and writes
 // the data to the log files. If a trace location is set, stack traces
-// are added to the entry before marshaling.
-func (l *loggingT) outputLogEntry(s Severity, file string, line int, msg string) {
+// are added to the entry before marshaling. The message already includes
+// the formatted tags, which are only passed for use by the JSON format.
+func (l *loggingT) outputLogEntry(s Severity, file string, line int, tags []logTag, msg string) {
 	// TODO(tschottdorf): this is a pretty horrible critical section.
 	l.mu.Lock()
 
@@ -721,20 +747,23 @@ func (l *loggingT) outputLogEntry(s Severity, file string, line int, msg string)
 	}
 
 	if s >= l.stderrThreshold.get() {
-		l.outputToStderr(entry, stacks)
+		l.outputToStderr(entry, tags, stacks)
+	}
+	if len(l.sinks) > 0 {
+		l.outputToSinks(entry)
 	}
 	if !l.toStderr && logDir.isSet() {
 		if l.file[s] == nil {
 			if err := l.createFiles(s); err != nil {
 				// Make sure the message appears somewhere.
-				l.outputToStderr(entry, stacks)
+				l.outputToStderr(entry, tags, stacks)
 				l.mu.Unlock()
 				l.exit(err)
 				return
 			}
 		}
 
-		buf := l.processForFile(entry, stacks)
+		buf := l.processForFile(entry, tags, stacks)
 		data := buf.Bytes()
 
 		switch s {
@@ -780,8 +809,8 @@ func (l *loggingT) outputLogEntry(s Severity, file string, line int, msg string)
 	}
 }
 
-func (l *loggingT) outputToStderr(entry Entry, stacks []byte) {
-	buf := l.processForStderr(entry, stacks)
+func (l *loggingT) outputToStderr(entry Entry, tags []logTag, stacks []byte) {
+	buf := l.processForStderr(entry, tags, stacks)
 	if _, err := os.Stderr.Write(buf.Bytes()); err != nil {
 		panic(err)
 	}
@@ -789,13 +818,13 @@ func (l *loggingT) outputToStderr(entry Entry, stacks []byte) {
 }
 
 // processForStderr formats a log entry for output to standard error.
-func (l *loggingT) processForStderr(entry Entry, stacks []byte) *buffer {
-	return formatLogEntry(entry, stacks, l.getTermColorProfile())
+func (l *loggingT) processForStderr(entry Entry, tags []logTag, stacks []byte) *buffer {
+	return l.formatEntry(entry, tags, stacks, l.getTermColorProfile())
 }
 
 // processForFile formats a log entry for output to a file.
-func (l *loggingT) processForFile(entry Entry, stacks []byte) *buffer {
-	return formatLogEntry(entry, stacks, nil)
+func (l *loggingT) processForFile(entry Entry, tags []logTag, stacks []byte) *buffer {
+	return l.formatEntry(entry, tags, stacks, nil)
 }
 
 // checkForColorTerm attempts to verify that stderr is a character
@@ -935,14 +964,14 @@ func (sb *syncBuffer) rotateFile(now time.Time) error {
 		fmt.Sprintf("[config] arguments: %s\n", os.Args),
 		fmt.Sprintf("line format: [IWEF]yymmdd hh:mm:ss.uuuuuu goid file:line msg\n"),
 	} {
-		buf := formatLogEntry(Entry{
+		buf := logging.formatEntry(Entry{
 			Severity:  sb.sev,
 			Time:      now.UnixNano(),
 			Goroutine: goid.Get(),
 			File:      f,
 			Line:      int64(l),
 			Message:   msg,
-		}, nil, nil)
+		}, nil, nil, nil)
 		var n int
 		n, err = sb.file.Write(buf.Bytes())
 		sb.nbytes += uint64(n)
@@ -1079,7 +1108,7 @@ func (lb logBridge) Write(b []byte) (n int, err error) {
 			line = 1
 		}
 	}
-	logging.outputLogEntry(Severity(lb), file, line, text)
+	logging.outputLogEntry(Severity(lb), file, line, nil, text)
 	return len(b), nil
 }
 
@@ -18,6 +18,7 @@ package log
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	stdLog "log"
@@ -217,6 +218,68 @@ func TestEntryDecoder(t *testing.T) {
 	}
 }
 
+// Test that entries are written as JSON objects which can be decoded.
+func TestJSONFormat(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	logging.format.set(formatJSON)
+	defer logging.format.set(formatText)
+
+	ctx := WithLogTagInt(context.Background(), "n", 1)
+	ctx = WithLogTag(ctx, "client", nil)
+	Infof(ctx, "hello %q", "world")
+
+	var je jsonEntry
+	if err := json.Unmarshal([]byte(contents(Severity_INFO)), &je); err != nil {
+		t.Fatal(err)
+	}
+	if je.Severity != "INFO" {
+		t.Errorf("expected severity INFO, got %s", je.Severity)
+	}
+	if !strings.HasSuffix(je.File, "clog_test.go") || je.Line == 0 {
+		t.Errorf("unexpected location %s:%d", je.File, je.Line)
+	}
+	if exp := map[string]string{"n": "1", "client": ""}; !reflect.DeepEqual(je.Tags, exp) {
+		t.Errorf("expected tags %v, got %v", exp, je.Tags)
+	}
+	const expMsg = `[n1,client] hello "world"`
+	if je.Message != expMsg {
+		t.Errorf("expected message %q, got %q", expMsg, je.Message)
+	}
+
+	// The JSON entries decode to the same entries as the text format.
+	Warning(context.Background(), "second")
+	decoder := NewEntryDecoder(strings.NewReader(contents(Severity_INFO)))
+	var entries []Entry
+	for {
+		var entry Entry
+		if err := decoder.Decode(&entry); err != nil {
+			if err == io.EOF {
+				break
+			}
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %+v", entries)
+	}
+	if e := entries[0]; e.Severity != Severity_INFO || e.Message != expMsg || e.Goroutine == 0 {
+		t.Errorf("unexpected first entry %+v", e)
+	}
+	if e := entries[1]; e.Severity != Severity_WARNING || e.Message != "second" {
+		t.Errorf("unexpected second entry %+v", e)
+	}
+
+	var f logFormat
+	if err := f.Set("xml"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+	if err := f.Set("json"); err != nil || f.get() != formatJSON {
+		t.Errorf("unexpected format %s (err: %v)", f.String(), err)
+	}
+}
+
 // Test that an Error log goes to Warning and Info.
 // Even in the Info log, the source character will be E, so the data should
 // all be identical.
@@ -301,6 +364,62 @@ func TestVmoduleOn(t *testing.T) {
 	}
 }
 
+// Test that the vmodule and verbosity can be changed while V is in use.
+func TestSetVModuleAndVerbosity(t *testing.T) {
+	setFlags()
+	defer func() { _ = SetVModule("") }()
+	defer SetVerbosity(GetVerbosity())
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				_ = V(2)
+			}
+		}
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	for i := 0; i < 10; i++ {
+		if err := SetVModule("clog_test=2"); err != nil {
+			t.Fatal(err)
+		}
+		if !V(2) || V(3) {
+			t.Fatalf("%d: vmodule clog_test=2 not in effect", i)
+		}
+		if a, e := GetVModule(), "clog_test=2"; a != e {
+			t.Fatalf("%d: expected vmodule %q, got %q", i, e, a)
+		}
+		if err := SetVModule(""); err != nil {
+			t.Fatal(err)
+		}
+		if V(1) {
+			t.Fatalf("%d: vmodule not disabled", i)
+		}
+
+		SetVerbosity(3)
+		if !V(3) || GetVerbosity() != 3 {
+			t.Fatalf("%d: verbosity 3 not in effect", i)
+		}
+		SetVerbosity(0)
+		if V(1) {
+			t.Fatalf("%d: verbosity not reset", i)
+		}
+	}
+
+	if err := SetVModule("clog_test"); err == nil {
+		t.Error("expected a syntax error")
+	}
+}
+
 // Test that a vmodule of another file does not enable a log in this file.
 func TestVmoduleOff(t *testing.T) {
 	setFlags()
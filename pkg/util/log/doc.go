@@ -40,6 +40,9 @@
 // Log output is buffered and written periodically using Flush. Programs
 // should call Flush before exiting to guarantee all log output is written.
 //
+// Entries can additionally be teed to syslog or to a network collector by
+// registering a Sink with AddSink; see NewSyslogSink and NewNetworkSink.
+//
 // By default, all log statements write to files in a temporary directory.
 // This package provides several flags that modify this behavior.
 // These are provided via the pflags library; see InitFlags.
@@ -51,6 +54,16 @@
 //	--log-dir=""
 //		Log files will be written to this directory instead of the
 //		default temporary directory.
+//	--redact-logs=false
+//		Values which may contain user data, such as keys and values, are
+//		replaced in log messages and tags unless they are marked with Safe.
+//		This includes strings passed to log calls without a format. Values
+//		marked with Unsafe are also replaced when they are formatted into
+//		strings which are logged later.
+//	--log-format=text
+//		The format of log entries. With "json", each entry is written as
+//		a single-line JSON object holding the timestamp, severity, file,
+//		line, context tags and message of the entry.
 //
 //	Other flags provide aids to debugging.
 //
@@ -30,4 +30,8 @@ func init() {
 	// which we can't pass to logflags without creating an import cycle.
 	flag.Var(&logging.stderrThreshold,
 		logflags.AlsoLogToStderrName, "logs at or above this threshold go to stderr")
+	flag.Var(&logging.format,
+		logflags.LogFormatName, "format of log entries: text or json")
+	flag.Var(&logging.redact,
+		logflags.RedactLogsName, "redact values which may contain user data from log messages")
 }
@@ -0,0 +1,156 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package log
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// logFormat is the format of log entries written to standard error and to
+// log files; it is the type of the --log-format flag.
+type logFormat int32
+
+const (
+	// formatText is the default format, a header followed by the message
+	// (see formatHeader).
+	formatText logFormat = iota
+	// formatJSON emits one JSON object per entry (see jsonEntry).
+	formatJSON
+)
+
+var logFormatNames = [...]string{
+	formatText: "text",
+	formatJSON: "json",
+}
+
+var _ flag.Value = new(logFormat)
+
+func (f *logFormat) get() logFormat {
+	return logFormat(atomic.LoadInt32((*int32)(f)))
+}
+
+func (f *logFormat) set(val logFormat) {
+	atomic.StoreInt32((*int32)(f), int32(val))
+}
+
+// String implements the flag.Value interface.
+func (f *logFormat) String() string {
+	return logFormatNames[f.get()]
+}
+
+// Set implements the flag.Value interface.
+func (f *logFormat) Set(value string) error {
+	for i, name := range logFormatNames {
+		if name == value {
+			f.set(logFormat(i))
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown log format %q: must be text or json", value)
+}
+
+// Type implements the flag.Value interface.
+func (f *logFormat) Type() string {
+	return "string"
+}
+
+// jsonEntry is the representation of a log entry in the JSON format. The
+// message includes the tags of the entry, like in the text format, so that
+// entries decoded from either format are identical; the tags are also
+// emitted separately to allow filtering on them.
+type jsonEntry struct {
+	Time      string            `json:"time"`
+	Severity  string            `json:"severity"`
+	Goroutine int64             `json:"goroutine,omitempty"`
+	File      string            `json:"file"`
+	Line      int64             `json:"line"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Message   string            `json:"message"`
+	Stacks    string            `json:"stacks,omitempty"`
+}
+
+// formatEntry formats a log entry in the configured format. Colors are only
+// used by the text format.
+func (l *loggingT) formatEntry(
+	entry Entry, tags []logTag, stacks []byte, colors *colorProfile,
+) *buffer {
+	if l.format.get() == formatJSON {
+		return formatLogEntryJSON(entry, tags, stacks)
+	}
+	return formatLogEntry(entry, stacks, colors)
+}
+
+// formatLogEntryJSON formats a log entry as a single line holding a JSON
+// object. Tags without a value are emitted with an empty value.
+func formatLogEntryJSON(entry Entry, tags []logTag, stacks []byte) *buffer {
+	je := jsonEntry{
+		Time:      time.Unix(0, entry.Time).UTC().Format(time.RFC3339Nano),
+		Severity:  entry.Severity.String(),
+		Goroutine: entry.Goroutine,
+		File:      entry.File,
+		Line:      entry.Line,
+		Message:   strings.TrimSuffix(entry.Message, "\n"),
+		Stacks:    string(stacks),
+	}
+	if len(tags) > 0 {
+		je.Tags = make(map[string]string, len(tags))
+		for _, t := range tags {
+			var value string
+			if v := t.Value(); v != nil {
+				value = formatTagValue(v)
+			}
+			je.Tags[t.Key()] = value
+		}
+	}
+	buf := logging.getBuffer()
+	// Encode terminates the object with a newline.
+	if err := json.NewEncoder(buf).Encode(&je); err != nil {
+		// Only strings are encoded, so this should not happen; make sure the
+		// entry is not lost.
+		logging.putBuffer(buf)
+		return formatLogEntry(entry, stacks, nil)
+	}
+	return buf
+}
+
+// decodeJSONEntry decodes a log entry formatted by formatLogEntryJSON.
+func decodeJSONEntry(b []byte, entry *Entry) error {
+	var je jsonEntry
+	if err := json.Unmarshal(b, &je); err != nil {
+		return err
+	}
+	t, err := time.Parse(time.RFC3339Nano, je.Time)
+	if err != nil {
+		return err
+	}
+	s, ok := SeverityByName(je.Severity)
+	if !ok {
+		return fmt.Errorf("unknown severity %q", je.Severity)
+	}
+	*entry = Entry{
+		Severity:  s,
+		Time:      t.UnixNano(),
+		Goroutine: je.Goroutine,
+		File:      je.File,
+		Line:      je.Line,
+		Message:   je.Message,
+	}
+	return nil
+}
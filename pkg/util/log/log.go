@@ -196,3 +196,28 @@ func FatalfDepth(ctx context.Context, depth int, format string, args ...interfac
 func V(level level) bool {
 	return VDepth(level, 1)
 }
+
+// SetVModule changes the --vmodule setting, which uses the syntax of the flag
+// (e.g. "raft=3,storage*=2"); an empty string disables vmodule logging. It is
+// safe for concurrent use, and subsequent V calls observe the new setting.
+func SetVModule(value string) error {
+	return logging.vmodule.Set(value)
+}
+
+// GetVModule returns the current --vmodule setting.
+func GetVModule() string {
+	return logging.vmodule.String()
+}
+
+// SetVerbosity changes the --verbosity setting. It is safe for concurrent
+// use, and subsequent V calls observe the new setting.
+func SetVerbosity(v int) {
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	logging.setVState(level(v), logging.vmodule.filter, false)
+}
+
+// GetVerbosity returns the current --verbosity setting.
+func GetVerbosity() int {
+	return int(logging.verbosity.get())
+}
@@ -0,0 +1,182 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+)
+
+// redactedMarker replaces redacted values in log messages.
+const redactedMarker = "‹redacted›"
+
+// redactFlag is the type of the --redact-logs flag. It is handled
+// atomically.
+type redactFlag int32
+
+var _ flag.Value = new(redactFlag)
+
+func (r *redactFlag) get() bool {
+	return atomic.LoadInt32((*int32)(r)) != 0
+}
+
+func (r *redactFlag) set(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32((*int32)(r), v)
+}
+
+// IsBoolFlag implements the boolFlag interface of the flag package.
+func (r *redactFlag) IsBoolFlag() bool {
+	return true
+}
+
+// String implements the flag.Value interface.
+func (r *redactFlag) String() string {
+	return strconv.FormatBool(r.get())
+}
+
+// Set implements the flag.Value interface.
+func (r *redactFlag) Set(value string) error {
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	r.set(enabled)
+	return nil
+}
+
+// Type implements the flag.Value interface.
+func (r *redactFlag) Type() string {
+	return "bool"
+}
+
+// SetRedactLogs changes the --redact-logs setting. While enabled, values
+// which may contain user data are replaced in log messages; see Safe and
+// Unsafe.
+func SetRedactLogs(enabled bool) {
+	logging.redact.set(enabled)
+}
+
+// RedactLogs returns whether the --redact-logs setting is enabled.
+func RedactLogs() bool {
+	return logging.redact.get()
+}
+
+// SafeValue is a value marked by Safe.
+type SafeValue struct {
+	v interface{}
+}
+
+// Safe marks a value as free of user data, so that it is not redacted from
+// log messages. Numbers, booleans and durations are safe without marking.
+func Safe(v interface{}) SafeValue {
+	return SafeValue{v: v}
+}
+
+// Format implements the fmt.Formatter interface.
+func (s SafeValue) Format(f fmt.State, verb rune) {
+	fmt.Fprintf(f, formatDirective(f, verb), s.v)
+}
+
+// UnsafeValue is a value marked by Unsafe.
+type UnsafeValue struct {
+	v interface{}
+}
+
+// Unsafe marks a value as containing user data, such as keys and values,
+// which is redacted when --redact-logs is enabled. Unlike unmarked values,
+// which are only redacted when they are the arguments of a log call or the
+// values of log tags, unsafe values are also redacted when they are
+// formatted into a string (such as an error message) which is logged later
+// on.
+func Unsafe(v interface{}) UnsafeValue {
+	return UnsafeValue{v: v}
+}
+
+// Format implements the fmt.Formatter interface.
+func (u UnsafeValue) Format(f fmt.State, verb rune) {
+	if logging.redact.get() {
+		_, _ = f.Write([]byte(redactedMarker))
+		return
+	}
+	fmt.Fprintf(f, formatDirective(f, verb), u.v)
+}
+
+// formatDirective reconstructs the formatting directive with which a
+// fmt.Formatter was invoked.
+func formatDirective(f fmt.State, verb rune) string {
+	var buf bytes.Buffer
+	buf.WriteByte('%')
+	for _, c := range "+-# 0" {
+		if f.Flag(int(c)) {
+			buf.WriteRune(c)
+		}
+	}
+	if width, ok := f.Width(); ok {
+		buf.WriteString(strconv.Itoa(width))
+	}
+	if prec, ok := f.Precision(); ok {
+		buf.WriteByte('.')
+		buf.WriteString(strconv.Itoa(prec))
+	}
+	buf.WriteRune(verb)
+	return buf.String()
+}
+
+// redactArgs returns the arguments of a log call with the values which may
+// contain user data marked as unsafe; see redactValue. This also applies to
+// plain strings passed to log calls without a format string, which have to
+// be marked Safe to be kept.
+func redactArgs(args []interface{}) []interface{} {
+	redacted := make([]interface{}, len(args))
+	for i, arg := range args {
+		redacted[i] = redactValue(arg)
+	}
+	return redacted
+}
+
+// redactValue returns v marked as unsafe if it may contain user data. Only
+// Safe values and values of numeric or boolean kinds (such as range IDs and
+// durations) are kept.
+func redactValue(v interface{}) interface{} {
+	switch v.(type) {
+	case SafeValue, UnsafeValue, nil:
+		return v
+	}
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Uintptr, reflect.Float32, reflect.Float64:
+		return v
+	}
+	return Unsafe(v)
+}
+
+// formatTagValue formats the value of a log tag, redacting it like the
+// arguments of log calls if --redact-logs is enabled.
+func formatTagValue(v interface{}) string {
+	if logging.redact.get() {
+		v = redactValue(v)
+	}
+	return fmt.Sprint(v)
+}
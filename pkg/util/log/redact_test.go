@@ -0,0 +1,97 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package log
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestRedact(t *testing.T) {
+	defer SetRedactLogs(RedactLogs())
+
+	type rangeID int64
+	testCases := []struct {
+		format string
+		args   []interface{}
+		exp    string
+		expRed string
+	}{
+		{"%s", []interface{}{"user"}, "user", redactedMarker},
+		{"%q", []interface{}{[]byte("user")}, `"user"`, redactedMarker},
+		{"%s %s", []interface{}{Safe("safe"), Unsafe("user")}, "safe user", "safe " + redactedMarker},
+		{"%d %s %t", []interface{}{rangeID(5), time.Second, true}, "5 1s true", "5 1s true"},
+		{"%-5s|%x", []interface{}{Unsafe("a"), Safe("b")}, "a    |62", redactedMarker + "|62"},
+		{"%v", []interface{}{fmt.Errorf("error at %s", Unsafe("key"))}, "error at key", redactedMarker},
+		// Without a format string, only safe strings are kept.
+		{"", []interface{}{Safe("error: "), errors.New("user")}, "error: user", "error: " + redactedMarker},
+		{"", []interface{}{"user"}, "user", redactedMarker},
+		{"", []interface{}{"n", nil}, "n<nil>", "n<nil>"},
+	}
+	for i, tc := range testCases {
+		for _, redact := range []bool{false, true} {
+			SetRedactLogs(redact)
+			exp := tc.exp
+			if redact {
+				exp = tc.expRed
+			}
+			if msg := makeMessage(context.Background(), tc.format, tc.args); msg != exp {
+				t.Errorf("%d: redact=%t: expected %q, got %q", i, redact, exp, msg)
+			}
+		}
+	}
+
+	// Tag values are redacted like arguments, both in the message and in the
+	// tags of JSON entries (which network sinks receive as well).
+	ctx := WithLogTagInt(context.Background(), "n", 1)
+	ctx = WithLogTag(ctx, "f", Safe("abc"))
+	ctx = WithLogTagStr(ctx, "user", "root")
+	ctx = WithLogTag(ctx, "key", []byte("a"))
+	ctx = WithLogTag(ctx, "hb", nil)
+	for _, redact := range []bool{false, true} {
+		SetRedactLogs(redact)
+		expTags := map[string]string{"n": "1", "f": "abc", "user": "root", "key": "[97]", "hb": ""}
+		if redact {
+			expTags["user"], expTags["key"] = redactedMarker, redactedMarker
+		}
+		expMsg := fmt.Sprintf("[n1,f=abc,user=%s,key=%s,hb] msg", expTags["user"], expTags["key"])
+		if msg := makeMessage(ctx, "%s", []interface{}{Safe("msg")}); msg != expMsg {
+			t.Errorf("redact=%t: expected %q, got %q", redact, expMsg, msg)
+		}
+		buf := formatLogEntryJSON(Entry{Message: expMsg}, contextLogTags(ctx), nil)
+		var je jsonEntry
+		err := json.Unmarshal(buf.Bytes(), &je)
+		logging.putBuffer(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(je.Tags, expTags) {
+			t.Errorf("redact=%t: expected tags %v, got %v", redact, expTags, je.Tags)
+		}
+	}
+
+	// Unsafe values are redacted wherever they are formatted.
+	SetRedactLogs(true)
+	err := fmt.Errorf("error at %s", Unsafe("key"))
+	if a, e := err.Error(), "error at "+redactedMarker; a != e {
+		t.Errorf("expected %q, got %q", e, a)
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/util/caller"
+	"github.com/petermattis/goid"
+)
+
+// DefaultSinkBufferSize is the number of entries buffered for a sink which
+// does not keep up with the rate of logging.
+const DefaultSinkBufferSize = 1024
+
+// A Sink receives copies of log entries in addition to the log files and
+// standard error, for example to forward them to syslog or to a network
+// collector.
+type Sink interface {
+	// Output writes a single entry. It is called from a goroutine dedicated
+	// to the sink, and thus may block without holding up logging.
+	Output(entry Entry) error
+}
+
+// sinkWorker feeds the entries of a registered sink through a buffer. When
+// the buffer is full, entries are dropped rather than blocking the logging
+// caller; the sink is told about the number of dropped entries once it
+// catches up.
+type sinkWorker struct {
+	sink      Sink
+	threshold Severity
+	entries   chan Entry
+	done      chan struct{}
+	dropped   int64 // accessed atomically
+}
+
+// AddSink registers a sink which receives the entries at or above the given
+// severity, buffering up to bufSize entries. Delivery is best effort: entries
+// are dropped while the buffer is full and may be lost when the process
+// exits. The returned function unregisters the sink after the buffered
+// entries have been written.
+func AddSink(sink Sink, threshold Severity, bufSize int) (remove func()) {
+	w := &sinkWorker{
+		sink:      sink,
+		threshold: threshold,
+		entries:   make(chan Entry, bufSize),
+		done:      make(chan struct{}),
+	}
+	go w.run()
+
+	logging.mu.Lock()
+	logging.sinks = append(logging.sinks, w)
+	logging.mu.Unlock()
+
+	return func() {
+		logging.mu.Lock()
+		for i, s := range logging.sinks {
+			if s == w {
+				logging.sinks = append(logging.sinks[:i:i], logging.sinks[i+1:]...)
+				close(w.entries)
+				break
+			}
+		}
+		logging.mu.Unlock()
+		<-w.done
+	}
+}
+
+// outputToSinks hands the entry to the sinks whose threshold it meets.
+// l.mu is held.
+func (l *loggingT) outputToSinks(entry Entry) {
+	for _, w := range l.sinks {
+		if entry.Severity < w.threshold {
+			continue
+		}
+		select {
+		case w.entries <- entry:
+		default:
+			atomic.AddInt64(&w.dropped, 1)
+		}
+	}
+}
+
+func (w *sinkWorker) run() {
+	defer close(w.done)
+	for entry := range w.entries {
+		w.output(entry)
+		if dropped := atomic.SwapInt64(&w.dropped, 0); dropped > 0 {
+			file, line, _ := caller.Lookup(0)
+			w.output(Entry{
+				Severity:  Severity_WARNING,
+				Time:      time.Now().UnixNano(),
+				Goroutine: goid.Get(),
+				File:      file,
+				Line:      int64(line),
+				Message:   fmt.Sprintf("%d log entries were dropped by a slow sink", dropped),
+			})
+		}
+	}
+}
+
+func (w *sinkWorker) output(entry Entry) {
+	if err := w.sink.Output(entry); err != nil {
+		// Logging the error would feed it back into the failing sink.
+		fmt.Fprintf(os.Stderr, "log: unable to write to sink %T: %s\n", w.sink, err)
+	}
+}
+
+// networkSink writes entries to a network collector (such as fluentd) as
+// JSON objects, one per line.
+type networkSink struct {
+	network, addr string
+	conn          net.Conn
+}
+
+// networkSinkTimeout bounds the time spent connecting to a network
+// collector and writing a single entry to it.
+const networkSinkTimeout = 10 * time.Second
+
+// NewNetworkSink returns a Sink which writes entries in the JSON format (see
+// --log-format) to the given address. The connection is established lazily
+// and reestablished after errors.
+func NewNetworkSink(network, addr string) Sink {
+	return &networkSink{network: network, addr: addr}
+}
+
+// Output implements the Sink interface.
+func (s *networkSink) Output(entry Entry) error {
+	if s.conn == nil {
+		conn, err := net.DialTimeout(s.network, s.addr, networkSinkTimeout)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	buf := formatLogEntryJSON(entry, nil, nil)
+	defer logging.putBuffer(buf)
+	if err := s.conn.SetWriteDeadline(time.Now().Add(networkSinkTimeout)); err != nil {
+		return s.closeOnError(err)
+	}
+	if _, err := s.conn.Write(buf.Bytes()); err != nil {
+		return s.closeOnError(err)
+	}
+	return nil
+}
+
+func (s *networkSink) closeOnError(err error) error {
+	_ = s.conn.Close()
+	s.conn = nil
+	return err
+}
@@ -0,0 +1,54 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build !windows,!plan9
+
+package log
+
+import (
+	"fmt"
+	"log/syslog"
+)
+
+// syslogSink writes entries to syslog, mapping their severities to the
+// corresponding syslog priorities.
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+// NewSyslogSink returns a Sink which writes entries to the syslog daemon at
+// the given address, using the daemon facility and the given tag. If network
+// is empty, the local syslog daemon is used.
+func NewSyslogSink(network, raddr, tag string) (Sink, error) {
+	w, err := syslog.Dial(network, raddr, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, err
+	}
+	return syslogSink{w: w}, nil
+}
+
+// Output implements the Sink interface.
+func (s syslogSink) Output(entry Entry) error {
+	msg := fmt.Sprintf("%s:%d %s", entry.File, entry.Line, entry.Message)
+	switch entry.Severity {
+	case Severity_FATAL:
+		return s.w.Crit(msg)
+	case Severity_ERROR:
+		return s.w.Err(msg)
+	case Severity_WARNING:
+		return s.w.Warning(msg)
+	default:
+		return s.w.Info(msg)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package log
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// chanSink passes the entries it receives to a channel, optionally waiting
+// for each entry to be released first.
+type chanSink struct {
+	entries chan Entry
+	release chan struct{}
+}
+
+func (s chanSink) Output(entry Entry) error {
+	if s.release != nil {
+		<-s.release
+	}
+	s.entries <- entry
+	return nil
+}
+
+// Test that sinks receive the entries at or above their threshold.
+func TestSinkThreshold(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+
+	sink := chanSink{entries: make(chan Entry, 10)}
+	remove := AddSink(sink, Severity_WARNING, DefaultSinkBufferSize)
+	Info(context.Background(), "info")
+	Warning(context.Background(), "warning")
+	Error(context.Background(), "error")
+	remove()
+	Error(context.Background(), "removed")
+	close(sink.entries)
+
+	var msgs []string
+	for entry := range sink.entries {
+		msgs = append(msgs, entry.Message)
+	}
+	if a, e := strings.Join(msgs, ","), "warning,error"; a != e {
+		t.Errorf("expected entries %s, got %s", e, a)
+	}
+}
+
+// Test that a slow sink does not block logging and is told about dropped
+// entries.
+func TestSinkDropped(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+
+	sink := chanSink{entries: make(chan Entry, 10), release: make(chan struct{})}
+	remove := AddSink(sink, Severity_INFO, 1)
+	// The first entry is picked up by the sink and blocks it, the second one
+	// is buffered and the remaining ones are dropped.
+	Info(context.Background(), "first")
+	for {
+		// Wait for the sink to pick up the first entry.
+		if len(logging.sinks[0].entries) == 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < 4; i++ {
+		Info(context.Background(), "more")
+	}
+	close(sink.release)
+	remove()
+	close(sink.entries)
+
+	var msgs []string
+	for entry := range sink.entries {
+		msgs = append(msgs, entry.Message)
+	}
+	exp := []string{"first", "3 log entries were dropped by a slow sink", "more"}
+	if a, e := strings.Join(msgs, ","), strings.Join(exp, ","); a != e {
+		t.Errorf("expected entries %s, got %s", e, a)
+	}
+}
+
+// Test that the network sink writes JSON entries.
+func TestNetworkSink(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	remove := AddSink(NewNetworkSink("tcp", ln.Addr().String()), Severity_INFO, DefaultSinkBufferSize)
+	defer remove()
+	Warning(WithLogTagInt(context.Background(), "n", 1), "to the network")
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := conn.SetReadDeadline(time.Now().Add(10 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entry Entry
+	if err := decodeJSONEntry(line, &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Severity != Severity_WARNING || entry.Message != "[n1] to the network" {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+}
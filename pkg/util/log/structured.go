@@ -44,7 +44,9 @@ func (b *msgBuf) writeKey(key string, hasValue bool) {
 
 func (b *msgBuf) EmitString(key, value string) {
 	b.writeKey(key, value != "")
-	b.WriteString(value)
+	if value != "" {
+		b.WriteString(formatTagValue(value))
+	}
 }
 
 func (b *msgBuf) EmitBool(key string, value bool) {
@@ -91,7 +93,7 @@ func (b *msgBuf) EmitObject(key string, value interface{}) {
 	hasValue := (value != nil)
 	b.writeKey(key, hasValue)
 	if hasValue {
-		fmt.Fprint(b, value)
+		b.WriteString(formatTagValue(value))
 	}
 }
 
@@ -102,7 +104,12 @@ func (b *msgBuf) EmitLazyLogger(value otlog.LazyLogger) {
 // formatTags appends the tags to a bytes.Buffer. If there are no tags,
 // returns false.
 func formatTags(ctx context.Context, buf *msgBuf) bool {
-	tags := contextLogTags(ctx)
+	return formatTagList(contextLogTags(ctx), buf)
+}
+
+// formatTagList appends the given tags to a bytes.Buffer. If there are no
+// tags, returns false.
+func formatTagList(tags []logTag, buf *msgBuf) bool {
 	if len(tags) > 0 {
 		buf.WriteString("[")
 		for i, t := range tags {
@@ -119,8 +126,16 @@ func formatTags(ctx context.Context, buf *msgBuf) bool {
 
 // makeMessage creates a structured log entry.
 func makeMessage(ctx context.Context, format string, args []interface{}) string {
+	return makeMessageWithTags(contextLogTags(ctx), format, args)
+}
+
+// makeMessageWithTags creates a structured log entry with the given tags.
+func makeMessageWithTags(tags []logTag, format string, args []interface{}) string {
 	var buf msgBuf
-	formatTags(ctx, &buf)
+	formatTagList(tags, &buf)
+	if logging.redact.get() {
+		args = redactArgs(args)
+	}
 	if len(format) == 0 {
 		fmt.Fprint(&buf, args...)
 	} else {
@@ -133,9 +148,10 @@ func makeMessage(ctx context.Context, format string, args []interface{}) string
 // specified facility of the logger.
 func addStructured(ctx context.Context, s Severity, depth int, format string, args []interface{}) {
 	file, line, _ := caller.Lookup(depth + 1)
-	msg := makeMessage(ctx, format, args)
+	tags := contextLogTags(ctx)
+	msg := makeMessageWithTags(tags, format, args)
 	// makeMessage already added the tags when forming msg, we don't want
 	// eventInternal to prepend them again.
 	eventInternal(ctx, (s >= Severity_ERROR), false /*withTags*/, "%s:%d %s", file, line, msg)
-	logging.outputLogEntry(s, file, line, msg)
+	logging.outputLogEntry(s, file, line, tags, msg)
 }
@@ -66,6 +66,8 @@ type PrometheusExportable interface {
 	GetType() *prometheusgo.MetricType
 	// GetLabels is a method on Metadata
 	GetLabels() []*prometheusgo.LabelPair
+	// GetFamily is a method on Metadata
+	GetFamily() (name, help string, label *prometheusgo.LabelPair)
 	// ToPrometheusMetric returns a filled-in prometheus metric of the right type
 	// for the given metric. It does not fill in labels.
 	// The implementation must return thread-safe data to the caller, i.e.
@@ -78,6 +80,30 @@ type PrometheusExportable interface {
 type Metadata struct {
 	Name, Help string
 	labels     []*prometheusgo.LabelPair
+	// family, familyHelp and familyLabel are set by InFamily.
+	family, familyHelp string
+	familyLabel        *prometheusgo.LabelPair
+}
+
+// InFamily returns a copy of the metadata which exports the metric to
+// prometheus as a member of the given family of metrics, distinguished from
+// the other members by the given label. The metric keeps its name in the
+// registry and in the time series recorded from it; only prometheus sees the
+// family. For example, a "queue.gc.pending" metric in family "queue.pending"
+// with label queue="gc" is exported as queue_pending{queue="gc"}, which
+// can be aggregated across queues without matching names. The help text
+// describes the family as a whole.
+//
+// For compatibility with existing dashboards and alerts, the metric is also
+// still exported under its own name, without the family label. This will
+// stop after one release, so consumers should switch to the family.
+func (m Metadata) InFamily(family, help, labelName, labelValue string) Metadata {
+	m.family, m.familyHelp = family, help
+	m.familyLabel = &prometheusgo.LabelPair{
+		Name:  proto.String(exportedLabel(labelName)),
+		Value: proto.String(labelValue),
+	}
+	return m
 }
 
 // GetName returns the metric's name.
@@ -90,7 +116,19 @@ func (m *Metadata) GetHelp() string {
 	return m.Help
 }
 
-// GetLabels returns the metric's labels.
+// GetFamily returns the name and help text of the prometheus metric family
+// of the metric, as well as the label which distinguishes the metric within
+// the family. Unless the metric was placed in a family by InFamily, the name
+// and help text are derived from the metric's own and the label is nil.
+func (m *Metadata) GetFamily() (name, help string, label *prometheusgo.LabelPair) {
+	if m.family == "" {
+		return exportedName(m.Name), m.Help, nil
+	}
+	return exportedName(m.family), m.familyHelp, m.familyLabel
+}
+
+// GetLabels returns the metric's labels, not including the label of its
+// family.
 func (m *Metadata) GetLabels() []*prometheusgo.LabelPair {
 	return m.labels
 }
@@ -165,18 +203,49 @@ type Histogram struct {
 	}
 }
 
+// HistogramOptions configure a Histogram created by NewHistogramWithOptions.
+type HistogramOptions struct {
+	// MaxVal is the maximum value tracked by the histogram. Higher values are
+	// recorded as MaxVal instead.
+	MaxVal int64
+	// SigFigs is the number of significant decimal digits (between 1 and 5)
+	// to which the values are recorded. Each additional digit makes the
+	// quantiles more accurate, at the cost of ten times as many buckets.
+	SigFigs int
+	// Duration is the span of the recent samples in the windowed histogram.
+	Duration time.Duration
+	// RotationInterval is the interval at which the oldest samples are
+	// evicted from the windowed histogram, which always retains at least
+	// Duration-RotationInterval worth of samples. Shorter intervals avoid
+	// quantiles based on few samples right after a rotation, but cost a
+	// histogram per interval in the window. It must be at most Duration/2
+	// and defaults to Duration/2.
+	RotationInterval time.Duration
+}
+
 // NewHistogram initializes a given Histogram. The contained windowed histogram
-// rotates every 'duration'; both the windowed and the cumulative histogram
-// track nonnegative values up to 'maxVal' with 'sigFigs' decimal points of
-// precision.
+// retains values for approximately 'duration'; both the windowed and the
+// cumulative histogram track nonnegative values up to 'maxVal' with 'sigFigs'
+// decimal points of precision.
 func NewHistogram(metadata Metadata, duration time.Duration, maxVal int64, sigFigs int) *Histogram {
-	dHist := newSlidingHistogram(duration, maxVal, sigFigs)
+	return NewHistogramWithOptions(metadata, HistogramOptions{
+		MaxVal:   maxVal,
+		SigFigs:  sigFigs,
+		Duration: duration,
+	})
+}
+
+// NewHistogramWithOptions initializes a Histogram configured by opts.
+func NewHistogramWithOptions(metadata Metadata, opts HistogramOptions) *Histogram {
+	if opts.RotationInterval == 0 {
+		opts.RotationInterval = opts.Duration / histWrapNum
+	}
 	h := &Histogram{
 		Metadata: metadata,
-		maxVal:   maxVal,
+		maxVal:   opts.MaxVal,
 	}
-	h.mu.cumulative = hdrhistogram.New(0, maxVal, sigFigs)
-	h.mu.sliding = dHist
+	h.mu.cumulative = hdrhistogram.New(0, opts.MaxVal, opts.SigFigs)
+	h.mu.sliding = newSlidingHistogram(opts.Duration, opts.RotationInterval, opts.MaxVal, opts.SigFigs)
 	return h
 }
 
@@ -193,12 +262,13 @@ func NewLatency(metadata Metadata, sampleDuration time.Duration) *Histogram {
 	)
 }
 
-// Windowed returns a copy of the current windowed histogram data and its
-// rotation interval.
+// Windowed returns a copy of the current windowed histogram data and the
+// duration of its window.
 func (h *Histogram) Windowed() (*hdrhistogram.Histogram, time.Duration) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	return cloneHistogram(h.mu.sliding.Current()), h.mu.sliding.duration
+	// Current merges the histograms of the window into a new one.
+	return h.mu.sliding.Current(), h.mu.sliding.duration
 }
 
 // Snapshot returns a copy of the cumulative (i.e. all-time samples) histogram
@@ -211,7 +281,8 @@ func (h *Histogram) Snapshot() *hdrhistogram.Histogram {
 
 // RecordValue adds the given value to the histogram. Recording a value in
 // excess of the configured maximum value for that histogram results in
-// recording the maximum value instead.
+// recording the maximum value instead. It does not allocate, so it can be
+// used on hot paths.
 func (h *Histogram) RecordValue(v int64) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
@@ -287,6 +358,36 @@ func (h *Histogram) ToPrometheusMetric() *prometheusgo.Metric {
 	}
 }
 
+// prometheusQuantiles are the quantiles (in percent) of the windowed
+// histogram data exported by ToPrometheusSummary.
+var prometheusQuantiles = []float64{50, 75, 90, 99, 99.9, 99.99, 99.999, 100}
+
+// ToPrometheusSummary returns a prometheus summary of the windowed histogram
+// data at fixed quantiles. Unlike the cumulative buckets returned by
+// ToPrometheusMetric, the quantiles reflect recent samples only, as do the
+// count and (approximate) sum of the summary.
+func (h *Histogram) ToPrometheusSummary() *prometheusgo.Metric {
+	h.mu.Lock()
+	maybeTick(h.mu.sliding)
+	curr := h.mu.sliding.Current()
+	summary := &prometheusgo.Summary{
+		SampleCount: proto.Uint64(uint64(curr.TotalCount())),
+		SampleSum:   proto.Float64(curr.Mean() * float64(curr.TotalCount())),
+		Quantile:    make([]*prometheusgo.Quantile, 0, len(prometheusQuantiles)),
+	}
+	for _, q := range prometheusQuantiles {
+		summary.Quantile = append(summary.Quantile, &prometheusgo.Quantile{
+			Quantile: proto.Float64(q / 100),
+			Value:    proto.Float64(float64(curr.ValueAtQuantile(q))),
+		})
+	}
+	h.mu.Unlock()
+
+	return &prometheusgo.Metric{
+		Summary: summary,
+	}
+}
+
 // A Counter holds a single mutable atomic value.
 type Counter struct {
 	Metadata
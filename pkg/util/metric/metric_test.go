@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 
@@ -107,6 +108,33 @@ func TestHistogramPrometheus(t *testing.T) {
 	}
 }
 
+func TestHistogramPrometheusSummary(t *testing.T) {
+	// Small values are recorded exactly even with one significant figure.
+	h := NewHistogram(Metadata{}, time.Hour, 20, 1)
+	for i := 1; i <= 20; i++ {
+		h.RecordValue(int64(i))
+	}
+	act := *h.ToPrometheusSummary().Summary
+
+	if c := act.GetSampleCount(); c != 20 {
+		t.Errorf("expected a sample count of 20, got %d", c)
+	}
+	if len(act.Quantile) != len(prometheusQuantiles) {
+		t.Fatalf("expected %d quantiles, got %+v", len(prometheusQuantiles), act.Quantile)
+	}
+	for i, q := range act.Quantile {
+		if exp := prometheusQuantiles[i] / 100; q.GetQuantile() != exp {
+			t.Errorf("%d: expected quantile %f, got %f", i, exp, q.GetQuantile())
+		}
+	}
+	if v := act.Quantile[0].GetValue(); v != 10 {
+		t.Errorf("expected a median of 10, got %f", v)
+	}
+	if v := act.Quantile[len(act.Quantile)-1].GetValue(); v != 20 {
+		t.Errorf("expected a maximum of 20, got %f", v)
+	}
+}
+
 func TestHistogramRotate(t *testing.T) {
 	defer TestingSetNow(nil)()
 	setNow(0)
@@ -140,6 +168,50 @@ func TestHistogramRotate(t *testing.T) {
 	}
 }
 
+func TestHistogramRotationInterval(t *testing.T) {
+	defer TestingSetNow(nil)()
+	setNow(0)
+	const duration = 4 * time.Second
+	h := NewHistogramWithOptions(emptyMetadata, HistogramOptions{
+		MaxVal:           1000,
+		SigFigs:          3,
+		Duration:         duration,
+		RotationInterval: time.Second,
+	})
+	var cur time.Duration
+	for i := 0; i < 10; i++ {
+		v := int64(10 * i)
+		h.RecordValue(v)
+		cur += time.Second
+		setNow(cur)
+		windowed, windowDuration := h.Windowed()
+		if windowDuration != duration {
+			t.Fatalf("window changed: is %s, should be %s", windowDuration, duration)
+		}
+
+		// The window retains the values of the last three seconds.
+		expMin := int64((i - 2) * 10)
+		if expMin < 0 {
+			expMin = 0
+		}
+		if min := windowed.Min(); min != expMin {
+			t.Fatalf("%d: unexpected minimum %d, expected %d", i, min, expMin)
+		}
+		if max := windowed.Max(); max != v {
+			t.Fatalf("%d: unexpected maximum %d, expected %d", i, max, v)
+		}
+	}
+}
+
+func TestHistogramRecordValueAllocs(t *testing.T) {
+	h := NewLatency(emptyMetadata, time.Minute)
+	if allocs := testing.AllocsPerRun(100, func() {
+		h.RecordValue(int64(time.Millisecond))
+	}); allocs != 0 {
+		t.Errorf("expected RecordValue not to allocate, got %.1f allocations", allocs)
+	}
+}
+
 func TestRateRotate(t *testing.T) {
 	defer TestingSetNow(nil)()
 	setNow(0)
@@ -171,3 +243,50 @@ func TestRateRotate(t *testing.T) {
 		t.Fatalf("final value implausible: %v", v)
 	}
 }
+
+func TestWindowedRate(t *testing.T) {
+	defer TestingSetNow(nil)()
+	setNow(0)
+	r := NewWindowedRate(emptyMetadata, 10*time.Second)
+
+	for i, tc := range []struct {
+		at  time.Duration
+		add int64
+		exp float64
+	}{
+		// While younger than its window, the rate averages over its lifetime.
+		{0, 10, 0},
+		{2 * time.Second, 0, 5},
+		{5 * time.Second, 45, 11},
+		// The first second has left the window, which now covers the nine
+		// full seconds preceding the current one.
+		{10 * time.Second, 0, 5},
+		// The bucket of the events added at 5s is reused.
+		{15 * time.Second, 9, 1},
+		{30 * time.Second, 0, 0},
+	} {
+		setNow(tc.at)
+		r.Add(tc.add)
+		if v := r.Value(); v != tc.exp {
+			t.Errorf("%d: at %s, expected a rate of %f, got %f", i, tc.at, tc.exp, v)
+		}
+	}
+	testMarshal(t, r, "0")
+
+	// Events can be added concurrently.
+	setNow(time.Minute)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				r.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if v, exp := r.Value(), 1000.0/9; v != exp {
+		t.Errorf("expected a rate of %f, got %f", exp, v)
+	}
+}
@@ -18,6 +18,7 @@ package metric
 
 import (
 	"io"
+	"sort"
 
 	"github.com/gogo/protobuf/proto"
 	prometheusgo "github.com/prometheus/client_model/go"
@@ -45,19 +46,21 @@ func MakePrometheusExporter() PrometheusExporter {
 	return PrometheusExporter{families: map[string]*prometheusgo.MetricFamily{}}
 }
 
-// find the family for the passed-in metric, or create and return it if not found.
-func (pm *PrometheusExporter) findOrCreateFamily(
-	prom PrometheusExportable,
+// quantilesSuffix is appended to the names of histograms to name the
+// summaries of their windowed quantiles.
+const quantilesSuffix = "_quantiles"
+
+func (pm *PrometheusExporter) findOrCreateFamilyWithName(
+	familyName, help string, typ *prometheusgo.MetricType,
 ) *prometheusgo.MetricFamily {
-	familyName := exportedName(prom.GetName())
 	if family, ok := pm.families[familyName]; ok {
 		return family
 	}
 
 	family := &prometheusgo.MetricFamily{
 		Name: proto.String(familyName),
-		Help: proto.String(prom.GetHelp()),
-		Type: prom.GetType(),
+		Help: proto.String(help),
+		Type: typ,
 	}
 
 	pm.families[familyName] = family
@@ -67,28 +70,68 @@ func (pm *PrometheusExporter) findOrCreateFamily(
 // ScrapeRegistry scrapes all metrics contained in the registry to the metric
 // family map, holding on only to the scraped data (which is no longer
 // connected to the registry and metrics within) when returning from the the
-// call. It creates new families as needed.
+// call. It creates new families as needed. Histograms are exported twice: as
+// prometheus histograms of all samples and, with the "_quantiles" suffix, as
+// prometheus summaries of the quantiles of their recent samples.
 func (pm *PrometheusExporter) ScrapeRegistry(registry *Registry) {
 	labels := registry.getLabels()
 	for _, metric := range registry.tracked {
 		metric.Inspect(func(v interface{}) {
 			if prom, ok := v.(PrometheusExportable); ok {
-				m := prom.ToPrometheusMetric()
-				// Set registry and metric labels.
-				m.Label = append(labels, prom.GetLabels()...)
-
-				family := pm.findOrCreateFamily(prom)
-				family.Metric = append(family.Metric, m)
+				pm.export(prom, "", prom.GetType(), labels, prom.ToPrometheusMetric)
+			}
+			if h, ok := v.(*Histogram); ok {
+				pm.export(h, quantilesSuffix, prometheusgo.MetricType_SUMMARY.Enum(),
+					labels, h.ToPrometheusSummary)
 			}
 		})
 	}
 }
 
+// export adds the metric returned by toMetric, labeled with the registry
+// labels and the labels of prom, to the family of prom. The name of the
+// family is suffixed with suffix. Metrics which were placed in a family by
+// InFamily are additionally exported under their own names, without the
+// family label, so that the names exported before the introduction of the
+// family keep working for a release.
+func (pm *PrometheusExporter) export(
+	prom PrometheusExportable,
+	suffix string,
+	typ *prometheusgo.MetricType,
+	registryLabels []*prometheusgo.LabelPair,
+	toMetric func() *prometheusgo.Metric,
+) {
+	// Copy the labels, which are shared by all the metrics of the registry.
+	labels := make([]*prometheusgo.LabelPair, 0, len(registryLabels)+len(prom.GetLabels())+1)
+	labels = append(append(labels, registryLabels...), prom.GetLabels()...)
+
+	name, help, label := prom.GetFamily()
+	if label != nil {
+		m := toMetric()
+		m.Label = labels
+		family := pm.findOrCreateFamilyWithName(exportedName(prom.GetName())+suffix, prom.GetHelp(), typ)
+		family.Metric = append(family.Metric, m)
+		labels = append(labels, label)
+	}
+	m := toMetric()
+	m.Label = labels
+	family := pm.findOrCreateFamilyWithName(name+suffix, help, typ)
+	family.Metric = append(family.Metric, m)
+}
+
 // PrintAsText writes all metrics in the families map to the io.Writer in
-// prometheus' text format. It removes individual metrics from the families
-// as it goes, readying the families for another found of registry additions.
+// prometheus' text format, including the help text and type of each family.
+// The families are written in the order of their names. It removes individual
+// metrics from the families as it goes, readying the families for another
+// found of registry additions.
 func (pm *PrometheusExporter) PrintAsText(w io.Writer) error {
-	for _, family := range pm.families {
+	names := make([]string, 0, len(pm.families))
+	for name := range pm.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		family := pm.families[name]
 		if _, err := expfmt.MetricFamilyToText(w, family); err != nil {
 			return err
 		}
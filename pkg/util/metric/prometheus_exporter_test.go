@@ -16,7 +16,13 @@
 
 package metric
 
-import "testing"
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
 
 func TestPrometheusExporter(t *testing.T) {
 	r1, r2 := NewRegistry(), NewRegistry()
@@ -88,3 +94,81 @@ func TestPrometheusExporter(t *testing.T) {
 		}
 	}
 }
+
+func TestPrometheusExporterPrintAsText(t *testing.T) {
+	r := NewRegistry()
+	r.AddLabel("registry", "one")
+	r.AddMetric(NewGauge(Metadata{Name: "b.gauge", Help: "A gauge"}))
+	h := NewHistogram(Metadata{Name: "a.latency", Help: "A latency"}, time.Hour, 100, 1)
+	h.RecordValue(10)
+	r.AddMetric(h)
+
+	pe := MakePrometheusExporter()
+	pe.ScrapeRegistry(r)
+	var buf bytes.Buffer
+	if err := pe.PrintAsText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	// The families are printed in order along with their metadata, and
+	// histograms come with a summary of their quantiles.
+	var last int
+	for _, expected := range []string{
+		"# HELP a_latency A latency\n# TYPE a_latency histogram\n",
+		`a_latency_bucket{registry="one",le="10"} 1`,
+		"# HELP a_latency_quantiles A latency\n# TYPE a_latency_quantiles summary\n",
+		`a_latency_quantiles{registry="one",quantile="0.5"} 10`,
+		`a_latency_quantiles_count{registry="one"} 1`,
+		"# HELP b_gauge A gauge\n# TYPE b_gauge gauge\n",
+		`b_gauge{registry="one"} 0`,
+	} {
+		i := strings.Index(out, expected)
+		if i < last {
+			t.Fatalf("expected %q after offset %d in:\n%s", expected, last, out)
+		}
+		last = i
+	}
+}
+
+func TestPrometheusExporterFamilies(t *testing.T) {
+	r := NewRegistry()
+	r.AddLabel("store", "1")
+	for _, queue := range []string{"gc", "split"} {
+		meta := Metadata{Name: "queue." + queue + ".pending", Help: "Pending in the " + queue + " queue"}
+		g := NewGauge(meta.InFamily("queue.pending", "Pending in the queue", "queue", queue))
+		g.Update(int64(len(queue)))
+		r.AddMetric(g)
+	}
+
+	// The registry keeps the names of the metrics.
+	var names []string
+	r.Each(func(name string, _ interface{}) {
+		names = append(names, name)
+	})
+	if expected := []string{"queue.gc.pending", "queue.split.pending"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected names %s, got %s", expected, names)
+	}
+
+	pe := MakePrometheusExporter()
+	pe.ScrapeRegistry(r)
+	var buf bytes.Buffer
+	if err := pe.PrintAsText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	// The metrics are also exported under their own names for compatibility.
+	expected := `# HELP queue_gc_pending Pending in the gc queue
+# TYPE queue_gc_pending gauge
+queue_gc_pending{store="1"} 2
+# HELP queue_pending Pending in the queue
+# TYPE queue_pending gauge
+queue_pending{store="1",queue="gc"} 2
+queue_pending{store="1",queue="split"} 5
+# HELP queue_split_pending Pending in the split queue
+# TYPE queue_split_pending gauge
+queue_split_pending{store="1"} 5
+`
+	if out := buf.String(); out != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+}
@@ -81,6 +81,18 @@ func (r *Registry) AddMetric(metric Iterable) {
 	}
 }
 
+// RemoveMetric removes the passed-in metric from the registry, if present.
+func (r *Registry) RemoveMetric(metric Iterable) {
+	r.Lock()
+	defer r.Unlock()
+	for i, m := range r.tracked {
+		if m == metric {
+			r.tracked = append(r.tracked[:i], r.tracked[i+1:]...)
+			return
+		}
+	}
+}
+
 // AddMetricStruct examines all fields of metricStruct and adds
 // all Iterable or metricGroup objects to the registry.
 func (r *Registry) AddMetricStruct(metricStruct interface{}) {
@@ -159,4 +159,9 @@ func TestRegistry(t *testing.T) {
 	if c := r.getCounter("top.histogram"); c != nil {
 		t.Errorf("getCounter returned non-nil %v of type %T when requesting non-counter, expected nil", c, c)
 	}
+
+	r.RemoveMetric(topGauge)
+	if g := r.getGauge("top.gauge"); g != nil {
+		t.Errorf("getGauge returned %v after removal, expected nil", g)
+	}
 }
@@ -29,25 +29,33 @@ type slidingHistogram struct {
 	windowed *hdrhistogram.WindowedHistogram
 	nextT    time.Time
 	duration time.Duration
+	interval time.Duration
 }
 
 // newSlidingHistogram creates a new windowed HDRHistogram with the given
-// parameters. Data is kept in the active window for approximately the given
-// duration. See the documentation for hdrhistogram.WindowedHistogram for
-// details.
-func newSlidingHistogram(duration time.Duration, maxVal int64, sigFigs int) *slidingHistogram {
+// parameters. The window is made of duration/interval histograms, the oldest
+// of which is dropped every interval, so that data is kept in the active
+// window for at least duration-interval. See the documentation for
+// hdrhistogram.WindowedHistogram for details.
+func newSlidingHistogram(
+	duration, interval time.Duration, maxVal int64, sigFigs int,
+) *slidingHistogram {
 	if duration <= 0 {
 		panic("cannot create a sliding histogram with nonpositive duration")
 	}
+	if interval <= 0 || interval > duration/2 {
+		panic("the rotation interval of a sliding histogram must be positive and at most half its duration")
+	}
 	return &slidingHistogram{
 		nextT:    now(),
 		duration: duration,
-		windowed: hdrhistogram.NewWindowed(histWrapNum, 0, maxVal, sigFigs),
+		interval: interval,
+		windowed: hdrhistogram.NewWindowed(int(duration/interval), 0, maxVal, sigFigs),
 	}
 }
 
 func (h *slidingHistogram) tick() {
-	h.nextT = h.nextT.Add(h.duration / histWrapNum)
+	h.nextT = h.nextT.Add(h.interval)
 	h.windowed.Rotate()
 }
 
@@ -0,0 +1,152 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metric
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	prometheusgo "github.com/prometheus/client_model/go"
+
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+)
+
+// windowedRateBuckets is the number of buckets a WindowedRate divides its
+// window into. Events fall out of the window one bucket at a time.
+const windowedRateBuckets = 10
+
+// windowedRateBucket counts the events of one interval of a WindowedRate. The
+// epoch numbers the interval since the creation of the rate.
+type windowedRateBucket struct {
+	epoch int64 // accessed atomically
+	count int64 // accessed atomically
+}
+
+// A WindowedRate measures the number of events per second over a sliding
+// window. Unlike a Rate, which is an exponentially weighted moving average
+// protected by a mutex, recording events only involves atomic operations
+// (except for once per bucket interval), which makes it suitable for hot
+// paths such as the processing of every request of a store.
+type WindowedRate struct {
+	Metadata
+	window    time.Duration
+	bucketDur time.Duration
+	created   time.Time
+	buckets   [windowedRateBuckets]windowedRateBucket
+	// rotateMu serializes the reuse of a bucket for a new interval.
+	rotateMu syncutil.Mutex
+}
+
+// NewWindowedRate creates a WindowedRate which measures events per second
+// over the given window. Windows shorter than a millisecond per bucket are
+// illegal and will cause a panic.
+func NewWindowedRate(metadata Metadata, window time.Duration) *WindowedRate {
+	bucketDur := window / windowedRateBuckets
+	if bucketDur < time.Millisecond {
+		panic(fmt.Sprintf("windowed rate on window %s is too fine-grained", window))
+	}
+	return &WindowedRate{
+		Metadata:  metadata,
+		window:    window,
+		bucketDur: bucketDur,
+		created:   now(),
+	}
+}
+
+// Window returns the window over which the rate is measured.
+func (w *WindowedRate) Window() time.Duration {
+	return w.window
+}
+
+// epochAt returns the number of the bucket interval containing t, along with
+// the time elapsed since the creation of the rate.
+func (w *WindowedRate) epochAt(t time.Time) (int64, time.Duration) {
+	elapsed := t.Sub(w.created)
+	if elapsed < 0 {
+		// The clock jumped backwards; attribute events to the first interval.
+		elapsed = 0
+	}
+	return int64(elapsed / w.bucketDur), elapsed
+}
+
+// Add records n events.
+func (w *WindowedRate) Add(n int64) {
+	epoch, _ := w.epochAt(now())
+	b := &w.buckets[epoch%windowedRateBuckets]
+	if atomic.LoadInt64(&b.epoch) < epoch {
+		w.rotateMu.Lock()
+		// Another caller may have rotated the bucket while we were waiting.
+		if atomic.LoadInt64(&b.epoch) < epoch {
+			// Reset the count before publishing the new epoch, so that
+			// concurrent callers which observe the new epoch don't add to the
+			// stale count.
+			atomic.StoreInt64(&b.count, 0)
+			atomic.StoreInt64(&b.epoch, epoch)
+		}
+		w.rotateMu.Unlock()
+	}
+	atomic.AddInt64(&b.count, n)
+}
+
+// Value returns the number of events per second over the window. While the
+// rate is younger than its window, the events are averaged over its lifetime
+// instead.
+func (w *WindowedRate) Value() float64 {
+	epoch, elapsed := w.epochAt(now())
+	var sum int64
+	for i := range w.buckets {
+		b := &w.buckets[i]
+		if e := atomic.LoadInt64(&b.epoch); e > epoch-windowedRateBuckets && e <= epoch {
+			sum += atomic.LoadInt64(&b.count)
+		}
+	}
+	// The buckets in the window cover the current, partial interval and the
+	// full intervals preceding it.
+	span := elapsed - time.Duration(epoch-windowedRateBuckets+1)*w.bucketDur
+	if span > elapsed {
+		span = elapsed
+	}
+	if span <= 0 {
+		return 0
+	}
+	return float64(sum) / span.Seconds()
+}
+
+// Inspect calls the given closure with itself.
+func (w *WindowedRate) Inspect(f func(interface{})) { f(w) }
+
+// GetType returns the prometheus type enum for this metric.
+func (w *WindowedRate) GetType() *prometheusgo.MetricType {
+	return prometheusgo.MetricType_GAUGE.Enum()
+}
+
+// MarshalJSON marshals to JSON.
+func (w *WindowedRate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(w.Value())
+}
+
+// ToPrometheusMetric returns a filled-in prometheus metric of the right type.
+func (w *WindowedRate) ToPrometheusMetric() *prometheusgo.Metric {
+	return &prometheusgo.Metric{
+		Gauge: &prometheusgo.Gauge{Value: proto.Float64(w.Value())},
+	}
+}
+
+var _ Iterable = &WindowedRate{}
+var _ json.Marshaler = &WindowedRate{}
+var _ PrometheusExportable = &WindowedRate{}
@@ -30,13 +30,29 @@ import (
 	"golang.org/x/net/http2"
 
 	"github.com/cockroachdb/cmux"
+	"github.com/cockroachdb/cockroach/pkg/util/envutil"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/stop"
 	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
 )
 
+// grpcDrainTimeout bounds the time for which a stopped grpc Server waits
+// for its in-flight RPCs before closing their connections.
+var grpcDrainTimeout = envutil.EnvOrDefaultDuration("COCKROACH_GRPC_DRAIN_TIMEOUT", 5*time.Second)
+
+// TestingSetGRPCDrainTimeout changes the time for which the grpc Servers
+// started afterwards wait for their in-flight RPCs when they are stopped.
+func TestingSetGRPCDrainTimeout(timeout time.Duration) func() {
+	origTimeout := grpcDrainTimeout
+	grpcDrainTimeout = timeout
+	return func() {
+		grpcDrainTimeout = origTimeout
+	}
+}
+
 // ListenAndServeGRPC creates a listener and serves the specified grpc Server
-// on it, closing the listener when signalled by the stopper.
+// on it. The server is drained when the stopper quiesces; see
+// DrainGRPCServerOnQuiesce.
 func ListenAndServeGRPC(
 	stopper *stop.Stopper, server *grpc.Server, addr net.Addr,
 ) (net.Listener, error) {
@@ -45,12 +61,7 @@ func ListenAndServeGRPC(
 		return ln, err
 	}
 
-	stopper.RunWorker(func() {
-		<-stopper.ShouldQuiesce()
-		FatalIfUnexpected(ln.Close())
-		<-stopper.ShouldStop()
-		server.Stop()
-	})
+	DrainGRPCServerOnQuiesce(stopper, server, ln.Addr())
 
 	stopper.RunWorker(func() {
 		FatalIfUnexpected(server.Serve(ln))
@@ -58,6 +69,38 @@ func ListenAndServeGRPC(
 	return ln, nil
 }
 
+// DrainGRPCServerOnQuiesce drains the specified grpc Server, which serves on
+// addr, when the stopper quiesces: the server closes its listeners and stops
+// accepting new streams, but lets the in-flight RPCs complete. Once the
+// stopper stops, the remaining RPCs get a bounded grace period (see
+// COCKROACH_GRPC_DRAIN_TIMEOUT) before their connections are closed.
+func DrainGRPCServerOnQuiesce(stopper *stop.Stopper, server *grpc.Server, addr net.Addr) {
+	drainTimeout := grpcDrainTimeout
+	stopper.RunWorker(func() {
+		<-stopper.ShouldQuiesce()
+		drained := make(chan struct{})
+		go func() {
+			server.GracefulStop()
+			close(drained)
+		}()
+		// Most RPCs are served by tasks of the stopper, which have completed
+		// once it stops.
+		select {
+		case <-drained:
+			return
+		case <-stopper.ShouldStop():
+		}
+		select {
+		case <-drained:
+		case <-time.After(drainTimeout):
+			log.Warningf(context.TODO(), "RPCs still running after %s; stopping grpc server at %s",
+				drainTimeout, addr)
+			server.Stop()
+			<-drained
+		}
+	})
+}
+
 var httpLogger = log.NewStdLogger(log.Severity_ERROR)
 
 // Server is a thin wrapper around http.Server. See MakeServer for more detail.
@@ -155,3 +198,31 @@ func FatalIfUnexpected(err error) {
 		log.Fatal(context.TODO(), err)
 	}
 }
+
+// KeepAliveListener returns a listener which enables TCP keepalives with the
+// specified period on the connections accepted by ln. If ln is not a TCP
+// listener or period is not positive, ln is returned as is.
+func KeepAliveListener(ln net.Listener, period time.Duration) net.Listener {
+	tcpLn, ok := ln.(*net.TCPListener)
+	if !ok || period <= 0 {
+		return ln
+	}
+	return keepAliveListener{TCPListener: tcpLn, period: period}
+}
+
+type keepAliveListener struct {
+	*net.TCPListener
+	period time.Duration
+}
+
+// Accept implements net.Listener.
+func (ln keepAliveListener) Accept() (net.Conn, error) {
+	conn, err := ln.AcceptTCP()
+	if err != nil {
+		return nil, err
+	}
+	// As in net/http, failures to configure keepalives are not fatal.
+	_ = conn.SetKeepAlive(true)
+	_ = conn.SetKeepAlivePeriod(ln.period)
+	return conn, nil
+}
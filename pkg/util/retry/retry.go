@@ -17,11 +17,14 @@
 package retry
 
 import (
+	"fmt"
 	"math"
 	"math/rand"
 	"time"
 
 	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 )
 
 // Options provides reusable configuration of Retry objects.
@@ -31,9 +34,28 @@ type Options struct {
 	Multiplier          float64         // Default backoff constant
 	MaxRetries          int             // Maximum number of attempts (0 for infinite)
 	RandomizationFactor float64         // Randomize the backoff interval by constant
+	FullJitter          bool            // Randomize the backoff interval between zero and its full value
+	MaxDuration         time.Duration   // Maximum total time spent in the retry loop (0 for infinite)
 	Closer              <-chan struct{} // Optionally end retry loop channel close.
 }
 
+// RetriesExhaustedError is returned by Retry.Err when the retry loop ended
+// because its MaxRetries or MaxDuration budget was used up.
+type RetriesExhaustedError struct {
+	Attempts int
+	Elapsed  time.Duration
+	// LastErr is the error of the last attempt, if any.
+	LastErr error
+}
+
+func (e *RetriesExhaustedError) Error() string {
+	msg := fmt.Sprintf("retries exhausted after %d attempts in %s", e.Attempts, e.Elapsed)
+	if e.LastErr != nil {
+		msg += ": " + e.LastErr.Error()
+	}
+	return msg
+}
+
 // Retry implements the public methods necessary to control an exponential-
 // backoff retry loop.
 type Retry struct {
@@ -41,6 +63,8 @@ type Retry struct {
 	ctxDoneChan    <-chan struct{}
 	currentAttempt int
 	isReset        bool
+	start          time.Time
+	exhausted      bool
 }
 
 // Start returns a new Retry initialized to some default values. The Retry can
@@ -66,7 +90,7 @@ func StartWithCtx(ctx context.Context, opts Options) Retry {
 		opts.Multiplier = 2
 	}
 
-	r := Retry{opts: opts}
+	r := Retry{opts: opts, start: timeutil.Now()}
 	if ctx != nil {
 		r.ctxDoneChan = ctx.Done()
 	}
@@ -77,7 +101,7 @@ func StartWithCtx(ctx context.Context, opts Options) Retry {
 // Reset resets the Retry to its initial state, meaning that the next call to
 // Next will return true immediately and subsequent calls will behave as if
 // they had followed the very first attempt (i.e. their backoffs will be
-// short).
+// short). The MaxDuration budget starts over as well.
 func (r *Retry) Reset() {
 	select {
 	case <-r.opts.Closer:
@@ -90,6 +114,8 @@ func (r *Retry) Reset() {
 	}
 	r.currentAttempt = 0
 	r.isReset = true
+	r.start = timeutil.Now()
+	r.exhausted = false
 }
 
 // CurrentAttempt it is zero initially and increases with each call to Next()
@@ -104,6 +130,13 @@ func (r Retry) retryIn() time.Duration {
 		backoff = maxBackoff
 	}
 
+	if r.opts.FullJitter {
+		// Get a random value from the range [0, backoff]. Unlike a small
+		// randomization factor, this spreads out the retries of many clients
+		// which failed at the same time.
+		return time.Duration(rand.Float64() * backoff)
+	}
+
 	var delta = r.opts.RandomizationFactor * backoff
 	// Get a random value from the range [backoff - delta, backoff + delta].
 	// The formula used below has a +1 because time.Duration is an int64, and the
@@ -114,6 +147,8 @@ func (r Retry) retryIn() time.Duration {
 // Next returns whether the retry loop should continue, and blocks for the
 // appropriate length of time before yielding back to the caller. If a stopper
 // is present, Next will eagerly return false when the stopper is stopped.
+// Next also returns false, without waiting, when the MaxRetries or
+// MaxDuration budget is used up; see Err.
 func (r *Retry) Next() bool {
 	if r.isReset {
 		r.isReset = false
@@ -121,12 +156,19 @@ func (r *Retry) Next() bool {
 	}
 
 	if r.opts.MaxRetries > 0 && r.currentAttempt == r.opts.MaxRetries {
+		r.exhausted = true
+		return false
+	}
+
+	wait := r.retryIn()
+	if r.opts.MaxDuration > 0 && timeutil.Since(r.start)+wait > r.opts.MaxDuration {
+		r.exhausted = true
 		return false
 	}
 
 	// Wait before retry.
 	select {
-	case <-time.After(r.retryIn()):
+	case <-time.After(wait):
 		r.currentAttempt++
 		return true
 	case <-r.opts.Closer:
@@ -135,3 +177,18 @@ func (r *Retry) Next() bool {
 		return false
 	}
 }
+
+// Err returns a *RetriesExhaustedError wrapping lastErr if the retry loop
+// ended because its MaxRetries or MaxDuration budget was used up, and nil
+// otherwise (including when the loop ended because of the closer or the
+// context).
+func (r *Retry) Err(lastErr error) error {
+	if !r.exhausted {
+		return nil
+	}
+	return &RetriesExhaustedError{
+		Attempts: r.currentAttempt + 1,
+		Elapsed:  timeutil.Since(r.start),
+		LastErr:  lastErr,
+	}
+}
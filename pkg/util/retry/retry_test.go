@@ -17,6 +17,7 @@
 package retry
 
 import (
+	"errors"
 	"testing"
 	"time"
 )
@@ -104,3 +105,52 @@ func TestRetryStop(t *testing.T) {
 		t.Errorf("expected %d attempts, got %d", expAttempts, attempts)
 	}
 }
+
+func TestRetryFullJitter(t *testing.T) {
+	opts := Options{
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Second,
+		Multiplier:     2,
+		FullJitter:     true,
+	}
+
+	r := Start(opts)
+	for i := 0; i < 10; i++ {
+		max := opts.InitialBackoff << uint(i)
+		if d := r.retryIn(); d < 0 || d > max {
+			t.Fatalf("%d: expected backoff in [0, %s], got %s", i, max, d)
+		}
+		r.currentAttempt++
+	}
+}
+
+func TestRetryExhausted(t *testing.T) {
+	testCases := []Options{
+		{InitialBackoff: time.Microsecond, MaxRetries: 2},
+		{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 10 * time.Millisecond, MaxDuration: 25 * time.Millisecond},
+	}
+	for i, opts := range testCases {
+		lastErr := errors.New("boom")
+		r := Start(opts)
+		for r.Next() {
+		}
+		err := r.Err(lastErr)
+		rErr, ok := err.(*RetriesExhaustedError)
+		if !ok {
+			t.Fatalf("%d: expected RetriesExhaustedError, got %v", i, err)
+		}
+		if rErr.LastErr != lastErr || rErr.Attempts < 2 || rErr.Attempts > 3 {
+			t.Errorf("%d: unexpected error %+v", i, rErr)
+		}
+	}
+
+	// A retry loop ended by its closer is not exhausted.
+	closer := make(chan struct{})
+	close(closer)
+	r := Start(Options{MaxRetries: 1, Closer: closer})
+	for r.Next() {
+	}
+	if err := r.Err(nil); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
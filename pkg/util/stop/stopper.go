@@ -17,9 +17,11 @@
 package stop
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"net/http"
+	"runtime/debug"
 	"sort"
 	"strings"
 	"sync"
@@ -28,7 +30,9 @@ import (
 
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/util/caller"
+	"github.com/cockroachdb/cockroach/pkg/util/envutil"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/metric"
 	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
 	"github.com/cockroachdb/cockroach/pkg/util/tracing"
 )
@@ -37,8 +41,69 @@ import (
 // is no more capacity for async tasks, as limited by the semaphore.
 var ErrThrottled = errors.New("throttled on async limiting semaphore")
 
+// ErrTaskRejected is returned when a task is not run because its class is
+// rejected by RejectTasks.
+var ErrTaskRejected = errors.New("stopper is rejecting tasks of this class")
+
 var errUnavailable = &roachpb.NodeUnavailableError{}
 
+// A TaskClass determines which tasks RejectTasks stops admitting: the tasks
+// of lower classes are rejected first.
+type TaskClass int
+
+const (
+	// BackgroundTask is the class of tasks doing periodic or maintenance
+	// work, such as the processing of the replica queues.
+	BackgroundTask TaskClass = iota
+	// ForegroundTask is the class of tasks serving requests. It is the class
+	// of the tasks which are run without specifying a class.
+	ForegroundTask
+
+	numTaskClasses
+)
+
+func (c TaskClass) String() string {
+	switch c {
+	case BackgroundTask:
+		return "background"
+	case ForegroundTask:
+		return "foreground"
+	}
+	return fmt.Sprintf("TaskClass(%d)", int(c))
+}
+
+var (
+	metaBackgroundTasks = metric.Metadata{
+		Name: "tasks.background",
+		Help: "Number of running background tasks"}
+	metaForegroundTasks = metric.Metadata{
+		Name: "tasks.foreground",
+		Help: "Number of running foreground tasks"}
+)
+
+// TaskMetrics holds the number of running tasks of a Stopper by class.
+type TaskMetrics struct {
+	BackgroundTasks *metric.Gauge
+	ForegroundTasks *metric.Gauge
+}
+
+func makeTaskMetrics() TaskMetrics {
+	return TaskMetrics{
+		BackgroundTasks: metric.NewGauge(metaBackgroundTasks),
+		ForegroundTasks: metric.NewGauge(metaForegroundTasks),
+	}
+}
+
+func (m *TaskMetrics) gauge(class TaskClass) *metric.Gauge {
+	if class == BackgroundTask {
+		return m.BackgroundTasks
+	}
+	return m.ForegroundTasks
+}
+
+// trackTaskStacks enables the TrackTaskStacks option for all Stoppers.
+var trackTaskStacks = envutil.EnvOrDefaultBool("COCKROACH_STOPPER_TASK_STACKS", false)
+
 func register(s *Stopper) {
 	trackedStoppers.Lock()
 	trackedStoppers.stoppers = append(trackedStoppers.stoppers, s)
@@ -70,6 +135,9 @@ func handleDebug(w http.ResponseWriter, r *http.Request) {
 	for _, s := range trackedStoppers.stoppers {
 		s.mu.Lock()
 		fmt.Fprintf(w, "%p: %d tasks\n%s", s, s.mu.numTasks, s.runningTasksLocked())
+		if s.trackStacks {
+			fmt.Fprintf(w, "\n%s", s.runningTaskStacksLocked())
+		}
 		s.mu.Unlock()
 	}
 }
@@ -101,6 +169,12 @@ func (k taskKey) String() string {
 	return fmt.Sprintf("%s:%d", k.file, k.line)
 }
 
+// taskStack is the creation stack of a running task.
+type taskStack struct {
+	key   taskKey
+	stack []byte
+}
+
 // A Stopper provides a channel-based mechanism to stop an arbitrary
 // array of workers. Each worker is registered with the stopper via
 // the RunWorker() method. The system further allows execution of functions
@@ -108,7 +182,8 @@ func (k taskKey) String() string {
 //
 // Stopping occurs in two phases: the first is the request to stop, which moves
 // the stopper into a quiescing phase. While quiescing, calls to RunTask() &
-// RunAsyncTask() don't execute the function passed in and return errUnavailable.
+// RunAsyncTask() don't execute the function passed in and return errUnavailable,
+// regardless of the class of the task.
 // When all outstanding tasks have been completed, the stopper
 // closes its stopper channel, which signals all live workers that it's safe to
 // shut down. When all workers have shutdown, the stopper is complete.
@@ -122,14 +197,30 @@ type Stopper struct {
 	stopped  chan struct{}     // Closed when stopped completely
 	onPanic  func(interface{}) // called with recover() on panic on any goroutine
 	stop     sync.WaitGroup    // Incremented for outstanding workers
-	mu       struct {
+	// trackStacks is set if the creation stacks of running tasks are
+	// recorded in mu.taskStacks.
+	trackStacks bool
+	// metrics counts the running tasks by class.
+	metrics TaskMetrics
+	// parent is set for Stoppers created by NewChild.
+	parent *Stopper
+	// afterParent is set for children which are stopped after their parent;
+	// see StopAfterParent.
+	afterParent bool
+	mu          struct {
 		syncutil.Mutex
-		quiesce   *sync.Cond // Conditional variable to wait for outstanding tasks
-		quiescing bool       // true when Stop() has been called
-		numTasks  int        // number of outstanding tasks
-		tasks     map[taskKey]int
-		closers   []Closer
-		cancels   []func()
+		quiesce    *sync.Cond // Conditional variable to wait for outstanding tasks
+		quiescing  bool       // true when Stop() has been called
+		stopping   bool       // true once Stop() has begun to stop the children
+		admit      TaskClass  // lowest class of tasks which are admitted
+		numTasks   int        // number of outstanding tasks
+		classTasks [numTaskClasses]int
+		tasks      map[taskKey]int
+		lastTaskID int64
+		taskStacks map[int64]taskStack // keyed by task ID
+		closers    []Closer
+		cancels    []func()
+		children   []*Stopper // in order of creation
 	}
 }
 
@@ -153,15 +244,49 @@ func OnPanic(handler func(interface{})) Option {
 	return optionPanicHandler(handler)
 }
 
+type optionTrackTaskStacks struct{}
+
+func (optionTrackTaskStacks) apply(stopper *Stopper) {
+	stopper.trackStacks = true
+}
+
+// TrackTaskStacks is an option which lets the Stopper record the stack from
+// which each running task was started, so that RunningTaskStacks can tell
+// which tasks are holding up quiescence. Recording the stacks is expensive;
+// the COCKROACH_STOPPER_TASK_STACKS environment variable enables it for all
+// Stoppers.
+func TrackTaskStacks() Option {
+	return optionTrackTaskStacks{}
+}
+
+type optionStopAfterParent struct{}
+
+func (optionStopAfterParent) apply(stopper *Stopper) {
+	stopper.afterParent = true
+}
+
+// StopAfterParent is an option for NewChild which lets the child be stopped
+// after its parent, once the workers of the parent have exited and its
+// closers have been closed, rather than before it. This suits children
+// whose resources (for example storage engines) have to outlive the tasks
+// and workers of the parent. It has no effect on Stoppers without a
+// parent.
+func StopAfterParent() Option {
+	return optionStopAfterParent{}
+}
+
 // NewStopper returns an instance of Stopper.
 func NewStopper(options ...Option) *Stopper {
 	s := &Stopper{
-		quiescer: make(chan struct{}),
-		stopper:  make(chan struct{}),
-		stopped:  make(chan struct{}),
+		quiescer:    make(chan struct{}),
+		stopper:     make(chan struct{}),
+		stopped:     make(chan struct{}),
+		trackStacks: trackTaskStacks,
+		metrics:     makeTaskMetrics(),
 	}
 
 	s.mu.tasks = map[taskKey]int{}
+	s.mu.taskStacks = map[int64]taskStack{}
 
 	for _, opt := range options {
 		opt.apply(s)
@@ -172,6 +297,48 @@ func NewStopper(options ...Option) *Stopper {
 	return s
 }
 
+// NewChild returns a Stopper which is stopped along with s, but can also be
+// stopped independently. Stopping s stops its children first, in the order in
+// which they were created, so the resources of a parent outlive the tasks and
+// workers of its children, except for the children created with
+// StopAfterParent, which are stopped once s has stopped. Only Stop cascades;
+// quiescing s leaves the children alone. The child inherits the options of s
+// unless they are overridden by the supplied ones. If s is already stopping,
+// the child is returned stopped.
+//
+// A child must not be stopped concurrently with its parent.
+func (s *Stopper) NewChild(options ...Option) *Stopper {
+	child := NewStopper(options...)
+	if child.onPanic == nil {
+		child.onPanic = s.onPanic
+	}
+	child.trackStacks = child.trackStacks || s.trackStacks
+	child.parent = s
+
+	s.mu.Lock()
+	stopping := s.mu.quiescing || s.mu.stopping
+	if !stopping {
+		s.mu.children = append(s.mu.children, child)
+	}
+	s.mu.Unlock()
+	if stopping {
+		child.Stop()
+	}
+	return child
+}
+
+// removeChild unregisters a child which is stopped independently.
+func (s *Stopper) removeChild(child *Stopper) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, c := range s.mu.children {
+		if c == child {
+			s.mu.children = append(s.mu.children[:i], s.mu.children[i+1:]...)
+			return
+		}
+	}
+}
+
 // Recover is used internally by Stopper to provide a hook for recovery of
 // panics on goroutines started by the Stopper. It can also be invoked
 // explicitly (via "defer s.Recover()") on goroutines that are created outside
@@ -214,13 +381,24 @@ func (s *Stopper) AddCloser(c Closer) {
 // function f was not called.
 func (s *Stopper) RunTask(f func()) error {
 	file, line, _ := caller.Lookup(1)
-	key := taskKey{file, line}
-	if !s.runPrelude(key) {
-		return errUnavailable
+	return s.runTask(taskKey{file, line}, ForegroundTask, f)
+}
+
+// RunTaskWithClass is like RunTask, but runs f as a task of the given class.
+// It returns ErrTaskRejected if the class is rejected by RejectTasks.
+func (s *Stopper) RunTaskWithClass(class TaskClass, f func()) error {
+	file, line, _ := caller.Lookup(1)
+	return s.runTask(taskKey{file, line}, class, f)
+}
+
+func (s *Stopper) runTask(key taskKey, class TaskClass, f func()) error {
+	id, err := s.runPrelude(key, class)
+	if err != nil {
+		return err
 	}
 	// Call f.
 	defer s.Recover()
-	defer s.runPostlude(key)
+	defer s.runPostlude(key, class, id)
 	f()
 	return nil
 }
@@ -236,12 +414,13 @@ func (s *Stopper) RunTask(f func()) error {
 func (s *Stopper) RunTaskWithErr(f func() error) error {
 	file, line, _ := caller.Lookup(1)
 	key := taskKey{file, line}
-	if !s.runPrelude(key) {
-		return errUnavailable
+	id, err := s.runPrelude(key, ForegroundTask)
+	if err != nil {
+		return err
 	}
 	// Call f.
 	defer s.Recover()
-	defer s.runPostlude(key)
+	defer s.runPostlude(key, ForegroundTask, id)
 	return f()
 }
 
@@ -249,17 +428,33 @@ func (s *Stopper) RunTaskWithErr(f func() error) error {
 // Stopper is quiescing, in which case the function is not executed.
 func (s *Stopper) RunAsyncTask(ctx context.Context, f func(context.Context)) error {
 	file, line, _ := caller.Lookup(1)
-	key := taskKey{file, line}
-	if !s.runPrelude(key) {
-		return errUnavailable
+	return s.runAsyncTask(ctx, taskKey{file, line}, ForegroundTask, f)
+}
+
+// RunAsyncTaskWithClass is like RunAsyncTask, but runs f as a task of the
+// given class. It returns ErrTaskRejected if the class is rejected by
+// RejectTasks.
+func (s *Stopper) RunAsyncTaskWithClass(
+	ctx context.Context, class TaskClass, f func(context.Context),
+) error {
+	file, line, _ := caller.Lookup(1)
+	return s.runAsyncTask(ctx, taskKey{file, line}, class, f)
+}
+
+func (s *Stopper) runAsyncTask(
+	ctx context.Context, key taskKey, class TaskClass, f func(context.Context),
+) error {
+	id, err := s.runPrelude(key, class)
+	if err != nil {
+		return err
 	}
 
-	ctx, span := tracing.ForkCtxSpan(ctx, fmt.Sprintf("%s:%d", file, line))
+	ctx, span := tracing.ForkCtxSpan(ctx, key.String())
 
 	// Call f.
 	go func() {
 		defer s.Recover()
-		defer s.runPostlude(key)
+		defer s.runPostlude(key, class, id)
 		defer tracing.FinishSpan(span)
 		f(ctx)
 	}()
@@ -311,16 +506,17 @@ func (s *Stopper) RunLimitedAsyncTask(
 	default:
 	}
 
-	if !s.runPrelude(key) {
+	id, err := s.runPrelude(key, ForegroundTask)
+	if err != nil {
 		<-sem
-		return errUnavailable
+		return err
 	}
 
-	ctx, span := tracing.ForkCtxSpan(ctx, fmt.Sprintf("%s:%d", file, line))
+	ctx, span := tracing.ForkCtxSpan(ctx, key.String())
 
 	go func() {
 		defer s.Recover()
-		defer s.runPostlude(key)
+		defer s.runPostlude(key, ForegroundTask, id)
 		defer func() { <-sem }()
 		defer tracing.FinishSpan(span)
 		f(ctx)
@@ -328,22 +524,42 @@ func (s *Stopper) RunLimitedAsyncTask(
 	return nil
 }
 
-func (s *Stopper) runPrelude(key taskKey) bool {
+// runPrelude registers a task of the given class started at the given call
+// site, unless its class is no longer admitted. It returns an ID of the task
+// which must be passed to runPostlude once the task is done.
+func (s *Stopper) runPrelude(key taskKey, class TaskClass) (int64, error) {
+	var stack []byte
+	if s.trackStacks {
+		stack = debug.Stack()
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if s.mu.quiescing {
-		return false
+		return 0, errUnavailable
+	}
+	if class < s.mu.admit {
+		return 0, ErrTaskRejected
 	}
 	s.mu.numTasks++
+	s.mu.classTasks[class]++
+	s.metrics.gauge(class).Inc(1)
 	s.mu.tasks[key]++
-	return true
+	s.mu.lastTaskID++
+	id := s.mu.lastTaskID
+	if stack != nil {
+		s.mu.taskStacks[id] = taskStack{key: key, stack: stack}
+	}
+	return id, nil
 }
 
-func (s *Stopper) runPostlude(key taskKey) {
+func (s *Stopper) runPostlude(key taskKey, class TaskClass, id int64) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.mu.numTasks--
+	s.mu.classTasks[class]--
+	s.metrics.gauge(class).Dec(1)
 	s.mu.tasks[key]--
+	delete(s.mu.taskStacks, id)
 	s.mu.quiesce.Broadcast()
 }
 
@@ -354,6 +570,37 @@ func (s *Stopper) NumTasks() int {
 	return s.mu.numTasks
 }
 
+// NumTasksOfClass returns the number of active tasks of the given class.
+func (s *Stopper) NumTasksOfClass(class TaskClass) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.mu.classTasks[class]
+}
+
+// Metrics returns the gauges of the number of active tasks by class.
+func (s *Stopper) Metrics() *TaskMetrics {
+	return &s.metrics
+}
+
+// RejectTasks makes the Stopper reject new tasks of the given class and all
+// lower classes with ErrTaskRejected, for example while the server is
+// draining. The tasks which are already running are not affected.
+func (s *Stopper) RejectTasks(class TaskClass) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.mu.admit <= class {
+		s.mu.admit = class + 1
+	}
+}
+
+// AdmitTasks undoes RejectTasks. It has no effect on a quiescing Stopper,
+// which rejects all new tasks.
+func (s *Stopper) AdmitTasks() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mu.admit = 0
+}
+
 // A TaskMap is returned by RunningTasks().
 type TaskMap map[string]int
 
@@ -387,6 +634,66 @@ func (s *Stopper) runningTasksLocked() TaskMap {
 	return m
 }
 
+// A TaskStack is the call site and the creation stack of a running task, as
+// returned by RunningTaskStacks().
+type TaskStack struct {
+	Location string
+	Stack    string
+}
+
+// TaskStacks are returned by RunningTaskStacks().
+type TaskStacks []TaskStack
+
+// String implements fmt.Stringer and returns the stacks of the tasks
+// separated by blank lines.
+func (ts TaskStacks) String() string {
+	var buf bytes.Buffer
+	for i, t := range ts {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "task started at %s:\n%s", t.Location, t.Stack)
+	}
+	return buf.String()
+}
+
+// RunningTaskStacks returns the creation stacks of the running tasks, sorted
+// by call site and then by the order in which the tasks were started. It
+// returns nothing unless the Stopper was created with the TrackTaskStacks
+// option.
+func (s *Stopper) RunningTaskStacks() TaskStacks {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.runningTaskStacksLocked()
+}
+
+func (s *Stopper) runningTaskStacksLocked() TaskStacks {
+	ids := make(taskIDs, 0, len(s.mu.taskStacks))
+	for id := range s.mu.taskStacks {
+		ids = append(ids, id)
+	}
+	sort.Sort(ids)
+	ts := make(TaskStacks, 0, len(ids))
+	for _, id := range ids {
+		t := s.mu.taskStacks[id]
+		ts = append(ts, TaskStack{Location: t.key.String(), Stack: string(t.stack)})
+	}
+	sort.Stable(taskStacksByLocation(ts))
+	return ts
+}
+
+type taskIDs []int64
+
+func (ids taskIDs) Len() int           { return len(ids) }
+func (ids taskIDs) Less(i, j int) bool { return ids[i] < ids[j] }
+func (ids taskIDs) Swap(i, j int)      { ids[i], ids[j] = ids[j], ids[i] }
+
+type taskStacksByLocation TaskStacks
+
+func (ts taskStacksByLocation) Len() int           { return len(ts) }
+func (ts taskStacksByLocation) Less(i, j int) bool { return ts[i].Location < ts[j].Location }
+func (ts taskStacksByLocation) Swap(i, j int)      { ts[i], ts[j] = ts[j], ts[i] }
+
 // Stop signals all live workers to stop and then waits for each to
 // confirm it has stopped.
 func (s *Stopper) Stop() {
@@ -410,14 +717,34 @@ func (s *Stopper) Stop() {
 		panic(r)
 	}
 
+	if s.parent != nil {
+		s.parent.removeChild(s)
+	}
+	s.mu.Lock()
+	s.mu.stopping = true
+	children := s.mu.children
+	s.mu.children = nil
+	s.mu.Unlock()
+	var afterChildren []*Stopper
+	for _, child := range children {
+		if child.afterParent {
+			afterChildren = append(afterChildren, child)
+			continue
+		}
+		child.Stop()
+	}
+
 	s.Quiesce()
 	close(s.stopper)
 	s.stop.Wait()
 	s.mu.Lock()
-	defer s.mu.Unlock()
 	for _, c := range s.mu.closers {
 		c.Close()
 	}
+	s.mu.Unlock()
+	for _, child := range afterChildren {
+		child.Stop()
+	}
 	close(s.stopped)
 }
 
@@ -451,10 +778,49 @@ func (s *Stopper) IsStopped() <-chan struct{} {
 	return s.stopped
 }
 
+// StopContext is like Stop, but gives up waiting for the running tasks to
+// complete once the context is done, in which case it returns the call sites
+// of the unfinished tasks along with the context's error so that the caller
+// can escalate. The Stopper is then left quiescing, and Stop or StopContext
+// may be called again. Once all tasks have completed, StopContext stops the
+// workers and closes the closers just like Stop, which is not subject to the
+// context.
+func (s *Stopper) StopContext(ctx context.Context) (TaskMap, error) {
+	if tasks, err := s.QuiesceContext(ctx); err != nil {
+		return tasks, err
+	}
+	s.Stop()
+	return nil, nil
+}
+
 // Quiesce moves the stopper to state quiescing and waits until all
 // tasks complete. This is used from Stop() and unittests.
 func (s *Stopper) Quiesce() {
 	defer s.Recover()
+	_, _ = s.QuiesceContext(context.Background())
+}
+
+// QuiesceContext is like Quiesce, but gives up waiting for the running tasks
+// to complete once the context is done. In that case, it returns the call
+// sites of the unfinished tasks along with the context's error; if the
+// Stopper was created with the TrackTaskStacks option, RunningTaskStacks
+// provides their stacks.
+func (s *Stopper) QuiesceContext(ctx context.Context) (TaskMap, error) {
+	if ctx.Done() != nil {
+		// Wake up the wait below when the context is done.
+		waiting := make(chan struct{})
+		defer close(waiting)
+		go func() {
+			select {
+			case <-ctx.Done():
+				s.mu.Lock()
+				s.mu.quiesce.Broadcast()
+				s.mu.Unlock()
+			case <-waiting:
+			}
+		}()
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	for _, cancel := range s.mu.cancels {
@@ -465,10 +831,14 @@ func (s *Stopper) Quiesce() {
 		close(s.quiescer)
 	}
 	for s.mu.numTasks > 0 {
+		if err := ctx.Err(); err != nil {
+			return s.runningTasksLocked(), err
+		}
 		log.Infof(context.TODO(), "quiescing; tasks left:\n%s", s.runningTasksLocked())
 		// Unlock s.mu, wait for the signal, and lock s.mu.
 		s.mu.quiesce.Wait()
 	}
+	return nil, nil
 }
 
 // WithCancel returns a child context which is cancelled when the Stopper
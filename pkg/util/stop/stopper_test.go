@@ -18,6 +18,8 @@ package stop_test
 
 import (
 	"fmt"
+	"reflect"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -304,6 +306,231 @@ func TestStopperNumTasks(t *testing.T) {
 	s.Stop()
 }
 
+// TestStopperRunningTaskStacks verifies that the creation stacks of running
+// tasks are recorded with the TrackTaskStacks option.
+func TestStopperRunningTaskStacks(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	untracked := stop.NewStopper()
+	defer untracked.Stop()
+	s := stop.NewStopper(stop.TrackTaskStacks())
+
+	c := make(chan struct{})
+	for _, stopper := range []*stop.Stopper{s, untracked} {
+		if err := stopper.RunAsyncTask(context.Background(), func(_ context.Context) {
+			<-c
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.RunTask(func() {
+		stacks := s.RunningTaskStacks()
+		if len(stacks) != 2 {
+			t.Fatalf("expected 2 task stacks, got %d:\n%s", len(stacks), stacks)
+		}
+		for _, ts := range stacks {
+			if !strings.Contains(ts.Location, "stopper_test.go") {
+				t.Errorf("unexpected task location %s", ts.Location)
+			}
+			if !strings.Contains(ts.Stack, "TestStopperRunningTaskStacks") {
+				t.Errorf("expected the stack to contain the test, got:\n%s", ts.Stack)
+			}
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if stacks := untracked.RunningTaskStacks(); len(stacks) != 0 {
+		t.Errorf("expected no task stacks without tracking, got:\n%s", stacks)
+	}
+
+	close(c)
+	util.SucceedsSoon(t, func() error {
+		if stacks := s.RunningTaskStacks(); len(stacks) != 0 {
+			return errors.Errorf("expected no remaining task stacks, got:\n%s", stacks)
+		}
+		return nil
+	})
+	s.Stop()
+}
+
+// TestStopperStopContext verifies that StopContext gives up on tasks which
+// do not complete before the deadline and reports them, and that the
+// Stopper can be stopped once they have completed.
+func TestStopperStopContext(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	s := stop.NewStopper()
+
+	c := make(chan struct{})
+	if err := s.RunAsyncTask(context.Background(), func(_ context.Context) {
+		<-c
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	tasks, err := s.StopContext(ctx)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected %s, got %v", context.DeadlineExceeded, err)
+	}
+	if len(tasks) != 1 {
+		t.Fatalf("expected one unfinished task, got %+v", tasks)
+	}
+	for location := range tasks {
+		if !strings.Contains(location, "stopper_test.go") {
+			t.Errorf("unexpected task location %s", location)
+		}
+	}
+	select {
+	case <-s.ShouldQuiesce():
+	default:
+		t.Fatal("expected the stopper to be quiescing")
+	}
+	select {
+	case <-s.ShouldStop():
+		t.Fatal("expected the stopper not to be stopping")
+	default:
+	}
+
+	close(c)
+	if tasks, err := s.StopContext(context.Background()); err != nil {
+		t.Fatalf("unexpected error %v with unfinished tasks %+v", err, tasks)
+	}
+	select {
+	case <-s.IsStopped():
+	default:
+		t.Fatal("expected the stopper to be stopped")
+	}
+}
+
+// TestStopperNewChild verifies that stopping a Stopper stops its children
+// first, except for those created with StopAfterParent, which are stopped
+// last, and that children can be stopped independently.
+func TestStopperNewChild(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	parent := stop.NewStopper()
+	child1 := parent.NewChild()
+	child2 := parent.NewChild()
+	child3 := parent.NewChild(stop.StopAfterParent())
+
+	var mu syncutil.Mutex
+	var closed []string
+	closer := func(name string) stop.Closer {
+		return stop.CloserFn(func() {
+			mu.Lock()
+			defer mu.Unlock()
+			closed = append(closed, name)
+		})
+	}
+	parent.AddCloser(closer("parent"))
+	child1.AddCloser(closer("child1"))
+	child2.AddCloser(closer("child2"))
+	child3.AddCloser(closer("child3"))
+
+	// Stopping a child leaves the parent and its other children running.
+	child1.Stop()
+	select {
+	case <-child2.ShouldQuiesce():
+		t.Fatal("expected child2 to keep running")
+	case <-parent.ShouldQuiesce():
+		t.Fatal("expected the parent to keep running")
+	default:
+	}
+
+	parent.Stop()
+	for _, s := range []*stop.Stopper{child1, child2, child3} {
+		select {
+		case <-s.IsStopped():
+		default:
+			t.Fatal("expected the children to be stopped")
+		}
+	}
+	if expected := []string{"child1", "child2", "parent", "child3"}; !reflect.DeepEqual(closed, expected) {
+		t.Errorf("expected closers to be closed in order %s, got %s", expected, closed)
+	}
+
+	// Children of a stopped Stopper are returned stopped.
+	select {
+	case <-parent.NewChild().IsStopped():
+	default:
+		t.Fatal("expected a child of a stopped stopper to be stopped")
+	}
+}
+
+// TestStopperRejectTasks verifies that RejectTasks rejects the tasks of the
+// given class and all lower classes, and that the running tasks are counted
+// by class.
+func TestStopperRejectTasks(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	s := stop.NewStopper()
+	defer s.Stop()
+
+	release := make(chan struct{})
+	if err := s.RunAsyncTaskWithClass(context.Background(), stop.BackgroundTask, func(context.Context) {
+		<-release
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if a := s.Metrics().BackgroundTasks.Value(); a != 1 {
+		t.Errorf("expected 1 running background task, got %d", a)
+	}
+	if a := s.Metrics().ForegroundTasks.Value(); a != 0 {
+		t.Errorf("expected no running foreground tasks, got %d", a)
+	}
+
+	s.RejectTasks(stop.BackgroundTask)
+	if err := s.RunTaskWithClass(stop.BackgroundTask, func() {}); err != stop.ErrTaskRejected {
+		t.Errorf("expected the background task to be rejected, got %v", err)
+	}
+	if err := s.RunTask(func() {}); err != nil {
+		t.Errorf("expected the foreground task to run, got %v", err)
+	}
+	if a := s.NumTasksOfClass(stop.BackgroundTask); a != 1 {
+		t.Errorf("expected the running background task to be unaffected, got %d tasks", a)
+	}
+
+	s.AdmitTasks()
+	if err := s.RunTaskWithClass(stop.BackgroundTask, func() {}); err != nil {
+		t.Errorf("expected the background task to run, got %v", err)
+	}
+	close(release)
+}
+
+// TestStopperQuiesceTaskClasses verifies that quiescing rejects the tasks
+// of all classes, even those which are still admitted by RejectTasks.
+func TestStopperQuiesceTaskClasses(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	s := stop.NewStopper()
+
+	release := make(chan struct{})
+	if err := s.RunAsyncTaskWithClass(context.Background(), stop.BackgroundTask, func(context.Context) {
+		<-release
+	}); err != nil {
+		t.Fatal(err)
+	}
+	s.RejectTasks(stop.BackgroundTask)
+	quiesced := make(chan struct{})
+	go func() {
+		s.Quiesce()
+		close(quiesced)
+	}()
+	<-s.ShouldQuiesce()
+
+	if _, ok := s.RunTaskWithClass(stop.BackgroundTask, func() {}).(*roachpb.NodeUnavailableError); !ok {
+		t.Error("expected the background task to be rejected")
+	}
+	if _, ok := s.RunTask(func() {}).(*roachpb.NodeUnavailableError); !ok {
+		t.Error("expected the foreground task to be rejected while quiescing")
+	}
+	s.AdmitTasks()
+	if _, ok := s.RunTask(func() {}).(*roachpb.NodeUnavailableError); !ok {
+		t.Error("expected AdmitTasks to have no effect while quiescing")
+	}
+
+	close(release)
+	<-quiesced
+	s.Stop()
+}
+
 // TestStopperRunTaskPanic ensures that a panic handler can recover panicking
 // tasks, and that no tasks are leaked when they panic.
 func TestStopperRunTaskPanic(t *testing.T) {
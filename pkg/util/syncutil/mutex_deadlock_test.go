@@ -0,0 +1,59 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// +build deadlock
+
+package syncutil
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	deadlock "github.com/sasha-s/go-deadlock"
+)
+
+// Test that acquiring two mutexes in inconsistent orders is reported along
+// with the stacks of the acquisitions, even though the test never actually
+// deadlocks.
+func TestDeadlockLockOrder(t *testing.T) {
+	defer func(onPotentialDeadlock func(), logBuf io.Writer) {
+		deadlock.Opts.OnPotentialDeadlock = onPotentialDeadlock
+		deadlock.Opts.LogBuf = logBuf
+	}(deadlock.Opts.OnPotentialDeadlock, deadlock.Opts.LogBuf)
+
+	var buf bytes.Buffer
+	var reported bool
+	deadlock.Opts.LogBuf = &buf
+	deadlock.Opts.OnPotentialDeadlock = func() { reported = true }
+
+	var a, b Mutex
+	a.Lock()
+	b.Lock()
+	b.Unlock()
+	a.Unlock()
+
+	b.Lock()
+	a.Lock()
+	a.Unlock()
+	b.Unlock()
+
+	if !reported {
+		t.Fatal("expected the inconsistent lock order to be reported")
+	}
+	if !strings.Contains(buf.String(), "mutex_deadlock_test.go") {
+		t.Errorf("expected the report to include the stacks, got:\n%s", buf.String())
+	}
+}
@@ -27,6 +27,7 @@ import (
 	"golang.org/x/net/context"
 
 	"github.com/cockroachdb/cockroach/pkg/util/caller"
+	"github.com/cockroachdb/cockroach/pkg/util/envutil"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 )
@@ -99,43 +100,122 @@ func CleanupDir(dir string) {
 }
 
 // DefaultSucceedsSoonDuration is the maximum amount of time unittests
-// will wait for a condition to become true. See SucceedsSoon().
+// will wait for a condition to become true by default. See SucceedsSoon().
 const DefaultSucceedsSoonDuration = 45 * time.Second
 
+// succeedsSoonDuration overrides DefaultSucceedsSoonDuration, for example on
+// slow CI machines.
+var succeedsSoonDuration = envutil.EnvOrDefaultDuration(
+	"COCKROACH_SUCCEEDS_SOON_DURATION", DefaultSucceedsSoonDuration)
+
+// SucceedsSoonDuration returns the maximum amount of time unittests will
+// wait for a condition to become true. It is DefaultSucceedsSoonDuration
+// unless overridden by the COCKROACH_SUCCEEDS_SOON_DURATION environment
+// variable.
+func SucceedsSoonDuration() time.Duration {
+	return succeedsSoonDuration
+}
+
+// SucceedsSoonOptions configure the retries of SucceedsSoonWithOptions. The
+// zero value of each field selects the behavior of SucceedsSoon.
+type SucceedsSoonOptions struct {
+	// MaxDuration is the time after which the condition is deemed to have
+	// failed. Defaults to SucceedsSoonDuration().
+	MaxDuration time.Duration
+	// InitialBackoff is the wait after the first failed attempt. Defaults to
+	// 1ns.
+	InitialBackoff time.Duration
+	// MaxBackoff bounds the wait between attempts. Defaults to 1s.
+	MaxBackoff time.Duration
+	// Multiplier is the factor by which the wait grows after each attempt.
+	// Defaults to 2.
+	Multiplier float64
+	// ProgressInterval, if set, is the interval at which the error of the
+	// condition is logged while it keeps failing.
+	ProgressInterval time.Duration
+}
+
+func (opts SucceedsSoonOptions) withDefaults() SucceedsSoonOptions {
+	if opts.MaxDuration == 0 {
+		opts.MaxDuration = SucceedsSoonDuration()
+	}
+	if opts.InitialBackoff == 0 {
+		opts.InitialBackoff = 1
+	}
+	if opts.MaxBackoff == 0 {
+		opts.MaxBackoff = time.Second
+	}
+	if opts.Multiplier == 0 {
+		opts.Multiplier = 2
+	}
+	return opts
+}
+
 // SucceedsSoon fails the test (with t.Fatal) unless the supplied
 // function runs without error within a preset maximum duration. The
 // function is invoked immediately at first and then successively with
-// an exponential backoff starting at 1ns and ending at the maximum
-// duration (currently 15s).
+// an exponential backoff starting at 1ns and ending at 1s. The maximum
+// duration is SucceedsSoonDuration().
 func SucceedsSoon(t Tester, fn func() error) {
-	SucceedsSoonDepth(1, t, fn)
+	SucceedsSoonWithOptionsDepth(1, t, SucceedsSoonOptions{}, fn)
 }
 
 // SucceedsSoonDepth is like SucceedsSoon() but with an additional
 // stack depth offset.
 func SucceedsSoonDepth(depth int, t Tester, fn func() error) {
-	if err := RetryForDuration(DefaultSucceedsSoonDuration, fn); err != nil {
+	SucceedsSoonWithOptionsDepth(depth+1, t, SucceedsSoonOptions{}, fn)
+}
+
+// SucceedsSoonWithOptions is like SucceedsSoon() but with the retries
+// configured by opts.
+func SucceedsSoonWithOptions(t Tester, opts SucceedsSoonOptions, fn func() error) {
+	SucceedsSoonWithOptionsDepth(1, t, opts, fn)
+}
+
+// SucceedsSoonWithOptionsDepth is like SucceedsSoonWithOptions() but with an
+// additional stack depth offset.
+func SucceedsSoonWithOptionsDepth(
+	depth int, t Tester, opts SucceedsSoonOptions, fn func() error,
+) {
+	opts = opts.withDefaults()
+	if err := retryWithOptions(opts, fn); err != nil {
 		file, line, _ := caller.Lookup(depth + 1)
-		t.Fatalf("%s:%d, condition failed to evaluate within %s: %s", file, line, DefaultSucceedsSoonDuration, err)
+		t.Fatalf("%s:%d, condition failed to evaluate within %s: %s", file, line, opts.MaxDuration, err)
 	}
 }
 
 // RetryForDuration will retry the given function until it either returns
 // without error, or the given duration has elapsed. The function is invoked
 // immediately at first and then successively with an exponential backoff
-// starting at 1ns and ending at the specified duration.
+// starting at 1ns and ending at 1s.
 func RetryForDuration(duration time.Duration, fn func() error) error {
-	deadline := timeutil.Now().Add(duration)
+	return retryWithOptions(SucceedsSoonOptions{MaxDuration: duration}.withDefaults(), fn)
+}
+
+func retryWithOptions(opts SucceedsSoonOptions, fn func() error) error {
+	start := timeutil.Now()
+	deadline := start.Add(opts.MaxDuration)
+	lastProgress := start
 	var lastErr error
-	for wait := time.Duration(1); timeutil.Now().Before(deadline); wait *= 2 {
+	for wait := opts.InitialBackoff; timeutil.Now().Before(deadline); {
 		lastErr = fn()
 		if lastErr == nil {
 			return nil
 		}
-		if wait > time.Second {
-			wait = time.Second
+		if opts.ProgressInterval > 0 && timeutil.Since(lastProgress) >= opts.ProgressInterval {
+			lastProgress = timeutil.Now()
+			log.Infof(context.TODO(), "condition still failing after %s: %s", lastProgress.Sub(start), lastErr)
 		}
 		time.Sleep(wait)
+		next := time.Duration(float64(wait) * opts.Multiplier)
+		if next == wait && opts.Multiplier > 1 {
+			// Small waits would not grow otherwise.
+			next++
+		}
+		wait = next
+		if wait > opts.MaxBackoff {
+			wait = opts.MaxBackoff
+		}
 	}
 	return lastErr
 }
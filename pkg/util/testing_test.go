@@ -17,6 +17,8 @@
 package util
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -41,6 +43,48 @@ func TestSucceedsSoon(t *testing.T) {
 	})
 }
 
+// recordingTester is a Tester which records the failures of a test.
+type recordingTester struct {
+	failures []string
+}
+
+func (rt *recordingTester) Failed() bool { return len(rt.failures) > 0 }
+
+func (rt *recordingTester) Error(args ...interface{}) { rt.Fatal(args...) }
+
+func (rt *recordingTester) Errorf(format string, args ...interface{}) {
+	rt.Fatalf(format, args...)
+}
+
+func (rt *recordingTester) Fatal(args ...interface{}) {
+	rt.failures = append(rt.failures, fmt.Sprint(args...))
+}
+
+func (rt *recordingTester) Fatalf(format string, args ...interface{}) {
+	rt.failures = append(rt.failures, fmt.Sprintf(format, args...))
+}
+
+func TestSucceedsSoonWithOptions(t *testing.T) {
+	var attempts int
+	rt := &recordingTester{}
+	SucceedsSoonWithOptions(rt, SucceedsSoonOptions{
+		MaxDuration:      50 * time.Millisecond,
+		InitialBackoff:   10 * time.Millisecond,
+		MaxBackoff:       10 * time.Millisecond,
+		ProgressInterval: time.Millisecond,
+	}, func() error {
+		attempts++
+		return errors.New("never")
+	})
+	if len(rt.failures) != 1 || !strings.Contains(rt.failures[0], "within 50ms: never") {
+		t.Errorf("expected the condition to fail, got %q", rt.failures)
+	}
+	// The attempts are spaced by the constant backoff.
+	if attempts < 2 || attempts > 6 {
+		t.Errorf("expected about 5 attempts, got %d", attempts)
+	}
+}
+
 func TestNoZeroField(t *testing.T) {
 	type foo struct {
 		X, Y int
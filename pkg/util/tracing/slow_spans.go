@@ -0,0 +1,129 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package tracing
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/util/envutil"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	basictracer "github.com/opentracing/basictracer-go"
+)
+
+// traceSampleRate is the fraction of traces which are sampled, i.e. whose
+// spans keep their log events in memory until they finish. Unsampled spans
+// only pass their events to net/trace.
+var traceSampleRate = envutil.EnvOrDefaultFloat("COCKROACH_TRACE_SAMPLE_RATE", 0.001)
+
+// slowSpanThreshold is the duration above which finished spans are kept in
+// the buffer of slow spans. Zero disables the buffer.
+var slowSpanThreshold = envutil.EnvOrDefaultDuration("COCKROACH_SLOW_SPAN_THRESHOLD", time.Second)
+
+// slowSpanBufferSize is the number of slow spans kept in memory.
+const slowSpanBufferSize = 100
+
+// sampleTrace decides whether a trace is sampled based on its (random) ID,
+// so that all the spans of a trace agree.
+func sampleTrace(traceID uint64) bool {
+	if traceSampleRate >= 1 {
+		return true
+	}
+	return float64(traceID) < traceSampleRate*math.MaxUint64
+}
+
+// spanRing is a ring buffer of the most recently finished slow spans.
+type spanRing struct {
+	threshold int64 // nanoseconds; accessed atomically
+
+	mu struct {
+		syncutil.Mutex
+		spans [slowSpanBufferSize]basictracer.RawSpan
+		next  int // index at which the next span is written
+		count int // number of spans in the buffer
+	}
+}
+
+var slowSpans = &spanRing{threshold: int64(slowSpanThreshold)}
+
+// record adds the span to the buffer if it exceeded the threshold. It is
+// called for every finished span, so the common case must be cheap.
+func (r *spanRing) record(sp basictracer.RawSpan) {
+	threshold := atomic.LoadInt64(&r.threshold)
+	if threshold <= 0 || sp.Duration < time.Duration(threshold) {
+		return
+	}
+	// The tags and logs of finished spans may be reused by the tracer.
+	if sp.Tags != nil {
+		tags := make(map[string]interface{}, len(sp.Tags))
+		for k, v := range sp.Tags {
+			tags[k] = v
+		}
+		sp.Tags = tags
+	}
+	sp.Logs = append(sp.Logs[:0:0], sp.Logs...)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.mu.spans[r.mu.next] = sp
+	r.mu.next = (r.mu.next + 1) % len(r.mu.spans)
+	if r.mu.count < len(r.mu.spans) {
+		r.mu.count++
+	}
+}
+
+// get returns the spans in the buffer, oldest first.
+func (r *spanRing) get() []basictracer.RawSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	spans := make([]basictracer.RawSpan, 0, r.mu.count)
+	start := r.mu.next - r.mu.count
+	if start < 0 {
+		start += len(r.mu.spans)
+	}
+	for i := 0; i < r.mu.count; i++ {
+		spans = append(spans, r.mu.spans[(start+i)%len(r.mu.spans)])
+	}
+	return spans
+}
+
+// reset empties the buffer.
+func (r *spanRing) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.mu.spans = [slowSpanBufferSize]basictracer.RawSpan{}
+	r.mu.next, r.mu.count = 0, 0
+}
+
+// SlowSpans returns the most recently finished spans of the tracers created
+// by NewTracer which exceeded the slow span threshold, oldest first. Only the
+// spans of sampled traces include their log events.
+func SlowSpans() []basictracer.RawSpan {
+	return slowSpans.get()
+}
+
+// SlowSpanThreshold returns the duration above which finished spans are
+// returned by SlowSpans.
+func SlowSpanThreshold() time.Duration {
+	return time.Duration(atomic.LoadInt64(&slowSpans.threshold))
+}
+
+// SetSlowSpanThreshold changes the duration above which finished spans are
+// returned by SlowSpans and empties the buffer. Zero disables the buffer.
+func SetSlowSpanThreshold(threshold time.Duration) {
+	atomic.StoreInt64(&slowSpans.threshold, int64(threshold))
+	slowSpans.reset()
+}
@@ -0,0 +1,89 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package tracing
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	basictracer "github.com/opentracing/basictracer-go"
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+func TestSampleTrace(t *testing.T) {
+	defer func(rate float64) { traceSampleRate = rate }(traceSampleRate)
+
+	testCases := []struct {
+		rate    float64
+		traceID uint64
+		exp     bool
+	}{
+		{0, 0, false},
+		{0, math.MaxUint64, false},
+		{0.5, 0, true},
+		{0.5, math.MaxUint64 / 4, true},
+		{0.5, math.MaxUint64 / 4 * 3, false},
+		{1, math.MaxUint64 - 1, true},
+	}
+	for i, tc := range testCases {
+		traceSampleRate = tc.rate
+		if a := sampleTrace(tc.traceID); a != tc.exp {
+			t.Errorf("%d: rate %f, trace %d: expected %t, got %t", i, tc.rate, tc.traceID, tc.exp, a)
+		}
+	}
+}
+
+func TestSlowSpans(t *testing.T) {
+	defer SetSlowSpanThreshold(SlowSpanThreshold())
+	SetSlowSpanThreshold(time.Second)
+
+	tr := basictracer.NewWithOptions(basictracerOptions(nil))
+	finish := func(op string, duration time.Duration) {
+		start := timeutil.Now()
+		sp := tr.StartSpan(op, opentracing.StartTime(start))
+		sp.SetTag("op", op)
+		sp.FinishWithOptions(opentracing.FinishOptions{FinishTime: start.Add(duration)})
+	}
+
+	finish("fast", time.Millisecond)
+	finish("slow", 2*time.Second)
+	spans := SlowSpans()
+	if len(spans) != 1 || spans[0].Operation != "slow" || spans[0].Tags["op"] != "slow" {
+		t.Fatalf("expected only the slow span, got %+v", spans)
+	}
+
+	// The buffer keeps the most recent spans.
+	for i := 0; i < slowSpanBufferSize+5; i++ {
+		finish(fmt.Sprintf("slow%d", i), 2*time.Second)
+	}
+	spans = SlowSpans()
+	if len(spans) != slowSpanBufferSize {
+		t.Fatalf("expected %d spans, got %d", slowSpanBufferSize, len(spans))
+	}
+	for i, sp := range spans {
+		if e := fmt.Sprintf("slow%d", i+5); sp.Operation != e {
+			t.Errorf("%d: expected span %s, got %s", i, e, sp.Operation)
+		}
+	}
+
+	SetSlowSpanThreshold(0)
+	finish("disabled", time.Hour)
+	if spans := SlowSpans(); len(spans) != 0 {
+		t.Errorf("expected no spans, got %+v", spans)
+	}
+}
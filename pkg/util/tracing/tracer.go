@@ -193,15 +193,18 @@ func basictracerOptions(recorder func(basictracer.RawSpan)) basictracer.Options
 	opts.TrimUnsampledSpans = true
 	opts.NewSpanEventListener = netTraceIntegrator
 	opts.DebugAssertUseAfterFinish = true // provoke crash on use-after-Finish
+	// Set a comfortable limit of log events per span.
+	opts.MaxLogsPerSpan = maxLogsPerSpan
 	if recorder == nil {
-		opts.Recorder = CallbackRecorder(func(_ basictracer.RawSpan) {})
-		// If we are not recording the spans, there is no need to keep them in
-		// memory. Events still get passed to netTraceIntegrator.
-		opts.DropAllLogs = true
+		// Finished spans are only recorded if they are slow. A fraction of the
+		// traces is sampled so that some of the slow spans come with their log
+		// events; the events of unsampled spans are not kept in memory, but
+		// still get passed to netTraceIntegrator.
+		opts.ShouldSample = sampleTrace
+		opts.Recorder = CallbackRecorder(slowSpans.record)
+		opts.DropAllLogs = traceSampleRate <= 0
 	} else {
 		opts.Recorder = CallbackRecorder(recorder)
-		// Set a comfortable limit of log events per span.
-		opts.MaxLogsPerSpan = maxLogsPerSpan
 	}
 	return opts
 }
@@ -223,16 +226,31 @@ var newTracer = func() opentracing.Tracer {
 		if lightstepOnly {
 			return lsTr
 		}
-		basicTr := basictracer.NewWithOptions(basictracerOptions(nil))
+		basicTr := newBasicTracer()
 		// The TeeTracer uses the first tracer for serialization of span contexts;
 		// lightspan needs to be first because it correlates spans between nodes.
 		return NewTeeTracer(lsTr, basicTr)
 	}
-	return basictracer.NewWithOptions(basictracerOptions(nil))
+	return newBasicTracer()
 }
 
-// NewTracer creates a Tracer which records to the net/trace
-// endpoint.
+// newBasicTracer creates the basictracer used by NewTracer, which also exports
+// spans to COCKROACH_ZIPKIN_COLLECTOR if set.
+func newBasicTracer() opentracing.Tracer {
+	opts := basictracerOptions(nil)
+	if zipkinCollector != "" {
+		recorder, exporter := opts.Recorder, getZipkinExporter()
+		opts.Recorder = CallbackRecorder(func(sp basictracer.RawSpan) {
+			recorder.RecordSpan(sp)
+			exporter.RecordSpan(sp)
+		})
+	}
+	return basictracer.NewWithOptions(opts)
+}
+
+// NewTracer creates a Tracer which records to the net/trace endpoint. The
+// sampled traces are also exported to a Zipkin or Jaeger collector if one is
+// configured through COCKROACH_ZIPKIN_COLLECTOR.
 func NewTracer() opentracing.Tracer {
 	return newTracer()
 }
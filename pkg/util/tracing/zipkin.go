@@ -0,0 +1,239 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/util/envutil"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	basictracer "github.com/opentracing/basictracer-go"
+)
+
+// zipkinCollector is the URL of a collector accepting spans in the Zipkin v1
+// JSON format, such as http://localhost:9411/api/v1/spans. Jaeger collectors
+// accept this format on their Zipkin port as well. The spans of sampled
+// traces (see COCKROACH_TRACE_SAMPLE_RATE) are exported to it.
+var zipkinCollector = envutil.EnvOrDefaultString("COCKROACH_ZIPKIN_COLLECTOR", "")
+
+// zipkinServiceName identifies this process in the exported spans.
+var zipkinServiceName = envutil.EnvOrDefaultString("COCKROACH_ZIPKIN_SERVICE_NAME", "cockroach")
+
+const (
+	// zipkinBufferSize is the number of spans buffered for export. Spans are
+	// dropped while the buffer is full.
+	zipkinBufferSize = 1000
+	// zipkinBatchSize is the maximum number of spans sent in one request.
+	zipkinBatchSize = 100
+	// zipkinFlushInterval is the maximum time spans are buffered for.
+	zipkinFlushInterval = time.Second
+	// zipkinTimeout bounds the time spent sending a batch of spans.
+	zipkinTimeout = 10 * time.Second
+)
+
+// zipkinEndpoint is the Zipkin representation of the service which recorded
+// an annotation.
+type zipkinEndpoint struct {
+	ServiceName string `json:"serviceName"`
+}
+
+type zipkinAnnotation struct {
+	Timestamp int64           `json:"timestamp"`
+	Value     string          `json:"value"`
+	Endpoint  *zipkinEndpoint `json:"endpoint,omitempty"`
+}
+
+type zipkinBinaryAnnotation struct {
+	Key      string          `json:"key"`
+	Value    string          `json:"value"`
+	Endpoint *zipkinEndpoint `json:"endpoint,omitempty"`
+}
+
+// zipkinSpan is a span in the Zipkin v1 JSON format. Timestamps and durations
+// are in microseconds.
+type zipkinSpan struct {
+	TraceID           string                   `json:"traceId"`
+	ID                string                   `json:"id"`
+	ParentID          string                   `json:"parentId,omitempty"`
+	Name              string                   `json:"name"`
+	Timestamp         int64                    `json:"timestamp"`
+	Duration          int64                    `json:"duration"`
+	Annotations       []zipkinAnnotation       `json:"annotations,omitempty"`
+	BinaryAnnotations []zipkinBinaryAnnotation `json:"binaryAnnotations,omitempty"`
+}
+
+func zipkinID(id uint64) string {
+	return fmt.Sprintf("%016x", id)
+}
+
+func zipkinTimestamp(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Microsecond)
+}
+
+// makeZipkinSpan converts a finished span. Its log events become annotations
+// and its tags binary annotations.
+func makeZipkinSpan(sp basictracer.RawSpan, serviceName string) zipkinSpan {
+	endpoint := &zipkinEndpoint{ServiceName: serviceName}
+	zs := zipkinSpan{
+		TraceID:   zipkinID(sp.Context.TraceID),
+		ID:        zipkinID(sp.Context.SpanID),
+		Name:      sp.Operation,
+		Timestamp: zipkinTimestamp(sp.Start),
+		Duration:  int64(sp.Duration / time.Microsecond),
+	}
+	if sp.ParentSpanID != 0 {
+		zs.ParentID = zipkinID(sp.ParentSpanID)
+	}
+	for _, l := range sp.Logs {
+		var buf bytes.Buffer
+		for i, f := range l.Fields {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			buf.WriteString(f.String())
+		}
+		zs.Annotations = append(zs.Annotations, zipkinAnnotation{
+			Timestamp: zipkinTimestamp(l.Timestamp),
+			Value:     buf.String(),
+			Endpoint:  endpoint,
+		})
+	}
+	for k, v := range sp.Tags {
+		zs.BinaryAnnotations = append(zs.BinaryAnnotations, zipkinBinaryAnnotation{
+			Key:      k,
+			Value:    fmt.Sprint(v),
+			Endpoint: endpoint,
+		})
+	}
+	if zs.BinaryAnnotations == nil {
+		// Zipkin only associates spans without annotations with a service
+		// through a local component annotation.
+		zs.BinaryAnnotations = []zipkinBinaryAnnotation{{
+			Key:      "lc",
+			Value:    "",
+			Endpoint: endpoint,
+		}}
+	}
+	return zs
+}
+
+// zipkinExporter sends the finished spans of sampled traces to a Zipkin (or
+// Jaeger) collector in batches. It implements basictracer.SpanRecorder.
+type zipkinExporter struct {
+	url           string
+	serviceName   string
+	flushInterval time.Duration
+	client        http.Client
+	spans         chan zipkinSpan
+}
+
+var _ basictracer.SpanRecorder = &zipkinExporter{}
+
+func newZipkinExporter(url, serviceName string, flushInterval time.Duration) *zipkinExporter {
+	e := &zipkinExporter{
+		url:           url,
+		serviceName:   serviceName,
+		flushInterval: flushInterval,
+		client:        http.Client{Timeout: zipkinTimeout},
+		spans:         make(chan zipkinSpan, zipkinBufferSize),
+	}
+	go e.run()
+	return e
+}
+
+var zipkinExporterOnce struct {
+	sync.Once
+	e *zipkinExporter
+}
+
+// getZipkinExporter returns the exporter for COCKROACH_ZIPKIN_COLLECTOR,
+// which is shared by all the tracers of the process.
+func getZipkinExporter() *zipkinExporter {
+	zipkinExporterOnce.Do(func() {
+		zipkinExporterOnce.e = newZipkinExporter(zipkinCollector, zipkinServiceName, zipkinFlushInterval)
+	})
+	return zipkinExporterOnce.e
+}
+
+// RecordSpan implements basictracer.SpanRecorder. Spans of unsampled traces
+// are ignored. The span is converted right away, since its tags and logs may
+// be reused once it is recorded.
+func (e *zipkinExporter) RecordSpan(sp basictracer.RawSpan) {
+	if !sp.Context.Sampled {
+		return
+	}
+	select {
+	case e.spans <- makeZipkinSpan(sp, e.serviceName):
+	default:
+	}
+}
+
+func (e *zipkinExporter) run() {
+	var timer timeutil.Timer
+	defer timer.Stop()
+	var batch []zipkinSpan
+	var lastErr error
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		err := e.send(batch)
+		if err != nil && lastErr == nil {
+			// The tracing package cannot log; only report the first of a series
+			// of errors to avoid flooding stderr while the collector is down.
+			fmt.Fprintf(os.Stderr, "tracing: unable to export spans to %s: %s\n", e.url, err)
+		}
+		lastErr = err
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case sp := <-e.spans:
+			if len(batch) == 0 {
+				timer.Reset(e.flushInterval)
+			}
+			batch = append(batch, sp)
+			if len(batch) >= zipkinBatchSize {
+				flush()
+			}
+		case <-timer.C:
+			timer.Read = true
+			flush()
+		}
+	}
+}
+
+// send posts a batch of spans to the collector.
+func (e *zipkinExporter) send(batch []zipkinSpan) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+	return nil
+}
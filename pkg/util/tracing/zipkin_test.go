@@ -0,0 +1,85 @@
+// Copyright 2016 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package tracing
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	basictracer "github.com/opentracing/basictracer-go"
+	opentracing "github.com/opentracing/opentracing-go"
+	otlog "github.com/opentracing/opentracing-go/log"
+)
+
+func TestZipkinExporter(t *testing.T) {
+	batches := make(chan []zipkinSpan, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch []zipkinSpan
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			t.Error(err)
+		}
+		batches <- batch
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+
+	e := newZipkinExporter(ts.URL, "test", time.Millisecond)
+	start := time.Unix(10, 0)
+	e.RecordSpan(basictracer.RawSpan{
+		Context:   basictracer.SpanContext{TraceID: 1, SpanID: 3},
+		Operation: "unsampled",
+	})
+	e.RecordSpan(basictracer.RawSpan{
+		Context:      basictracer.SpanContext{TraceID: 1, SpanID: 2, Sampled: true},
+		ParentSpanID: 0xabc,
+		Operation:    "sampled",
+		Start:        start,
+		Duration:     5 * time.Millisecond,
+		Tags:         opentracing.Tags{"node": 1},
+		Logs: []opentracing.LogRecord{{
+			Timestamp: start.Add(time.Millisecond),
+			Fields:    []otlog.Field{otlog.String("event", "read"), otlog.Int("keys", 3)},
+		}},
+	})
+
+	var batch []zipkinSpan
+	select {
+	case batch = <-batches:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for spans")
+	}
+	endpoint := &zipkinEndpoint{ServiceName: "test"}
+	exp := []zipkinSpan{{
+		TraceID:   "0000000000000001",
+		ID:        "0000000000000002",
+		ParentID:  "0000000000000abc",
+		Name:      "sampled",
+		Timestamp: 10000000,
+		Duration:  5000,
+		Annotations: []zipkinAnnotation{
+			{Timestamp: 10001000, Value: "event:read keys:3", Endpoint: endpoint},
+		},
+		BinaryAnnotations: []zipkinBinaryAnnotation{
+			{Key: "node", Value: "1", Endpoint: endpoint},
+		},
+	}}
+	if !reflect.DeepEqual(batch, exp) {
+		t.Errorf("expected %+v, got %+v", exp, batch)
+	}
+}